@@ -5,6 +5,8 @@ import (
 	"alda.io/client/help"
 	log "alda.io/client/logging"
 	"alda.io/client/parser"
+	"alda.io/client/system"
+	"bytes"
 	"fmt"
 	"github.com/spf13/cobra"
 	"io"
@@ -15,6 +17,7 @@ var formatInputFile string
 var formatOverwrite bool
 var formatConfiguredWrapLen int
 var formatConfiguredIndentText string
+var formatMaxLineWidth int
 
 func init() {
 	formatCmd.Flags().StringVarP(
@@ -26,11 +29,21 @@ func init() {
 	)
 
 	formatCmd.Flags().IntVarP(
-		&formatConfiguredWrapLen, "wrap", "w", 0, "Configured line character length to wrap formatted output (default 80)",
+		&formatConfiguredWrapLen, "wrap", "w", 0, fmt.Sprintf(
+			"Configured line character length to wrap formatted output (default %d)",
+			parser.DefaultSoftWrap,
+		),
 	)
 
 	formatCmd.Flags().StringVarP(
-		&formatConfiguredIndentText, "indent", "i", "", "Configured indent text (default two spaces)",
+		&formatConfiguredIndentText, "indent", "i", "", fmt.Sprintf(
+			"Configured indent text (default %q)", parser.DefaultIndentText,
+		),
+	)
+
+	formatCmd.Flags().IntVar(
+		&formatMaxLineWidth, "max-width", 0,
+		"Fail if any formatted line is longer than this (default no limit)",
 	)
 }
 
@@ -42,10 +55,13 @@ var formatCmd = &cobra.Command{
 
 ---
 
-Source code must be provided by specifying the path to a file (-f, --file):
+Source code can be provided by specifying the path to a file (-f, --file):
   alda format -f path/to/my-score.alda
 
-In this case, the formatted output will be printed to standard output.
+or piped in via stdin:
+  cat path/to/my-score.alda | alda format
+
+In either case, the formatted output will be printed to standard output.
 
 When -o / --overwrite is specified, the input file is instead overwritten.
   alda format -f path/to/my-score.alda -o
@@ -53,6 +69,10 @@ When -o / --overwrite is specified, the input file is instead overwritten.
 Formatted output can be configured with the -w / --wrap and -i / --indent flags.
   alda format -f path/to/my-score.alda -w 120 -i "    "
 
+Lines that can't be wrapped (e.g. long S-expressions) can exceed the wrap
+length. To fail instead, e.g. in CI, set a hard limit with --max-width.
+  alda format -f path/to/my-score.alda --max-width 120
+
 ---
 
 Currently, formatting cannot handle comments (i.e. all comments are dropped)
@@ -65,28 +85,36 @@ Currently, formatting cannot handle comments (i.e. all comments are dropped)
 			color.Aurora.BrightYellow("format"),
 		))
 
-		root, err := parser.ParseFile(formatInputFile)
-		if err != nil {
-			return err
-		}
+		var root parser.ASTNode
+		var err error
 
-		var out io.Writer
-		if formatOverwrite {
-			f, err := os.OpenFile(
-				formatInputFile,
-				os.O_WRONLY|os.O_TRUNC,
-				0664, // default rw-rw-r perms
+		if formatInputFile != "" {
+			root, err = parser.ParseFile(formatInputFile)
+		} else if formatOverwrite {
+			return help.UserFacingErrorf(
+				`The %s option requires an input file (%s).`,
+				color.Aurora.BrightYellow("--overwrite"),
+				color.Aurora.BrightYellow("--file"),
 			)
-			if err != nil {
+		} else {
+			root, err = parseStdin()
+			if err == system.ErrNoInputSupplied {
 				return help.UserFacingErrorf(
-					`Issue opening file %s.`,
-					color.Aurora.BrightYellow(outputAldaFilename),
+					`No Alda source code input supplied.
+
+Please provide the path to a file (%s) or pipe source code into stdin.`,
+					color.Aurora.BrightYellow("--file"),
 				)
 			}
-			defer f.Close()
-			out = f
-		} else {
-			out = os.Stdout
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// Duplicate aliases don't prevent formatting, but the score won't play.
+		if err := parser.CheckAliases(root); err != nil {
+			log.Warn().Err(err).Msg("Duplicate part alias.")
 		}
 
 		if formatConfiguredWrapLen < 0 {
@@ -96,29 +124,30 @@ Currently, formatting cannot handle comments (i.e. all comments are dropped)
 			)
 		}
 
-		if formatConfiguredWrapLen > 0 && len(formatConfiguredIndentText) > 0 {
-			err = parser.FormatASTToCode(
-				root,
-				out,
-				parser.ConfigureSoftWrapLen(formatConfiguredWrapLen),
-				parser.ConfigureIndentText(formatConfiguredIndentText),
-			)
-		} else if formatConfiguredWrapLen > 0 {
-			err = parser.FormatASTToCode(
-				root,
-				out,
-				parser.ConfigureSoftWrapLen(formatConfiguredWrapLen),
-			)
-		} else if len(formatConfiguredIndentText) > 0 {
-			err = parser.FormatASTToCode(
-				root,
-				out,
-				parser.ConfigureIndentText(formatConfiguredIndentText),
+		wrapLenOption := parser.Identity()
+		if formatConfiguredWrapLen > 0 {
+			wrapLenOption = parser.ConfigureSoftWrapLen(formatConfiguredWrapLen)
+		}
+
+		indentTextOption := parser.Identity()
+		if len(formatConfiguredIndentText) > 0 {
+			indentTextOption = parser.ConfigureIndentText(formatConfiguredIndentText)
+		}
+
+		if formatMaxLineWidth < 0 {
+			return help.UserFacingErrorf(
+				`Configured maximum line width %d must be positive.`,
+				formatMaxLineWidth,
 			)
-		} else {
-			err = parser.FormatASTToCode(root, out)
 		}
 
+		// We format to a buffer first so that, if formatting fails, we don't
+		// truncate the input file when overwriting it.
+		formatted := bytes.Buffer{}
+		err = parser.FormatASTToCode(
+			root, &formatted, wrapLenOption, indentTextOption,
+			parser.ConfigureMaxLineWidth(formatMaxLineWidth),
+		)
 		if err != nil {
 			return help.UserFacingErrorf(
 				`Issue formatting Alda: %s.`,
@@ -126,6 +155,26 @@ Currently, formatting cannot handle comments (i.e. all comments are dropped)
 			)
 		}
 
-		return nil
+		var out io.Writer
+		if formatOverwrite {
+			f, err := os.OpenFile(
+				formatInputFile,
+				os.O_WRONLY|os.O_TRUNC,
+				0664, // default rw-rw-r perms
+			)
+			if err != nil {
+				return help.UserFacingErrorf(
+					`Issue opening file %s.`,
+					color.Aurora.BrightYellow(outputAldaFilename),
+				)
+			}
+			defer f.Close()
+			out = f
+		} else {
+			out = os.Stdout
+		}
+
+		_, err = out.Write(formatted.Bytes())
+		return err
 	},
 }
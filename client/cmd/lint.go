@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"alda.io/client/color"
+	"alda.io/client/help"
+	"alda.io/client/lint"
+	log "alda.io/client/logging"
+	"alda.io/client/parser"
+	"alda.io/client/system"
+	"github.com/spf13/cobra"
+)
+
+var lintInputFile string
+var lintOutputFormat string
+var lintFailOnWarnings bool
+
+func init() {
+	lintCmd.Flags().StringVarP(
+		&lintInputFile, "file", "f", "", "Input Alda file to lint",
+	)
+
+	lintCmd.Flags().StringVar(
+		&lintOutputFormat, "output", "text",
+		`Output format: "text", "json" or "line"`,
+	)
+
+	lintCmd.Flags().BoolVar(
+		&lintFailOnWarnings, "fail-on-warnings", false,
+		"Exit unsuccessfully if there are warnings, not just errors",
+	)
+}
+
+var lintCmd = &cobra.Command{
+	Use:    "lint",
+	Hidden: true,
+	Short:  "Check Alda source code for likely mistakes",
+	Long: `Check Alda source code for likely mistakes
+
+---
+
+Source code can be provided by specifying the path to a file (-f, --file):
+  alda lint -f path/to/my-score.alda
+
+or piped in via stdin:
+  cat path/to/my-score.alda | alda lint
+
+The problems found are printed to standard output. For tools like editor
+plugins, --output json prints a JSON array with an object for each problem,
+and --output line prints a line per problem, with its fields separated by
+colons.
+  alda lint -f path/to/my-score.alda --output json
+
+Rules can be configured in a .alda-lint.json file in the directory of the input
+file or one of its parent directories (or the current directory, for stdin).
+
+---
+
+Exit codes:
+  0  no problems, or only warnings and info
+  1  errors, or warnings when --fail-on-warnings is specified
+  2  the source code can't be parsed
+
+---`,
+	RunE: func(_ *cobra.Command, args []string) error {
+		format, err := lint.ParseOutputFormat(lintOutputFormat)
+		if err != nil {
+			return help.UserFacingErrorf(`%s.`, err.Error())
+		}
+
+		configDir := "."
+		if lintInputFile != "" {
+			configDir = filepath.Dir(lintInputFile)
+		}
+
+		config, err := lint.LoadConfig(configDir)
+		if err != nil {
+			return help.UserFacingErrorf(
+				`Issue loading lint configuration: %s.`, err.Error(),
+			)
+		}
+
+		for _, warning := range config.Warnings {
+			log.Warn().Msg(warning)
+		}
+
+		comments := []parser.SourceComment{}
+
+		// Syntax errors are reported as diagnostics (see lint.SyntaxErrors), so
+		// the error returned by the parser is ignored.
+		var root parser.ASTNode
+
+		if lintInputFile != "" {
+			file, err := os.Open(lintInputFile)
+			if err != nil {
+				return help.UserFacingErrorf(
+					`Issue opening file %s.`,
+					color.Aurora.BrightYellow(lintInputFile),
+				)
+			}
+			defer file.Close()
+
+			root, _ = parser.ParseReader(
+				lintInputFile, file, parser.CollectComments(&comments),
+			)
+		} else {
+			reader, err := system.StdinReader()
+			if err == system.ErrNoInputSupplied {
+				return help.UserFacingErrorf(
+					`No Alda source code input supplied.
+
+Please provide the path to a file (%s) or pipe source code into stdin.`,
+					color.Aurora.BrightYellow("--file"),
+				)
+			}
+			if err != nil {
+				return err
+			}
+
+			root, _ = parser.ParseReader(
+				"", reader, parser.CollectComments(&comments),
+			)
+		}
+
+		diagnostics := lint.LintWithConfig(root, comments, config)
+
+		if err := lint.WriteDiagnostics(
+			os.Stdout, diagnostics, format,
+		); err != nil {
+			return err
+		}
+
+		if code := lint.ExitCode(
+			diagnostics, lintFailOnWarnings,
+		); code != lint.ExitClean {
+			return &help.ExitCodeError{Code: code}
+		}
+
+		return nil
+	},
+}
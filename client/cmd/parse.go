@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	encjson "encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"alda.io/client/color"
@@ -15,6 +17,7 @@ import (
 )
 
 var outputType string
+var dumpPositions bool
 
 func init() {
 	parseCmd.Flags().StringVarP(
@@ -28,6 +31,13 @@ func init() {
 	parseCmd.Flags().StringVarP(
 		&outputType, "output", "o", "data", "The desired parse output",
 	)
+
+	parseCmd.Flags().BoolVar(
+		&dumpPositions,
+		"positions",
+		false,
+		"Include source positions in the ast-sexp output",
+	)
 }
 
 var parseCmd = &cobra.Command{
@@ -54,6 +64,12 @@ ast-human:
   The AST that results from parsing the source code, displayed in a more
   human-readable way.
 
+ast-sexp:
+
+  The AST that results from parsing the source code, displayed as a compact
+  S-expression, for debugging. Use --positions to include the line and column
+  of each node.
+
 events:
 
   A JSON array of objects, each of which represents an "event" parsed from the
@@ -70,7 +86,7 @@ data (default):
 	),
 	RunE: func(_ *cobra.Command, args []string) error {
 		switch outputType {
-		case "ast", "ast-human", "events", "data": // OK to proceed
+		case "ast", "ast-human", "ast-sexp", "events", "data": // OK to proceed
 		default:
 			return help.UserFacingErrorf(
 				`%s is not a supported output type.
@@ -85,6 +101,10 @@ Please choose one of:
   The AST that results from parsing the source code, displayed in a more
   human-readable way.
 
+  %s
+  The AST that results from parsing the source code, displayed as a compact
+  S-expression, for debugging.
+
   %s
   A JSON array of objects, each of which represents an "event" parsed from the
   source code.
@@ -96,6 +116,7 @@ Please choose one of:
 				color.Aurora.BrightYellow(outputType),
 				color.Aurora.BrightYellow("ast"),
 				color.Aurora.BrightYellow("ast-human"),
+				color.Aurora.BrightYellow("ast-sexp"),
 				color.Aurora.BrightYellow("events"),
 				color.Aurora.BrightYellow("data"),
 			)
@@ -133,7 +154,7 @@ Please choose one of:
 		// number and display the error message at the relevant position in the
 		// file.
 		switch err.(type) {
-		case *model.AldaSourceError:
+		case *model.AldaSourceError, *parser.ParseErrors:
 			err = &help.UserFacingError{Err: err}
 		}
 
@@ -142,7 +163,14 @@ Please choose one of:
 		}
 
 		if outputType == "ast" {
-			fmt.Println(ast.JSON().String())
+			// The encoding/json representation of the AST includes the type of each
+			// literal, so that the output can be read back in by tooling.
+			astJSON, err := encjson.Marshal(ast)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(string(astJSON))
 
 			return nil
 		}
@@ -169,6 +197,14 @@ Please choose one of:
 			return nil
 		}
 
+		if outputType == "ast-sexp" {
+			if dumpPositions {
+				return parser.DumpAST(ast, os.Stdout, parser.DumpSourceContext)
+			}
+
+			return parser.DumpAST(ast, os.Stdout)
+		}
+
 		scoreUpdates, err = ast.Updates()
 
 		// Errors with source context are presented to the user as-is.
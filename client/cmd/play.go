@@ -64,12 +64,12 @@ func init() {
 // Returns a different error if the input couldn't be parsed as valid Alda code,
 // or if something else went wrong.
 func parseStdin() (parser.ASTNode, error) {
-	bytes, err := system.ReadStdin()
+	reader, err := system.StdinReader()
 	if err != nil {
 		return parser.ASTNode{}, err
 	}
 
-	return parser.ParseString(string(bytes))
+	return parser.ParseReader("", reader)
 }
 
 func sourceCodeInputOptions(command string, useColor bool) string {
@@ -175,7 +175,7 @@ var playCmd = &cobra.Command{
 		// TODO: See TODO comment in cmd/parse.go about writing better user-facing
 		// error messages.
 		switch err.(type) {
-		case *model.AldaSourceError:
+		case *model.AldaSourceError, *parser.ParseErrors:
 			err = &help.UserFacingError{Err: err}
 		}
 
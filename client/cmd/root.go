@@ -243,11 +243,13 @@ Use "{{.CommandPath}} [command] --help" for more information about a command.{{e
 		formatCmd,
 		importCmd,
 		instrumentsCmd,
+		lintCmd,
 		parseCmd,
 		playCmd,
 		psCmd,
 		replCmd,
 		shutdownCmd,
+		statsCmd,
 		stopCmd,
 		telemetryCmd,
 		updateCmd,
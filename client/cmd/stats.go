@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"alda.io/client/color"
+	"alda.io/client/help"
+	log "alda.io/client/logging"
+	"alda.io/client/model"
+	"alda.io/client/parser"
+	"alda.io/client/system"
+	"github.com/spf13/cobra"
+)
+
+var statsInputFiles []string
+var statsJSON bool
+
+func init() {
+	statsCmd.Flags().StringArrayVarP(
+		&statsInputFiles, "file", "f", nil,
+		"Input Alda file to analyze (can be given more than once)",
+	)
+
+	statsCmd.Flags().BoolVar(
+		&statsJSON, "json", false, "Print the statistics as JSON",
+	)
+}
+
+// statsCount is a parser.Count as it's written in JSON output.
+type statsCount struct {
+	Written int `json:"written"`
+	Played  int `json:"played"`
+}
+
+func newStatsCount(count parser.Count) statsCount {
+	return statsCount{Written: count.Written, Played: count.Expanded}
+}
+
+// statsPart is the statistics of a part, as they're written in JSON output.
+type statsPart struct {
+	Names       []string   `json:"names"`
+	Alias       string     `json:"alias,omitempty"`
+	Instruments []string   `json:"instruments"`
+	Notes       statsCount `json:"notes"`
+	Rests       statsCount `json:"rests"`
+	Chords      statsCount `json:"chords"`
+	Measures    int        `json:"measures"`
+}
+
+// statsScore is the statistics of a score, as they're written in JSON output.
+type statsScore struct {
+	File  string      `json:"file,omitempty"`
+	Parts []statsPart `json:"parts,omitempty"`
+	// The number of scores, in the aggregate of more than one
+	Scores          int        `json:"scores,omitempty"`
+	Notes           statsCount `json:"notes"`
+	Rests           statsCount `json:"rests"`
+	Chords          statsCount `json:"chords"`
+	Measures        int        `json:"measures"`
+	DurationMs      *float64   `json:"durationMs"`
+	Variables       int        `json:"variables"`
+	Markers         int        `json:"markers"`
+	MaxNestingDepth int        `json:"maxNestingDepth"`
+	// Problems that left the statistics incomplete, e.g. a syntax error
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// analyzeScore computes the statistics of a score, given the AST and the
+// error, if any, from parsing it. A score with a syntax error still has
+// statistics for the part of it that could be parsed, and a score that can't
+// be evaluated has no duration. In either case, there's a warning.
+func analyzeScore(file string, root parser.ASTNode, parseErr error) statsScore {
+	stats := parser.Analyze(root)
+
+	score := statsScore{
+		File:            file,
+		Parts:           []statsPart{},
+		Notes:           newStatsCount(stats.Notes),
+		Rests:           newStatsCount(stats.Rests),
+		Chords:          newStatsCount(stats.Chords),
+		Measures:        stats.Measures,
+		Variables:       stats.VariableDefinitions,
+		Markers:         stats.Markers,
+		MaxNestingDepth: stats.MaxNestingDepth,
+		Warnings:        []string{},
+	}
+
+	for _, part := range stats.PartStats {
+		score.Parts = append(score.Parts, statsPart{
+			Names:       part.Names,
+			Alias:       part.Alias,
+			Instruments: part.Instruments,
+			Notes:       newStatsCount(part.Notes),
+			Rests:       newStatsCount(part.Rests),
+			Chords:      newStatsCount(part.Chords),
+			Measures:    part.Measures,
+		})
+	}
+
+	if parseErr != nil {
+		score.Warnings = append(score.Warnings, fmt.Sprintf(
+			"the statistics only include the source code before a syntax error: "+
+				"%s", parseErr,
+		))
+		return score
+	}
+
+	updates, err := root.Updates()
+	if err == nil {
+		modelScore := model.NewScore()
+		if err = modelScore.Update(updates...); err == nil {
+			duration := modelScore.DurationMs()
+			score.DurationMs = &duration
+		}
+	}
+
+	if err != nil {
+		score.Warnings = append(score.Warnings, fmt.Sprintf(
+			"the duration is unknown, because the score can't be evaluated: %s",
+			err,
+		))
+	}
+
+	return score
+}
+
+// aggregateStats adds up the statistics of several scores. The duration is
+// known if it's known for every score.
+func aggregateStats(scores []statsScore) statsScore {
+	total := statsScore{Scores: len(scores), Warnings: []string{}}
+	duration := 0.0
+	durationKnown := true
+
+	add := func(sum *statsCount, count statsCount) {
+		sum.Written += count.Written
+		sum.Played += count.Played
+	}
+
+	for _, score := range scores {
+		add(&total.Notes, score.Notes)
+		add(&total.Rests, score.Rests)
+		add(&total.Chords, score.Chords)
+		total.Measures += score.Measures
+		total.Variables += score.Variables
+		total.Markers += score.Markers
+
+		if score.MaxNestingDepth > total.MaxNestingDepth {
+			total.MaxNestingDepth = score.MaxNestingDepth
+		}
+
+		if score.DurationMs == nil {
+			durationKnown = false
+		} else {
+			duration += *score.DurationMs
+		}
+	}
+
+	if durationKnown {
+		total.DurationMs = &duration
+	}
+
+	return total
+}
+
+func formatStatsDuration(durationMs *float64) string {
+	if durationMs == nil {
+		return "unknown"
+	}
+
+	return time.Duration(*durationMs * float64(time.Millisecond)).
+		Round(time.Millisecond).String()
+}
+
+// writeStatsTable writes the statistics of a score as a table, with a row per
+// part, followed by the statistics that aren't per part.
+func writeStatsTable(out io.Writer, score statsScore) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, score.File)
+	fmt.Fprintln(w, "part\tinstruments\tnotes\trests\tchords\tmeasures")
+
+	for _, part := range score.Parts {
+		name := strings.Join(part.Names, "/")
+		if part.Alias != "" {
+			name = fmt.Sprintf("%s \"%s\"", name, part.Alias)
+		}
+
+		fmt.Fprintf(
+			w, "%s\t%s\t%d\t%d\t%d\t%d\n", name,
+			strings.Join(part.Instruments, ", "), part.Notes.Played,
+			part.Rests.Played, part.Chords.Played, part.Measures,
+		)
+	}
+
+	fmt.Fprintf(
+		w, "total\t\t%d\t%d\t%d\t%d\n", score.Notes.Played,
+		score.Rests.Played, score.Chords.Played, score.Measures,
+	)
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(
+		out,
+		"\nduration: %s, variables: %d, markers: %d, max nesting depth: %d\n",
+		formatStatsDuration(score.DurationMs), score.Variables, score.Markers,
+		score.MaxNestingDepth,
+	)
+	return err
+}
+
+// writeStatsSummary writes the statistics of several scores as a table, with
+// a row per score, followed by a row with their aggregate.
+func writeStatsSummary(
+	out io.Writer, scores []statsScore, total statsScore,
+) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(
+		w, "file\tnotes\trests\tchords\tmeasures\tduration\tvariables\t"+
+			"markers\tmax nesting depth",
+	)
+
+	for _, score := range append(scores, total) {
+		file := score.File
+		if score.Scores > 0 {
+			file = fmt.Sprintf("total (%d scores)", score.Scores)
+		}
+
+		fmt.Fprintf(
+			w, "%s\t%d\t%d\t%d\t%d\t%s\t%d\t%d\t%d\n", file,
+			score.Notes.Played, score.Rests.Played, score.Chords.Played,
+			score.Measures, formatStatsDuration(score.DurationMs), score.Variables,
+			score.Markers, score.MaxNestingDepth,
+		)
+	}
+
+	return w.Flush()
+}
+
+var statsCmd = &cobra.Command{
+	Use:    "stats",
+	Hidden: true,
+	Short:  "Print statistics about Alda scores",
+	Long: `Print statistics about Alda scores
+
+---
+
+Source code can be provided by specifying the paths to one or more files (-f,
+--file):
+  alda stats -f path/to/my-score.alda -f path/to/another-score.alda
+
+or piped in via stdin:
+  cat path/to/my-score.alda | alda stats
+
+For each score, a table is printed with the instruments of each part and its
+numbers of notes, rests, chords and measures, followed by the duration of the
+score, and its numbers of variables and markers. When more than one file is
+given, a summary of all of the scores follows.
+
+Counts are of what is played, e.g. [c d]*4 counts as 8 notes. The notes, rests
+and chords in a variable definition are counted wherever the variable is
+referenced, and not at all if it isn't. The --json option prints both the
+number of occurrences in the source code ("written"), where the events in a
+variable definition count towards the total of a score, but not towards any
+part, and the number that are played ("played").
+
+A score with a syntax error still gets statistics for the source code before
+the error, with a warning.
+
+---`,
+	RunE: func(_ *cobra.Command, args []string) error {
+		scores := []statsScore{}
+
+		if len(statsInputFiles) == 0 {
+			root, err := parseStdin()
+			if err == system.ErrNoInputSupplied {
+				return help.UserFacingErrorf(
+					`No Alda source code input supplied.
+
+Please provide the path to a file (%s) or pipe source code into stdin.`,
+					color.Aurora.BrightYellow("--file"),
+				)
+			}
+
+			scores = append(scores, analyzeScore("<stdin>", root, err))
+		}
+
+		for _, file := range statsInputFiles {
+			contents, err := os.ReadFile(file)
+			if err != nil {
+				return help.UserFacingErrorf(
+					`Issue reading file %s: %s`,
+					color.Aurora.BrightYellow(file), err,
+				)
+			}
+
+			root, err := parser.Parse(file, string(contents))
+			scores = append(scores, analyzeScore(file, root, err))
+		}
+
+		for _, score := range scores {
+			for _, warning := range score.Warnings {
+				log.Warn().Str("file", score.File).Msg(warning)
+			}
+		}
+
+		var total *statsScore
+		if len(scores) > 1 {
+			aggregate := aggregateStats(scores)
+			total = &aggregate
+		}
+
+		if statsJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+
+			return encoder.Encode(struct {
+				Scores []statsScore `json:"scores"`
+				Total  *statsScore  `json:"total,omitempty"`
+			}{scores, total})
+		}
+
+		for i, score := range scores {
+			if i > 0 {
+				fmt.Println()
+			}
+
+			if err := writeStatsTable(os.Stdout, score); err != nil {
+				return err
+			}
+		}
+
+		if total != nil {
+			fmt.Println()
+			return writeStatsSummary(os.Stdout, scores, *total)
+		}
+
+		return nil
+	},
+}
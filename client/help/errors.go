@@ -66,11 +66,25 @@ func (ue *UsageError) Error() string {
 	)
 }
 
+// ExitCodeError signifies that a command has already reported its outcome,
+// e.g. the problems found by `alda lint`, and that the process should exit
+// with a particular exit code without presenting an error.
+type ExitCodeError struct {
+	Code int
+}
+
+// Error returns a string representation of an ExitCodeError.
+func (ece *ExitCodeError) Error() string {
+	return fmt.Sprintf("exit code %d", ece.Code)
+}
+
 // PresentError prints an error message in a way that is helpful for the user.
 //
 // Inspired by the guidance in https://clig.dev/#errors
 func PresentError(err error) {
 	switch e := err.(type) {
+	case *ExitCodeError:
+		// The command has already reported its outcome.
 	case *UserFacingError, *UsageError:
 		fmt.Fprintln(os.Stderr, e)
 	default:
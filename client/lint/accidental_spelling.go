@@ -0,0 +1,44 @@
+package lint
+
+import (
+	"fmt"
+
+	"alda.io/client/model"
+	"alda.io/client/parser"
+)
+
+// AccidentalSpelling notes (as Info) notes whose accidentals go against those
+// of the key signature, e.g. `a-` where the key signature has sharps, which
+// can make a score hard to read, especially when the same pitch is spelled
+// both ways. Each diagnostic suggests the same pitch spelled in keeping with
+// the key signature, e.g. `g+` (see parser.FindRespellings).
+//
+// This is a matter of style, and either spelling can be the right one, so this
+// is an optional rule (see OptionalRules). It says nothing where no key
+// signature is set.
+var AccidentalSpelling = Rule{
+	ID:          "accidental-spelling",
+	Description: "accidentals spelled against the key signature",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		for _, respelling := range parser.FindRespellings(root) {
+			written, key := "flat", "sharps"
+			if respelling.KeyAccidental == model.Flat {
+				written, key = "sharp", "flats"
+			}
+
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: Info,
+				Context:  respelling.Context,
+				Message: fmt.Sprintf(
+					"note %s is spelled with a %s, while the key signature has %s",
+					respelling.Written, written, key,
+				),
+				Suggestion: respelling.Respelled,
+			})
+		}
+
+		return diagnostics
+	},
+}
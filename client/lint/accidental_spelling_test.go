@@ -0,0 +1,104 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestAccidentalSpelling(t *testing.T) {
+	executeLintTestCases(
+		t,
+		AccidentalSpelling,
+		lintTestCase{
+			label:    "no key signature",
+			given:    "piano: g+ a- b- c+ | a-/c/e- d+",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "key signature written as the name of a scale",
+			given: "piano: (key-sig '(g major)) a- d-",
+			expected: []string{
+				"piece.alda:1:29 info: note a- is spelled with a flat, while the " +
+					"key signature has sharps; did you mean \"g+\"? " +
+					"(accidental-spelling)",
+				"piece.alda:1:32 info: note d- is spelled with a flat, while the " +
+					"key signature has sharps; did you mean \"c+\"? " +
+					"(accidental-spelling)",
+			},
+		},
+		lintTestCase{
+			label: "sharp key",
+			given: "piano: (key-sig \"f+\") g+ a- | d- c- b-- f_ f+",
+			expected: []string{
+				"piece.alda:1:26 info: note a- is spelled with a flat, while the " +
+					"key signature has sharps; did you mean \"g+\"? " +
+					"(accidental-spelling)",
+				"piece.alda:1:31 info: note d- is spelled with a flat, while the " +
+					"key signature has sharps; did you mean \"c+\"? " +
+					"(accidental-spelling)",
+				"piece.alda:1:34 info: note c- is spelled with a flat, while the " +
+					"key signature has sharps; did you mean \"b\"? " +
+					"(accidental-spelling)",
+				"piece.alda:1:37 info: note b-- is spelled with a flat, while the " +
+					"key signature has sharps; did you mean \"a\"? " +
+					"(accidental-spelling)",
+			},
+		},
+		lintTestCase{
+			label: "natural sign where the key signature changes a letter",
+			given: "piano: (key-sig '(f (sharp) c (sharp) g (sharp) d (sharp) " +
+				"a (sharp) e (sharp))) f-",
+			expected: []string{
+				"piece.alda:1:81 info: note f- is spelled with a flat, while the " +
+					"key signature has sharps; did you mean \"e_\"? " +
+					"(accidental-spelling)",
+			},
+		},
+		lintTestCase{
+			label: "flat key",
+			given: "piano: (key-sig \"b- e-\") b- c+ | a+/e+ d",
+			expected: []string{
+				"piece.alda:1:29 info: note c+ is spelled with a sharp, while the " +
+					"key signature has flats; did you mean \"d-\"? " +
+					"(accidental-spelling)",
+				"piece.alda:1:34 info: note a+ is spelled with a sharp, while the " +
+					"key signature has flats; did you mean \"b-\"? " +
+					"(accidental-spelling)",
+				"piece.alda:1:37 info: note e+ is spelled with a sharp, while the " +
+					"key signature has flats; did you mean \"f\"? " +
+					"(accidental-spelling)",
+			},
+		},
+		lintTestCase{
+			label: "key signature of each part",
+			given: "(key-sig! \"b-\")\npiano: c+ (key-sig \"f+\") d-\n" +
+				"violin: c+ (key-sig \"\") d-",
+			expected: []string{
+				"piece.alda:2:8 info: note c+ is spelled with a sharp, while the " +
+					"key signature has flats; did you mean \"d-\"? " +
+					"(accidental-spelling)",
+				"piece.alda:2:26 info: note d- is spelled with a flat, while the " +
+					"key signature has sharps; did you mean \"c+\"? " +
+					"(accidental-spelling)",
+				"piece.alda:3:9 info: note c+ is spelled with a sharp, while the " +
+					"key signature has flats; did you mean \"d-\"? " +
+					"(accidental-spelling)",
+			},
+		},
+		lintTestCase{
+			label: "repeated note",
+			given: "piano: (key-sig \"f+\") [a- b]*4",
+			expected: []string{
+				"piece.alda:1:24 info: note a- is spelled with a flat, while the " +
+					"key signature has sharps; did you mean \"g+\"? " +
+					"(accidental-spelling)",
+			},
+		},
+		lintTestCase{
+			label:    "percussion",
+			given:    "percussion \"drums\": (key-sig \"f+\") a- d-\ndrums: e-",
+			expected: []string{},
+		},
+	)
+}
@@ -0,0 +1,87 @@
+package lint
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"alda.io/client/parser"
+)
+
+// An attributeRange is the range of plausible values of the number given to an
+// attribute, e.g. `(vol 50)`.
+type attributeRange struct {
+	// The names of the attribute, without the `!` of its global version
+	names []string
+	// The lowest and highest plausible values
+	min, max float64
+}
+
+// attributeRanges are the attributes whose values AttributeRanges checks. To
+// check another attribute that takes a single number, add it here.
+var attributeRanges = []attributeRange{
+	// Below 1, the tempo is rejected when the score is evaluated.
+	{names: []string{"tempo"}, min: 1, max: 1000},
+	{names: []string{"volume", "vol"}, min: 0, max: 100},
+	{names: []string{"track-volume", "track-vol"}, min: 0, max: 100},
+	{names: []string{"quantization", "quantize", "quant"}, min: 0, max: 100},
+	{names: []string{"panning", "pan"}, min: 0, max: 100},
+	{names: []string{"octave"}, min: parser.MinOctave, max: parser.MaxOctave},
+}
+
+// AttributeRanges reports attribute changes whose value is implausible, e.g.
+// `(tempo! 0)`, `(vol 250)` or `(quant -5)`, along with the range of plausible
+// values. Some of these are rejected when the score is evaluated, with a less
+// helpful error, and the rest play in surprising ways.
+//
+// Only attribute changes with a single number as their value are checked, e.g.
+// not `(tempo 2 60)` or `(octave 'up)`.
+var AttributeRanges = Rule{
+	ID:          "attribute-range",
+	Description: "attribute changes with implausible values",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		ranges := map[string]attributeRange{}
+		for _, attribute := range attributeRanges {
+			for _, name := range attribute.names {
+				ranges[name] = attribute
+			}
+		}
+
+		for _, list := range topLevelLispLists(root) {
+			if len(list.Children) != 2 ||
+				list.Children[0].Type != parser.LispSymbolNode ||
+				list.Children[1].Type != parser.LispNumberNode {
+				continue
+			}
+
+			name, _ := list.Children[0].Literal.(string)
+			attribute, ok := ranges[strings.TrimSuffix(name, "!")]
+			if !ok {
+				continue
+			}
+
+			argument := list.Children[1]
+			value, _ := argument.Literal.(float64)
+			if attribute.min <= value && value <= attribute.max {
+				continue
+			}
+
+			diagnostics = append(diagnostics, Diagnostic{
+				Context: argument.SourceContext,
+				Message: fmt.Sprintf(
+					"implausible value for \"%s\": %s, outside the range %s to %s",
+					name, formatNumber(value), formatNumber(attribute.min),
+					formatNumber(attribute.max),
+				),
+			})
+		}
+
+		return diagnostics
+	},
+}
+
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
@@ -0,0 +1,57 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestAttributeRanges(t *testing.T) {
+	executeLintTestCases(
+		t,
+		AttributeRanges,
+		lintTestCase{
+			label: "values at the boundaries",
+			given: "piano: (tempo 1) (tempo! 1000) (vol 0) (vol 100)\n" +
+				"(track-vol 0) (track-volume 100) (quant 0) (quantization 100)\n" +
+				"(pan 0) (panning! 100) (octave -1) (octave 9)",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "values beyond the boundaries",
+			given: "piano: (tempo! 0) (tempo 1000.5) (vol -1) (volume 250)\n" +
+				"(track-vol 101) (quant -5) (quantize 100.5) (pan -0.5)\n" +
+				"(pan! 101) (octave -2) (octave! 10)",
+			expected: []string{
+				"piece.alda:1:16 implausible value for \"tempo!\": 0, outside the " +
+					"range 1 to 1000 (attribute-range)",
+				"piece.alda:1:26 implausible value for \"tempo\": 1000.5, outside " +
+					"the range 1 to 1000 (attribute-range)",
+				"piece.alda:1:39 implausible value for \"vol\": -1, outside the " +
+					"range 0 to 100 (attribute-range)",
+				"piece.alda:1:51 implausible value for \"volume\": 250, outside the " +
+					"range 0 to 100 (attribute-range)",
+				"piece.alda:2:12 implausible value for \"track-vol\": 101, outside " +
+					"the range 0 to 100 (attribute-range)",
+				"piece.alda:2:24 implausible value for \"quant\": -5, outside the " +
+					"range 0 to 100 (attribute-range)",
+				"piece.alda:2:38 implausible value for \"quantize\": 100.5, outside " +
+					"the range 0 to 100 (attribute-range)",
+				"piece.alda:2:50 implausible value for \"pan\": -0.5, outside the " +
+					"range 0 to 100 (attribute-range)",
+				"piece.alda:3:7 implausible value for \"pan!\": 101, outside the " +
+					"range 0 to 100 (attribute-range)",
+				"piece.alda:3:20 implausible value for \"octave\": -2, outside the " +
+					"range -1 to 9 (attribute-range)",
+				"piece.alda:3:33 implausible value for \"octave!\": 10, outside the " +
+					"range -1 to 9 (attribute-range)",
+			},
+		},
+		lintTestCase{
+			label: "other forms",
+			given: "piano: (tempo 2 600000) (octave 'up) (vol (* 50 10))\n" +
+				"(reverb 500)",
+			expected: []string{},
+		},
+	)
+}
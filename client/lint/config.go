@@ -0,0 +1,201 @@
+package lint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"alda.io/client/parser"
+)
+
+// ConfigFilename is the name of a lint configuration file (see LoadConfig).
+const ConfigFilename = ".alda-lint.json"
+
+// A Config selects which rules run, and the severity of the diagnostics of
+// each rule. The zero value runs the rules that run by default (see Rules)
+// with the severities that they report.
+//
+// In a configuration file, it's written as a JSON object whose "rules" map
+// rule IDs to "off", "on", "error", "warning" or "info", e.g.
+//
+//	{"rules": {"unused-variable": "off", "measure-length": "error"}}
+//
+// "on" runs a rule with the severities that it reports. A rule that isn't
+// mentioned is on, unless it's optional (see OptionalRules), in which case it's
+// off. Any setting other than "off" turns an optional rule on.
+type Config struct {
+	// Disabled are the IDs of the rules that don't run.
+	Disabled map[string]bool
+	// Enabled are the IDs of the optional rules (see OptionalRules) that run.
+	Enabled map[string]bool
+	// Severities are the severities of the diagnostics of rules whose severity
+	// is overridden, keyed by rule ID.
+	Severities map[string]Severity
+	// Warnings are problems with the configuration that don't stop it from
+	// being used, e.g. a rule ID that isn't the ID of any rule, which is
+	// ignored.
+	Warnings []string
+}
+
+// ParseConfig parses the contents of a lint configuration file. A value that
+// isn't a known setting is an error, while a rule ID that isn't the ID of an
+// available rule is a warning (see Config.Warnings), so that a configuration
+// file can mention rules that are added in later versions.
+func ParseConfig(data []byte) (Config, error) {
+	config := Config{
+		Disabled:   map[string]bool{},
+		Enabled:    map[string]bool{},
+		Severities: map[string]Severity{},
+	}
+
+	var file struct {
+		Rules map[string]string `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return Config{}, fmt.Errorf("invalid lint configuration: %w", err)
+	}
+
+	ids := []string{}
+	for id := range file.Rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		setting := file.Rules[id]
+
+		if _, ok := LookupRule(id); !ok {
+			config.Warnings = append(config.Warnings, fmt.Sprintf(
+				"unknown lint rule \"%s\" in configuration", id,
+			))
+			continue
+		}
+
+		if setting != "off" {
+			for _, rule := range OptionalRules {
+				if rule.ID == id {
+					config.Enabled[id] = true
+				}
+			}
+		}
+
+		switch setting {
+		case "off":
+			config.Disabled[id] = true
+		case "on":
+		case "error":
+			config.Severities[id] = Error
+		case "warning":
+			config.Severities[id] = Warning
+		case "info":
+			config.Severities[id] = Info
+		default:
+			return Config{}, fmt.Errorf(
+				"invalid lint configuration: unknown setting \"%s\" for rule "+
+					"\"%s\", expected \"off\", \"on\", \"error\", \"warning\" or "+
+					"\"info\"",
+				setting, id,
+			)
+		}
+	}
+
+	return config, nil
+}
+
+// FindConfig returns the path of the lint configuration file (see
+// ConfigFilename) that applies to the files in a directory: the one in the
+// directory, or else in the closest of its parent directories that has one.
+// Returns false if there isn't one.
+func FindConfig(dir string) (string, bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false, err
+	}
+
+	for {
+		path := filepath.Join(dir, ConfigFilename)
+
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, true, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", false, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false, nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig finds and parses the lint configuration file that applies to the
+// files in a directory (see FindConfig), or returns the zero Config if there
+// isn't one.
+func LoadConfig(dir string) (Config, error) {
+	path, ok, err := FindConfig(dir)
+	if err != nil || !ok {
+		return Config{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	config, err := ParseConfig(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Rules returns the available rules that the configuration runs, in the
+// order in which they're run by default, followed by the optional rules that
+// it enables.
+func (c Config) Rules() []Rule {
+	rules := []Rule{}
+	for _, rule := range Rules {
+		if !c.Disabled[rule.ID] {
+			rules = append(rules, rule)
+		}
+	}
+
+	for _, rule := range OptionalRules {
+		if c.Enabled[rule.ID] && !c.Disabled[rule.ID] {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// LintWithConfig runs the rules that a configuration selects over the AST, like
+// Lint, gives their diagnostics the severities that it sets, and leaves out the
+// ones that are suppressed by the given comments (see Suppress), which are the
+// comments of the source code that the AST was parsed from (see
+// parser.CollectComments).
+func LintWithConfig(
+	root parser.ASTNode, comments []parser.SourceComment, config Config,
+) []Diagnostic {
+	rules := config.Rules()
+	if len(rules) == 0 {
+		return []Diagnostic{}
+	}
+
+	diagnostics := Lint(root, rules...)
+	for i, diagnostic := range diagnostics {
+		if severity, ok := config.Severities[diagnostic.RuleID]; ok {
+			diagnostics[i].Severity = severity
+		}
+	}
+
+	return Suppress(diagnostics, comments)
+}
@@ -0,0 +1,252 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"alda.io/client/parser"
+	_ "alda.io/client/testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"rules": {
+		"unused-variable": "off",
+		"measure-length": "error",
+		"trailing-tie": "info",
+		"octave-range": "on",
+		"accidental-spelling": "on",
+		"unused-varaible": "off",
+		"no-such-rule": "error"
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Config{
+		Disabled: map[string]bool{"unused-variable": true},
+		Enabled:  map[string]bool{"accidental-spelling": true},
+		Severities: map[string]Severity{
+			"measure-length": Error,
+			"trailing-tie":   Info,
+		},
+		Warnings: []string{
+			"unknown lint rule \"no-such-rule\" in configuration",
+			"unknown lint rule \"unused-varaible\" in configuration",
+		},
+	}
+
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected: %#v\nactual: %#v", expected, config)
+	}
+
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected string
+	}{
+		{
+			label: "unknown setting",
+			given: `{"rules": {"unused-variable": "disabled"}}`,
+			expected: "invalid lint configuration: unknown setting \"disabled\" " +
+				"for rule \"unused-variable\", expected \"off\", \"on\", " +
+				"\"error\", \"warning\" or \"info\"",
+		},
+		{
+			label: "invalid JSON",
+			given: `{"rules": ["unused-variable"]}`,
+			expected: "invalid lint configuration: json: cannot unmarshal array " +
+				"into Go struct field .rules of type map[string]string",
+		},
+	} {
+		_, err := ParseConfig([]byte(testCase.given))
+		if err == nil || err.Error() != testCase.expected {
+			t.Errorf(
+				"%s\nexpected: %q\nactual: %v", testCase.label, testCase.expected,
+				err,
+			)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "scores", "drafts")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a configuration file, everything runs as it would by default.
+	config, err := LoadConfig(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Rules()) != len(Rules) {
+		t.Errorf("expected all %d rules, got %d", len(Rules), len(config.Rules()))
+	}
+
+	path := filepath.Join(root, ConfigFilename)
+	if err := os.WriteFile(
+		path, []byte(`{"rules": {"unused-variable": "off"}}`), 0644,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// The configuration file in a parent directory applies.
+	found, ok, err := FindConfig(nested)
+	if err != nil || !ok || found != path {
+		t.Errorf("expected to find %s, got %q, %v, %v", path, found, ok, err)
+	}
+
+	config, err = LoadConfig(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.Disabled["unused-variable"] {
+		t.Errorf("expected unused-variable to be disabled: %#v", config)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"rules": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(nested); err == nil {
+		t.Errorf("expected an error for an invalid configuration file")
+	}
+}
+
+func TestLintWithConfig(t *testing.T) {
+	given := "unused = c\npiano: (vol 250) c1~ | d"
+
+	for _, testCase := range []struct {
+		label    string
+		config   string
+		expected []string
+	}{
+		{
+			label:  "default configuration",
+			config: `{}`,
+			expected: []string{
+				"piece.alda:1:1 variable \"unused\" is defined but never used " +
+					"(unused-variable)",
+				"piece.alda:2:13 implausible value for \"vol\": 250, outside the " +
+					"range 0 to 100 (attribute-range)",
+				"piece.alda:2:20 info: tie into a note of a different pitch, which " +
+					"is a slur (trailing-tie)",
+			},
+		},
+		{
+			label: "disabled rules and severity overrides",
+			config: `{"rules": {
+				"unused-variable": "off",
+				"attribute-range": "error",
+				"trailing-tie": "warning"
+			}}`,
+			expected: []string{
+				"piece.alda:2:13 error: implausible value for \"vol\": 250, " +
+					"outside the range 0 to 100 (attribute-range)",
+				"piece.alda:2:20 tie into a note of a different pitch, which is a " +
+					"slur (trailing-tie)",
+			},
+		},
+		{
+			label: "all rules disabled",
+			config: `{"rules": {
+				"unused-variable": "off",
+				"attribute-range": "off",
+				"trailing-tie": "off"
+			}}`,
+			expected: []string{},
+		},
+	} {
+		config, err := ParseConfig([]byte(testCase.config))
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+
+		// The rules that don't find anything in the score are disabled too.
+		for _, rule := range Rules {
+			switch rule.ID {
+			case "unused-variable", "attribute-range", "trailing-tie":
+			default:
+				config.Disabled[rule.ID] = true
+			}
+		}
+
+		root, err := parser.Parse("piece.alda", given)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual := []string{}
+		for _, diagnostic := range LintWithConfig(root, nil, config) {
+			actual = append(actual, diagnostic.String())
+		}
+
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf(
+				"%s\nexpected: %q\nactual: %q",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+func TestConfigOptionalRules(t *testing.T) {
+	root, err := parser.Parse("piece.alda", "piano: (key-sig \"f+\") a-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range []struct {
+		label    string
+		config   string
+		expected []string
+	}{
+		{
+			label:    "optional rules are off by default",
+			config:   `{}`,
+			expected: []string{},
+		},
+		{
+			label:  "optional rule turned on",
+			config: `{"rules": {"accidental-spelling": "on"}}`,
+			expected: []string{
+				"piece.alda:1:23 info: note a- is spelled with a flat, while the " +
+					"key signature has sharps; did you mean \"g+\"? " +
+					"(accidental-spelling)",
+			},
+		},
+		{
+			label:  "optional rule turned on with a severity",
+			config: `{"rules": {"accidental-spelling": "warning"}}`,
+			expected: []string{
+				"piece.alda:1:23 note a- is spelled with a flat, while the key " +
+					"signature has sharps; did you mean \"g+\"? " +
+					"(accidental-spelling)",
+			},
+		},
+		{
+			label:    "optional rule turned off",
+			config:   `{"rules": {"accidental-spelling": "off"}}`,
+			expected: []string{},
+		},
+	} {
+		config, err := ParseConfig([]byte(testCase.config))
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+
+		actual := []string{}
+		for _, diagnostic := range LintWithConfig(root, nil, config) {
+			actual = append(actual, diagnostic.String())
+		}
+
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf(
+				"%s\nexpected: %q\nactual: %q",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"alda.io/client/parser"
+)
+
+// DuplicateMarkers reports markers, e.g. `%chorus`, that are defined more than
+// once in a score, in any of its parts, which makes it ambiguous where a jump
+// to the marker, e.g. `@chorus`, goes. Each definition is reported, along with
+// the positions of the others.
+//
+// A marker that's defined once within a repeat is only written once, so it
+// isn't reported, even though it's placed once per repetition. To also report
+// markers whose names differ only by case, see DuplicateMarkersIgnoringCase.
+var DuplicateMarkers = duplicateMarkers(false)
+
+// DuplicateMarkersIgnoringCase is a version of the DuplicateMarkers rule that
+// also reports markers whose names differ only by case, e.g. `%chorus` and
+// `%Chorus`, which are distinct, but easily confused.
+var DuplicateMarkersIgnoringCase = duplicateMarkers(true)
+
+func duplicateMarkers(ignoreCase bool) Rule {
+	return Rule{
+		ID:          "duplicate-marker",
+		Description: "markers that are defined more than once",
+		Check: func(root parser.ASTNode) []Diagnostic {
+			diagnostics := []Diagnostic{}
+
+			// The definitions of each marker, in the order in which they're written
+			definitions := map[string][]parser.ASTNode{}
+
+			for _, ref := range root.FindByType(parser.MarkerNode) {
+				name, _ := ref.Node.Literal.(string)
+				if ignoreCase {
+					name = strings.ToLower(name)
+				}
+
+				definitions[name] = append(definitions[name], ref.Node)
+			}
+
+			for _, ref := range root.FindByType(parser.MarkerNode) {
+				name, _ := ref.Node.Literal.(string)
+				key := name
+				if ignoreCase {
+					key = strings.ToLower(name)
+				}
+
+				if len(definitions[key]) < 2 {
+					continue
+				}
+
+				others := []string{}
+				for _, other := range definitions[key] {
+					context := other.SourceContext
+					if context == ref.Node.SourceContext {
+						continue
+					}
+
+					position := fmt.Sprintf(
+						"at line %d, column %d", context.Line, context.Column,
+					)
+					if otherName, _ := other.Literal.(string); otherName != name {
+						position = fmt.Sprintf("as \"%s\" %s", otherName, position)
+					}
+
+					others = append(others, position)
+				}
+
+				diagnostics = append(diagnostics, Diagnostic{
+					Context: ref.Node.SourceContext,
+					Message: fmt.Sprintf(
+						"marker \"%s\" is defined more than once; it's also defined %s",
+						name, strings.Join(others, " and "),
+					),
+				})
+			}
+
+			return diagnostics
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestDuplicateMarkers(t *testing.T) {
+	executeLintTestCases(
+		t,
+		DuplicateMarkers,
+		lintTestCase{
+			label:    "distinct markers",
+			given:    "piano: %verse c d %chorus e f\nviolin: @chorus g",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "duplicates within one part",
+			given: "piano: %verse c d %verse e f",
+			expected: []string{
+				"piece.alda:1:8 marker \"verse\" is defined more than once; it's " +
+					"also defined at line 1, column 19 (duplicate-marker)",
+				"piece.alda:1:19 marker \"verse\" is defined more than once; it's " +
+					"also defined at line 1, column 8 (duplicate-marker)",
+			},
+		},
+		lintTestCase{
+			label: "duplicates across parts",
+			given: "piano: %verse c\nviolin: d %verse\ncello: %verse e",
+			expected: []string{
+				"piece.alda:1:8 marker \"verse\" is defined more than once; it's " +
+					"also defined at line 2, column 11 and at line 3, column 8 " +
+					"(duplicate-marker)",
+				"piece.alda:2:11 marker \"verse\" is defined more than once; it's " +
+					"also defined at line 1, column 8 and at line 3, column 8 " +
+					"(duplicate-marker)",
+				"piece.alda:3:8 marker \"verse\" is defined more than once; it's " +
+					"also defined at line 1, column 8 and at line 2, column 11 " +
+					"(duplicate-marker)",
+			},
+		},
+		lintTestCase{
+			label:    "marker within a repeat",
+			given:    "piano: [%verse c d]*4\nviolin: @verse e",
+			expected: []string{},
+		},
+		lintTestCase{
+			label:    "markers that differ by case",
+			given:    "piano: %verse c %Verse d",
+			expected: []string{},
+		},
+	)
+
+	executeLintTestCases(
+		t,
+		DuplicateMarkersIgnoringCase,
+		lintTestCase{
+			label: "markers that differ by case",
+			given: "piano: %verse c\nviolin: %Verse d",
+			expected: []string{
+				"piece.alda:1:8 marker \"verse\" is defined more than once; it's " +
+					"also defined as \"Verse\" at line 2, column 9 (duplicate-marker)",
+				"piece.alda:2:9 marker \"Verse\" is defined more than once; it's " +
+					"also defined as \"verse\" at line 1, column 8 (duplicate-marker)",
+			},
+		},
+	)
+}
@@ -0,0 +1,80 @@
+package lint
+
+import (
+	"fmt"
+
+	"alda.io/client/parser"
+)
+
+// EmptyEvents reports chords with fewer than two notes or rests, empty cram
+// expressions, empty event sequences, e.g. `[]`, and empty variable
+// definitions, which are usually left over from editing. Each diagnostic says
+// how to fix the problem.
+var EmptyEvents = Rule{
+	ID:          "empty-events",
+	Description: "chords, crams and event sequences without enough events",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+		checkEmptyEvents(root, parser.RootNode, &diagnostics)
+		return diagnostics
+	},
+}
+
+func checkEmptyEvents(
+	node parser.ASTNode, parentType parser.ASTNodeType,
+	diagnostics *[]Diagnostic,
+) {
+	report := func(context parser.ASTNode, message string) {
+		*diagnostics = append(*diagnostics, Diagnostic{
+			Context: context.SourceContext,
+			Message: message,
+		})
+	}
+
+	switch node.Type {
+	case parser.ChordNode:
+		notes := 0
+		for _, child := range node.Children {
+			if child.Type == parser.NoteNode || child.Type == parser.RestNode {
+				notes++
+			}
+		}
+
+		switch notes {
+		case 0:
+			report(node, "chord without any notes or rests; remove it")
+		case 1:
+			report(node, "chord with a single note or rest; remove the `/`")
+		}
+
+	case parser.CramNode:
+		if len(node.Children) > 0 && len(node.Children[0].Children) == 0 {
+			report(node, "empty cram expression; remove it")
+		}
+
+	case parser.EventSequenceNode:
+		// Only a standalone event sequence is reported here, not the events of a
+		// part, a voice, a cram expression, etc.
+		switch parentType {
+		case parser.EventSequenceNode, parser.RepeatNode,
+			parser.OnRepetitionsNode:
+			if len(node.Children) == 0 {
+				report(node, "empty event sequence; remove it")
+			}
+		}
+
+	case parser.VariableDefinitionNode:
+		if len(node.Children) == 2 && len(node.Children[1].Children) == 0 {
+			name, _ := node.Children[0].Literal.(string)
+			report(node.Children[0], fmt.Sprintf(
+				"variable \"%s\" is defined without any events; remove the "+
+					"definition or add events to it",
+				name,
+			))
+		}
+	}
+
+	for _, child := range node.Children {
+		checkEmptyEvents(child, node.Type, diagnostics)
+	}
+}
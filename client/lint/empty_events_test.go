@@ -0,0 +1,96 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+
+	"alda.io/client/model"
+	"alda.io/client/parser"
+	_ "alda.io/client/testing"
+)
+
+func TestEmptyEvents(t *testing.T) {
+	executeLintTestCases(
+		t,
+		EmptyEvents,
+		lintTestCase{
+			label:    "events that aren't empty",
+			given:    "riff = [c d]\npiano: c/e/g {c d}2 [e f]*2 V1: riff V0:",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "empty crams and event sequences",
+			given: "piano: c {}2 d []\nriff = []\nviolin: [e []]*2 [f []'2]*2",
+			expected: []string{
+				"piece.alda:1:10 empty cram expression; remove it (empty-events)",
+				"piece.alda:1:16 empty event sequence; remove it (empty-events)",
+				"piece.alda:2:8 empty event sequence; remove it (empty-events)",
+				"piece.alda:3:12 empty event sequence; remove it (empty-events)",
+				"piece.alda:3:21 empty event sequence; remove it (empty-events)",
+			},
+		},
+	)
+
+	// Chords with fewer than two notes, and empty variable definitions, don't
+	// parse, but can be in an AST that's built or transformed programmatically.
+	context := func(column int) model.AldaSourceContext {
+		return model.AldaSourceContext{
+			Filename: "piece.alda", Line: 1, Column: column,
+		}
+	}
+	note := parser.ASTNode{
+		Type:          parser.NoteNode,
+		SourceContext: context(3),
+		Children: []parser.ASTNode{{
+			Type:     parser.NoteLetterAndAccidentalsNode,
+			Children: []parser.ASTNode{{Type: parser.NoteLetterNode, Literal: 'c'}},
+		}},
+	}
+	root := parser.ASTNode{
+		Type: parser.RootNode,
+		Children: []parser.ASTNode{{
+			Type: parser.ImplicitPartNode,
+			Children: []parser.ASTNode{{
+				Type: parser.EventSequenceNode,
+				Children: []parser.ASTNode{
+					{
+						Type:          parser.ChordNode,
+						SourceContext: context(1),
+						Children:      []parser.ASTNode{note},
+					},
+					{Type: parser.ChordNode, SourceContext: context(5)},
+					{
+						Type:          parser.VariableDefinitionNode,
+						SourceContext: context(12),
+						Children: []parser.ASTNode{
+							{
+								Type:          parser.VariableNameNode,
+								SourceContext: context(7),
+								Literal:       "riff",
+							},
+							{Type: parser.EventSequenceNode},
+						},
+					},
+				},
+			}},
+		}},
+	}
+
+	actual := []string{}
+	for _, diagnostic := range Lint(root, EmptyEvents) {
+		actual = append(actual, diagnostic.String())
+	}
+
+	expected := []string{
+		"piece.alda:1:1 chord with a single note or rest; remove the `/` " +
+			"(empty-events)",
+		"piece.alda:1:5 chord without any notes or rests; remove it " +
+			"(empty-events)",
+		"piece.alda:1:7 variable \"riff\" is defined without any events; " +
+			"remove the definition or add events to it (empty-events)",
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %q\nactual: %q", expected, actual)
+	}
+}
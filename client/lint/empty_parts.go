@@ -0,0 +1,196 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"alda.io/client/parser"
+)
+
+// EmptyParts reports parts that are declared, but don't have any notes, rests
+// or variable references, e.g. the `trumpet:` in `trumpet: violin: c d e`,
+// which are silent for the whole score. That usually means that the music was
+// meant to be added to the part, but never was. A part that only has attribute
+// changes, e.g. `trumpet: (vol 50)`, is reported as Info, as that's sometimes
+// intended, e.g. to set up an instrument for later.
+//
+// A part can be declared more than once, e.g. `piano: c violin: d piano: e`,
+// so a part is only reported (at its first declaration) if none of its
+// declarations have any events. Events played by a member of a group, e.g.
+// `strings.violin: c` after `violin/viola "strings":`, count as events of the
+// group, and events played by a group count as events of each of its members,
+// e.g. `violin: (vol 50)` is set up for `violin/viola: c` to play.
+var EmptyParts = Rule{
+	ID:          "empty-part",
+	Description: "parts without any notes, rests or variable references",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		type emptyPart struct {
+			// The first declaration of the part
+			declaration parser.ASTNode
+			// The name of the part, i.e. its alias or names
+			name string
+			// The instruments of the part (see partMembers)
+			members []string
+			// Whether any declaration of the part has attribute changes or other
+			// events that don't make a sound
+			hasAttributes bool
+		}
+
+		parts := []*emptyPart{}
+		byName := map[string]*emptyPart{}
+		sounding := map[string]bool{}
+		aliases := map[string][]string{}
+
+		for _, part := range root.Children {
+			if part.Type != parser.PartNode || len(part.Children) < 2 {
+				continue
+			}
+
+			declaration := part.Children[0]
+			events := part.Children[1]
+			name := partName(declaration)
+			members := partMembers(declaration, aliases)
+
+			if hasSoundingEvents(events) {
+				sounding[name] = true
+				if i := strings.LastIndex(name, "."); i >= 0 {
+					sounding[name[:i]] = true
+				}
+				for _, member := range members {
+					sounding[member] = true
+				}
+				continue
+			}
+
+			if byName[name] == nil {
+				byName[name] = &emptyPart{
+					declaration: declaration, name: name, members: members,
+				}
+				parts = append(parts, byName[name])
+			}
+
+			if len(events.Children) > 0 {
+				byName[name].hasAttributes = true
+			}
+		}
+
+		diagnostics := []Diagnostic{}
+
+		for _, part := range parts {
+			if sounding[part.name] || anySounding(part.members, sounding) {
+				continue
+			}
+
+			if part.hasAttributes {
+				diagnostics = append(diagnostics, Diagnostic{
+					Severity: Info,
+					Context:  part.declaration.SourceContext,
+					Message: fmt.Sprintf(
+						"part \"%s\" only has attribute changes, so it's silent for "+
+							"the whole score",
+						part.name,
+					),
+				})
+				continue
+			}
+
+			diagnostics = append(diagnostics, Diagnostic{
+				Context: part.declaration.SourceContext,
+				Message: fmt.Sprintf(
+					"part \"%s\" has no events, so it's silent for the whole score; "+
+						"add events to it or remove it",
+					part.name,
+				),
+			})
+		}
+
+		return diagnostics
+	},
+}
+
+// partName returns the name of the part of a PartDeclarationNode, i.e. its
+// alias, if it has one, or its names, e.g. "violin/viola".
+func partName(declaration parser.ASTNode) string {
+	if len(declaration.Children) > 1 {
+		if alias, ok := declaration.Children[1].Literal.(string); ok {
+			return alias
+		}
+	}
+
+	names := []string{}
+	if len(declaration.Children) > 0 {
+		for _, nameNode := range declaration.Children[0].Children {
+			if name, ok := nameNode.Literal.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return strings.Join(names, "/")
+}
+
+// partMembers returns the instruments of a PartDeclarationNode, known by their
+// names, or their aliases if they have one of their own, and records the alias
+// of the declaration, e.g. "violin" and "viola" for `strings:` after
+// `violin/viola "strings":`, or "v1" for `v1:` after `violin "v1":`. A member
+// of a group, e.g. `strings.violin`, is the instrument of that name.
+func partMembers(
+	declaration parser.ASTNode, aliases map[string][]string,
+) []string {
+	if len(declaration.Children) == 0 {
+		return nil
+	}
+
+	members := []string{}
+	for _, nameNode := range declaration.Children[0].Children {
+		name, _ := nameNode.Literal.(string)
+		if aliased, ok := aliases[name]; ok {
+			members = append(members, aliased...)
+			continue
+		}
+
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			if _, ok := aliases[name[:i]]; ok {
+				name = name[i+1:]
+			}
+		}
+		members = append(members, name)
+	}
+
+	if len(declaration.Children) > 1 {
+		if alias, ok := declaration.Children[1].Literal.(string); ok {
+			if len(members) == 1 {
+				members = []string{alias}
+			}
+			aliases[alias] = members
+		}
+	}
+
+	return members
+}
+
+// anySounding returns true if any of the members are sounding.
+func anySounding(members []string, sounding map[string]bool) bool {
+	for _, member := range members {
+		if sounding[member] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasSoundingEvents returns true if the events include a note, a rest or a
+// variable reference, at any depth, e.g. in a repeat or a voice. Input that
+// couldn't be parsed (see SyntaxErrors) might be any of them, so it counts too.
+func hasSoundingEvents(events parser.ASTNode) bool {
+	return len(events.FindAll(func(node parser.ASTNode) bool {
+		switch node.Type {
+		case parser.NoteNode, parser.RestNode, parser.VariableReferenceNode,
+			parser.ErrorNode:
+			return true
+		default:
+			return false
+		}
+	})) > 0
+}
@@ -0,0 +1,69 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestEmptyParts(t *testing.T) {
+	executeLintTestCases(
+		t,
+		EmptyParts,
+		lintTestCase{
+			label: "parts with events",
+			given: "riff = c d\npiano: c d\nviolin: (vol 50) r1\n" +
+				"cello: riff\nviola: [V1: c V2: e V0:]*2",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "empty part",
+			given: "trumpet:\nviolin: c d e",
+			expected: []string{
+				"piece.alda:1:1 part \"trumpet\" has no events, so it's silent " +
+					"for the whole score; add events to it or remove it (empty-part)",
+			},
+		},
+		lintTestCase{
+			label: "empty group",
+			given: "piano: c\nviolin/viola \"strings\":",
+			expected: []string{
+				"piece.alda:2:1 part \"strings\" has no events, so it's silent " +
+					"for the whole score; add events to it or remove it (empty-part)",
+			},
+		},
+		lintTestCase{
+			label: "attribute changes only",
+			given: "trumpet: (vol 50) o5 %intro |\nviolin: c",
+			expected: []string{
+				"piece.alda:1:1 info: part \"trumpet\" only has attribute changes, " +
+					"so it's silent for the whole score (empty-part)",
+			},
+		},
+		lintTestCase{
+			label:    "part with events in a later declaration",
+			given:    "piano: violin: c piano: e\ntuba \"low\": (vol 50)\nlow: c",
+			expected: []string{},
+		},
+		lintTestCase{
+			label:    "group whose members have events",
+			given:    "violin/viola \"strings\":\nstrings.violin: c",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "parts set up alone and then played as a group",
+			given: "violin: (tempo 100)\nviola: (tempo 105)\ncello:\n" +
+				"violin/viola/cello: [e8 f g]*2\n" +
+				"piano: (set-duration 4)\npiano/harp: c",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "part set up alone and not in a group that's played",
+			given: "violin: (vol 50)\nviola/cello: c",
+			expected: []string{
+				"piece.alda:1:1 info: part \"violin\" only has attribute changes, " +
+					"so it's silent for the whole score (empty-part)",
+			},
+		},
+	)
+}
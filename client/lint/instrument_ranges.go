@@ -0,0 +1,33 @@
+package lint
+
+import (
+	"errors"
+
+	"alda.io/client/model"
+	"alda.io/client/parser"
+)
+
+// InstrumentRanges reports notes that are played outside the range of an
+// instrument of their part, e.g. `o8 c` for a tuba (see
+// parser.CheckInstrumentRanges).
+var InstrumentRanges = Rule{
+	ID:          "instrument-range",
+	Description: "notes outside the range of the instrument that plays them",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		for _, err := range parser.CheckInstrumentRanges(root) {
+			var sourceErr *model.AldaSourceError
+			if !errors.As(err, &sourceErr) {
+				continue
+			}
+
+			diagnostics = append(diagnostics, Diagnostic{
+				Context: sourceErr.Context,
+				Message: sourceErr.Err.Error(),
+			})
+		}
+
+		return diagnostics
+	},
+}
@@ -0,0 +1,34 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestInstrumentRanges(t *testing.T) {
+	executeLintTestCases(
+		t,
+		InstrumentRanges,
+		lintTestCase{
+			label:    "in range",
+			given:    "piano: o0 a o8 c\npiccolo: o5 d o7 c",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "out of range",
+			given: "piccolo: o4 c\ntuba: o8 c",
+			expected: []string{
+				"piece.alda:1:13 note C4 is outside the range of piccolo (D5 to C8) " +
+					"(instrument-range)",
+				"piece.alda:2:10 note C8 is outside the range of tuba (D1 to F4) " +
+					"(instrument-range)",
+			},
+		},
+		lintTestCase{
+			label:    "transposed into range",
+			given:    "piccolo: (transpose 12) o4 d",
+			expected: []string{},
+		},
+	)
+}
@@ -0,0 +1,208 @@
+// Package lint checks Alda ASTs for problems that aren't syntax errors, but
+// are likely to be mistakes, e.g. a variable that's defined but never used.
+//
+// Each kind of problem is checked by a Rule, and Lint runs a set of rules over
+// an AST, returning a Diagnostic for each problem found.
+package lint
+
+import (
+	"fmt"
+	"sort"
+
+	"alda.io/client/model"
+	"alda.io/client/parser"
+)
+
+// Severity is how likely a diagnostic is to be a mistake.
+type Severity int
+
+const (
+	// Warning is a problem that's likely to be a mistake. This is the default.
+	Warning Severity = iota
+	// Info is something worth pointing out that's often intended, e.g. endings
+	// of a repeat that are played on some of the same repetitions.
+	Info
+	// Error is a problem that must be fixed, e.g. one that makes the score fail
+	// to play, like an undefined variable. A rule's diagnostics can also be made
+	// errors by a Config.
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Info:
+		return "info"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// A Diagnostic is a problem found by a rule.
+type Diagnostic struct {
+	// RuleID is the ID of the rule that found the problem, e.g.
+	// "unused-variable".
+	RuleID string
+	// Severity is how likely the problem is to be a mistake.
+	Severity Severity
+	// Context is the location of the problem in the source code.
+	Context model.AldaSourceContext
+	// Message describes the problem.
+	Message string
+	// Suggestion is what the source code was probably meant to be, if there's a
+	// likely fix, e.g. the name of a defined variable that a reference is
+	// probably a misspelling of.
+	Suggestion string
+	// Fix is a change to the AST that fixes the problem, if it can be fixed
+	// automatically (see ApplyFixes).
+	Fix *Fix
+}
+
+// A Fix is a change to an AST that fixes a problem.
+type Fix struct {
+	// Remove are the paths of the nodes to remove, in the form given to
+	// parser.ASTNode.Remove, e.g. "PartNode[1]/EventSequenceNode/NoteNode[3]".
+	Remove []string
+}
+
+func (d Diagnostic) String() string {
+	filename := d.Context.Filename
+	if filename == "" {
+		filename = "<no file>"
+	}
+
+	message := d.Message
+	if d.Severity != Warning {
+		message = fmt.Sprintf("%s: %s", d.Severity, message)
+	}
+	if d.Suggestion != "" {
+		message += fmt.Sprintf("; did you mean \"%s\"?", d.Suggestion)
+	}
+
+	return fmt.Sprintf(
+		"%s:%d:%d %s (%s)",
+		filename, d.Context.Line, d.Context.Column, message, d.RuleID,
+	)
+}
+
+// A Rule checks an AST for one kind of problem.
+type Rule struct {
+	// ID identifies the rule, e.g. in diagnostics.
+	ID string
+	// Description is a one-line summary of what the rule checks.
+	Description string
+	// Check returns the problems that the rule finds in the AST, given its
+	// root node. Each diagnostic's RuleID is filled in by Lint.
+	Check func(root parser.ASTNode) []Diagnostic
+}
+
+// Rules are the available rules, in the order in which they're run by
+// default.
+var Rules = []Rule{
+	SyntaxErrors,
+	UndefinedVariables,
+	UnusedVariables,
+	RedefinedVariables,
+	OctaveRange,
+	UnknownAttributes,
+	DuplicateMarkers,
+	UndefinedMarkers,
+	RepetitionRanges,
+	EmptyEvents,
+	MeasureLengths,
+	UnknownInstruments,
+	TrailingTies,
+	RedundantOctaves,
+	InstrumentRanges,
+	AttributeRanges,
+	VoiceGroups,
+	EmptyParts,
+}
+
+// OptionalRules are the available rules that don't run by default, e.g. rules
+// about style rather than likely mistakes. They run when they're given to Lint,
+// or enabled by a Config.
+var OptionalRules = []Rule{
+	AccidentalSpelling,
+}
+
+// LookupRule returns the available rule with the given ID, if there is one,
+// whether it's optional or not. Rule IDs are stable, so they can be referred to
+// in configuration files and suppression comments (see Config and Suppress).
+func LookupRule(id string) (Rule, bool) {
+	for _, rules := range [][]Rule{Rules, OptionalRules} {
+		for _, rule := range rules {
+			if rule.ID == id {
+				return rule, true
+			}
+		}
+	}
+
+	return Rule{}, false
+}
+
+// Lint runs the given rules over the AST, or all of the available rules (see
+// Rules) if none are given, and returns the problems that they find, in order
+// of their positions in the source code.
+func Lint(root parser.ASTNode, rules ...Rule) []Diagnostic {
+	if len(rules) == 0 {
+		rules = Rules
+	}
+
+	diagnostics := []Diagnostic{}
+
+	for _, rule := range rules {
+		for _, diagnostic := range rule.Check(root) {
+			diagnostic.RuleID = rule.ID
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Context, diagnostics[j].Context
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return diagnostics
+}
+
+// SyntaxErrors reports each ErrorNode in the AST, which stands in for input
+// that couldn't be parsed (see parser.Parse).
+var SyntaxErrors = Rule{
+	ID:          "syntax-error",
+	Description: "input that couldn't be parsed",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		for _, ref := range root.FindByType(parser.ErrorNode) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Context: ref.Node.SourceContext,
+				Message: fmt.Sprintf("syntax error: %v", ref.Node.Literal),
+			})
+		}
+
+		return diagnostics
+	},
+}
+
+// ApplyFixes returns a copy of the AST with the fixes of the given diagnostics
+// applied. Diagnostics without a fix are ignored. The diagnostics must have
+// been found in the same AST, as the fixes refer to its nodes by their paths.
+func ApplyFixes(
+	root parser.ASTNode, diagnostics []Diagnostic,
+) (parser.ASTNode, error) {
+	remove := []string{}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Fix != nil {
+			remove = append(remove, diagnostic.Fix.Remove...)
+		}
+	}
+
+	return root.Remove(remove...)
+}
@@ -0,0 +1,99 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+
+	"alda.io/client/parser"
+	_ "alda.io/client/testing"
+)
+
+type lintTestCase struct {
+	label    string
+	given    string
+	expected []string
+}
+
+func executeLintTestCases(t *testing.T, rule Rule, testCases ...lintTestCase) {
+	for _, testCase := range testCases {
+		root, err := parser.Parse("piece.alda", testCase.given)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.label, err)
+			continue
+		}
+
+		actual := []string{}
+		for _, diagnostic := range Lint(root, rule) {
+			actual = append(actual, diagnostic.String())
+		}
+
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf(
+				"%s\nexpected: %q\nactual: %q",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	// The syntax error stands in for `)`, leaving the rest of the score intact.
+	root, err := parser.Parse(
+		"piece.alda", "unused = c\nriff = d\npiano: riff ) e\nbass = f",
+	)
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+
+	actual := []string{}
+	for _, diagnostic := range Lint(root) {
+		actual = append(actual, diagnostic.String())
+	}
+
+	// The diagnostics of all the rules are in order of position.
+	expected := []string{
+		"piece.alda:1:1 variable \"unused\" is defined but never used " +
+			"(unused-variable)",
+		"piece.alda:3:13 syntax error: Unexpected close parenthesis `)` in " +
+			"inner events (syntax-error)",
+		"piece.alda:4:1 variable \"bass\" is defined but never used " +
+			"(unused-variable)",
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected: %q\nactual: %q", expected, actual)
+	}
+}
+
+// Rule IDs are referred to in configuration files and suppression comments, so
+// they mustn't change, and each one must identify a single rule.
+func TestRuleIDs(t *testing.T) {
+	ids := map[string]bool{}
+	for _, rule := range append(append([]Rule{}, Rules...), OptionalRules...) {
+		if ids[rule.ID] {
+			t.Errorf("duplicate rule ID \"%s\"", rule.ID)
+		}
+		ids[rule.ID] = true
+
+		if found, ok := LookupRule(rule.ID); !ok || found.ID != rule.ID {
+			t.Errorf("expected to look up rule \"%s\"", rule.ID)
+		}
+	}
+
+	for _, id := range []string{
+		"syntax-error", "undefined-variable", "unused-variable",
+		"redefined-variable", "octave-range", "unknown-attribute",
+		"duplicate-marker", "undefined-marker", "repetition-range",
+		"empty-events", "measure-length", "unknown-instrument", "trailing-tie",
+		"redundant-octave", "instrument-range", "attribute-range", "voice-group",
+		"empty-part", "accidental-spelling",
+	} {
+		if !ids[id] {
+			t.Errorf("expected a rule with ID \"%s\"", id)
+		}
+	}
+
+	if _, ok := LookupRule("no-such-rule"); ok {
+		t.Errorf("expected no rule with ID \"no-such-rule\"")
+	}
+}
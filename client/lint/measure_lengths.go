@@ -0,0 +1,44 @@
+package lint
+
+import (
+	"errors"
+
+	"alda.io/client/model"
+	"alda.io/client/parser"
+)
+
+// MeasureLengths reports measures whose length doesn't match the time
+// signature in effect, e.g. five quarter notes between barlines in 4/4 (see
+// parser.CheckMeasureLengths).
+//
+// A short first measure is usually a pickup (anacrusis) measure, so it's only
+// noted (as Info).
+var MeasureLengths = Rule{
+	ID:          "measure-length",
+	Description: "measures that don't match the time signature",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		for _, err := range parser.CheckMeasureLengths(root) {
+			var sourceErr *model.AldaSourceError
+			var measureErr *parser.MeasureLengthError
+			if !errors.As(err, &sourceErr) || !errors.As(err, &measureErr) {
+				continue
+			}
+
+			diagnostic := Diagnostic{
+				Context: sourceErr.Context,
+				Message: measureErr.Error(),
+			}
+
+			if measureErr.Pickup() {
+				diagnostic.Severity = Info
+				diagnostic.Message += ", so it's probably a pickup measure"
+			}
+
+			diagnostics = append(diagnostics, diagnostic)
+		}
+
+		return diagnostics
+	},
+}
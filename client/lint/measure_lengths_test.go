@@ -0,0 +1,86 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestMeasureLengths(t *testing.T) {
+	executeLintTestCases(
+		t,
+		MeasureLengths,
+		lintTestCase{
+			label:    "full measures",
+			given:    "piano: 4/4 c4 d e f | g2. a8. b16 | c1~|2 d2 | e",
+			expected: []string{},
+		},
+		lintTestCase{
+			label:    "no time signature",
+			given:    "piano: c4 d e f g | a",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "overfull",
+			given: "piano: 4/4 c4 d e f | g4 a b > c d | e",
+			expected: []string{
+				"piece.alda:1:23 measure 2 is overfull: it has 5 beats, but 4/4 " +
+					"has 4 beats (measure-length)",
+			},
+		},
+		lintTestCase{
+			label: "underfull",
+			given: "piano: 3/4 c4 d e | f2 | g4 a b",
+			expected: []string{
+				"piece.alda:1:21 measure 2 is underfull: it has 2 beats, but 3/4 " +
+					"has 3 beats (measure-length)",
+			},
+		},
+		lintTestCase{
+			label: "pickup",
+			given: "piano: 4/4 g4 | c4 d e f | g1",
+			expected: []string{
+				"piece.alda:1:12 info: measure 1 is underfull: it has 1 beat, but " +
+					"4/4 has 4 beats, so it's probably a pickup measure " +
+					"(measure-length)",
+			},
+		},
+		lintTestCase{
+			label:    "time signature change",
+			given:    "piano: 4/4 c4 d e f | 3/4 g a b | 6/8 c8 d e f4. | c",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "measure after a time signature change",
+			given: "piano: (time-sig '(2 4)) c4 d | (time-sig '(3 4)) e f | g",
+			expected: []string{
+				"piece.alda:1:51 measure 2 is underfull: it has 2 beats, but 3/4 " +
+					"has 3 beats (measure-length)",
+			},
+		},
+		lintTestCase{
+			label:    "crams, chords and triplets",
+			given:    "piano: 2/4 {c d e}4 c4/e/g | c6 d e",
+			expected: []string{},
+		},
+		lintTestCase{
+			label:    "duration in milliseconds",
+			given:    "piano: 4/4 c4 d500ms e4 | f1",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "voices",
+			given: "piano: 2/4 V1: c4 d | e2 V2: e4 | f2 V0: | g2",
+			expected: []string{
+				"piece.alda:1:30 info: measure 1 is underfull: it has 1 beat, but " +
+					"2/4 has 2 beats, so it's probably a pickup measure " +
+					"(measure-length)",
+			},
+		},
+		lintTestCase{
+			label:    "repeats",
+			given:    "riff = c4 d e | \npiano: 3/4 [riff]*4 f2",
+			expected: []string{},
+		},
+	)
+}
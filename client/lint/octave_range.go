@@ -0,0 +1,32 @@
+package lint
+
+import (
+	"errors"
+
+	"alda.io/client/model"
+	"alda.io/client/parser"
+)
+
+// OctaveRange reports notes that are played in an octave outside the range in
+// which notes can be played (see parser.CheckOctaveRange).
+var OctaveRange = Rule{
+	ID:          "octave-range",
+	Description: "notes outside the range of playable octaves",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		for _, err := range parser.CheckOctaveRange(root) {
+			var sourceErr *model.AldaSourceError
+			if !errors.As(err, &sourceErr) {
+				continue
+			}
+
+			diagnostics = append(diagnostics, Diagnostic{
+				Context: sourceErr.Context,
+				Message: sourceErr.Err.Error(),
+			})
+		}
+
+		return diagnostics
+	},
+}
@@ -0,0 +1,27 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestOctaveRange(t *testing.T) {
+	executeLintTestCases(
+		t,
+		OctaveRange,
+		lintTestCase{
+			label:    "in range",
+			given:    "piano: o8 c > c < c",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "out of range",
+			given: "riff = c >\npiano: o8 riff riff riff",
+			expected: []string{
+				"piece.alda:1:8 note in octave 10, outside the range of octaves " +
+					"-1 to 9 (octave-range)",
+			},
+		},
+	)
+}
@@ -0,0 +1,181 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// OutputFormat is the way that WriteDiagnostics writes diagnostics.
+type OutputFormat int
+
+const (
+	// TextOutput writes a diagnostic per line (see Diagnostic.String), followed
+	// by a summary, for people to read. This is the default.
+	TextOutput OutputFormat = iota
+	// JSONOutput writes a JSON array with an object for each diagnostic, for
+	// tools like editor plugins to read (see jsonDiagnostic).
+	JSONOutput
+	// LineOutput writes a diagnostic per line, with its fields separated by
+	// colons, e.g. `piece.alda:3:5:warning:unused-variable:message`, for tools
+	// like grep to read.
+	LineOutput
+)
+
+// ParseOutputFormat returns the output format with the given name: "text",
+// "json" or "line".
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch name {
+	case "text":
+		return TextOutput, nil
+	case "json":
+		return JSONOutput, nil
+	case "line":
+		return LineOutput, nil
+	default:
+		return TextOutput, fmt.Errorf(
+			"unknown output format \"%s\", expected \"text\", \"json\" or \"line\"",
+			name,
+		)
+	}
+}
+
+// A jsonDiagnostic is a diagnostic as it's written in JSON output. The end of
+// a problem isn't known, so endLine and endColumn are those of its start, i.e.
+// the problem is a point, which editors show as the token at that point.
+type jsonDiagnostic struct {
+	RuleID     string `json:"ruleID"`
+	Severity   string `json:"severity"`
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+	EndLine    int    `json:"endLine"`
+	EndColumn  int    `json:"endColumn"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion"`
+}
+
+// WriteDiagnostics writes diagnostics in the given output format.
+func WriteDiagnostics(
+	out io.Writer, diagnostics []Diagnostic, format OutputFormat,
+) error {
+	switch format {
+	case JSONOutput:
+		array := []jsonDiagnostic{}
+		for _, d := range diagnostics {
+			array = append(array, jsonDiagnostic{
+				RuleID:     d.RuleID,
+				Severity:   d.Severity.String(),
+				File:       d.Context.Filename,
+				Line:       d.Context.Line,
+				Column:     d.Context.Column,
+				EndLine:    d.Context.Line,
+				EndColumn:  d.Context.Column,
+				Message:    d.Message,
+				Suggestion: d.Suggestion,
+			})
+		}
+
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(array)
+
+	case LineOutput:
+		for _, d := range diagnostics {
+			message := d.Message
+			if d.Suggestion != "" {
+				message += fmt.Sprintf("; did you mean \"%s\"?", d.Suggestion)
+			}
+
+			// A message never spans lines, so that each line is a diagnostic.
+			message = strings.Join(strings.Fields(message), " ")
+
+			if _, err := fmt.Fprintf(
+				out, "%s:%d:%d:%s:%s:%s\n", d.Context.Filename, d.Context.Line,
+				d.Context.Column, d.Severity, d.RuleID, message,
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	default:
+		for _, d := range diagnostics {
+			if _, err := fmt.Fprintln(out, d); err != nil {
+				return err
+			}
+		}
+
+		_, err := fmt.Fprintln(out, summary(diagnostics))
+		return err
+	}
+}
+
+// summary returns a summary of the number of diagnostics of each severity,
+// e.g. "3 problems (1 error, 2 warnings)".
+func summary(diagnostics []Diagnostic) string {
+	if len(diagnostics) == 0 {
+		return "No problems found."
+	}
+
+	counts := map[Severity]int{}
+	for _, d := range diagnostics {
+		counts[d.Severity]++
+	}
+
+	plural := func(count int, noun string) string {
+		if count == 1 {
+			return fmt.Sprintf("%d %s", count, noun)
+		}
+		return fmt.Sprintf("%d %ss", count, noun)
+	}
+
+	parts := []string{}
+	if counts[Error] > 0 {
+		parts = append(parts, plural(counts[Error], "error"))
+	}
+	if counts[Warning] > 0 {
+		parts = append(parts, plural(counts[Warning], "warning"))
+	}
+	if counts[Info] > 0 {
+		parts = append(parts, fmt.Sprintf("%d info", counts[Info]))
+	}
+
+	return fmt.Sprintf(
+		"%s (%s)", plural(len(diagnostics), "problem"), strings.Join(parts, ", "),
+	)
+}
+
+const (
+	// ExitClean is the exit code of a lint run that finds no problems that fail
+	// it (see ExitCode).
+	ExitClean = 0
+	// ExitProblems is the exit code of a lint run that finds errors, or
+	// warnings when they fail the run.
+	ExitProblems = 1
+	// ExitParseFailure is the exit code of a lint run on source code that can't
+	// be parsed.
+	ExitParseFailure = 2
+)
+
+// ExitCode returns the exit code of a lint run that found the given
+// diagnostics: ExitParseFailure if any of them are syntax errors (see
+// SyntaxErrors), ExitProblems if any are errors, or warnings and
+// failOnWarnings is true, and ExitClean otherwise. Info diagnostics never
+// fail a run.
+func ExitCode(diagnostics []Diagnostic, failOnWarnings bool) int {
+	code := ExitClean
+
+	for _, d := range diagnostics {
+		switch {
+		case d.RuleID == SyntaxErrors.ID:
+			return ExitParseFailure
+		case d.Severity == Error, d.Severity == Warning && failOnWarnings:
+			code = ExitProblems
+		}
+	}
+
+	return code
+}
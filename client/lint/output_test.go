@@ -0,0 +1,213 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"alda.io/client/model"
+	"alda.io/client/parser"
+	_ "alda.io/client/testing"
+)
+
+// The diagnostics of a score with a warning, an info and an error
+func outputTestDiagnostics(t *testing.T) []Diagnostic {
+	root, err := parser.Parse(
+		"piece.alda", "piano: c1~ | d (vol 250)\n(volum 50)",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{Severities: map[string]Severity{"attribute-range": Error}}
+
+	return LintWithConfig(root, nil, config)
+}
+
+func TestWriteDiagnostics(t *testing.T) {
+	diagnostics := outputTestDiagnostics(t)
+
+	for _, testCase := range []struct {
+		label    string
+		format   string
+		expected string
+	}{
+		{
+			label:  "text",
+			format: "text",
+			expected: "piece.alda:1:10 info: tie into a note of a different pitch, " +
+				"which is a slur (trailing-tie)\n" +
+				"piece.alda:1:21 error: implausible value for \"vol\": 250, outside " +
+				"the range 0 to 100 (attribute-range)\n" +
+				"piece.alda:2:2 unknown attribute or function \"volum\"; did you " +
+				"mean \"volume\"? (unknown-attribute)\n" +
+				"3 problems (1 error, 1 warning, 1 info)\n",
+		},
+		{
+			label:  "line",
+			format: "line",
+			expected: "piece.alda:1:10:info:trailing-tie:tie into a note of a " +
+				"different pitch, which is a slur\n" +
+				"piece.alda:1:21:error:attribute-range:implausible value for " +
+				"\"vol\": 250, outside the range 0 to 100\n" +
+				"piece.alda:2:2:warning:unknown-attribute:unknown attribute or " +
+				"function \"volum\"; did you mean \"volume\"?\n",
+		},
+	} {
+		format, err := ParseOutputFormat(testCase.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output := bytes.Buffer{}
+		if err := WriteDiagnostics(&output, diagnostics, format); err != nil {
+			t.Fatal(err)
+		}
+
+		if output.String() != testCase.expected {
+			t.Errorf(
+				"%s\nexpected: %q\nactual: %q",
+				testCase.label, testCase.expected, output.String(),
+			)
+		}
+	}
+
+	output := bytes.Buffer{}
+	if err := WriteDiagnostics(&output, nil, TextOutput); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "No problems found.\n" {
+		t.Errorf("expected a summary without problems, got %q", output.String())
+	}
+
+	if _, err := ParseOutputFormat("xml"); err == nil {
+		t.Errorf("expected an error for an unknown output format")
+	}
+}
+
+func TestWriteDiagnosticsJSON(t *testing.T) {
+	for _, testCase := range []struct {
+		label       string
+		diagnostics []Diagnostic
+		expected    []map[string]interface{}
+	}{
+		{
+			label:       "clean",
+			diagnostics: []Diagnostic{},
+			expected:    []map[string]interface{}{},
+		},
+		{
+			label:       "with and without a suggestion",
+			diagnostics: outputTestDiagnostics(t)[1:],
+			expected: []map[string]interface{}{
+				{
+					"ruleID":     "attribute-range",
+					"severity":   "error",
+					"file":       "piece.alda",
+					"line":       1.0,
+					"column":     21.0,
+					"endLine":    1.0,
+					"endColumn":  21.0,
+					"message":    "implausible value for \"vol\": 250, outside the range 0 to 100",
+					"suggestion": "",
+				},
+				{
+					"ruleID":     "unknown-attribute",
+					"severity":   "warning",
+					"file":       "piece.alda",
+					"line":       2.0,
+					"column":     2.0,
+					"endLine":    2.0,
+					"endColumn":  2.0,
+					"message":    "unknown attribute or function \"volum\"",
+					"suggestion": "volume",
+				},
+			},
+		},
+	} {
+		output := bytes.Buffer{}
+		if err := WriteDiagnostics(
+			&output, testCase.diagnostics, JSONOutput,
+		); err != nil {
+			t.Fatal(err)
+		}
+
+		// Decoding into generic values checks the field names and types, and
+		// that there are no other fields.
+		actual := []map[string]interface{}{}
+		if err := json.Unmarshal(output.Bytes(), &actual); err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf(
+				"%s\nexpected: %#v\nactual: %#v",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	diagnostic := func(ruleID string, severity Severity) Diagnostic {
+		return Diagnostic{
+			RuleID: ruleID, Severity: severity,
+			Context: model.AldaSourceContext{Line: 1, Column: 1},
+		}
+	}
+
+	info := diagnostic("trailing-tie", Info)
+	warning := diagnostic("unused-variable", Warning)
+	err := diagnostic("attribute-range", Error)
+	syntax := diagnostic("syntax-error", Warning)
+
+	for _, testCase := range []struct {
+		label          string
+		diagnostics    []Diagnostic
+		failOnWarnings bool
+		expected       int
+	}{
+		{label: "clean", diagnostics: nil, expected: ExitClean},
+		{
+			label:          "clean when failing on warnings",
+			diagnostics:    nil,
+			failOnWarnings: true,
+			expected:       ExitClean,
+		},
+		{
+			label:          "info only",
+			diagnostics:    []Diagnostic{info},
+			failOnWarnings: true,
+			expected:       ExitClean,
+		},
+		{
+			label:       "warnings only",
+			diagnostics: []Diagnostic{info, warning},
+			expected:    ExitClean,
+		},
+		{
+			label:          "warnings only, failing on warnings",
+			diagnostics:    []Diagnostic{info, warning},
+			failOnWarnings: true,
+			expected:       ExitProblems,
+		},
+		{
+			label:       "errors",
+			diagnostics: []Diagnostic{warning, err},
+			expected:    ExitProblems,
+		},
+		{
+			label:       "parse failure",
+			diagnostics: []Diagnostic{err, syntax},
+			expected:    ExitParseFailure,
+		},
+	} {
+		actual := ExitCode(testCase.diagnostics, testCase.failOnWarnings)
+		if actual != testCase.expected {
+			t.Errorf(
+				"%s: expected %d, got %d", testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package lint
+
+import (
+	"fmt"
+
+	"alda.io/client/parser"
+)
+
+// RedefinedVariables reports a variable definition whose name is already
+// defined, which is allowed, but is often a copy-paste mistake, because it
+// silently changes what every later reference refers to. The diagnostic is
+// more emphatic if the earlier definition was referenced in between.
+//
+// A redefinition that refers to the variable itself, e.g. `riff = riff c`, is
+// deliberate, so it isn't reported. To allow other redefinitions, see
+// RedefinedVariablesAllowing.
+var RedefinedVariables = RedefinedVariablesAllowing()
+
+// RedefinedVariablesAllowing returns a version of the RedefinedVariables rule
+// that doesn't report redefinitions of the given variables, e.g. for a score
+// that intentionally redefines a variable from one section to the next.
+func RedefinedVariablesAllowing(names ...string) Rule {
+	allowed := map[string]bool{}
+	for _, name := range names {
+		allowed[name] = true
+	}
+
+	return Rule{
+		ID:          "redefined-variable",
+		Description: "variables that are defined more than once",
+		Check: func(root parser.ASTNode) []Diagnostic {
+			diagnostics := []Diagnostic{}
+
+			type definition struct {
+				node       parser.ASTNode
+				references int
+			}
+
+			definitions := map[string]*definition{}
+
+			walkVariables(root, variableVisitor{
+				define: func(name string, node parser.ASTNode) {
+					previous, redefined := definitions[name]
+					definitions[name] = &definition{node: node}
+
+					if !redefined || allowed[name] || refersTo(node.Children[1], name) {
+						return
+					}
+
+					used := ""
+					if previous.references > 0 {
+						used = " after it was used"
+					}
+
+					context := previous.node.Children[0].SourceContext
+					diagnostics = append(diagnostics, Diagnostic{
+						Context: node.Children[0].SourceContext,
+						Message: fmt.Sprintf(
+							"variable \"%s\" is redefined%s; it was already defined at "+
+								"line %d, column %d",
+							name, used, context.Line, context.Column,
+						),
+					})
+				},
+				reference: func(name string, node parser.ASTNode) {
+					if definition, ok := definitions[name]; ok {
+						definition.references++
+					}
+				},
+			})
+
+			return diagnostics
+		},
+	}
+}
+
+// refersTo reports whether there's a reference to the named variable within
+// the given events.
+func refersTo(events parser.ASTNode, name string) bool {
+	references := events.FindAll(func(node parser.ASTNode) bool {
+		return node.Type == parser.VariableReferenceNode && node.Literal == name
+	})
+
+	return len(references) > 0
+}
@@ -0,0 +1,62 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestRedefinedVariables(t *testing.T) {
+	executeLintTestCases(
+		t,
+		RedefinedVariables,
+		lintTestCase{
+			label:    "distinct variables",
+			given:    "riff = c d e\nbass = f g\npiano: riff bass",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "redefinition in the same part",
+			given: "piano:\n  riff = c d e\n  riff riff\n  riff = f g\n  riff",
+			expected: []string{
+				"piece.alda:4:3 variable \"riff\" is redefined after it was used; " +
+					"it was already defined at line 2, column 3 (redefined-variable)",
+			},
+		},
+		lintTestCase{
+			label: "redefinition across parts",
+			given: "piano: riff = c d e\nviolin: riff = f g\nriff",
+			expected: []string{
+				"piece.alda:2:9 variable \"riff\" is redefined; it was already " +
+					"defined at line 1, column 8 (redefined-variable)",
+			},
+		},
+		lintTestCase{
+			label: "redefinition inside nested event sequences",
+			given: "riff = c\npiano: [d [e\nriff = f\n]]*2 riff",
+			expected: []string{
+				"piece.alda:3:1 variable \"riff\" is redefined; it was already " +
+					"defined at line 1, column 1 (redefined-variable)",
+			},
+		},
+		lintTestCase{
+			label:    "redefinition in terms of itself",
+			given:    "riff = c d\nriff = riff e\nriff = [riff]*2\npiano: riff",
+			expected: []string{},
+		},
+	)
+
+	executeLintTestCases(
+		t,
+		RedefinedVariablesAllowing("section"),
+		lintTestCase{
+			label: "allowed redefinitions",
+			given: "section = c\nriff = d\npiano: section riff\n" +
+				"section = e\nriff = f\nviolin: section riff",
+			expected: []string{
+				"piece.alda:5:1 variable \"riff\" is redefined after it was used; " +
+					"it was already defined at line 2, column 1 (redefined-variable)",
+			},
+		},
+	)
+}
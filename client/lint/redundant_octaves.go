@@ -0,0 +1,214 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"alda.io/client/parser"
+)
+
+// RedundantOctaves reports octave changes that don't change the octave: an
+// octave set to the octave that's already in effect, e.g. the second `o4` in
+// `o4 c o4 d`, and an octave up and down (or down and up) next to each other,
+// e.g. `> <`, which cancel each other out. Each diagnostic has a fix that
+// removes the redundant octave changes.
+//
+// The octave is only known after an octave set, e.g. `o4`, in the same part,
+// voice or variable definition. It's forgotten wherever the octave in effect
+// when the score is played can differ from the one before it in the source
+// code, e.g. at the start or end of a repeat or a voice group, at a marker,
+// and after a variable reference or an octave attribute change, e.g.
+// `(octave 5)`.
+var RedundantOctaves = Rule{
+	ID:          "redundant-octave",
+	Description: "octave changes that don't change the octave",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		lines := []octaveLine{}
+		for i, part := range root.Children {
+			switch part.Type {
+			case parser.ImplicitPartNode, parser.PartNode:
+				last := len(part.Children) - 1
+				lines = append(lines, appendOctaveEvents(
+					nil, part.Children[last],
+					childPath(childPath("", root, i), part, last), &lines,
+				))
+			}
+		}
+
+		for _, line := range lines {
+			diagnostics = append(diagnostics, checkOctaves(line)...)
+		}
+
+		return diagnostics
+	},
+}
+
+// An octaveEvent is an event in an octaveLine, along with its path (see
+// parser.ASTNode.Remove).
+type octaveEvent struct {
+	node parser.ASTNode
+	path string
+}
+
+// An octaveLine is a sequence of events in which each octave change applies to
+// the events after it, e.g. the events of a part, with nil wherever the octave
+// in effect can't be known without evaluating the score.
+type octaveLine []*octaveEvent
+
+// childPath returns the path of the child at the given index of a node at the
+// given path, or "" for the root.
+func childPath(path string, node parser.ASTNode, index int) string {
+	segment := fmt.Sprintf("%s[%d]", node.Children[index].Type, index)
+	if path == "" {
+		return segment
+	}
+
+	return path + "/" + segment
+}
+
+// appendOctaveEvents appends the events of a node at the given path to a line,
+// and the lines within the node (e.g. voices) to lines.
+func appendOctaveEvents(
+	line octaveLine, node parser.ASTNode, path string, lines *[]octaveLine,
+) octaveLine {
+	appendChildren := func(line octaveLine) octaveLine {
+		for i := range node.Children {
+			line = appendOctaveEvents(
+				line, node.Children[i], childPath(path, node, i), lines,
+			)
+		}
+		return line
+	}
+
+	switch node.Type {
+	case parser.EventSequenceNode, parser.ChordNode, parser.CramNode:
+		line = appendChildren(line)
+
+	case parser.RepeatNode, parser.OnRepetitionsNode:
+		line = append(line, nil)
+		line = appendOctaveEvents(
+			line, node.Children[0], childPath(path, node, 0), lines,
+		)
+		line = append(line, nil)
+
+	case parser.VoiceGroupNode:
+		line = append(line, nil)
+
+		for i, voice := range node.Children {
+			if voice.Type == parser.VoiceNode {
+				*lines = append(*lines, appendOctaveEvents(
+					nil, voice, childPath(path, node, i), lines,
+				))
+			}
+		}
+
+	case parser.VoiceNode:
+		line = appendChildren(line)
+
+	case parser.VariableDefinitionNode:
+		*lines = append(*lines, appendOctaveEvents(
+			nil, node.Children[1], childPath(path, node, 1), lines,
+		))
+
+	case parser.MarkerNode, parser.AtMarkerNode, parser.VariableReferenceNode:
+		line = append(line, nil)
+
+	case parser.LispListNode:
+		if isOctaveAttributeChange(node) {
+			line = append(line, nil)
+		} else {
+			line = append(line, &octaveEvent{node, path})
+		}
+
+	case parser.DurationNode, parser.TimesNode, parser.VoiceNumberNode,
+		parser.VoiceGroupEndMarkerNode:
+
+	default:
+		line = append(line, &octaveEvent{node, path})
+	}
+
+	return line
+}
+
+// isOctaveAttributeChange reports whether a Lisp list is an octave attribute
+// change, e.g. `(octave 5)` or `(octave! 'up)`.
+func isOctaveAttributeChange(node parser.ASTNode) bool {
+	if len(node.Children) == 0 || node.Children[0].Type != parser.LispSymbolNode {
+		return false
+	}
+
+	name, _ := node.Children[0].Literal.(string)
+	return strings.TrimSuffix(name, "!") == "octave"
+}
+
+func checkOctaves(line octaveLine) []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	// The octave in effect, if it's known
+	octave, known := int32(0), false
+
+	for i := 0; i < len(line); i++ {
+		event := line[i]
+		if event == nil {
+			known = false
+			continue
+		}
+
+		switch event.node.Type {
+		case parser.OctaveSetNode:
+			number, _ := event.node.Literal.(int32)
+
+			if known && number == octave {
+				diagnostics = append(diagnostics, Diagnostic{
+					Context: event.node.SourceContext,
+					Message: fmt.Sprintf(
+						"redundant octave set: the octave is already %d", number,
+					),
+					Fix: &Fix{Remove: []string{event.path}},
+				})
+			}
+
+			octave, known = number, true
+
+		case parser.OctaveUpNode, parser.OctaveDownNode:
+			if i+1 < len(line) && line[i+1] != nil &&
+				isOppositeOctaveChange(event.node.Type, line[i+1].node.Type) {
+				diagnostics = append(diagnostics, Diagnostic{
+					Context: event.node.SourceContext,
+					Message: fmt.Sprintf(
+						"redundant octave changes: `%s` and `%s` cancel each other out",
+						octaveChangeText(event.node.Type),
+						octaveChangeText(line[i+1].node.Type),
+					),
+					Fix: &Fix{Remove: []string{event.path, line[i+1].path}},
+				})
+
+				i++
+				continue
+			}
+
+			if event.node.Type == parser.OctaveUpNode {
+				octave++
+			} else {
+				octave--
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+func isOppositeOctaveChange(a, b parser.ASTNodeType) bool {
+	return (a == parser.OctaveUpNode && b == parser.OctaveDownNode) ||
+		(a == parser.OctaveDownNode && b == parser.OctaveUpNode)
+}
+
+func octaveChangeText(nodeType parser.ASTNodeType) string {
+	if nodeType == parser.OctaveUpNode {
+		return ">"
+	}
+
+	return "<"
+}
@@ -0,0 +1,85 @@
+package lint
+
+import (
+	"bytes"
+	"testing"
+
+	"alda.io/client/parser"
+	_ "alda.io/client/testing"
+)
+
+func TestRedundantOctaves(t *testing.T) {
+	executeLintTestCases(
+		t,
+		RedundantOctaves,
+		lintTestCase{
+			label:    "octave changes that change the octave",
+			given:    "piano: o4 c > c o3 c < c > > c o5 c/>e/<g",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "octave set to the octave in effect",
+			given: "piano: o4 o4 c o5 d < o4 e\nriff = o2 c | o2 d",
+			expected: []string{
+				"piece.alda:1:11 redundant octave set: the octave is already 4 " +
+					"(redundant-octave)",
+				"piece.alda:1:23 redundant octave set: the octave is already 4 " +
+					"(redundant-octave)",
+				"piece.alda:2:15 redundant octave set: the octave is already 2 " +
+					"(redundant-octave)",
+			},
+		},
+		lintTestCase{
+			label: "octave changes that cancel each other out",
+			given: "piano: o5 > < c < > d > > < e",
+			expected: []string{
+				"piece.alda:1:11 redundant octave changes: `>` and `<` cancel each " +
+					"other out (redundant-octave)",
+				"piece.alda:1:17 redundant octave changes: `<` and `>` cancel each " +
+					"other out (redundant-octave)",
+				"piece.alda:1:25 redundant octave changes: `>` and `<` cancel each " +
+					"other out (redundant-octave)",
+			},
+		},
+		lintTestCase{
+			label: "octave not known",
+			given: "piano: o4 c\npiano: o4 d\nviolin: o4 [c > c]*2 o4 c\n" +
+				"cello: o3 riff o3 c %mark o3 d (octave 3) o3 e V1: o3 f V2: g V0: o3",
+			expected: []string{},
+		},
+		lintTestCase{
+			label:    "octave changes that aren't next to each other",
+			given:    "piano: > [<]*2 > [c'1 <]*2 V1: > V2: <",
+			expected: []string{},
+		},
+	)
+}
+
+func TestApplyFixes(t *testing.T) {
+	root, err := parser.Parse(
+		"piece.alda", "riff = o2 c < > d o2 e\npiano: o4 c o4 d > < e",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Diagnostics without fixes are ignored.
+	diagnostics := append(
+		Lint(root, RedundantOctaves), Diagnostic{Message: "no fix"},
+	)
+
+	fixed, err := ApplyFixes(root, diagnostics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := bytes.Buffer{}
+	if err := parser.FormatASTToCode(fixed, &buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "riff = o2 c d e\n\npiano:\n  o4 c d e\n"
+	if actual := buffer.String(); actual != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,129 @@
+package lint
+
+import (
+	"fmt"
+
+	"alda.io/client/parser"
+)
+
+// A repetitionRange is a range of repetitions of a repeat on which an event
+// is played, e.g. `2-3` in `[c d'2-3]*4`.
+type repetitionRange struct {
+	node  parser.ASTNode
+	first int32
+	last  int32
+}
+
+func (r repetitionRange) String() string {
+	if r.first == r.last {
+		return fmt.Sprint(r.first)
+	}
+
+	return fmt.Sprintf("%d-%d", r.first, r.last)
+}
+
+// RepetitionRanges reports events of a repeat that are played on repetitions
+// that never happen, e.g. `e'3` in `[c d e'3]*2`, because their range of
+// repetitions is beyond the number of times the passage is repeated, or
+// inverted, e.g. `e'3-1`.
+//
+// It also notes (as Info) endings of the same repeat that are played on some
+// of the same repetitions, e.g. `d'1-2` and `e'2-3`, which is sometimes
+// intended, but can also be a mistake.
+var RepetitionRanges = Rule{
+	ID:          "repetition-range",
+	Description: "ranges of repetitions that are outside of their repeat",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		for _, ref := range root.FindByType(parser.RepeatNode) {
+			repeat := ref.Node
+			times, _ := repeat.Children[1].Literal.(int32)
+
+			// The ranges of the endings checked so far
+			checked := []repetitionRange{}
+
+			for _, ranges := range repetitionRanges(repeat.Children[0]) {
+				for _, r := range ranges {
+					switch {
+					case r.first > r.last:
+						diagnostics = append(diagnostics, Diagnostic{
+							Context: r.node.SourceContext,
+							Message: fmt.Sprintf(
+								"repetition range %d-%d is inverted, so it's never played",
+								r.first, r.last,
+							),
+						})
+					case r.first < 1 || r.last > times:
+						diagnostics = append(diagnostics, Diagnostic{
+							Context: r.node.SourceContext,
+							Message: fmt.Sprintf(
+								"repetition %s is out of range for a passage repeated %d "+
+									"times",
+								r, times,
+							),
+						})
+					}
+				}
+
+				for _, r := range ranges {
+					for _, other := range checked {
+						if r.first > r.last || other.first > other.last ||
+							r.last < other.first || other.last < r.first {
+							continue
+						}
+
+						context := other.node.SourceContext
+						diagnostics = append(diagnostics, Diagnostic{
+							Context:  r.node.SourceContext,
+							Severity: Info,
+							Message: fmt.Sprintf(
+								"repetition %s overlaps with repetition %s at line %d, "+
+									"column %d",
+								r, other, context.Line, context.Column,
+							),
+						})
+						break
+					}
+				}
+
+				checked = append(checked, ranges...)
+			}
+		}
+
+		return diagnostics
+	},
+}
+
+// repetitionRanges returns the ranges of repetitions of each event within the
+// body of a repeat that's played on certain repetitions (i.e. of each
+// OnRepetitionsNode), in the order in which they're written. The events of
+// nested repeats are left out, because their repetitions are those of the
+// nested repeat.
+func repetitionRanges(node parser.ASTNode) [][]repetitionRange {
+	switch node.Type {
+	case parser.RepeatNode:
+		return nil
+
+	case parser.OnRepetitionsNode:
+		ranges := []repetitionRange{}
+		for _, rangeNode := range node.Children[1].Children {
+			first, _ := rangeNode.Children[0].Literal.(int32)
+			last, _ := rangeNode.Children[1].Literal.(int32)
+			ranges = append(ranges, repetitionRange{
+				node: rangeNode, first: first, last: last,
+			})
+		}
+
+		return append(
+			[][]repetitionRange{ranges}, repetitionRanges(node.Children[0])...,
+		)
+	}
+
+	result := [][]repetitionRange{}
+	for _, child := range node.Children {
+		result = append(result, repetitionRanges(child)...)
+	}
+
+	return result
+}
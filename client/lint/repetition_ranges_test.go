@@ -0,0 +1,50 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestRepetitionRanges(t *testing.T) {
+	executeLintTestCases(
+		t,
+		RepetitionRanges,
+		lintTestCase{
+			label:    "in range",
+			given:    "piano: [c d'1-2 e'3 f'4]*4 [g a'1]*1",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "out of range",
+			given: "piano: [c d'1-3 e'0]*2",
+			expected: []string{
+				"piece.alda:1:12 repetition 1-3 is out of range for a passage " +
+					"repeated 2 times (repetition-range)",
+				"piece.alda:1:18 repetition 0 is out of range for a passage " +
+					"repeated 2 times (repetition-range)",
+			},
+		},
+		lintTestCase{
+			label: "inverted",
+			given: "piano: [c d'3-1]*4",
+			expected: []string{
+				"piece.alda:1:12 repetition range 3-1 is inverted, so it's never " +
+					"played (repetition-range)",
+			},
+		},
+		lintTestCase{
+			label: "overlapping",
+			given: "piano: [c d'1-2 e'3,4 f'2-3]*4",
+			expected: []string{
+				"piece.alda:1:24 info: repetition 2-3 overlaps with repetition 1-2 " +
+					"at line 1, column 12 (repetition-range)",
+			},
+		},
+		lintTestCase{
+			label:    "nested repeats",
+			given:    "piano: [c [d e'3]*3 f'2]*2",
+			expected: []string{},
+		},
+	)
+}
@@ -0,0 +1,84 @@
+package lint
+
+import "sort"
+
+// closestMatch returns the candidate that's the fewest edits away from the
+// given name, as a suggestion for what a misspelled name was meant to be. If
+// there are several, the first in alphabetical order is returned. There's no
+// match if every candidate is too different to be a plausible misspelling,
+// i.e. more than a third of the name's characters would have to change.
+func closestMatch(name string, candidates []string) (string, bool) {
+	sorted := append([]string{}, candidates...)
+	sort.Strings(sorted)
+
+	maxDistance := len([]rune(name)) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	match := ""
+	matchDistance := maxDistance + 1
+
+	for _, candidate := range sorted {
+		if candidate == name {
+			continue
+		}
+
+		if distance := editDistance(name, candidate); distance < matchDistance {
+			match = candidate
+			matchDistance = distance
+		}
+	}
+
+	return match, match != ""
+}
+
+// editDistance returns the distance between two strings, i.e. the number of
+// single character insertions, deletions and substitutions, and swaps of
+// adjacent characters (a common typo, e.g. "pinao"), needed to turn one into
+// the other, without editing any character more than once.
+func editDistance(a string, b string) int {
+	as, bs := []rune(a), []rune(b)
+
+	// The distances from the first i characters of a to the first j characters
+	// of b, for the previous two and current values of i
+	beforePrevious := make([]int, len(bs)+1)
+	previous := make([]int, len(bs)+1)
+	current := make([]int, len(bs)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(as); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(bs); j++ {
+			substitution := previous[j-1]
+			if as[i-1] != bs[j-1] {
+				substitution++
+			}
+
+			current[j] = minInt(substitution, previous[j]+1, current[j-1]+1)
+
+			if i > 1 && j > 1 && as[i-1] == bs[j-2] && as[i-2] == bs[j-1] {
+				current[j] = minInt(current[j], beforePrevious[j-2]+1)
+			}
+		}
+
+		beforePrevious, previous, current = previous, current, beforePrevious
+	}
+
+	return previous[len(bs)]
+}
+
+func minInt(first int, rest ...int) int {
+	result := first
+	for _, n := range rest {
+		if n < result {
+			result = n
+		}
+	}
+
+	return result
+}
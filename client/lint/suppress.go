@@ -0,0 +1,126 @@
+package lint
+
+import (
+	"strings"
+
+	"alda.io/client/parser"
+)
+
+const (
+	// disableComment starts a comment that suppresses diagnostics on a line,
+	// e.g. `# alda-lint:disable unused-variable`.
+	disableComment = "alda-lint:disable"
+	// disableFileComment starts a comment that suppresses diagnostics in a
+	// whole file, e.g. `# alda-lint:disable-file measure-length`.
+	disableFileComment = "alda-lint:disable-file"
+)
+
+// A suppression is the rules whose diagnostics are suppressed somewhere.
+type suppression struct {
+	// Whether the diagnostics of all rules are suppressed
+	all bool
+	// The IDs of the rules whose diagnostics are suppressed
+	ids map[string]bool
+}
+
+func (s *suppression) add(ids []string) {
+	if len(ids) == 0 {
+		s.all = true
+		return
+	}
+
+	if s.ids == nil {
+		s.ids = map[string]bool{}
+	}
+	for _, id := range ids {
+		s.ids[id] = true
+	}
+}
+
+func (s suppression) suppresses(id string) bool {
+	return s.all || s.ids[id]
+}
+
+// parseSuppressionComment returns the rule IDs of a suppression comment,
+// which are separated by spaces or commas, and whether it's a comment that
+// suppresses diagnostics in the whole file. Returns false if the comment isn't
+// a suppression comment.
+func parseSuppressionComment(text string) ([]string, bool, bool) {
+	text = strings.TrimSpace(strings.TrimPrefix(text, "#"))
+
+	fields := strings.Fields(strings.ReplaceAll(text, ",", " "))
+	if len(fields) == 0 {
+		return nil, false, false
+	}
+
+	switch fields[0] {
+	case disableFileComment:
+		return fields[1:], true, true
+	case disableComment:
+		return fields[1:], false, true
+	}
+
+	return nil, false, false
+}
+
+// Suppress returns the diagnostics that aren't suppressed by the given
+// comments (see parser.CollectComments), which are the comments of the source
+// code in which the diagnostics were found.
+//
+// A comment like `# alda-lint:disable unused-variable` on a line of its own
+// suppresses the diagnostics of the given rules on the next line that isn't a
+// comment, and at the end of a line of code, on that line. A comment like
+// `# alda-lint:disable-file measure-length` suppresses them in the whole file.
+// Rule IDs are separated by spaces or commas, and a comment without any
+// suppresses the diagnostics of all rules.
+func Suppress(
+	diagnostics []Diagnostic, comments []parser.SourceComment,
+) []Diagnostic {
+	commentLines := map[int]bool{}
+	for _, comment := range comments {
+		if comment.Standalone {
+			commentLines[comment.SourceContext.Line] = true
+		}
+	}
+
+	file := suppression{}
+	lines := map[int]*suppression{}
+
+	for _, comment := range comments {
+		ids, wholeFile, ok := parseSuppressionComment(comment.Text)
+		if !ok {
+			continue
+		}
+
+		if wholeFile {
+			file.add(ids)
+			continue
+		}
+
+		line := comment.SourceContext.Line
+		if comment.Standalone {
+			line++
+			for commentLines[line] {
+				line++
+			}
+		}
+
+		if lines[line] == nil {
+			lines[line] = &suppression{}
+		}
+		lines[line].add(ids)
+	}
+
+	unsuppressed := []Diagnostic{}
+	for _, diagnostic := range diagnostics {
+		line := lines[diagnostic.Context.Line]
+		if file.suppresses(diagnostic.RuleID) ||
+			(line != nil && line.suppresses(diagnostic.RuleID)) {
+			continue
+		}
+
+		unsuppressed = append(unsuppressed, diagnostic)
+	}
+
+	return unsuppressed
+}
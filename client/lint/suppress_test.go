@@ -0,0 +1,97 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+
+	"alda.io/client/parser"
+	_ "alda.io/client/testing"
+)
+
+func TestSuppress(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected []string
+	}{
+		{
+			label: "without suppression comments",
+			given: "# a comment\nriff = c\nbass = d\npiano: (vol 250)",
+			expected: []string{
+				"piece.alda:2:1 variable \"riff\" is defined but never used " +
+					"(unused-variable)",
+				"piece.alda:3:1 variable \"bass\" is defined but never used " +
+					"(unused-variable)",
+				"piece.alda:4:13 implausible value for \"vol\": 250, outside the " +
+					"range 0 to 100 (attribute-range)",
+			},
+		},
+		{
+			label: "on the preceding line",
+			given: "# alda-lint:disable unused-variable\nriff = c\nbass = d\n" +
+				"# alda-lint:disable unused-variable\n" +
+				"piano: (vol 250)",
+			expected: []string{
+				"piece.alda:3:1 variable \"bass\" is defined but never used " +
+					"(unused-variable)",
+				"piece.alda:5:13 implausible value for \"vol\": 250, outside the " +
+					"range 0 to 100 (attribute-range)",
+			},
+		},
+		{
+			label: "more than one rule, and all rules",
+			given: "riff = c\n# alda-lint:disable attribute-range, unused-variable\n" +
+				"bass = d (vol 250)\n# alda-lint:disable\npiano: (vol 250)",
+			expected: []string{
+				"piece.alda:1:1 variable \"riff\" is defined but never used " +
+					"(unused-variable)",
+			},
+		},
+		{
+			label: "consecutive comments",
+			given: "# alda-lint:disable unused-variable\n" +
+				"# alda-lint:disable attribute-range\n# why\n" +
+				"riff = c (vol 250)",
+			expected: []string{},
+		},
+		{
+			label: "at the end of a line",
+			given: "riff = c # alda-lint:disable unused-variable\nbass = d",
+			expected: []string{
+				"piece.alda:2:1 variable \"bass\" is defined but never used " +
+					"(unused-variable)",
+			},
+		},
+		{
+			label: "in the whole file",
+			given: "riff = c\nbass = d\npiano: (vol 250)\n" +
+				"# alda-lint:disable-file unused-variable",
+			expected: []string{
+				"piece.alda:3:13 implausible value for \"vol\": 250, outside the " +
+					"range 0 to 100 (attribute-range)",
+			},
+		},
+	} {
+		comments := []parser.SourceComment{}
+		root, err := parser.Parse(
+			"piece.alda", testCase.given, parser.CollectComments(&comments),
+		)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+
+		actual := []string{}
+		for _, diagnostic := range Suppress(
+			Lint(root, UnusedVariables, AttributeRanges), comments,
+		) {
+			actual = append(actual, diagnostic.String())
+		}
+
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf(
+				"%s\nexpected: %q\nactual: %q",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
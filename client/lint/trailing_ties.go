@@ -0,0 +1,275 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"alda.io/client/parser"
+)
+
+// TrailingTies reports ties (or slurs), e.g. `c4~`, that don't connect to a
+// note, because they're on the last note of a part or voice, or the next note
+// is a rest, e.g. `c4~ | r`. These are usually left over from editing.
+//
+// It also notes (as Info) ties into a note of a different pitch, e.g. `c4~ d`,
+// which is a slur. That's sometimes intended, but can also be a mistake. Notes
+// that differ by an octave change in between, e.g. `c~ > c`, have different
+// pitches, but where the octave is set, e.g. `c~ o5 c`, the pitches aren't
+// compared.
+//
+// Where the event after a tie can't be told without evaluating the score, e.g.
+// at the end of a repeat or a variable definition, or before a variable
+// reference, the tie isn't checked.
+var TrailingTies = Rule{
+	ID:          "trailing-tie",
+	Description: "ties that don't connect to a note",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		for _, line := range tieLines(root) {
+			diagnostics = append(diagnostics, checkTies(line)...)
+		}
+
+		return diagnostics
+	},
+}
+
+// A tieLine is a sequence of events that are played one after another, e.g.
+// the events of a part, in which a tie connects each note to the next.
+type tieLine struct {
+	// The events, with nil where the next event can't be told without evaluating
+	// the score, e.g. at the end of a repeat
+	events []*parser.ASTNode
+	// What the line is the events of, e.g. "part", for diagnostics about its end
+	what string
+	// Whether the events that follow the line are unknown, e.g. at the end of a
+	// variable definition
+	open bool
+}
+
+// tieLines returns the lines of events in a score: one for each part, voice
+// and variable definition.
+func tieLines(root parser.ASTNode) []tieLine {
+	lines := []tieLine{}
+
+	for i := range root.Children {
+		part := &root.Children[i]
+
+		switch part.Type {
+		case parser.ImplicitPartNode, parser.PartNode:
+			line := tieLine{what: "part"}
+			line.events = appendTieEvents(
+				line.events, &part.Children[len(part.Children)-1], &lines,
+			)
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// appendTieEvents appends the events of a node to those of a line, and the
+// lines within the node (e.g. voices) to lines.
+func appendTieEvents(
+	events []*parser.ASTNode, node *parser.ASTNode, lines *[]tieLine,
+) []*parser.ASTNode {
+	switch node.Type {
+	case parser.EventSequenceNode:
+		for i := range node.Children {
+			events = appendTieEvents(events, &node.Children[i], lines)
+		}
+
+	case parser.RepeatNode:
+		// The last event of a repeat is followed by the first one on every
+		// repetition but the last, so what follows it is unknown.
+		events = appendTieEvents(events, &node.Children[0], lines)
+		events = append(events, nil)
+
+	case parser.OnRepetitionsNode:
+		events = append(events, nil)
+		events = appendTieEvents(events, &node.Children[0], lines)
+		events = append(events, nil)
+
+	case parser.VariableDefinitionNode:
+		line := tieLine{what: "variable definition", open: true}
+		line.events = appendTieEvents(nil, &node.Children[1], lines)
+		*lines = append(*lines, line)
+
+	case parser.VoiceGroupNode:
+		events = append(events, nil)
+
+		for i := range node.Children {
+			voice := &node.Children[i]
+			if voice.Type != parser.VoiceNode {
+				continue
+			}
+
+			line := tieLine{what: "voice"}
+			for j := range voice.Children {
+				line.events = appendTieEvents(line.events, &voice.Children[j], lines)
+			}
+			*lines = append(*lines, line)
+		}
+
+	case parser.VoiceNumberNode, parser.VoiceGroupEndMarkerNode:
+
+	default:
+		events = append(events, node)
+	}
+
+	return events
+}
+
+func checkTies(line tieLine) []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	for i, event := range line.events {
+		if event == nil || event.Type != parser.NoteNode {
+			continue
+		}
+
+		tie := tieOf(*event)
+		if tie == nil {
+			continue
+		}
+
+		diagnostic := Diagnostic{Context: tie.SourceContext}
+
+		next, octaves, known := nextTiedEvent(line.events[i+1:])
+		switch {
+		case !known:
+			continue
+
+		case next == nil:
+			if line.open {
+				continue
+			}
+
+			diagnostic.Message = fmt.Sprintf(
+				"tie at the end of a %s, which doesn't connect to a note", line.what,
+			)
+
+		case next.Type == parser.RestNode:
+			diagnostic.Message = "tie into a rest, which doesn't connect to a note"
+
+		case next.Type == parser.NoteNode || next.Type == parser.ChordNode:
+			if octaves < 0 || samePitchInOctave(*event, *next, octaves) {
+				continue
+			}
+
+			diagnostic.Severity = Info
+			diagnostic.Message = "tie into a note of a different pitch, which is " +
+				"a slur"
+
+		default:
+			continue
+		}
+
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	return diagnostics
+}
+
+// tieOf returns the tie at the end of a note, if it has one.
+func tieOf(note parser.ASTNode) *parser.ASTNode {
+	for i := range note.Children {
+		if note.Children[i].Type == parser.TieNode {
+			return &note.Children[i]
+		}
+	}
+
+	return nil
+}
+
+// nextTiedEvent returns the event that a tie connects to, given the events
+// after the tied note: the first one that takes time, or nil at the end of the
+// line. It also returns the number of octaves by which the octave is changed
+// before the event, or -1 if the octave is set, and whether the event can be
+// told without evaluating the score.
+func nextTiedEvent(events []*parser.ASTNode) (*parser.ASTNode, int, bool) {
+	octaves := 0
+
+	for _, event := range events {
+		if event == nil {
+			return nil, 0, false
+		}
+
+		switch event.Type {
+		case parser.BarlineNode, parser.LispListNode, parser.MarkerNode:
+		case parser.OctaveUpNode:
+			if octaves >= 0 {
+				octaves++
+			}
+		case parser.OctaveDownNode:
+			if octaves >= 0 {
+				octaves--
+			}
+		case parser.OctaveSetNode:
+			octaves = -1
+		default:
+			return event, octaves, true
+		}
+	}
+
+	return nil, 0, true
+}
+
+// samePitchInOctave reports whether a tied note has the same pitch as the
+// note, or one of the notes of the chord, that it's tied to, given the number
+// of octaves by which the octave is changed in between.
+func samePitchInOctave(
+	tied parser.ASTNode, next parser.ASTNode, octaves int,
+) bool {
+	if octaves != 0 {
+		return false
+	}
+
+	if next.Type == parser.NoteNode {
+		return notePitch(tied) == notePitch(next)
+	}
+
+	// Within a chord, an octave change applies to the notes after it.
+	for _, child := range next.Children {
+		switch child.Type {
+		case parser.NoteNode:
+			if notePitch(tied) == notePitch(child) {
+				return true
+			}
+		case parser.OctaveUpNode, parser.OctaveDownNode, parser.OctaveSetNode:
+			return false
+		}
+	}
+
+	return false
+}
+
+// notePitch returns the letter and accidentals of a note, e.g. "c+".
+func notePitch(note parser.ASTNode) string {
+	if len(note.Children) == 0 {
+		return ""
+	}
+
+	builder := strings.Builder{}
+
+	for _, node := range note.Children[0].Children {
+		switch node.Type {
+		case parser.NoteLetterNode:
+			letter, _ := node.Literal.(rune)
+			builder.WriteRune(letter)
+		case parser.NoteAccidentalsNode:
+			for _, accidental := range node.Children {
+				switch accidental.Type {
+				case parser.SharpNode:
+					builder.WriteRune('+')
+				case parser.FlatNode:
+					builder.WriteRune('-')
+				case parser.NaturalNode:
+					builder.WriteRune('_')
+				}
+			}
+		}
+	}
+
+	return builder.String()
+}
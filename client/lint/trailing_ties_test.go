@@ -0,0 +1,64 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestTrailingTies(t *testing.T) {
+	executeLintTestCases(
+		t,
+		TrailingTies,
+		lintTestCase{
+			label:    "tie into the same pitch",
+			given:    "piano: c2~ | c2 d+4~ (vol 50) d+ > e~ < > e c/e~ | e/g",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "tie at the end of a part",
+			given: "piano: c d e~\nviolin: c [d e~] >",
+			expected: []string{
+				"piece.alda:1:13 tie at the end of a part, which doesn't connect to " +
+					"a note (trailing-tie)",
+				"piece.alda:2:15 tie at the end of a part, which doesn't connect to " +
+					"a note (trailing-tie)",
+			},
+		},
+		lintTestCase{
+			label: "tie at the end of a voice",
+			given: "piano: V1: c d~ V2: e f",
+			expected: []string{
+				"piece.alda:1:15 tie at the end of a voice, which doesn't connect " +
+					"to a note (trailing-tie)",
+			},
+		},
+		lintTestCase{
+			label: "tie into a rest",
+			given: "piano: c2~ | r2 d",
+			expected: []string{
+				"piece.alda:1:10 tie into a rest, which doesn't connect to a note " +
+					"(trailing-tie)",
+			},
+		},
+		lintTestCase{
+			label: "tie into a different pitch",
+			given: "piano: c~ d e-~ e c~ > c f~ a/c",
+			expected: []string{
+				"piece.alda:1:9 info: tie into a note of a different pitch, which " +
+					"is a slur (trailing-tie)",
+				"piece.alda:1:15 info: tie into a note of a different pitch, which " +
+					"is a slur (trailing-tie)",
+				"piece.alda:1:20 info: tie into a note of a different pitch, which " +
+					"is a slur (trailing-tie)",
+				"piece.alda:1:27 info: tie into a note of a different pitch, which " +
+					"is a slur (trailing-tie)",
+			},
+		},
+		lintTestCase{
+			label:    "next event unknown",
+			given:    "riff = c d~\npiano: [c d~]*2 e~ riff f~ o5 f g~ V1: g",
+			expected: []string{},
+		},
+	)
+}
@@ -0,0 +1,50 @@
+package lint
+
+import (
+	"fmt"
+
+	"alda.io/client/parser"
+)
+
+// UndefinedMarkers reports jumps to markers, e.g. `@chorus`, where the marker
+// isn't defined anywhere in the score, along with the defined marker that a
+// misspelled name was probably meant to be. A marker can be jumped to from any
+// part, not just the one that defines it.
+var UndefinedMarkers = Rule{
+	ID:          "undefined-marker",
+	Description: "jumps to markers that aren't defined",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		defined := map[string]bool{}
+		names := []string{}
+
+		for _, ref := range root.FindByType(parser.MarkerNode) {
+			name, _ := ref.Node.Literal.(string)
+			if !defined[name] {
+				defined[name] = true
+				names = append(names, name)
+			}
+		}
+
+		for _, ref := range root.FindByType(parser.AtMarkerNode) {
+			name, _ := ref.Node.Literal.(string)
+			if defined[name] {
+				continue
+			}
+
+			diagnostic := Diagnostic{
+				Context: ref.Node.SourceContext,
+				Message: fmt.Sprintf("undefined marker \"%s\"", name),
+			}
+
+			if match, ok := closestMatch(name, names); ok {
+				diagnostic.Suggestion = match
+			}
+
+			diagnostics = append(diagnostics, diagnostic)
+		}
+
+		return diagnostics
+	},
+}
@@ -0,0 +1,39 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestUndefinedMarkers(t *testing.T) {
+	executeLintTestCases(
+		t,
+		UndefinedMarkers,
+		lintTestCase{
+			label:    "resolved references",
+			given:    "piano: %verse c d %chorus e\nviolin: @chorus f @verse g",
+			expected: []string{},
+		},
+		lintTestCase{
+			label:    "reference in the part that defines the marker",
+			given:    "piano: c %verse d\nviolin: e\npiano: @verse f",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "unresolved reference",
+			given: "piano: %verse c\nviolin: @bridge d",
+			expected: []string{
+				"piece.alda:2:9 undefined marker \"bridge\" (undefined-marker)",
+			},
+		},
+		lintTestCase{
+			label: "near-miss spelling",
+			given: "piano: %chorus c\nviolin: @chrous d @chorus e",
+			expected: []string{
+				"piece.alda:2:9 undefined marker \"chrous\"; did you mean " +
+					"\"chorus\"? (undefined-marker)",
+			},
+		},
+	)
+}
@@ -0,0 +1,74 @@
+package lint
+
+import (
+	"fmt"
+
+	"alda.io/client/parser"
+)
+
+// UndefinedVariables reports variable references that don't refer to a
+// preceding definition (see walkVariables for the scoping rules), along with
+// the defined variable that a misspelled reference was probably meant to be.
+// A reference to a variable that's only defined later in the score is
+// reported, too, because the variable isn't defined yet when it's referenced.
+// Both are reported as errors, as the score fails to play.
+var UndefinedVariables = Rule{
+	ID:          "undefined-variable",
+	Description: "variable references without a preceding definition",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		// The line of the first definition of each variable in the score
+		firstDefinitions := map[string]int{}
+		names := []string{}
+
+		walkVariables(root, variableVisitor{
+			define: func(name string, node parser.ASTNode) {
+				if _, ok := firstDefinitions[name]; !ok {
+					firstDefinitions[name] = node.SourceContext.Line
+					names = append(names, name)
+				}
+			},
+			reference: func(name string, node parser.ASTNode) {},
+		})
+
+		defined := map[string]bool{}
+
+		walkVariables(root, variableVisitor{
+			define: func(name string, node parser.ASTNode) {
+				defined[name] = true
+			},
+			reference: func(name string, node parser.ASTNode) {
+				if defined[name] {
+					return
+				}
+
+				if line, ok := firstDefinitions[name]; ok {
+					diagnostics = append(diagnostics, Diagnostic{
+						Severity: Error,
+						Context:  node.SourceContext,
+						Message: fmt.Sprintf(
+							"variable \"%s\" is used before it's defined at line %d",
+							name, line,
+						),
+					})
+					return
+				}
+
+				diagnostic := Diagnostic{
+					Severity: Error,
+					Context:  node.SourceContext,
+					Message:  fmt.Sprintf("undefined variable \"%s\"", name),
+				}
+
+				if match, ok := closestMatch(name, names); ok {
+					diagnostic.Suggestion = match
+				}
+
+				diagnostics = append(diagnostics, diagnostic)
+			},
+		})
+
+		return diagnostics
+	},
+}
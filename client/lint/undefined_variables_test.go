@@ -0,0 +1,86 @@
+package lint
+
+import (
+	"testing"
+
+	"alda.io/client/parser"
+	_ "alda.io/client/testing"
+)
+
+func TestUndefinedVariables(t *testing.T) {
+	executeLintTestCases(
+		t,
+		UndefinedVariables,
+		lintTestCase{
+			label:    "defined variables",
+			given:    "riff = c d e\nbass = riff f\npiano: riff bass",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "forward reference",
+			given: "piano: riff\nriff = c d e\nviolin: riff",
+			expected: []string{
+				"piece.alda:1:8 error: variable \"riff\" is used before it's " +
+					"defined at line 2 (undefined-variable)",
+			},
+		},
+		lintTestCase{
+			label: "typo with a suggestion",
+			given: "riff = c d e\nbassline = f g\npiano: rif basline",
+			expected: []string{
+				"piece.alda:3:8 error: undefined variable \"rif\"; did you mean " +
+					"\"riff\"? (undefined-variable)",
+				"piece.alda:3:12 error: undefined variable \"basline\"; did you mean " +
+					"\"bassline\"? (undefined-variable)",
+			},
+		},
+		lintTestCase{
+			label: "nothing close enough to suggest",
+			given: "riff = c d e\npiano: melody",
+			expected: []string{
+				"piece.alda:2:8 error: undefined variable \"melody\" " +
+					"(undefined-variable)",
+			},
+		},
+		lintTestCase{
+			label: "reference inside another definition",
+			given: "bass = riff f\nriff = c d e\npiano: bass",
+			expected: []string{
+				"piece.alda:1:8 error: variable \"riff\" is used before it's " +
+					"defined at line 2 (undefined-variable)",
+			},
+		},
+		lintTestCase{
+			label: "self-reference in the first definition",
+			given: "riff = riff c\npiano: riff",
+			expected: []string{
+				"piece.alda:1:8 error: variable \"riff\" is used before it's " +
+					"defined at line 1 (undefined-variable)",
+			},
+		},
+		lintTestCase{
+			label: "references inside repeats and voices",
+			given: "riff = c d\npiano: [riff rif]*2 V1: riff V2: riff2 V0:",
+			expected: []string{
+				"piece.alda:2:14 error: undefined variable \"rif\"; did you mean " +
+					"\"riff\"? (undefined-variable)",
+				"piece.alda:2:34 error: undefined variable \"riff2\"; did you mean " +
+					"\"riff\"? (undefined-variable)",
+			},
+		},
+	)
+}
+
+// A score that references an undefined variable fails to play, so linting it
+// fails without any configuration.
+func TestUndefinedVariablesExitCode(t *testing.T) {
+	root, err := parser.Parse("piece.alda", "piano: c d e foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diagnostics := LintWithConfig(root, nil, Config{})
+	if code := ExitCode(diagnostics, false); code != ExitProblems {
+		t.Errorf("expected %d, got %d: %v", ExitProblems, code, diagnostics)
+	}
+}
@@ -0,0 +1,148 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"alda.io/client/model"
+	"alda.io/client/parser"
+)
+
+// UnknownAttributes reports S-expressions in a score, e.g. `(temo 120)`, that
+// call something other than an attribute or function that alda-lisp knows
+// about, along with the one that a misspelled name was probably meant to be.
+// Otherwise, the mistake would only be reported when the score is evaluated.
+// It also reports known attributes and functions that are given a number of
+// arguments that none of their signatures take, e.g. `(tempo)`.
+//
+// Only the S-expressions that are events in the score are checked, not the
+// ones nested within them. To allow other names, see
+// UnknownAttributesAllowing.
+var UnknownAttributes = UnknownAttributesAllowing()
+
+// UnknownAttributesAllowing returns a version of the UnknownAttributes rule
+// that doesn't report S-expressions that call the given names, e.g. for a
+// score that's evaluated by a player with functions of its own.
+func UnknownAttributesAllowing(names ...string) Rule {
+	allowed := map[string]bool{}
+	for _, name := range names {
+		allowed[name] = true
+	}
+
+	return Rule{
+		ID:          "unknown-attribute",
+		Description: "S-expressions that call unknown attributes or functions",
+		Check: func(root parser.ASTNode) []Diagnostic {
+			diagnostics := []Diagnostic{}
+
+			for _, list := range topLevelLispLists(root) {
+				if len(list.Children) == 0 ||
+					list.Children[0].Type != parser.LispSymbolNode {
+					continue
+				}
+
+				head := list.Children[0]
+				name, _ := head.Literal.(string)
+				if allowed[name] {
+					continue
+				}
+
+				function, known := model.LookupLispFunction(name)
+				if !known {
+					diagnostic := Diagnostic{
+						Context: head.SourceContext,
+						Message: fmt.Sprintf("unknown attribute or function \"%s\"", name),
+					}
+
+					if match, ok := closestMatch(name, model.LispFunctionNames()); ok {
+						diagnostic.Suggestion = match
+					}
+
+					diagnostics = append(diagnostics, diagnostic)
+					continue
+				}
+
+				arguments := len(list.Children) - 1
+				if expected, ok := argumentCounts(function, arguments); !ok {
+					diagnostics = append(diagnostics, Diagnostic{
+						Context: head.SourceContext,
+						Message: fmt.Sprintf(
+							"wrong number of arguments to \"%s\": expected %s, got %d",
+							name, expected, arguments,
+						),
+					})
+				}
+			}
+
+			return diagnostics
+		},
+	}
+}
+
+// topLevelLispLists returns the S-expressions that are events in the score,
+// i.e. the ones that aren't nested within other S-expressions.
+func topLevelLispLists(node parser.ASTNode) []parser.ASTNode {
+	if node.Type == parser.LispListNode {
+		return []parser.ASTNode{node}
+	}
+
+	lists := []parser.ASTNode{}
+	for _, child := range node.Children {
+		lists = append(lists, topLevelLispLists(child)...)
+	}
+
+	return lists
+}
+
+// argumentCounts reports whether a function takes the given number of
+// arguments, and describes the numbers of arguments that it takes, e.g. "1 or
+// 2" or "at least 1".
+func argumentCounts(
+	function model.LispFunction, arguments int,
+) (string, bool) {
+	counts := map[int]bool{}
+	// The fewest arguments taken by a variadic signature, or -1 if there's none
+	minimum := -1
+
+	for _, signature := range function.Signatures {
+		count := len(signature.ArgumentTypes)
+
+		if count > 0 {
+			if _, ok := signature.ArgumentTypes[count-1].(model.LispVariadic); ok {
+				if minimum == -1 || count-1 < minimum {
+					minimum = count - 1
+				}
+				continue
+			}
+		}
+
+		counts[count] = true
+	}
+
+	if counts[arguments] || (minimum != -1 && arguments >= minimum) {
+		return "", true
+	}
+
+	sorted := []int{}
+	for count := range counts {
+		sorted = append(sorted, count)
+	}
+	sort.Ints(sorted)
+
+	descriptions := []string{}
+	for _, count := range sorted {
+		descriptions = append(descriptions, fmt.Sprint(count))
+	}
+	if minimum != -1 {
+		descriptions = append(descriptions, fmt.Sprintf("at least %d", minimum))
+	}
+
+	if len(descriptions) == 1 {
+		return descriptions[0], false
+	}
+
+	last := len(descriptions) - 1
+	return strings.Join(descriptions[:last], ", ") + " or " +
+		descriptions[last], false
+}
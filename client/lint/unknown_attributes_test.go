@@ -0,0 +1,69 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestUnknownAttributes(t *testing.T) {
+	executeLintTestCases(
+		t,
+		UnknownAttributes,
+		lintTestCase{
+			label: "known attributes and functions",
+			given: "piano: (tempo 120) (tempo! 2 60) (vol 50)\n" +
+				"(key-sig '(a major)) (quant (+ 50 10)) c (pan 0) (transpose -2)\n" +
+				"(octave 'up) d",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "misspelled attributes",
+			given: "piano: (temo 120) c\n(quant! 90) (volum 50)",
+			expected: []string{
+				"piece.alda:1:9 unknown attribute or function \"temo\"; did you " +
+					"mean \"tempo\"? (unknown-attribute)",
+				"piece.alda:2:14 unknown attribute or function \"volum\"; did you " +
+					"mean \"volume\"? (unknown-attribute)",
+			},
+		},
+		lintTestCase{
+			label: "unknown attributes without a likely match",
+			given: "piano: (reverb 3) c",
+			expected: []string{
+				"piece.alda:1:9 unknown attribute or function \"reverb\" " +
+					"(unknown-attribute)",
+			},
+		},
+		lintTestCase{
+			label: "wrong number of arguments",
+			given: "piano: (tempo) c (vol 1 2) d (tempo 1 2 3)",
+			expected: []string{
+				"piece.alda:1:9 wrong number of arguments to \"tempo\": expected 1 " +
+					"or 2, got 0 (unknown-attribute)",
+				"piece.alda:1:19 wrong number of arguments to \"vol\": expected 1, " +
+					"got 2 (unknown-attribute)",
+				"piece.alda:1:31 wrong number of arguments to \"tempo\": expected 1 " +
+					"or 2, got 3 (unknown-attribute)",
+			},
+		},
+	)
+
+	executeLintTestCases(
+		t,
+		UnknownAttributesAllowing("reverb"),
+		lintTestCase{
+			label:    "allowed names",
+			given:    "piano: (reverb 3) c (reverb 1 2 3)",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "other names",
+			given: "piano: (reverb 3) c (echo 1)",
+			expected: []string{
+				"piece.alda:1:22 unknown attribute or function \"echo\" " +
+					"(unknown-attribute)",
+			},
+		},
+	)
+}
@@ -0,0 +1,81 @@
+package lint
+
+import (
+	"fmt"
+
+	"alda.io/client/model"
+	"alda.io/client/parser"
+)
+
+// UnknownInstruments reports names in part declarations, e.g. `pinao:`, that
+// are neither the name of an instrument nor an alias declared by an earlier
+// part declaration (e.g. `piano "lefthand":`), along with the one that a
+// misspelled name was probably meant to be. Otherwise, the mistake would only
+// be reported when the score is evaluated. Each name in a group declaration,
+// e.g. `violin/viola/cello "strings":`, is checked.
+//
+// The alias of a group also makes the names in the group available with the
+// alias as a prefix, e.g. `strings.violin`.
+var UnknownInstruments = Rule{
+	ID:          "unknown-instrument",
+	Description: "part declarations of unknown instruments",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		instruments := map[string]bool{}
+		for _, name := range model.InstrumentNames() {
+			instruments[name] = true
+		}
+
+		aliases := map[string]bool{}
+		aliasNames := []string{}
+		declareAlias := func(alias string) {
+			if !aliases[alias] {
+				aliases[alias] = true
+				aliasNames = append(aliasNames, alias)
+			}
+		}
+
+		for _, ref := range root.FindByType(parser.PartDeclarationNode) {
+			declaration := ref.Node
+			if len(declaration.Children) == 0 {
+				continue
+			}
+
+			names := []string{}
+
+			for _, nameNode := range declaration.Children[0].Children {
+				name, _ := nameNode.Literal.(string)
+				names = append(names, name)
+
+				if instruments[name] || aliases[name] {
+					continue
+				}
+
+				diagnostic := Diagnostic{
+					Context: nameNode.SourceContext,
+					Message: fmt.Sprintf("unknown instrument \"%s\"", name),
+				}
+
+				candidates := append(model.InstrumentNames(), aliasNames...)
+				if match, ok := closestMatch(name, candidates); ok {
+					diagnostic.Suggestion = match
+				}
+
+				diagnostics = append(diagnostics, diagnostic)
+			}
+
+			if len(declaration.Children) < 2 {
+				continue
+			}
+
+			alias, _ := declaration.Children[1].Literal.(string)
+			declareAlias(alias)
+			for _, name := range names {
+				declareAlias(alias + "." + name)
+			}
+		}
+
+		return diagnostics
+	},
+}
@@ -0,0 +1,47 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestUnknownInstruments(t *testing.T) {
+	executeLintTestCases(
+		t,
+		UnknownInstruments,
+		lintTestCase{
+			label: "instruments and their aliases",
+			given: "piano: c\nmidi-acoustic-grand-piano: d\n" +
+				"violin/viola/cello \"strings\": e",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "declared aliases",
+			given: "piano \"lefthand\": c\nviolin/viola \"strings\": d\n" +
+				"lefthand: e\nstrings: f\nstrings.viola: g\n" +
+				"lefthand/cello \"low\": a\nlow.lefthand: b",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "typos",
+			given: "pinao: c\nviolin/voila/cello: d\nflute/kazoo: e",
+			expected: []string{
+				"piece.alda:1:1 unknown instrument \"pinao\"; did you mean " +
+					"\"piano\"? (unknown-instrument)",
+				"piece.alda:2:8 unknown instrument \"voila\"; did you mean " +
+					"\"viola\"? (unknown-instrument)",
+				"piece.alda:3:7 unknown instrument \"kazoo\" (unknown-instrument)",
+			},
+		},
+		lintTestCase{
+			label: "alias used before it's declared",
+			given: "lefthand: c\npiano \"lefthand\": d\nlefthnd: e",
+			expected: []string{
+				"piece.alda:1:1 unknown instrument \"lefthand\" (unknown-instrument)",
+				"piece.alda:3:1 unknown instrument \"lefthnd\"; did you mean " +
+					"\"lefthand\"? (unknown-instrument)",
+			},
+		},
+	)
+}
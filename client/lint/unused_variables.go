@@ -0,0 +1,70 @@
+package lint
+
+import (
+	"fmt"
+
+	"alda.io/client/parser"
+)
+
+// UnusedVariables reports variable definitions that are never referenced,
+// which often means that a reference to the variable is misspelled. A
+// definition that's redefined before it's used is reported, too. (See
+// walkVariables for the scoping rules.)
+var UnusedVariables = Rule{
+	ID:          "unused-variable",
+	Description: "variable definitions that are never referenced",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		type definition struct {
+			name string
+			// The VariableNameNode of the definition
+			node       parser.ASTNode
+			references int
+		}
+
+		// The definition in effect for each variable name
+		definitions := map[string]*definition{}
+		// Every definition, in the order in which they appear
+		order := []*definition{}
+
+		walkVariables(root, variableVisitor{
+			define: func(name string, definitionNode parser.ASTNode) {
+				node := definitionNode.Children[0]
+
+				if previous, ok := definitions[name]; ok &&
+					previous.references == 0 {
+					diagnostics = append(diagnostics, Diagnostic{
+						Context: previous.node.SourceContext,
+						Message: fmt.Sprintf(
+							"variable \"%s\" is redefined at line %d before it's used",
+							name, node.SourceContext.Line,
+						),
+					})
+				}
+
+				definitions[name] = &definition{name: name, node: node}
+				order = append(order, definitions[name])
+			},
+			reference: func(name string, node parser.ASTNode) {
+				if definition, ok := definitions[name]; ok {
+					definition.references++
+				}
+			},
+		})
+
+		for _, definition := range order {
+			if definitions[definition.name] == definition &&
+				definition.references == 0 {
+				diagnostics = append(diagnostics, Diagnostic{
+					Context: definition.node.SourceContext,
+					Message: fmt.Sprintf(
+						"variable \"%s\" is defined but never used", definition.name,
+					),
+				})
+			}
+		}
+
+		return diagnostics
+	},
+}
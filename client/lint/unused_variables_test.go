@@ -0,0 +1,61 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestUnusedVariables(t *testing.T) {
+	executeLintTestCases(
+		t,
+		UnusedVariables,
+		lintTestCase{
+			label:    "used variables",
+			given:    "riff = c d e\nbass = riff riff\npiano: bass\nviolin: riff",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "unused variables",
+			given: "riff = c d e\nbass = f g\npiano: riff",
+			expected: []string{
+				"piece.alda:2:1 variable \"bass\" is defined but never used " +
+					"(unused-variable)",
+			},
+		},
+		lintTestCase{
+			label: "reference before the definition",
+			given: "piano: riff\nriff = c d e",
+			expected: []string{
+				"piece.alda:2:1 variable \"riff\" is defined but never used " +
+					"(unused-variable)",
+			},
+		},
+		lintTestCase{
+			label: "redefined before it's used",
+			given: "riff = c d e\nriff = f g\npiano: riff",
+			expected: []string{
+				"piece.alda:1:1 variable \"riff\" is redefined at line 2 before " +
+					"it's used (unused-variable)",
+			},
+		},
+		lintTestCase{
+			label:    "redefined after it's used",
+			given:    "riff = c d e\npiano: riff\nriff = f g\nviolin: riff",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "redefined in terms of itself, then unused",
+			given: "riff = c d e\nriff = riff f\npiano: c",
+			expected: []string{
+				"piece.alda:2:1 variable \"riff\" is defined but never used " +
+					"(unused-variable)",
+			},
+		},
+		lintTestCase{
+			label:    "used in another part and within nested events",
+			given:    "piano: riff = c d\nviolin: [{riff}2]*2 V1: riff V0:",
+			expected: []string{},
+		},
+	)
+}
@@ -0,0 +1,47 @@
+package lint
+
+import "alda.io/client/parser"
+
+// variableVisitor is called for each variable definition and reference in an
+// AST, in the order in which they take effect (see walkVariables).
+type variableVisitor struct {
+	// define is called with the name and the VariableDefinitionNode of a
+	// definition.
+	define func(name string, definition parser.ASTNode)
+	// reference is called with the name and the VariableReferenceNode of a
+	// reference.
+	reference func(name string, node parser.ASTNode)
+}
+
+// walkVariables visits the variable definitions and references in the AST in
+// the order in which they take effect, which follows Alda's scoping rules: a
+// variable can be referenced anywhere after it's defined, in any part, until
+// it's redefined. The body of a definition is evaluated where the variable is
+// defined, so the references in the body (e.g. `riff = riff c`) are visited
+// before the definition itself.
+func walkVariables(node parser.ASTNode, visitor variableVisitor) {
+	switch node.Type {
+	case parser.VariableDefinitionNode:
+		if len(node.Children) != 2 {
+			return
+		}
+
+		name, ok := node.Children[0].Literal.(string)
+		if !ok {
+			return
+		}
+
+		walkVariables(node.Children[1], visitor)
+		visitor.define(name, node)
+
+	case parser.VariableReferenceNode:
+		if name, ok := node.Literal.(string); ok {
+			visitor.reference(name, node)
+		}
+
+	default:
+		for _, child := range node.Children {
+			walkVariables(child, visitor)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package lint
+
+import (
+	"fmt"
+
+	"alda.io/client/parser"
+)
+
+// VoiceGroups reports voice groups, e.g. `V1: c d V2: e f V0:`, whose
+// structure is likely to be a mistake: voices without any events, e.g. the
+// `V2:` in `V1: c V2: V3: e`, and voice numbers that appear more than once in
+// the same group, e.g. `V1: c V1: e`, which play the events of both voices in
+// one voice.
+//
+// It also notes (as Info) voice groups in a part that aren't ended with `V0:`,
+// so that the last voice continues to the end of the part, e.g. `V1: c V2: e
+// | f g` plays `f g` in voice 2. That's legal, but events written after the
+// voices are often meant to be played after all of them. Voice groups within
+// an event sequence or a cram expression end where it does, so they aren't
+// noted.
+var VoiceGroups = Rule{
+	ID:          "voice-group",
+	Description: "empty, duplicate and unended voices",
+	Check: func(root parser.ASTNode) []Diagnostic {
+		diagnostics := []Diagnostic{}
+
+		for _, part := range root.Children {
+			switch part.Type {
+			case parser.ImplicitPartNode, parser.PartNode:
+				events := part.Children[len(part.Children)-1]
+				for _, event := range events.Children {
+					if event.Type == parser.VoiceGroupNode {
+						diagnostics = append(diagnostics, checkVoiceGroupEnd(event)...)
+					}
+				}
+			}
+		}
+
+		for _, ref := range root.FindByType(parser.VoiceGroupNode) {
+			diagnostics = append(diagnostics, checkVoices(ref.Node)...)
+		}
+
+		return diagnostics
+	},
+}
+
+// checkVoiceGroupEnd returns a diagnostic if a voice group in a part isn't
+// ended with `V0:`.
+func checkVoiceGroupEnd(group parser.ASTNode) []Diagnostic {
+	for _, child := range group.Children {
+		if child.Type == parser.VoiceGroupEndMarkerNode {
+			return nil
+		}
+	}
+
+	return []Diagnostic{{
+		Severity: Info,
+		Context:  group.SourceContext,
+		Message: "voice group isn't ended with `V0:`, so its last voice " +
+			"continues to the end of the part",
+	}}
+}
+
+// checkVoices returns diagnostics for the empty voices in a voice group, and
+// those whose voice number appears earlier in the group.
+func checkVoices(group parser.ASTNode) []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	// The voice number nodes of the voices in the group, by voice number
+	numbers := map[int32]parser.ASTNode{}
+
+	for _, voice := range group.Children {
+		if voice.Type != parser.VoiceNode || len(voice.Children) < 2 {
+			continue
+		}
+
+		numberNode := voice.Children[0]
+		number, _ := numberNode.Literal.(int32)
+
+		if len(voice.Children[1].Children) == 0 {
+			diagnostics = append(diagnostics, Diagnostic{
+				Context: voice.SourceContext,
+				Message: fmt.Sprintf(
+					"voice %d is empty; remove it or add events to it", number,
+				),
+			})
+		}
+
+		if first, ok := numbers[number]; ok {
+			diagnostics = append(diagnostics, Diagnostic{
+				Context: voice.SourceContext,
+				Message: fmt.Sprintf(
+					"voice %d appears more than once in the same voice group; it "+
+						"also starts at line %d, column %d",
+					number, first.SourceContext.Line, first.SourceContext.Column,
+				),
+			})
+			continue
+		}
+
+		numbers[number] = numberNode
+	}
+
+	return diagnostics
+}
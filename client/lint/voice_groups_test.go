@@ -0,0 +1,70 @@
+package lint
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestVoiceGroups(t *testing.T) {
+	executeLintTestCases(
+		t,
+		VoiceGroups,
+		lintTestCase{
+			label:    "ended voice group",
+			given:    "piano: V1: c d V2: e f V0: g\nviolin: [V1: c V2: e] f",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "empty voice",
+			given: "piano: V1: c V2: V3: e V0:\nviolin: V1: c V2: V0:",
+			expected: []string{
+				"piece.alda:1:14 voice 2 is empty; remove it or add events to it " +
+					"(voice-group)",
+				"piece.alda:2:15 voice 2 is empty; remove it or add events to it " +
+					"(voice-group)",
+			},
+		},
+		lintTestCase{
+			label: "duplicate voice number",
+			given: "piano: V1: c V2: e V1: g V0:",
+			expected: []string{
+				"piece.alda:1:20 voice 1 appears more than once in the same voice " +
+					"group; it also starts at line 1, column 8 (voice-group)",
+			},
+		},
+		lintTestCase{
+			label:    "same voice number in different groups",
+			given:    "piano: V1: c V2: e V0: d V1: c V2: e V0:",
+			expected: []string{},
+		},
+		lintTestCase{
+			label: "unended voice group",
+			given: "piano: V1: c V2: e | f g\nviolin: c\nV1: d V2: f",
+			expected: []string{
+				"piece.alda:1:8 info: voice group isn't ended with `V0:`, so its " +
+					"last voice continues to the end of the part (voice-group)",
+				"piece.alda:3:1 info: voice group isn't ended with `V0:`, so its " +
+					"last voice continues to the end of the part (voice-group)",
+			},
+		},
+		lintTestCase{
+			label: "unended voice group in an implicit part",
+			given: "c V1: d V2: e",
+			expected: []string{
+				"piece.alda:1:3 info: voice group isn't ended with `V0:`, so its " +
+					"last voice continues to the end of the part (voice-group)",
+			},
+		},
+		lintTestCase{
+			label: "nested voice group",
+			given: "piano: [V1: c V1: V2: e]*2",
+			expected: []string{
+				"piece.alda:1:15 voice 1 is empty; remove it or add events to it " +
+					"(voice-group)",
+				"piece.alda:1:15 voice 1 appears more than once in the same voice " +
+					"group; it also starts at line 1, column 9 (voice-group)",
+			},
+		},
+	)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"alda.io/client/cmd"
@@ -28,6 +29,12 @@ func main() {
 
 	if err := cmd.Execute(); err != nil {
 		exitCode = 1
+
+		var exitCodeErr *help.ExitCodeError
+		if errors.As(err, &exitCodeErr) {
+			exitCode = exitCodeErr.Code
+		}
+
 		help.PresentError(err)
 	}
 
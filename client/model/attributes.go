@@ -434,6 +434,23 @@ func (kss KeySignatureSet) updatePart(part *Part, globalUpdate bool) {
 	part.KeySignature = kss.KeySignature
 }
 
+// TimeSignatureSet sets the time signature of all active parts.
+type TimeSignatureSet struct {
+	TimeSignature TimeSignature
+}
+
+// JSON implements RepresentableAsJSON.JSON.
+func (tss TimeSignatureSet) JSON() *json.Container {
+	return json.Object(
+		"attribute", "time-signature",
+		"value", tss.TimeSignature.JSON(),
+	)
+}
+
+func (tss TimeSignatureSet) updatePart(part *Part, globalUpdate bool) {
+	part.TimeSignature = tss.TimeSignature
+}
+
 // TranspositionSet sets the transposition of all active parts.
 type TranspositionSet struct {
 	Semitones int32
@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	_ "alda.io/client/testing"
@@ -128,6 +129,15 @@ func expectPartKeySignature(
 	)
 }
 
+func expectPartTimeSignature(
+	instrument string, timeSignature TimeSignature,
+) func(s *Score) error {
+	return expectPartValueDeepEquals(
+		instrument, "time signature",
+		func(part *Part) interface{} { return part.TimeSignature }, timeSignature,
+	)
+}
+
 func expectPartTransposition(
 	instrument string, transposition int32,
 ) func(s *Score) error {
@@ -1054,6 +1064,58 @@ func TestAttributes(t *testing.T) {
 				),
 			},
 		},
+		scoreUpdateTestCase{
+			label: "initial time signature",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+			},
+			expectations: []scoreUpdateExpectation{
+				expectPartTimeSignature(
+					"piano", TimeSignature{Numerator: 4, Denominator: 4},
+				),
+			},
+		},
+		scoreUpdateTestCase{
+			// (time-signature '(6 8))
+			label: "set time signature via lisp",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				LispList{Elements: []LispForm{
+					LispSymbol{Name: "time-signature"},
+					LispQuotedForm{Form: LispList{Elements: []LispForm{
+						LispNumber{Value: 6}, LispNumber{Value: 8},
+					}}},
+				}},
+			},
+			expectations: []scoreUpdateExpectation{
+				expectPartTimeSignature(
+					"piano", TimeSignature{Numerator: 6, Denominator: 8},
+				),
+			},
+		},
+		scoreUpdateTestCase{
+			// (time-signature '(3 5))
+			label: "time signature with a denominator that isn't a power of 2",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				LispList{Elements: []LispForm{
+					LispSymbol{Name: "time-signature"},
+					LispQuotedForm{Form: LispList{Elements: []LispForm{
+						LispNumber{Value: 3}, LispNumber{Value: 5},
+					}}},
+				}},
+			},
+			errorExpectations: []scoreUpdateErrorExpectation{
+				func(err error) error {
+					expected := "invalid time signature 3/5: the denominator must " +
+						"be a power of 2"
+					if !strings.Contains(err.Error(), expected) {
+						return err
+					}
+					return nil
+				},
+			},
+		},
 		scoreUpdateTestCase{
 			label: "initial transposition",
 			updates: []ScoreUpdate{
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"alda.io/client/help"
+	"alda.io/client/json"
+	"github.com/mohae/deepcopy"
+)
+
+// MaxGlissandoInterval is the widest interval, in semitones, that a glissando
+// can span between two consecutive notes.
+//
+// A glissando is performed by bending the pitch of the first note, and the
+// player can only bend a pitch this far in either direction.
+const MaxGlissandoInterval = 24
+
+// A Glissando is a sequence of notes where the pitch of each note slides into
+// the pitch of the next.
+//
+// Barlines are allowed to occur between the notes.
+type Glissando struct {
+	SourceContext AldaSourceContext
+	Events        []ScoreUpdate
+}
+
+// GetSourceContext implements HasSourceContext.GetSourceContext.
+func (glissando Glissando) GetSourceContext() AldaSourceContext {
+	return glissando.SourceContext
+}
+
+// JSON implements RepresentableAsJSON.JSON.
+func (glissando Glissando) JSON() *json.Container {
+	events := json.Array()
+	for _, event := range glissando.Events {
+		events.ArrayAppend(event.JSON())
+	}
+
+	return json.Object(
+		"type", "glissando",
+		"value", json.Object("events", events),
+	)
+}
+
+// UpdateScore implements ScoreUpdate.UpdateScore by adding each note in the
+// glissando to the score, and marking the note events of each note except the
+// last one as sliding into the pitch of the following note in the same part.
+func (glissando Glissando) UpdateScore(score *Score) error {
+	// For each part, the index in score.Events of the note event that the next
+	// note in the glissando will slide from.
+	slideFrom := map[*Part]int{}
+
+	for _, event := range glissando.Events {
+		eventsBefore := len(score.Events)
+
+		if err := event.UpdateScore(score); err != nil {
+			return err
+		}
+
+		if _, isNote := event.(Note); !isNote {
+			continue
+		}
+
+		for i := eventsBefore; i < len(score.Events); i++ {
+			noteEvent, ok := score.Events[i].(NoteEvent)
+			if !ok {
+				continue
+			}
+
+			if j, ok := slideFrom[noteEvent.Part]; ok {
+				from := score.Events[j].(NoteEvent)
+
+				interval := noteEvent.MidiNote - from.MidiNote
+				if interval < -MaxGlissandoInterval || interval > MaxGlissandoInterval {
+					return &AldaSourceError{
+						Context: event.GetSourceContext(),
+						Err: help.UserFacingErrorf(
+							"a glissando can't span more than %d semitones "+
+								"(MIDI note %d to %d)",
+							MaxGlissandoInterval, from.MidiNote, noteEvent.MidiNote,
+						),
+					}
+				}
+
+				from.Glissando = true
+				from.GlissandoMidiNote = noteEvent.MidiNote
+				score.Events[j] = from
+			}
+
+			slideFrom[noteEvent.Part] = i
+		}
+	}
+
+	return nil
+}
+
+// DurationMs implements ScoreUpdate.DurationMs by returning the total duration
+// of the notes in the glissando.
+func (glissando Glissando) DurationMs(part *Part) float64 {
+	durationMs := 0.0
+
+	for _, event := range glissando.Events {
+		durationMs += event.DurationMs(part)
+	}
+
+	return durationMs
+}
+
+// VariableValue implements ScoreUpdate.VariableValue by returning a version of
+// the glissando where each event is the captured value of that event.
+func (glissando Glissando) VariableValue(score *Score) (ScoreUpdate, error) {
+	result := deepcopy.Copy(glissando).(Glissando)
+	result.Events = []ScoreUpdate{}
+
+	for _, event := range glissando.Events {
+		eventValue, err := event.VariableValue(score)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Events = append(result.Events, eventValue)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func expectGlissandi(expectedTargets ...int32) func(*Score) error {
+	return func(s *Score) error {
+		if len(s.Events) != len(expectedTargets) {
+			return fmt.Errorf(
+				"expected %d events, got %d", len(expectedTargets), len(s.Events),
+			)
+		}
+
+		for i, expectedTarget := range expectedTargets {
+			note := s.Events[i].(NoteEvent)
+
+			// 0 means that the note shouldn't be the start of a glissando.
+			if expectedTarget == 0 {
+				if note.Glissando {
+					return fmt.Errorf(
+						"expected note #%d not to be a glissando, but it slides to %d",
+						i+1, note.GlissandoMidiNote,
+					)
+				}
+
+				continue
+			}
+
+			if !note.Glissando || note.GlissandoMidiNote != expectedTarget {
+				return fmt.Errorf(
+					"expected note #%d to slide to %d, but got %#v",
+					i+1, expectedTarget, note,
+				)
+			}
+		}
+
+		return nil
+	}
+}
+
+func glissandoNote(letter NoteLetter) Note {
+	return Note{
+		Pitch: LetterAndAccidentals{NoteLetter: letter},
+		Duration: Duration{
+			Components: []DurationComponent{NoteLength{Denominator: 4}},
+		},
+	}
+}
+
+func TestGlissando(t *testing.T) {
+	executeScoreUpdateTestCases(
+		t,
+		scoreUpdateTestCase{
+			label: "glissando between two notes",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				Glissando{Events: []ScoreUpdate{glissandoNote(C), glissandoNote(G)}},
+				glissandoNote(C),
+			},
+			expectations: []scoreUpdateExpectation{
+				expectMidiNoteNumbers(60, 67, 60),
+				expectNoteOffsets(0, 500, 1000),
+				expectGlissandi(67, 0, 0),
+			},
+		},
+		scoreUpdateTestCase{
+			label: "glissando across a barline",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				Glissando{
+					Events: []ScoreUpdate{
+						glissandoNote(C),
+						Barline{},
+						glissandoNote(E),
+						glissandoNote(G),
+					},
+				},
+			},
+			expectations: []scoreUpdateExpectation{
+				expectMidiNoteNumbers(60, 64, 67),
+				expectGlissandi(64, 67, 0),
+			},
+		},
+		scoreUpdateTestCase{
+			label: "glissando in multiple parts",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano", "flute"}},
+				Glissando{Events: []ScoreUpdate{glissandoNote(C), glissandoNote(D)}},
+			},
+			expectations: []scoreUpdateExpectation{
+				expectMidiNoteNumbers(60, 60, 62, 62),
+				expectGlissandi(62, 62, 0, 0),
+			},
+		},
+		scoreUpdateTestCase{
+			label: "glissando wider than two octaves",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				Glissando{
+					Events: []ScoreUpdate{
+						glissandoNote(C),
+						AttributeUpdate{PartUpdate: OctaveSet{OctaveNumber: 7}},
+						glissandoNote(C),
+					},
+				},
+			},
+			errorExpectations: []scoreUpdateErrorExpectation{
+				func(err error) error {
+					expected := "a glissando can't span more than 24 semitones " +
+						"(MIDI note 60 to 96)"
+					if !strings.Contains(err.Error(), expected) {
+						return err
+					}
+					return nil
+				},
+			},
+		},
+	)
+}
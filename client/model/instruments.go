@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"sort"
 )
 
 // An Instrument is a template for a Part.
@@ -231,6 +232,19 @@ func InstrumentsList() []string {
 	return list
 }
 
+// InstrumentNames returns the names of the instruments available to use in an
+// Alda score, along with their aliases (e.g. `piano`), in alphabetical order.
+func InstrumentNames() []string {
+	names := []string{}
+	for name := range stockInstruments {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
 var stockInstruments = map[string]Instrument{}
 
 func init() {
@@ -255,6 +269,13 @@ func init() {
 	}
 }
 
+// IsPercussionInstrument returns true if the identifier is the name or alias
+// of a percussion instrument, whose notes stand for drums rather than pitches.
+func IsPercussionInstrument(identifier string) bool {
+	instrument, ok := stockInstruments[identifier].(MidiInstrument)
+	return ok && instrument.IsPercussion
+}
+
 // stockInstrument returns a stock instrument, given an identifier which is the
 // name or alias of a stock instrument.
 //
@@ -283,3 +304,75 @@ func stockInstrumentName(identifier string) (string, error) {
 
 	return instrument.Name(), nil
 }
+
+// A NoteRange is a range of pitches, as MIDI note numbers, e.g. the range in
+// which an instrument can be played.
+type NoteRange struct {
+	Lowest  int32
+	Highest int32
+}
+
+// Contains reports whether a MIDI note number is within the range.
+func (nr NoteRange) Contains(midiNote int32) bool {
+	return nr.Lowest <= midiNote && midiNote <= nr.Highest
+}
+
+func (nr NoteRange) String() string {
+	return fmt.Sprintf(
+		"%s to %s", MidiNoteName(nr.Lowest), MidiNoteName(nr.Highest),
+	)
+}
+
+// The ranges in which instruments can be played, as sounding pitches (i.e.
+// the pitches that Alda plays, rather than the written pitches of transposing
+// instruments), keyed by instrument name. Instruments without a range that
+// players would agree on, e.g. synths and sound effects, are left out.
+var instrumentRanges = map[string]NoteRange{
+	"midi-acoustic-grand-piano":  {21, 108}, // A0 to C8
+	"midi-harpsichord":           {29, 89},  // F1 to F6
+	"midi-celesta":               {60, 108}, // C4 to C8
+	"midi-glockenspiel":          {79, 108}, // G5 to C8
+	"midi-vibraphone":            {53, 89},  // F3 to F6
+	"midi-marimba":               {36, 96},  // C2 to C7
+	"midi-xylophone":             {65, 108}, // F4 to C8
+	"midi-tubular-bells":         {60, 77},  // C4 to F5
+	"midi-acoustic-guitar-nylon": {40, 83},  // E2 to B5
+	"midi-acoustic-guitar-steel": {40, 86},  // E2 to D6
+	"midi-acoustic-bass":         {28, 67},  // E1 to G4
+	"midi-electric-bass-finger":  {28, 67},  // E1 to G4
+	"midi-electric-bass-pick":    {28, 67},  // E1 to G4
+	"midi-violin":                {55, 103}, // G3 to G7
+	"midi-viola":                 {48, 88},  // C3 to E6
+	"midi-cello":                 {36, 81},  // C2 to A5
+	"midi-contrabass":            {28, 67},  // E1 to G4
+	"midi-orchestral-harp":       {24, 103}, // C1 to G7
+	"midi-timpani":               {38, 60},  // D2 to C4
+	"midi-trumpet":               {52, 86},  // E3 to D6
+	"midi-trombone":              {40, 77},  // E2 to F5
+	"midi-tuba":                  {26, 65},  // D1 to F4
+	"midi-french-horn":           {35, 77},  // B1 to F5
+	"midi-soprano-saxophone":     {56, 87},  // G#3 to D#6
+	"midi-alto-saxophone":        {49, 80},  // C#3 to G#5
+	"midi-tenor-saxophone":       {44, 75},  // G#2 to D#5
+	"midi-baritone-saxophone":    {37, 68},  // C#2 to G#4
+	"midi-oboe":                  {58, 91},  // A#3 to G6
+	"midi-english-horn":          {52, 84},  // E3 to C6
+	"midi-bassoon":               {34, 75},  // A#1 to D#5
+	"midi-clarinet":              {50, 94},  // D3 to A#6
+	"midi-piccolo":               {74, 108}, // D5 to C8
+	"midi-flute":                 {60, 96},  // C4 to C7
+	"midi-recorder":              {72, 98},  // C5 to D7
+}
+
+// InstrumentRange returns the range in which an instrument can be played, as
+// sounding pitches, given the name or alias of a stock instrument, and whether
+// the instrument has a known range.
+func InstrumentRange(identifier string) (NoteRange, bool) {
+	name, err := stockInstrumentName(identifier)
+	if err != nil {
+		return NoteRange{}, false
+	}
+
+	noteRange, ok := instrumentRanges[name]
+	return noteRange, ok
+}
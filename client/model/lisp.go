@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -335,6 +336,28 @@ var specialForms = map[string]LispForm{
 
 var environment = map[string]LispForm{}
 
+// LookupLispFunction returns the built-in alda-lisp function with the given
+// name, e.g. `tempo` or `tempo!`.
+func LookupLispFunction(name string) (LispFunction, bool) {
+	function, hit := environment[name].(LispFunction)
+	return function, hit
+}
+
+// LispFunctionNames returns the names of the built-in alda-lisp functions, in
+// alphabetical order.
+func LispFunctionNames() []string {
+	names := []string{}
+	for name, value := range environment {
+		if _, ok := value.(LispFunction); ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
 type attributeFunctionSignature struct {
 	argumentTypes  []LispForm
 	implementation func(...LispForm) (PartUpdate, error)
@@ -778,6 +801,47 @@ func keySignatureFromList(form LispForm) (KeySignature, error) {
 	}
 }
 
+func timeSignatureFromList(form LispForm) (TimeSignature, error) {
+	list := form.(LispList)
+
+	sourceError := func(err error) error {
+		return &AldaSourceError{
+			Context: list.SourceContext,
+			Err:     err,
+		}
+	}
+
+	forms := list.Elements
+	if len(forms) != 2 {
+		return TimeSignature{}, sourceError(
+			fmt.Errorf("invalid time signature: %#v", forms),
+		)
+	}
+
+	numbers := []int32{}
+	for _, form := range forms {
+		if _, ok := form.(LispNumber); !ok {
+			return TimeSignature{}, sourceError(
+				fmt.Errorf("invalid time signature: %#v", forms),
+			)
+		}
+
+		number, err := integer(form)
+		if err != nil {
+			return TimeSignature{}, err
+		}
+
+		numbers = append(numbers, number)
+	}
+
+	timeSig := TimeSignature{Numerator: numbers[0], Denominator: numbers[1]}
+	if err := timeSig.Validate(); err != nil {
+		return TimeSignature{}, sourceError(err)
+	}
+
+	return timeSig, nil
+}
+
 func init() {
 	// Current octave. Used to calculate the pitch of notes.
 	defattribute([]string{"octave"},
@@ -1112,6 +1176,20 @@ func init() {
 		},
 	)
 
+	// The meter, e.g. '(3 4) for 3/4. This has no audible effect.
+	defattribute([]string{"time-signature", "time-sig"},
+		attributeFunctionSignature{
+			argumentTypes: []LispForm{LispList{}},
+			implementation: func(args ...LispForm) (PartUpdate, error) {
+				timeSig, err := timeSignatureFromList(args[0])
+				if err != nil {
+					return nil, err
+				}
+				return TimeSignatureSet{TimeSignature: timeSig}, nil
+			},
+		},
+	)
+
 	// The number of semitones to transpose. A negative number means transpose
 	// down, a positive number means transpose up.
 	defattribute([]string{"transposition", "transpose"},
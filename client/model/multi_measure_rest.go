@@ -0,0 +1,88 @@
+package model
+
+import (
+	"alda.io/client/help"
+	"alda.io/client/json"
+)
+
+// A MultiMeasureRest is a rest that lasts a number of whole measures, in the
+// time signature of each part at that point in the score.
+type MultiMeasureRest struct {
+	SourceContext AldaSourceContext
+	Measures      int32
+}
+
+// GetSourceContext implements HasSourceContext.GetSourceContext.
+func (rest MultiMeasureRest) GetSourceContext() AldaSourceContext {
+	return rest.SourceContext
+}
+
+// JSON implements RepresentableAsJSON.JSON.
+func (rest MultiMeasureRest) JSON() *json.Container {
+	return json.Object(
+		"type", "multi-measure-rest",
+		"value", json.Object("measures", rest.Measures),
+	)
+}
+
+// measureDuration returns the duration of a measure in the part's current time
+// signature.
+func measureDuration(part *Part) Duration {
+	return Duration{
+		Components: []DurationComponent{
+			NoteLengthBeats{Quantity: part.TimeSignature.MeasureBeats()},
+		},
+	}
+}
+
+// UpdateScore implements ScoreUpdate.UpdateScore by adjusting the
+// CurrentOffset, LastOffset, and Duration of all current parts.
+//
+// The rest is equivalent to a rest lasting one measure, repeated for each
+// measure, so like such a rest, it sets the default duration of each part to a
+// measure.
+func (rest MultiMeasureRest) UpdateScore(score *Score) error {
+	if rest.Measures < 1 {
+		return &AldaSourceError{
+			Context: rest.SourceContext,
+			Err: help.UserFacingErrorf(
+				"a multi-measure rest must last at least one measure",
+			),
+		}
+	}
+
+	if !score.chordMode {
+		score.ApplyGlobalAttributes()
+	}
+
+	for _, part := range score.CurrentParts {
+		duration := measureDuration(part)
+		durationMs := float64(rest.Measures) * duration.Ms(part.Tempo) *
+			part.TimeScale
+
+		if !score.chordMode {
+			part.LastOffset = part.CurrentOffset
+			part.CurrentOffset += durationMs
+		}
+
+		updateDefaultDuration(part, duration)
+	}
+
+	return nil
+}
+
+// DurationMs implements ScoreUpdate.DurationMs by returning the duration of the
+// rest in the context of the part's current time signature and tempo.
+//
+// Also updates the part's default duration, so that it can be correctly
+// considered when tallying the duration of subsequent events.
+func (rest MultiMeasureRest) DurationMs(part *Part) float64 {
+	duration := measureDuration(part)
+	updateDefaultDuration(part, duration)
+	return float64(rest.Measures) * duration.Ms(part.Tempo)
+}
+
+// VariableValue implements ScoreUpdate.VariableValue.
+func (rest MultiMeasureRest) VariableValue(score *Score) (ScoreUpdate, error) {
+	return rest, nil
+}
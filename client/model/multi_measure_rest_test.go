@@ -0,0 +1,109 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func timeSignatureUpdate(numerator int32, denominator int32) AttributeUpdate {
+	return AttributeUpdate{
+		PartUpdate: TimeSignatureSet{
+			TimeSignature: TimeSignature{
+				Numerator: numerator, Denominator: denominator,
+			},
+		},
+	}
+}
+
+func TestMultiMeasureRest(t *testing.T) {
+	executeScoreUpdateTestCases(
+		t,
+		scoreUpdateTestCase{
+			label: "multi-measure rest in 4/4",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				// A measure of 4/4 at 120 BPM = 2000 ms
+				MultiMeasureRest{Measures: 3},
+				Note{Pitch: LetterAndAccidentals{NoteLetter: C}},
+			},
+			expectations: []scoreUpdateExpectation{
+				expectNoteOffsets(6000),
+				// Like a rest lasting a measure, the rest sets the default duration.
+				expectNoteDurations(2000),
+				expectPartCurrentOffset("piano", 8000),
+			},
+		},
+		scoreUpdateTestCase{
+			label: "time signature changes before multi-measure rests",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				timeSignatureUpdate(3, 4),
+				MultiMeasureRest{Measures: 2},
+				timeSignatureUpdate(6, 8),
+				MultiMeasureRest{Measures: 1},
+				Note{Pitch: LetterAndAccidentals{NoteLetter: C}},
+			},
+			expectations: []scoreUpdateExpectation{
+				expectNoteOffsets(4500),
+				expectNoteDurations(1500),
+				expectPartLastOffset("piano", 4500),
+				expectPartCurrentOffset("piano", 6000),
+			},
+		},
+		scoreUpdateTestCase{
+			label: "multi-measure rest in parts with different time signatures",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				timeSignatureUpdate(3, 4),
+				PartDeclaration{Names: []string{"piano", "flute"}},
+				MultiMeasureRest{Measures: 2},
+			},
+			expectations: []scoreUpdateExpectation{
+				expectPartCurrentOffset("piano", 3000),
+				expectPartCurrentOffset("flute", 4000),
+			},
+		},
+		scoreUpdateTestCase{
+			label: "multi-measure rest within a cram expression",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				Cram{
+					Events: []ScoreUpdate{
+						MultiMeasureRest{Measures: 1},
+						Note{
+							Pitch: LetterAndAccidentals{NoteLetter: C},
+							Duration: Duration{
+								Components: []DurationComponent{NoteLength{Denominator: 1}},
+							},
+						},
+					},
+					Duration: Duration{
+						Components: []DurationComponent{NoteLength{Denominator: 1}},
+					},
+				},
+			},
+			expectations: []scoreUpdateExpectation{
+				expectNoteOffsets(1000),
+				expectPartCurrentOffset("piano", 2000),
+			},
+		},
+		scoreUpdateTestCase{
+			label: "multi-measure rest lasting no measures",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				MultiMeasureRest{Measures: 0},
+			},
+			errorExpectations: []scoreUpdateErrorExpectation{
+				func(err error) error {
+					expected := "a multi-measure rest must last at least one measure"
+					if !strings.Contains(err.Error(), expected) {
+						return err
+					}
+					return nil
+				},
+			},
+		},
+	)
+}
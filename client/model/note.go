@@ -47,11 +47,16 @@ type NoteEvent struct {
 	Volume          float64
 	TrackVolume     float64
 	Panning         float64
+	// When a note is the start of a glissando, its pitch slides over its audible
+	// duration until it reaches GlissandoMidiNote, the MIDI note of the next note
+	// in the glissando.
+	Glissando         bool
+	GlissandoMidiNote int32
 }
 
 // JSON implements RepresentableAsJSON.JSON.
 func (note NoteEvent) JSON() *json.Container {
-	return json.Object(
+	result := json.Object(
 		"part", note.Part.ID(),
 		"midi-note", note.MidiNote,
 		"offset", note.Offset,
@@ -61,6 +66,12 @@ func (note NoteEvent) JSON() *json.Container {
 		"track-volume", note.TrackVolume,
 		"panning", note.Panning,
 	)
+
+	if note.Glissando {
+		result.Set(note.GlissandoMidiNote, "glissando-midi-note")
+	}
+
+	return result
 }
 
 // EventOffset implements ScoreEvent.EventOffset by returning the offset of the
@@ -41,6 +41,7 @@ type Part struct {
 	TempoRole       TempoRole
 	Tempo           float64
 	KeySignature    KeySignature
+	TimeSignature   TimeSignature
 	Transposition   int32
 	ReferencePitch  float64
 	CurrentOffset   float64
@@ -102,6 +103,7 @@ func (part *Part) JSON() *json.Container {
 		"tempo-role", part.TempoRole.String(),
 		"tempo", part.Tempo,
 		"key-signature", part.KeySignature.JSON(),
+		"time-signature", part.TimeSignature.JSON(),
 		"transposition", part.Transposition,
 		"reference-pitch", part.ReferencePitch,
 		"current-offset", part.CurrentOffset,
@@ -161,6 +163,7 @@ func (score *Score) NewPart(name string) (*Part, error) {
 		},
 		TimeScale:      1.0,
 		KeySignature:   KeySignature{},
+		TimeSignature:  DefaultTimeSignature,
 		Transposition:  0,
 		ReferencePitch: 440.0,
 		voices:         NewVoices(),
@@ -203,3 +203,23 @@ func (mnn MidiNoteNumber) CalculateMidiNote(
 ) int32 {
 	return mnn.MidiNote + transposition
 }
+
+// The names of the pitch classes, counting from C, as they're written in
+// MidiNoteName
+var pitchClassNames = []string{
+	"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B",
+}
+
+// MidiNoteName returns the name of a MIDI note number in scientific pitch
+// notation, e.g. "C4" for 60 (middle C) or "F#5" for 78. Black keys are named
+// as sharps.
+func MidiNoteName(midiNote int32) string {
+	octave := midiNote/12 - 1
+	pitchClass := midiNote % 12
+	if pitchClass < 0 {
+		octave--
+		pitchClass += 12
+	}
+
+	return fmt.Sprintf("%s%d", pitchClassNames[pitchClass], octave)
+}
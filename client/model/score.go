@@ -157,6 +157,28 @@ func (score *Score) PartOffsets() map[*Part]float64 {
 	return offsets
 }
 
+// DurationMs returns the length of the score in milliseconds, i.e. the latest
+// point at which one of its parts ends (including rests at the end of a part)
+// or one of its notes stops sounding.
+func (score *Score) DurationMs() float64 {
+	duration := 0.0
+
+	for _, offset := range score.PartOffsets() {
+		if offset > duration {
+			duration = offset
+		}
+	}
+
+	for _, event := range score.Events {
+		note, ok := event.(NoteEvent)
+		if ok && note.Offset+note.Duration > duration {
+			duration = note.Offset + note.Duration
+		}
+	}
+
+	return duration
+}
+
 // InterpretOffsetReference interprets a string as a specific offset in the
 // score in milliseconds.
 //
@@ -11,6 +11,8 @@ type AldaSourceContext struct {
 	Filename string
 	Line     int
 	Column   int
+	// Offset is the byte offset from the beginning of the source.
+	Offset int
 }
 
 // HasSourceContext is an interface implemented by types that can be linked to a
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"fmt"
+
+	"alda.io/client/json"
+)
+
+// A TimeSignature is the meter of a part, e.g. 3/4 is three quarter notes per
+// measure.
+//
+// The time signature has no effect on how a score sounds. Alda doesn't enforce
+// that barlines occur at the end of each measure, for example. It's recorded so
+// that the score can be interpreted in terms of measures.
+type TimeSignature struct {
+	Numerator   int32
+	Denominator int32
+}
+
+// DefaultTimeSignature is the time signature of a part that doesn't specify
+// one, i.e. 4/4.
+var DefaultTimeSignature = TimeSignature{Numerator: 4, Denominator: 4}
+
+// JSON implements RepresentableAsJSON.JSON.
+func (ts TimeSignature) JSON() *json.Container {
+	return json.Array(ts.Numerator, ts.Denominator)
+}
+
+func (ts TimeSignature) String() string {
+	return fmt.Sprintf("%d/%d", ts.Numerator, ts.Denominator)
+}
+
+// MeasureBeats returns the number of beats (i.e. quarter notes) in a measure,
+// e.g. 3 in 3/4 and 3.5 in 7/8.
+func (ts TimeSignature) MeasureBeats() float64 {
+	return float64(ts.Numerator) * 4 / float64(ts.Denominator)
+}
+
+// Validate returns an error if the time signature doesn't make sense, i.e. the
+// numerator isn't positive, or the denominator isn't a positive power of 2.
+func (ts TimeSignature) Validate() error {
+	if ts.Numerator < 1 {
+		return fmt.Errorf(
+			"invalid time signature %s: the numerator must be positive", ts,
+		)
+	}
+
+	if ts.Denominator < 1 || ts.Denominator&(ts.Denominator-1) != 0 {
+		return fmt.Errorf(
+			"invalid time signature %s: the denominator must be a power of 2", ts,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"fmt"
+
+	"alda.io/client/json"
+	"github.com/mohae/deepcopy"
+)
+
+// A TupletRatio is the ratio of a tuplet, e.g. 3:2 (a triplet) means three
+// notes in the time of two.
+type TupletRatio struct {
+	// ActualNotes is the number of notes that are played, e.g. 3 in a triplet.
+	ActualNotes int32
+	// NormalNotes is the number of notes in whose time they're played, e.g. 2
+	// in a triplet.
+	NormalNotes int32
+}
+
+// JSON implements RepresentableAsJSON.JSON.
+func (ratio TupletRatio) JSON() *json.Container {
+	return json.Array(ratio.ActualNotes, ratio.NormalNotes)
+}
+
+func (ratio TupletRatio) String() string {
+	return fmt.Sprintf("%d:%d", ratio.ActualNotes, ratio.NormalNotes)
+}
+
+// Validate returns an error if the tuplet ratio doesn't make sense, i.e. either
+// number isn't positive.
+func (ratio TupletRatio) Validate() error {
+	if ratio.ActualNotes < 1 || ratio.NormalNotes < 1 {
+		return fmt.Errorf(
+			"invalid tuplet ratio %s: both numbers must be positive", ratio,
+		)
+	}
+
+	return nil
+}
+
+// scale returns the factor by which the durations of the events in a tuplet
+// are multiplied, e.g. 2/3 for a triplet.
+func (ratio TupletRatio) scale() float64 {
+	return float64(ratio.NormalNotes) / float64(ratio.ActualNotes)
+}
+
+// A Tuplet plays its events in a fixed ratio of their written durations, e.g.
+// the events of a 3:2 tuplet (a triplet) take 2/3 as long as they would
+// otherwise.
+//
+// Unlike a Cram expression, which fits its events into a given duration, the
+// total duration of a tuplet depends on the written durations of its events.
+// Also unlike a Cram expression, the events affect the part's default duration
+// as they would outside of the tuplet.
+type Tuplet struct {
+	SourceContext AldaSourceContext
+	Events        []ScoreUpdate
+	Ratio         TupletRatio
+}
+
+// GetSourceContext implements HasSourceContext.GetSourceContext.
+func (tuplet Tuplet) GetSourceContext() AldaSourceContext {
+	return tuplet.SourceContext
+}
+
+// JSON implements RepresentableAsJSON.JSON.
+func (tuplet Tuplet) JSON() *json.Container {
+	events := json.Array()
+	for _, event := range tuplet.Events {
+		events.ArrayAppend(event.JSON())
+	}
+
+	return json.Object(
+		"type", "tuplet",
+		"value", json.Object("events", events, "ratio", tuplet.Ratio.JSON()),
+	)
+}
+
+// UpdateScore implements ScoreUpdate.UpdateScore by scaling each current part's
+// TimeScale value by the tuplet ratio, using the events within the tuplet to
+// update the score, and then restoring the previous TimeScale values.
+func (tuplet Tuplet) UpdateScore(score *Score) error {
+	if err := tuplet.Ratio.Validate(); err != nil {
+		return &AldaSourceError{Context: tuplet.SourceContext, Err: err}
+	}
+
+	previousTimeScales := map[*Part]float64{}
+	for _, part := range score.CurrentParts {
+		previousTimeScales[part] = part.TimeScale
+		part.TimeScale *= tuplet.Ratio.scale()
+	}
+
+	if err := score.Update(tuplet.Events...); err != nil {
+		return err
+	}
+
+	for part, timeScale := range previousTimeScales {
+		part.TimeScale = timeScale
+	}
+
+	return nil
+}
+
+// DurationMs implements ScoreUpdate.DurationMs by returning the total duration
+// of the events in the tuplet, scaled by the tuplet ratio.
+func (tuplet Tuplet) DurationMs(part *Part) float64 {
+	durationMs := 0.0
+
+	for _, event := range tuplet.Events {
+		durationMs += event.DurationMs(part)
+	}
+
+	return durationMs * tuplet.Ratio.scale()
+}
+
+// VariableValue implements ScoreUpdate.VariableValue by returning a version of
+// the tuplet where each event is the captured value of that event.
+func (tuplet Tuplet) VariableValue(score *Score) (ScoreUpdate, error) {
+	result := deepcopy.Copy(tuplet).(Tuplet)
+	result.Events = []ScoreUpdate{}
+
+	for _, event := range tuplet.Events {
+		eventValue, err := event.VariableValue(score)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Events = append(result.Events, eventValue)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+// tupletNote returns a note with the given note length, or the part's default
+// duration if the denominator is 0.
+func tupletNote(letter NoteLetter, denominator float64) Note {
+	note := Note{Pitch: LetterAndAccidentals{NoteLetter: letter}}
+
+	if denominator != 0 {
+		note.Duration = Duration{
+			Components: []DurationComponent{NoteLength{Denominator: denominator}},
+		}
+	}
+
+	return note
+}
+
+func triplet(events ...ScoreUpdate) Tuplet {
+	return Tuplet{
+		Events: events,
+		Ratio:  TupletRatio{ActualNotes: 3, NormalNotes: 2},
+	}
+}
+
+func TestTuplet(t *testing.T) {
+	executeScoreUpdateTestCases(
+		t,
+		scoreUpdateTestCase{
+			label: "triplet of (implicit) quarter notes",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				// A quarter note at 120 BPM = 500 ms
+				triplet(tupletNote(C, 0), tupletNote(D, 0), tupletNote(E, 0)),
+			},
+			expectations: []scoreUpdateExpectation{
+				expectNoteOffsets(0, 1000/3.0, (1000/3.0)*2),
+				expectNoteDurations(1000/3.0, 1000/3.0, 1000/3.0),
+				expectPartCurrentOffset("piano", 1000),
+			},
+		},
+		scoreUpdateTestCase{
+			label: "quintuplet of explicit sixteenth notes",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				Tuplet{
+					Events: []ScoreUpdate{
+						tupletNote(C, 16), tupletNote(D, 0), tupletNote(E, 0),
+						tupletNote(F, 0), tupletNote(G, 0),
+					},
+					Ratio: TupletRatio{ActualNotes: 5, NormalNotes: 4},
+				},
+				// The note length carries over, but the ratio doesn't.
+				tupletNote(A, 0),
+			},
+			expectations: []scoreUpdateExpectation{
+				expectNoteOffsets(0, 100, 200, 300, 400, 500),
+				expectNoteDurations(100, 100, 100, 100, 100, 125),
+				expectPartCurrentOffset("piano", 625),
+				expectPartDurationBeats("piano", 0.25),
+			},
+		},
+		scoreUpdateTestCase{
+			label: "nested triplets",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				triplet(
+					tupletNote(C, 0),
+					tupletNote(D, 0),
+					triplet(tupletNote(E, 0), tupletNote(F, 0), tupletNote(G, 0)),
+				),
+			},
+			expectations: []scoreUpdateExpectation{
+				expectNoteOffsets(
+					0, 1000/3.0, 2000/3.0, 2000/3.0+2000/9.0, 2000/3.0+4000/9.0,
+				),
+				expectPartCurrentOffset("piano", 4000/3.0),
+			},
+		},
+		scoreUpdateTestCase{
+			label: "triplet within a cram expression",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				Cram{
+					Events: []ScoreUpdate{
+						// The triplet lasts 2 beats and the F lasts 1, so the events of
+						// the cram are scaled by 2/3.
+						triplet(tupletNote(C, 0), tupletNote(D, 0), tupletNote(E, 0)),
+						tupletNote(F, 0),
+					},
+					Duration: Duration{
+						Components: []DurationComponent{NoteLength{Denominator: 2}},
+					},
+				},
+			},
+			expectations: []scoreUpdateExpectation{
+				expectNoteOffsets(0, 2000/9.0, 4000/9.0, 2000/3.0),
+				expectPartCurrentOffset("piano", 1000),
+			},
+		},
+		scoreUpdateTestCase{
+			label: "invalid tuplet ratio",
+			updates: []ScoreUpdate{
+				PartDeclaration{Names: []string{"piano"}},
+				Tuplet{
+					Events: []ScoreUpdate{tupletNote(C, 0)},
+					Ratio:  TupletRatio{ActualNotes: 0, NormalNotes: 2},
+				},
+			},
+			errorExpectations: []scoreUpdateErrorExpectation{
+				func(err error) error {
+					expected := "invalid tuplet ratio 0:2: both numbers must be positive"
+					if !strings.Contains(err.Error(), expected) {
+						return err
+					}
+					return nil
+				},
+			},
+		},
+	)
+}
@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"fmt"
+
+	"alda.io/client/model"
+)
+
+// CheckAliases returns an error if two part declarations in the AST declare
+// the same alias, e.g. `piano "p1":` twice, which is almost certainly a
+// mistake: the score fails to play, because an alias can't be redefined.
+//
+// The error is reported at the second declaration, and its message includes
+// the position of the first one. The formatter doesn't check aliases, so this
+// can be used to surface the problem separately.
+func CheckAliases(root ASTNode) error {
+	declared := map[string]ASTNode{}
+
+	for _, part := range root.Children {
+		if part.Type != PartNode || len(part.Children) == 0 {
+			continue
+		}
+
+		decl := part.Children[0]
+		if len(decl.Children) < 2 || decl.Children[1].Type != PartAliasNode {
+			continue
+		}
+
+		aliasNode := decl.Children[1]
+		alias, ok := aliasNode.Literal.(string)
+		if !ok {
+			continue
+		}
+
+		first, ok := declared[alias]
+		if !ok {
+			declared[alias] = aliasNode
+			continue
+		}
+
+		return &model.AldaSourceError{
+			Context: aliasNode.SourceContext,
+			Err: fmt.Errorf(
+				"duplicate alias \"%s\", first declared at line %d, column %d",
+				alias, first.SourceContext.Line, first.SourceContext.Column,
+			),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"io"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestCheckAliases(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected string
+	}{
+		{
+			label: "distinct aliases",
+			given: "piano \"rh\": c\npiano \"lh\": d\nrh: e\nviolin/viola \"vv\": f",
+		},
+		{
+			label: "duplicate aliases",
+			given: "piano \"rh\": c\nviolin: d\npiano \"rh\": e",
+			expected: "piece.alda:3:7 duplicate alias \"rh\", first declared at " +
+				"line 1, column 7",
+		},
+		{
+			label: "duplicate alias for a different group",
+			given: "violin/viola \"strings\": c\ncello \"strings\": d",
+			expected: "piece.alda:2:7 duplicate alias \"strings\", first declared " +
+				"at line 1, column 14",
+		},
+	} {
+		ast, err := Parse("piece.alda", testCase.given)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+
+		err = CheckAliases(ast)
+
+		if testCase.expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", testCase.label, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.label)
+		} else if actual := err.Error(); actual != testCase.expected {
+			t.Errorf(
+				"%s\nexpected error: %s\nactual error: %s",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+
+		// The duplicates don't stop the AST from being formatted.
+		if err := FormatASTToCode(ast, io.Discard); err != nil {
+			t.Errorf("%s: %v", testCase.label, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package parser
+
+// arenaChunkSize is the number of nodes in each chunk that a nodeArena
+// allocates.
+const arenaChunkSize = 4096
+
+// A nodeArena stores the children of the nodes that the parser produces in
+// large, shared chunks, rather than in a backing array of their own for each
+// node, which would otherwise be most of the allocations made while parsing a
+// large score.
+//
+// The children are ordinary slices, so an ASTNode is the same whether or not
+// its children are stored in an arena. Each slice's capacity is its length, so
+// appending to the children of a node reallocates them, rather than
+// overwriting the nodes stored after them. On the other hand, as long as any
+// node in a chunk is reachable, the whole chunk is kept in memory.
+type nodeArena struct {
+	// The unused part of the current chunk
+	chunk []ASTNode
+}
+
+// children returns a copy of the nodes, stored in the arena. It's empty rather
+// than nil if there are no nodes.
+func (a *nodeArena) children(nodes ...ASTNode) []ASTNode {
+	n := len(nodes)
+	if n == 0 {
+		return []ASTNode{}
+	}
+
+	// A long list of nodes, e.g. the events of a part, gets a backing array of
+	// its own, so that it doesn't waste the rest of a chunk.
+	if n > arenaChunkSize/8 {
+		return append(make([]ASTNode, 0, n), nodes...)
+	}
+
+	if n > len(a.chunk) {
+		a.chunk = make([]ASTNode, arenaChunkSize)
+	}
+
+	children := a.chunk[:n:n]
+	copy(children, nodes)
+	a.chunk = a.chunk[n:]
+
+	return children
+}
+
+// A nodeList collects nodes on the parser's stack of nodes (see
+// parser.stack), until they're stored as the children of a node (see
+// nodeList.children), which saves growing a slice of its own for them.
+//
+// Lists are nested like the nodes being parsed: a list that's started while
+// another is being collected must be finished before anything else is added
+// to the outer list. If it isn't, e.g. because parsing fails along the way, the
+// nodes that it leaves on the stack are overwritten when the outer list is
+// added to.
+type nodeList struct {
+	p *parser
+	// The index of the first node in the stack, and the number of nodes
+	start, len int
+}
+
+// newNodeList returns an empty list at the top of the stack.
+func (p *parser) newNodeList() nodeList {
+	return nodeList{p: p, start: len(p.stack)}
+}
+
+// add adds nodes to the end of the list.
+func (l *nodeList) add(nodes ...ASTNode) {
+	l.p.stack = append(l.p.stack[:l.start+l.len], nodes...)
+	l.len += len(nodes)
+}
+
+// nodes returns the nodes in the list. The slice is only valid until nodes are
+// added to this or any other list.
+func (l *nodeList) nodes() []ASTNode {
+	return l.p.stack[l.start : l.start+l.len]
+}
+
+// children stores the nodes in the parser's arena and removes them from the
+// stack, leaving the list empty.
+func (l *nodeList) children() []ASTNode {
+	children := l.p.arena.children(l.nodes()...)
+	l.pop()
+	return children
+}
+
+// pop removes the nodes from the stack, leaving the list empty.
+func (l *nodeList) pop() {
+	l.p.stack = l.p.stack[:l.start]
+	l.len = 0
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+// The children of the nodes that the parser produces are stored next to each
+// other, so appending to the children of one node mustn't overwrite those of
+// the next.
+func TestArenaChildrenAppend(t *testing.T) {
+	ast, err := Parse("", "piano: c4 d8 e2", SuppressSourceContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ast.Clone()
+
+	events := ast.Children[0].Children[1].Children
+	for i := range events {
+		events[i].Children = append(events[i].Children, ASTNode{Type: TieNode})
+		events[i].Children = events[i].Children[:len(events[i].Children)-1]
+	}
+
+	if diffs := Diff(expected, ast); len(diffs) > 0 {
+		t.Errorf("appending children changed the AST: %v", diffs)
+	}
+}
+
+func TestArenaChildrenLengths(t *testing.T) {
+	arena := nodeArena{}
+
+	for _, n := range []int{0, 1, 3, arenaChunkSize / 8, arenaChunkSize} {
+		nodes := make([]ASTNode, n)
+		for i := range nodes {
+			nodes[i] = ASTNode{Type: NoteNode, Literal: int32(i)}
+		}
+
+		children := arena.children(nodes...)
+		if children == nil || len(children) != n || cap(children) != n {
+			t.Errorf(
+				"%d nodes: got len %d, cap %d, nil %v",
+				n, len(children), cap(children), children == nil,
+			)
+			continue
+		}
+
+		for i := range children {
+			if children[i].Literal != int32(i) {
+				t.Errorf("%d nodes: node %d has literal %v", n, i, children[i].Literal)
+				break
+			}
+		}
+	}
+}
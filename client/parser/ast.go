@@ -2,6 +2,7 @@ package parser
 
 import (
 	"bytes"
+	encjson "encoding/json"
 	"fmt"
 	"strings"
 
@@ -21,17 +22,24 @@ const (
 	DenominatorNode
 	DotsNode
 	DurationNode
+	DynamicNode
+	ErrorNode
 	EventSequenceNode
 	FirstRepetitionNode
 	FlatNode
+	GlissandoNode
 	ImplicitPartNode
 	LastRepetitionNode
+	LispKeywordNode
 	LispListNode
+	LispMapNode
 	LispNumberNode
 	LispQuotedFormNode
 	LispStringNode
 	LispSymbolNode
+	LispVectorNode
 	MarkerNode
+	MultiMeasureRestNode
 	NaturalNode
 	NoteAccidentalsNode
 	NoteLengthMsNode
@@ -56,7 +64,13 @@ const (
 	RootNode
 	SharpNode
 	TieNode
+	TimeSignatureDenominatorNode
+	TimeSignatureNode
+	TimeSignatureNumeratorNode
 	TimesNode
+	TupletActualNotesNode
+	TupletNode
+	TupletNormalNotesNode
 	VariableDefinitionNode
 	VariableNameNode
 	VariableReferenceNode
@@ -64,6 +78,10 @@ const (
 	VoiceGroupEndMarkerNode
 	VoiceGroupNode
 	VoiceNumberNode
+
+	// numASTNodeTypes is the number of AST node types defined above. It must
+	// remain the final entry in this list.
+	numASTNodeTypes
 )
 
 type ASTNode struct {
@@ -71,6 +89,11 @@ type ASTNode struct {
 	Literal       interface{}
 	Children      []ASTNode
 	SourceContext model.AldaSourceContext
+	// SourceText is the original spelling of the literal in the source code
+	// (e.g. "0.50" for a float64 literal 0.5), when the node was produced by the
+	// parser. The formatter can re-emit it; see ConfigurePreserveLiterals.
+	// ASTEqual and Diff ignore it.
+	SourceText string
 }
 
 func (nt ASTNodeType) String() string {
@@ -89,18 +112,28 @@ func (nt ASTNodeType) String() string {
 		return "DotsNode"
 	case DurationNode:
 		return "DurationNode"
+	case DynamicNode:
+		return "DynamicNode"
+	case ErrorNode:
+		return "ErrorNode"
 	case EventSequenceNode:
 		return "EventSequenceNode"
 	case FirstRepetitionNode:
 		return "FirstRepetitionNode"
 	case FlatNode:
 		return "FlatNode"
+	case GlissandoNode:
+		return "GlissandoNode"
 	case ImplicitPartNode:
 		return "ImplicitPartNode"
 	case LastRepetitionNode:
 		return "LastRepetitionNode"
+	case LispKeywordNode:
+		return "LispKeywordNode"
 	case LispListNode:
 		return "LispListNode"
+	case LispMapNode:
+		return "LispMapNode"
 	case LispNumberNode:
 		return "LispNumberNode"
 	case LispQuotedFormNode:
@@ -109,8 +142,12 @@ func (nt ASTNodeType) String() string {
 		return "LispStringNode"
 	case LispSymbolNode:
 		return "LispSymbolNode"
+	case LispVectorNode:
+		return "LispVectorNode"
 	case MarkerNode:
 		return "MarkerNode"
+	case MultiMeasureRestNode:
+		return "MultiMeasureRestNode"
 	case NaturalNode:
 		return "NaturalNode"
 	case NoteAccidentalsNode:
@@ -159,8 +196,20 @@ func (nt ASTNodeType) String() string {
 		return "SharpNode"
 	case TieNode:
 		return "TieNode"
+	case TimeSignatureDenominatorNode:
+		return "TimeSignatureDenominatorNode"
+	case TimeSignatureNode:
+		return "TimeSignatureNode"
+	case TimeSignatureNumeratorNode:
+		return "TimeSignatureNumeratorNode"
 	case TimesNode:
 		return "TimesNode"
+	case TupletActualNotesNode:
+		return "TupletActualNotesNode"
+	case TupletNode:
+		return "TupletNode"
+	case TupletNormalNotesNode:
+		return "TupletNormalNotesNode"
 	case VariableDefinitionNode:
 		return "VariableDefinitionNode"
 	case VariableNameNode:
@@ -219,6 +268,202 @@ func (node ASTNode) JSON() *json.Container {
 	return nodeJSON
 }
 
+// astNodeTypesByName maps the names returned by ASTNodeType.String() back to
+// their respective node types. This is what allows the JSON representation of
+// an AST to be read back in.
+var astNodeTypesByName = map[string]ASTNodeType{}
+
+func init() {
+	for nt := ASTNodeType(0); nt < numASTNodeTypes; nt++ {
+		astNodeTypesByName[nt.String()] = nt
+	}
+}
+
+// ASTNodeTypeFromString returns the ASTNodeType with the provided name, e.g.
+// "NoteNode". The boolean return value is false if there is no such type.
+func ASTNodeTypeFromString(name string) (ASTNodeType, bool) {
+	nt, ok := astNodeTypesByName[name]
+	return nt, ok
+}
+
+// The Go type of a literal is recorded alongside the literal in the JSON
+// representation of an AST, because encoding/json would otherwise decode every
+// number as a float64.
+//
+// NB: rune is an alias for int32, so we can't tell the two apart by inspecting
+// the Go type of the literal. NoteLetterNode is the only node type whose
+// literal is a rune, so we treat it specially.
+const (
+	literalTypeRune    = "rune"
+	literalTypeInt32   = "int32"
+	literalTypeInt64   = "int64"
+	literalTypeFloat64 = "float64"
+	literalTypeString  = "string"
+)
+
+type astNodeSourceContextJSON struct {
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Offset   int    `json:"offset"`
+}
+
+type astNodeJSON struct {
+	Type          string                    `json:"type"`
+	Literal       encjson.RawMessage        `json:"literal,omitempty"`
+	LiteralType   string                    `json:"literal-type,omitempty"`
+	Children      *[]ASTNode                `json:"children,omitempty"`
+	SourceContext *astNodeSourceContextJSON `json:"source-context,omitempty"`
+	SourceText    string                    `json:"source-text,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+//
+// Node types are represented by name (e.g. "NoteNode") and each literal is
+// accompanied by its Go type, so that the result can be read back in via
+// UnmarshalJSON without losing information.
+func (node ASTNode) MarshalJSON() ([]byte, error) {
+	nodeJSON := astNodeJSON{
+		Type:       node.Type.String(),
+		SourceText: node.SourceText,
+	}
+
+	// We distinguish between nil and empty (but non-nil) children so that the
+	// AST is reproduced exactly when read back in.
+	if node.Children != nil {
+		nodeJSON.Children = &node.Children
+	}
+
+	if node.Literal != nil {
+		var literal interface{}
+
+		switch value := node.Literal.(type) {
+		case int32:
+			if node.Type == NoteLetterNode {
+				nodeJSON.LiteralType = literalTypeRune
+				literal = string(rune(value))
+			} else {
+				nodeJSON.LiteralType = literalTypeInt32
+				literal = value
+			}
+		case int64:
+			nodeJSON.LiteralType = literalTypeInt64
+			literal = value
+		case float64:
+			nodeJSON.LiteralType = literalTypeFloat64
+			literal = value
+		case string:
+			nodeJSON.LiteralType = literalTypeString
+			literal = value
+		default:
+			return nil, fmt.Errorf(
+				"unsupported %s literal: %#v", node.Type.String(), value,
+			)
+		}
+
+		bs, err := encjson.Marshal(literal)
+		if err != nil {
+			return nil, err
+		}
+
+		nodeJSON.Literal = bs
+	}
+
+	if node.SourceContext.Line > 0 {
+		nodeJSON.SourceContext = &astNodeSourceContextJSON{
+			Filename: node.SourceContext.Filename,
+			Line:     node.SourceContext.Line,
+			Column:   node.SourceContext.Column,
+			Offset:   node.SourceContext.Offset,
+		}
+	}
+
+	return encjson.Marshal(nodeJSON)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It reads the representation
+// produced by MarshalJSON.
+func (node *ASTNode) UnmarshalJSON(data []byte) error {
+	nodeJSON := astNodeJSON{}
+	if err := encjson.Unmarshal(data, &nodeJSON); err != nil {
+		return err
+	}
+
+	nodeType, ok := ASTNodeTypeFromString(nodeJSON.Type)
+	if !ok {
+		return fmt.Errorf("unrecognized AST node type: %q", nodeJSON.Type)
+	}
+
+	result := ASTNode{Type: nodeType, SourceText: nodeJSON.SourceText}
+
+	if nodeJSON.Children != nil {
+		result.Children = *nodeJSON.Children
+	}
+
+	if len(nodeJSON.Literal) > 0 {
+		switch nodeJSON.LiteralType {
+		case literalTypeRune:
+			var s string
+			if err := encjson.Unmarshal(nodeJSON.Literal, &s); err != nil {
+				return err
+			}
+
+			runes := []rune(s)
+			if len(runes) != 1 {
+				return fmt.Errorf("invalid %s literal: %q", nodeJSON.Type, s)
+			}
+
+			result.Literal = runes[0]
+		case literalTypeInt32:
+			var i int32
+			if err := encjson.Unmarshal(nodeJSON.Literal, &i); err != nil {
+				return err
+			}
+
+			result.Literal = i
+		case literalTypeInt64:
+			var i int64
+			if err := encjson.Unmarshal(nodeJSON.Literal, &i); err != nil {
+				return err
+			}
+
+			result.Literal = i
+		case literalTypeFloat64:
+			var f float64
+			if err := encjson.Unmarshal(nodeJSON.Literal, &f); err != nil {
+				return err
+			}
+
+			result.Literal = f
+		case literalTypeString:
+			var s string
+			if err := encjson.Unmarshal(nodeJSON.Literal, &s); err != nil {
+				return err
+			}
+
+			result.Literal = s
+		default:
+			return fmt.Errorf(
+				"unrecognized literal type for %s: %q",
+				nodeJSON.Type, nodeJSON.LiteralType,
+			)
+		}
+	}
+
+	if sc := nodeJSON.SourceContext; sc != nil {
+		result.SourceContext = model.AldaSourceContext{
+			Filename: sc.Filename,
+			Line:     sc.Line,
+			Column:   sc.Column,
+			Offset:   sc.Offset,
+		}
+	}
+
+	*node = result
+
+	return nil
+}
+
 // HumanReadableAST returns a human-readable textual representation of an AST.
 // It operates on the JSON output of ASTNode.JSON().
 //
@@ -273,9 +518,72 @@ func HumanReadableAST(ast *json.Container) string {
 	return strings.TrimRight(buffer.String(), "\n")
 }
 
+// maxDescribedLiteralLength is the length beyond which literals are truncated
+// when describing a node in an error message.
+const maxDescribedLiteralLength = 20
+
+// describe returns a short, human-readable description of a node for use in
+// error messages, e.g. `PartNameNode "piano"` or `NoteNode (2 children)`.
+//
+// Unlike a `%#v` dump, the description is bounded in length no matter how large
+// the node is.
+func (node ASTNode) describe() string {
+	description := node.Type.String()
+
+	if node.Literal != nil {
+		var literal string
+		switch value := node.Literal.(type) {
+		case int32:
+			if node.Type == NoteLetterNode {
+				literal = fmt.Sprintf("%q", value)
+			} else {
+				literal = fmt.Sprintf("%d", value)
+			}
+		case string:
+			runes := []rune(value)
+			if len(runes) > maxDescribedLiteralLength {
+				value = string(runes[:maxDescribedLiteralLength]) + "..."
+			}
+			literal = fmt.Sprintf("%q", value)
+		default:
+			literal = fmt.Sprintf("%v", value)
+		}
+
+		description += " " + literal
+	}
+
+	switch len(node.Children) {
+	case 0:
+	case 1:
+		description += " (1 child)"
+	default:
+		description += fmt.Sprintf(" (%d children)", len(node.Children))
+	}
+
+	return description
+}
+
+// errorf returns an error with the provided message, annotated with the source
+// context of the node, if it has one.
+func (node ASTNode) errorf(format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+
+	if node.SourceContext.Line == 0 {
+		return err
+	}
+
+	return &model.AldaSourceError{Context: node.SourceContext, Err: err}
+}
+
+// errUnexpectedNode returns an error about a node that is not expected in the
+// given context, e.g. "while formatting a chord".
+func (node ASTNode) errUnexpectedNode(context string) error {
+	return node.errorf("unexpected %s %s", node.describe(), context)
+}
+
 func (node ASTNode) expectChildren() error {
 	if len(node.Children) == 0 {
-		return fmt.Errorf("%s has no children", node.Type.String())
+		return node.errorf("expected %s to have children", node.Type.String())
 	}
 
 	return nil
@@ -290,20 +598,32 @@ func (node ASTNode) expectNChildren(expectedChildren ...int) error {
 		}
 	}
 
-	return fmt.Errorf(
-		"expected %s to have %v children, but it has %d",
+	expectedStrs := []string{}
+	for _, expected := range expectedChildren {
+		expectedStrs = append(expectedStrs, fmt.Sprintf("%d", expected))
+	}
+
+	var expectedText string
+	switch len(expectedStrs) {
+	case 1:
+		expectedText = expectedStrs[0]
+	default:
+		expectedText = strings.Join(expectedStrs[:len(expectedStrs)-1], ", ") +
+			" or " + expectedStrs[len(expectedStrs)-1]
+	}
+
+	return node.errorf(
+		"expected %s to have %s children, but it has %d",
 		node.Type.String(),
-		expectedChildren,
+		expectedText,
 		actualChildren,
 	)
 }
 
 func (node ASTNode) expectNodeType(expectedType ASTNodeType) (ASTNode, error) {
 	if node.Type != expectedType {
-		return ASTNode{}, fmt.Errorf(
-			"expected %s node, but got %s node",
-			expectedType.String(),
-			node.Type.String(),
+		return ASTNode{}, node.errorf(
+			"expected %s but got %s", expectedType.String(), node.describe(),
 		)
 	}
 
@@ -367,6 +687,62 @@ func duration(node ASTNode) (model.Duration, error) {
 	return duration, nil
 }
 
+// timeSignature returns the time signature of a TimeSignatureNode, or an error
+// if it isn't a valid time signature.
+func timeSignature(node ASTNode) (model.TimeSignature, error) {
+	if err := node.expectNChildren(2); err != nil {
+		return model.TimeSignature{}, err
+	}
+
+	numerator, err := node.Children[0].expectNodeType(TimeSignatureNumeratorNode)
+	if err != nil {
+		return model.TimeSignature{}, err
+	}
+
+	denominator, err := node.Children[1].expectNodeType(
+		TimeSignatureDenominatorNode,
+	)
+	if err != nil {
+		return model.TimeSignature{}, err
+	}
+
+	timeSig := model.TimeSignature{
+		Numerator:   numerator.Literal.(int32),
+		Denominator: denominator.Literal.(int32),
+	}
+
+	if err := timeSig.Validate(); err != nil {
+		return model.TimeSignature{}, node.errorf("%s", err)
+	}
+
+	return timeSig, nil
+}
+
+// tupletRatio returns the ratio of a TupletNode, or an error if it isn't a
+// valid tuplet ratio.
+func tupletRatio(node ASTNode) (model.TupletRatio, error) {
+	actualNotes, err := node.Children[1].expectNodeType(TupletActualNotesNode)
+	if err != nil {
+		return model.TupletRatio{}, err
+	}
+
+	normalNotes, err := node.Children[2].expectNodeType(TupletNormalNotesNode)
+	if err != nil {
+		return model.TupletRatio{}, err
+	}
+
+	ratio := model.TupletRatio{
+		ActualNotes: actualNotes.Literal.(int32),
+		NormalNotes: normalNotes.Literal.(int32),
+	}
+
+	if err := ratio.Validate(); err != nil {
+		return model.TupletRatio{}, node.errorf("%s", err)
+	}
+
+	return ratio, nil
+}
+
 func (node ASTNode) Updates() ([]model.ScoreUpdate, error) {
 	concatChildUpdates := func(node ASTNode) ([]model.ScoreUpdate, error) {
 		updates := []model.ScoreUpdate{}
@@ -450,6 +826,18 @@ func (node ASTNode) Updates() ([]model.ScoreUpdate, error) {
 
 		return []model.ScoreUpdate{cram}, nil
 
+	case DynamicNode:
+		return []model.ScoreUpdate{
+			model.AttributeUpdate{
+				SourceContext: node.SourceContext,
+				PartUpdate:    model.DynamicMarking{Marking: node.Literal.(string)},
+			},
+		}, nil
+
+	case ErrorNode:
+		// Input that couldn't be parsed (see Parse) has no meaning.
+		return nil, node.errorf("syntax error: %v", node.Literal)
+
 	case EventSequenceNode:
 		updates, err := concatChildUpdates(node)
 		if err != nil {
@@ -463,6 +851,23 @@ func (node ASTNode) Updates() ([]model.ScoreUpdate, error) {
 			},
 		}, nil
 
+	case GlissandoNode:
+		if err := node.expectChildren(); err != nil {
+			return nil, err
+		}
+
+		updates, err := concatChildUpdates(node)
+		if err != nil {
+			return nil, err
+		}
+
+		return []model.ScoreUpdate{
+			model.Glissando{
+				SourceContext: node.SourceContext,
+				Events:        updates,
+			},
+		}, nil
+
 	case ImplicitPartNode:
 		if err := node.expectNChildren(1); err != nil {
 			return nil, err
@@ -476,14 +881,33 @@ func (node ASTNode) Updates() ([]model.ScoreUpdate, error) {
 		return concatChildUpdates(events)
 
 	case LispListNode:
-		var lispForm func(ASTNode) (model.LispForm, error)
-		lispForm = func(node ASTNode) (model.LispForm, error) {
+		// NB: quoted is true within a quoted form, where vectors are data rather
+		// than expressions that evaluate to lists.
+		var lispForm func(ASTNode, bool) (model.LispForm, error)
+		lispForm = func(node ASTNode, quoted bool) (model.LispForm, error) {
 			switch node.Type {
-			case LispListNode:
+			case LispKeywordNode:
+				// alda-lisp has no keywords, so we represent a keyword as a symbol
+				// whose name includes the colon, which is what it used to parse as.
+				return model.LispSymbol{
+					SourceContext: node.SourceContext,
+					Name:          ":" + node.Literal.(string),
+				}, nil
+
+			case LispListNode, LispVectorNode:
 				list := model.LispList{SourceContext: node.SourceContext}
 
+				// alda-lisp has no vectors either. An unquoted vector evaluates to a
+				// list of its evaluated elements, i.e. `[a b]` is `(list a b)`.
+				if node.Type == LispVectorNode && !quoted {
+					list.Elements = append(list.Elements, model.LispSymbol{
+						SourceContext: node.SourceContext,
+						Name:          "list",
+					})
+				}
+
 				for _, child := range node.Children {
-					form, err := lispForm(child)
+					form, err := lispForm(child, quoted)
 					if err != nil {
 						return nil, err
 					}
@@ -504,7 +928,7 @@ func (node ASTNode) Updates() ([]model.ScoreUpdate, error) {
 					return nil, err
 				}
 
-				form, err := lispForm(node.Children[0])
+				form, err := lispForm(node.Children[0], true)
 				if err != nil {
 					return nil, err
 				}
@@ -527,12 +951,14 @@ func (node ASTNode) Updates() ([]model.ScoreUpdate, error) {
 				}, nil
 			}
 
+			// NB: This includes maps, which alda-lisp can't represent. They can be
+			// parsed and formatted, but not evaluated.
 			return nil, fmt.Errorf(
 				"unexpected %s node inside of Lisp form", node.Type.String(),
 			)
 		}
 
-		list, err := lispForm(node)
+		list, err := lispForm(node, false)
 		if err != nil {
 			return nil, err
 		}
@@ -547,6 +973,14 @@ func (node ASTNode) Updates() ([]model.ScoreUpdate, error) {
 			},
 		}, nil
 
+	case MultiMeasureRestNode:
+		return []model.ScoreUpdate{
+			model.MultiMeasureRest{
+				SourceContext: node.SourceContext,
+				Measures:      node.Literal.(int32),
+			},
+		}, nil
+
 	case NoteNode:
 		if err := node.expectChildren(); err != nil {
 			return nil, err
@@ -819,6 +1253,47 @@ func (node ASTNode) Updates() ([]model.ScoreUpdate, error) {
 	case RootNode:
 		return concatChildUpdates(node)
 
+	case TimeSignatureNode:
+		timeSig, err := timeSignature(node)
+		if err != nil {
+			return nil, err
+		}
+
+		return []model.ScoreUpdate{
+			model.AttributeUpdate{
+				SourceContext: node.SourceContext,
+				PartUpdate:    model.TimeSignatureSet{TimeSignature: timeSig},
+			},
+		}, nil
+
+	case TupletNode:
+		if err := node.expectNChildren(3); err != nil {
+			return nil, err
+		}
+
+		eventsNode, err := node.Children[0].expectNodeType(EventSequenceNode)
+		if err != nil {
+			return nil, err
+		}
+
+		events, err := concatChildUpdates(eventsNode)
+		if err != nil {
+			return nil, err
+		}
+
+		ratio, err := tupletRatio(node)
+		if err != nil {
+			return nil, err
+		}
+
+		return []model.ScoreUpdate{
+			model.Tuplet{
+				SourceContext: node.SourceContext,
+				Events:        events,
+				Ratio:         ratio,
+			},
+		}, nil
+
 	case VariableDefinitionNode:
 		if err := node.expectNChildren(2); err != nil {
 			return nil, err
@@ -0,0 +1,149 @@
+package parser
+
+import "strings"
+
+// maxBarlinePadding is the most padding that alignBarlines adds to a measure
+// in order to align the barline after it with the barlines above and below.
+// A column of barlines that would need more padding than this is left as it
+// is, as are the columns after it, so that one long measure doesn't spread out
+// the lines around it.
+const maxBarlinePadding = 16
+
+// alignBarlines pads the measures of consecutive lines of formatted output so
+// that their barlines line up in columns (see ConfigureBarlineAlignment).
+//
+// Lines are aligned with each other if they're consecutive, have the same
+// indentation and have barlines. The nth barlines of the lines are aligned by
+// padding the measures before them to the length of the longest, from left to
+// right, stopping at the first column that can't be aligned: i.e. one that
+// would need more than maxBarlinePadding, or would make a line longer than the
+// soft wrap length, or where a line has no measure before the barline to pad.
+//
+// Lines with strings or comments are left as they are, as a `|` within them
+// isn't a barline.
+func alignBarlines(output string, separator string, softWrapLen int) string {
+	lines := strings.Split(output, "\n")
+
+	for start := 0; start < len(lines); {
+		indent, ok := barlineIndent(lines[start], separator)
+		if !ok {
+			start++
+			continue
+		}
+
+		end := start + 1
+		for end < len(lines) {
+			if lineIndent, ok := barlineIndent(lines[end], separator); !ok ||
+				lineIndent != indent {
+				break
+			}
+			end++
+		}
+
+		alignBarlineColumns(lines[start:end], indent, separator, softWrapLen)
+		start = end
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// barlineIndent returns the indentation of a line, and whether its barlines
+// can be aligned.
+func barlineIndent(line string, separator string) (string, bool) {
+	if strings.ContainsAny(line, "\"#") {
+		return "", false
+	}
+
+	content := strings.TrimLeft(line, " \t")
+	for _, token := range strings.Split(content, separator) {
+		if token == "|" {
+			return line[:len(line)-len(content)], true
+		}
+	}
+
+	return "", false
+}
+
+// alignBarlineColumns aligns the barlines of lines with the same indentation,
+// modifying the lines in place.
+func alignBarlineColumns(
+	lines []string, indent string, separator string, softWrapLen int,
+) {
+	if len(lines) < 2 {
+		return
+	}
+
+	// The tokens of each line, split into the measures between its barlines
+	measures := make([][][]string, len(lines))
+	lengths := make([]int, len(lines))
+
+	for i, line := range lines {
+		measure := []string{}
+		for _, token := range strings.Split(line[len(indent):], separator) {
+			if token == "|" {
+				measures[i] = append(measures[i], measure)
+				measure = []string{}
+				continue
+			}
+			measure = append(measure, token)
+		}
+		measures[i] = append(measures[i], measure)
+		lengths[i] = len(line)
+	}
+
+	for column := 0; ; column++ {
+		// The lines with a barline after the measure in this column
+		aligned := []int{}
+		width := 0
+
+		for i := range lines {
+			if column+1 >= len(measures[i]) {
+				continue
+			}
+
+			measure := measures[i][column]
+			if len(measure) == 0 {
+				return
+			}
+
+			aligned = append(aligned, i)
+			if length := len(strings.Join(measure, separator)); length > width {
+				width = length
+			}
+		}
+
+		if len(aligned) < 2 {
+			break
+		}
+
+		for _, i := range aligned {
+			padding := width - len(strings.Join(measures[i][column], separator))
+			if padding > maxBarlinePadding || lengths[i]+padding > softWrapLen {
+				return
+			}
+		}
+
+		for _, i := range aligned {
+			measure := measures[i][column]
+			padding := width - len(strings.Join(measure, separator))
+			measure[len(measure)-1] += strings.Repeat(" ", padding)
+			lengths[i] += padding
+		}
+
+		for i := range lines {
+			lines[i] = indent + joinMeasures(measures[i], separator)
+		}
+	}
+}
+
+func joinMeasures(measures [][]string, separator string) string {
+	tokens := []string{}
+	for i, measure := range measures {
+		if i > 0 {
+			tokens = append(tokens, "|")
+		}
+		tokens = append(tokens, measure...)
+	}
+
+	return strings.Join(tokens, separator)
+}
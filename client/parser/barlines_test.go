@@ -53,3 +53,63 @@ func TestBarlines(t *testing.T) {
 	)
 
 }
+
+func TestFormatBarlineAlignment(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label: "three measures",
+			given: "riff = c4 d e f | g2 a | b1\nbass = c2 c | d4 d d d | e1\n" +
+				"lead = c1 | d8 e f g a b > c d | e2 e\npiano: riff bass lead",
+			opts: []formatterOption{ConfigureBarlineAlignment(true)},
+			expected: "riff = c4 d e f | g2 a               | b1\n" +
+				"bass = c2 c     | d4 d d d           | e1\n" +
+				"lead = c1       | d8 e f g a b > c d | e2 e\n" +
+				"\npiano:\n  riff bass lead\n",
+		},
+		formatTestCase{
+			label: "not configured",
+			given: "riff = c4 d e f | g2 a | b1\nbass = c2 c | d4 d d d | e1",
+			expected: "riff = c4 d e f | g2 a | b1\n" +
+				"bass = c2 c | d4 d d d | e1\n",
+		},
+		formatTestCase{
+			label: "lines with different numbers of barlines",
+			given: "riff = c1 | d | e\nbass = c4 d e f | g1\nlead = c1",
+			opts:  []formatterOption{ConfigureBarlineAlignment(true)},
+			expected: "riff = c1       | d | e\n" +
+				"bass = c4 d e f | g1\n" +
+				"lead = c1\n",
+		},
+		formatTestCase{
+			label:    "lines with different indentation",
+			given:    "riff = c4 d e f | g1\npiano:\n  c1 | d1",
+			opts:     []formatterOption{ConfigureBarlineAlignment(true)},
+			expected: "riff = c4 d e f | g1\n\npiano:\n  c1 | d1\n",
+		},
+		formatTestCase{
+			label: "too much padding",
+			given: "riff = c1 | d1 | e1\n" +
+				"bass = c16 d e f g a b > c d e f g a b > c d e | f1 | g1",
+			opts: []formatterOption{ConfigureBarlineAlignment(true)},
+			expected: "riff = c1 | d1 | e1\n" +
+				"bass = c16 d e f g a b > c d e f g a b > c d e | f1 | g1\n",
+		},
+		formatTestCase{
+			label: "soft wrap length",
+			given: "riff = c1 | d1\nbass = c4 d e f | g1",
+			opts: []formatterOption{
+				ConfigureBarlineAlignment(true), ConfigureSoftWrapLen(19),
+			},
+			expected: "riff = c1 | d1\nbass = c4 d e f | g1\n",
+		},
+		formatTestCase{
+			label: "minified",
+			given: "riff = c4 d e f | g1\nbass = c1 | d1",
+			opts: []formatterOption{
+				ConfigureBarlineAlignment(true), ConfigureMinified(true),
+			},
+			expected: "riff = c4 d e f | g1\nbass = c1 | d1\n",
+		},
+	)
+}
@@ -0,0 +1,367 @@
+package parser
+
+import (
+	"math"
+	"strings"
+
+	"alda.io/client/model"
+)
+
+// beatGroupingEpsilon is the tolerance for deciding that a position falls on a
+// beat group boundary, which absorbs floating point error in e.g. triplets.
+const beatGroupingEpsilon = 1e-9
+
+// beatGrouper keeps track of where the events of each part fall within the
+// measure while the events are formatted, so that the formatter can leave extra
+// space between beat groups (see ConfigureBeatGrouping).
+//
+// The positions are worked out from the note lengths in the AST, so they're
+// only known where every duration since the last barline is a note length
+// (i.e. not in milliseconds or seconds) and every event can be timed without
+// evaluating the score, e.g. not a variable reference or a voice group. A
+// barline always starts a new measure.
+type beatGrouper struct {
+	meters *timeSignatureTracker
+	// The position and default note length of each part, keyed by its alias or
+	// names
+	parts map[string]*beatPosition
+	// The position and default note length of the current part
+	current *beatPosition
+}
+
+// A beatPosition is the position of a part's next event within the measure,
+// in beats, along with the default note length of the part.
+type beatPosition struct {
+	// The number of beats since the start of the measure, or -1 if unknown
+	beats float64
+	// The length of a note without a duration, in beats, or 0 if unknown
+	noteBeats float64
+	// Whether the start of the beat group at this position has been marked
+	marked bool
+}
+
+func newBeatGrouper() *beatGrouper {
+	grouper := &beatGrouper{
+		// The zero time signature means that no meter has been declared, in which
+		// case no groups are marked.
+		meters: &timeSignatureTracker{parts: map[string]model.TimeSignature{}},
+		parts:  map[string]*beatPosition{},
+	}
+	grouper.enterPart("")
+
+	return grouper
+}
+
+// enterPart switches to the part with the given key (see partKey), or the
+// implicit part if the key is "".
+func (g *beatGrouper) enterPart(key string) {
+	g.meters.enterPart(key)
+
+	if _, ok := g.parts[key]; !ok {
+		g.parts[key] = &beatPosition{noteBeats: 1}
+	}
+	g.current = g.parts[key]
+}
+
+// startsGroup reports whether the given event, the current part's next one,
+// starts a beat group, other than the first one in a measure. Only the first
+// event at the start of a group does, e.g. an octave change before a note.
+func (g *beatGrouper) startsGroup(node ASTNode) bool {
+	meter := g.meters.current
+	if meter.Numerator == 0 || g.current.beats <= 0 || g.current.marked ||
+		node.Type == BarlineNode {
+		return false
+	}
+
+	groupBeats := beatGroupBeats(meter)
+	groups := g.current.beats / groupBeats
+
+	if math.Abs(groups-math.Round(groups)) >= beatGroupingEpsilon {
+		return false
+	}
+
+	g.current.marked = true
+	return true
+}
+
+// beatGroupBeats returns the number of beats in a beat group, i.e. the note
+// length of the denominator, or three of them in compound meters like 6/8.
+func beatGroupBeats(meter model.TimeSignature) float64 {
+	beats := 4 / float64(meter.Denominator)
+
+	if meter.Denominator >= 8 && meter.Numerator > 3 && meter.Numerator%3 == 0 {
+		return beats * 3
+	}
+
+	return beats
+}
+
+// advance moves the current part past an event formatted at the top level of
+// the part.
+func (g *beatGrouper) advance(node ASTNode) {
+	switch node.Type {
+	case BarlineNode:
+		g.current.beats = 0
+
+	case MultiMeasureRestNode:
+		// Whole measures leave the part at the start of a measure.
+		g.current.beats = 0
+		g.current.noteBeats = g.meters.current.MeasureBeats()
+
+	case TimeSignatureNode:
+		if timeSig, err := timeSignature(node); err == nil {
+			g.meters.set(timeSig, false)
+		}
+
+	case LispListNode:
+		if timeSig, global, ok := lispTimeSignature(node); ok {
+			g.meters.set(timeSig, global)
+		}
+
+		if setsDuration(node) {
+			g.current.noteBeats = 0
+		}
+
+	case NoteNode, RestNode:
+		// A barline within the duration of a note starts a new measure partway
+		// through the note.
+		for _, child := range node.Children {
+			if child.Type == DurationNode && hasBarline(child) {
+				g.advanceTiedAcrossBarline(child)
+				return
+			}
+		}
+
+		g.advanceBy(eventBeats(node, &g.current.noteBeats))
+
+	default:
+		g.advanceBy(eventBeats(node, &g.current.noteBeats))
+	}
+}
+
+func (g *beatGrouper) advanceBy(beats float64) {
+	if beats < 0 || g.current.beats < 0 {
+		g.current.beats = -1
+		return
+	}
+
+	if beats > 0 {
+		g.current.beats += beats
+		g.current.marked = false
+	}
+}
+
+func (g *beatGrouper) advanceTiedAcrossBarline(duration ASTNode) {
+	beats := 0.0
+
+	for _, component := range duration.Children {
+		if component.Type == BarlineNode {
+			beats = 0
+			continue
+		}
+
+		componentBeats, ok := noteLengthNodeBeats(component)
+		if !ok {
+			g.current.beats = -1
+			g.current.noteBeats = 0
+			return
+		}
+
+		beats += componentBeats
+	}
+
+	g.current.beats = beats
+	g.current.noteBeats, _ = durationBeats(duration)
+}
+
+func hasBarline(duration ASTNode) bool {
+	for _, component := range duration.Children {
+		if component.Type == BarlineNode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setsDuration reports whether a Lisp list sets the default note length,
+// e.g. `(set-duration-ms 500)`.
+func setsDuration(node ASTNode) bool {
+	if len(node.Children) == 0 || node.Children[0].Type != LispSymbolNode {
+		return false
+	}
+
+	name, _ := node.Children[0].Literal.(string)
+
+	switch strings.TrimSuffix(name, "!") {
+	case "set-duration", "set-duration-ms", "set-note-length":
+		return true
+	}
+
+	return false
+}
+
+// eventBeats returns the number of beats that an event lasts, or -1 if it
+// can't be determined, and updates the default note length (in beats, or 0 if
+// unknown) as the event would.
+func eventBeats(node ASTNode, noteBeats *float64) float64 {
+	switch node.Type {
+	case NoteNode, RestNode:
+		for _, child := range node.Children {
+			if child.Type != DurationNode {
+				continue
+			}
+
+			beats, ok := durationBeats(child)
+			if !ok {
+				*noteBeats = 0
+				return -1
+			}
+
+			*noteBeats = beats
+		}
+
+		if *noteBeats == 0 {
+			return -1
+		}
+
+		return *noteBeats
+
+	case ChordNode:
+		// A chord lasts as long as its shortest note.
+		shortest := math.Inf(1)
+
+		for _, child := range node.Children {
+			if child.Type != NoteNode && child.Type != RestNode {
+				continue
+			}
+
+			beats := eventBeats(child, noteBeats)
+			if beats < 0 {
+				return -1
+			}
+
+			shortest = math.Min(shortest, beats)
+		}
+
+		if math.IsInf(shortest, 1) {
+			return 0
+		}
+
+		return shortest
+
+	case CramNode:
+		// The cram expression as a whole is what has a note length, so the default
+		// note length is only changed by a cram expression with a duration.
+		if len(node.Children) > 1 {
+			beats, ok := durationBeats(node.Children[1])
+			if !ok {
+				*noteBeats = 0
+				return -1
+			}
+
+			*noteBeats = beats
+		}
+
+		if *noteBeats == 0 {
+			return -1
+		}
+
+		return *noteBeats
+
+	case TupletNode:
+		ratio, err := tupletRatio(node)
+		if err != nil {
+			return -1
+		}
+
+		beats := eventBeats(node.Children[0], noteBeats)
+		if beats < 0 {
+			return -1
+		}
+
+		return beats * float64(ratio.NormalNotes) / float64(ratio.ActualNotes)
+
+	case EventSequenceNode:
+		total := 0.0
+
+		for _, child := range node.Children {
+			beats := eventBeats(child, noteBeats)
+			if beats < 0 {
+				return -1
+			}
+
+			total += beats
+		}
+
+		return total
+
+	case RepeatNode:
+		times, ok := node.Children[1].Literal.(int32)
+		if !ok {
+			return -1
+		}
+
+		beats := eventBeats(node.Children[0], noteBeats)
+		if beats < 0 {
+			return -1
+		}
+
+		return beats * float64(times)
+
+	case AtMarkerNode, GlissandoNode, MultiMeasureRestNode, OnRepetitionsNode,
+		VariableReferenceNode, VoiceGroupNode:
+		// These can't be timed without evaluating the score (or they're dealt with
+		// at the top level of a part; see beatGrouper.advance).
+		*noteBeats = 0
+		return -1
+	}
+
+	// Everything else (e.g. attribute changes and octave changes) takes no time.
+	if node.Type == LispListNode && setsDuration(node) {
+		*noteBeats = 0
+	}
+
+	return 0
+}
+
+// durationBeats returns the number of beats in a DurationNode, if all of its
+// components are note lengths.
+func durationBeats(duration ASTNode) (float64, bool) {
+	total := 0.0
+
+	for _, component := range duration.Children {
+		if component.Type == BarlineNode {
+			continue
+		}
+
+		beats, ok := noteLengthNodeBeats(component)
+		if !ok {
+			return 0, false
+		}
+
+		total += beats
+	}
+
+	return total, true
+}
+
+// noteLengthNodeBeats returns the number of beats in a NoteLengthNode with any
+// denominator, e.g. 4/3 for a triplet quarter note (`6`).
+func noteLengthNodeBeats(node ASTNode) (float64, bool) {
+	if node.Type != NoteLengthNode || len(node.Children) == 0 {
+		return 0, false
+	}
+
+	denominator, ok := node.Children[0].Literal.(float64)
+	if !ok || denominator <= 0 {
+		return 0, false
+	}
+
+	dots := int32(0)
+	if len(node.Children) > 1 {
+		dots, _ = node.Children[1].Literal.(int32)
+	}
+
+	return (4 / denominator) * (2 - math.Pow(2, -float64(dots))), true
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestFormatBeatGrouping(t *testing.T) {
+	grouped := []formatterOption{ConfigureBeatGrouping(true)}
+
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label: "eighth notes in 4/4",
+			given: "piano: (time-signature '(4 4)) " +
+				"o4 c8 d e f g a b > c | c4 < b8 a g2",
+			opts: grouped,
+			expected: "piano:\n" +
+				"  (time-signature '(4 4)) o4 c8 d  e f  g a  b > c | c4  < b8 a  g2\n",
+		},
+		formatTestCase{
+			label:    "dotted quarter notes in 6/8",
+			given:    "piano: 6/8 c8 d e f4. | g8 a b > c4.",
+			opts:     grouped,
+			expected: "piano:\n  6/8 c8 d e  f4. | g8 a b  > c4.\n",
+		},
+		formatTestCase{
+			label:    "no meter declared",
+			given:    "piano: c8 d e f g a b > c",
+			opts:     grouped,
+			expected: "piano:\n  c8 d e f g a b > c\n",
+		},
+		formatTestCase{
+			label:    "beat grouping is off by default",
+			given:    "piano: (time-sig '(4 4)) c8 d e f",
+			expected: "piano:\n  (time-sig '(4 4)) c8 d e f\n",
+		},
+		formatTestCase{
+			label:    "tie across a barline",
+			given:    "piano: 2/4 c4 d4~|8 e f4",
+			opts:     grouped,
+			expected: "piano:\n  2/4 c4  d4 | ~8 e  f4\n",
+		},
+		formatTestCase{
+			label: "triplets, chords and cram expressions",
+			given: "piano: 4/4 c6 d e c4/e/g {f g a}4 [b8 a]",
+			opts:  grouped,
+			expected: "piano:\n  4/4 c6 d e  c4 / e / g  { f g a }4\n" +
+				"  [\n    b8 a\n  ]\n",
+		},
+		formatTestCase{
+			label:    "unknown position until the next barline",
+			given:    "piano: 4/4 c4 d500ms e4 f | c4 d",
+			opts:     grouped,
+			expected: "piano:\n  4/4 c4  d500ms e4 f | c4  d\n",
+		},
+		formatTestCase{
+			label: "separate meters for each part",
+			given: "piano: (time-sig '(2 4)) c8 d e f\n" +
+				"violin: c8 d e f\n" +
+				"piano: g8 a",
+			opts: grouped,
+			expected: "piano:\n  (time-sig '(2 4)) c8 d  e f\n\n" +
+				"violin:\n  c8 d e f\n\n" +
+				"piano:\n  g8 a\n",
+		},
+		formatTestCase{
+			label: "global meter",
+			given: "(time-sig! '(2 4))\n" +
+				"piano: c8 d e f",
+			opts:     grouped,
+			expected: "(time-sig! '(2 4))\n\npiano:\n  c8 d  e f\n",
+		},
+		formatTestCase{
+			label: "no gap at the end of a line",
+			given: "piano: 4/4 c4 d e f | c d e f | c d e f | c d e f | c d e f",
+			opts:  append(grouped, ConfigureSoftWrapLen(40)),
+			expected: "piano:\n" +
+				"  4/4 c4  d  e  f | c  d  e  f | c  d  e\n" +
+				"  f | c  d  e  f | c  d  e  f\n",
+		},
+		formatTestCase{
+			label:    "minified",
+			given:    "piano: 4/4 c8 d e f",
+			opts:     append(grouped, ConfigureMinified(true)),
+			expected: "piano: 4/4 c8 d e f\n",
+		},
+	)
+}
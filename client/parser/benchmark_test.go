@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+// NB: The tests log at the DEBUG level by default, which dominates the cost of
+// parsing. To measure the parser as the CLI runs it, run the benchmarks with:
+//
+//	go test -run XXX -bench . -benchmem ./parser -args -log-level warn
+
+// largeScore returns the source code of a score with about a million AST
+// nodes, made up of many copies of a real one.
+func largeScore(b *testing.B) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	examplesDir := filepath.Join(filepath.Dir(filepath.Dir(dir)), "examples")
+
+	contents, err := os.ReadFile(
+		filepath.Join(examplesDir, "bach_cello_suite_no_1.alda"),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// Each copy parses to about 2,500 nodes.
+	return strings.Repeat(string(contents)+"\n", 400)
+}
+
+func BenchmarkParse(b *testing.B) {
+	src := largeScore(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse("", src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFormat(b *testing.B) {
+	ast, err := Parse("", largeScore(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := FormatASTToCode(ast, io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseAndFormat(b *testing.B) {
+	src := largeScore(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ast, err := Parse("", src)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		buffer := bytes.Buffer{}
+		if err := FormatASTToCode(ast, &buffer); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFormatDeeplyNested(b *testing.B) {
+	depth := 100000
+
+	ast, err := Parse(
+		"", strings.Repeat("{", depth)+"c"+strings.Repeat("}", depth),
+		MaxNestingDepth(depth),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// Without indentation, as the output would otherwise be quadratic in
+		// the depth.
+		if err := FormatASTToCode(
+			ast, io.Discard,
+			ConfigureMaxNestingDepth(depth), ConfigureNoIndent(true),
+		); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+// Package builders provides functions for constructing Alda ASTs by hand, e.g.
+// in tests or code generators.
+//
+// Each function returns a correctly shaped parser.ASTNode, with children in the
+// positions and literals of the Go types that the parser produces, so that the
+// result can be formatted (see parser.FormatASTToCode) or compared against the
+// AST of parsed Alda code (see parser.Equal).
+//
+//	builders.Root(
+//		builders.Part("piano",
+//			builders.Lisp("tempo!", builders.Int(120)),
+//			builders.Note('c', builders.Sharp(), builders.Dur(4, builders.Dots(1))),
+//			builders.Chord(builders.Note('e'), builders.Note('g')),
+//		),
+//	)
+package builders
+
+import (
+	"strings"
+
+	"alda.io/client/parser"
+)
+
+func node(
+	nodeType parser.ASTNodeType, children ...parser.ASTNode,
+) parser.ASTNode {
+	return parser.ASTNode{Type: nodeType, Children: children}
+}
+
+func leaf(nodeType parser.ASTNodeType, literal interface{}) parser.ASTNode {
+	return parser.ASTNode{Type: nodeType, Literal: literal}
+}
+
+// Root returns the root node of a score, containing parts (see Part and
+// ImplicitPart).
+func Root(parts ...parser.ASTNode) parser.ASTNode {
+	return node(parser.RootNode, parts...)
+}
+
+// ImplicitPart returns the events at the beginning of a score that precede the
+// first part declaration.
+func ImplicitPart(events ...parser.ASTNode) parser.ASTNode {
+	return node(parser.ImplicitPartNode, Seq(events...))
+}
+
+// Part returns a part with the given events. Multiple names can be separated by
+// slashes, e.g. "violin/viola".
+func Part(names string, events ...parser.ASTNode) parser.ASTNode {
+	return node(
+		parser.PartNode,
+		node(parser.PartDeclarationNode, partNames(names)),
+		Seq(events...),
+	)
+}
+
+// AliasedPart returns a part with the given alias and events, e.g. the part
+// declared as `violin/viola "strings":`.
+func AliasedPart(
+	names string, alias string, events ...parser.ASTNode,
+) parser.ASTNode {
+	return node(
+		parser.PartNode,
+		node(
+			parser.PartDeclarationNode,
+			partNames(names),
+			leaf(parser.PartAliasNode, alias),
+		),
+		Seq(events...),
+	)
+}
+
+func partNames(names string) parser.ASTNode {
+	partNames := node(parser.PartNamesNode)
+
+	for _, name := range strings.Split(names, "/") {
+		partNames.Children = append(
+			partNames.Children, leaf(parser.PartNameNode, name),
+		)
+	}
+
+	return partNames
+}
+
+// Seq returns an event sequence, e.g. `[c d e]`.
+func Seq(events ...parser.ASTNode) parser.ASTNode {
+	return node(parser.EventSequenceNode, events...)
+}
+
+// Note returns a note with the given letter.
+//
+// The remaining arguments can be accidentals (Sharp, Flat and Natural), a
+// duration (Dur or Duration) and/or Tie, in any order. Any other node is
+// included as an additional child of the note, which Validate will report.
+func Note(letter rune, parts ...parser.ASTNode) parser.ASTNode {
+	letterAndAccidentals := node(
+		parser.NoteLetterAndAccidentalsNode,
+		leaf(parser.NoteLetterNode, letter),
+	)
+
+	accidentals := node(parser.NoteAccidentalsNode)
+	durations := []parser.ASTNode{}
+	ties := []parser.ASTNode{}
+	others := []parser.ASTNode{}
+
+	for _, part := range parts {
+		switch part.Type {
+		case parser.FlatNode, parser.NaturalNode, parser.SharpNode:
+			accidentals.Children = append(accidentals.Children, part)
+		case parser.DurationNode:
+			durations = append(durations, part)
+		case parser.TieNode:
+			ties = append(ties, part)
+		default:
+			others = append(others, part)
+		}
+	}
+
+	if len(accidentals.Children) > 0 {
+		letterAndAccidentals.Children = append(
+			letterAndAccidentals.Children, accidentals,
+		)
+	}
+
+	note := node(parser.NoteNode, letterAndAccidentals)
+	note.Children = append(note.Children, durations...)
+	note.Children = append(note.Children, ties...)
+	note.Children = append(note.Children, others...)
+
+	return note
+}
+
+// Rest returns a rest, optionally with a duration (Dur or Duration).
+func Rest(duration ...parser.ASTNode) parser.ASTNode {
+	return node(parser.RestNode, duration...)
+}
+
+// MultiMeasureRest returns a rest lasting a number of measures, e.g. `R*8` is
+// MultiMeasureRest(8).
+func MultiMeasureRest(measures int32) parser.ASTNode {
+	return leaf(parser.MultiMeasureRestNode, measures)
+}
+
+// Sharp returns a sharp accidental, for use with Note.
+func Sharp() parser.ASTNode {
+	return node(parser.SharpNode)
+}
+
+// Flat returns a flat accidental, for use with Note.
+func Flat() parser.ASTNode {
+	return node(parser.FlatNode)
+}
+
+// Natural returns a natural accidental, for use with Note.
+func Natural() parser.ASTNode {
+	return node(parser.NaturalNode)
+}
+
+// Tie returns a tie (or slur), for use with Note.
+func Tie() parser.ASTNode {
+	return node(parser.TieNode)
+}
+
+// Dur returns a duration consisting of a single note length, e.g. `4.` is
+// Dur(4, Dots(1)).
+func Dur(denominator float64, dots ...parser.ASTNode) parser.ASTNode {
+	return Duration(Length(denominator, dots...))
+}
+
+// Duration returns a duration consisting of one or more components (Length, Ms
+// and Seconds) that are tied together, e.g. `4~8` is
+// Duration(Length(4), Length(8)). A Barline can also appear between the
+// components.
+func Duration(components ...parser.ASTNode) parser.ASTNode {
+	return node(parser.DurationNode, components...)
+}
+
+// Length returns a note length component of a duration, e.g. `8..` is
+// Length(8, Dots(2)).
+func Length(denominator float64, dots ...parser.ASTNode) parser.ASTNode {
+	length := node(
+		parser.NoteLengthNode, leaf(parser.DenominatorNode, denominator),
+	)
+	length.Children = append(length.Children, dots...)
+
+	return length
+}
+
+// Dots returns the dots of a note length, for use with Dur and Length.
+func Dots(n int32) parser.ASTNode {
+	return leaf(parser.DotsNode, n)
+}
+
+// Ms returns a duration component in milliseconds, e.g. `500ms`.
+func Ms(ms float64) parser.ASTNode {
+	return leaf(parser.NoteLengthMsNode, ms)
+}
+
+// Seconds returns a duration component in seconds, e.g. `2s`.
+func Seconds(seconds float64) parser.ASTNode {
+	return leaf(parser.NoteLengthSecondsNode, seconds)
+}
+
+// Barline returns a barline, which can appear as an event or within a
+// duration.
+func Barline() parser.ASTNode {
+	return node(parser.BarlineNode)
+}
+
+// Chord returns a chord, e.g. `c/e/g`. Besides notes and rests, a chord can
+// contain octave changes and Lisp forms that apply to the subsequent notes.
+func Chord(events ...parser.ASTNode) parser.ASTNode {
+	return node(parser.ChordNode, events...)
+}
+
+// Cram returns a cram expression, e.g. `{c d e}`. If one of the arguments is a
+// duration (Dur or Duration), it is used as the duration of the cram, e.g.
+// `{c d e}2` is Cram(Note('c'), Note('d'), Note('e'), Dur(2)).
+func Cram(events ...parser.ASTNode) parser.ASTNode {
+	sequence := Seq()
+	durations := []parser.ASTNode{}
+
+	for _, event := range events {
+		if event.Type == parser.DurationNode {
+			durations = append(durations, event)
+		} else {
+			sequence.Children = append(sequence.Children, event)
+		}
+	}
+
+	cram := node(parser.CramNode, sequence)
+	cram.Children = append(cram.Children, durations...)
+
+	return cram
+}
+
+// Glissando returns a glissando between notes, e.g. `c2 ~~ | g2` is
+// Glissando(Note('c', Dur(2)), Barline(), Note('g', Dur(2))).
+func Glissando(events ...parser.ASTNode) parser.ASTNode {
+	return node(parser.GlissandoNode, events...)
+}
+
+// Repeat returns a repeated event, e.g. `[c d]*2` is
+// Repeat(Seq(Note('c'), Note('d')), 2).
+func Repeat(event parser.ASTNode, times int32) parser.ASTNode {
+	return node(parser.RepeatNode, event, leaf(parser.TimesNode, times))
+}
+
+// OnRepetitions returns an event that only occurs on the given repetitions
+// (see Reps) of the enclosing repeat, e.g. `c'1-2,4`.
+func OnRepetitions(
+	event parser.ASTNode, ranges ...parser.ASTNode,
+) parser.ASTNode {
+	return node(
+		parser.OnRepetitionsNode,
+		event,
+		node(parser.RepetitionsNode, ranges...),
+	)
+}
+
+// Reps returns a range of repetitions, for use with OnRepetitions. A single
+// repetition is a range where first and last are the same.
+func Reps(first int32, last int32) parser.ASTNode {
+	return node(
+		parser.RepetitionRangeNode,
+		leaf(parser.FirstRepetitionNode, first),
+		leaf(parser.LastRepetitionNode, last),
+	)
+}
+
+// Octave returns an octave change, e.g. `o4`.
+func Octave(octave int32) parser.ASTNode {
+	return leaf(parser.OctaveSetNode, octave)
+}
+
+// OctaveUp returns `>`.
+func OctaveUp() parser.ASTNode {
+	return node(parser.OctaveUpNode)
+}
+
+// OctaveDown returns `<`.
+func OctaveDown() parser.ASTNode {
+	return node(parser.OctaveDownNode)
+}
+
+// Marker returns a marker, e.g. `%chorus`.
+func Marker(name string) parser.ASTNode {
+	return leaf(parser.MarkerNode, name)
+}
+
+// AtMarker returns a reference to a marker, e.g. `@chorus`.
+func AtMarker(name string) parser.ASTNode {
+	return leaf(parser.AtMarkerNode, name)
+}
+
+// VarDef returns a variable definition, e.g. `riff = c d e`.
+func VarDef(name string, events ...parser.ASTNode) parser.ASTNode {
+	return node(
+		parser.VariableDefinitionNode,
+		leaf(parser.VariableNameNode, name),
+		Seq(events...),
+	)
+}
+
+// VarRef returns a reference to a variable.
+func VarRef(name string) parser.ASTNode {
+	return leaf(parser.VariableReferenceNode, name)
+}
+
+// Voices returns a voice group, consisting of voices (see Voice) and optionally
+// ending with VoicesEnd.
+func Voices(voices ...parser.ASTNode) parser.ASTNode {
+	return node(parser.VoiceGroupNode, voices...)
+}
+
+// Voice returns a voice within a voice group, e.g. `V1: c d e`.
+func Voice(number int32, events ...parser.ASTNode) parser.ASTNode {
+	return node(
+		parser.VoiceNode,
+		leaf(parser.VoiceNumberNode, number),
+		Seq(events...),
+	)
+}
+
+// VoicesEnd returns `V0:`, which ends a voice group.
+func VoicesEnd() parser.ASTNode {
+	return node(parser.VoiceGroupEndMarkerNode)
+}
+
+// Dynamic returns a dynamic marking, e.g. `mf`.
+func Dynamic(marking string) parser.ASTNode {
+	return leaf(parser.DynamicNode, marking)
+}
+
+// Error returns an ErrorNode, which stands in for input that couldn't be
+// parsed. The source text is written as-is when the formatter is configured to
+// preserve errors (see parser.ConfigurePreserveErrors).
+func Error(message string, sourceText string) parser.ASTNode {
+	node := leaf(parser.ErrorNode, message)
+	node.SourceText = sourceText
+	return node
+}
+
+// TimeSignature returns a time signature, e.g. `3/4` is TimeSignature(3, 4).
+func TimeSignature(numerator int32, denominator int32) parser.ASTNode {
+	return node(
+		parser.TimeSignatureNode,
+		leaf(parser.TimeSignatureNumeratorNode, numerator),
+		leaf(parser.TimeSignatureDenominatorNode, denominator),
+	)
+}
+
+// Tuplet returns a tuplet, e.g. `{c d e}3:2` is
+// Tuplet(3, 2, Note('c'), Note('d'), Note('e')).
+func Tuplet(
+	actualNotes int32, normalNotes int32, events ...parser.ASTNode,
+) parser.ASTNode {
+	return node(
+		parser.TupletNode,
+		Seq(events...),
+		leaf(parser.TupletActualNotesNode, actualNotes),
+		leaf(parser.TupletNormalNotesNode, normalNotes),
+	)
+}
+
+// Lisp returns a Lisp list whose first element is the symbol `head`, e.g.
+// `(tempo! 120)` is Lisp("tempo!", Int(120)).
+func Lisp(head string, args ...parser.ASTNode) parser.ASTNode {
+	return List(append([]parser.ASTNode{Symbol(head)}, args...)...)
+}
+
+// List returns a Lisp list of arbitrary forms.
+func List(forms ...parser.ASTNode) parser.ASTNode {
+	return node(parser.LispListNode, forms...)
+}
+
+// Symbol returns a Lisp symbol.
+func Symbol(name string) parser.ASTNode {
+	return leaf(parser.LispSymbolNode, name)
+}
+
+// Keyword returns a Lisp keyword, e.g. `:major` is Keyword("major").
+func Keyword(name string) parser.ASTNode {
+	return leaf(parser.LispKeywordNode, name)
+}
+
+// Vector returns a Lisp vector, e.g. `[:a :major]`.
+func Vector(forms ...parser.ASTNode) parser.ASTNode {
+	return node(parser.LispVectorNode, forms...)
+}
+
+// Map returns a Lisp map of alternating keys and values, e.g. `{:channel 3}` is
+// Map(Keyword("channel"), Int(3)).
+func Map(keysAndValues ...parser.ASTNode) parser.ASTNode {
+	return node(parser.LispMapNode, keysAndValues...)
+}
+
+// Int returns a Lisp number with an integral value. Like the parser, it
+// represents the number as a float64.
+func Int(n int) parser.ASTNode {
+	return Num(float64(n))
+}
+
+// Num returns a Lisp number.
+func Num(n float64) parser.ASTNode {
+	return leaf(parser.LispNumberNode, n)
+}
+
+// Str returns a Lisp string.
+func Str(s string) parser.ASTNode {
+	return leaf(parser.LispStringNode, s)
+}
+
+// Quote returns a quoted Lisp form, e.g. `'(a major)` is
+// Quote(List(Symbol("a"), Symbol("major"))).
+func Quote(form parser.ASTNode) parser.ASTNode {
+	return node(parser.LispQuotedFormNode, form)
+}
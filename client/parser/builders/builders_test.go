@@ -0,0 +1,296 @@
+package builders
+
+import (
+	"bytes"
+	"testing"
+
+	"alda.io/client/parser"
+	_ "alda.io/client/testing"
+)
+
+// builderTestCase models a test of the builders, where the built AST is
+// expected to be valid, to format to the expected code, and to be equal to the
+// AST of the expected code.
+type builderTestCase struct {
+	label    string
+	built    parser.ASTNode
+	expected string
+}
+
+func executeBuilderTestCases(t *testing.T, testCases ...builderTestCase) {
+	for _, testCase := range testCases {
+		if err := Validate(testCase.built); err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		buffer := bytes.Buffer{}
+		if err := parser.FormatASTToCode(testCase.built, &buffer); err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if actual := buffer.String(); actual != testCase.expected {
+			t.Error(testCase.label)
+			t.Errorf("expected:\n%s\nactual:\n%s", testCase.expected, actual)
+		}
+
+		parsed, err := parser.Parse(
+			testCase.label, testCase.expected, parser.SuppressSourceContext,
+		)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if !parser.Equal(testCase.built, parsed) {
+			t.Error(testCase.label)
+			for _, diff := range parser.Diff(testCase.built, parsed) {
+				t.Errorf("%v", diff)
+			}
+		}
+	}
+}
+
+func TestBuilders(t *testing.T) {
+	executeBuilderTestCases(
+		t,
+		builderTestCase{
+			label:    "empty score",
+			built:    Root(),
+			expected: "",
+		},
+		builderTestCase{
+			label: "part with notes and rests",
+			built: Root(Part("piano",
+				Note('c', Sharp(), Dur(4, Dots(1))),
+				Note('d', Flat(), Flat()),
+				Note('e', Natural(), Tie()),
+				Rest(Dur(8)),
+				Rest(),
+			)),
+			expected: "piano:\n  c+4. d-- e_~ r8 r\n",
+		},
+		builderTestCase{
+			label: "aliased part with multiple names",
+			built: Root(AliasedPart("violin/viola", "strings", Note('c'))),
+			expected: `violin/viola "strings":
+  c
+`,
+		},
+		builderTestCase{
+			label: "implicit part followed by a part",
+			built: Root(
+				ImplicitPart(Lisp("tempo!", Int(120))),
+				Part("piano", Note('c')),
+			),
+			expected: "(tempo! 120)\n\npiano:\n  c\n",
+		},
+		builderTestCase{
+			label: "durations",
+			built: Root(ImplicitPart(
+				Note('c', Duration(Length(4), Length(8, Dots(2)))),
+				Note('d', Duration(Ms(500), Seconds(2))),
+				Note('e', Duration(Length(2), Barline(), Length(2))),
+			)),
+			expected: "c4~8.. d500ms~2s e2 | ~2\n",
+		},
+		builderTestCase{
+			label: "chords",
+			built: Root(ImplicitPart(
+				Chord(Note('c'), Note('e'), OctaveUp(), Note('g')),
+				Chord(
+					Note('c', Dur(1)), Rest(Dur(2)), Lisp("vol", Int(50)), Note('e'),
+				),
+			)),
+			expected: "c / e / > g c1 / r2 / (vol 50) e\n",
+		},
+		builderTestCase{
+			label: "crams",
+			built: Root(ImplicitPart(
+				Cram(Note('c'), Note('d')),
+				Cram(Note('e'), Note('f'), Dur(2)),
+			)),
+			expected: "{ c d } { e f }2\n",
+		},
+		builderTestCase{
+			label: "repeats",
+			built: Root(ImplicitPart(
+				Repeat(Seq(
+					OnRepetitions(
+						Seq(Note('c'), Note('d')), Reps(1, 2), Reps(4, 4),
+					),
+					Note('e'),
+				), 4),
+				Repeat(Note('f'), 2),
+			)),
+			expected: "[\n  [\n    c d\n  ] '1-2,4 e\n] *4 f *2\n",
+		},
+		builderTestCase{
+			label: "octaves, markers and barlines",
+			built: Root(ImplicitPart(
+				Octave(4), OctaveUp(), OctaveDown(),
+				Marker("chorus"), AtMarker("chorus"), Barline(),
+			)),
+			expected: "o4 > < %chorus @chorus |\n",
+		},
+		builderTestCase{
+			label: "variables",
+			built: Root(
+				ImplicitPart(VarDef("riff", Note('c'), Note('d'))),
+				Part("piano", VarRef("riff")),
+			),
+			expected: "riff = c d\n\npiano:\n  riff\n",
+		},
+		builderTestCase{
+			label: "voices",
+			built: Root(Part("piano",
+				Voices(
+					Voice(1, Note('c')),
+					Voice(2, Note('e')),
+					VoicesEnd(),
+				),
+				Note('g'),
+			)),
+			expected: "piano:\n  V1:\n    c\n  V2:\n    e\n  V0: g\n",
+		},
+		builderTestCase{
+			label: "lisp forms",
+			built: Root(ImplicitPart(
+				Lisp("key-signature", Quote(List(
+					Symbol("e"), List(Symbol("flat")),
+				))),
+				Lisp("print", Str("hi"), Num(1.5), Int(-3)),
+			)),
+			expected: "(key-signature '(e (flat))) (print \"hi\" 1.5 -3)\n",
+		},
+		builderTestCase{
+			label:    "dynamic markings",
+			built:    Root(Part("piano", Dynamic("pp"), Note('c'), Dynamic("mf"))),
+			expected: "piano:\n  pp c mf\n",
+		},
+		builderTestCase{
+			label: "time signature",
+			built: Root(Part("piano",
+				TimeSignature(3, 4), Note('c', Dur(2, Dots(1))), TimeSignature(6, 8),
+			)),
+			expected: "piano:\n  3/4 c2. 6/8\n",
+		},
+		builderTestCase{
+			label: "glissando",
+			built: Root(Part("piano",
+				Glissando(Note('c', Dur(2)), Barline(), Note('g', Dur(2))),
+			)),
+			expected: "piano:\n  c2 ~~ | g2\n",
+		},
+		builderTestCase{
+			label: "multi-measure rest",
+			built: Root(Part("piano",
+				TimeSignature(3, 4), MultiMeasureRest(8), Barline(), Note('c'),
+			)),
+			expected: "piano:\n  3/4 R*8 | c\n",
+		},
+		builderTestCase{
+			label: "tuplet",
+			built: Root(Part("piano",
+				Tuplet(3, 2, Note('c', Dur(8)), Note('d'), Note('e')),
+			)),
+			expected: "piano:\n  { c8 d e }3:2\n",
+		},
+		builderTestCase{
+			label: "lisp keywords, vectors and maps",
+			built: Root(ImplicitPart(
+				Lisp("key-signature", Vector(Keyword("a"), Keyword("major"))),
+				Lisp("instrument-config", Map(
+					Keyword("channel"), Int(3),
+					Keyword("patches"), Quote(Vector(Int(1), Int(2))),
+				)),
+			)),
+			expected: "(key-signature [:a :major]) " +
+				"(instrument-config {:channel 3 :patches '[1 2]})\n",
+		},
+	)
+}
+
+func TestValidate(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    parser.ASTNode
+		expected string
+	}{
+		{
+			label: "note with too many children",
+			given: Root(Part("piano",
+				Note('c', Dur(4), Tie(), Marker("oops")),
+			)),
+			expected: "RootNode/PartNode/EventSequenceNode/NoteNode: expected " +
+				"NoteNode to have 1, 2 or 3 children, but it has 4",
+		},
+		{
+			label: "leaf with children",
+			given: Root(ImplicitPart(
+				Note('c'),
+				parser.ASTNode{
+					Type:     parser.BarlineNode,
+					Children: []parser.ASTNode{Note('d')},
+				},
+			)),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/BarlineNode: " +
+				"expected BarlineNode to have 0 children, but it has 1",
+		},
+		{
+			label: "glissando with one note",
+			given: Root(ImplicitPart(Note('c'), Note('d'), Glissando(Note('e')))),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/GlissandoNode: " +
+				"expected GlissandoNode to have at least 2 children, but it has 1",
+		},
+		{
+			label: "repeat without times",
+			given: Root(ImplicitPart(Note('c'), parser.ASTNode{
+				Type:     parser.RepeatNode,
+				Children: []parser.ASTNode{Note('d')},
+			}, Note('e'))),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/RepeatNode: " +
+				"expected RepeatNode to have 2 children, but it has 1",
+		},
+		{
+			label: "cram with two durations",
+			given: Root(ImplicitPart(Cram(Note('c'), Dur(4), Dur(8)))),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/CramNode: " +
+				"expected CramNode to have 1 or 2 children, but it has 3",
+		},
+		{
+			label: "empty duration among siblings",
+			given: Root(ImplicitPart(
+				Note('c', Dur(4)),
+				Note('d', Duration()),
+			)),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/NoteNode[1]/" +
+				"DurationNode: expected DurationNode to have at least 1 " +
+				"child, but it has 0",
+		},
+		{
+			label: "error node",
+			given: Root(Part("piano",
+				Note('c'), Error("Unexpected `)` in inner events", ") d"), Note('e'),
+			)),
+			expected: "RootNode/PartNode/EventSequenceNode/ErrorNode: " +
+				"syntax error: Unexpected `)` in inner events",
+		},
+	} {
+		err := Validate(testCase.given)
+		if err == nil {
+			t.Error(testCase.label)
+			t.Error("expected validation to fail")
+			continue
+		}
+
+		if err.Error() != testCase.expected {
+			t.Error(testCase.label)
+			t.Errorf("expected error: %s\nactual error: %s", testCase.expected, err)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package builders
+
+import (
+	"alda.io/client/parser"
+)
+
+// Validate checks that the tree is well-formed, i.e. that each node has the
+// number and types of children and the type of literal that the formatter
+// expects, returning an error describing the first problem, if any. See
+// parser.ValidateAST.
+func Validate(root parser.ASTNode) error {
+	if problems := parser.ValidateAST(root); len(problems) > 0 {
+		return problems[0]
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"bytes"
 	"testing"
 
 	"alda.io/client/model"
@@ -103,3 +104,92 @@ func TestChords(t *testing.T) {
 		},
 	)
 }
+
+func TestFormatChordInnerEvents(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "octave change before a chord member",
+			given:    "c/e/>g",
+			expected: "c / e / > g\n",
+		},
+		formatTestCase{
+			label:    "octave change before the separator",
+			given:    "c/e >/g",
+			expected: "c / e / > g\n",
+		},
+		formatTestCase{
+			label:    "octave change before a chord",
+			given:    "c > e / g",
+			expected: "c > e / g\n",
+		},
+		formatTestCase{
+			label:    "octave change after a chord",
+			given:    "c/e/g > a",
+			expected: "c / e / g > a\n",
+		},
+		formatTestCase{
+			label:    "several inner events",
+			given:    "c/ o5 (vol 50) > e/<g",
+			expected: "c / o5 (vol 50) > e / < g\n",
+		},
+		formatTestCase{
+			label:    "minified",
+			given:    "c/e/>g/(vol 50) o3 a > b",
+			opts:     []formatterOption{ConfigureMinified(true)},
+			expected: "c/e/>g/(vol 50) o3 a >b\n",
+		},
+		formatTestCase{
+			label:    "wrapped chord",
+			given:    "c d e/>g/<c",
+			opts:     []formatterOption{ConfigureSoftWrapLen(8)},
+			expected: "c d e /\n> g / <\nc\n",
+		},
+		formatTestCase{
+			label:    "wrapped before a chord separator",
+			given:    "c d e/g",
+			opts:     []formatterOption{ConfigureSoftWrapLen(5)},
+			expected: "c d\ne / g\n",
+		},
+	)
+}
+
+func TestFormatChordInnerEventsRoundTrip(t *testing.T) {
+	for _, given := range []string{
+		"c/e/>g",
+		"c > e / g",
+		"c/e >/g",
+		"c/>e/<g > a/c",
+		"c1/(vol 50) >e8/o3 g4.",
+		"[c/>e]*2 {c/e >g}2",
+		"riff = c/e/>g\npiano: riff",
+	} {
+		ast, err := Parse("", given)
+		if err != nil {
+			t.Fatalf("%q: %v", given, err)
+		}
+
+		for _, opts := range [][]formatterOption{
+			nil,
+			{ConfigureMinified(true)},
+			{ConfigureSoftWrapLen(4)},
+		} {
+			buffer := bytes.Buffer{}
+			if err := FormatASTToCode(ast, &buffer, opts...); err != nil {
+				t.Fatalf("%q: %v", given, err)
+			}
+
+			formatted, err := Parse("", buffer.String())
+			if err != nil {
+				t.Fatalf("%q formatted as %q: %v", given, buffer.String(), err)
+			}
+
+			if !ASTEqual(ast, formatted, IgnoreSourceContext) {
+				t.Errorf("%q formatted as %q", given, buffer.String())
+				for _, diffItem := range Diff(ast, formatted) {
+					t.Errorf("%v", diffItem)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package parser
+
+import "reflect"
+
+// Clone returns a deep copy of the node, so that the copy can be modified
+// without affecting the original, and vice versa.
+//
+// The children are copied recursively. Literals of the types that the parser
+// produces (rune, int32, int64, int, float64 and string) are immutable, so they
+// are shared between the original and the copy. Slice and map literals, which
+// the parser never produces but a hand-built AST might contain, are copied
+// recursively. Literals of any other type (e.g. pointers) are shared.
+//
+// Nil and empty Children are preserved as such, so the copy is equal to the
+// original according to ASTEqual.
+func (node ASTNode) Clone() ASTNode {
+	clone := ASTNode{
+		Type:          node.Type,
+		Literal:       cloneLiteral(node.Literal),
+		SourceContext: node.SourceContext,
+		SourceText:    node.SourceText,
+	}
+
+	if node.Children != nil {
+		clone.Children = make([]ASTNode, len(node.Children))
+		for i, child := range node.Children {
+			clone.Children[i] = child.Clone()
+		}
+	}
+
+	return clone
+}
+
+func cloneLiteral(literal interface{}) interface{} {
+	switch literal.(type) {
+	case nil, rune, int64, int, float64, string:
+		return literal
+	}
+
+	return cloneValue(reflect.ValueOf(literal)).Interface()
+}
+
+func cloneValue(value reflect.Value) reflect.Value {
+	switch value.Kind() {
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+
+		clone := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			clone.Index(i).Set(cloneValue(value.Index(i)))
+		}
+		return clone
+
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+
+		clone := reflect.MakeMapWithSize(value.Type(), value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			clone.SetMapIndex(iter.Key(), cloneValue(iter.Value()))
+		}
+		return clone
+
+	case reflect.Interface:
+		if value.IsNil() {
+			return value
+		}
+
+		clone := reflect.New(value.Type()).Elem()
+		clone.Set(cloneValue(value.Elem()))
+		return clone
+
+	default:
+		return value
+	}
+}
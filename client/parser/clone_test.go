@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestCloneIsIndependent(t *testing.T) {
+	original, err := Parse(
+		"piece.alda", "piano: [c8 d e f]*2 V1: {c d e}4 V2: c/e/g",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := original.Clone()
+	clone := original.Clone()
+
+	if !ASTEqual(original, clone) {
+		t.Fatalf("expected clone to be equal: %v", Diff(original, clone))
+	}
+
+	// RootNode/PartNode/EventSequenceNode
+	events := &clone.Children[0].Children[1]
+
+	// .../RepeatNode/EventSequenceNode/NoteNode
+	repeatedNote := &events.Children[0].Children[0].Children[0]
+	repeatedNote.Children[0].Children[0].Literal = 'b'
+	repeatedNote.Children = append(repeatedNote.Children, ASTNode{Type: TieNode})
+
+	// .../VoiceGroupNode
+	voices := &events.Children[1]
+	voices.Children = voices.Children[:1]
+	voices.Children[0].Children[1].Children[0].Type = ChordNode
+
+	if !ASTEqual(original, snapshot) {
+		t.Errorf(
+			"modifying the clone modified the original: %v",
+			Diff(snapshot, original),
+		)
+	}
+
+	if ASTEqual(original, clone) {
+		t.Error("expected the clone to have been modified")
+	}
+}
+
+func TestCloneLiterals(t *testing.T) {
+	slice := []interface{}{"a", []int{1, 2}}
+	mapping := map[string][]int{"a": {1, 2}}
+
+	node := ASTNode{
+		Type: LispListNode,
+		Children: []ASTNode{
+			{Type: LispSymbolNode, Literal: slice},
+			{Type: LispSymbolNode, Literal: mapping},
+			{Type: LispStringNode, Literal: "b"},
+		},
+	}
+
+	clone := node.Clone()
+
+	clone.Children[0].Literal.([]interface{})[1].([]int)[0] = 100
+	clone.Children[1].Literal.(map[string][]int)["a"][0] = 100
+	clone.Children[1].Literal.(map[string][]int)["c"] = nil
+
+	if slice[1].([]int)[0] != 1 {
+		t.Errorf("modifying a cloned slice literal modified the original")
+	}
+
+	if mapping["a"][0] != 1 || len(mapping) != 1 {
+		t.Errorf("modifying a cloned map literal modified the original")
+	}
+
+	if clone.Children[2].Literal != "b" {
+		t.Errorf("expected string literal to be copied")
+	}
+}
+
+func TestCloneNilAndEmptyChildren(t *testing.T) {
+	node := ASTNode{
+		Type:     EventSequenceNode,
+		Children: []ASTNode{{Type: EventSequenceNode, Children: []ASTNode{}}},
+	}
+
+	clone := node.Clone()
+
+	if clone.Children[0].Children == nil {
+		t.Error("expected empty children to remain non-nil")
+	}
+
+	if (ASTNode{Type: BarlineNode}).Clone().Children != nil {
+		t.Error("expected nil children to remain nil")
+	}
+}
+
+func BenchmarkClone(b *testing.B) {
+	dir, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	examplesDir := filepath.Join(filepath.Dir(filepath.Dir(dir)), "examples")
+
+	contents, err := os.ReadFile(
+		filepath.Join(examplesDir, "bach_cello_suite_no_1.alda"),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// A large score, made up of many copies of a real one.
+	ast, err := Parse("", strings.Repeat(string(contents)+"\n", 50))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ast.Clone()
+	}
+}
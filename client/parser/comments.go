@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"alda.io/client/model"
+)
+
+// A SourceComment is a comment in Alda source code, e.g. `# Verse 1`.
+type SourceComment struct {
+	// Text is the text of the comment, including the initial `#`.
+	Text string
+	// SourceContext is the position of the comment in the source code.
+	SourceContext model.AldaSourceContext
+	// Standalone is true if the comment is on a line of its own, as opposed to
+	// following code on the same line, e.g. `c d e # a trailing comment`.
+	Standalone bool
+}
+
+// CollectComments customizes a parser to collect the comments in the input,
+// in the order in which they appear, by appending them to the given slice.
+// Otherwise, comments are discarded. See FormatASTWithComments.
+func CollectComments(comments *[]SourceComment) parseOption {
+	return func(p *parser) {
+		p.comments = comments
+	}
+}
+
+// collectComments returns the comments among the given tokens, which must
+// include trivia for there to be any.
+func collectComments(tokens []Token) []SourceComment {
+	comments := []SourceComment{}
+
+	// The line on which the last token other than trivia ended
+	codeLine := 0
+
+	for _, token := range tokens {
+		switch {
+		case token.tokenType == Comment:
+			comments = append(comments, SourceComment{
+				Text:          strings.TrimRight(token.text, " \t\r"),
+				SourceContext: token.sourceContext,
+				Standalone:    token.sourceContext.Line != codeLine,
+			})
+
+		case !token.tokenType.IsTrivia():
+			codeLine = token.endContext.Line
+		}
+	}
+
+	return comments
+}
+
+// FormatASTWithComments formats an AST like FormatASTToCode, and re-inserts the
+// given standalone comments (see CollectComments) on lines of their own, each
+// before the first line of code that followed it in the original source code,
+// and with the same indentation as that line. Lines are broken where necessary
+// to make room for comments between events. This keeps e.g. section headers
+// between parts in place. Comments that followed everything else are written
+// at the end.
+//
+// Only standalone comments are written. Trailing comments (e.g. `c d # foo`)
+// are dropped.
+//
+// NB: The comments are placed according to the source positions of the nodes
+// in the AST, so the AST must have been parsed with source context.
+func FormatASTWithComments(
+	root ASTNode,
+	comments []SourceComment,
+	out io.Writer,
+	opts ...formatterOption,
+) error {
+	temp := bytes.Buffer{}
+	f := newFormatter(&temp, opts...)
+	f.sourceLines = []int{}
+	for _, comment := range comments {
+		if comment.Standalone {
+			f.commentLines = append(f.commentLines, comment.SourceContext.Line)
+		}
+	}
+
+	if err := f.formatRoot(root); err != nil {
+		return err
+	}
+
+	output := insertComments(
+		f.alignOutputBarlines(temp.Bytes()), f.sourceLines, comments,
+	)
+	if err := f.checkLineWidths(output); err != nil {
+		return err
+	}
+
+	if !f.trailingNewline {
+		output = bytes.TrimSuffix(output, []byte("\n"))
+	}
+
+	_, err := out.Write(output)
+	return err
+}
+
+// insertComments inserts standalone comments into formatted output, given the
+// source line from which each line of output was formatted (0 if unknown).
+func insertComments(
+	output []byte, sourceLines []int, comments []SourceComment,
+) []byte {
+	lines := strings.SplitAfter(string(output), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// inserted[i] are the comments to write before line i of the output, and
+	// inserted[len(lines)] are those to write at the end.
+	inserted := make([][]string, len(lines)+1)
+
+	for _, comment := range comments {
+		if !comment.Standalone {
+			continue
+		}
+
+		i := 0
+		for ; i < len(lines) && i < len(sourceLines); i++ {
+			if sourceLines[i] > comment.SourceContext.Line {
+				break
+			}
+		}
+
+		indent := ""
+		switch {
+		case i < len(lines):
+			indent = leadingWhitespace(lines[i])
+		case len(lines) > 0 && comment.SourceContext.Column > 1:
+			indent = leadingWhitespace(lines[len(lines)-1])
+		}
+
+		inserted[i] = append(inserted[i], indent+comment.Text+"\n")
+	}
+
+	result := strings.Builder{}
+
+	for i, line := range lines {
+		for _, comment := range inserted[i] {
+			result.WriteString(comment)
+		}
+
+		result.WriteString(line)
+	}
+
+	if len(inserted[len(lines)]) > 0 {
+		if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+			result.WriteString("\n")
+		}
+
+		for _, comment := range inserted[len(lines)] {
+			result.WriteString(comment)
+		}
+	}
+
+	return []byte(result.String())
+}
+
+func leadingWhitespace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"bytes"
+	"reflect"
 	"testing"
 
 	"alda.io/client/model"
@@ -43,3 +45,185 @@ func TestComments(t *testing.T) {
 		},
 	)
 }
+
+func TestCollectComments(t *testing.T) {
+	comments := []SourceComment{}
+
+	_, err := Parse("piece.alda", `# Intro
+piano: c d # trailing
+  # indented
+
+violin: (vol 50 # in a list
+) e
+#no space`, CollectComments(&comments))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(line int, column int) model.AldaSourceContext {
+		return model.AldaSourceContext{
+			Filename: "piece.alda", Line: line, Column: column,
+		}
+	}
+
+	expected := []SourceComment{
+		{Text: "# Intro", SourceContext: at(1, 1), Standalone: true},
+		{Text: "# trailing", SourceContext: at(2, 12), Standalone: false},
+		{Text: "# indented", SourceContext: at(3, 3), Standalone: true},
+		{Text: "# in a list", SourceContext: at(5, 17), Standalone: false},
+		{Text: "#no space", SourceContext: at(7, 1), Standalone: true},
+	}
+
+	// NB: We don't compare offsets, which are tested elsewhere.
+	for i := range comments {
+		comments[i].SourceContext.Offset = 0
+	}
+
+	if !reflect.DeepEqual(expected, comments) {
+		t.Errorf("expected:\n%#v\nactual:\n%#v", expected, comments)
+	}
+}
+
+func TestFormatASTWithComments(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		opts     []formatterOption
+		expected string
+	}{
+		{
+			label: "header comments between parts",
+			given: `# Intro
+piano: c d e
+
+# Verse
+violin: f g a
+# Outro
+cello: b`,
+			expected: `# Intro
+piano:
+  c d e
+
+# Verse
+violin:
+  f g a
+
+# Outro
+cello:
+  b
+`,
+		},
+		{
+			label: "comments within a part",
+			given: `piano:
+  c d
+  # second phrase
+  e f
+    # last note
+  g
+# the end`,
+			expected: `piano:
+  c d
+  # second phrase
+  e f
+  # last note
+  g
+# the end
+`,
+		},
+		{
+			label:    "trailing comments are dropped",
+			given:    "piano: c d # trailing\n  e",
+			expected: "piano:\n  c d e\n",
+		},
+		{
+			label:    "comments after the last event",
+			given:    "piano: c d\n  # indented\n# not indented",
+			expected: "piano:\n  c d\n  # indented\n# not indented\n",
+		},
+		{
+			label: "short parts with comments",
+			given: `# drums
+snare: c d
+kick:
+  c
+  # fill
+  d`,
+			opts: []formatterOption{ConfigureInlineShortParts(80)},
+			expected: `# drums
+snare: c d
+
+kick:
+  c
+  # fill
+  d
+`,
+		},
+		{
+			label:    "only comments",
+			given:    "# one\n# two",
+			expected: "# one\n# two\n",
+		},
+		{
+			label:    "without a trailing newline",
+			given:    "# Intro\npiano: c\n# the end",
+			opts:     []formatterOption{ConfigureTrailingNewline(false)},
+			expected: "# Intro\npiano:\n  c\n# the end",
+		},
+	} {
+		comments := []SourceComment{}
+
+		ast, err := Parse("", testCase.given, CollectComments(&comments))
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		buffer := bytes.Buffer{}
+		err = FormatASTWithComments(ast, comments, &buffer, testCase.opts...)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if actual := buffer.String(); actual != testCase.expected {
+			t.Error(testCase.label)
+			t.Errorf("expected:\n%s\nactual:\n%s", testCase.expected, actual)
+		}
+
+		// The output should parse to the same AST, with the same comments.
+		formattedComments := []SourceComment{}
+		formattedAST, err := Parse(
+			"", buffer.String(), CollectComments(&formattedComments),
+		)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if !Equal(ast, formattedAST) {
+			t.Error(testCase.label)
+			t.Error("expected the formatted output to parse to the same AST")
+		}
+
+		standalone := []string{}
+		for _, comment := range comments {
+			if comment.Standalone {
+				standalone = append(standalone, comment.Text)
+			}
+		}
+
+		actualComments := []string{}
+		for _, comment := range formattedComments {
+			actualComments = append(actualComments, comment.Text)
+		}
+
+		if !reflect.DeepEqual(standalone, actualComments) {
+			t.Error(testCase.label)
+			t.Errorf("expected comments %q, got %q", standalone, actualComments)
+		}
+	}
+}
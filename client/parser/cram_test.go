@@ -41,5 +41,20 @@ func TestCram(t *testing.T) {
 				},
 			},
 		},
+		parseTestCase{
+			label: "empty cram expression",
+			given: "{}4 c",
+			expectUpdates: []model.ScoreUpdate{
+				model.Cram{
+					Events: []model.ScoreUpdate{},
+					Duration: model.Duration{
+						Components: []model.DurationComponent{
+							model.NoteLength{Denominator: 4},
+						},
+					},
+				},
+				model.Note{Pitch: model.LetterAndAccidentals{NoteLetter: model.C}},
+			},
+		},
 	)
 }
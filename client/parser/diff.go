@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A DiffKind is a kind of difference between two AST nodes.
+type DiffKind int
+
+const (
+	// TypeDiff means that the two nodes are of different types.
+	TypeDiff DiffKind = iota
+	// LiteralDiff means that the two nodes have different literals.
+	LiteralDiff
+	// ChildCountDiff means that the two nodes have different numbers of
+	// children.
+	ChildCountDiff
+)
+
+func (dk DiffKind) String() string {
+	switch dk {
+	case TypeDiff:
+		return "type"
+	case LiteralDiff:
+		return "literal"
+	case ChildCountDiff:
+		return "child count"
+	default:
+		return fmt.Sprintf("%d (String not implemented)", dk)
+	}
+}
+
+// A NodeDiff describes a single difference between two ASTs.
+type NodeDiff struct {
+	// Path is the location of the differing node within the tree, e.g.
+	// "RootNode/PartNode[0]/EventSequenceNode/NoteNode[3]". An index is included
+	// when the parent has more than one child of the same type.
+	Path string
+	Kind DiffKind
+	// A and B are the differing values (node types, literals, or numbers of
+	// children, depending on Kind) of the first and second node, respectively.
+	A interface{}
+	B interface{}
+}
+
+func (d NodeDiff) String() string {
+	return fmt.Sprintf("%s: %s differs: %#v != %#v", d.Path, d.Kind, d.A, d.B)
+}
+
+// An equalOption is a function that customizes the comparison done by
+// ASTEqual.
+type equalOption func(*equalConfig)
+
+type equalConfig struct {
+	ignoreSourceContext bool
+}
+
+// IgnoreSourceContext customizes ASTEqual to disregard the source context (file,
+// line and column) of each node.
+func IgnoreSourceContext(config *equalConfig) {
+	config.ignoreSourceContext = true
+}
+
+// ASTEqual reports whether two ASTs are equal, comparing the type, literal, and
+// children of each node recursively. By default, the source context of each
+// node is compared as well; see IgnoreSourceContext. The source text of
+// literals is never compared, as it doesn't affect the meaning of the AST.
+//
+// Literals are compared by both value and Go type, so for example an int32
+// literal 4 is not equal to an int literal 4, nor to a float64 literal 4. This
+// is deliberate: the formatter and the score model assert on the concrete type
+// of each literal, so two ASTs that differ in this way do not behave the same.
+// (The parser only ever produces int32 for integral literals and float64 for
+// numbers that may be fractional; any other numeric type in an AST indicates
+// that it was constructed by hand.)
+func ASTEqual(a, b ASTNode, opts ...equalOption) bool {
+	config := &equalConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	return astEqual(a, b, config)
+}
+
+func astEqual(a, b ASTNode, config *equalConfig) bool {
+	if a.Type != b.Type ||
+		!reflect.DeepEqual(a.Literal, b.Literal) ||
+		len(a.Children) != len(b.Children) {
+		return false
+	}
+
+	if !config.ignoreSourceContext && a.SourceContext != b.SourceContext {
+		return false
+	}
+
+	for i := range a.Children {
+		if !astEqual(a.Children[i], b.Children[i], config) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Equal reports whether two ASTs are structurally equal, i.e. they have the
+// same node types, literals, and children, ignoring source context. It is
+// equivalent to ASTEqual(a, b, IgnoreSourceContext).
+func Equal(a, b ASTNode) bool {
+	return ASTEqual(a, b, IgnoreSourceContext)
+}
+
+// Diff returns the structural differences between two ASTs, ignoring source
+// context. See ASTEqual for the rules used to compare literals.
+//
+// When two nodes have different types, their children are not compared. When
+// two nodes have different numbers of children, the children that they have in
+// common (by index) are still compared.
+func Diff(a, b ASTNode) []NodeDiff {
+	diffs := []NodeDiff{}
+	diffNodes(a, b, a.Type.String(), &diffs)
+	return diffs
+}
+
+func childPathSegment(siblings []ASTNode, index int) string {
+	child := siblings[index]
+
+	sameType := 0
+	for _, sibling := range siblings {
+		if sibling.Type == child.Type {
+			sameType++
+		}
+	}
+
+	if sameType > 1 {
+		return fmt.Sprintf("%s[%d]", child.Type.String(), index)
+	}
+
+	return child.Type.String()
+}
+
+func diffNodes(a, b ASTNode, path string, diffs *[]NodeDiff) {
+	if a.Type != b.Type {
+		*diffs = append(*diffs, NodeDiff{
+			Path: path, Kind: TypeDiff, A: a.Type, B: b.Type,
+		})
+		return
+	}
+
+	if !reflect.DeepEqual(a.Literal, b.Literal) {
+		*diffs = append(*diffs, NodeDiff{
+			Path: path, Kind: LiteralDiff, A: a.Literal, B: b.Literal,
+		})
+	}
+
+	if len(a.Children) != len(b.Children) {
+		*diffs = append(*diffs, NodeDiff{
+			Path: path,
+			Kind: ChildCountDiff,
+			A:    len(a.Children),
+			B:    len(b.Children),
+		})
+	}
+
+	for i := 0; i < len(a.Children) && i < len(b.Children); i++ {
+		diffNodes(
+			a.Children[i],
+			b.Children[i],
+			path+"/"+childPathSegment(a.Children, i),
+			diffs,
+		)
+	}
+}
@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+	"github.com/go-test/deep"
+)
+
+type diffTestCase struct {
+	label    string
+	a        string
+	b        string
+	expected []NodeDiff
+}
+
+func executeDiffTestCases(t *testing.T, testCases ...diffTestCase) {
+	for _, testCase := range testCases {
+		a, err := ParseString(testCase.a)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		b, err := ParseString(testCase.b)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		actual := Diff(a, b)
+		if diff := deep.Equal(testCase.expected, actual); diff != nil {
+			t.Error(testCase.label)
+			for _, diffItem := range diff {
+				t.Errorf("%v", diffItem)
+			}
+		}
+
+		if Equal(a, b) != (len(testCase.expected) == 0) {
+			t.Error(testCase.label)
+			t.Errorf("Equal disagrees with Diff: %v", actual)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	executeDiffTestCases(
+		t,
+		diffTestCase{
+			label:    "equal, ignoring source context",
+			a:        "piano: c d e",
+			b:        "piano:\n  c\n  d  e",
+			expected: []NodeDiff{},
+		},
+		diffTestCase{
+			label: "different literal",
+			a:     "piano: c d e f",
+			b:     "piano: c d e g",
+			expected: []NodeDiff{
+				{
+					Path: "RootNode/PartNode/EventSequenceNode/NoteNode[3]" +
+						"/NoteLetterAndAccidentalsNode/NoteLetterNode",
+					Kind: LiteralDiff,
+					A:    'f',
+					B:    'g',
+				},
+			},
+		},
+		diffTestCase{
+			label: "missing child",
+			a:     "piano: c8 d e",
+			b:     "piano: c d e",
+			expected: []NodeDiff{
+				{
+					Path: "RootNode/PartNode/EventSequenceNode/NoteNode[0]",
+					Kind: ChildCountDiff,
+					A:    2,
+					B:    1,
+				},
+			},
+		},
+		diffTestCase{
+			label: "swapped node type",
+			a:     "piano: c d e",
+			b:     "piano: c r e",
+			expected: []NodeDiff{
+				{
+					Path: "RootNode/PartNode/EventSequenceNode/NoteNode[1]",
+					Kind: TypeDiff,
+					A:    NoteNode,
+					B:    RestNode,
+				},
+			},
+		},
+	)
+}
+
+func TestEqualLiteralTypes(t *testing.T) {
+	a := ASTNode{Type: OctaveSetNode, Literal: int32(4)}
+	b := ASTNode{Type: OctaveSetNode, Literal: 4}
+
+	if Equal(a, b) {
+		t.Error("int32 and int literals should not be considered equal")
+	}
+}
+
+func TestASTEqual(t *testing.T) {
+	parse := func(input string, opts ...parseOption) ASTNode {
+		ast, err := Parse("", input, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ast
+	}
+
+	for _, testCase := range []struct {
+		label    string
+		a        ASTNode
+		b        ASTNode
+		opts     []equalOption
+		expected bool
+	}{
+		{
+			label:    "equal",
+			a:        parse("piano: c d e"),
+			b:        parse("piano: c d e"),
+			expected: true,
+		},
+		{
+			label:    "equal except for source context",
+			a:        parse("piano: c d e"),
+			b:        parse("piano:\n  c d e"),
+			expected: false,
+		},
+		{
+			label:    "equal except for source context, ignoring source context",
+			a:        parse("piano: c d e"),
+			b:        parse("piano:\n  c d e"),
+			opts:     []equalOption{IgnoreSourceContext},
+			expected: true,
+		},
+		{
+			label:    "unequal by literal",
+			a:        parse("piano: o4 c", SuppressSourceContext),
+			b:        parse("piano: o5 c", SuppressSourceContext),
+			expected: false,
+		},
+		{
+			label:    "unequal by structure",
+			a:        parse("piano: [c d] e", SuppressSourceContext),
+			b:        parse("piano: c d e", SuppressSourceContext),
+			expected: false,
+		},
+		{
+			label:    "unequal by literal type",
+			a:        ASTNode{Type: LispNumberNode, Literal: int32(1)},
+			b:        ASTNode{Type: LispNumberNode, Literal: float64(1)},
+			expected: false,
+		},
+	} {
+		if actual := ASTEqual(testCase.a, testCase.b, testCase.opts...); actual != testCase.expected {
+			t.Errorf("%s: expected %v, got %v", testCase.label, testCase.expected, actual)
+		}
+	}
+}
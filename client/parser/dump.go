@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// dumpWidth is the line length beyond which DumpAST breaks a node's children
+// onto separate lines.
+const dumpWidth = 80
+
+// A dumpOption is a function that customizes the output of DumpAST.
+type dumpOption func(*dumper)
+
+// DumpSourceContext customizes DumpAST to include the source position (line
+// and column) of each node that has one, e.g. `(Note@3:5 ...)`.
+func DumpSourceContext(d *dumper) {
+	d.sourceContext = true
+}
+
+type dumper struct {
+	sourceContext bool
+	buffer        bytes.Buffer
+}
+
+// DumpAST writes a compact, indented, s-expression representation of an AST,
+// for debugging purposes, e.g.:
+//
+//	(Note (NoteLetterAndAccidentals (NoteLetter c) (NoteAccidentals Sharp))
+//	  (Duration (NoteLength (Denominator 4.0))))
+//
+// Each node is written as its type (without the "Node" suffix), followed by its
+// literal, if it has one, and its children. A node with neither a literal nor
+// children is written as a bare type, e.g. `Sharp`. A node is written on a
+// single line if it fits; otherwise, each of its children is written on a
+// separate, indented line.
+//
+// The dump depends only on the AST, so it is deterministic. Literals of any
+// type other than those that the parser produces are written along with their
+// Go type, e.g. `int64(4)`, as are float64 literals with integral values, e.g.
+// `4.0`, so that literals that are not equal according to ASTEqual are written
+// differently.
+func DumpAST(root ASTNode, w io.Writer, opts ...dumpOption) error {
+	d := &dumper{}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	d.dump(root, 0)
+
+	_, err := w.Write(d.buffer.Bytes())
+	return err
+}
+
+func (d *dumper) dump(node ASTNode, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	if line := d.inline(node); len(node.Children) == 0 ||
+		len(indent)+len(line) <= dumpWidth {
+		d.buffer.WriteString(indent + line + "\n")
+		return
+	}
+
+	d.buffer.WriteString(indent + "(" + d.head(node) + "\n")
+
+	for _, child := range node.Children {
+		d.dump(child, depth+1)
+	}
+
+	// Close the list at the end of the last child's line, Lisp-style.
+	d.buffer.Truncate(d.buffer.Len() - 1)
+	d.buffer.WriteString(")\n")
+}
+
+// inline returns the representation of a node on a single line.
+func (d *dumper) inline(node ASTNode) string {
+	if node.Literal == nil && len(node.Children) == 0 {
+		return d.head(node)
+	}
+
+	elements := []string{d.head(node)}
+	for _, child := range node.Children {
+		elements = append(elements, d.inline(child))
+	}
+
+	return "(" + strings.Join(elements, " ") + ")"
+}
+
+// head returns the representation of a node without its children.
+func (d *dumper) head(node ASTNode) string {
+	head := strings.TrimSuffix(node.Type.String(), "Node")
+
+	if d.sourceContext && node.SourceContext.Line > 0 {
+		head += fmt.Sprintf(
+			"@%d:%d", node.SourceContext.Line, node.SourceContext.Column,
+		)
+	}
+
+	if node.Literal != nil {
+		head += " " + dumpLiteral(node)
+	}
+
+	return head
+}
+
+func dumpLiteral(node ASTNode) string {
+	switch literal := node.Literal.(type) {
+	case int32: // NB: rune is an alias for int32
+		if node.Type == NoteLetterNode {
+			return string(literal)
+		}
+
+		return strconv.FormatInt(int64(literal), 10)
+
+	case float64:
+		text := strconv.FormatFloat(literal, 'f', -1, 64)
+		if !strings.ContainsAny(text, ".NI") {
+			text += ".0"
+		}
+
+		return text
+
+	case string:
+		return strconv.Quote(literal)
+
+	default:
+		return fmt.Sprintf("%T(%v)", literal, literal)
+	}
+}
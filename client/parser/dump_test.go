@@ -0,0 +1,185 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+type dumpTestCase struct {
+	label    string
+	given    string
+	opts     []dumpOption
+	expected string
+}
+
+func executeDumpTestCases(t *testing.T, testCases ...dumpTestCase) {
+	for _, testCase := range testCases {
+		ast, err := Parse("piece.alda", testCase.given)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		buffer := bytes.Buffer{}
+		if err := DumpAST(ast, &buffer, testCase.opts...); err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if actual := buffer.String(); actual != testCase.expected {
+			t.Error(testCase.label)
+			t.Errorf("expected:\n%s\nactual:\n%s", testCase.expected, actual)
+		}
+
+		// The dump must not depend on anything but the AST.
+		again := bytes.Buffer{}
+		if err := DumpAST(ast, &again, testCase.opts...); err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if again.String() != buffer.String() {
+			t.Error(testCase.label)
+			t.Error("expected the dump to be deterministic")
+		}
+	}
+}
+
+func TestDumpAST(t *testing.T) {
+	executeDumpTestCases(
+		t,
+		dumpTestCase{
+			label:    "empty score",
+			given:    "",
+			expected: "Root\n",
+		},
+		dumpTestCase{
+			label: "note with an accidental and a duration",
+			given: "c+4",
+			expected: `(Root
+  (ImplicitPart
+    (EventSequence
+      (Note
+        (NoteLetterAndAccidentals (NoteLetter c) (NoteAccidentals Sharp))
+        (Duration (NoteLength (Denominator 4.0)))))))
+`,
+		},
+		dumpTestCase{
+			label: "note with source positions",
+			given: "c+4",
+			opts:  []dumpOption{DumpSourceContext},
+			expected: `(Root@1:1
+  (ImplicitPart@1:1
+    (EventSequence@1:1
+      (Note@1:1
+        (NoteLetterAndAccidentals@1:1
+          (NoteLetter@1:1 c)
+          (NoteAccidentals@1:2 Sharp@1:2))
+        (Duration@1:3 (NoteLength@1:3 (Denominator@1:3 4.0)))))))
+`,
+		},
+		dumpTestCase{
+			label: "part with chords, barlines, crams and repeats",
+			given: `piano: o4 c/e/>g | {c d}2 [e f]*2`,
+			expected: `(Root
+  (Part
+    (PartDeclaration (PartNames (PartName "piano")))
+    (EventSequence
+      (OctaveSet 4)
+      (Chord
+        (Note (NoteLetterAndAccidentals (NoteLetter c)))
+        (Note (NoteLetterAndAccidentals (NoteLetter e)))
+        OctaveUp
+        (Note (NoteLetterAndAccidentals (NoteLetter g))))
+      Barline
+      (Cram
+        (EventSequence
+          (Note (NoteLetterAndAccidentals (NoteLetter c)))
+          (Note (NoteLetterAndAccidentals (NoteLetter d))))
+        (Duration (NoteLength (Denominator 2.0))))
+      (Repeat
+        (EventSequence
+          (Note (NoteLetterAndAccidentals (NoteLetter e)))
+          (Note (NoteLetterAndAccidentals (NoteLetter f))))
+        (Times 2)))))
+`,
+		},
+		dumpTestCase{
+			label: "variables and voices",
+			given: `riff = c d
+violin "v":
+  V1: riff V2: r8 V0: riff`,
+			expected: `(Root
+  (ImplicitPart
+    (EventSequence
+      (VariableDefinition
+        (VariableName "riff")
+        (EventSequence
+          (Note (NoteLetterAndAccidentals (NoteLetter c)))
+          (Note (NoteLetterAndAccidentals (NoteLetter d)))))))
+  (Part
+    (PartDeclaration (PartNames (PartName "violin")) (PartAlias "v"))
+    (EventSequence
+      (VoiceGroup
+        (Voice (VoiceNumber 1) (EventSequence (VariableReference "riff")))
+        (Voice
+          (VoiceNumber 2)
+          (EventSequence (Rest (Duration (NoteLength (Denominator 8.0))))))
+        VoiceGroupEndMarker)
+      (VariableReference "riff"))))
+`,
+		},
+		dumpTestCase{
+			label: "lisp forms",
+			given: `(key-sig '(e (flat))) (print "say \"hi\"" 1.5)`,
+			expected: `(Root
+  (ImplicitPart
+    (EventSequence
+      (LispList
+        (LispSymbol "key-sig")
+        (LispQuotedForm
+          (LispList (LispSymbol "e") (LispList (LispSymbol "flat")))))
+      (LispList (LispSymbol "print") (LispString "say \"hi\"") (LispNumber 1.5)))))
+`,
+		},
+	)
+}
+
+func TestDumpASTLiteralTypes(t *testing.T) {
+	ast := implicitPart(
+		ASTNode{Type: LispListNode, Children: []ASTNode{
+			{Type: LispSymbolNode, Literal: "f"},
+			{Type: LispNumberNode, Literal: int32(1)},
+			{Type: LispNumberNode, Literal: int64(2)},
+			{Type: LispNumberNode, Literal: 3},
+			{Type: LispNumberNode, Literal: 4.0},
+			{Type: LispNumberNode, Literal: -0.5},
+		}},
+	)
+
+	buffer := bytes.Buffer{}
+	if err := DumpAST(ast, &buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `(Root
+  (ImplicitPart
+    (EventSequence
+      (LispList
+        (LispSymbol "f")
+        (LispNumber 1)
+        (LispNumber int64(2))
+        (LispNumber int(3))
+        (LispNumber 4.0)
+        (LispNumber -0.5)))))
+`
+
+	if actual := buffer.String(); actual != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,23 @@
+package parser
+
+// dynamicMarkings are the dynamic markings that can be written as events (see
+// DynamicNode), e.g. `mf`. They're a subset of those that alda-lisp supports
+// (see model.DynamicVolumes), which can be written as Lisp forms, e.g. `(mf)`.
+//
+// NB: `f` is not among them, because it's a note. Forte must be written as a
+// Lisp form, i.e. `(f)`.
+var dynamicMarkings = map[string]bool{
+	"ppp": true,
+	"pp":  true,
+	"p":   true,
+	"mp":  true,
+	"mf":  true,
+	"ff":  true,
+	"fff": true,
+}
+
+// isDynamicMarking returns true if the name is a dynamic marking that can be
+// written as an event, e.g. `mf`.
+func isDynamicMarking(name string) bool {
+	return dynamicMarkings[name]
+}
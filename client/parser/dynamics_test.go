@@ -0,0 +1,201 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+func dynamicMarking(marking string) model.AttributeUpdate {
+	return model.AttributeUpdate{
+		PartUpdate: model.DynamicMarking{Marking: marking},
+	}
+}
+
+func letterNote(letter model.NoteLetter) model.Note {
+	return model.Note{Pitch: model.LetterAndAccidentals{NoteLetter: letter}}
+}
+
+func TestDynamics(t *testing.T) {
+	executeParseTestCases(
+		t,
+		parseTestCase{
+			label: "dynamic markings",
+			given: "piano: ppp c pp c p c mp c mf c ff c fff c",
+			expectUpdates: []model.ScoreUpdate{
+				model.PartDeclaration{Names: []string{"piano"}},
+				dynamicMarking("ppp"), letterNote(model.C),
+				dynamicMarking("pp"), letterNote(model.C),
+				dynamicMarking("p"), letterNote(model.C),
+				dynamicMarking("mp"), letterNote(model.C),
+				dynamicMarking("mf"), letterNote(model.C),
+				dynamicMarking("ff"), letterNote(model.C),
+				dynamicMarking("fff"), letterNote(model.C),
+			},
+		},
+		parseTestCase{
+			label: "dynamic markings next to other events",
+			given: "piano: [p c]*2 | {mf d e}4 p",
+			expectUpdates: []model.ScoreUpdate{
+				model.PartDeclaration{Names: []string{"piano"}},
+				repeat(eventSequence(dynamicMarking("p"), letterNote(model.C)), 2),
+				model.Barline{},
+				model.Cram{
+					Events: []model.ScoreUpdate{
+						dynamicMarking("mf"),
+						letterNote(model.D),
+						letterNote(model.E),
+					},
+					Duration: model.Duration{
+						Components: []model.DurationComponent{
+							model.NoteLength{Denominator: 4},
+						},
+					},
+				},
+				dynamicMarking("p"),
+			},
+		},
+		parseTestCase{
+			label: "f is a note, not a dynamic marking",
+			given: "piano: f (f)",
+			expectUpdates: []model.ScoreUpdate{
+				model.PartDeclaration{Names: []string{"piano"}},
+				letterNote(model.F),
+				lispList(lispSymbol("f")),
+			},
+		},
+		parseTestCase{
+			label: "variable named like a dynamic marking",
+			given: "mf = c d\npiano: mf",
+			expectUpdates: []model.ScoreUpdate{
+				variableDefinition("mf", letterNote(model.C), letterNote(model.D)),
+				model.PartDeclaration{Names: []string{"piano"}},
+				variableReference("mf"),
+			},
+		},
+	)
+}
+
+func TestDynamicsShadowedByVariables(t *testing.T) {
+	warnings := []*model.AldaSourceError{}
+
+	ast, err := Parse(
+		"piece.alda",
+		"piano: mf c\nmf = d\npiano: mf c",
+		CollectWarnings(&warnings),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := ast.Children[0].Children[1].Children
+	if events[0].Type != DynamicNode {
+		t.Errorf(
+			"expected a DynamicNode before the definition, got %s", events[0].Type,
+		)
+	}
+
+	events = ast.Children[1].Children[1].Children
+	if events[0].Type != VariableReferenceNode {
+		t.Errorf(
+			"expected a VariableReferenceNode after the definition, got %s",
+			events[0].Type,
+		)
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d: %v", len(warnings), warnings)
+	}
+
+	expected := "piece.alda:3:8 mf refers to the variable mf, not the dynamic " +
+		"marking; use (mf) for the dynamic marking"
+	if actual := warnings[0].Error(); actual != expected {
+		t.Errorf("expected warning: %s\nactual warning: %s", expected, actual)
+	}
+}
+
+func TestFormatDynamics(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "dynamic markings are written verbatim",
+			given:    "piano: pp c  mf   d\n  fff e",
+			expected: "piano:\n  pp c mf d fff e\n",
+		},
+	)
+
+	// An AST might not have been parsed, so a dynamic marking can follow the
+	// definition of a variable of the same name. It has to be written as a Lisp
+	// form, so that it doesn't parse as a reference to the variable.
+	ast := implicitPart(
+		ASTNode{Type: VariableDefinitionNode, Children: []ASTNode{
+			{Type: VariableNameNode, Literal: "mf"},
+			{Type: EventSequenceNode, Children: []ASTNode{{
+				Type: NoteNode,
+				Children: []ASTNode{{
+					Type:     NoteLetterAndAccidentalsNode,
+					Children: []ASTNode{{Type: NoteLetterNode, Literal: 'c'}},
+				}},
+			}}},
+		}},
+		ASTNode{Type: DynamicNode, Literal: "mf"},
+	)
+
+	buffer := bytes.Buffer{}
+	if err := FormatASTToCode(ast, &buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, actual := "mf = c\n(mf)\n", buffer.String(); actual != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+
+	executeFormatErrorTestCases(t, formatErrorTestCase{
+		label:    "unknown dynamic marking",
+		given:    implicitPart(ASTNode{Type: DynamicNode, Literal: "mff"}),
+		expected: `invalid dynamic marking: "mff"`,
+	})
+}
+
+func TestDynamicsVolume(t *testing.T) {
+	ast, err := Parse("piece.alda", "piano: c pp c mf c fff c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates, err := ast.Updates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score := model.NewScore()
+	if err := score.Update(updates...); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []float64{
+		model.DynamicVolumes["mf"], // the default
+		model.DynamicVolumes["pp"],
+		model.DynamicVolumes["mf"],
+		model.DynamicVolumes["fff"],
+	}
+
+	if len(score.Events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(score.Events))
+	}
+
+	for i, event := range score.Events {
+		note, ok := event.(model.NoteEvent)
+		if !ok {
+			t.Fatalf("expected a NoteEvent, got %#v", event)
+		}
+
+		if note.Volume != expected[i] {
+			t.Errorf(
+				"note %d: expected volume %f, got %f", i, expected[i], note.Volume,
+			)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+func nodeTypes(nodes []ASTNode) []ASTNodeType {
+	types := []ASTNodeType{}
+	for _, node := range nodes {
+		types = append(types, node.Type)
+	}
+
+	return types
+}
+
+// When parsing fails, the AST is still returned, with an ErrorNode in place of
+// each construct that couldn't be parsed.
+func TestErrorNodes(t *testing.T) {
+	for _, testCase := range []struct {
+		label string
+		given string
+		// The types of the events of the first part
+		expectEvents []ASTNodeType
+		// The ErrorNode among the events
+		expectError ASTNode
+	}{
+		{
+			label: "unexpected token in the middle of a part",
+			given: "piano: c d ) e | f g",
+			expectEvents: []ASTNodeType{
+				NoteNode, NoteNode, ErrorNode, NoteNode, NoteNode,
+			},
+			expectError: ASTNode{
+				Type: ErrorNode,
+				SourceContext: model.AldaSourceContext{
+					Filename: "piece.alda", Line: 1, Column: 12, Offset: 11,
+				},
+				Literal:    "Unexpected close parenthesis `)` in inner events",
+				SourceText: ") e |",
+			},
+		},
+		{
+			label: "malformed S-expression",
+			given: "piano: c d (vol ]) | e f",
+			expectEvents: []ASTNodeType{
+				NoteNode, NoteNode, ErrorNode, NoteNode, NoteNode,
+			},
+			expectError: ASTNode{
+				Type: ErrorNode,
+				SourceContext: model.AldaSourceContext{
+					Filename: "piece.alda", Line: 1, Column: 17, Offset: 16,
+				},
+				Literal:    "Unexpected end of event sequence `]` in S-expression",
+				SourceText: "(vol ]) |",
+			},
+		},
+	} {
+		ast, err := Parse("piece.alda", testCase.given)
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.label)
+			continue
+		}
+
+		if _, ok := err.(*ParseErrors); !ok {
+			t.Errorf("%s: expected *ParseErrors, got %T", testCase.label, err)
+		}
+
+		if len(ast.Children) == 0 {
+			t.Errorf("%s: expected a partial AST, got %#v", testCase.label, ast)
+			continue
+		}
+
+		events := ast.Children[0].Children[1].Children
+
+		actual := nodeTypes(events)
+		if !reflect.DeepEqual(actual, testCase.expectEvents) {
+			t.Errorf(
+				"%s\nexpected events: %v\nactual events: %v",
+				testCase.label, testCase.expectEvents, actual,
+			)
+			continue
+		}
+
+		for _, event := range events {
+			if event.Type != ErrorNode {
+				continue
+			}
+
+			if !ASTEqual(event, testCase.expectError) {
+				t.Errorf(
+					"%s\nexpected: %#v\nactual: %#v",
+					testCase.label, testCase.expectError, event,
+				)
+			}
+		}
+	}
+}
+
+// An error at the top level, e.g. in a part declaration, is replaced by an
+// ErrorNode among the parts.
+func TestTopLevelErrorNode(t *testing.T) {
+	ast, err := Parse("piece.alda", "piano: c d\nviolin \"v\" \"w\": e\ncello: f")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	actual := nodeTypes(ast.Children)
+	expected := []ASTNodeType{PartNode, ErrorNode, PartNode}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected parts: %v\nactual parts: %v", expected, actual)
+	}
+
+	expectedText := "violin \"v\" \"w\": e"
+	if actual := ast.Children[1].SourceText; actual != expectedText {
+		t.Errorf("expected source text: %q\nactual: %q", expectedText, actual)
+	}
+}
+
+// ErrorNodes are reported as syntax errors when validating or interpreting the
+// AST, or formatting it, unless the formatter is configured to preserve them.
+func TestErrorNodeDiagnostics(t *testing.T) {
+	given := "piano: c d ) e | f g"
+	ast, _ := Parse("piece.alda", given)
+
+	problems := ValidateAST(ast)
+	if len(problems) != 1 {
+		t.Fatalf("expected 1 problem, got %d: %v", len(problems), problems)
+	}
+
+	expectedProblem := "piece.alda:1:12 RootNode/PartNode/EventSequenceNode/" +
+		"ErrorNode: syntax error: Unexpected close parenthesis `)` in inner events"
+	if actual := problems[0].Error(); actual != expectedProblem {
+		t.Errorf(
+			"expected problem: %s\nactual problem: %s", expectedProblem, actual,
+		)
+	}
+
+	if _, err := ast.Updates(); err == nil ||
+		!strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("expected a syntax error from Updates, got %v", err)
+	}
+
+	buffer := bytes.Buffer{}
+	if err := FormatASTToCode(ast, &buffer); err == nil {
+		t.Errorf("expected formatting to fail, got %q", buffer.String())
+	}
+
+	buffer.Reset()
+	if err := FormatASTToCode(
+		ast, &buffer, ConfigurePreserveErrors(true),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "piano:\n  c d ) e | f g\n"
+	if actual := buffer.String(); actual != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+func TestParseErrorRecovery(t *testing.T) {
+	_, err := Parse("piece.alda", `piano:
+  c d : e
+  f g = a
+  b *x c`)
+
+	var parseErrors *ParseErrors
+	if !errors.As(err, &parseErrors) {
+		t.Fatalf("expected *ParseErrors, got %#v", err)
+	}
+
+	expected := []string{
+		"piece.alda:2:7 Unexpected colon `:` in inner events",
+		"piece.alda:3:7 Unexpected equals sign `=` in inner events",
+		"piece.alda:4:6 Unexpected 'x' in repeat",
+	}
+
+	if len(parseErrors.Errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %d:\n%s",
+			len(expected), len(parseErrors.Errors), parseErrors.Error())
+	}
+
+	for i, err := range parseErrors.Errors {
+		if err.Error() != expected[i] {
+			t.Errorf("expected: %s\nactual: %s", expected[i], err.Error())
+		}
+	}
+
+	// Callers that are only interested in a single error get the first one.
+	var sourceError *model.AldaSourceError
+	if !errors.As(err, &sourceError) || sourceError.Error() != expected[0] {
+		t.Errorf("expected the first error to be %s", expected[0])
+	}
+}
+
+func TestParseErrorRecoveryAcrossParts(t *testing.T) {
+	_, err := Parse("piece.alda", `piano: c | : d
+violin/: e
+cello: f`)
+
+	var parseErrors *ParseErrors
+	if !errors.As(err, &parseErrors) {
+		t.Fatalf("expected *ParseErrors, got %#v", err)
+	}
+
+	expected := []string{
+		"piece.alda:1:12 Unexpected colon `:` in inner events",
+		"piece.alda:2:8 Unexpected colon `:` in part declaration",
+	}
+
+	if len(parseErrors.Errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %d:\n%s",
+			len(expected), len(parseErrors.Errors), parseErrors.Error())
+	}
+
+	for i, err := range parseErrors.Errors {
+		if err.Error() != expected[i] {
+			t.Errorf("expected: %s\nactual: %s", expected[i], err.Error())
+		}
+	}
+}
+
+func TestParseErrorCap(t *testing.T) {
+	input := "piano:"
+	for i := 0; i < 2*maxErrors; i++ {
+		input += "\n  c :"
+	}
+
+	_, err := Parse("piece.alda", input)
+
+	var parseErrors *ParseErrors
+	if !errors.As(err, &parseErrors) {
+		t.Fatalf("expected *ParseErrors, got %#v", err)
+	}
+
+	if len(parseErrors.Errors) != maxErrors || !parseErrors.Truncated {
+		t.Errorf(
+			"expected errors to be capped at %d, got %d (truncated: %v)",
+			maxErrors, len(parseErrors.Errors), parseErrors.Truncated,
+		)
+	}
+}
+
+// Errors are only reported as truncated if there are more of them than are
+// reported, whether they're found by the scanner or the parser.
+func TestParseErrorCapTruncated(t *testing.T) {
+	for _, testCase := range []struct {
+		line      string
+		errors    int
+		truncated bool
+	}{
+		{"\n  c :", maxErrors, false},
+		{"\n  c :", maxErrors + 1, true},
+		{"\né", maxErrors, false},
+		{"\né", maxErrors + 1, true},
+	} {
+		input := "piano:" + strings.Repeat(testCase.line, testCase.errors) + "\n"
+
+		_, err := Parse("piece.alda", input)
+
+		var parseErrors *ParseErrors
+		if !errors.As(err, &parseErrors) {
+			t.Fatalf("expected *ParseErrors, got %#v", err)
+		}
+
+		if len(parseErrors.Errors) != maxErrors ||
+			parseErrors.Truncated != testCase.truncated {
+			t.Errorf(
+				"%d x %q: expected %d errors (truncated: %v), got %d (truncated: %v)",
+				testCase.errors, testCase.line, maxErrors, testCase.truncated,
+				len(parseErrors.Errors), parseErrors.Truncated,
+			)
+		}
+
+		tooMany := strings.HasSuffix(err.Error(), "too many errors")
+		if tooMany != testCase.truncated {
+			t.Errorf("%d x %q: unexpected error: %s", testCase.errors,
+				testCase.line, err)
+		}
+	}
+}
+
+func TestParseAliasErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		given    string
+		expected string
+	}{
+		{`piano "": c`, "piece.alda:1:7 Empty alias"},
+		{`piano " : c`, "piece.alda:1:8 Unexpected ' ' in alias"},
+		{`piano "pno :`, "piece.alda:1:11 Unexpected ' ' in alias"},
+	} {
+		_, err := Parse("piece.alda", testCase.given)
+
+		var parseErrors *ParseErrors
+		if !errors.As(err, &parseErrors) {
+			t.Errorf("%s: expected *ParseErrors, got %#v", testCase.given, err)
+			continue
+		}
+
+		if actual := parseErrors.Errors[0].Error(); actual != testCase.expected {
+			t.Errorf(
+				"%s:\nexpected: %s\nactual: %s",
+				testCase.given, testCase.expected, actual,
+			)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package parser
+
+import (
+	"math"
+	"strings"
+
+	"alda.io/client/model"
+)
+
+// ExpandMultiMeasureRests returns a copy of the AST where each multi-measure
+// rest is replaced with the equivalent rests, one measure long each and
+// separated by barlines, e.g. `R*2` in 3/4 becomes `r2. | r2.`. The original
+// AST is left unchanged.
+//
+// The length of a measure depends on the time signature in effect where the
+// rest is written. The time signatures are tracked in the order that the score
+// is written, per part, which accounts for the time signature shorthand (e.g.
+// `3/4`) and for attribute changes with a literal time signature, e.g.
+// `(time-signature '(3 4))` or `(time-sig! '(6 8))`. Other time signature
+// changes (e.g. those that use a variable) aren't accounted for.
+func ExpandMultiMeasureRests(root ASTNode) ASTNode {
+	expanded := root.Clone()
+
+	tracker := &timeSignatureTracker{
+		current: model.DefaultTimeSignature,
+		global:  model.DefaultTimeSignature,
+		parts:   map[string]model.TimeSignature{},
+	}
+	tracker.expand(&expanded)
+
+	return expanded
+}
+
+// timeSignatureTracker keeps track of the time signature of each part while
+// walking an AST in the order that it's written.
+type timeSignatureTracker struct {
+	// The time signature of the current part
+	current model.TimeSignature
+	// The time signature of parts that haven't been declared yet
+	global model.TimeSignature
+	// The time signature of each part, keyed by its alias or names
+	parts map[string]model.TimeSignature
+	// The key of the current part, or "" for the implicit part
+	part string
+}
+
+func (t *timeSignatureTracker) enterPart(key string) {
+	t.part = key
+
+	if timeSig, ok := t.parts[key]; ok {
+		t.current = timeSig
+	} else {
+		t.current = t.global
+	}
+}
+
+func (t *timeSignatureTracker) set(timeSig model.TimeSignature, global bool) {
+	if global {
+		t.global = timeSig
+		for key := range t.parts {
+			t.parts[key] = timeSig
+		}
+	}
+
+	t.current = timeSig
+	t.parts[t.part] = timeSig
+}
+
+func (t *timeSignatureTracker) expand(node *ASTNode) {
+	switch node.Type {
+	case PartNode:
+		if len(node.Children) > 0 {
+			t.enterPart(partKey(node.Children[0]))
+		}
+
+	case TimeSignatureNode:
+		if timeSig, err := timeSignature(*node); err == nil {
+			t.set(timeSig, false)
+		}
+
+	case LispListNode:
+		if timeSig, global, ok := lispTimeSignature(*node); ok {
+			t.set(timeSig, global)
+		}
+	}
+
+	if node.Children == nil {
+		return
+	}
+
+	children := []ASTNode{}
+
+	for i := range node.Children {
+		child := node.Children[i]
+
+		if child.Type != MultiMeasureRestNode {
+			t.expand(&child)
+			children = append(children, child)
+			continue
+		}
+
+		rests := t.measureRests(child)
+
+		// Where a single event is expected (e.g. the event of a repeat), the rests
+		// are wrapped in an event sequence.
+		if node.Type == EventSequenceNode {
+			children = append(children, rests...)
+		} else {
+			children = append(children, ASTNode{
+				Type:          EventSequenceNode,
+				SourceContext: child.SourceContext,
+				Children:      rests,
+			})
+		}
+	}
+
+	node.Children = children
+}
+
+// measureRests returns the rests equivalent to a multi-measure rest in the
+// current time signature.
+func (t *timeSignatureTracker) measureRests(node ASTNode) []ASTNode {
+	duration := ASTNode{
+		Type:          DurationNode,
+		SourceContext: node.SourceContext,
+		Children: simplifyDurationComponents(
+			noteLengthsForBeats(t.current.MeasureBeats(), node.SourceContext),
+		),
+	}
+
+	rests := []ASTNode{}
+
+	measures, _ := node.Literal.(int32)
+	for i := int32(0); i < measures; i++ {
+		if i > 0 {
+			rests = append(rests, ASTNode{
+				Type:          BarlineNode,
+				SourceContext: node.SourceContext,
+			})
+		}
+
+		rests = append(rests, ASTNode{
+			Type:          RestNode,
+			SourceContext: node.SourceContext,
+			Children:      []ASTNode{duration.Clone()},
+		})
+	}
+
+	return rests
+}
+
+// noteLengthsForBeats returns undotted note lengths with power-of-2
+// denominators that last the given number of beats when tied together, from
+// longest to shortest.
+func noteLengthsForBeats(
+	beats float64, sourceContext model.AldaSourceContext,
+) []ASTNode {
+	noteLengths := []ASTNode{}
+
+	for beats > 0 {
+		_, exp := math.Frexp(beats)
+		noteLengthBeats := math.Ldexp(1, exp-1)
+
+		noteLength, _ := noteLengthForBeats(noteLengthBeats, sourceContext)
+		noteLengths = append(noteLengths, noteLength)
+
+		beats -= noteLengthBeats
+	}
+
+	return noteLengths
+}
+
+// partKey returns the key that identifies the part of a PartDeclarationNode,
+// i.e. its alias, if it has one, or its names.
+func partKey(decl ASTNode) string {
+	if len(decl.Children) > 1 {
+		if alias, ok := decl.Children[1].Literal.(string); ok {
+			return alias
+		}
+	}
+
+	names := []string{}
+	if len(decl.Children) > 0 {
+		for _, name := range decl.Children[0].Children {
+			if name, ok := name.Literal.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return strings.Join(names, "/")
+}
+
+// lispTimeSignature returns the time signature set by a Lisp list, if it's a
+// time signature attribute change with a literal time signature, e.g.
+// `(time-signature '(3 4))`, and whether the change is global.
+func lispTimeSignature(node ASTNode) (model.TimeSignature, bool, bool) {
+	if len(node.Children) != 2 || node.Children[0].Type != LispSymbolNode {
+		return model.TimeSignature{}, false, false
+	}
+
+	name, _ := node.Children[0].Literal.(string)
+	global := strings.HasSuffix(name, "!")
+
+	switch strings.TrimSuffix(name, "!") {
+	case "time-signature", "time-sig":
+	default:
+		return model.TimeSignature{}, false, false
+	}
+
+	quoted := node.Children[1]
+	if quoted.Type != LispQuotedFormNode || len(quoted.Children) != 1 {
+		return model.TimeSignature{}, false, false
+	}
+
+	list := quoted.Children[0]
+	if list.Type != LispListNode || len(list.Children) != 2 {
+		return model.TimeSignature{}, false, false
+	}
+
+	numbers := []int32{}
+	for _, child := range list.Children {
+		number, ok := child.Literal.(float64)
+		if child.Type != LispNumberNode || !ok || number != math.Trunc(number) {
+			return model.TimeSignature{}, false, false
+		}
+
+		numbers = append(numbers, int32(number))
+	}
+
+	timeSig := model.TimeSignature{Numerator: numbers[0], Denominator: numbers[1]}
+	if timeSig.Validate() != nil {
+		return model.TimeSignature{}, false, false
+	}
+
+	return timeSig, global, true
+}
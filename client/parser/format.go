@@ -2,10 +2,17 @@ package parser
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+
+	log "alda.io/client/logging"
 )
 
 type varDefState int
@@ -22,11 +29,100 @@ type formatter struct {
 	varDef      varDefState // state to handle formatting variable definitions
 	indentLevel int         // state for indentation level
 	texts       []string    // buffer of "tokens" for the ongoing formatted line
+	lineNumber  int         // number of lines written to the output so far
+	minified    bool        // configured to emit minimal whitespace
+	singleLine  bool        // formatting a single line (see inlineText)
+	overflowed  bool        // the single line exceeded softWrapLen
 	out         io.Writer
+
+	// Optional callback for lines that exceed softWrapLen
+	overflowReporter func(line int, length int)
+	// Optional callback for each line written (see ConfigureLineCallback)
+	lineCallback func(lineNo int, text string, nodes []ASTNode)
+	// When lineCallback is set, the node that produced each of texts, or nil
+	textNodes []*ASTNode
+	// When lineCallback is set, the node being formatted, or nil
+	node *ASTNode
+	// Length beyond which a formatted line is an error, or 0 for no limit
+	maxLineWidth int
+	// Whether to write every line unindented, regardless of nesting
+	noIndent bool
+	// Whether to detect indentText from the original source, when available
+	detectIndent bool
+	// Whether to end the output with a newline
+	trailingNewline bool
+	// Whether to re-emit the original spelling of literals, when available
+	preserveLiterals bool
+	// Whether to write the raw text of ErrorNodes, rather than failing
+	preserveErrors bool
+	// Whether to replace tied note lengths with dotted ones (see
+	// SimplifyDurations)
+	simplifyDurations bool
+	// How to write the arguments of key signature attribute changes
+	keySignatureStyle KeySignatureStyle
+	// Whether to respell notes whose accidentals go against the key signature
+	// (see RespellNotes)
+	respellNotes bool
+	// How to write the notes of percussion parts when respelling notes
+	drumNameStyle DrumNameStyle
+	// The version of Alda whose syntax to write, or 0 to write constructs whose
+	// syntax differs between versions as they are
+	syntaxVersion SyntaxVersion
+	// The name of the part under which to write a leading implicit part, or ""
+	// to write it at the top level
+	implicitPartName string
+	// The whitespace between texts on a line
+	tokenSeparator string
+	// Whether to line up the barlines of consecutive lines in columns
+	alignBarlines bool
+	// Whether to separate the `*N` of a repeat from the repeated event
+	repeatSpacing bool
+	// Whether to separate the `/` between the names of a part from the names
+	partGroupSpacing bool
+	// The number of levels that constructs can be nested (see
+	// DefaultMaxNestingDepth)
+	maxNestingDepth int
+	// Whether to leave extra space between beat groups (see
+	// ConfigureBeatGrouping)
+	beatGrouping bool
+	// When non-nil, where the events of each part fall within the measure
+	beats *beatGrouper
+	// Line length within which a part is written on a single line along with its
+	// declaration, or 0 to always indent a part's events on separate lines
+	inlineShortParts int
+
+	// When non-nil, the source line from which each line of output was
+	// formatted, or 0 if unknown (see FormatASTWithComments)
+	sourceLines []int
+	// The source line of the node being formatted
+	sourceLine int
+	// The source line of the first text on the current line
+	lineSourceLine int
+	// The source lines of the standalone comments that haven't been passed yet,
+	// in order (see breakForComments)
+	commentLines []int
+	// The names of the variables defined so far
+	variables map[string]bool
+	// The context whose cancellation aborts formatting (see
+	// FormatASTToCodeContext)
+	ctx context.Context
 }
 
 type formatterOption func(*formatter)
 
+const (
+	// DefaultSoftWrap is the line length beyond which the formatter wraps
+	// lines, unless configured otherwise via ConfigureSoftWrapLen.
+	DefaultSoftWrap = 80
+	// DefaultIndentText is the text that the formatter indents lines with,
+	// unless configured otherwise via ConfigureIndentText.
+	DefaultIndentText = "  "
+	// DefaultTokenSeparator is the whitespace that the formatter writes between
+	// the tokens on a line, unless configured otherwise via
+	// ConfigureTokenSeparator.
+	DefaultTokenSeparator = " "
+)
+
 func ConfigureSoftWrapLen(len int) func(*formatter) {
 	return func(f *formatter) {
 		f.softWrapLen = len
@@ -39,14 +135,344 @@ func ConfigureIndentText(text string) func(*formatter) {
 	}
 }
 
+// ConfigureTokenSeparator configures the whitespace that the formatter writes
+// between the tokens on a line, e.g. two spaces for "double-spaced" output. The
+// separator must consist of one or more spaces, otherwise formatting fails.
+// (Tabs aren't allowed, as Alda doesn't allow a tab after a note, so the output
+// couldn't be parsed.) Minified output isn't affected.
+func ConfigureTokenSeparator(separator string) func(*formatter) {
+	return func(f *formatter) {
+		f.tokenSeparator = separator
+	}
+}
+
+// ConfigureMaxNestingDepth configures the number of levels that event
+// sequences, cram expressions and Lisp forms can be nested within one another
+// in the AST being formatted, instead of DefaultMaxNestingDepth. A more deeply
+// nested AST is an error.
+func ConfigureMaxNestingDepth(depth int) func(*formatter) {
+	return func(f *formatter) {
+		f.maxNestingDepth = depth
+	}
+}
+
+// ConfigureOverflowReporter registers a callback that is invoked for each
+// formatted line that exceeds the soft wrap length, e.g. a long Lisp list that
+// cannot be wrapped, or a Lisp list with a long string argument, such as
+// lyrics, which is never broken up. The callback receives the 1-based line
+// number and length.
+func ConfigureOverflowReporter(reporter func(line int, length int)) func(*formatter) {
+	return func(f *formatter) {
+		f.overflowReporter = reporter
+	}
+}
+
+// ConfigureLineCallback registers a callback that is invoked for each line
+// of formatted output as it's written, e.g. to map the lines back to the AST
+// (a "source map"). The callback receives the 1-based line number, the text of
+// the line without its newline, and the nodes that the line was formatted
+// from, in order, which is best-effort: a text that is formatted from a node
+// and its children at once, like a short cram expression, is attributed to the
+// node, and the blank lines between parts have no nodes at all. The lines are
+// as the formatter writes them, i.e. before barlines are aligned (see
+// ConfigureBarlineAlignment).
+func ConfigureLineCallback(
+	callback func(lineNo int, text string, nodes []ASTNode),
+) func(*formatter) {
+	return func(f *formatter) {
+		f.lineCallback = callback
+	}
+}
+
+// ConfigureMaxLineWidth configures a hard limit on the length of formatted
+// lines. Unlike the soft wrap length, which the formatter tries to keep within,
+// the limit is enforced: if any line of the output is longer than the limit
+// (e.g. because it contains a long Lisp list, which can't be wrapped),
+// formatting fails with a *LineWidthError listing the offending lines, and
+// nothing is written. Like the soft wrap length, the length of a line is its
+// length in bytes. The default, 0, means no limit.
+func ConfigureMaxLineWidth(width int) func(*formatter) {
+	return func(f *formatter) {
+		f.maxLineWidth = width
+	}
+}
+
+// An OverlongLine is a line of formatted output that exceeds the maximum line
+// width.
+type OverlongLine struct {
+	// Line is the 1-based line number.
+	Line int
+	// Length is the length of the line, in bytes.
+	Length int
+}
+
+// LineWidthError is the error returned when formatted output contains lines
+// that exceed the maximum line width (see ConfigureMaxLineWidth).
+type LineWidthError struct {
+	// MaxLineWidth is the configured maximum line width.
+	MaxLineWidth int
+	// Lines are the overlong lines, in order.
+	Lines []OverlongLine
+}
+
+// Error returns a string representation of the error, listing the overlong
+// lines.
+func (lwe *LineWidthError) Error() string {
+	lines := []string{}
+	for _, line := range lwe.Lines {
+		lines = append(lines, fmt.Sprintf("%d (%d)", line.Line, line.Length))
+	}
+
+	noun := "lines exceed"
+	if len(lwe.Lines) == 1 {
+		noun = "line exceeds"
+	}
+
+	return fmt.Sprintf(
+		"%d %s the maximum line width of %d: line %s",
+		len(lwe.Lines), noun, lwe.MaxLineWidth, strings.Join(lines, ", "),
+	)
+}
+
+// checkLineWidths returns a *LineWidthError if any line of the formatted output
+// exceeds the maximum line width, if one is configured.
+func (f *formatter) checkLineWidths(output []byte) error {
+	if f.maxLineWidth <= 0 {
+		return nil
+	}
+
+	overlong := []OverlongLine{}
+	for i, line := range bytes.Split(output, []byte("\n")) {
+		if len(line) > f.maxLineWidth {
+			overlong = append(overlong, OverlongLine{Line: i + 1, Length: len(line)})
+		}
+	}
+
+	if len(overlong) > 0 {
+		return &LineWidthError{MaxLineWidth: f.maxLineWidth, Lines: overlong}
+	}
+
+	return nil
+}
+
+// ConfigureMinified configures the formatter to emit semantically identical
+// code with minimal whitespace, i.e. no indentation, no wrapping, and spaces
+// only where they are syntactically required. Lines are only broken where
+// required, i.e. after variable definitions.
+func ConfigureMinified(minified bool) func(*formatter) {
+	return func(f *formatter) {
+		f.minified = minified
+	}
+}
+
+// ConfigureNoIndent configures the formatter to write every line without
+// indentation, e.g. for generating snippets of code to be embedded elsewhere.
+// Unlike an empty indent text (see ConfigureIndentText), this also stops the
+// formatter from tracking how deeply each line is nested, so the output is flat
+// even if the indent text is later detected from the source (see
+// ConfigureDetectIndent). Lines are still broken as usual.
+func ConfigureNoIndent(noIndent bool) func(*formatter) {
+	return func(f *formatter) {
+		f.noIndent = noIndent
+	}
+}
+
+// ConfigureDetectIndent configures FormatCode and FormatFile to detect whether
+// the original source is indented with tabs or spaces (and how many), and to
+// indent the formatted output the same way. If the source has no indented
+// lines, the configured indent text is used. This option has no effect on
+// FormatASTToCode, which has no access to the original source.
+func ConfigureDetectIndent(detect bool) func(*formatter) {
+	return func(f *formatter) {
+		f.detectIndent = detect
+	}
+}
+
+// ConfigureTrailingNewline configures whether the formatted output ends with a
+// newline, which it does by default. Omitting the newline is useful when
+// embedding the output in a larger document.
+func ConfigureTrailingNewline(trailingNewline bool) func(*formatter) {
+	return func(f *formatter) {
+		f.trailingNewline = trailingNewline
+	}
+}
+
+// ConfigurePreserveErrors configures the formatter to write the raw text of
+// each ErrorNode (see Parse) verbatim, so that code with syntax errors can be
+// formatted around them. Otherwise, formatting an AST that contains an
+// ErrorNode fails.
+func ConfigurePreserveErrors(preserve bool) func(*formatter) {
+	return func(f *formatter) {
+		f.preserveErrors = preserve
+	}
+}
+
+// ConfigurePreserveLiterals configures the formatter to write each literal
+// (e.g. a note length or a number in a Lisp form) the way it was spelled in the
+// original source code, e.g. `c0.50` rather than `c0.5`, so that formatting is
+// lossless. Literals without source text (e.g. in a generated AST), or whose
+// source text no longer matches their value, are written canonically.
+func ConfigurePreserveLiterals(preserve bool) func(*formatter) {
+	return func(f *formatter) {
+		f.preserveLiterals = preserve
+	}
+}
+
+// ConfigureSimplifyDurations configures the formatter to write tied note
+// lengths as a single dotted note length where that is exactly equivalent,
+// e.g. `c2~4` as `c2.`. See SimplifyDurations.
+func ConfigureSimplifyDurations(simplify bool) func(*formatter) {
+	return func(f *formatter) {
+		f.simplifyDurations = simplify
+	}
+}
+
+// ConfigureKeySignatureStyle configures the formatter to write key signature
+// attribute changes in the given style, e.g. `(key-signature "f+ c+")` rather
+// than `(key-signature '(f (sharp) c (sharp)))`. See NormalizeKeySignatures.
+func ConfigureKeySignatureStyle(style KeySignatureStyle) func(*formatter) {
+	return func(f *formatter) {
+		f.keySignatureStyle = style
+	}
+}
+
+// ConfigureRespellNotes configures the formatter to write notes whose
+// accidentals go against those of the key signature in keeping with it, e.g.
+// `a-` as `g+` in a key with sharps. See RespellNotes. The notes of percussion
+// parts are left as they are, unless configured otherwise via
+// ConfigureDrumNameStyle.
+func ConfigureRespellNotes(respell bool) func(*formatter) {
+	return func(f *formatter) {
+		f.respellNotes = respell
+	}
+}
+
+// ConfigureDrumNameStyle configures how the formatter writes the notes of
+// percussion parts, i.e. parts with a percussion instrument, like
+// `percussion:` or `midi-percussion:`, and parts that refer to them by alias.
+// Their note letters name drums rather than pitches, so by default they're
+// exempt from respelling (see ConfigureRespellNotes).
+func ConfigureDrumNameStyle(style DrumNameStyle) func(*formatter) {
+	return func(f *formatter) {
+		f.drumNameStyle = style
+	}
+}
+
+// ConfigureSyntaxVersion configures the formatter to write constructs whose
+// syntax differs between versions of Alda in the syntax of the given version,
+// e.g. `(key-sig [:g :minor])` for Alda 1 rather than `(key-sig '(g minor))`
+// for Alda 2. See ConvertSyntaxVersion for the constructs that are affected.
+// By default, they're written as they are.
+func ConfigureSyntaxVersion(version SyntaxVersion) func(*formatter) {
+	return func(f *formatter) {
+		f.syntaxVersion = version
+	}
+}
+
+// ConfigureExplicitImplicitPart configures the formatter to write the events
+// at the start of a score that aren't under any part declaration (i.e. the
+// implicit part) under a declaration of the named part instead, e.g. `c d e`
+// becomes `piano: c d e`. Only the leading implicit part is affected.
+// Formatting fails if the name isn't a valid part name, or if the score
+// already declares a part with that name or alias.
+func ConfigureExplicitImplicitPart(name string) func(*formatter) {
+	return func(f *formatter) {
+		f.implicitPartName = name
+	}
+}
+
+// ConfigureBeatGrouping configures the formatter to leave extra space between
+// beat groups within a measure, i.e. an extra token separator (so a double
+// space, by default) before an event that starts a beat in simple meters like
+// 4/4, or a dotted beat in compound meters like 6/8. For example, in 4/4:
+//
+//	c8 d  e f  g a  b > c
+//
+// The meter is tracked from the time signature shorthand (e.g. `3/4`) and from
+// time signature attribute changes with a literal time signature, e.g.
+// `(time-signature '(3 4))`. Parts without a declared meter are formatted with
+// normal spacing, as is minified output. Groups are only marked between the
+// top-level events of a part, and only where the position within the measure
+// can be worked out from the note lengths (see beatGrouper).
+func ConfigureBeatGrouping(group bool) func(*formatter) {
+	return func(f *formatter) {
+		f.beatGrouping = group
+	}
+}
+
+// ConfigureBarlineAlignment configures the formatter to line up the barlines
+// of consecutive lines with the same indentation in columns, by padding the
+// measures before them with spaces, e.g.
+//
+//	riff = c4 d e f | g2 a               | b1
+//	bass = c2 c     | d4 d d d           | e1
+//	lead = c1       | d8 e f g a b > c d | e2 e
+//
+// This is most useful for scores where the lines are regular, e.g. études. So
+// that the lines don't spread out too far, a measure is padded by at most 16
+// spaces, and not beyond the soft wrap length; a column of barlines that can't
+// be aligned within these limits is left as it is, as are the columns after it.
+// Lines are wrapped as usual before the barlines are aligned. Minified output
+// is never aligned.
+func ConfigureBarlineAlignment(align bool) func(*formatter) {
+	return func(f *formatter) {
+		f.alignBarlines = align
+	}
+}
+
+// ConfigureRepeatSpacing configures whether the number of times that an event
+// is repeated is separated from the event, e.g. `c4 *4`, which is the default,
+// or written right after it, e.g. `c4*4`. A repeated event sequence that spans
+// several lines ends with `] *4` or `]*4` accordingly. Minified output is
+// always written without the space.
+func ConfigureRepeatSpacing(spaced bool) func(*formatter) {
+	return func(f *formatter) {
+		f.repeatSpacing = spaced
+	}
+}
+
+// ConfigurePartGroupSpacing configures whether the names of a part with more
+// than one instrument are separated by a `/` with spaces around it, e.g.
+// `violin / viola / cello:`, which can be easier to read in a large ensemble,
+// or without, e.g. `violin/viola/cello:`, which is the default. Minified output
+// is always written without the spaces.
+func ConfigurePartGroupSpacing(spaced bool) func(*formatter) {
+	return func(f *formatter) {
+		f.partGroupSpacing = spaced
+	}
+}
+
+// ConfigureInlineShortParts configures the formatter to write a part on a
+// single line, e.g. `snare: c d e`, when its declaration and events fit on one
+// line of at most the given length. Parts that don't fit are written with their
+// events indented on separate lines, as usual. The default, 0, means that parts
+// are never written on a single line.
+func ConfigureInlineShortParts(cols int) func(*formatter) {
+	return func(f *formatter) {
+		f.inlineShortParts = cols
+	}
+}
+
+// Identity returns an option that leaves the formatter configuration unchanged.
+// It is useful when building a list of options conditionally.
+func Identity() func(*formatter) {
+	return func(f *formatter) {}
+}
+
 func newFormatter(out io.Writer, opts ...formatterOption) *formatter {
 	formatter := &formatter{
-		softWrapLen: 80,
-		indentText:  "  ",
-		varDef:      None,
-		indentLevel: 0,
-		texts:       []string{},
-		out:         out,
+		softWrapLen:     DefaultSoftWrap,
+		indentText:      DefaultIndentText,
+		varDef:          None,
+		indentLevel:     0,
+		texts:           []string{},
+		out:             out,
+		trailingNewline: true,
+		repeatSpacing:   true,
+		tokenSeparator:  DefaultTokenSeparator,
+		maxNestingDepth: DefaultMaxNestingDepth,
+		variables:       map[string]bool{},
+		ctx:             context.Background(),
 	}
 
 	for _, opt := range opts {
@@ -58,7 +484,11 @@ func newFormatter(out io.Writer, opts ...formatterOption) *formatter {
 
 // line constructs and returns the current line being formatted.
 func (f *formatter) line() string {
-	text := strings.Join(f.texts, " ")
+	if f.minified {
+		return minifiedJoin(f.texts)
+	}
+
+	text := strings.Join(f.texts, f.tokenSeparator)
 	if len(text) == 0 {
 		return text
 	} else {
@@ -67,23 +497,158 @@ func (f *formatter) line() string {
 	}
 }
 
+// lineLen returns the length of the current line being formatted, i.e.
+// len(f.line()), without constructing it. (write checks the length of the line
+// after every text, so constructing it each time would be expensive.)
+func (f *formatter) lineLen() int {
+	if f.minified {
+		return len(f.line())
+	}
+
+	if len(f.texts) == 0 {
+		return 0
+	}
+
+	// The texts, joined with the token separator
+	length := (len(f.texts) - 1) * len(f.tokenSeparator)
+	for _, text := range f.texts {
+		length += len(text)
+	}
+
+	if length == 0 {
+		return 0
+	}
+
+	return f.indentLevel*len(f.indentText) + length
+}
+
+// isOctaveSetText returns true if the text is an octave set, e.g. "o4".
+// The scanner requires whitespace after an octave set.
+func isOctaveSetText(text string) bool {
+	if len(text) < 2 || text[0] != 'o' {
+		return false
+	}
+
+	for _, c := range text[1:] {
+		if !isDigit(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// minifiedJoin joins texts, omitting the space between them wherever the
+// scanner does not require one.
+func minifiedJoin(texts []string) string {
+	builder := strings.Builder{}
+
+	for i, text := range texts {
+		if i > 0 {
+			prev := texts[i-1]
+
+			needsSpace := true
+			switch {
+			case prev == "/" || text == "/" || prev == ">" || prev == "<":
+				needsSpace = false
+			case strings.HasSuffix(prev, "[") || strings.HasSuffix(prev, "{"):
+				needsSpace = false
+			case (text[0] == ']' || text[0] == '}' || text[0] == '*') &&
+				!isOctaveSetText(prev):
+				needsSpace = false
+			}
+
+			if needsSpace {
+				builder.WriteString(" ")
+			}
+		}
+
+		builder.WriteString(text)
+	}
+
+	return builder.String()
+}
+
 // emptyLine writes an empty line
 func (f *formatter) emptyLine() {
-	if f.varDef == None {
+	if f.varDef == None && !f.minified {
 		f.flush()
 		f.out.Write([]byte("\n"))
+		f.lineNumber++
+
+		if f.lineCallback != nil {
+			f.lineCallback(f.lineNumber, "", nil)
+		}
+
+		if f.sourceLines != nil {
+			f.sourceLines = append(f.sourceLines, 0)
+		}
 	}
 }
 
 // flush flushes out the current line to the output.
+// When minified, lines are only ended where required (see endLine).
 func (f *formatter) flush() {
+	if !f.minified {
+		f.endLine()
+	}
+}
+
+// endLine ends the current line, writing it to the output.
+func (f *formatter) endLine() {
 	if len(f.texts) > 0 && f.varDef == None {
-		f.out.Write([]byte(f.line() + "\n"))
+		line := f.line()
+		if f.beats != nil {
+			// A beat group gap at the end of a line (see formatPartEvents)
+			line = strings.TrimRight(line, f.tokenSeparator)
+		}
+
+		f.out.Write([]byte(line + "\n"))
+		f.lineNumber++
 		f.texts = []string{}
+		var nodes []ASTNode
+		if f.lineCallback != nil {
+			nodes = f.lineNodes()
+			f.textNodes = nil
+		}
+
+		if f.sourceLines != nil {
+			f.sourceLines = append(f.sourceLines, f.lineSourceLine)
+		}
+
+		if f.overflowReporter != nil && len(line) > f.softWrapLen {
+			f.overflowReporter(f.lineNumber, len(line))
+		}
+
+		if f.lineCallback != nil {
+			f.lineCallback(f.lineNumber, line, nodes)
+		}
 	}
 }
 
+// lineNodes returns the nodes that the texts of the current line were
+// formatted from, in order, without repeating a node whose texts are adjacent.
+func (f *formatter) lineNodes() []ASTNode {
+	nodes := []ASTNode{}
+	var previous *ASTNode
+	for _, node := range f.textNodes {
+		if node != nil && node != previous {
+			nodes = append(nodes, *node)
+		}
+		previous = node
+	}
+
+	return nodes
+}
+
 // indent increments the indentation level of subsequent formatting.
+//
+// Each construct whose body is indented (a part, a voice, or an event sequence
+// or cram that doesn't fit on one line) calls indent exactly once before its
+// body and unindent exactly once after it, so the indentation of a line is
+// always the number of such constructs that it's nested within. Editors rely on
+// this to fold nested structures predictably. (When configured not to indent,
+// the level stays at 0; see ConfigureNoIndent.)
 func (f *formatter) indent() {
 	switch f.varDef {
 	case LastNode:
@@ -93,8 +658,38 @@ func (f *formatter) indent() {
 		fallthrough
 	case None:
 		f.flush()
-		f.indentLevel++
+		if !f.noIndent {
+			f.indentLevel++
+		}
+	}
+}
+
+// UnbalancedIndentError is the error returned when the indentation level isn't
+// back to 0 once formatting is done, i.e. the formatter indented more times
+// than it unindented, or vice versa. This is always a bug in the formatter,
+// which would otherwise show up as misindented output after the construct
+// that leaked the indentation.
+type UnbalancedIndentError struct {
+	// Level is the indentation level once formatting was done.
+	Level int
+}
+
+func (uie *UnbalancedIndentError) Error() string {
+	return fmt.Sprintf(
+		"internal formatting error: indentation level is %d after formatting, "+
+			"rather than 0",
+		uie.Level,
+	)
+}
+
+// checkIndentBalanced returns an UnbalancedIndentError if the indentation
+// level isn't 0, which it should be once formatting is done (see indent).
+func (f *formatter) checkIndentBalanced() error {
+	if f.indentLevel != 0 {
+		return &UnbalancedIndentError{Level: f.indentLevel}
 	}
+
+	return nil
 }
 
 // unindent decrements the indentation level of subsequent formatting.
@@ -102,7 +697,9 @@ func (f *formatter) indent() {
 func (f *formatter) unindent() {
 	if f.varDef == None {
 		f.flush()
-		f.indentLevel--
+		if !f.noIndent {
+			f.indentLevel--
+		}
 	}
 }
 
@@ -110,13 +707,246 @@ func (f *formatter) unindent() {
 // Each "text" is an unwrappable token, i.e. wrapping only happens between text.
 func (f *formatter) write(text string) {
 	f.texts = append(f.texts, text)
-	if len(f.line()) > f.softWrapLen && f.varDef == None {
-		f.texts = f.texts[0 : len(f.texts)-1]
+	if f.lineCallback != nil {
+		f.textNodes = append(f.textNodes, f.node)
+	}
+	if f.singleLine {
+		f.overflowed = f.overflowed || f.lineLen() > f.softWrapLen
+	} else if f.varDef == None && !f.minified && f.lineLen() > f.softWrapLen {
+		// A line never starts with a chord separator, which would make it look
+		// like the note before it isn't part of the chord, so the note is moved
+		// onto the next line along with the separator. (If the note is the only
+		// thing on the line, the separator stays on the line with it.)
+		carried := 1
+		if text == "/" {
+			carried = 2
+		}
+
+		if carried < len(f.texts) || carried == 1 {
+			moved := append([]string{}, f.texts[len(f.texts)-carried:]...)
+			f.texts = f.texts[0 : len(f.texts)-carried]
+			var movedNodes []*ASTNode
+			if f.lineCallback != nil {
+				movedNodes = append(
+					movedNodes, f.textNodes[len(f.textNodes)-carried:]...,
+				)
+				f.textNodes = f.textNodes[0 : len(f.textNodes)-carried]
+			}
+			f.flush()
+			f.texts = append(f.texts, moved...)
+			f.textNodes = append(f.textNodes, movedNodes...)
+			f.lineSourceLine = f.sourceLine
+		}
+	}
+
+	if len(f.texts) == 1 {
+		f.lineSourceLine = f.sourceLine
+	}
+}
+
+// unknownNodeText returns the text of a node of a type that the parser doesn't
+// produce, i.e. its literal, if it's a non-empty string and the node has no
+// children.
+func unknownNodeText(node ASTNode) (string, bool) {
+	if _, known := nodeSpecs[node.Type]; known || len(node.Children) > 0 {
+		return "", false
+	}
+
+	text, ok := node.Literal.(string)
+	return text, ok && text != ""
+}
+
+// writeRepeatTimes writes the `*N` of a repeat, joining it onto the text of
+// the repeated event unless the formatter is configured to separate them (see
+// ConfigureRepeatSpacing).
+func (f *formatter) writeRepeatTimes(text string) {
+	if f.repeatSpacing || len(f.texts) == 0 {
+		f.write(text)
+		return
+	}
+
+	last := f.texts[len(f.texts)-1]
+	f.texts = f.texts[:len(f.texts)-1]
+	if f.lineCallback != nil {
+		f.textNodes = f.textNodes[:len(f.textNodes)-1]
+	}
+	f.write(last + text)
+}
+
+// breakForComments ends the current line if there are standalone comments
+// between the last node formatted and a node on the given source line, so that
+// the comments can be inserted between them (see FormatASTWithComments).
+func (f *formatter) breakForComments(line int) {
+	passed := 0
+	for passed < len(f.commentLines) && f.commentLines[passed] < line {
+		passed++
+	}
+
+	if passed > 0 {
+		f.commentLines = f.commentLines[passed:]
 		f.flush()
-		f.texts = append(f.texts, text)
 	}
 }
 
+// stringEscaper escapes the characters that cannot appear verbatim in a
+// formatted string. See stringEscapes for the corresponding scanner logic.
+var stringEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// escapeString returns the string literal representation of s, i.e. s
+// surrounded by double quotes, with special characters escaped.
+func escapeString(s string) string {
+	return `"` + stringEscaper.Replace(s) + `"`
+}
+
+var (
+	// integerSourceText and floatSourceText match the spellings of numbers that
+	// the scanner accepts.
+	integerSourceText = regexp.MustCompile(`^[0-9]+$`)
+	floatSourceText   = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+)
+
+// literalText returns the text to write for a literal: its original spelling,
+// if so configured and the node's source text is still a valid spelling of its
+// literal, otherwise the given canonical text.
+func (f *formatter) literalText(node ASTNode, canonical string) string {
+	if f.preserveLiterals && sourceTextMatches(node) {
+		return node.SourceText
+	}
+
+	return canonical
+}
+
+// sourceTextMatches reports whether a node's source text is a spelling of its
+// literal. This guards against source text that went stale when the literal
+// was changed after parsing.
+func sourceTextMatches(node ASTNode) bool {
+	switch literal := node.Literal.(type) {
+	case int32:
+		if !integerSourceText.MatchString(node.SourceText) {
+			return false
+		}
+
+		value, err := strconv.ParseInt(node.SourceText, 10, 32)
+		return err == nil && int32(value) == literal
+
+	case float64:
+		if !floatSourceText.MatchString(node.SourceText) {
+			return false
+		}
+
+		value, err := strconv.ParseFloat(node.SourceText, 64)
+		return err == nil && value == literal
+
+	case string:
+		// The source text of a string is the whole string token, quotes and all,
+		// so we check that it scans as exactly that string. (Strings only occur
+		// within Lisp forms; elsewhere, a double quote starts a part alias.)
+		tokens, err := Tokenize("(" + node.SourceText + ")")
+		return err == nil &&
+			len(tokens) == 4 &&
+			tokens[1].tokenType == String &&
+			tokens[1].literal == literal
+	}
+
+	return false
+}
+
+// validateName checks that a name (e.g. a part alias) consists only of
+// characters that the scanner accepts in a name. There is no escape syntax for
+// names, so a name that contains any other character cannot be formatted.
+func validateName(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("name is empty")
+	}
+
+	for _, c := range name {
+		if !isValidNameChar(c) {
+			return fmt.Errorf("%q contains invalid character %q", name, c)
+		}
+	}
+
+	return nil
+}
+
+// inlineText returns the text of the given events formatted on a single line.
+// Formatting stops as soon as the line is longer than maxLen, in which case the
+// boolean return value is false, so that the cost of trying doesn't depend on
+// the size of the events.
+// The boolean return value is false if the events can't be formatted on a
+// single line, e.g. because they include an event sequence, which is always
+// indented.
+func (f *formatter) inlineText(
+	maxLen int, nodes ...ASTNode,
+) (string, bool, error) {
+	out := bytes.Buffer{}
+	inline := newFormatter(
+		&out, ConfigureSoftWrapLen(maxLen), ConfigureIndentText(f.indentText),
+	)
+	inline.singleLine = true
+	// The options that affect how events are written on a line
+	inline.preserveLiterals = f.preserveLiterals
+	inline.tokenSeparator = f.tokenSeparator
+	inline.repeatSpacing = f.repeatSpacing
+	inline.partGroupSpacing = f.partGroupSpacing
+	inline.variables = f.variables
+	inline.ctx = f.ctx
+
+	if err := inline.formatInnerEvents(nodes...); err != nil {
+		return "", false, err
+	}
+	if inline.overflowed {
+		return "", false, nil
+	}
+	inline.flush()
+
+	text := strings.TrimSuffix(out.String(), "\n")
+	return text, !strings.Contains(text, "\n"), nil
+}
+
+// formatBraces writes the opening brace and the events of a cram expression or
+// a tuplet, leaving the caller to write the closing brace and whatever follows
+// it (i.e. a duration or a tuplet ratio).
+//
+// A node that fits on a line is instead written as a single text, so that it
+// isn't wrapped, in which case the boolean return value is true and the caller
+// has nothing left to write. A longer node is broken across lines with its
+// events indented, like a standalone event sequence. (While defining a
+// variable, lines can't be broken anyway.)
+func (f *formatter) formatBraces(node ASTNode, events ASTNode) (bool, error) {
+	if f.minified || f.singleLine || f.varDef == Defining {
+		f.write("{")
+		return false, f.formatInnerEvents(events.Children...)
+	}
+
+	indent := strings.Repeat(f.indentText, f.indentLevel)
+	text, ok, err := f.inlineText(f.softWrapLen-len(indent), node)
+	if err != nil {
+		return false, err
+	}
+
+	if ok {
+		f.write(text)
+		return true, nil
+	}
+
+	f.flush()
+	f.write("{")
+	f.indent()
+
+	if err := f.formatInnerEvents(events.Children...); err != nil {
+		return false, err
+	}
+
+	f.unindent()
+	return false, nil
+}
+
 // formatWithDuration handles duration formatting.
 // Durations are formatted with possible text directly pre/post (no spaces),
 // i.e. note pitches preceding durations.
@@ -125,6 +955,22 @@ func (f *formatter) write(text string) {
 func (f *formatter) formatWithDuration(
 	pre string, duration ASTNode, post string,
 ) error {
+	// A duration that consists solely of barlines has no note length for the
+	// post text to follow, and a tie can't follow a barline (e.g. `c |~`), so
+	// the post text is written along with the pre text, before the barlines.
+	onlyBarlines := len(duration.Children) > 0
+	for _, child := range duration.Children {
+		onlyBarlines = onlyBarlines && child.Type == BarlineNode
+	}
+
+	if onlyBarlines {
+		f.write(pre + post)
+		for range duration.Children {
+			f.write("|")
+		}
+		return nil
+	}
+
 	text := strings.Builder{}
 	text.WriteString(pre)
 	shouldTie := false
@@ -133,24 +979,25 @@ func (f *formatter) formatWithDuration(
 		switch child.Type {
 
 		default:
-			return fmt.Errorf(
-				"unexpected DurationNode %#v during formatting", child,
-			)
+			return child.errUnexpectedNode("while formatting a duration")
 
 		case BarlineNode:
-			if i == len(duration.Children)-1 {
-				// The final duration is a barline
-				// We write out any post text before the barline for clarity
-				text.WriteString(post)
-			}
-
 			// Barlines in a duration split formatting into separate texts
 			if text.Len() > 0 {
 				f.write(text.String())
 			}
-			f.write("|")
-
-			text.Reset()
+
+			if i == len(duration.Children)-1 {
+				// The final duration component is a barline, so we write out any post
+				// text (i.e. a tie) right after it. NB: Writing the tie before the
+				// barline (e.g. `c4~ |`) would end the duration before the barline,
+				// making the barline a separate event.
+				f.write("|" + post)
+			} else {
+				f.write("|")
+			}
+
+			text.Reset()
 
 		case NoteLengthNode:
 			if shouldTie {
@@ -173,12 +1020,22 @@ func (f *formatter) formatWithDuration(
 					return err
 				}
 
-				numDots = int(dotsNode.Literal.(int32))
+				// A negative number of dots can't be written, and would make
+				// strings.Repeat panic.
+				dots, _ := dotsNode.Literal.(int32)
+				if dots < 0 {
+					return dotsNode.errorf("invalid number of dots: %d", dots)
+				}
+
+				numDots = int(dots)
 			}
 
 			text.WriteString(fmt.Sprintf(
 				"%s%s",
-				strconv.FormatFloat(denom.Literal.(float64), 'f', -1, 64),
+				f.literalText(
+					denom,
+					strconv.FormatFloat(denom.Literal.(float64), 'f', -1, 64),
+				),
 				strings.Repeat(".", numDots),
 			))
 
@@ -191,7 +1048,10 @@ func (f *formatter) formatWithDuration(
 
 			text.WriteString(fmt.Sprintf(
 				"%sms",
-				strconv.FormatFloat(child.Literal.(float64), 'f', -1, 64),
+				f.literalText(
+					child,
+					strconv.FormatFloat(child.Literal.(float64), 'f', -1, 64),
+				),
 			))
 
 			shouldTie = true
@@ -203,7 +1063,10 @@ func (f *formatter) formatWithDuration(
 
 			text.WriteString(fmt.Sprintf(
 				"%ss",
-				strconv.FormatFloat(child.Literal.(float64), 'f', -1, 64),
+				f.literalText(
+					child,
+					strconv.FormatFloat(child.Literal.(float64), 'f', -1, 64),
+				),
 			))
 
 			shouldTie = true
@@ -221,13 +1084,47 @@ func (f *formatter) formatWithDuration(
 
 // formatInnerEvents handles formatting of inner events within parts.
 func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
-	for _, node := range nodes {
+	if f.lineCallback != nil {
+		// The texts written after the events, e.g. the closing bracket of an
+		// event sequence, are attributed to the enclosing node.
+		defer func(enclosing *ASTNode) { f.node = enclosing }(f.node)
+	}
+
+	for i, node := range nodes {
+		if f.overflowed {
+			return nil
+		}
+
+		if f.lineCallback != nil {
+			f.node = &nodes[i]
+		}
+
+		if err := f.ctx.Err(); err != nil {
+			return err
+		}
+
+		if node.SourceContext.Line > 0 {
+			f.breakForComments(node.SourceContext.Line)
+			f.sourceLine = node.SourceContext.Line
+		}
+
 		switch node.Type {
 
 		default:
-			return fmt.Errorf(
-				"unexpected ASTNode Type %#v during formatting", node.Type,
-			)
+			// A node of a type that the parser doesn't produce, e.g. one added by
+			// another tool, is written as its text, if it has one, rather than
+			// failing to format the whole score.
+			text, ok := unknownNodeText(node)
+			if !ok {
+				return node.errUnexpectedNode("while formatting events")
+			}
+
+			log.Warn().
+				Str("type", node.Type.String()).
+				Str("text", text).
+				Msg("Writing the text of a node of an unknown type.")
+
+			f.write(text)
 
 		case AtMarkerNode:
 			f.write(fmt.Sprintf("@%s", node.Literal.(string)))
@@ -242,22 +1139,38 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 			// We can change this by creating a new helper function for
 			// inner-chord nodes that returns a []string of texts
 			// Would have to handle the fact that barlines make multiple writes
-
-			if err := node.expectChildren(); err != nil {
-				return err
-			}
+			//
+			// A chord with fewer than two notes is formatted as it is (an empty
+			// chord as nothing at all); it's left to the linter to complain.
 
 			// Within a chord, there can be additional nodes between notes
 			// We format all of these after the separator for readability as
 			// they apply to the subsequent note
-			lastNoteOrRest := 0
+			firstNoteOrRest, lastNoteOrRest := -1, -1
 			for i, child := range node.Children {
 				if child.Type == NoteNode || child.Type == RestNode {
+					if firstNoteOrRest == -1 {
+						firstNoteOrRest = i
+					}
 					lastNoteOrRest = i
 				}
 			}
 
+			// Anything before the first note or after the last would be parsed as
+			// being outside of the chord, so the chord wouldn't round-trip.
+			if len(node.Children) > 0 && (firstNoteOrRest != 0 ||
+				lastNoteOrRest != len(node.Children)-1) {
+				return node.errorf("a chord must start and end on a note or rest")
+			}
+
 			for i, child := range node.Children {
+				switch child.Type {
+				case NoteNode, RestNode, OctaveDownNode, OctaveSetNode, OctaveUpNode,
+					LispListNode:
+				default:
+					return child.errUnexpectedNode("while formatting a chord")
+				}
+
 				err := f.formatInnerEvents(child)
 				if err != nil {
 					return err
@@ -280,13 +1193,33 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 				return err
 			}
 
-			f.write("{")
+			if len(events.Children) == 0 {
+				// An empty cram, which is left to the linter to complain about
+				if len(node.Children) == 1 {
+					f.write("{}")
+					continue
+				}
 
-			err = f.formatInnerEvents(events.Children...)
+				duration, err := node.Children[1].expectNodeType(DurationNode)
+				if err != nil {
+					return err
+				}
+
+				if err := f.formatWithDuration("{}", duration, ""); err != nil {
+					return err
+				}
+				continue
+			}
+
+			inlined, err := f.formatBraces(node, events)
 			if err != nil {
 				return err
 			}
 
+			if inlined {
+				continue
+			}
+
 			if len(node.Children) > 1 {
 				duration, err := node.Children[1].expectNodeType(DurationNode)
 				if err != nil {
@@ -301,7 +1234,35 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 				f.write("}")
 			}
 
+		case DynamicNode:
+			marking := node.Literal.(string)
+			if !isDynamicMarking(marking) {
+				return node.errorf("invalid dynamic marking: %q", marking)
+			}
+
+			// After a variable of the same name is defined, the marking would parse
+			// as a reference to the variable, so we write the equivalent Lisp form.
+			if f.variables[marking] {
+				f.write("(" + marking + ")")
+			} else {
+				f.write(marking)
+			}
+
+		case ErrorNode:
+			// The raw text is written as a single text, so that it isn't wrapped.
+			// (formatRoot has already refused to format ErrorNodes, unless they're
+			// to be preserved.)
+			if node.SourceText != "" {
+				f.write(node.SourceText)
+			}
+
 		case EventSequenceNode:
+			// An empty event sequence is left to the linter to complain about.
+			if len(node.Children) == 0 {
+				f.write("[]")
+				continue
+			}
+
 			// Always try to indent the children of standalone event sequences
 			// (i.e. those not used as part of a separate node such as cram)
 			f.flush()
@@ -316,17 +1277,50 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 			f.unindent()
 			f.write("]")
 
+		case GlissandoNode:
+			if err := node.expectChildren(); err != nil {
+				return err
+			}
+
+			lastNote := -1
+			for i, child := range node.Children {
+				switch child.Type {
+				case NoteNode:
+					lastNote = i
+				case BarlineNode:
+				default:
+					return child.errUnexpectedNode("while formatting a glissando")
+				}
+			}
+
+			if node.Children[0].Type != NoteNode || lastNote != len(node.Children)-1 {
+				return node.errorf("a glissando must start and end on a note")
+			}
+
+			for i, child := range node.Children {
+				if err := f.formatInnerEvents(child); err != nil {
+					return err
+				}
+
+				if child.Type == NoteNode && i < lastNote {
+					f.write("~~")
+				}
+			}
+
 		case LispListNode:
 			var lispString func(ASTNode) (string, error)
 			lispString = func(lisp ASTNode) (string, error) {
 				switch lisp.Type {
 
 				default:
-					return "", fmt.Errorf(
-						"unexpected LispListNode %#v during formatting", lisp,
+					return "", lisp.errUnexpectedNode(
+						"while formatting a Lisp form",
 					)
 
-				case LispListNode:
+				case LispKeywordNode:
+					return ":" + lisp.Literal.(string), nil
+
+				case LispListNode, LispMapNode, LispVectorNode:
 					texts := []string{}
 
 					for _, child := range lisp.Children {
@@ -338,21 +1332,32 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 						texts = append(texts, text)
 					}
 
-					return fmt.Sprintf("(%s)", strings.Join(texts, " ")), nil
+					brackets := map[ASTNodeType]string{
+						LispListNode:   "()",
+						LispMapNode:    "{}",
+						LispVectorNode: "[]",
+					}[lisp.Type]
+
+					return fmt.Sprintf(
+						"%c%s%c", brackets[0], strings.Join(texts, " "), brackets[1],
+					), nil
 
 				case LispNumberNode:
 					switch num := lisp.Literal.(type) {
 					default:
-						return "", fmt.Errorf(
-							"unexpected LispNumberNode %#v during formatting",
-							num,
+						return "", lisp.errUnexpectedNode(
+							"while formatting a Lisp form",
 						)
 					case float64:
-						return strconv.FormatFloat(
+						return f.literalText(lisp, strconv.FormatFloat(
 							num, 'f', -1, 64,
-						), nil
+						)), nil
 					case int32:
-						return fmt.Sprintf("%d", num), nil
+						return strconv.FormatInt(int64(num), 10), nil
+					case int64:
+						return strconv.FormatInt(num, 10), nil
+					case int:
+						return strconv.Itoa(num), nil
 					}
 
 				case LispQuotedFormNode:
@@ -364,7 +1369,13 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 					return fmt.Sprintf("'%s", form), nil
 
 				case LispStringNode:
-					return fmt.Sprintf("\"%s\"", lisp.Literal.(string)), nil
+					// A string is never wrapped, however long it is. A line break within
+					// the quotes would become part of the string, there's no escape
+					// sequence for continuing a string on the next line, and alda-lisp
+					// has no function for concatenating strings. So a line with a long
+					// string can only be reported (see ConfigureOverflowReporter).
+					literal := lisp.Literal.(string)
+					return f.literalText(lisp, escapeString(literal)), nil
 
 				case LispSymbolNode:
 					return lisp.Literal.(string), nil
@@ -384,6 +1395,9 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 		case MarkerNode:
 			f.write(fmt.Sprintf("%%%s", node.Literal.(string)))
 
+		case MultiMeasureRestNode:
+			f.write(fmt.Sprintf("R*%d", node.Literal.(int32)))
+
 		case NoteNode:
 			if err := node.expectNChildren(1, 2, 3); err != nil {
 				return err
@@ -405,6 +1419,9 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 				return err
 			}
 
+			// The letter and accidentals are written as they are. Respelling
+			// them, which leaves percussion parts alone by default, is done
+			// beforehand (see RespellNotes).
 			pitchText := strings.Builder{}
 			pitchText.WriteRune(letter.Literal.(rune))
 
@@ -419,9 +1436,8 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 				for _, child := range accidentals.Children {
 					switch child.Type {
 					default:
-						return fmt.Errorf(
-							"unexpected NoteAccidentalsNode %#v during formatting",
-							child,
+						return child.errUnexpectedNode(
+							"while formatting accidentals",
 						)
 					case FlatNode:
 						pitchText.WriteString("-")
@@ -455,7 +1471,9 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 			f.write("<")
 
 		case OctaveSetNode:
-			f.write(fmt.Sprintf("o%d", node.Literal.(int32)))
+			f.write("o" + f.literalText(
+				node, strconv.Itoa(int(node.Literal.(int32))),
+			))
 
 		case OctaveUpNode:
 			f.write(">")
@@ -475,7 +1493,9 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 				return err
 			}
 
-			f.write(fmt.Sprintf("*%d", times.Literal.(int32)))
+			f.writeRepeatTimes("*" + f.literalText(
+				times, strconv.Itoa(int(times.Literal.(int32))),
+			))
 
 		case OnRepetitionsNode:
 			if err := node.expectNChildren(2); err != nil {
@@ -513,17 +1533,15 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 					return err
 				}
 
-				frNum := fr.Literal.(int32)
-				lrNum := lr.Literal.(int32)
+				frText := f.literalText(fr, strconv.Itoa(int(fr.Literal.(int32))))
+				lrText := f.literalText(lr, strconv.Itoa(int(lr.Literal.(int32))))
 
-				if frNum == lrNum {
-					ranges = append(ranges,
-						fmt.Sprintf("%d", frNum),
-					)
+				// NB: The parser gives both ends of a single-repetition range (e.g.
+				// `'2`) the same source text.
+				if fr.Literal.(int32) == lr.Literal.(int32) && frText == lrText {
+					ranges = append(ranges, frText)
 				} else {
-					ranges = append(ranges,
-						fmt.Sprintf("%d-%d", frNum, lrNum),
-					)
+					ranges = append(ranges, frText+"-"+lrText)
 				}
 			}
 			f.write(fmt.Sprintf("'%s", strings.Join(ranges, ",")))
@@ -543,6 +1561,41 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 				f.write("r")
 			}
 
+		case TimeSignatureNode:
+			timeSig, err := timeSignature(node)
+			if err != nil {
+				return err
+			}
+
+			f.write(timeSig.String())
+
+		case TupletNode:
+			if err := node.expectNChildren(3); err != nil {
+				return err
+			}
+
+			events, err := node.Children[0].expectNodeType(EventSequenceNode)
+			if err != nil {
+				return err
+			}
+
+			ratio, err := tupletRatio(node)
+			if err != nil {
+				return err
+			}
+
+			inlined, err := f.formatBraces(node, events)
+			if err != nil {
+				return err
+			}
+
+			if inlined {
+				continue
+			}
+
+			// The ratio must directly follow the closing brace.
+			f.write("}" + ratio.String())
+
 		case VariableDefinitionNode:
 			// Variable definitions are incredibly tricky to format because
 			// formatted text must be on the same line as the variable name.
@@ -552,6 +1605,11 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 			// - While "LastNode", we allow event sequences (including repeats)
 			// 	 and voice groups to indent and continue on new lines.
 			// 	 This is complicated, but any alternative I tried was worse.
+			//
+			// NB: A long definition of a flat list of events (e.g. a long melody)
+			// therefore produces an overlong line. We can't wrap it, because the
+			// parser ends a variable definition at the end of the line, so any
+			// events wrapped onto the next line would no longer be part of it.
 
 			f.flush()
 			f.varDef = Defining
@@ -566,6 +1624,7 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 			}
 
 			f.write(fmt.Sprintf("%s =", name.Literal.(string)))
+			f.variables[name.Literal.(string)] = true
 
 			events, err := node.Children[1].expectNodeType(EventSequenceNode)
 			if err != nil {
@@ -586,10 +1645,15 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 				if err != nil {
 					return err
 				}
+			} else {
+				// A definition must have an event on the same line as the `=`, so an
+				// empty definition is written as an empty event sequence.
+				f.write("[]")
 			}
 
+			// A variable definition always ends its line
 			f.varDef = None
-			f.flush()
+			f.endLine()
 
 		case VariableReferenceNode:
 			f.write(node.Literal.(string))
@@ -614,7 +1678,9 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 				return err
 			}
 
-			f.write(fmt.Sprintf("V%d:", voiceNumber.Literal.(int32)))
+			f.write(fmt.Sprintf("V%s:", f.literalText(
+				voiceNumber, strconv.Itoa(int(voiceNumber.Literal.(int32))),
+			)))
 
 			f.indent()
 
@@ -636,11 +1702,122 @@ func (f *formatter) formatInnerEvents(nodes ...ASTNode) error {
 	return nil
 }
 
+// formatInlinePart writes a part declaration and the part's events on a single
+// line, if the formatter is configured to do so and the line is short enough
+// (see ConfigureInlineShortParts). The boolean return value is false if nothing
+// was written, in which case the part should be formatted as usual.
+func (f *formatter) formatInlinePart(
+	declText string, events ASTNode,
+) (bool, error) {
+	if f.inlineShortParts <= 0 || f.minified {
+		return false, nil
+	}
+
+	// A standalone comment within the part needs a line of its own (see
+	// FormatASTWithComments).
+	lastLine := maxSourceLine(events)
+	for _, line := range f.commentLines {
+		if line > f.sourceLine && line < lastLine {
+			return false, nil
+		}
+	}
+
+	// Formatting the events records any variables that they define, which would
+	// be premature if the part ends up being formatted as usual.
+	variables := make(map[string]bool, len(f.variables))
+	for name := range f.variables {
+		variables[name] = true
+	}
+
+	text, ok, err := f.inlineText(
+		f.inlineShortParts-len(declText)-1, events.Children...,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	line := declText
+	if text != "" {
+		line += " " + text
+	}
+
+	if !ok || len(line) > f.inlineShortParts {
+		f.variables = variables
+		return false, nil
+	}
+
+	// The line is written as a single text so that it isn't wrapped.
+	f.write(line)
+	return true, nil
+}
+
+// maxSourceLine returns the last source line of the given node or any of its
+// descendants, or 0 if unknown.
+func maxSourceLine(node ASTNode) int {
+	line := node.SourceContext.Line
+	for _, child := range node.Children {
+		if childLine := maxSourceLine(child); childLine > line {
+			line = childLine
+		}
+	}
+
+	return line
+}
+
+// formatPartEvents formats the events of a part, leaving extra space before
+// each event that starts a beat group when configured to (see
+// ConfigureBeatGrouping). The extra space is an additional token separator at
+// the end of the preceding text, which is trimmed if the line ends there.
+func (f *formatter) formatPartEvents(events []ASTNode) error {
+	if f.beats == nil {
+		return f.formatInnerEvents(events...)
+	}
+
+	for _, event := range events {
+		if f.beats.startsGroup(event) && len(f.texts) > 0 {
+			f.texts[len(f.texts)-1] += f.tokenSeparator
+		}
+
+		if err := f.formatInnerEvents(event); err != nil {
+			return err
+		}
+
+		f.beats.advance(event)
+	}
+
+	return nil
+}
+
 // formatTopLevel handles formatting for the RootNode and parts.
 func (f *formatter) formatTopLevel(root ASTNode) error {
 	for i, part := range root.Children {
+		if err := f.ctx.Err(); err != nil {
+			return err
+		}
+
+		if part.SourceContext.Line > 0 {
+			f.sourceLine = part.SourceContext.Line
+		}
+
+		if f.lineCallback != nil {
+			f.node = &root.Children[i]
+		}
+
+		// Parts are separated by a blank line. This includes the implicit part,
+		// e.g. global attribute changes or variable definitions at the top of a
+		// score, which is set apart from the first named part in the same way
+		// that named parts are set apart from each other.
+		if i > 0 {
+			f.emptyLine()
+		}
+
 		switch part.Type {
 
+		case ErrorNode:
+			if err := f.formatInnerEvents(part); err != nil {
+				return err
+			}
+
 		case ImplicitPartNode:
 			if err := part.expectNChildren(1); err != nil {
 				return err
@@ -651,7 +1828,7 @@ func (f *formatter) formatTopLevel(root ASTNode) error {
 				return err
 			}
 
-			err = f.formatInnerEvents(events.Children...)
+			err = f.formatPartEvents(events.Children)
 			if err != nil {
 				return err
 			}
@@ -689,7 +1866,13 @@ func (f *formatter) formatTopLevel(root ASTNode) error {
 
 				names = append(names, partNameNode.Literal.(string))
 			}
-			namesText := strings.Join(names, "/")
+			separator := "/"
+			if f.partGroupSpacing && !f.minified {
+				separator = " / "
+			}
+			namesText := strings.Join(names, separator)
+
+			var declText string
 
 			if len(decl.Children) > 1 {
 				partAlias, err := decl.Children[1].expectNodeType(
@@ -699,57 +1882,670 @@ func (f *formatter) formatTopLevel(root ASTNode) error {
 					return err
 				}
 
-				f.write(fmt.Sprintf(
-					"%s \"%s\":",
-					namesText,
-					partAlias.Literal.(string),
-				))
+				alias := partAlias.Literal.(string)
+				if err := validateName(alias); err != nil {
+					return partAlias.errorf("invalid part alias: %s", err)
+				}
+
+				declText = fmt.Sprintf("%s \"%s\":", namesText, alias)
 			} else {
-				f.write(fmt.Sprintf(
+				declText = fmt.Sprintf(
 					"%s:",
 					namesText,
-				))
+				)
 			}
 
-			// Part events
-			f.indent()
-
 			events, err := part.Children[1].expectNodeType(EventSequenceNode)
 			if err != nil {
 				return err
 			}
 
-			err = f.formatInnerEvents(events.Children...)
+			if f.beats != nil {
+				f.beats.enterPart(partKey(decl))
+			}
+
+			inlined, err := f.formatInlinePart(declText, events)
+			if err != nil {
+				return err
+			}
+
+			if inlined {
+				// Short parts are written without beat group gaps, but the position
+				// within the measure still needs to be kept track of.
+				if f.beats != nil {
+					for _, event := range events.Children {
+						f.beats.advance(event)
+					}
+				}
+				break
+			}
+
+			f.write(declText)
+
+			// Part events
+			f.indent()
+
+			err = f.formatPartEvents(events.Children)
 			if err != nil {
 				return err
 			}
 
 			f.unindent()
 
+		default:
+			return part.errUnexpectedNode("at the top level of a score")
 		}
 
 		f.flush()
-		if i+1 < len(root.Children) {
-			f.emptyLine()
+	}
+
+	f.endLine()
+
+	return nil
+}
+
+// formatRoot validates and formats an AST.
+func (f *formatter) formatRoot(root ASTNode) error {
+	// Not tabs, as the scanner doesn't allow a tab after a note or a name.
+	if strings.Trim(f.tokenSeparator, " ") != "" || f.tokenSeparator == "" {
+		return fmt.Errorf(
+			"invalid token separator %q: it must consist of spaces",
+			f.tokenSeparator,
+		)
+	}
+
+	if err := checkNestingDepth(root, f.maxNestingDepth); err != nil {
+		return err
+	}
+
+	// Fail fast on malformed ASTs, which the formatter would otherwise trip
+	// over with a less helpful error, or even a panic
+	if problems := validateAST(root, f.preserveErrors, true); len(problems) > 0 {
+		return problems[0]
+	}
+
+	if f.simplifyDurations {
+		root = SimplifyDurations(root)
+	}
+
+	switch f.syntaxVersion {
+	case 0:
+	case SyntaxVersion1, SyntaxVersion2:
+		// Key signatures are normalized in Alda 2 syntax, which is the only one
+		// that NormalizeKeySignatures understands.
+		root = ConvertSyntaxVersion(root, SyntaxVersion2)
+	default:
+		return fmt.Errorf("unsupported syntax version %d", f.syntaxVersion)
+	}
+
+	if f.keySignatureStyle != KeySignaturePreserve {
+		root = NormalizeKeySignatures(root, f.keySignatureStyle)
+	}
+
+	if f.respellNotes {
+		root = RespellNotes(root, f.drumNameStyle)
+	}
+
+	if f.syntaxVersion == SyntaxVersion1 {
+		root = ConvertSyntaxVersion(root, SyntaxVersion1)
+	}
+
+	if f.implicitPartName != "" {
+		if err := validateName(f.implicitPartName); err != nil {
+			return fmt.Errorf("invalid implicit part name: %s", err)
+		}
+
+		explicit, err := explicitImplicitPart(root, f.implicitPartName)
+		if err != nil {
+			return err
+		}
+		root = explicit
+	}
+
+	if f.beatGrouping && !f.minified {
+		f.beats = newBeatGrouper()
+	}
+
+	if err := f.formatTopLevel(root); err != nil {
+		return err
+	}
+
+	return f.checkIndentBalanced()
+}
+
+// explicitImplicitPart returns a copy of the root node where the leading
+// implicit part, if there is one, is replaced by a part with the given name
+// and the same events.
+//
+// Returns an error if a part declaration in the score already uses the name,
+// as a part name or an alias, as the score would then declare the part twice,
+// e.g. `piano:` and `piano "solo":`, which is ambiguous.
+func explicitImplicitPart(root ASTNode, name string) (ASTNode, error) {
+	if len(root.Children) == 0 || root.Children[0].Type != ImplicitPartNode {
+		return root, nil
+	}
+
+	for _, part := range root.Children {
+		if part.Type != PartNode || len(part.Children) == 0 {
+			continue
+		}
+
+		decl := part.Children[0]
+		for _, node := range decl.Children {
+			declared := []ASTNode{node}
+			if node.Type == PartNamesNode {
+				declared = node.Children
+			}
+
+			for _, declaredName := range declared {
+				if declaredName.Literal != name {
+					continue
+				}
+
+				return ASTNode{}, declaredName.errorf(
+					"invalid implicit part name: %q is already declared in the score",
+					name,
+				)
+			}
+		}
+	}
+
+	implicitPart := root.Children[0]
+
+	root.Children = append([]ASTNode{{
+		Type:          PartNode,
+		SourceContext: implicitPart.SourceContext,
+		Children: append([]ASTNode{{
+			Type: PartDeclarationNode,
+			Children: []ASTNode{{
+				Type:     PartNamesNode,
+				Children: []ASTNode{{Type: PartNameNode, Literal: name}},
+			}},
+		}}, implicitPart.Children...),
+	}}, root.Children[1:]...)
+
+	return root, nil
+}
+
+// checkNestingDepth returns an error about the first node that is nested more
+// than maxDepth levels deep. The AST is traversed with an explicit stack, so
+// that an AST of any depth can be checked.
+func checkNestingDepth(root ASTNode, maxDepth int) error {
+	type nestedNode struct {
+		node  *ASTNode
+		depth int
+	}
+
+	stack := []nestedNode{{node: &root}}
+	for len(stack) > 0 {
+		parent := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for i := range parent.node.Children {
+			child := &parent.node.Children[i]
+
+			depth := parent.depth
+			if opensNestingLevel(parent.node.Type, child.Type) {
+				depth++
+			}
+
+			if depth > maxDepth {
+				return child.errorf(
+					"exceeded the maximum nesting depth of %d", maxDepth,
+				)
+			}
+
+			stack = append(stack, nestedNode{node: child, depth: depth})
 		}
 	}
 
 	return nil
 }
 
+// opensNestingLevel reports whether a child node of the given type is nested
+// one level deeper than its parent, i.e. it's written with brackets, braces or
+// parentheses. The events of a part, a voice, a variable definition, a cram
+// expression or a tuplet are an event sequence that isn't written with
+// brackets, so it doesn't count.
+func opensNestingLevel(parentType ASTNodeType, childType ASTNodeType) bool {
+	switch childType {
+	case CramNode, TupletNode, LispListNode, LispVectorNode, LispMapNode:
+		return true
+	case EventSequenceNode:
+		switch parentType {
+		case CramNode, TupletNode, PartNode, ImplicitPartNode, VoiceNode,
+			VariableDefinitionNode:
+			return false
+		}
+		return true
+	}
+
+	return false
+}
+
 // FormatASTToCode performs rudimentary output formatting of Alda code including
 // handling basic spacing, indentation, and line wrapping.
+//
+// The output depends only on the AST and the options, and not on e.g. the time,
+// the locale, or the order of iteration over a map, so formatting the same AST
+// always produces byte-identical output that never begins with a byte order
+// mark. This matters to anyone who checks formatted scores into version
+// control, so it's important that any future formatting rule (e.g. sorting
+// attributes) iterates over things in a well-defined order.
 // TODO: handle formatting comments by retaining comment data to the AST layer.
 func FormatASTToCode(
 	root ASTNode, out io.Writer, opts ...formatterOption,
 ) error {
-	// Write to temp buffer instead of directly to file in case of error
+	return FormatASTToCodeContext(context.Background(), root, out, opts...)
+}
+
+// FormatASTToCodeContext is like FormatASTToCode, but stops formatting as soon
+// as the context is canceled or its deadline passes, returning the context's
+// error (e.g. context.DeadlineExceeded). This bounds the time spent on a
+// pathologically large AST, e.g. one generated from user input. The context is
+// checked before each part and each event, so nothing is written to the
+// output once it's done.
+func FormatASTToCodeContext(
+	ctx context.Context, root ASTNode, out io.Writer, opts ...formatterOption,
+) error {
+	output, err := formatASTToBytes(ctx, root, opts...)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(output)
+	return err
+}
+
+// FormatASTToCodeChecked is like FormatASTToCode, but also compares the output
+// with the original source code, returning the byte offset of the first byte
+// where they differ, or -1 if they're identical. If one is a prefix of the
+// other, they differ at the end of the shorter one.
+//
+// This is cheaper than a full diff when all that's needed is whether
+// formatting changes anything, e.g. to only overwrite a file that isn't
+// already formatted.
+func FormatASTToCodeChecked(
+	root ASTNode, original string, out io.Writer, opts ...formatterOption,
+) (int, error) {
+	output, err := formatASTToBytes(context.Background(), root, opts...)
+	if err != nil {
+		return -1, err
+	}
+
+	if _, err := out.Write(output); err != nil {
+		return -1, err
+	}
+
+	return firstDifference(output, []byte(original)), nil
+}
+
+// FormatASTToCodePartial is like FormatASTToCode, but if the AST can't be
+// formatted, e.g. because of a malformed node, it writes as much of it as it
+// can, i.e. everything before the first part or event that can't be formatted,
+// followed by a comment on a line of its own that marks where formatting
+// stopped, e.g. `# alda-format: formatting stopped here: ...`. It then returns
+// the error. The partial output is still valid Alda code, so it can be shown
+// in an editor, or parsed, in place of a score that can't be formatted in
+// full.
+func FormatASTToCodePartial(
+	root ASTNode, out io.Writer, opts ...formatterOption,
+) error {
+	output, err := formatASTToBytes(context.Background(), root, opts...)
+	if err == nil {
+		_, err = out.Write(output)
+		return err
+	}
+
 	temp := bytes.Buffer{}
 	f := newFormatter(&temp, opts...)
-	err := f.formatTopLevel(root)
+	prefix, inPart := validPrefix(root, f.preserveErrors)
+
+	if f.formatRoot(prefix) != nil {
+		// Formatting stopped partway through a line, so the line is written as
+		// far as it goes.
+		f.varDef = None
+		f.endLine()
+	}
+
+	partial := temp.Bytes()
+	if len(partial) > 0 && !bytes.HasSuffix(partial, []byte("\n")) {
+		partial = append(partial, '\n')
+	}
+
+	indent := ""
+	if inPart && !f.minified && !f.noIndent {
+		indent = f.indentText
+	}
+
+	message := strings.Join(strings.Fields(err.Error()), " ")
+	partial = append(partial, fmt.Sprintf(
+		"%s# alda-format: formatting stopped here: %s\n", indent, message,
+	)...)
+
+	if !f.trailingNewline {
+		partial = bytes.TrimSuffix(partial, []byte("\n"))
+	}
+
+	if _, writeErr := out.Write(partial); writeErr != nil {
+		return writeErr
+	}
+
+	return err
+}
+
+// validPrefix returns a copy of an AST that's cut short just before its first
+// part or event that isn't valid (see validateAST), and whether it's cut
+// within a part declared by name, as opposed to at the top level. An AST that
+// is valid is returned as it is.
+func validPrefix(root ASTNode, allowErrors bool) (ASTNode, bool) {
+	valid := func(part ASTNode) bool {
+		return len(validateAST(
+			ASTNode{Type: RootNode, Children: []ASTNode{part}}, allowErrors, true,
+		)) == 0
+	}
+
+	withEvents := func(part ASTNode, events []ASTNode) ASTNode {
+		last := len(part.Children) - 1
+		part.Children = append([]ASTNode{}, part.Children...)
+		part.Children[last] = ASTNode{
+			Type:          part.Children[last].Type,
+			SourceContext: part.Children[last].SourceContext,
+			Children:      events,
+		}
+		return part
+	}
+
+	for i, part := range root.Children {
+		if valid(part) {
+			continue
+		}
+
+		prefix := root
+		prefix.Children = append([]ASTNode{}, root.Children[:i]...)
+
+		if len(part.Children) == 0 ||
+			part.Children[len(part.Children)-1].Type != EventSequenceNode {
+			return prefix, false
+		}
+
+		// The events before the first invalid one
+		events := part.Children[len(part.Children)-1].Children
+		j := 0
+		for j < len(events) && valid(withEvents(part, events[j:j+1])) {
+			j++
+		}
+
+		truncated := withEvents(part, events[:j])
+		if !valid(truncated) {
+			// The part itself is invalid, e.g. its declaration.
+			return prefix, false
+		}
+
+		prefix.Children = append(prefix.Children, truncated)
+		return prefix, part.Type == PartNode
+	}
+
+	return root, false
+}
+
+// formatASTToBytes formats an AST to a temporary buffer, rather than writing
+// directly to the output, so that nothing is written in case of error.
+func formatASTToBytes(
+	ctx context.Context, root ASTNode, opts ...formatterOption,
+) ([]byte, error) {
+	temp := bytes.Buffer{}
+	f := newFormatter(&temp, opts...)
+	f.ctx = ctx
+	if err := f.formatRoot(root); err != nil {
+		return nil, err
+	}
+
+	output := f.alignOutputBarlines(temp.Bytes())
+	if err := f.checkLineWidths(output); err != nil {
+		return nil, err
+	}
+
+	if !f.trailingNewline {
+		output = bytes.TrimSuffix(output, []byte("\n"))
+	}
+
+	return output, nil
+}
+
+// alignOutputBarlines aligns the barlines of the formatted output, if the
+// formatter is configured to (see ConfigureBarlineAlignment).
+func (f *formatter) alignOutputBarlines(output []byte) []byte {
+	if !f.alignBarlines || f.minified {
+		return output
+	}
+
+	return []byte(alignBarlines(string(output), f.tokenSeparator, f.softWrapLen))
+}
+
+// firstDifference returns the offset of the first byte where a and b differ,
+// or -1 if they're identical.
+func firstDifference(a []byte, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return len(a)
+		}
+		return len(b)
+	}
+
+	return -1
+}
+
+// FormatEvents formats a fragment of code consisting only of events, e.g. the
+// result of ParseEvents, in the same way as the events at the beginning of a
+// score that precede the first part declaration.
+func FormatEvents(
+	events []ASTNode, out io.Writer, opts ...formatterOption,
+) error {
+	root := ASTNode{
+		Type: RootNode,
+		Children: []ASTNode{{
+			Type: ImplicitPartNode,
+			Children: []ASTNode{{
+				Type: EventSequenceNode, Children: events,
+			}},
+		}},
+	}
+
+	return FormatASTToCode(root, out, opts...)
+}
+
+// maxIndentSamples is the number of indented lines that detectIndent inspects.
+const maxIndentSamples = 10
+
+// detectIndent returns the indentation used by the provided source code, based
+// on its first few indented lines. If most of those lines are indented with a
+// tab, the indentation is a tab. Otherwise, it is the smallest number of spaces
+// that any of the lines are indented with.
+//
+// Returns false if the source has no indented lines.
+func detectIndent(source string) (string, bool) {
+	tabs, spaces, minSpaces := 0, 0, 0
+
+	for _, line := range strings.Split(source, "\n") {
+		if tabs+spaces >= maxIndentSamples {
+			break
+		}
+
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || len(trimmed) == len(line) {
+			// The line is blank or not indented.
+			continue
+		}
+
+		if line[0] == '\t' {
+			tabs++
+			continue
+		}
+
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		spaces++
+		if minSpaces == 0 || n < minSpaces {
+			minSpaces = n
+		}
+	}
+
+	switch {
+	case tabs+spaces == 0:
+		return "", false
+	case tabs > spaces:
+		return "\t", true
+	default:
+		return strings.Repeat(" ", minSpaces), true
+	}
+}
+
+// FormatCode parses and formats a string of Alda source code.
+func FormatCode(source string, out io.Writer, opts ...formatterOption) error {
+	return formatSource("", source, out, opts...)
+}
+
+// Format reads all of the Alda source code from the provided reader, then
+// parses and formats it, e.g. for formatting code piped in via stdin. As with
+// FormatCode, parse errors include the position of the error in the source, and
+// nothing is written if reading, parsing or formatting fails.
+func Format(in io.Reader, out io.Writer, opts ...formatterOption) error {
+	source, err := io.ReadAll(in)
 	if err != nil {
 		return err
 	}
-	_, err = out.Write(temp.Bytes())
-	return err
+
+	return formatSource("", string(source), out, opts...)
+}
+
+// FormatFile parses and formats a file of Alda source code.
+func FormatFile(filepath string, out io.Writer, opts ...formatterOption) error {
+	source, err := readSourceFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	return formatSource(filepath, source, out, opts...)
+}
+
+// FormatDirectoryError is the error returned by FormatDirectory when some of
+// the files couldn't be formatted, e.g. because they don't parse.
+type FormatDirectoryError struct {
+	// Errors are the errors for each file that couldn't be formatted, in the
+	// order in which the files were walked.
+	Errors []error
+}
+
+func (e *FormatDirectoryError) Error() string {
+	messages := []string{}
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf(
+		"failed to format %d file(s):\n%s",
+		len(e.Errors), strings.Join(messages, "\n"),
+	)
+}
+
+// FormatDirectory formats each Alda file (i.e. each file ending in `.alda`)
+// within a directory and its subdirectories, in place, and returns the paths
+// of the files that were changed, in lexical order. Files that are already
+// formatted are left untouched.
+//
+// In a dry run, no files are changed, and the returned paths are the files
+// that would be changed.
+//
+// A file that can't be formatted, e.g. because it doesn't parse, is skipped,
+// and the rest of the files are still formatted. If any files were skipped,
+// the returned error is a *FormatDirectoryError with an error for each of
+// them.
+func FormatDirectory(
+	root string, dryRun bool, opts ...formatterOption,
+) ([]string, error) {
+	changed := []string{}
+	skipped := []error{}
+
+	err := filepath.WalkDir(
+		root,
+		func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if entry.IsDir() || filepath.Ext(path) != ".alda" {
+				return nil
+			}
+
+			source, err := readSourceFile(path)
+			if err != nil {
+				skipped = append(skipped, err)
+				return nil
+			}
+
+			formatted := bytes.Buffer{}
+			if err := formatSource(path, source, &formatted, opts...); err != nil {
+				skipped = append(skipped, err)
+				return nil
+			}
+
+			if formatted.String() == source {
+				return nil
+			}
+
+			if dryRun {
+				changed = append(changed, path)
+				return nil
+			}
+
+			info, err := entry.Info()
+			if err == nil {
+				err = os.WriteFile(path, formatted.Bytes(), info.Mode().Perm())
+			}
+			if err != nil {
+				skipped = append(skipped, err)
+				return nil
+			}
+
+			changed = append(changed, path)
+			return nil
+		},
+	)
+	if err != nil {
+		return changed, err
+	}
+
+	if len(skipped) > 0 {
+		return changed, &FormatDirectoryError{Errors: skipped}
+	}
+
+	return changed, nil
+}
+
+func formatSource(
+	filepath string, source string, out io.Writer, opts ...formatterOption,
+) error {
+	root, err := Parse(filepath, source)
+	if err != nil {
+		return err
+	}
+
+	// We apply the options to a throwaway formatter in order to find out whether
+	// we should detect the indentation of the source.
+	if newFormatter(nil, opts...).detectIndent {
+		if indentText, ok := detectIndent(source); ok {
+			// NB: The full slice expression avoids modifying the caller's slice.
+			opts = append(
+				opts[:len(opts):len(opts)], ConfigureIndentText(indentText),
+			)
+		}
+	}
+
+	return FormatASTToCode(root, out, opts...)
 }
@@ -0,0 +1,316 @@
+package parser_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"alda.io/client/model"
+	"alda.io/client/parser"
+	"alda.io/client/parser/builders"
+	_ "alda.io/client/testing"
+)
+
+// The formatter tests whose ASTs are built by hand rather than parsed, e.g. to
+// cover shapes that the parser doesn't produce. They're built with the builders
+// package, so they live outside of package parser, which builders imports. The
+// malformed ASTs that the builders can't produce are tested in format_test.go.
+
+// formatBuiltTestCase models a test of the formatter, where the built AST is
+// formatted with the default options.
+type formatBuiltTestCase struct {
+	label    string
+	built    parser.ASTNode
+	expected string
+}
+
+func executeFormatBuiltTestCases(
+	t *testing.T, testCases ...formatBuiltTestCase,
+) {
+	for _, testCase := range testCases {
+		buffer := bytes.Buffer{}
+		if err := parser.FormatASTToCode(testCase.built, &buffer); err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if actual := buffer.String(); actual != testCase.expected {
+			t.Error(testCase.label)
+			t.Errorf("expected:\n%q\nactual:\n%q", testCase.expected, actual)
+			continue
+		}
+
+		// The output parses without errors.
+		if _, err := parser.Parse("", buffer.String()); err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+		}
+	}
+}
+
+// formatBuiltErrorTestCase models a test of the formatter, where formatting
+// the built AST is expected to fail with the expected error.
+type formatBuiltErrorTestCase struct {
+	label    string
+	built    parser.ASTNode
+	expected string
+}
+
+func executeFormatBuiltErrorTestCases(
+	t *testing.T, testCases ...formatBuiltErrorTestCase,
+) {
+	for _, testCase := range testCases {
+		err := parser.FormatASTToCode(testCase.built, &bytes.Buffer{})
+		if err == nil {
+			t.Error(testCase.label)
+			t.Error("expected formatting to fail")
+			continue
+		}
+
+		if err.Error() != testCase.expected {
+			t.Error(testCase.label)
+			t.Errorf("expected error: %s\nactual error: %s", testCase.expected, err)
+		}
+	}
+}
+
+// score returns the root of a score consisting of the given events, without
+// any part declaration.
+func score(events ...parser.ASTNode) parser.ASTNode {
+	return builders.Root(builders.ImplicitPart(events...))
+}
+
+// number returns a Lisp number with the given literal, which can be of a type
+// that builders.Num doesn't take.
+func number(literal interface{}) parser.ASTNode {
+	number := builders.Num(0)
+	number.Literal = literal
+	return number
+}
+
+// withContext returns the node with the given source context, at a line and
+// column of piece.alda.
+func withContext(node parser.ASTNode, line int, column int) parser.ASTNode {
+	node.SourceContext = model.AldaSourceContext{
+		Filename: "piece.alda", Line: line, Column: column,
+	}
+	return node
+}
+
+func TestFormatBuiltEmptyEvents(t *testing.T) {
+	// These are left to the linter to complain about. The empty variable
+	// definition is written in a way that parses.
+	executeFormatBuiltTestCases(t, formatBuiltTestCase{
+		label: "empty chord and variable definition",
+		built: score(
+			builders.Chord(builders.Note('c')),
+			builders.Chord(),
+			builders.Note('c'),
+			builders.VarDef("riff"),
+		),
+		expected: "c c\nriff = []\n",
+	})
+}
+
+func TestFormatBuiltEmptyParts(t *testing.T) {
+	// A built part might have a nil rather than an empty event sequence.
+	empty := builders.Part("piano")
+	empty.Children[1].Children = []parser.ASTNode{}
+
+	executeFormatBuiltTestCases(
+		t,
+		formatBuiltTestCase{
+			label:    "part with a nil event sequence",
+			built:    builders.Root(builders.Part("piano")),
+			expected: "piano:\n",
+		},
+		formatBuiltTestCase{
+			label:    "part with an empty event sequence",
+			built:    builders.Root(empty),
+			expected: "piano:\n",
+		},
+	)
+}
+
+// The parser doesn't produce a duration that consists solely of a barline, but
+// it can come up in an AST that's built or transformed by other code. The
+// output has the barline as a separate event, which is played the same way.
+func TestFormatBuiltBarlineOnlyDuration(t *testing.T) {
+	barline := builders.Duration(builders.Barline())
+
+	executeFormatBuiltTestCases(
+		t,
+		formatBuiltTestCase{
+			label:    "note",
+			built:    score(builders.Note('c', barline), builders.Note('d')),
+			expected: "c | d\n",
+		},
+		formatBuiltTestCase{
+			label: "tied note",
+			built: score(
+				builders.Note('c', barline, builders.Tie()), builders.Note('d'),
+			),
+			expected: "c~ | d\n",
+		},
+		formatBuiltTestCase{
+			label:    "rest at the end of the score",
+			built:    score(builders.Rest(barline)),
+			expected: "r |\n",
+		},
+	)
+}
+
+// Notes and rests are written with the same note lengths, dots included.
+func TestFormatBuiltDots(t *testing.T) {
+	for dots, length := range []string{"4", "4.", "4..", "4..."} {
+		duration := builders.Dur(4, builders.Dots(int32(dots)))
+
+		executeFormatBuiltTestCases(
+			t,
+			formatBuiltTestCase{
+				label:    fmt.Sprintf("note with %d dots", dots),
+				built:    score(builders.Note('c', duration)),
+				expected: "c" + length + "\n",
+			},
+			formatBuiltTestCase{
+				label:    fmt.Sprintf("rest with %d dots", dots),
+				built:    score(builders.Rest(duration)),
+				expected: "r" + length + "\n",
+			},
+		)
+	}
+
+	negative := builders.Dur(4, builders.Dots(-1))
+
+	executeFormatBuiltErrorTestCases(
+		t,
+		formatBuiltErrorTestCase{
+			label:    "note with negative dots",
+			built:    score(builders.Note('c', negative)),
+			expected: "invalid number of dots: -1",
+		},
+		formatBuiltErrorTestCase{
+			label:    "rest with negative dots",
+			built:    score(builders.Rest(negative)),
+			expected: "invalid number of dots: -1",
+		},
+	)
+}
+
+func TestFormatBuiltLispNumbers(t *testing.T) {
+	// Code generators can use any integer type, which is written exactly.
+	for _, literal := range []interface{}{
+		int32(-3),
+		int64(9007199254740993),
+		int64(-9223372036854775808),
+		9007199254740993,
+	} {
+		executeFormatBuiltTestCases(t, formatBuiltTestCase{
+			label:    fmt.Sprintf("%T %v", literal, literal),
+			built:    score(builders.Lisp("tempo", number(literal))),
+			expected: fmt.Sprintf("(tempo %d)\n", literal),
+		})
+	}
+}
+
+func TestFormatBuiltPreserveLiteralsStaleSourceText(t *testing.T) {
+	for _, testCase := range []struct {
+		literal    parser.ASTNode
+		sourceText string
+		expected   string
+	}{
+		{builders.Num(0.5), "0.50", "(vol 0.50)\n"},
+		{builders.Num(0.75), "0.50", "(vol 0.75)\n"},
+		{builders.Num(0.5), "5e-1", "(vol 0.5)\n"},
+		{builders.Num(0.5), "", "(vol 0.5)\n"},
+		{builders.Str("a b"), `"a b"`, "(vol \"a b\")\n"},
+		{builders.Str("a b"), `"a c"`, "(vol \"a b\")\n"},
+		{builders.Str(`a" "b`), `"a" "b"`, "(vol \"a\\\" \\\"b\")\n"},
+	} {
+		literal := testCase.literal
+		literal.SourceText = testCase.sourceText
+
+		buffer := bytes.Buffer{}
+		err := parser.FormatASTToCode(
+			score(builders.Lisp("vol", literal)), &buffer,
+			parser.ConfigurePreserveLiterals(true),
+		)
+		if err != nil {
+			t.Errorf("%v %q: %v", literal.Literal, testCase.sourceText, err)
+			continue
+		}
+
+		if actual := buffer.String(); actual != testCase.expected {
+			t.Errorf(
+				"%v %q: expected:\n%s\nactual:\n%s",
+				literal.Literal, testCase.sourceText, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+func TestFormatBuiltErrors(t *testing.T) {
+	executeFormatBuiltErrorTestCases(
+		t,
+		formatBuiltErrorTestCase{
+			label: "unexpected node in a chord",
+			built: score(withContext(builders.Chord(
+				builders.Note('c'),
+				withContext(builders.Duration(), 42, 17),
+				builders.Note('e'),
+			), 42, 1)),
+			expected: "piece.alda:42:17 RootNode/ImplicitPartNode/" +
+				"EventSequenceNode/ChordNode/DurationNode: unexpected " +
+				"DurationNode in ChordNode",
+		},
+		formatBuiltErrorTestCase{
+			label: "unexpected duration component",
+			built: score(builders.Rest(withContext(
+				builders.Duration(withContext(builders.Tie(), 1, 3)), 1, 2,
+			))),
+			expected: "piece.alda:1:3 RootNode/ImplicitPartNode/" +
+				"EventSequenceNode/RestNode/DurationNode/TieNode: unexpected " +
+				"TieNode in DurationNode",
+		},
+		// Unlike a note, a rest can't be followed by a tie (or slur), e.g. `r4~`.
+		formatBuiltErrorTestCase{
+			label: "rest with a tie",
+			built: score(builders.Rest(builders.Dur(4), builders.Tie())),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/RestNode: " +
+				"expected RestNode to have 0 or 1 children, but it has 2",
+		},
+		formatBuiltErrorTestCase{
+			label: "lisp number with an unsupported literal",
+			built: score(builders.Lisp("vol", number("fifty"))),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/" +
+				"LispListNode/LispNumberNode: expected LispNumberNode to have " +
+				`a numeric literal, but it has string "fifty"`,
+		},
+		formatBuiltErrorTestCase{
+			label: "octave change after the last note of a chord",
+			built: score(
+				builders.Chord(builders.Note('c'), builders.OctaveUp()),
+			),
+			expected: "a chord must start and end on a note or rest",
+		},
+		formatBuiltErrorTestCase{
+			label: "duration without children",
+			built: score(builders.Cram(builders.Duration())),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/CramNode/" +
+				"DurationNode: expected DurationNode to have at least 1 child, " +
+				"but it has 0",
+		},
+		formatBuiltErrorTestCase{
+			label: "part alias containing a quote",
+			built: builders.Root(func() parser.ASTNode {
+				part := builders.AliasedPart("piano", `my "piano"`)
+				alias := &part.Children[0].Children[1]
+				*alias = withContext(*alias, 1, 7)
+				return part
+			}()),
+			expected: `piece.alda:1:7 invalid part alias: "my \"piano\"" ` +
+				`contains invalid character ' '`,
+		},
+	)
+}
@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FormatterOptionsFromConfig returns the formatter options that correspond to
+// EditorConfig-style settings (https://editorconfig.org), so that front ends
+// that read such settings, e.g. from a `.editorconfig` file, don't need to map
+// them to options themselves. Keys and values are case-insensitive. The keys
+// are:
+//
+//   - indent_style: "tab" or "space"
+//   - indent_size: the number of spaces per indentation level, if indenting
+//     with spaces, or "tab"
+//   - max_line_length: the soft wrap length (see ConfigureSoftWrapLen), or
+//     "off" to never wrap lines
+//   - insert_final_newline: "true" or "false" (see ConfigureTrailingNewline)
+//
+// An invalid value is an error. Other keys, e.g. charset, are an error if
+// strict is true, and are ignored otherwise.
+func FormatterOptionsFromConfig(
+	config map[string]string, strict bool,
+) ([]formatterOption, error) {
+	options := []formatterOption{}
+
+	// Iterate in a well-defined order, so that the first of several problems is
+	// always the one that's reported.
+	keys := []string{}
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	indentStyle, indentSize := "", 0
+
+	for _, key := range keys {
+		value := strings.ToLower(strings.TrimSpace(config[key]))
+
+		invalid := func(expected string) error {
+			return fmt.Errorf(
+				"invalid value for %s: %q, expected %s", key, config[key], expected,
+			)
+		}
+
+		switch strings.ToLower(key) {
+		case "indent_style":
+			if value != "tab" && value != "space" {
+				return nil, invalid("\"tab\" or \"space\"")
+			}
+			indentStyle = value
+
+		case "indent_size":
+			if value == "tab" {
+				continue
+			}
+
+			size, err := strconv.Atoi(value)
+			if err != nil || size < 1 {
+				return nil, invalid("a positive integer or \"tab\"")
+			}
+			indentSize = size
+
+		case "max_line_length":
+			if value == "off" {
+				options = append(options, ConfigureSoftWrapLen(math.MaxInt32))
+				continue
+			}
+
+			length, err := strconv.Atoi(value)
+			if err != nil || length < 1 {
+				return nil, invalid("a positive integer or \"off\"")
+			}
+			options = append(options, ConfigureSoftWrapLen(length))
+
+		case "insert_final_newline":
+			newline, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, invalid("\"true\" or \"false\"")
+			}
+			options = append(options, ConfigureTrailingNewline(newline))
+
+		default:
+			if strict {
+				return nil, fmt.Errorf("unknown formatter setting: %s", key)
+			}
+		}
+	}
+
+	switch {
+	case indentStyle == "tab":
+		options = append(options, ConfigureIndentText("\t"))
+	case indentSize > 0:
+		options = append(
+			options, ConfigureIndentText(strings.Repeat(" ", indentSize)),
+		)
+	}
+
+	return options, nil
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestFormatterOptionsFromConfig(t *testing.T) {
+	given := "piano: c8 d e f g a b > c < b a g f e d c d e f g a b > c"
+
+	for _, testCase := range []struct {
+		label    string
+		config   map[string]string
+		expected string
+	}{
+		{
+			label:    "no settings",
+			config:   map[string]string{},
+			expected: "piano:\n  c8 d e f g a b > c < b a g f e d c d e f g a b > c\n",
+		},
+		{
+			label:    "tabs",
+			config:   map[string]string{"indent_style": "tab", "indent_size": "4"},
+			expected: "piano:\n\tc8 d e f g a b > c < b a g f e d c d e f g a b > c\n",
+		},
+		{
+			label:  "spaces",
+			config: map[string]string{"indent_style": "space", "indent_size": "4"},
+			expected: "piano:\n" +
+				"    c8 d e f g a b > c < b a g f e d c d e f g a b > c\n",
+		},
+		{
+			label:  "size without a style",
+			config: map[string]string{"indent_size": "3"},
+			expected: "piano:\n" +
+				"   c8 d e f g a b > c < b a g f e d c d e f g a b > c\n",
+		},
+		{
+			label: "width",
+			config: map[string]string{
+				"indent_style": "Space", "indent_size": "4", "max_line_length": "30",
+			},
+			expected: "piano:\n" +
+				"    c8 d e f g a b > c < b a g\n" +
+				"    f e d c d e f g a b > c\n",
+		},
+		{
+			label: "no final newline, and keys that aren't formatter settings",
+			config: map[string]string{
+				"INSERT_FINAL_NEWLINE": "false", "charset": "utf-8",
+			},
+			expected: "piano:\n  c8 d e f g a b > c < b a g f e d c d e f g a b > c",
+		},
+	} {
+		opts, err := FormatterOptionsFromConfig(testCase.config, false)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.label, err)
+			continue
+		}
+
+		executeFormatTestCases(t, formatTestCase{
+			label:    testCase.label,
+			given:    given,
+			opts:     opts,
+			expected: testCase.expected,
+		})
+	}
+
+	for _, testCase := range []struct {
+		label    string
+		config   map[string]string
+		strict   bool
+		expected string
+	}{
+		{
+			label:  "invalid style",
+			config: map[string]string{"indent_style": "tabs"},
+			expected: "invalid value for indent_style: \"tabs\", expected \"tab\" " +
+				"or \"space\"",
+		},
+		{
+			label:  "invalid size",
+			config: map[string]string{"indent_size": "0"},
+			expected: "invalid value for indent_size: \"0\", expected a positive " +
+				"integer or \"tab\"",
+		},
+		{
+			label:  "invalid width",
+			config: map[string]string{"max_line_length": "wide"},
+			expected: "invalid value for max_line_length: \"wide\", expected a " +
+				"positive integer or \"off\"",
+		},
+		{
+			label:  "invalid final newline",
+			config: map[string]string{"insert_final_newline": "yes"},
+			expected: "invalid value for insert_final_newline: \"yes\", expected " +
+				"\"true\" or \"false\"",
+		},
+		{
+			label:    "unknown key when strict",
+			config:   map[string]string{"indent_size": "2", "charset": "utf-8"},
+			strict:   true,
+			expected: "unknown formatter setting: charset",
+		},
+	} {
+		_, err := FormatterOptionsFromConfig(testCase.config, testCase.strict)
+		if err == nil || err.Error() != testCase.expected {
+			t.Errorf(
+				"%s\nexpected: %q\nactual: %v",
+				testCase.label, testCase.expected, err,
+			)
+		}
+	}
+}
@@ -0,0 +1,1970 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+// formatTestCase models a test of the formatter, where the given Alda code is
+// parsed and then formatted with the provided options.
+type formatTestCase struct {
+	label    string
+	given    string
+	opts     []formatterOption
+	expected string
+}
+
+func executeFormatTestCases(t *testing.T, testCases ...formatTestCase) {
+	for _, testCase := range testCases {
+		ast, err := Parse(testCase.label, testCase.given, SuppressSourceContext)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		buffer := bytes.Buffer{}
+		if err := FormatASTToCode(ast, &buffer, testCase.opts...); err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if actual := buffer.String(); actual != testCase.expected {
+			t.Error(testCase.label)
+			t.Errorf("expected:\n%s\nactual:\n%s", testCase.expected, actual)
+		}
+	}
+}
+
+func TestFormatOverflowReporter(t *testing.T) {
+	type overflow struct {
+		line   int
+		length int
+	}
+
+	overflows := []overflow{}
+	reporter := ConfigureOverflowReporter(func(line int, length int) {
+		overflows = append(overflows, overflow{line, length})
+	})
+
+	executeFormatTestCases(t, formatTestCase{
+		label: "lisp list longer than the soft wrap length",
+		given: "piano: c d (key-signature '(e (flat) b (flat) a (flat))) e f",
+		opts:  []formatterOption{ConfigureSoftWrapLen(20), reporter},
+		expected: `piano:
+  c d
+  (key-signature '(e (flat) b (flat) a (flat)))
+  e f
+`,
+	})
+
+	// NB: deep.Equal ignores unexported fields, so we can't use it here.
+	expected := []overflow{{line: 3, length: 47}}
+	if !reflect.DeepEqual(expected, overflows) {
+		t.Errorf(
+			"expected overflows: %+v\nactual overflows: %+v", expected, overflows,
+		)
+	}
+}
+
+func TestFormatLongLispString(t *testing.T) {
+	lines := []int{}
+	reporter := ConfigureOverflowReporter(func(line int, length int) {
+		lines = append(lines, line)
+	})
+
+	// The string can't be broken at its spaces without changing it, so it's
+	// written as it is, and the line is reported.
+	executeFormatTestCases(t, formatTestCase{
+		label: "string argument longer than the soft wrap length",
+		given: `piano: c (lyrics "the quick brown fox jumps over the lazy dog") d`,
+		opts:  []formatterOption{ConfigureSoftWrapLen(30), reporter},
+		expected: `piano:
+  c
+  (lyrics "the quick brown fox jumps over the lazy dog")
+  d
+`,
+	})
+
+	if expected := []int{3}; !reflect.DeepEqual(expected, lines) {
+		t.Errorf("expected overflowing lines: %v\nactual: %v", expected, lines)
+	}
+}
+
+func TestFormatLineCallback(t *testing.T) {
+	type line struct {
+		lineNo int
+		text   string
+		nodes  []ASTNodeType
+	}
+
+	lines := []line{}
+	callback := ConfigureLineCallback(
+		func(lineNo int, text string, nodes []ASTNode) {
+			types := []ASTNodeType{}
+			for _, node := range nodes {
+				types = append(types, node.Type)
+			}
+			lines = append(lines, line{lineNo, text, types})
+		},
+	)
+
+	executeFormatTestCases(t, formatTestCase{
+		label: "lines mapped to the nodes they were formatted from",
+		given: "(tempo! 90)\npiano: c d/e [f g]*2 a",
+		opts:  []formatterOption{ConfigureSoftWrapLen(14), callback},
+		expected: `(tempo! 90)
+
+piano:
+  c d / e
+  [
+    f g
+  ] *2 a
+`,
+	})
+
+	expected := []line{
+		{1, "(tempo! 90)", []ASTNodeType{LispListNode}},
+		{2, "", []ASTNodeType{}},
+		{3, "piano:", []ASTNodeType{PartNode}},
+		// The chord separator is attributed to the chord, and the notes to
+		// themselves.
+		{4, "  c d / e", []ASTNodeType{NoteNode, NoteNode, ChordNode, NoteNode}},
+		{5, "  [", []ASTNodeType{EventSequenceNode}},
+		{6, "    f g", []ASTNodeType{NoteNode, NoteNode}},
+		{7, "  ] *2 a", []ASTNodeType{EventSequenceNode, RepeatNode, NoteNode}},
+	}
+	if !reflect.DeepEqual(expected, lines) {
+		t.Errorf("expected lines: %+v\nactual lines: %+v", expected, lines)
+	}
+}
+
+func TestFormatMaxLineWidth(t *testing.T) {
+	given := `piano:
+  c d (key-signature '(e (flat) b (flat) a (flat))) e f
+  (instrument-config {:channel 3 :patches [1 2]}) g a b`
+
+	ast, err := Parse("piece.alda", given)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The soft wrap length puts each Lisp list on a line of its own, but they're
+	// still longer than the maximum width.
+	buffer := bytes.Buffer{}
+	err = FormatASTToCode(
+		ast, &buffer, ConfigureSoftWrapLen(20), ConfigureMaxLineWidth(40),
+	)
+
+	expected := &LineWidthError{
+		MaxLineWidth: 40,
+		Lines:        []OverlongLine{{Line: 3, Length: 47}, {Line: 5, Length: 49}},
+	}
+	if !reflect.DeepEqual(expected, err) {
+		t.Errorf("expected error: %#v\nactual error: %#v", expected, err)
+	}
+
+	expectedMessage := "2 lines exceed the maximum line width of 40: " +
+		"line 3 (47), 5 (49)"
+	if err == nil || err.Error() != expectedMessage {
+		t.Errorf("expected error: %s\nactual error: %v", expectedMessage, err)
+	}
+
+	if buffer.Len() > 0 {
+		t.Errorf("expected no output, got:\n%s", buffer.String())
+	}
+
+	// A line may be exactly as long as the maximum width.
+	buffer.Reset()
+	err = FormatASTToCode(
+		ast, &buffer, ConfigureSoftWrapLen(20), ConfigureMaxLineWidth(49),
+	)
+	if err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+
+	expectedOutput := `piano:
+  c d
+  (key-signature '(e (flat) b (flat) a (flat)))
+  e f
+  (instrument-config {:channel 3 :patches [1 2]})
+  g a b
+`
+	if actual := buffer.String(); actual != expectedOutput {
+		t.Errorf("expected:\n%s\nactual:\n%s", expectedOutput, actual)
+	}
+
+	// Comments count, too.
+	comments := []SourceComment{}
+	ast, err = Parse(
+		"piece.alda",
+		"# a comment that is far too long\nc d",
+		CollectComments(&comments),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = FormatASTWithComments(
+		ast, comments, &bytes.Buffer{}, ConfigureMaxLineWidth(20),
+	)
+	if _, ok := err.(*LineWidthError); !ok {
+		t.Errorf("expected a *LineWidthError, got: %v", err)
+	}
+}
+
+type formatErrorTestCase struct {
+	label    string
+	given    ASTNode
+	expected string
+}
+
+func executeFormatErrorTestCases(
+	t *testing.T, testCases ...formatErrorTestCase,
+) {
+	for _, testCase := range testCases {
+		err := FormatASTToCode(testCase.given, &bytes.Buffer{})
+		if err == nil {
+			t.Error(testCase.label)
+			t.Error("expected formatting to fail")
+			continue
+		}
+
+		if err.Error() != testCase.expected {
+			t.Error(testCase.label)
+			t.Errorf("expected error: %s\nactual error: %s", testCase.expected, err)
+		}
+	}
+}
+
+func at(line int, column int) model.AldaSourceContext {
+	return model.AldaSourceContext{
+		Filename: "piece.alda", Line: line, Column: column,
+	}
+}
+
+func implicitPart(events ...ASTNode) ASTNode {
+	return ASTNode{
+		Type: RootNode,
+		Children: []ASTNode{{
+			Type: ImplicitPartNode,
+			Children: []ASTNode{
+				{Type: EventSequenceNode, Children: events},
+			},
+		}},
+	}
+}
+
+func TestFormatEmptyEvents(t *testing.T) {
+	// These are left to the linter to complain about.
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label: "empty event sequences",
+			given: "piano: c [] d [[]]*2 [e []'2]*2",
+			expected: "piano:\n  c [] d\n  [\n    []\n  ] *2\n" +
+				"  [\n    e [] '2\n  ] *2\n",
+		},
+		formatTestCase{
+			label:    "empty crams",
+			given:    "piano: c {}2 d {}",
+			expected: "piano:\n  c {}2 d {}\n",
+		},
+		formatTestCase{
+			label:    "variable defined as an empty event sequence",
+			given:    "riff = []\npiano: riff",
+			expected: "riff = []\n\npiano:\n  riff\n",
+		},
+	)
+}
+
+func TestFormatErrorPositions(t *testing.T) {
+	executeFormatErrorTestCases(
+		t,
+		formatErrorTestCase{
+			label: "note without children",
+			given: implicitPart(ASTNode{
+				Type: NoteNode, SourceContext: at(3, 5),
+			}),
+			expected: "piece.alda:3:5 RootNode/ImplicitPartNode/" +
+				"EventSequenceNode/NoteNode: expected NoteNode to have 1, 2 or " +
+				"3 children, but it has 0",
+		},
+		formatErrorTestCase{
+			label: "unexpected child node type",
+			given: implicitPart(ASTNode{
+				Type:          CramNode,
+				SourceContext: at(7, 2),
+				Children: []ASTNode{
+					{Type: NoteNode, SourceContext: at(7, 3)},
+				},
+			}),
+			expected: "piece.alda:7:3 RootNode/ImplicitPartNode/" +
+				"EventSequenceNode/CramNode/NoteNode: expected " +
+				"EventSequenceNode but got NoteNode",
+		},
+	)
+}
+
+func TestFormatUnknownNodes(t *testing.T) {
+	// A node of a type that the parser doesn't produce, e.g. one added by
+	// another tool, is written as its text.
+	note := ASTNode{Type: NoteNode, Children: []ASTNode{{
+		Type:     NoteLetterAndAccidentalsNode,
+		Children: []ASTNode{{Type: NoteLetterNode, Literal: 'c'}},
+	}}}
+	unknown := ASTNode{Type: numASTNodeTypes + 1, Literal: "(grace d)"}
+
+	root := implicitPart(
+		note, unknown, note,
+		ASTNode{Type: RepeatNode, Children: []ASTNode{
+			{Type: EventSequenceNode, Children: []ASTNode{unknown, note}},
+			{Type: TimesNode, Literal: int32(2)},
+		}},
+	)
+
+	buffer := bytes.Buffer{}
+	if err := FormatASTToCode(root, &buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "c (grace d) c\n[\n  (grace d) c\n] *2\n"
+	if actual := buffer.String(); actual != expected {
+		t.Errorf("expected:\n%q\nactual:\n%q", expected, actual)
+	}
+
+	// Otherwise, formatting fails as usual.
+	executeFormatErrorTestCases(
+		t,
+		formatErrorTestCase{
+			label: "unknown node without text",
+			given: implicitPart(ASTNode{Type: numASTNodeTypes + 1}),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/64 (String " +
+				"not implemented): unexpected 64 (String not implemented) in " +
+				"EventSequenceNode",
+		},
+		formatErrorTestCase{
+			label: "unknown node where an event can't be",
+			given: implicitPart(ASTNode{
+				Type: ChordNode, Children: []ASTNode{note, unknown, note},
+			}),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/ChordNode/" +
+				"64 (String not implemented): unexpected 64 (String not " +
+				`implemented) "(grace d)" in ChordNode`,
+		},
+		formatErrorTestCase{
+			label: "trailing unknown node at the top level",
+			given: ASTNode{Type: RootNode, Children: append(
+				implicitPart(note).Children, unknown,
+			)},
+			expected: "RootNode/64 (String not implemented): unexpected 64 " +
+				`(String not implemented) "(grace d)" in RootNode`,
+		},
+	)
+
+	// Even without validation, a node at the top level that isn't a part is
+	// rejected, rather than being skipped and leaving a blank line after the
+	// last part.
+	buffer.Reset()
+	f := newFormatter(&buffer)
+	err := f.formatTopLevel(ASTNode{Type: RootNode, Children: append(
+		implicitPart(note).Children, unknown,
+	)})
+	if err == nil {
+		t.Fatalf("expected an error, got output:\n%q", buffer.String())
+	}
+
+	expected = "unexpected 64 (String not implemented) \"(grace d)\" at the " +
+		"top level of a score"
+	if err.Error() != expected {
+		t.Errorf("expected error:\n%s\nactual:\n%v", expected, err)
+	}
+}
+
+func TestFormatMinified(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label: "minified parts, chords, and event sequences",
+			given: `
+piano:
+  o4 c8 d e/g/>c
+  [c d]*2 {e f g}4 o5
+  [c d] | r2.
+
+violin "v": V1: c V2: e V0: (vol 50)`,
+			opts: []formatterOption{ConfigureMinified(true)},
+			expected: "piano: o4 c8 d e/g/>c [c d]*2 {e f g}4 o5 [c d] | r2. " +
+				"violin \"v\": V1: c V2: e V0: (vol 50)\n",
+		},
+		formatTestCase{
+			label: "minified variable definitions end their lines",
+			given: `
+riff = c8 d [e f]
+piano: riff o4 riff*2`,
+			opts:     []formatterOption{ConfigureMinified(true)},
+			expected: "riff = c8 d [e f]\npiano: riff o4 riff*2\n",
+		},
+	)
+}
+
+func TestFormatMinifiedRoundTripExamples(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	examplesDir := filepath.Join(filepath.Dir(filepath.Dir(dir)), "examples")
+
+	paths, err := filepath.Glob(filepath.Join(examplesDir, "*.alda"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		ast, err := ParseFile(path)
+		if err != nil {
+			t.Error(path)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		buffer := bytes.Buffer{}
+		err = FormatASTToCode(ast, &buffer, ConfigureMinified(true))
+		if err != nil {
+			t.Error(path)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		minifiedAST, err := ParseString(buffer.String())
+		if err != nil {
+			t.Error(path)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if !ASTEqual(ast, minifiedAST, IgnoreSourceContext) {
+			t.Error(path)
+			for _, diffItem := range Diff(ast, minifiedAST) {
+				t.Errorf("%v", diffItem)
+			}
+		}
+	}
+}
+
+func TestFormatErrorMessages(t *testing.T) {
+	executeFormatErrorTestCases(
+		t,
+		formatErrorTestCase{
+			label: "unexpected node type with children",
+			given: implicitPart(ASTNode{
+				Type: RestNode,
+				Children: []ASTNode{{
+					Type:          TieNode,
+					SourceContext: at(12, 4),
+					Children:      []ASTNode{{Type: TieNode}, {Type: TieNode}},
+				}},
+			}),
+			expected: "piece.alda:12:4 RootNode/ImplicitPartNode/" +
+				"EventSequenceNode/RestNode/TieNode: expected DurationNode but " +
+				"got TieNode (2 children)",
+		},
+		formatErrorTestCase{
+			label: "unexpected node with a long literal",
+			given: implicitPart(ASTNode{
+				Type:    VariableNameNode,
+				Literal: "a-very-long-variable-name-indeed",
+			}),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/" +
+				`VariableNameNode: unexpected VariableNameNode ` +
+				`"a-very-long-variable..." in EventSequenceNode`,
+		},
+		formatErrorTestCase{
+			label: "unexpected node with a single child",
+			given: implicitPart(ASTNode{
+				Type:     PartNamesNode,
+				Children: []ASTNode{{Type: PartNameNode, Literal: "piano"}},
+			}),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/" +
+				"PartNamesNode: unexpected PartNamesNode (1 child) in " +
+				"EventSequenceNode",
+		},
+		formatErrorTestCase{
+			label: "unexpected number of children",
+			given: implicitPart(ASTNode{
+				Type:     RepeatNode,
+				Children: []ASTNode{{Type: BarlineNode}},
+			}),
+			expected: "RootNode/ImplicitPartNode/EventSequenceNode/" +
+				"RepeatNode: expected RepeatNode to have 2 children, but it " +
+				"has 1",
+		},
+	)
+}
+
+func TestFormatEscaping(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "lisp string with quotes and backslashes",
+			given:    `(print "say \"hi\" \\ bye")`,
+			expected: "(print \"say \\\"hi\\\" \\\\ bye\")\n",
+		},
+		formatTestCase{
+			label:    "lisp string with an unescaped backslash",
+			given:    `(print "a\b")`,
+			expected: "(print \"a\\\\b\")\n",
+		},
+		formatTestCase{
+			label:    "lisp string with escaped whitespace",
+			given:    `(print "line 1\nline 2\ttabbed\r")`,
+			expected: "(print \"line 1\\nline 2\\ttabbed\\r\")\n",
+		},
+		formatTestCase{
+			label:    "lisp string with a literal newline",
+			given:    "(print \"line 1\nline 2\")",
+			expected: "(print \"line 1\\nline 2\")\n",
+		},
+		formatTestCase{
+			label:    "part alias with every allowed punctuation character",
+			given:    `piano "a_b-c+d'e(f).g": c`,
+			expected: "piano \"a_b-c+d'e(f).g\":\n  c\n",
+		},
+	)
+}
+
+func TestFormatLispNumbers(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "negative integer",
+			given:    "(transpose -3)",
+			expected: "(transpose -3)\n",
+		},
+		formatTestCase{
+			label:    "float",
+			given:    "(tempo 1.5)",
+			expected: "(tempo 1.5)\n",
+		},
+		formatTestCase{
+			label:    "negative float",
+			given:    "(pan -0.25)",
+			expected: "(pan -0.25)\n",
+		},
+		formatTestCase{
+			label:    "large integer",
+			given:    "(tempo 123456789012)",
+			expected: "(tempo 123456789012)\n",
+		},
+	)
+}
+
+func TestFormatLispLiterals(t *testing.T) {
+	for _, given := range []string{
+		`(key-signature "f+ c+ g+")`,
+		`(key-signature '(a major))`,
+		`(key-signature '(e (flat) b (flat)))`,
+		`(key-signature [:a :major])`,
+		`(key-signature '[:e :flat :minor])`,
+		`(key-signature {:f [:sharp] :c [:sharp]})`,
+		`(instrument-config {:midi-channel 3 :patches '[1 2] :name "lead"})`,
+		`(print '(a '(b ''c)) :done)`,
+	} {
+		executeFormatTestCases(t, formatTestCase{
+			label:    given,
+			given:    given,
+			expected: given + "\n",
+		})
+	}
+
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "whitespace is normalized",
+			given:    "(key-signature  [ :a\n  :major ] ) ( f {\n:a 1 } )",
+			expected: "(key-signature [:a :major]) (f {:a 1})\n",
+		},
+		formatTestCase{
+			label: "long forms are not wrapped",
+			given: "(instrument-config {:channel 3 :patches [1 2 3 4 5 6 7 8 9 10]})",
+			opts:  []formatterOption{ConfigureSoftWrapLen(20)},
+			expected: "(instrument-config {:channel 3 " +
+				":patches [1 2 3 4 5 6 7 8 9 10]})\n",
+		},
+	)
+}
+
+func TestFormatIdentity(t *testing.T) {
+	given := "piano: o4 c8 d e f | g2 (tempo 120) [c e g]*2"
+
+	expected := bytes.Buffer{}
+	ast, err := Parse("", given, SuppressSourceContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := FormatASTToCode(ast, &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "identity option",
+			given:    given,
+			opts:     []formatterOption{Identity()},
+			expected: expected.String(),
+		},
+		formatTestCase{
+			label: "identity option combined with other options",
+			given: "piano: c d e",
+			opts: []formatterOption{
+				Identity(), ConfigureIndentText("\t"), Identity(),
+			},
+			expected: "piano:\n\tc d e\n",
+		},
+	)
+}
+
+func TestFormatDetectIndent(t *testing.T) {
+	detect := ConfigureDetectIndent(true)
+
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		opts     []formatterOption
+		expected string
+	}{
+		{
+			label:    "tab-indented source",
+			given:    "piano:\n\tc d e\n\tV1: f\n",
+			opts:     []formatterOption{detect},
+			expected: "piano:\n\tc d e\n\tV1:\n\t\tf\n",
+		},
+		{
+			label:    "two-space-indented source",
+			given:    "piano:\n  c d e\n    f\n",
+			opts:     []formatterOption{detect, ConfigureIndentText("\t")},
+			expected: "piano:\n  c d e f\n",
+		},
+		{
+			label:    "four-space-indented source",
+			given:    "piano:\n    c d e\n\nviolin:\n    f\n",
+			opts:     []formatterOption{detect},
+			expected: "piano:\n    c d e\n\nviolin:\n    f\n",
+		},
+		{
+			label:    "mostly tab-indented source",
+			given:    "piano:\n\tc\n\td\n  e\n",
+			opts:     []formatterOption{detect},
+			expected: "piano:\n\tc d e\n",
+		},
+		{
+			label:    "source without indentation falls back to the indent text",
+			given:    "piano: c d e",
+			opts:     []formatterOption{detect, ConfigureIndentText("   ")},
+			expected: "piano:\n   c d e\n",
+		},
+		{
+			label:    "indentation disabled",
+			given:    "piano:\n\tc d e\n\tV1: f\n",
+			opts:     []formatterOption{detect, ConfigureNoIndent(true)},
+			expected: "piano:\nc d e\nV1:\nf\n",
+		},
+		{
+			label:    "detection disabled",
+			given:    "piano:\n\tc d e\n",
+			opts:     []formatterOption{ConfigureDetectIndent(false)},
+			expected: "piano:\n  c d e\n",
+		},
+	} {
+		buffer := bytes.Buffer{}
+		err := FormatCode(testCase.given, &buffer, testCase.opts...)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if actual := buffer.String(); actual != testCase.expected {
+			t.Error(testCase.label)
+			t.Errorf("expected:\n%q\nactual:\n%q", testCase.expected, actual)
+		}
+	}
+}
+
+func TestFormatFileDetectIndent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "score.alda")
+	if err := os.WriteFile(path, []byte("piano:\n\tc d e\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := bytes.Buffer{}
+	if err := FormatFile(path, &buffer, ConfigureDetectIndent(true)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "piano:\n\tc d e\n"
+	if actual := buffer.String(); actual != expected {
+		t.Errorf("expected:\n%q\nactual:\n%q", expected, actual)
+	}
+}
+
+func TestFormatDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"formatted.alda":            "piano:\n  c d e\n",
+		"unformatted.alda":          "piano: c    d e",
+		"invalid.alda":              "piano: c d )",
+		"notes.txt":                 "piano: c    d e",
+		"songs/unformatted.alda":    "violin:   f g",
+		"songs/more/formatted.alda": "cello:\n  a b\n",
+	}
+
+	write := func() {
+		for name, contents := range files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	read := func(name string) string {
+		contents, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(contents)
+	}
+
+	expectedChanged := []string{
+		filepath.Join(dir, "songs/unformatted.alda"),
+		filepath.Join(dir, "unformatted.alda"),
+	}
+
+	checkErr := func(err error) {
+		var dirErr *FormatDirectoryError
+		if !errors.As(err, &dirErr) || len(dirErr.Errors) != 1 ||
+			!strings.Contains(dirErr.Errors[0].Error(), "invalid.alda") {
+			t.Errorf("expected an error for invalid.alda, got: %v", err)
+		}
+	}
+
+	write()
+
+	changed, err := FormatDirectory(dir, true)
+	checkErr(err)
+	if !reflect.DeepEqual(expectedChanged, changed) {
+		t.Errorf("dry run\nexpected: %q\nactual: %q", expectedChanged, changed)
+	}
+	for name, contents := range files {
+		if actual := read(name); actual != contents {
+			t.Errorf("dry run changed %s: %q", name, actual)
+		}
+	}
+
+	changed, err = FormatDirectory(dir, false)
+	checkErr(err)
+	if !reflect.DeepEqual(expectedChanged, changed) {
+		t.Errorf("expected: %q\nactual: %q", expectedChanged, changed)
+	}
+
+	expectedContents := map[string]string{
+		"formatted.alda":            files["formatted.alda"],
+		"unformatted.alda":          "piano:\n  c d e\n",
+		"invalid.alda":              files["invalid.alda"],
+		"notes.txt":                 files["notes.txt"],
+		"songs/unformatted.alda":    "violin:\n  f g\n",
+		"songs/more/formatted.alda": files["songs/more/formatted.alda"],
+	}
+	for name, expected := range expectedContents {
+		if actual := read(name); actual != expected {
+			t.Errorf("%s\nexpected: %q\nactual: %q", name, expected, actual)
+		}
+	}
+
+	// Once formatted, there's nothing left to change.
+	changed, _ = FormatDirectory(dir, true)
+	if len(changed) != 0 {
+		t.Errorf("expected no changes, got: %q", changed)
+	}
+}
+
+func TestFormatDefaults(t *testing.T) {
+	given := "piano: V1: c d e f g a b > c d e f g a b > c d e f g a b > c d e f g"
+
+	expected := bytes.Buffer{}
+	if err := FormatCode(given, &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	executeFormatTestCases(t, formatTestCase{
+		label: "explicit defaults",
+		given: given,
+		opts: []formatterOption{
+			ConfigureSoftWrapLen(DefaultSoftWrap),
+			ConfigureIndentText(DefaultIndentText),
+		},
+		expected: expected.String(),
+	})
+}
+
+func TestFormatNestedCrams(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "cram",
+			given:    "{c d}",
+			expected: "{ c d }\n",
+		},
+		formatTestCase{
+			label:    "cram with a duration",
+			given:    "{c d}4",
+			expected: "{ c d }4\n",
+		},
+		formatTestCase{
+			label:    "nested cram",
+			given:    "{{c d} e}",
+			expected: "{ { c d } e }\n",
+		},
+		formatTestCase{
+			label:    "nested cram with a duration on the outer cram",
+			given:    "{{c d} e}4",
+			expected: "{ { c d } e }4\n",
+		},
+		formatTestCase{
+			label:    "nested cram with a duration on the inner cram",
+			given:    "{{c d}2 e}",
+			expected: "{ { c d }2 e }\n",
+		},
+		formatTestCase{
+			label:    "nested cram with durations on both crams",
+			given:    "{{c d}2 e}4",
+			expected: "{ { c d }2 e }4\n",
+		},
+		formatTestCase{
+			label:    "nested cram at the end of the outer cram",
+			given:    "{c {d e}8}4",
+			expected: "{ c { d e }8 }4\n",
+		},
+		formatTestCase{
+			label:    "doubly nested cram with durations",
+			given:    "{{{c d}8 e} f}2",
+			expected: "{ { { c d }8 e } f }2\n",
+		},
+		formatTestCase{
+			label:    "nested cram with a tied duration",
+			given:    "piano: {{c d}4 e}2~4 f",
+			expected: "piano:\n  { { c d }4 e }2~4 f\n",
+		},
+	)
+
+	// However the lines are wrapped, the braces must stay paired and each
+	// duration must stay attached to its cram.
+	for _, given := range []string{
+		"{{c d} e}4",
+		"{{c d}2 e}4",
+		"{c {d e}8}4",
+		"{{{c d}8 e} f}2",
+		"piano: {{c d}4 e}2~4 f",
+	} {
+		ast, err := Parse(given, given, SuppressSourceContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for wrapLen := 1; wrapLen <= 20; wrapLen++ {
+			buffer := bytes.Buffer{}
+			err := FormatASTToCode(ast, &buffer, ConfigureSoftWrapLen(wrapLen))
+			if err != nil {
+				t.Errorf("%s (wrap length %d): %v", given, wrapLen, err)
+				continue
+			}
+
+			formattedAST, err := Parse(
+				given, buffer.String(), SuppressSourceContext,
+			)
+			if err != nil {
+				t.Errorf("%s (wrap length %d): %v", given, wrapLen, err)
+				continue
+			}
+
+			if !Equal(ast, formattedAST) {
+				t.Errorf("%s (wrap length %d):\n%s", given, wrapLen, buffer.String())
+				for _, diffItem := range Diff(ast, formattedAST) {
+					t.Errorf("%v", diffItem)
+				}
+			}
+		}
+	}
+}
+
+func TestFormatLongCrams(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "short cram stays inline",
+			given:    "piano: c d {c d e}4 e f",
+			opts:     []formatterOption{ConfigureSoftWrapLen(20)},
+			expected: "piano:\n  c d { c d e }4 e f\n",
+		},
+		formatTestCase{
+			label:    "short cram is wrapped as a whole",
+			given:    "piano: c d e f g {c d e}4 e f",
+			opts:     []formatterOption{ConfigureSoftWrapLen(20)},
+			expected: "piano:\n  c d e f g\n  { c d e }4 e f\n",
+		},
+		formatTestCase{
+			label: "long cram body is indented",
+			given: "piano: c d {c d e f g a b > c d e f g a b > c d e f g a b > " +
+				"c d e f g a b > c d e f g a b > c}2 e f",
+			expected: `piano:
+  c d
+  {
+    c d e f g a b > c d e f g a b > c d e f g a b > c d e f g a b > c d e f g a
+    b > c
+  }2 e f
+`,
+		},
+		formatTestCase{
+			label: "long cram with a tied duration across a barline",
+			given: "piano: {c d e f g a b > c d e f g a b > c d e f g a b}2 | ~2 f",
+			opts:  []formatterOption{ConfigureSoftWrapLen(30)},
+			expected: `piano:
+  {
+    c d e f g a b > c d e f g
+    a b > c d e f g a b
+  }2 | ~2 f
+`,
+		},
+		formatTestCase{
+			label: "long cram containing a short cram",
+			given: "piano: {c d {e f}8 g a b > c d e f g a b}2 c",
+			opts:  []formatterOption{ConfigureSoftWrapLen(30)},
+			expected: `piano:
+  {
+    c d { e f }8 g a b > c d e
+    f g a b
+  }2 c
+`,
+		},
+		formatTestCase{
+			label: "long cram containing a long cram",
+			given: "piano: {c d {e f g a b > c d e f g a b}8 > c d e f g}2~4 e f",
+			opts:  []formatterOption{ConfigureSoftWrapLen(30)},
+			expected: `piano:
+  {
+    c d
+    {
+      e f g a b > c d e f g a
+      b
+    }8 > c d e f g
+  }2~4 e f
+`,
+		},
+		formatTestCase{
+			label: "long cram at the end of a variable definition",
+			given: "riff = c {c d e f g a b > c d e f g a b > c d e f g a b}2",
+			opts:  []formatterOption{ConfigureSoftWrapLen(30)},
+			expected: `riff = c {
+  c d e f g a b > c d e f g a
+  b > c d e f g a b
+}2
+`,
+		},
+		formatTestCase{
+			label: "long cram in the middle of a variable definition",
+			given: "riff = {c d e f g a b > c d e f g a b > c d e f g a b}2 c",
+			opts:  []formatterOption{ConfigureSoftWrapLen(30)},
+			expected: "riff = { c d e f g a b > c d e f g a b > c d e f g a b }2 " +
+				"c\n",
+		},
+	)
+}
+
+func TestFormatSingleValueVariableDefinitions(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "single note",
+			given:    "foo = c\npiano: foo",
+			expected: "foo = c\n\npiano:\n  foo\n",
+		},
+		formatTestCase{
+			label:    "single event sequence",
+			given:    "foo = [c d]\npiano: foo",
+			expected: "foo = [\n  c d\n]\n\npiano:\n  foo\n",
+		},
+		formatTestCase{
+			label:    "single repeated event sequence",
+			given:    "foo = [c d]*2",
+			expected: "foo = [\n  c d\n] *2\n",
+		},
+		formatTestCase{
+			label:    "single Lisp form",
+			given:    "foo = (vol 50)",
+			expected: "foo = (vol 50)\n",
+		},
+	)
+}
+
+func TestFormatLongVariableDefinitions(t *testing.T) {
+	melody := strings.Repeat("c8 d e f g a b > ", 12) + "c"
+
+	overflows := []int{}
+	reporter := ConfigureOverflowReporter(func(line int, length int) {
+		overflows = append(overflows, line)
+	})
+
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			// The events of a variable definition must all begin on the same line as
+			// the name, so they can't be wrapped onto the following lines.
+			label:    "long flat definition stays on one line",
+			given:    "riff = " + melody + "\npiano: riff",
+			opts:     []formatterOption{reporter},
+			expected: "riff = " + melody + "\n\npiano:\n  riff\n",
+		},
+		formatTestCase{
+			// A definition whose last event is an event sequence can continue on the
+			// following lines, so a long melody can be written that way instead.
+			label: "long definition ending with an event sequence wraps",
+			given: "riff = [" + melody + "]\npiano: riff",
+			opts:  []formatterOption{reporter},
+			expected: `riff = [
+  c8 d e f g a b > c8 d e f g a b > c8 d e f g a b > c8 d e f g a b > c8 d e f g
+  a b > c8 d e f g a b > c8 d e f g a b > c8 d e f g a b > c8 d e f g a b > c8 d
+  e f g a b > c8 d e f g a b > c8 d e f g a b > c
+]
+
+piano:
+  riff
+`,
+		},
+	)
+
+	if !reflect.DeepEqual([]int{1}, overflows) {
+		t.Errorf("expected an overflow on line 1 only, but got %v", overflows)
+	}
+
+	// Either way, the formatted definition must still define the same events.
+	for _, given := range []string{
+		"riff = " + melody,
+		"riff = [" + melody + "]",
+	} {
+		ast, err := Parse("", given, SuppressSourceContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buffer := bytes.Buffer{}
+		if err := FormatASTToCode(ast, &buffer); err != nil {
+			t.Fatal(err)
+		}
+
+		formattedAST, err := Parse("", buffer.String(), SuppressSourceContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !Equal(ast, formattedAST) {
+			for _, diffItem := range Diff(ast, formattedAST) {
+				t.Errorf("%v", diffItem)
+			}
+		}
+	}
+}
+
+func TestFormatRests(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "rest without a duration",
+			given:    "r",
+			expected: "r\n",
+		},
+		formatTestCase{
+			label:    "rest with a dotted note length",
+			given:    "r2.",
+			expected: "r2.\n",
+		},
+		formatTestCase{
+			label:    "rest with tied note lengths",
+			given:    "r4~4 r4~8",
+			expected: "r4~4 r4~8\n",
+		},
+		formatTestCase{
+			label:    "rest with a millisecond duration",
+			given:    "r500ms",
+			expected: "r500ms\n",
+		},
+		formatTestCase{
+			label:    "rest with tied seconds and milliseconds",
+			given:    "r1s~500ms",
+			expected: "r1s~500ms\n",
+		},
+		formatTestCase{
+			label:    "rest tied across a barline",
+			given:    "r2~|4",
+			expected: "r2 | ~4\n",
+		},
+	)
+}
+
+// In a percussion part, each note stands for a drum (i.e. a MIDI note number)
+// rather than a pitch, so its letter and accidentals are written as they are,
+// even when other options rewrite the events around them.
+func TestFormatPercussionNoteLetters(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label: "percussion part",
+			given: "percussion: o2 c+ e_ f+ b-- (key-sig \"f+\") f_8 a-4~8 c+",
+			opts: []formatterOption{
+				ConfigureSimplifyDurations(true),
+				ConfigureKeySignatureStyle(KeySignatureList),
+			},
+			expected: "percussion:\n" +
+				"  o2 c+ e_ f+ b-- (key-sig '(f (sharp))) f_8 a-4. c+\n",
+		},
+		formatTestCase{
+			label: "respelled notes, leaving percussion parts alone",
+			given: "percussion: (key-sig \"f+\") g- a-\n" +
+				"piano: (key-sig \"f+\") g- a- c-",
+			opts: []formatterOption{ConfigureRespellNotes(true)},
+			expected: "percussion:\n  (key-sig \"f+\") g- a-\n\n" +
+				"piano:\n  (key-sig \"f+\") f+ g+ c-\n",
+		},
+		formatTestCase{
+			label: "respelled notes, leaving a percussion alias alone",
+			given: "percussion \"drums\": (key-sig \"f+\") a-\n" +
+				"drums: b-\nviolin: (key-sig \"f+\") b-",
+			opts: []formatterOption{ConfigureRespellNotes(true)},
+			expected: "percussion \"drums\":\n  (key-sig \"f+\") a-\n\n" +
+				"drums:\n  b-\n\nviolin:\n  (key-sig \"f+\") a+\n",
+		},
+		formatTestCase{
+			label: "respelled notes, in a variable that percussion plays",
+			given: "riff = b-\npiano: (key-sig \"f+\") riff a-\n" +
+				"percussion: (key-sig \"f+\") riff",
+			opts: []formatterOption{ConfigureRespellNotes(true)},
+			expected: "riff = b-\n\npiano:\n  (key-sig \"f+\") riff g+\n\n" +
+				"percussion:\n  (key-sig \"f+\") riff\n",
+		},
+		formatTestCase{
+			label: "respelled notes, including percussion parts",
+			given: "riff = b-\npiano: (key-sig \"f+\") riff\n" +
+				"percussion: (key-sig \"f+\") riff g-",
+			opts: []formatterOption{
+				ConfigureRespellNotes(true),
+				ConfigureDrumNameStyle(DrumNamesRespelled),
+			},
+			expected: "riff = a+\n\npiano:\n  (key-sig \"f+\") riff\n\n" +
+				"percussion:\n  (key-sig \"f+\") riff f+\n",
+		},
+		formatTestCase{
+			label:    "drum names without respelling notes",
+			given:    "percussion: (key-sig \"f+\") g-",
+			opts:     []formatterOption{ConfigureDrumNameStyle(DrumNamesRespelled)},
+			expected: "percussion:\n  (key-sig \"f+\") g-\n",
+		},
+	)
+}
+
+func TestFormatDeterministic(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	examplesDir := filepath.Join(filepath.Dir(filepath.Dir(dir)), "examples")
+
+	paths, err := filepath.Glob(filepath.Join(examplesDir, "*.alda"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		ast, err := ParseFile(path)
+		if err != nil {
+			t.Error(path)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		expected := bytes.Buffer{}
+		if err := FormatASTToCode(ast, &expected); err != nil {
+			t.Error(path)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if bytes.HasPrefix(expected.Bytes(), []byte("\xef\xbb\xbf")) {
+			t.Error(path)
+			t.Error("expected the output not to begin with a byte order mark")
+		}
+
+		for i := 0; i < 100; i++ {
+			actual := bytes.Buffer{}
+			if err := FormatASTToCode(ast, &actual); err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+				t.Error(path)
+				t.Errorf("expected identical output on attempt %d", i+1)
+				break
+			}
+		}
+	}
+}
+
+func TestFormatTrailingNewline(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "trailing newline by default",
+			given:    "piano: c d e",
+			expected: "piano:\n  c d e\n",
+		},
+		formatTestCase{
+			label:    "trailing newline",
+			given:    "piano: c d e\nviolin: f",
+			opts:     []formatterOption{ConfigureTrailingNewline(true)},
+			expected: "piano:\n  c d e\n\nviolin:\n  f\n",
+		},
+		formatTestCase{
+			label:    "no trailing newline",
+			given:    "piano: c d e\nviolin: f",
+			opts:     []formatterOption{ConfigureTrailingNewline(false)},
+			expected: "piano:\n  c d e\n\nviolin:\n  f",
+		},
+		formatTestCase{
+			label:    "no trailing newline after a variable definition",
+			given:    "riff = c d e",
+			opts:     []formatterOption{ConfigureTrailingNewline(false)},
+			expected: "riff = c d e",
+		},
+		formatTestCase{
+			label: "no trailing newline when minified",
+			given: "piano: c d e\nviolin: f",
+			opts: []formatterOption{
+				ConfigureMinified(true), ConfigureTrailingNewline(false),
+			},
+			expected: "piano: c d e violin: f",
+		},
+		formatTestCase{
+			label:    "empty score",
+			given:    "",
+			opts:     []formatterOption{ConfigureTrailingNewline(true)},
+			expected: "",
+		},
+	)
+}
+
+func TestFormatPreserveLiterals(t *testing.T) {
+	for _, given := range []string{
+		"piano:\n  o04 c0.50.. d500.0ms e2.50s f01~0.50 | g1.0s~0250ms\n",
+		"piano:\n  V01:\n    [\n      c d\n    ] *02\n" +
+			"  V2:\n    [\n      e f '01-2,03 g '2\n    ] *3\n",
+		"(vol 0.50) (pan -3.50) (tempo! 090)\n",
+		"(print \"tab:\\t quote:\\\" backslash:\\\\ other:\\q\")\n",
+		"(transpose +3)\n",
+		"{ c0.50 d }02 e *03\n",
+	} {
+		ast, err := Parse("literals", given)
+		if err != nil {
+			t.Error(given)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		buffer := bytes.Buffer{}
+		err = FormatASTToCode(ast, &buffer, ConfigurePreserveLiterals(true))
+		if err != nil {
+			t.Error(given)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if actual := buffer.String(); actual != given {
+			t.Errorf("expected:\n%s\nactual:\n%s", given, actual)
+		}
+	}
+
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "canonical literals by default",
+			given:    "o04 c0.50.. d500.0ms (vol 0.50) {e f}02 [g'01-2]*02",
+			expected: "o4 c0.5.. d500ms (vol 0.5) { e f }2\n[\n  g '1-2\n] *2\n",
+		},
+		formatTestCase{
+			label:    "canonical literals without source text",
+			given:    "o04 c0.50.. d500.0ms (vol 0.50) {e f}02 [g'01-2]*02",
+			opts:     []formatterOption{ConfigurePreserveLiterals(true)},
+			expected: "o4 c0.5.. d500ms (vol 0.5) { e f }2\n[\n  g '1-2\n] *2\n",
+		},
+	)
+}
+
+func TestFormatEmptyParts(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "empty part",
+			given:    "piano:",
+			expected: "piano:\n",
+		},
+		formatTestCase{
+			label:    "empty part with an alias",
+			given:    `piano "pno":` + "\n\n",
+			expected: "piano \"pno\":\n",
+		},
+		formatTestCase{
+			label:    "empty part followed by a part",
+			given:    "piano: violin: c",
+			expected: "piano:\n\nviolin:\n  c\n",
+		},
+		formatTestCase{
+			label:    "empty part between parts",
+			given:    "piano: c\nviolin:\n# just a comment\nguitar: d",
+			expected: "piano:\n  c\n\nviolin:\n\nguitar:\n  d\n",
+		},
+		formatTestCase{
+			label:    "empty parts, minified",
+			given:    "piano:\nviolin:",
+			opts:     []formatterOption{ConfigureMinified(true)},
+			expected: "piano: violin:\n",
+		},
+	)
+}
+
+func TestFormatNestedVoiceIndentation(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label: "event sequence within a cram within a voice",
+			given: "V1: {[c d] e}",
+			expected: `V1:
+  {
+    [
+      c d
+    ] e
+  }
+`,
+		},
+		formatTestCase{
+			label: "voices in a part",
+			given: "piano: V1: {[c d] e}4 V2: f V0: g",
+			expected: `piano:
+  V1:
+    {
+      [
+        c d
+      ] e
+    }4
+  V2:
+    f
+  V0: g
+`,
+		},
+		formatTestCase{
+			label: "deeply nested",
+			given: "piano: V1: [{[c d [e f]] g}2 a]*2 V2: {b c}",
+			expected: `piano:
+  V1:
+    [
+      {
+        [
+          c d
+          [
+            e f
+          ]
+        ] g
+      }2 a
+    ] *2
+  V2:
+    { b c }
+`,
+		},
+		formatTestCase{
+			label: "consecutive voice groups",
+			given: "V1: {[c d] e} V0: V1: {[f g] a} V2: b",
+			expected: `V1:
+  {
+    [
+      c d
+    ] e
+  }
+V0:
+V1:
+  {
+    [
+      f g
+    ] a
+  }
+V2:
+  b
+`,
+		},
+	)
+}
+
+func TestFormatTieAfterBarline(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "tie after a barline within a duration",
+			given:    "c4|~ d",
+			expected: "c4 |~ d\n",
+		},
+		formatTestCase{
+			label:    "tie after a barline at the end of the score",
+			given:    "c4|~",
+			expected: "c4 |~\n",
+		},
+		formatTestCase{
+			label:    "tie before a separate barline",
+			given:    "c4~ | d",
+			expected: "c4~ | d\n",
+		},
+	)
+
+	for _, given := range []string{"c4|~ d", "c4|~", "c4~ | d"} {
+		ast, err := Parse("", given, SuppressSourceContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buffer := bytes.Buffer{}
+		if err := FormatASTToCode(ast, &buffer); err != nil {
+			t.Fatal(err)
+		}
+
+		formattedAST, err := Parse("", buffer.String(), SuppressSourceContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !Equal(ast, formattedAST) {
+			t.Errorf("%s: formatted output parses differently", given)
+			for _, diff := range Diff(ast, formattedAST) {
+				t.Errorf("%v", diff)
+			}
+		}
+	}
+}
+
+func TestFormatInlineShortParts(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "part that fits exactly",
+			given:    "piano: c d e",
+			opts:     []formatterOption{ConfigureInlineShortParts(12)},
+			expected: "piano: c d e\n",
+		},
+		formatTestCase{
+			label:    "part that's one column too long",
+			given:    "piano: c d e",
+			opts:     []formatterOption{ConfigureInlineShortParts(11)},
+			expected: "piano:\n  c d e\n",
+		},
+		formatTestCase{
+			label:    "part with an alias",
+			given:    "piano \"p\": c d e",
+			opts:     []formatterOption{ConfigureInlineShortParts(16)},
+			expected: "piano \"p\": c d e\n",
+		},
+		formatTestCase{
+			label: "short and long parts",
+			given: "snare: c d\nkick: c c c c\nbass: c\nhat: c",
+			opts:  []formatterOption{ConfigureInlineShortParts(10)},
+			expected: "snare: c d\n\nkick:\n  c c c c\n\nbass: c\n\n" +
+				"hat: c\n",
+		},
+		formatTestCase{
+			label:    "part with an event sequence",
+			given:    "piano: [c d]",
+			opts:     []formatterOption{ConfigureInlineShortParts(80)},
+			expected: "piano:\n  [\n    c d\n  ]\n",
+		},
+		formatTestCase{
+			label:    "part with a variable definition",
+			given:    "piano: motif = c d\nmotif",
+			opts:     []formatterOption{ConfigureInlineShortParts(80)},
+			expected: "piano:\n  motif = c d\n  motif\n",
+		},
+		formatTestCase{
+			label:    "empty part",
+			given:    "piano:",
+			opts:     []formatterOption{ConfigureInlineShortParts(80)},
+			expected: "piano:\n",
+		},
+		formatTestCase{
+			label: "minified",
+			given: "piano: c d e",
+			opts: []formatterOption{
+				ConfigureInlineShortParts(80), ConfigureMinified(true),
+			},
+			expected: "piano: c d e\n",
+		},
+		formatTestCase{
+			label:    "parts aren't inlined by default",
+			given:    "piano: c d e",
+			expected: "piano:\n  c d e\n",
+		},
+	)
+}
+
+func TestFormatNoIndent(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label: "nested voices",
+			given: "piano: V1: [{[c d [e f]] g}2 a]*2 V2: {b c}",
+			opts:  []formatterOption{ConfigureNoIndent(true)},
+			expected: `piano:
+V1:
+[
+{
+[
+c d
+[
+e f
+]
+] g
+}2 a
+] *2
+V2:
+{ b c }
+`,
+		},
+		formatTestCase{
+			label: "indentation disabled along with a custom indent text",
+			given: "piano: V1: c",
+			opts: []formatterOption{
+				ConfigureIndentText("\t"), ConfigureNoIndent(true),
+			},
+			expected: "piano:\nV1:\nc\n",
+		},
+	)
+}
+
+func TestFormatReader(t *testing.T) {
+	out := bytes.Buffer{}
+	err := Format(strings.NewReader("piano: c d   e\nviolin: f"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "piano:\n  c d e\n\nviolin:\n  f\n"
+	if actual := out.String(); actual != expected {
+		t.Errorf("expected:\n%q\nactual:\n%q", expected, actual)
+	}
+
+	for _, testCase := range []struct {
+		label    string
+		in       *strings.Reader
+		opts     []formatterOption
+		expected string
+	}{
+		{
+			label:    "invalid score",
+			in:       strings.NewReader("piano: c d\n  e )"),
+			expected: "<no file>:2:5 Unexpected close parenthesis",
+		},
+		{
+			label:    "line too long",
+			in:       strings.NewReader("piano: (quant 90)"),
+			opts:     []formatterOption{ConfigureMaxLineWidth(10)},
+			expected: "1 line exceeds the maximum line width of 10",
+		},
+	} {
+		out := bytes.Buffer{}
+		err := Format(testCase.in, &out, testCase.opts...)
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.label)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), testCase.expected) {
+			t.Errorf(
+				"%s: expected an error containing %q, got %q",
+				testCase.label, testCase.expected, err.Error(),
+			)
+		}
+
+		if out.Len() > 0 {
+			t.Errorf("%s: expected no output, got %q", testCase.label, out.String())
+		}
+	}
+
+	readErr := errors.New("read error")
+	out.Reset()
+	if err := Format(iotest.ErrReader(readErr), &out); err != readErr {
+		t.Errorf("expected the read error, got %v", err)
+	}
+
+	if out.Len() > 0 {
+		t.Errorf("expected no output after a read error, got %q", out.String())
+	}
+}
+
+func TestFormatTokenSeparator(t *testing.T) {
+	doubleSpaced := ConfigureTokenSeparator("  ")
+
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "two-space separator",
+			given:    "piano: c d {e f}2 (vol 50)",
+			opts:     []formatterOption{doubleSpaced},
+			expected: "piano:\n  c  d  {  e  f  }2  (vol 50)\n",
+		},
+		formatTestCase{
+			label:    "wrapping accounts for the separator",
+			given:    "piano: c d e f g",
+			opts:     []formatterOption{doubleSpaced, ConfigureSoftWrapLen(10)},
+			expected: "piano:\n  c  d  e\n  f  g\n",
+		},
+		formatTestCase{
+			label:    "minified output is unaffected",
+			given:    "piano: c d e",
+			opts:     []formatterOption{doubleSpaced, ConfigureMinified(true)},
+			expected: "piano: c d e\n",
+		},
+		formatTestCase{
+			label: "beat groups are separated by an extra separator",
+			given: "piano: (time-signature '(4 4)) c8 d e f g a b > c",
+			opts:  []formatterOption{doubleSpaced, ConfigureBeatGrouping(true)},
+			expected: "piano:\n" +
+				"  (time-signature '(4 4))  c8  d    e  f    g  a    b  >  c\n",
+		},
+	)
+
+	for _, separator := range []string{"", "-", " \n", "\t", " \t"} {
+		err := FormatCode(
+			"c d", &bytes.Buffer{}, ConfigureTokenSeparator(separator),
+		)
+
+		expected := fmt.Sprintf(
+			"invalid token separator %q: it must consist of spaces",
+			separator,
+		)
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error: %s\nactual error: %v", expected, err)
+		}
+	}
+}
+
+func TestFormatASTToCodeChecked(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		opts     []formatterOption
+		expected int
+	}{
+		{
+			label:    "already formatted",
+			given:    "piano:\n  c d e\n",
+			expected: -1,
+		},
+		{
+			label:    "extra whitespace",
+			given:    "piano:\n  c  d e\n",
+			expected: 11,
+		},
+		{
+			label:    "missing trailing newline",
+			given:    "piano:\n  c d e",
+			expected: 14,
+		},
+		{
+			label:    "extra trailing newline",
+			given:    "piano:\n  c d e\n\n",
+			expected: 15,
+		},
+		{
+			label:    "different options",
+			given:    "piano:\n  c d e\n",
+			opts:     []formatterOption{ConfigureIndentText("\t")},
+			expected: 7,
+		},
+	} {
+		ast, err := Parse("piece.alda", testCase.given)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buffer := bytes.Buffer{}
+		actual, err := FormatASTToCodeChecked(
+			ast, testCase.given, &buffer, testCase.opts...,
+		)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.label, err)
+			continue
+		}
+
+		if actual != testCase.expected {
+			t.Errorf(
+				"%s: expected the first difference at %d, got %d",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+
+		// The output is the same as without checking.
+		expectedOutput := bytes.Buffer{}
+		if err := FormatASTToCode(
+			ast, &expectedOutput, testCase.opts...,
+		); err != nil {
+			t.Fatal(err)
+		}
+
+		if buffer.String() != expectedOutput.String() {
+			t.Errorf(
+				"%s\nexpected output:\n%s\nactual output:\n%s",
+				testCase.label, expectedOutput.String(), buffer.String(),
+			)
+		}
+	}
+
+	// Nothing is written if formatting fails.
+	buffer := bytes.Buffer{}
+	firstDiff, err := FormatASTToCodeChecked(
+		ASTNode{Type: RootNode, Children: []ASTNode{{Type: NoteNode}}},
+		"c", &buffer,
+	)
+	if err == nil || firstDiff != -1 || buffer.Len() > 0 {
+		t.Errorf(
+			"expected an error and no output, got %d, %v, %q",
+			firstDiff, err, buffer.String(),
+		)
+	}
+}
+
+// checkLimitContext is a context that's canceled after its Err method has been
+// called a given number of times, to cancel formatting partway through.
+type checkLimitContext struct {
+	context.Context
+	checks int
+}
+
+func (c *checkLimitContext) Err() error {
+	if c.checks == 0 {
+		return context.Canceled
+	}
+
+	c.checks--
+	return nil
+}
+
+func TestFormatASTToCodePartial(t *testing.T) {
+	parse := func(code string) ASTNode {
+		ast, err := Parse("piece.alda", code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ast
+	}
+
+	badEvent := parse("piano: c d e\nviolin: f g a b")
+	badEvent.Children[1].Children[1].Children[2] = ASTNode{
+		Type: NoteNode, SourceContext: at(2, 13),
+	}
+
+	badDeclaration := parse("c d\npiano: e f")
+	badDeclaration.Children[1].Children[0].Children = nil
+
+	for _, testCase := range []struct {
+		label         string
+		given         ASTNode
+		expected      string
+		expectedError string
+	}{
+		{
+			label:    "valid AST",
+			given:    parse("piano: c d e"),
+			expected: "piano:\n  c d e\n",
+		},
+		{
+			label: "invalid event",
+			given: badEvent,
+			expected: "piano:\n  c d e\n\nviolin:\n  f g\n" +
+				"  # alda-format: formatting stopped here: piece.alda:2:13 " +
+				"RootNode/PartNode[1]/EventSequenceNode/NoteNode[2]: expected " +
+				"NoteNode to have 1, 2 or 3 children, but it has 0\n",
+			expectedError: "piece.alda:2:13 RootNode/PartNode[1]/EventSequenceNode/" +
+				"NoteNode[2]: expected NoteNode to have 1, 2 or 3 children, but it " +
+				"has 0",
+		},
+		{
+			label: "invalid part declaration",
+			given: badDeclaration,
+			expected: "c d\n# alda-format: formatting stopped here: " +
+				"piece.alda:2:1 RootNode/PartNode/PartDeclarationNode: expected " +
+				"PartDeclarationNode to have 1 or 2 children, but it has 0\n",
+			expectedError: "piece.alda:2:1 RootNode/PartNode/PartDeclarationNode: " +
+				"expected PartDeclarationNode to have 1 or 2 children, but it has 0",
+		},
+	} {
+		output := bytes.Buffer{}
+		err := FormatASTToCodePartial(testCase.given, &output)
+
+		actualError := ""
+		if err != nil {
+			actualError = err.Error()
+		}
+		if actualError != testCase.expectedError {
+			t.Errorf(
+				"%s\nexpected error: %q\nactual error: %q",
+				testCase.label, testCase.expectedError, actualError,
+			)
+		}
+
+		if output.String() != testCase.expected {
+			t.Errorf(
+				"%s\nexpected: %q\nactual: %q",
+				testCase.label, testCase.expected, output.String(),
+			)
+		}
+
+		// The partial output is still valid Alda code.
+		if _, err := Parse("piece.alda", output.String()); err != nil {
+			t.Errorf("%s: %v", testCase.label, err)
+		}
+	}
+}
+
+func TestFormatASTToCodeContext(t *testing.T) {
+	given := strings.Repeat("piano:\n  c d e f g\n\n", 100)
+	ast, err := Parse("piece.alda", given)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := bytes.Buffer{}
+	if err := FormatASTToCodeContext(
+		context.Background(), ast, &output,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := bytes.Buffer{}
+	if err := FormatASTToCode(ast, &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.String() != expected.String() {
+		t.Errorf(
+			"expected the same output as FormatASTToCode\nexpected: %q\nactual: %q",
+			expected.String(), output.String(),
+		)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, testCase := range []struct {
+		label string
+		ctx   context.Context
+	}{
+		{label: "canceled before formatting", ctx: canceled},
+		{
+			label: "canceled partway through",
+			ctx:   &checkLimitContext{Context: context.Background(), checks: 50},
+		},
+	} {
+		output := bytes.Buffer{}
+		err := FormatASTToCodeContext(testCase.ctx, ast, &output)
+
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf(
+				"%s: expected %v, got %v", testCase.label, context.Canceled, err,
+			)
+		}
+
+		if output.Len() > 0 {
+			t.Errorf(
+				"%s: expected no output, got %q", testCase.label, output.String(),
+			)
+		}
+	}
+}
+
+func TestFormatIndentBalanced(t *testing.T) {
+	given := `riff = [c d {e f}3]*2
+bass = (vol 50) c/e/g~ | c/e/g
+piano: V1: [{[c d [e f]] g}2 a]*2 riff V2: {b c} V0: bass
+violin "strings": (key-sig '(c major)) c8 d e f | g a b > c
+  [c d e f g a b > c]*3 [c'1-2 d'3]
+(tempo! 120) @strings %chorus
+V1: {[c d] e} V0: V1: {[f g] a} V2: b
+`
+
+	ast, err := Parse("piece.alda", given)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range []struct {
+		label string
+		opts  []formatterOption
+	}{
+		{label: "default"},
+		{label: "narrow", opts: []formatterOption{ConfigureSoftWrapLen(10)}},
+		{label: "minified", opts: []formatterOption{ConfigureMinified(true)}},
+		{label: "no indent", opts: []formatterOption{ConfigureNoIndent(true)}},
+		{
+			label: "beat grouping",
+			opts:  []formatterOption{ConfigureBeatGrouping(true)},
+		},
+	} {
+		f := newFormatter(&bytes.Buffer{}, testCase.opts...)
+		if err := f.formatRoot(ast); err != nil {
+			t.Errorf("%s: %v", testCase.label, err)
+			continue
+		}
+
+		if f.indentLevel != 0 {
+			t.Errorf(
+				"%s: expected an indentation level of 0, got %d",
+				testCase.label, f.indentLevel,
+			)
+		}
+	}
+
+	// A construct that leaks indentation is caught once formatting is done.
+	f := newFormatter(&bytes.Buffer{})
+	f.indent()
+	f.indent()
+	f.unindent()
+
+	var unbalanced *UnbalancedIndentError
+	if err := f.checkIndentBalanced(); !errors.As(err, &unbalanced) {
+		t.Fatalf("expected an *UnbalancedIndentError, got: %v", err)
+	}
+
+	if unbalanced.Level != 1 {
+		t.Errorf("expected an indentation level of 1, got %d", unbalanced.Level)
+	}
+}
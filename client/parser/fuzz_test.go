@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+// FuzzFormatRoundTrip asserts that, for any input that parses successfully,
+// formatting the AST produces code that parses back to an equal AST.
+//
+// Run with:
+//
+//	go test ./parser -run '^$' -fuzz FuzzFormatRoundTrip -args -log-level warn
+//
+// (Logging at the default DEBUG level slows fuzzing down considerably.) Inputs
+// that have failed in the past are checked in under testdata/fuzz, so that
+// they're run as regression tests by `go test`.
+func FuzzFormatRoundTrip(f *testing.F) {
+	dir, err := os.Getwd()
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	examplesDir := filepath.Join(filepath.Dir(filepath.Dir(dir)), "examples")
+
+	paths, err := filepath.Glob(filepath.Join(examplesDir, "*.alda"))
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(string(contents))
+	}
+
+	// Minimal constructs that have been tricky to format in the past
+	for _, seed := range []string{
+		"c1|~1/e/g",
+		"c2|~|4 r4|~8",
+		"{c {d e}8 f}4",
+		"{{c d}}",
+		"[c d'1-2,4 e'3]*4",
+		"[[c d]*2 e]*3",
+		"riff = [c d] {e f}2\nriff*2",
+		"V1: {[c d] e} V2: f V0: g",
+		"piano: V1: c V2: d\nviolin \"v\": e",
+		"(print \"a \\\"b\\\" c\")",
+		"o4 >c <d %m @m",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		ast, err := Parse("fuzz", input, SuppressSourceContext)
+		if err != nil {
+			return
+		}
+
+		buffer := bytes.Buffer{}
+		if err := FormatASTToCode(ast, &buffer); err != nil {
+			t.Fatalf("failed to format %q: %v", input, err)
+		}
+
+		formattedAST, err := Parse("fuzz", buffer.String(), SuppressSourceContext)
+		if err != nil {
+			t.Fatalf(
+				"formatted output of %q does not parse: %v\n%s",
+				input, err, buffer.String(),
+			)
+		}
+
+		if !Equal(ast, formattedAST) {
+			t.Errorf("formatted output of %q parses differently", input)
+			for _, diffItem := range Diff(ast, formattedAST) {
+				t.Errorf("%v", diffItem)
+			}
+		}
+	})
+}
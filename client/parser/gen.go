@@ -3,6 +3,7 @@ package parser
 import (
 	"alda.io/client/model"
 	"fmt"
+	"strings"
 )
 
 // withDuration returns the same ASTNode with an added DurationNode child if the
@@ -87,6 +88,9 @@ func mapIsolatedUpdate(scoreUpdate model.ScoreUpdate) (ASTNode, error) {
 		// We handle the subset that can be generated via MusicXML import.
 		// TODO: handle generating all possible part updates into lisp.
 		case model.DynamicMarking:
+			if isDynamicMarking(pu.Marking) {
+				return ASTNode{Type: DynamicNode, Literal: pu.Marking}, nil
+			}
 			return ASTNode{Type: LispListNode, Children: []ASTNode{{
 				Type: LispSymbolNode,
 				Literal: pu.Marking,
@@ -108,6 +112,18 @@ func mapIsolatedUpdate(scoreUpdate model.ScoreUpdate) (ASTNode, error) {
 				},
 			}}, nil
 
+		case model.TimeSignatureSet:
+			return ASTNode{Type: TimeSignatureNode, Children: []ASTNode{
+				{
+					Type:    TimeSignatureNumeratorNode,
+					Literal: pu.TimeSignature.Numerator,
+				},
+				{
+					Type:    TimeSignatureDenominatorNode,
+					Literal: pu.TimeSignature.Denominator,
+				},
+			}}, nil
+
 		case model.TranspositionSet:
 			return ASTNode{Type: LispListNode, Children: []ASTNode{
 				{
@@ -159,6 +175,13 @@ func mapIsolatedUpdate(scoreUpdate model.ScoreUpdate) (ASTNode, error) {
 		}
 		return ASTNode{Type: EventSequenceNode, Children: children}, nil
 
+	case model.Glissando:
+		children, err := mapInnerEvents(update.Events)
+		if err != nil {
+			return ASTNode{}, err
+		}
+		return ASTNode{Type: GlissandoNode, Children: children}, nil
+
 	case model.LispList:
 		var lispFormToNode func(model.LispForm) (ASTNode, error)
 		lispFormToNode = func(lispForm model.LispForm) (ASTNode, error) {
@@ -192,6 +215,11 @@ func mapIsolatedUpdate(scoreUpdate model.ScoreUpdate) (ASTNode, error) {
 				return ASTNode{Type: LispStringNode, Literal: l.Value}, nil
 
 			case model.LispSymbol:
+				// Keywords are represented as symbols whose names start with a colon
+				// (see ASTNode.Updates).
+				if len(l.Name) > 1 && strings.HasPrefix(l.Name, ":") {
+					return ASTNode{Type: LispKeywordNode, Literal: l.Name[1:]}, nil
+				}
 				return ASTNode{Type: LispSymbolNode, Literal: l.Name}, nil
 
 			default:
@@ -206,6 +234,9 @@ func mapIsolatedUpdate(scoreUpdate model.ScoreUpdate) (ASTNode, error) {
 	case model.Marker:
 		return ASTNode{Type: MarkerNode, Literal: update.Name}, nil
 
+	case model.MultiMeasureRest:
+		return ASTNode{Type: MultiMeasureRestNode, Literal: update.Measures}, nil
+
 	case model.Note:
 		note := ASTNode{Type: NoteNode}
 
@@ -295,6 +326,21 @@ func mapIsolatedUpdate(scoreUpdate model.ScoreUpdate) (ASTNode, error) {
 	case model.Rest:
 		return withDuration(ASTNode{Type: RestNode}, update.Duration)
 
+	case model.Tuplet:
+		children, err := mapInnerEvents(update.Events)
+		if err != nil {
+			return ASTNode{}, err
+		}
+
+		if children == nil {
+			children = []ASTNode{}
+		}
+		return ASTNode{Type: TupletNode, Children: []ASTNode{
+			{Type: EventSequenceNode, Children: children},
+			{Type: TupletActualNotesNode, Literal: update.Ratio.ActualNotes},
+			{Type: TupletNormalNotesNode, Literal: update.Ratio.NormalNotes},
+		}}, nil
+
 	case model.VariableDefinition:
 		children, err := mapInnerEvents(update.Events)
 		if err != nil {
@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+func noteWithLength(letter model.NoteLetter, denominator float64) model.Note {
+	return model.Note{
+		Pitch: model.LetterAndAccidentals{NoteLetter: letter},
+		Duration: model.Duration{
+			Components: []model.DurationComponent{
+				model.NoteLength{Denominator: denominator},
+			},
+		},
+	}
+}
+
+func glissando(events ...model.ScoreUpdate) model.Glissando {
+	return model.Glissando{Events: events}
+}
+
+func TestGlissando(t *testing.T) {
+	executeParseTestCases(
+		t,
+		parseTestCase{
+			label: "glissando between two notes",
+			given: "c4 ~~ g4",
+			expectUpdates: []model.ScoreUpdate{
+				glissando(noteWithLength(model.C, 4), noteWithLength(model.G, 4)),
+			},
+		},
+		parseTestCase{
+			label: "glissando without whitespace",
+			given: "c~~g c",
+			expectUpdates: []model.ScoreUpdate{
+				glissando(letterNote(model.C), letterNote(model.G)),
+				letterNote(model.C),
+			},
+		},
+		parseTestCase{
+			label: "glissando through several notes",
+			given: "c ~~ e ~~ g",
+			expectUpdates: []model.ScoreUpdate{
+				glissando(
+					letterNote(model.C), letterNote(model.E), letterNote(model.G),
+				),
+			},
+		},
+		parseTestCase{
+			label: "glissando across a barline",
+			given: "c2 ~~ | g2",
+			expectUpdates: []model.ScoreUpdate{
+				glissando(
+					noteWithLength(model.C, 2),
+					model.Barline{},
+					noteWithLength(model.G, 2),
+				),
+			},
+		},
+		parseTestCase{
+			label: "repeated glissando",
+			given: "c ~~ g*2",
+			expectUpdates: []model.ScoreUpdate{
+				repeat(glissando(letterNote(model.C), letterNote(model.G)), 2),
+			},
+		},
+		parseTestCase{
+			label: "two tildes followed by a note length are still a tie",
+			given: "c4~~4",
+			expectUpdates: []model.ScoreUpdate{
+				cNoteWithDuration(
+					model.NoteLength{Denominator: 4},
+					model.NoteLength{Denominator: 4},
+				),
+			},
+		},
+	)
+}
+
+func TestGlissandoErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		given    string
+		expected string
+	}{
+		{
+			given:    "c/e ~~ g",
+			expected: "piece.alda:1:5 a glissando can't start on a chord",
+		},
+		{
+			given:    "c ~~ e/g",
+			expected: "piece.alda:1:7 a glissando can't end on a chord",
+		},
+		{
+			given:    "c ~~ e >/g",
+			expected: "piece.alda:1:9 a glissando can't end on a chord",
+		},
+		{
+			given:    "r ~~ c",
+			expected: "piece.alda:1:3 a glissando can't start on a rest",
+		},
+		{
+			given:    "c ~~ r",
+			expected: "piece.alda:1:6 a glissando can't end on a rest",
+		},
+		{
+			given:    "c ~~ (pp) d",
+			expected: "piece.alda:1:6 Unexpected open parenthesis `(` in glissando",
+		},
+	} {
+		_, err := Parse("piece.alda", testCase.given)
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.given)
+			continue
+		}
+
+		if actual := err.Error(); actual != testCase.expected {
+			t.Errorf(
+				"%s\nexpected error: %s\nactual error: %s",
+				testCase.given, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+func TestFormatGlissando(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "glissandi are written with spaces around the tildes",
+			given:    "piano: c4~~g4 c2 ~~  | e~~g",
+			expected: "piano:\n  c4 ~~ g4 c2 ~~ | e ~~ g\n",
+		},
+	)
+
+	executeFormatErrorTestCases(t, formatErrorTestCase{
+		label: "glissando ending on a barline",
+		given: implicitPart(ASTNode{Type: GlissandoNode, Children: []ASTNode{
+			{
+				Type:     NoteNode,
+				Children: []ASTNode{letterAndAccidentals('c')},
+			},
+			{Type: BarlineNode},
+		}}),
+		expected: "a glissando must start and end on a note",
+	})
+}
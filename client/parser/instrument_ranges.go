@@ -0,0 +1,208 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"alda.io/client/model"
+)
+
+// An InstrumentRangeError is a note that's played outside the range of an
+// instrument of its part (see CheckInstrumentRanges).
+type InstrumentRangeError struct {
+	// Part is the alias or names of the part, e.g. "violin/viola".
+	Part string
+	// Instrument is the name of the instrument, as it's written in the part
+	// declaration, e.g. "tuba".
+	Instrument string
+	// MidiNote is the pitch of the note, as a MIDI note number.
+	MidiNote int32
+	// Range is the range in which the instrument can be played.
+	Range model.NoteRange
+}
+
+func (e *InstrumentRangeError) Error() string {
+	part := ""
+	if e.Part != e.Instrument {
+		part = fmt.Sprintf(" in part \"%s\"", e.Part)
+	}
+
+	return fmt.Sprintf(
+		"note %s%s is outside the range of %s (%s)",
+		model.MidiNoteName(e.MidiNote), part, e.Instrument, e.Range,
+	)
+}
+
+// A rangedInstrument is an instrument of a part that has a known range.
+type rangedInstrument struct {
+	name      string
+	noteRange model.NoteRange
+}
+
+// partInstruments returns the instruments with a known range (see
+// model.InstrumentRange) of each part, keyed by its alias or names (see
+// partKey). A name in a part declaration can also be the alias of an earlier
+// part, e.g. `lefthand:` after `piano "lefthand":`, or a name in a group with
+// the group's alias as a prefix, e.g. `strings.violin`.
+func partInstruments(root ASTNode) map[string][]rangedInstrument {
+	parts := map[string][]rangedInstrument{}
+
+	var resolve func(name string) []rangedInstrument
+	resolve = func(name string) []rangedInstrument {
+		if noteRange, ok := model.InstrumentRange(name); ok {
+			return []rangedInstrument{{name: name, noteRange: noteRange}}
+		}
+
+		if instruments, ok := parts[name]; ok {
+			return instruments
+		}
+
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			if _, ok := parts[name[:i]]; ok {
+				return resolve(name[i+1:])
+			}
+		}
+
+		return nil
+	}
+
+	for _, part := range root.Children {
+		if part.Type != PartNode {
+			continue
+		}
+
+		declaration := part.Children[0]
+		key := partKey(declaration)
+		if _, ok := parts[key]; ok || len(declaration.Children) == 0 {
+			continue
+		}
+
+		instruments := []rangedInstrument{}
+		for _, nameNode := range declaration.Children[0].Children {
+			name, _ := nameNode.Literal.(string)
+			instruments = append(instruments, resolve(name)...)
+		}
+
+		parts[key] = instruments
+	}
+
+	return parts
+}
+
+// noteMidiNumber returns the pitch of a note as a MIDI note number, given the
+// context in which it's played, and whether it can be determined from the AST.
+func noteMidiNumber(note ASTNode, context pitchContext) (int32, bool) {
+	if !context.octave.known || !context.transpositionKnown ||
+		len(note.Children) == 0 {
+		return 0, false
+	}
+
+	pitch := model.LetterAndAccidentals{}
+	hasLetter := false
+
+	for _, node := range note.Children[0].Children {
+		switch node.Type {
+		case NoteLetterNode:
+			letter, _ := node.Literal.(rune)
+			noteLetter, err := model.NewNoteLetter(letter)
+			if err != nil {
+				return 0, false
+			}
+
+			pitch.NoteLetter = noteLetter
+			hasLetter = true
+
+		case NoteAccidentalsNode:
+			pitch.Accidentals = []model.Accidental{}
+
+			for _, accidental := range node.Children {
+				switch accidental.Type {
+				case SharpNode:
+					pitch.Accidentals = append(pitch.Accidentals, model.Sharp)
+				case FlatNode:
+					pitch.Accidentals = append(pitch.Accidentals, model.Flat)
+				case NaturalNode:
+					pitch.Accidentals = append(pitch.Accidentals, model.Natural)
+				}
+			}
+		}
+	}
+
+	if !hasLetter {
+		return 0, false
+	}
+
+	midiNote := pitch.CalculateMidiNote(
+		context.octave.number, nil, context.transposition,
+	)
+
+	// Without accidentals, the note is played in the key signature.
+	if pitch.Accidentals == nil {
+		if !context.keySignatureKnown {
+			return 0, false
+		}
+
+		midiNote += context.keySignature[pitch.NoteLetter]
+	}
+
+	return midiNote, true
+}
+
+// CheckInstrumentRanges returns an error (an InstrumentRangeError, wrapped in
+// an AldaSourceError at the note) for each note that's played outside the
+// range of an instrument of its part, e.g. `o8 c` for a tuba. A part with more
+// than one instrument, e.g. `violin/viola:`, gets an error for each instrument
+// whose range the note is outside. Each note is reported once per instrument,
+// even if it's played more than once.
+//
+// Ranges are those of the sounding pitches (see model.InstrumentRange), and
+// the pitch of each note is worked out like the octave is in
+// CheckOctaveRange, taking into account transposition attribute changes, e.g.
+// `(transpose -12)`, and key signature attribute changes, e.g. `(key-sig "b-
+// e-")` or `(key-sig '(g minor))`. Notes whose pitch can't
+// be determined without evaluating the score aren't checked, nor are the notes
+// of parts without an instrument with a known range, e.g. synths.
+func CheckInstrumentRanges(root ASTNode) []error {
+	errors := []error{}
+	parts := partInstruments(root)
+
+	type report struct {
+		node       *ASTNode
+		instrument string
+	}
+	reported := map[report]bool{}
+
+	var tracker *octaveTracker
+	tracker = newOctaveTracker(func(node *ASTNode, context pitchContext) {
+		if node.Type != NoteNode {
+			return
+		}
+
+		midiNote, ok := noteMidiNumber(*node, context)
+		if !ok {
+			return
+		}
+
+		for _, instrument := range parts[tracker.currentKey] {
+			if instrument.noteRange.Contains(midiNote) ||
+				reported[report{node, instrument.name}] {
+				continue
+			}
+
+			reported[report{node, instrument.name}] = true
+			errors = append(errors, &model.AldaSourceError{
+				Context: node.SourceContext,
+				Err: &InstrumentRangeError{
+					Part:       tracker.currentKey,
+					Instrument: instrument.name,
+					MidiNote:   midiNote,
+					Range:      instrument.noteRange,
+				},
+			})
+		}
+	})
+
+	tracker.walkRoot(&root)
+
+	return errors
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestCheckInstrumentRanges(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected []string
+	}{
+		{
+			label:    "piano in range",
+			given:    "piano: o0 a o4 c o8 c",
+			expected: []string{},
+		},
+		{
+			label: "piano out of range",
+			given: "piano: o0 a- > c o8 c+",
+			expected: []string{
+				"piece.alda:1:11 note G#0 is outside the range of piano (A0 to C8)",
+				"piece.alda:1:21 note C#8 is outside the range of piano (A0 to C8)",
+			},
+		},
+		{
+			label: "piccolo",
+			given: "piccolo: o5 d o4 c o8 c d",
+			expected: []string{
+				"piece.alda:1:18 note C4 is outside the range of piccolo (D5 to C8)",
+				"piece.alda:1:25 note D8 is outside the range of piccolo (D5 to C8)",
+			},
+		},
+		{
+			label: "transposition",
+			given: "clarinet: o3 e (transpose -2) e d\n" +
+				"tuba: (transpose -24) o5 f",
+			expected: []string{
+				"piece.alda:1:33 note C3 is outside the range of clarinet (D3 to A#6)",
+			},
+		},
+		{
+			label: "global transposition",
+			given: "flute: c\n(transpose! 12) o7 c\noboe: o6 g",
+			expected: []string{
+				"piece.alda:2:20 note C8 is outside the range of flute (C4 to C7)",
+				"piece.alda:3:10 note G7 is outside the range of oboe (A#3 to G6)",
+			},
+		},
+		{
+			label: "key signature",
+			given: "flute: (key-sig \"c-\") o4 c c+ (key-sig '(a major)) c",
+			expected: []string{
+				"piece.alda:1:26 note B3 is outside the range of flute (C4 to C7)",
+			},
+		},
+		{
+			label: "key signature written as the name of a scale",
+			given: "flute: (key-sig '(c flat major)) o4 c d",
+			expected: []string{
+				"piece.alda:1:37 note B3 is outside the range of flute (C4 to C7)",
+			},
+		},
+		{
+			label: "more than one instrument",
+			given: "violin/viola \"strings\": o3 c o6 f",
+			expected: []string{
+				"piece.alda:1:28 note C3 in part \"strings\" is outside the range " +
+					"of violin (G3 to G7)",
+				"piece.alda:1:33 note F6 in part \"strings\" is outside the range " +
+					"of viola (C3 to E6)",
+			},
+		},
+		{
+			label: "part alias",
+			given: "tuba \"low\": o1 d\nlow: c",
+			expected: []string{
+				"piece.alda:2:6 note C1 in part \"low\" is outside the range of " +
+					"tuba (D1 to F4)",
+			},
+		},
+		{
+			label:    "instrument without a range",
+			given:    "midi-synth-bass-1: o9 c",
+			expected: []string{},
+		},
+		{
+			label: "repeated note",
+			given: "trumpet: o6 [c d e]*2",
+			expected: []string{
+				"piece.alda:1:18 note E6 is outside the range of trumpet (E3 to D6)",
+			},
+		},
+	} {
+		ast, err := Parse("piece.alda", testCase.given)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+
+		actual := []string{}
+		for _, err := range CheckInstrumentRanges(ast) {
+			actual = append(actual, err.Error())
+		}
+
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf(
+				"%s\nexpected: %q\nactual: %q",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	encjson "encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "alda.io/client/testing"
+	"github.com/go-test/deep"
+)
+
+func executeJSONRoundTrip(t *testing.T, label string, ast ASTNode) {
+	deep.MaxDepth = math.MaxInt32
+
+	bs, err := encjson.Marshal(ast)
+	if err != nil {
+		t.Error(label)
+		t.Errorf("%v\n", err)
+		return
+	}
+
+	roundTripped := ASTNode{}
+	if err := encjson.Unmarshal(bs, &roundTripped); err != nil {
+		t.Error(label)
+		t.Errorf("%v\n", err)
+		return
+	}
+
+	if diff := deep.Equal(ast, roundTripped); diff != nil {
+		t.Error(label)
+		for _, diffItem := range diff {
+			t.Errorf("%v", diffItem)
+		}
+	}
+}
+
+func TestASTJSONRoundTrip(t *testing.T) {
+	for _, given := range []string{
+		"piano: o4 c+8. d-16~4 e_ r2 | f/a/>c1",
+		`violin/viola "strings": (key-signature '(e (flat) b (flat))) {c d e}4.`,
+		"foo = [c d]*2\nguitar: V1: foo V2: [[e f]'1-2,4 g]*4 V0: %m @m g500ms a2s",
+		`(tempo! 90.5) (key-signature "f+ c+ g+")`,
+	} {
+		ast, err := ParseString(given)
+		if err != nil {
+			t.Error(given)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		executeJSONRoundTrip(t, given, ast)
+	}
+}
+
+func TestASTJSONRoundTripExamples(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Errorf("%v\n", err)
+		return
+	}
+
+	examplesDir := filepath.Join(filepath.Dir(filepath.Dir(dir)), "examples")
+
+	paths, err := filepath.Glob(filepath.Join(examplesDir, "*.alda"))
+	if err != nil {
+		t.Errorf("%v\n", err)
+		return
+	}
+
+	for _, path := range paths {
+		ast, err := ParseFile(path)
+		if err != nil {
+			t.Error(path)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		executeJSONRoundTrip(t, fmt.Sprintf("JSON round trip for %s", path), ast)
+	}
+}
+
+func TestASTJSONTypedLiterals(t *testing.T) {
+	ast, err := Parse("", "o4 c8", SuppressSourceContext)
+	if err != nil {
+		t.Errorf("%v\n", err)
+		return
+	}
+
+	bs, err := encjson.Marshal(ast)
+	if err != nil {
+		t.Errorf("%v\n", err)
+		return
+	}
+
+	for _, expected := range []string{
+		`"type":"RootNode"`,
+		`"type":"OctaveSetNode","literal":4,"literal-type":"int32"`,
+		`"type":"NoteLetterNode","literal":"c","literal-type":"rune"`,
+		`"type":"DenominatorNode","literal":8,"literal-type":"float64"`,
+	} {
+		if !strings.Contains(string(bs), expected) {
+			t.Errorf("expected %s to contain %s", string(bs), expected)
+		}
+	}
+}
+
+func TestASTJSONInt64Literal(t *testing.T) {
+	executeJSONRoundTrip(t, "int64 lisp number", ASTNode{
+		Type: LispListNode,
+		Children: []ASTNode{
+			{Type: LispSymbolNode, Literal: "tempo"},
+			{Type: LispNumberNode, Literal: int64(9007199254740993)},
+		},
+	})
+}
+
+func TestASTJSONUnmarshalErrors(t *testing.T) {
+	for _, given := range []string{
+		`{"type": "NotARealNode"}`,
+		`{"type": "NoteLetterNode", "literal": "cd", "literal-type": "rune"}`,
+		`{"type": "OctaveSetNode", "literal": 4, "literal-type": "int128"}`,
+	} {
+		node := ASTNode{}
+		if err := encjson.Unmarshal([]byte(given), &node); err == nil {
+			t.Errorf("expected an error unmarshaling %s", given)
+		}
+	}
+}
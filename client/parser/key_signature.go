@@ -0,0 +1,217 @@
+package parser
+
+import "strings"
+
+// KeySignatureStyle is the way that the formatter writes the argument of a
+// key signature attribute change (see ConfigureKeySignatureStyle).
+type KeySignatureStyle int
+
+const (
+	// KeySignaturePreserve leaves key signatures as they're written. This is
+	// the default.
+	KeySignaturePreserve KeySignatureStyle = iota
+	// KeySignatureString writes key signatures as a string of note letters and
+	// accidentals, e.g. `(key-signature "f+ c+ g+")`.
+	KeySignatureString
+	// KeySignatureList writes key signatures as a quoted list of note letters
+	// and lists of accidentals, e.g. `(key-signature '(f (sharp) c (sharp)))`.
+	KeySignatureList
+)
+
+// A keySignatureEntry is a note letter in a key signature, along with its
+// accidentals, e.g. `f+` is {letter: "f", accidentals: ["sharp"]}.
+type keySignatureEntry struct {
+	letter      string
+	accidentals []string
+}
+
+// The names of accidentals, keyed by how they're written in a string
+var accidentalNames = map[rune]string{'+': "sharp", '-': "flat", '_': "natural"}
+
+// How accidentals are written in a string, keyed by their names
+var accidentalShorthands = map[string]string{
+	"sharp": "+", "flat": "-", "natural": "_",
+}
+
+// NormalizeKeySignatures returns a copy of the AST where the argument of each
+// key signature attribute change (e.g. `(key-signature "f+ c+")`) is written
+// in the given style, wherever it's written as note letters and accidentals,
+// in either style. The letters are kept in the order in which they're written.
+// The original AST is left unchanged.
+//
+// A key signature written as the name of a scale (e.g. `'(a major)`) is left
+// as it is, as is a key signature with a natural sign, which can't be written
+// as a list.
+func NormalizeKeySignatures(root ASTNode, style KeySignatureStyle) ASTNode {
+	normalized := root.Clone()
+	normalizeKeySignatures(&normalized, style)
+	return normalized
+}
+
+func normalizeKeySignatures(node *ASTNode, style KeySignatureStyle) {
+	for i := range node.Children {
+		normalizeKeySignatures(&node.Children[i], style)
+	}
+
+	if style == KeySignaturePreserve || !isKeySignatureChange(*node) {
+		return
+	}
+
+	entries, ok := keySignatureEntries(node.Children[1])
+	if !ok {
+		return
+	}
+
+	switch style {
+	case KeySignatureString:
+		node.Children[1] = keySignatureString(entries)
+	case KeySignatureList:
+		if argument, ok := keySignatureList(entries); ok {
+			node.Children[1] = argument
+		}
+	}
+}
+
+// isKeySignatureChange reports whether a node is a key signature attribute
+// change with a single argument, e.g. `(key-sig! "b- e-")`.
+func isKeySignatureChange(node ASTNode) bool {
+	if node.Type != LispListNode || len(node.Children) != 2 ||
+		node.Children[0].Type != LispSymbolNode {
+		return false
+	}
+
+	name, _ := node.Children[0].Literal.(string)
+
+	switch strings.TrimSuffix(name, "!") {
+	case "key-signature", "key-sig":
+		return true
+	}
+
+	return false
+}
+
+// keySignatureEntries returns the note letters and accidentals of a key
+// signature written as a string (e.g. `"f+ c+"`) or as a quoted list or
+// vector (e.g. `'(f (sharp) c (sharp))`).
+func keySignatureEntries(argument ASTNode) ([]keySignatureEntry, bool) {
+	switch argument.Type {
+	case LispStringNode:
+		text, _ := argument.Literal.(string)
+		return keySignatureStringEntries(text)
+
+	case LispQuotedFormNode:
+		if len(argument.Children) != 1 {
+			return nil, false
+		}
+
+		switch list := argument.Children[0]; list.Type {
+		case LispListNode, LispVectorNode:
+			return keySignatureListEntries(list.Children)
+		}
+	}
+
+	return nil, false
+}
+
+func keySignatureStringEntries(text string) ([]keySignatureEntry, bool) {
+	entries := []keySignatureEntry{}
+
+	for _, field := range strings.Fields(text) {
+		if !isNoteLetter(rune(field[0])) {
+			return nil, false
+		}
+
+		entry := keySignatureEntry{letter: field[:1], accidentals: []string{}}
+		for _, shorthand := range field[1:] {
+			accidental, ok := accidentalNames[shorthand]
+			if !ok {
+				return nil, false
+			}
+
+			entry.accidentals = append(entry.accidentals, accidental)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, len(entries) > 0
+}
+
+func keySignatureListEntries(forms []ASTNode) ([]keySignatureEntry, bool) {
+	if len(forms) == 0 || len(forms)%2 != 0 {
+		return nil, false
+	}
+
+	entries := []keySignatureEntry{}
+
+	for i := 0; i < len(forms); i += 2 {
+		letter, _ := forms[i].Literal.(string)
+		if forms[i].Type != LispSymbolNode || !isNoteLetterName(letter) ||
+			forms[i+1].Type != LispListNode {
+			return nil, false
+		}
+
+		entry := keySignatureEntry{letter: letter, accidentals: []string{}}
+		for _, form := range forms[i+1].Children {
+			accidental, _ := form.Literal.(string)
+			if form.Type != LispSymbolNode ||
+				(accidental != "sharp" && accidental != "flat") {
+				return nil, false
+			}
+
+			entry.accidentals = append(entry.accidentals, accidental)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, true
+}
+
+// isNoteLetterName reports whether a symbol is a note letter, e.g. `f`.
+func isNoteLetterName(name string) bool {
+	return len(name) == 1 && isNoteLetter(rune(name[0]))
+}
+
+func keySignatureString(entries []keySignatureEntry) ASTNode {
+	fields := []string{}
+
+	for _, entry := range entries {
+		field := entry.letter
+		for _, accidental := range entry.accidentals {
+			field += accidentalShorthands[accidental]
+		}
+
+		fields = append(fields, field)
+	}
+
+	return ASTNode{Type: LispStringNode, Literal: strings.Join(fields, " ")}
+}
+
+func keySignatureList(entries []keySignatureEntry) (ASTNode, bool) {
+	forms := []ASTNode{}
+
+	for _, entry := range entries {
+		accidentals := []ASTNode{}
+		for _, accidental := range entry.accidentals {
+			if accidental == "natural" {
+				return ASTNode{}, false
+			}
+
+			accidentals = append(accidentals, ASTNode{
+				Type: LispSymbolNode, Literal: accidental,
+			})
+		}
+
+		forms = append(
+			forms,
+			ASTNode{Type: LispSymbolNode, Literal: entry.letter},
+			ASTNode{Type: LispListNode, Children: accidentals},
+		)
+	}
+
+	return ASTNode{
+		Type:     LispQuotedFormNode,
+		Children: []ASTNode{{Type: LispListNode, Children: forms}},
+	}, true
+}
@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+func TestFormatKeySignatureStyle(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "key signatures are preserved by default",
+			given:    "piano: (key-signature \"f+ c+\") (key-sig '(b (flat)))",
+			expected: "piano:\n  (key-signature \"f+ c+\") (key-sig '(b (flat)))\n",
+		},
+		formatTestCase{
+			label: "list form as a string",
+			given: "piano: (key-signature '(f (sharp) c (sharp) g (sharp))) c",
+			opts: []formatterOption{
+				ConfigureKeySignatureStyle(KeySignatureString),
+			},
+			expected: "piano:\n  (key-signature \"f+ c+ g+\") c\n",
+		},
+		formatTestCase{
+			label: "vector form as a string",
+			given: "piano: (key-sig! '[b (flat) e (flat flat)])",
+			opts: []formatterOption{
+				ConfigureKeySignatureStyle(KeySignatureString),
+			},
+			expected: "piano:\n  (key-sig! \"b- e--\")\n",
+		},
+		formatTestCase{
+			label: "string form as a list",
+			given: "piano: (key-signature \"f+  c+\") c",
+			opts: []formatterOption{
+				ConfigureKeySignatureStyle(KeySignatureList),
+			},
+			expected: "piano:\n  (key-signature '(f (sharp) c (sharp))) c\n",
+		},
+		formatTestCase{
+			label: "vector form as a list",
+			given: "piano: (key-signature '[b (flat)])",
+			opts: []formatterOption{
+				ConfigureKeySignatureStyle(KeySignatureList),
+			},
+			expected: "piano:\n  (key-signature '(b (flat)))\n",
+		},
+		formatTestCase{
+			label: "scale names and naturals are left alone",
+			given: "piano: (key-sig '(a major)) (key-sig \"f_ b-\")",
+			opts: []formatterOption{
+				ConfigureKeySignatureStyle(KeySignatureList),
+			},
+			expected: "piano:\n  (key-sig '(a major)) (key-sig \"f_ b-\")\n",
+		},
+		formatTestCase{
+			label: "other lisp lists are unaffected",
+			given: "piano: (print \"f+ c+\") (tempo 120)",
+			opts: []formatterOption{
+				ConfigureKeySignatureStyle(KeySignatureList),
+			},
+			expected: "piano:\n  (print \"f+ c+\") (tempo 120)\n",
+		},
+	)
+}
+
+// Normalizing key signatures doesn't change what they mean.
+func TestNormalizeKeySignaturesEquivalence(t *testing.T) {
+	keySignatureOf := func(ast ASTNode) model.KeySignature {
+		updates, err := ast.Updates()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		score := model.NewScore()
+		if err := score.Update(updates...); err != nil {
+			t.Fatal(err)
+		}
+
+		return score.Parts[0].KeySignature
+	}
+
+	for _, given := range []string{
+		"piano: (key-signature \"f+ c+ g+\") c",
+		"piano: (key-signature '(b (flat) e (flat))) c",
+	} {
+		ast, err := Parse("piece.alda", given, SuppressSourceContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := keySignatureOf(ast)
+
+		for _, style := range []KeySignatureStyle{
+			KeySignatureString, KeySignatureList,
+		} {
+			actual := keySignatureOf(NormalizeKeySignatures(ast, style))
+
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf(
+					"%s (style %d)\nexpected: %v\nactual: %v",
+					given, style, expected, actual,
+				)
+			}
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 
 	"alda.io/client/model"
 	_ "alda.io/client/testing"
+	"github.com/go-test/deep"
 )
 
 func lispSymbol(name string) model.LispSymbol {
@@ -55,6 +57,33 @@ func TestLisp(t *testing.T) {
 				lispList(lispSymbol("key-signature"), lispString("f+ c+ g+")),
 			},
 		},
+		parseTestCase{
+			label: "string with escaped quotes and backslashes",
+			given: `(print "say \"hi\" \\ bye")`,
+			expectUpdates: []model.ScoreUpdate{
+				lispList(lispSymbol("print"), lispString(`say "hi" \ bye`)),
+			},
+			scoreApplyOptOut: true,
+		},
+		parseTestCase{
+			label: "string with embedded quotes and escaped whitespace",
+			given: `(print "she said \"hi\"\n\tthen left")`,
+			expectUpdates: []model.ScoreUpdate{
+				lispList(
+					lispSymbol("print"),
+					lispString("she said \"hi\"\n\tthen left"),
+				),
+			},
+			scoreApplyOptOut: true,
+		},
+		parseTestCase{
+			label: "string with a backslash that doesn't escape anything",
+			given: `(print "a\b")`,
+			expectUpdates: []model.ScoreUpdate{
+				lispList(lispSymbol("print"), lispString(`a\b`)),
+			},
+			scoreApplyOptOut: true,
+		},
 		parseTestCase{
 			label: "global attribute change",
 			given: "(tempo! 200)",
@@ -87,5 +116,117 @@ func TestLisp(t *testing.T) {
 				),
 			},
 		},
+		parseTestCase{
+			label: "keyword arguments",
+			given: "(key-signature '(:a :major))",
+			expectUpdates: []model.ScoreUpdate{
+				lispList(
+					lispSymbol("key-signature"),
+					lispQuotedList(lispSymbol(":a"), lispSymbol(":major")),
+				),
+			},
+			scoreApplyOptOut: true,
+		},
+		parseTestCase{
+			label: "nested quoted forms",
+			given: "(print '(a '(b ''c)))",
+			expectUpdates: []model.ScoreUpdate{
+				lispList(
+					lispSymbol("print"),
+					lispQuotedList(
+						lispSymbol("a"),
+						lispQuotedList(
+							lispSymbol("b"),
+							lispQuotedForm(lispQuotedForm(lispSymbol("c"))),
+						),
+					),
+				),
+			},
+			scoreApplyOptOut: true,
+		},
 	)
 }
+
+func TestLispCollections(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected []model.ScoreUpdate
+	}{
+		{
+			label: "vector",
+			given: "(key-signature [:a :major])",
+			expected: []model.ScoreUpdate{
+				lispList(
+					lispSymbol("key-signature"),
+					lispList(lispSymbol("list"), lispSymbol(":a"), lispSymbol(":major")),
+				),
+			},
+		},
+		{
+			label: "quoted vector",
+			given: "(key-signature '[a major])",
+			expected: []model.ScoreUpdate{
+				lispList(
+					lispSymbol("key-signature"),
+					lispQuotedList(lispSymbol("a"), lispSymbol("major")),
+				),
+			},
+		},
+		{
+			label: "vector of mixed content",
+			given: `(print [1 "two" three (four) [5]])`,
+			expected: []model.ScoreUpdate{
+				lispList(
+					lispSymbol("print"),
+					lispList(
+						lispSymbol("list"),
+						lispNumber(1),
+						lispString("two"),
+						lispSymbol("three"),
+						lispList(lispSymbol("four")),
+						lispList(lispSymbol("list"), lispNumber(5)),
+					),
+				),
+			},
+		},
+	} {
+		ast, err := Parse(testCase.label, testCase.given, SuppressSourceContext)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		actual, err := ast.Updates()
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if diff := deep.Equal(testCase.expected, actual); diff != nil {
+			t.Error(testCase.label)
+			for _, diffItem := range diff {
+				t.Errorf("%v", diffItem)
+			}
+		}
+	}
+}
+
+func TestLispMaps(t *testing.T) {
+	ast, err := Parse("maps", "(instrument-config {:channel 3 :patches [1 2]})")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "unexpected LispMapNode node inside of Lisp form"
+	if _, err := ast.Updates(); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+
+	if _, err := Parse("maps", "(f {:a 1 :b})"); err == nil ||
+		!strings.Contains(err.Error(), "even number of forms") {
+		t.Errorf("expected an error about an odd number of forms, got %v", err)
+	}
+}
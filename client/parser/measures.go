@@ -0,0 +1,376 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"alda.io/client/model"
+)
+
+// maxMeasureRepetitions is the maximum number of repetitions of a repeat that
+// measureTracker walks through. Each repetition of a passage is usually laid
+// out in the same measures, so a mismatched measure shows up within the first
+// few repetitions.
+const maxMeasureRepetitions = 32
+
+// A MeasureLengthError is a measure whose length doesn't match the time
+// signature in effect at its start (see CheckMeasureLengths).
+type MeasureLengthError struct {
+	// Number is the number of the measure within its part, counting from 1.
+	Number int
+	// TimeSignature is the time signature in effect at the start of the
+	// measure.
+	TimeSignature model.TimeSignature
+	// Beats is the length of the measure, in beats (i.e. quarter notes).
+	Beats float64
+}
+
+func (e *MeasureLengthError) Error() string {
+	fullness := "underfull"
+	if e.Beats > e.ExpectedBeats() {
+		fullness = "overfull"
+	}
+
+	return fmt.Sprintf(
+		"measure %d is %s: it has %s, but %s has %s",
+		e.Number, fullness, formatBeats(e.Beats), e.TimeSignature,
+		formatBeats(e.ExpectedBeats()),
+	)
+}
+
+// ExpectedBeats returns the length of a measure in the measure's time
+// signature, in beats.
+func (e *MeasureLengthError) ExpectedBeats() float64 {
+	return e.TimeSignature.MeasureBeats()
+}
+
+// Pickup reports whether the measure is the first of its part and shorter
+// than a full measure, i.e. it's probably a pickup (anacrusis) measure.
+func (e *MeasureLengthError) Pickup() bool {
+	return e.Number == 1 && e.Beats < e.ExpectedBeats()
+}
+
+// formatBeats returns a number of beats as it's written in an error message,
+// e.g. "1 beat" or "3.5 beats", rounded to hide floating point error in e.g.
+// triplets.
+func formatBeats(beats float64) string {
+	rounded := math.Round(beats*1000) / 1000
+	number := strconv.FormatFloat(rounded, 'f', -1, 64)
+
+	if rounded == 1 {
+		return number + " beat"
+	}
+
+	return number + " beats"
+}
+
+// A measurePosition is the position of a part's next event within its
+// current measure.
+type measurePosition struct {
+	// The number of the current measure, counting from 1
+	number int
+	// The number of beats since the start of the measure, or -1 if unknown
+	beats float64
+	// The first event of the measure that takes time, or nil if there isn't one
+	// yet
+	start *ASTNode
+	// The time signature in effect at the start of the measure
+	meter model.TimeSignature
+	// The length of a note without a duration, in beats, or 0 if unknown
+	noteBeats float64
+}
+
+// measureTracker walks through the events of a score in the order in which
+// they're played (like octaveTracker), keeping track of the length of each
+// part's current measure, and calls visit for each measure that ends at a
+// barline.
+//
+// Like beatGrouper, lengths are worked out from the note lengths in the AST,
+// so a measure's length is only known if every event in it can be timed
+// without evaluating the score.
+type measureTracker struct {
+	visit  func(position measurePosition)
+	meters *timeSignatureTracker
+	// The position of each part, keyed by its alias or names (see partKey)
+	parts map[string]*measurePosition
+	// The position of the current part
+	current *measurePosition
+	// The variable definitions in effect
+	variables map[string]variableScope
+}
+
+func newMeasureTracker(
+	visit func(position measurePosition),
+) *measureTracker {
+	tracker := &measureTracker{
+		visit:     visit,
+		meters:    &timeSignatureTracker{parts: map[string]model.TimeSignature{}},
+		parts:     map[string]*measurePosition{},
+		variables: map[string]variableScope{},
+	}
+	tracker.enterPart("")
+
+	return tracker
+}
+
+func (t *measureTracker) enterPart(key string) {
+	t.meters.enterPart(key)
+
+	if _, ok := t.parts[key]; !ok {
+		t.parts[key] = &measurePosition{number: 1, noteBeats: 1}
+	}
+	t.current = t.parts[key]
+}
+
+// walkRoot walks the parts of a score.
+func (t *measureTracker) walkRoot(root *ASTNode) {
+	for i := range root.Children {
+		part := &root.Children[i]
+
+		switch part.Type {
+		case ImplicitPartNode:
+			t.enterPart("")
+		case PartNode:
+			t.enterPart(partKey(part.Children[0]))
+		default:
+			continue
+		}
+
+		t.walk(&part.Children[len(part.Children)-1], 0)
+	}
+}
+
+// walk walks an event, or a node that contains events. repetition is the
+// repetition of the innermost enclosing repeat that's being walked, or 0 if
+// the node isn't within a repeat.
+func (t *measureTracker) walk(node *ASTNode, repetition int) {
+	switch node.Type {
+	case BarlineNode:
+		t.endMeasure()
+
+	case NoteNode, RestNode:
+		for i := range node.Children {
+			if node.Children[i].Type == DurationNode &&
+				hasBarline(node.Children[i]) {
+				t.walkTiedAcrossBarline(node, node.Children[i])
+				return
+			}
+		}
+
+		t.advance(node, eventBeats(*node, &t.current.noteBeats))
+
+	case MultiMeasureRestNode:
+		// A multi-measure rest is equivalent to a rest lasting a measure for each
+		// measure, separated by barlines.
+		measures, _ := node.Literal.(int32)
+		for i := int32(0); i < measures; i++ {
+			if i > 0 {
+				t.endMeasure()
+			}
+
+			t.advance(node, t.meters.current.MeasureBeats())
+		}
+
+		t.current.noteBeats = t.meters.current.MeasureBeats()
+
+	case TimeSignatureNode:
+		if timeSig, err := timeSignature(*node); err == nil {
+			t.meters.set(timeSig, false)
+		}
+
+	case LispListNode:
+		if timeSig, global, ok := lispTimeSignature(*node); ok {
+			t.meters.set(timeSig, global)
+		}
+
+		t.advance(node, eventBeats(*node, &t.current.noteBeats))
+
+	case RepeatNode:
+		times, _ := node.Children[1].Literal.(int32)
+
+		for repetition := 1; repetition <= int(times) &&
+			repetition <= maxMeasureRepetitions; repetition++ {
+			t.walk(&node.Children[0], repetition)
+		}
+
+	case OnRepetitionsNode:
+		if repetition == 0 || occursOnRepetition(node.Children[1], repetition) {
+			t.walk(&node.Children[0], repetition)
+		}
+
+	case VariableDefinitionNode:
+		name, _ := node.Children[0].Literal.(string)
+		scope := variableScope{events: &node.Children[1], variables: t.variables}
+		t.variables = copyVariableScopes(t.variables)
+		t.variables[name] = scope
+
+	case VariableReferenceNode:
+		name, _ := node.Literal.(string)
+		scope, ok := t.variables[name]
+		if !ok {
+			// The variable isn't defined (yet), so we can't tell how long it lasts.
+			t.advance(node, -1)
+			t.current.noteBeats = 0
+			return
+		}
+
+		variables := t.variables
+		t.variables = scope.variables
+		t.walk(scope.events, repetition)
+		t.variables = variables
+
+	case VoiceGroupNode:
+		t.walkVoiceGroup(node, repetition)
+
+	case EventSequenceNode, VoiceNode:
+		for i := range node.Children {
+			t.walk(&node.Children[i], repetition)
+		}
+
+	default:
+		t.advance(node, eventBeats(*node, &t.current.noteBeats))
+	}
+}
+
+// walkTiedAcrossBarline walks a note or rest whose duration has a barline
+// within it (e.g. `c2~|4`), which ends the measure partway through the note.
+func (t *measureTracker) walkTiedAcrossBarline(node *ASTNode, duration ASTNode) {
+	for _, component := range duration.Children {
+		if component.Type == BarlineNode {
+			t.endMeasure()
+			continue
+		}
+
+		beats, ok := noteLengthNodeBeats(component)
+		if !ok {
+			beats = -1
+		}
+
+		t.advance(node, beats)
+	}
+
+	beats, ok := durationBeats(duration)
+	if !ok {
+		beats = 0
+	}
+
+	t.current.noteBeats = beats
+}
+
+// advance moves the current part past an event that lasts the given number of
+// beats, or -1 if it can't be determined.
+func (t *measureTracker) advance(node *ASTNode, beats float64) {
+	if beats == 0 {
+		return
+	}
+
+	if t.current.start == nil {
+		t.current.start = node
+		t.current.meter = t.meters.current
+	}
+
+	if beats < 0 || t.current.beats < 0 {
+		t.current.beats = -1
+		return
+	}
+
+	t.current.beats += beats
+}
+
+// endMeasure visits the current part's measure, if there's anything in it, and
+// starts the next one.
+func (t *measureTracker) endMeasure() {
+	if t.current.start == nil {
+		return
+	}
+
+	t.visit(*t.current)
+
+	t.current.number++
+	t.current.beats = 0
+	t.current.start = nil
+}
+
+// walkVoiceGroup walks each voice starting from the position at the start of
+// the group. Afterwards, the part continues from the position at which the
+// voices end, if they all end at the same one.
+func (t *measureTracker) walkVoiceGroup(node *ASTNode, repetition int) {
+	start := *t.current
+	var end *measurePosition
+
+	for i := range node.Children {
+		if node.Children[i].Type != VoiceNode {
+			continue
+		}
+
+		*t.current = start
+		t.walk(&node.Children[i], repetition)
+
+		if end == nil {
+			voiceEnd := *t.current
+			end = &voiceEnd
+			continue
+		}
+
+		if end.number != t.current.number ||
+			math.Abs(end.beats-t.current.beats) >= beatGroupingEpsilon {
+			end.beats = -1
+		}
+		if end.noteBeats != t.current.noteBeats {
+			end.noteBeats = 0
+		}
+	}
+
+	if end != nil {
+		*t.current = *end
+	}
+}
+
+// CheckMeasureLengths returns an error (a MeasureLengthError, wrapped in an
+// AldaSourceError at the first event of the measure) for each measure whose
+// length doesn't match the time signature in effect at its start, e.g. five
+// quarter notes between barlines in 4/4. Each measure is reported once, even if
+// it's played more than once.
+//
+// The time signature is tracked from the time signature shorthand (e.g. `3/4`)
+// and from time signature attribute changes with a literal time signature,
+// e.g. `(time-signature '(3 4))`. Measure lengths are worked out from the note
+// lengths, including dots and ties.
+//
+// Only measures that end at a barline are checked, so the last measure of a
+// part can be left incomplete, as can the first one, which is reported, but
+// can be told apart as a pickup measure (see MeasureLengthError.Pickup).
+// Measures before the first time signature aren't checked, and neither are
+// measures whose length can't be determined without evaluating the score, e.g.
+// because of a duration in milliseconds, which depends on the tempo.
+//
+// Each voice of a voice group is checked separately, continuing the measure
+// that's in progress at the start of the group.
+func CheckMeasureLengths(root ASTNode) []error {
+	errors := []error{}
+	reported := map[*ASTNode]bool{}
+
+	tracker := newMeasureTracker(func(position measurePosition) {
+		if position.meter.Numerator == 0 || position.beats < 0 ||
+			reported[position.start] ||
+			math.Abs(position.beats-position.meter.MeasureBeats()) <
+				beatGroupingEpsilon {
+			return
+		}
+
+		reported[position.start] = true
+		errors = append(errors, &model.AldaSourceError{
+			Context: position.start.SourceContext,
+			Err: &MeasureLengthError{
+				Number:        position.number,
+				TimeSignature: position.meter,
+				Beats:         position.beats,
+			},
+		})
+	})
+
+	tracker.walkRoot(&root)
+
+	return errors
+}
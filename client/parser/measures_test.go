@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestCheckMeasureLengths(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected []string
+	}{
+		{
+			label:    "full measures in 4/4",
+			given:    "piano: 4/4 c4 d e f | g2. a8. b16 | c1~|2 d2 | R*2 | e",
+			expected: []string{},
+		},
+		{
+			label: "overfull and underfull measures in 4/4",
+			given: "piano: (time-signature '(4 4)) c4 d e f | g2 a2. | b4 c8 d | e",
+			expected: []string{
+				"piece.alda:1:43 measure 2 is overfull: it has 5 beats, but 4/4 " +
+					"has 4 beats",
+				"piece.alda:1:52 measure 3 is underfull: it has 2 beats, but 4/4 " +
+					"has 4 beats",
+			},
+		},
+		{
+			label: "full measures in common meters",
+			given: "piano: 3/4 c4 d e | 2/4 c d | 6/8 c8 d e f4. | 2/2 c2 d | " +
+				"5/4 c1~4 | e",
+			expected: []string{},
+		},
+		{
+			label: "overfull measures in common meters",
+			given: "piano: 3/4 c4 d e f | 6/8 c4. d4. e8 | 2/2 c2 d e | f",
+			expected: []string{
+				"piece.alda:1:12 measure 1 is overfull: it has 4 beats, but 3/4 " +
+					"has 3 beats",
+				"piece.alda:1:27 measure 2 is overfull: it has 3.5 beats, but 6/8 " +
+					"has 3 beats",
+				"piece.alda:1:44 measure 3 is overfull: it has 6 beats, but 2/2 " +
+					"has 4 beats",
+			},
+		},
+		{
+			label:    "crams and triplets",
+			given:    "piano: 2/4 {c d e}4 c4/e/g | c6 d e | c4 [d8 e]",
+			expected: []string{},
+		},
+		{
+			label: "measure numbers",
+			given: "piano: 2/4 c4 | d e | f g a | b",
+			expected: []string{
+				"piece.alda:1:12 measure 1 is underfull: it has 1 beat, but 2/4 " +
+					"has 2 beats (pickup)",
+				"piece.alda:1:23 measure 3 is overfull: it has 3 beats, but 2/4 " +
+					"has 2 beats",
+			},
+		},
+		{
+			label: "each part has its own measures",
+			given: "(time-sig! '(3 4))\npiano: c4 d e | f\nviolin: c2 | d\n" +
+				"piano: g2. | a",
+			expected: []string{
+				"piece.alda:3:9 measure 1 is underfull: it has 2 beats, but 3/4 " +
+					"has 3 beats (pickup)",
+				"piece.alda:2:17 measure 2 is overfull: it has 4 beats, but 3/4 " +
+					"has 3 beats",
+			},
+		},
+		{
+			label: "measures in a repeat",
+			given: "piano: 3/4 [c4 d e | f2 g4'1 | a2'2 |]*2",
+			expected: []string{
+				"piece.alda:1:22 measure 4 is underfull: it has 2 beats, but 3/4 " +
+					"has 3 beats",
+				"piece.alda:1:32 measure 5 is underfull: it has 2 beats, but 3/4 " +
+					"has 3 beats",
+			},
+		},
+		{
+			// The measure in the variable is reported once, even though it's short
+			// both times it's played.
+			label: "measures in a variable",
+			given: "riff = c4 d e |\npiano: 4/4 riff riff f | g",
+			expected: []string{
+				"piece.alda:1:8 measure 1 is underfull: it has 3 beats, but 4/4 " +
+					"has 4 beats (pickup)",
+				"piece.alda:2:22 measure 3 is underfull: it has 1 beat, but 4/4 " +
+					"has 4 beats",
+			},
+		},
+		{
+			label:    "measures that can't be timed",
+			given:    "piano: 4/4 c4 riff | d4 e500ms f4 | g1",
+			expected: []string{},
+		},
+	} {
+		ast, err := Parse("piece.alda", testCase.given)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+
+		actual := []string{}
+		for _, err := range CheckMeasureLengths(ast) {
+			description := err.Error()
+
+			var measureErr *MeasureLengthError
+			if errors.As(err, &measureErr) && measureErr.Pickup() {
+				description += " (pickup)"
+			}
+
+			actual = append(actual, description)
+		}
+
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf(
+				"%s\nexpected: %q\nactual: %q",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+func TestMultiMeasureRests(t *testing.T) {
+	executeParseTestCases(
+		t,
+		parseTestCase{
+			label: "multi-measure rest",
+			given: "piano: R*8 c",
+			expectUpdates: []model.ScoreUpdate{
+				model.PartDeclaration{Names: []string{"piano"}},
+				model.MultiMeasureRest{Measures: 8},
+				letterNote(model.C),
+			},
+		},
+		parseTestCase{
+			label: "multi-measure rest after a time signature and before a barline",
+			given: "3/4 R*2| c",
+			expectUpdates: []model.ScoreUpdate{
+				timeSignatureUpdate(3, 4),
+				model.MultiMeasureRest{Measures: 2},
+				model.Barline{},
+				letterNote(model.C),
+			},
+		},
+		parseTestCase{
+			label: "multi-measure rest in an event sequence",
+			given: "[c R*2]",
+			expectUpdates: []model.ScoreUpdate{
+				eventSequence(
+					letterNote(model.C), model.MultiMeasureRest{Measures: 2},
+				),
+			},
+		},
+	)
+}
+
+func TestMultiMeasureRestErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		given    string
+		expected string
+	}{
+		{
+			given: "piano: R*0",
+			expected: "piece.alda:1:8 a multi-measure rest must last at least one " +
+				"measure",
+		},
+		{
+			given:    "piano: R*x",
+			expected: "piece.alda:1:10 Unexpected 'x' in multi-measure rest",
+		},
+		{
+			given:    "piano: R*2x",
+			expected: "piece.alda:1:11 Unexpected 'x' in multi-measure rest",
+		},
+	} {
+		_, err := Parse("piece.alda", testCase.given)
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.given)
+			continue
+		}
+
+		if actual := err.Error(); actual != testCase.expected {
+			t.Errorf(
+				"%s\nexpected error: %s\nactual error: %s",
+				testCase.given, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+func TestFormatMultiMeasureRests(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "multi-measure rests are single texts",
+			given:    "piano: 3/4 R*8|c   R*12",
+			opts:     []formatterOption{ConfigureSoftWrapLen(12)},
+			expected: "piano:\n  3/4 R*8 |\n  c R*12\n",
+		},
+	)
+}
+
+func TestExpandMultiMeasureRests(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected string
+	}{
+		{
+			label:    "default time signature",
+			given:    "R*2 c",
+			expected: "r1 | r1 c\n",
+		},
+		{
+			label:    "time signature changes before the rests",
+			given:    "piano: 3/4 R*2 | c 6/8 R*1 2/2 R*1",
+			expected: "piano:\n  3/4 r2. | r2. | c 6/8 r2. 2/2 r1\n",
+		},
+		{
+			label:    "measures that can't be a single note length",
+			given:    "5/4 R*2 7/8 R*1",
+			expected: "5/4 r1~4 | r1~4 7/8 r2..\n",
+		},
+		{
+			label:    "time signature attribute",
+			given:    "(time-sig '(6 8)) R*1 (time-signature '(3 2)) R*1",
+			expected: "(time-sig '(6 8)) r2. (time-signature '(3 2)) r1.\n",
+		},
+		{
+			label: "time signatures per part",
+			given: "piano: 3/4 c violin: R*1 piano: R*1",
+			expected: "piano:\n  3/4 c\n\nviolin:\n  r1\n\n" +
+				"piano:\n  r2.\n",
+		},
+		{
+			label: "global time signature",
+			given: "piano: (time-signature! '(2 4)) violin: R*1 piano: R*1",
+			expected: "piano:\n  (time-signature! '(2 4))\n\nviolin:\n  r2\n\n" +
+				"piano:\n  r2\n",
+		},
+	} {
+		ast, err := Parse("", testCase.given, SuppressSourceContext)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		original := ast.Clone()
+		expanded := ExpandMultiMeasureRests(ast)
+
+		if !ASTEqual(ast, original) {
+			t.Errorf("%s: expected the original AST to be unchanged", testCase.label)
+		}
+
+		buffer := bytes.Buffer{}
+		if err := FormatASTToCode(expanded, &buffer); err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if actual := buffer.String(); actual != testCase.expected {
+			t.Error(testCase.label)
+			t.Errorf("expected:\n%s\nactual:\n%s", testCase.expected, actual)
+		}
+	}
+
+	// Where a single event is expected, the rests are wrapped in an event
+	// sequence.
+	repeated := implicitPart(ASTNode{
+		Type: RepeatNode,
+		Children: []ASTNode{
+			{Type: MultiMeasureRestNode, Literal: int32(2)},
+			{Type: TimesNode, Literal: int32(3)},
+		},
+	})
+
+	expanded := ExpandMultiMeasureRests(repeated)
+	if problems := ValidateAST(expanded); len(problems) > 0 {
+		t.Errorf("expected a valid AST, got: %v", problems)
+	}
+
+	repeat := expanded.Children[0].Children[0].Children[0]
+	if events := repeat.Children[0]; events.Type != EventSequenceNode ||
+		len(events.Children) != 3 {
+		t.Errorf("expected an event sequence of 3 events, got %#v", events)
+	}
+}
+
+// Expanding multi-measure rests doesn't change the score.
+func TestExpandMultiMeasureRestsEquivalence(t *testing.T) {
+	scoreFor := func(ast ASTNode) *model.Score {
+		updates, err := ast.Updates()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		score := model.NewScore()
+		if err := score.Update(updates...); err != nil {
+			t.Fatal(err)
+		}
+
+		return score
+	}
+
+	ast, err := Parse(
+		"piece.alda",
+		"piano: 3/4 c R*2 | d 7/8 R*3 e | violin: R*4 f piano: {R*1 g}2 a",
+		SuppressSourceContext,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The note events of a score, without their parts, which are different
+	// pointers in each score.
+	noteEvents := func(score *model.Score) []model.NoteEvent {
+		events := []model.NoteEvent{}
+		for _, event := range score.Events {
+			noteEvent := event.(model.NoteEvent)
+			noteEvent.Part = nil
+			events = append(events, noteEvent)
+		}
+
+		return events
+	}
+
+	rests := scoreFor(ast)
+	expanded := scoreFor(ExpandMultiMeasureRests(ast))
+
+	if !reflect.DeepEqual(noteEvents(rests), noteEvents(expanded)) {
+		t.Errorf(
+			"expected the same events\nrests: %#v\nexpanded: %#v",
+			noteEvents(rests), noteEvents(expanded),
+		)
+	}
+
+	for i, part := range rests.Parts {
+		if part.CurrentOffset != expanded.Parts[i].CurrentOffset {
+			t.Errorf(
+				"%s: expected the same offset, got %f and %f",
+				part.Name, part.CurrentOffset, expanded.Parts[i].CurrentOffset,
+			)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+// nested returns the source code of an event nested the given number of levels
+// deep within the given brackets, e.g. "{{{c}}}".
+func nested(depth int, open string, event string, close string) string {
+	return strings.Repeat(open, depth) + event + strings.Repeat(close, depth)
+}
+
+func TestMaxNestingDepth(t *testing.T) {
+	depth := DefaultMaxNestingDepth + 1
+
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected string
+	}{
+		{
+			label: "cram expressions",
+			given: nested(depth, "{", "c", "}"),
+			expected: "piece.alda:1:10001 exceeded the maximum nesting depth " +
+				"of 10000",
+		},
+		{
+			label: "event sequences",
+			given: "piano: " + nested(depth, "[", "c", "]"),
+			expected: "piece.alda:1:10008 exceeded the maximum nesting depth " +
+				"of 10000",
+		},
+		{
+			label: "S-expressions",
+			given: nested(depth, "(", "", ")"),
+			expected: "piece.alda:1:10001 exceeded the maximum nesting depth " +
+				"of 10000",
+		},
+		{
+			label: "a mixture of constructs",
+			given: nested(depth/2+1, "[{", "c", "}]"),
+			expected: "piece.alda:1:10001 exceeded the maximum nesting depth " +
+				"of 10000",
+		},
+	} {
+		_, err := Parse("piece.alda", testCase.given)
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.label)
+			continue
+		}
+
+		if actual := err.Error(); actual != testCase.expected {
+			t.Errorf(
+				"%s\nexpected error: %s\nactual error: %s",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+
+	if _, err := Parse(
+		"piece.alda", nested(DefaultMaxNestingDepth, "{", "c", "}"),
+	); err != nil {
+		t.Errorf("expected the maximum nesting depth to be allowed, got %v", err)
+	}
+
+	if _, err := Parse(
+		"piece.alda", nested(depth, "{", "c", "}"), MaxNestingDepth(depth),
+	); err != nil {
+		t.Errorf("expected a configured nesting depth to be allowed, got %v", err)
+	}
+
+	_, err := Parse("piece.alda", "c [d {e (f)}]", MaxNestingDepth(2))
+	expected := "piece.alda:1:9 exceeded the maximum nesting depth of 2"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error: %s\nactual error: %v", expected, err)
+	}
+}
+
+func TestFormatMaxNestingDepth(t *testing.T) {
+	depth := DefaultMaxNestingDepth + 1
+
+	ast, err := Parse(
+		"piece.alda", "piano: "+nested(depth, "[", "c", "]"),
+		MaxNestingDepth(depth),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "piece.alda:1:10008 exceeded the maximum nesting depth of 10000"
+	if err := FormatASTToCode(ast, io.Discard); err == nil {
+		t.Error("expected an error")
+	} else if actual := err.Error(); actual != expected {
+		t.Errorf("expected error: %s\nactual error: %s", expected, actual)
+	}
+
+	if err := FormatASTToCode(
+		ast, io.Discard,
+		ConfigureMaxNestingDepth(depth), ConfigureNoIndent(true),
+	); err != nil {
+		t.Errorf("expected a configured nesting depth to be allowed, got %v", err)
+	}
+
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "nesting within the configured depth",
+			given:    "c [d {e (f)}]",
+			opts:     []formatterOption{ConfigureMaxNestingDepth(3)},
+			expected: "c\n[\n  d { e (f) }\n]\n",
+		},
+	)
+
+	ast, err = Parse("piece.alda", "c [d {e (f)}]")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = "piece.alda:1:9 exceeded the maximum nesting depth of 2"
+	if err := FormatASTToCode(
+		ast, io.Discard, ConfigureMaxNestingDepth(2),
+	); err == nil || err.Error() != expected {
+		t.Errorf("expected error: %s\nactual error: %v", expected, err)
+	}
+}
+
+// A deeply nested AST is formatted in time proportional to its size (see
+// formatter.inlineText).
+func TestFormatDeeplyNestedCrams(t *testing.T) {
+	depth := 2000
+
+	ast, err := Parse("piece.alda", nested(depth, "{", "c", "}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := strings.Builder{}
+	if err := FormatASTToCode(
+		ast, &output, ConfigureMinified(true),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := nested(depth, "{", "c", "}") + "\n"
+	if output.String() != expected {
+		t.Errorf("expected the minified crams to be unchanged")
+	}
+}
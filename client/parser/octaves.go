@@ -0,0 +1,441 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"alda.io/client/model"
+)
+
+const (
+	// MinOctave is the lowest octave in which a note can be played, i.e. the
+	// octave of MIDI note 0.
+	MinOctave = -1
+	// MaxOctave is the highest octave in which a note can be played, i.e. the
+	// octave of MIDI note 127.
+	MaxOctave = 9
+)
+
+// defaultOctave is the octave of a part that hasn't set one.
+const defaultOctave = 4
+
+// maxOctaveRepetitions is the maximum number of repetitions of a repeat that
+// octaveTracker walks through. A repeated passage either leaves the octave as
+// it found it, in which case one repetition is enough, or shifts it, in which
+// case its notes are out of range within a dozen repetitions or so.
+const maxOctaveRepetitions = 32
+
+// An octave is the octave in effect at a point in a score, as far as it can be
+// determined from the AST.
+type octave struct {
+	number int32
+	// False if the octave can't be determined without evaluating the score, e.g.
+	// after a group of voices that end in different octaves
+	known bool
+}
+
+// A pitchContext is the state of a part that determines the pitches of its
+// notes, as far as it can be determined from the AST: the octave, along with
+// the transposition and key signature set by attribute changes.
+type pitchContext struct {
+	octave octave
+	// The transposition, in semitones
+	transposition int32
+	// The number of semitones by which the key signature raises or lowers notes
+	// without accidentals, indexed by model.NoteLetter
+	keySignature [7]int32
+	// False if the transposition or the key signature can't be determined
+	// without evaluating the score, e.g. after a variable reference that's not
+	// defined yet
+	transpositionKnown, keySignatureKnown bool
+	// Whether the key signature can have been set by an attribute change, and
+	// whether it can be the default one without accidentals, which are both
+	// true e.g. after a group of voices where only some of them set it
+	keyed, unkeyed bool
+}
+
+// octaveTracker walks through the events of a score, keeping track of the
+// octave of each part, along with the rest of its pitchContext, and calls
+// visit for each note and attribute change that it tracks with the context in
+// effect just before it.
+//
+// The events are walked in the order in which they're played: the events of a
+// repeat are walked once for each repetition (see maxOctaveRepetitions), and
+// the events of a variable are walked wherever the variable is referenced. So
+// the same node can be visited more than once, with different contexts.
+type octaveTracker struct {
+	visit func(node *ASTNode, current pitchContext)
+	// The context of each part, keyed by its alias or names (see partKey)
+	parts map[string]*pitchContext
+	// The key of the current part
+	currentKey string
+	// The context of the current part
+	current *pitchContext
+	// The context of a part that hasn't been entered yet, which is changed by a
+	// global attribute change, e.g. `(octave! 3)`
+	initial pitchContext
+	// The variable definitions in effect
+	variables map[string]variableScope
+}
+
+// A variableScope is a variable definition, along with the definitions that
+// were in effect where it was defined, which its events refer to.
+type variableScope struct {
+	events    *ASTNode
+	variables map[string]variableScope
+}
+
+func newOctaveTracker(
+	visit func(node *ASTNode, current pitchContext),
+) *octaveTracker {
+	tracker := &octaveTracker{
+		visit: visit,
+		parts: map[string]*pitchContext{},
+		initial: pitchContext{
+			octave:             octave{number: defaultOctave, known: true},
+			transpositionKnown: true,
+			keySignatureKnown:  true,
+			unkeyed:            true,
+		},
+		variables: map[string]variableScope{},
+	}
+	tracker.enterPart("")
+
+	return tracker
+}
+
+func (t *octaveTracker) enterPart(key string) {
+	if _, ok := t.parts[key]; !ok {
+		initial := t.initial
+		t.parts[key] = &initial
+	}
+	t.currentKey = key
+	t.current = t.parts[key]
+}
+
+// walkRoot walks the parts of a score.
+func (t *octaveTracker) walkRoot(root *ASTNode) {
+	for i := range root.Children {
+		part := &root.Children[i]
+
+		switch part.Type {
+		case ImplicitPartNode:
+			t.enterPart("")
+		case PartNode:
+			t.enterPart(partKey(part.Children[0]))
+		default:
+			continue
+		}
+
+		t.walk(&part.Children[len(part.Children)-1], 0)
+	}
+}
+
+// walk walks an event, or a node that contains events. repetition is the
+// repetition of the innermost enclosing repeat that's being walked, or 0 if
+// the node isn't within a repeat.
+func (t *octaveTracker) walk(node *ASTNode, repetition int) {
+	switch node.Type {
+	case NoteNode:
+		t.visit(node, *t.current)
+
+	case OctaveSetNode:
+		t.visit(node, *t.current)
+		number, _ := node.Literal.(int32)
+		t.current.octave = octave{number: number, known: true}
+
+	case OctaveUpNode:
+		t.visit(node, *t.current)
+		t.current.octave.number++
+
+	case OctaveDownNode:
+		t.visit(node, *t.current)
+		t.current.octave.number--
+
+	case LispListNode:
+		t.walkLispList(node)
+
+	case RepeatNode:
+		t.walkRepeat(node)
+
+	case OnRepetitionsNode:
+		if repetition == 0 || occursOnRepetition(node.Children[1], repetition) {
+			t.walk(&node.Children[0], repetition)
+		}
+
+	case VariableDefinitionNode:
+		name, _ := node.Children[0].Literal.(string)
+		scope := variableScope{events: &node.Children[1], variables: t.variables}
+		t.variables = copyVariableScopes(t.variables)
+		t.variables[name] = scope
+
+	case VariableReferenceNode:
+		name, _ := node.Literal.(string)
+		scope, ok := t.variables[name]
+		if !ok {
+			// The variable isn't defined (yet), so we can't tell what it does.
+			t.current.octave.known = false
+			t.current.transpositionKnown = false
+			t.current.keySignatureKnown = false
+			t.current.keyed = true
+			return
+		}
+
+		variables := t.variables
+		t.variables = scope.variables
+		t.walk(scope.events, repetition)
+		t.variables = variables
+
+	case VoiceGroupNode:
+		t.walkVoiceGroup(node, repetition)
+
+	default:
+		for i := range node.Children {
+			t.walk(&node.Children[i], repetition)
+		}
+	}
+}
+
+// walkLispList handles the attribute changes that the tracker keeps track of:
+// octave changes, e.g. `(octave 5)`, `(octave 'up)` or `(octave! 2)`,
+// transposition changes, e.g. `(transpose -2)`, and key signature changes,
+// e.g. `(key-sig "f+ c+")` or `(key-sig '(a major))`.
+func (t *octaveTracker) walkLispList(node *ASTNode) {
+	if len(node.Children) != 2 || node.Children[0].Type != LispSymbolNode {
+		return
+	}
+
+	name, _ := node.Children[0].Literal.(string)
+	argument := node.Children[1]
+
+	var change func(c *pitchContext)
+
+	switch strings.TrimSuffix(name, "!") {
+	case "octave":
+		change = func(c *pitchContext) { changeOctave(&c.octave, argument) }
+	case "transposition", "transpose":
+		change = func(c *pitchContext) {
+			number, ok := argument.Literal.(float64)
+			c.transposition = int32(number)
+			c.transpositionKnown = ok
+		}
+	case "key-signature", "key-sig":
+		change = func(c *pitchContext) { changeKeySignature(c, argument) }
+	default:
+		return
+	}
+
+	t.visit(node, *t.current)
+
+	if !strings.HasSuffix(name, "!") {
+		change(t.current)
+		return
+	}
+
+	change(&t.initial)
+	for _, part := range t.parts {
+		change(part)
+	}
+}
+
+// changeOctave applies the argument of an octave attribute change to an
+// octave.
+func changeOctave(o *octave, argument ASTNode) {
+	if argument.Type == LispQuotedFormNode && len(argument.Children) == 1 {
+		argument = argument.Children[0]
+	}
+
+	switch argument.Type {
+	case LispNumberNode:
+		number, _ := argument.Literal.(float64)
+		*o = octave{number: int32(number), known: true}
+	case LispSymbolNode:
+		switch argument.Literal {
+		case "up":
+			o.number++
+		case "down":
+			o.number--
+		default:
+			o.known = false
+		}
+	default:
+		o.known = false
+	}
+}
+
+// changeKeySignature applies the argument of a key signature attribute change
+// to a context. The key signature can be written as note letters and
+// accidentals, e.g. `"f+ c+"`, or as the name of a scale, e.g. `'(a major)`. An
+// empty string, i.e. `""`, is the key signature without any accidentals.
+func changeKeySignature(c *pitchContext, argument ASTNode) {
+	c.keyed, c.unkeyed = true, false
+
+	if tonic, scaleName, ok := keySignatureScale(argument); ok {
+		c.keySignature = scaleKeySignature(tonic, scaleTypes[scaleName])
+		c.keySignatureKnown = true
+		return
+	}
+
+	text, _ := argument.Literal.(string)
+	if argument.Type == LispStringNode && strings.TrimSpace(text) == "" {
+		c.keySignature = [7]int32{}
+		c.keySignatureKnown = true
+		return
+	}
+
+	entries, ok := keySignatureEntries(argument)
+	if !ok {
+		c.keySignatureKnown = false
+		return
+	}
+
+	c.keySignature = [7]int32{}
+	c.keySignatureKnown = true
+
+	for _, entry := range entries {
+		letter, err := model.NewNoteLetter(rune(entry.letter[0]))
+		if err != nil {
+			c.keySignatureKnown = false
+			return
+		}
+
+		for _, accidental := range entry.accidentals {
+			switch accidental {
+			case "sharp":
+				c.keySignature[letter]++
+			case "flat":
+				c.keySignature[letter]--
+			}
+		}
+	}
+}
+
+func (t *octaveTracker) walkRepeat(node *ASTNode) {
+	times, _ := node.Children[1].Literal.(int32)
+
+	for repetition := 1; repetition <= int(times) &&
+		repetition <= maxOctaveRepetitions; repetition++ {
+		start := *t.current
+		t.walk(&node.Children[0], repetition)
+
+		// If the octave is the same as it was at the start of this repetition, the
+		// remaining repetitions would be walked in the same way, unless some of
+		// the events occur only on certain repetitions.
+		if *t.current == start && !hasRepetitions(node.Children[0]) {
+			break
+		}
+	}
+}
+
+func hasRepetitions(node ASTNode) bool {
+	return len(node.FindByType(OnRepetitionsNode)) > 0 ||
+		node.Type == OnRepetitionsNode
+}
+
+// occursOnRepetition reports whether a RepetitionsNode (e.g. `'1-2,4`) includes
+// the given repetition.
+func occursOnRepetition(repetitions ASTNode, repetition int) bool {
+	for _, rangeNode := range repetitions.Children {
+		if len(rangeNode.Children) != 2 {
+			continue
+		}
+
+		first, _ := rangeNode.Children[0].Literal.(int32)
+		last, _ := rangeNode.Children[1].Literal.(int32)
+
+		if int(first) <= repetition && repetition <= int(last) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// walkVoiceGroup walks each voice starting from the context at the start of
+// the group. Afterwards, the part continues in the context in which the voices
+// end, as far as they all end in the same one.
+func (t *octaveTracker) walkVoiceGroup(node *ASTNode, repetition int) {
+	start := *t.current
+	var end *pitchContext
+
+	for i := range node.Children {
+		if node.Children[i].Type != VoiceNode {
+			continue
+		}
+
+		*t.current = start
+		t.walk(&node.Children[i], repetition)
+
+		if end == nil {
+			voiceEnd := *t.current
+			end = &voiceEnd
+			continue
+		}
+
+		if end.octave != t.current.octave {
+			end.octave.known = false
+		}
+		if end.transposition != t.current.transposition ||
+			!t.current.transpositionKnown {
+			end.transpositionKnown = false
+		}
+		if end.keySignature != t.current.keySignature ||
+			!t.current.keySignatureKnown {
+			end.keySignatureKnown = false
+		}
+		end.keyed = end.keyed || t.current.keyed
+		end.unkeyed = end.unkeyed || t.current.unkeyed
+	}
+
+	if end != nil {
+		*t.current = *end
+	}
+}
+
+func copyVariableScopes(
+	variables map[string]variableScope,
+) map[string]variableScope {
+	copied := make(map[string]variableScope, len(variables)+1)
+	for name, scope := range variables {
+		copied[name] = scope
+	}
+
+	return copied
+}
+
+// CheckOctaveRange returns an error for each note that's played in an octave
+// outside the range in which notes can be played (see MinOctave and MaxOctave),
+// e.g. because of a runaway sequence of octave changes like `>>>>`. The error
+// is reported at the note, and only once per note, even if it's played more
+// than once.
+//
+// The octave of each part is worked out from the octave changes in the AST,
+// including octave attribute changes like `(octave 5)`, in the order in which
+// the events are played, i.e. through repeats and variable references. Notes
+// whose octave can't be determined without evaluating the score, e.g. after
+// a group of voices that end in different octaves, aren't checked.
+func CheckOctaveRange(root ASTNode) []error {
+	errors := []error{}
+	reported := map[*ASTNode]bool{}
+
+	tracker := newOctaveTracker(func(node *ASTNode, context pitchContext) {
+		current := context.octave
+		if node.Type != NoteNode || !current.known || reported[node] ||
+			(MinOctave <= current.number && current.number <= MaxOctave) {
+			return
+		}
+
+		reported[node] = true
+		errors = append(errors, &model.AldaSourceError{
+			Context: node.SourceContext,
+			Err: fmt.Errorf(
+				"note in octave %d, outside the range of octaves %d to %d",
+				current.number, MinOctave, MaxOctave,
+			),
+		})
+	})
+
+	tracker.walkRoot(&root)
+
+	return errors
+}
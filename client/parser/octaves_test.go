@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"reflect"
 	"testing"
 
 	"alda.io/client/model"
@@ -109,3 +110,115 @@ func TestOctaves(t *testing.T) {
 		},
 	)
 }
+
+func TestCheckOctaveRange(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected []string
+	}{
+		{
+			label:    "in range",
+			given:    "piano: (octave -1) c > c o9 c < c\nviolin: >>>>> c",
+			expected: []string{},
+		},
+		{
+			label: "runaway octave changes",
+			given: "piano: o8 c >> d e < f",
+			expected: []string{
+				"piece.alda:1:16 note in octave 10, outside the range of octaves " +
+					"-1 to 9",
+				"piece.alda:1:18 note in octave 10, outside the range of octaves " +
+					"-1 to 9",
+			},
+		},
+		{
+			label: "octave set out of range",
+			given: "piano: o0 c < d << e",
+			expected: []string{
+				"piece.alda:1:20 note in octave -3, outside the range of octaves " +
+					"-1 to 9",
+			},
+		},
+		{
+			label: "octave attribute changes",
+			given: "piano: (octave 9) c (octave 'up) d\nviolin: (octave! 12)\n" +
+				"cello: e",
+			expected: []string{
+				"piece.alda:1:34 note in octave 10, outside the range of octaves " +
+					"-1 to 9",
+				"piece.alda:3:8 note in octave 12, outside the range of octaves " +
+					"-1 to 9",
+			},
+		},
+		{
+			label: "each part has its own octave",
+			given: "piano: o9 c >\nviolin: c\npiano: c",
+			expected: []string{
+				"piece.alda:3:8 note in octave 10, outside the range of octaves " +
+					"-1 to 9",
+			},
+		},
+		{
+			label: "octave changes in a repeat",
+			given: "piano: [c >]*8",
+			expected: []string{
+				"piece.alda:1:9 note in octave 10, outside the range of octaves " +
+					"-1 to 9",
+			},
+		},
+		{
+			label:    "repeat that returns to the same octave",
+			given:    "piano: o9 [c < c >]*100",
+			expected: []string{},
+		},
+		{
+			label: "octave changes on certain repetitions",
+			given: "piano: o9 [c >'2]*3",
+			expected: []string{
+				"piece.alda:1:12 note in octave 10, outside the range of octaves " +
+					"-1 to 9",
+			},
+		},
+		{
+			label: "octave changes in a variable",
+			given: "up = > c\npiano: o8 up up",
+			expected: []string{
+				"piece.alda:1:8 note in octave 10, outside the range of octaves " +
+					"-1 to 9",
+			},
+		},
+		{
+			label:    "voices that end in different octaves",
+			given:    "piano: o9 V1: c > V2: c V0: c",
+			expected: []string{},
+		},
+		{
+			label: "voices that end in the same octave",
+			given: "piano: o9 V1: c > V2: > c V0: c",
+			expected: []string{
+				"piece.alda:1:25 note in octave 10, outside the range of octaves " +
+					"-1 to 9",
+				"piece.alda:1:31 note in octave 10, outside the range of octaves " +
+					"-1 to 9",
+			},
+		},
+	} {
+		ast, err := Parse("piece.alda", testCase.given)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+
+		actual := []string{}
+		for _, err := range CheckOctaveRange(ast) {
+			actual = append(actual, err.Error())
+		}
+
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf(
+				"%s\nexpected: %q\nactual: %q",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+type parseEventsTestCase struct {
+	label          string
+	given          string
+	expectedEvents []ASTNodeType
+	expectedFormat string
+}
+
+func executeParseEventsTestCases(
+	t *testing.T, testCases ...parseEventsTestCase,
+) {
+	for _, testCase := range testCases {
+		events, err := ParseEvents(testCase.given)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		actualEvents := []ASTNodeType{}
+		for _, event := range events {
+			actualEvents = append(actualEvents, event.Type)
+		}
+
+		if !sameTypes(testCase.expectedEvents, actualEvents) {
+			t.Error(testCase.label)
+			t.Errorf(
+				"expected events: %v\nactual events: %v",
+				testCase.expectedEvents, actualEvents,
+			)
+		}
+
+		// The events should be the same as those of the implicit part that we get
+		// by parsing the same code as a score.
+		root, err := Parse("", testCase.given)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		expected := ASTNode{Type: EventSequenceNode, Children: []ASTNode{}}
+		if len(root.Children) > 0 {
+			expected = root.Children[0].Children[0]
+		}
+
+		actual := ASTNode{
+			Type:          EventSequenceNode,
+			SourceContext: expected.SourceContext,
+			Children:      events,
+		}
+		if !ASTEqual(expected, actual) {
+			t.Error(testCase.label)
+			for _, diff := range Diff(expected, actual) {
+				t.Errorf("%v", diff)
+			}
+		}
+
+		buffer := bytes.Buffer{}
+		if err := FormatEvents(events, &buffer); err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		if actual := buffer.String(); actual != testCase.expectedFormat {
+			t.Error(testCase.label)
+			t.Errorf(
+				"expected:\n%s\nactual:\n%s", testCase.expectedFormat, actual,
+			)
+		}
+	}
+}
+
+func TestParseEvents(t *testing.T) {
+	executeParseEventsTestCases(
+		t,
+		parseEventsTestCase{
+			label: "notes and a barline",
+			given: "c8 d e f | g2",
+			expectedEvents: []ASTNodeType{
+				NoteNode, NoteNode, NoteNode, NoteNode, BarlineNode, NoteNode,
+			},
+			expectedFormat: "c8 d e f | g2\n",
+		},
+		parseEventsTestCase{
+			label:          "chords",
+			given:          "c1/e/g   c/f/>a",
+			expectedEvents: []ASTNodeType{ChordNode, ChordNode},
+			expectedFormat: "c1 / e / g c / f / > a\n",
+		},
+		parseEventsTestCase{
+			label: "voices",
+			given: "V1: c d V2: e/g f V0: c",
+			expectedEvents: []ASTNodeType{
+				VoiceGroupNode, NoteNode,
+			},
+			expectedFormat: "V1:\n  c d\nV2:\n  e / g f\nV0: c\n",
+		},
+		parseEventsTestCase{
+			label: "attribute forms",
+			given: `(tempo! 120) (key-sig "f+") (vol 50) c`,
+			expectedEvents: []ASTNodeType{
+				LispListNode, LispListNode, LispListNode, NoteNode,
+			},
+			expectedFormat: "(tempo! 120) (key-sig \"f+\") (vol 50) c\n",
+		},
+		parseEventsTestCase{
+			label:          "variable references",
+			given:          "riff*2 c",
+			expectedEvents: []ASTNodeType{RepeatNode, NoteNode},
+			expectedFormat: "riff *2 c\n",
+		},
+		parseEventsTestCase{
+			label:          "empty fragment",
+			given:          "  ",
+			expectedEvents: []ASTNodeType{},
+			expectedFormat: "",
+		},
+	)
+}
+
+func TestParseEventsErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected []string
+	}{
+		{
+			label: "part declaration",
+			given: "c d\npiano: e",
+			expected: []string{
+				"<no file>:2:1 Unexpected part declaration `piano` in events",
+			},
+		},
+		{
+			label: "part declaration with an alias",
+			given: `violin/viola "strings": c`,
+			expected: []string{
+				"<no file>:1:1 Unexpected part declaration `violin` in events",
+			},
+		},
+		{
+			label: "variable definition",
+			given: "riff = c d\nriff",
+			expected: []string{
+				"<no file>:1:1 Unexpected variable definition `riff` in events",
+			},
+		},
+		{
+			label: "every problem is reported",
+			given: "c d violin: e\nriff = c\nf : g",
+			expected: []string{
+				"<no file>:1:5 Unexpected part declaration `violin` in events",
+				"<no file>:2:1 Unexpected variable definition `riff` in events",
+				"<no file>:3:3 Unexpected colon `:` in inner events",
+			},
+		},
+	} {
+		events, err := ParseEvents(testCase.given)
+		if events != nil {
+			t.Error(testCase.label)
+			t.Errorf("expected no events, got %d", len(events))
+		}
+
+		var parseErrors *ParseErrors
+		if !errors.As(err, &parseErrors) {
+			t.Error(testCase.label)
+			t.Errorf("expected *ParseErrors, got %#v", err)
+			continue
+		}
+
+		actual := []string{}
+		for _, err := range parseErrors.Errors {
+			actual = append(actual, err.Error())
+		}
+
+		if len(actual) != len(testCase.expected) {
+			t.Error(testCase.label)
+			t.Errorf("expected:\n%q\nactual:\n%q", testCase.expected, actual)
+			continue
+		}
+
+		for i := range actual {
+			if actual[i] != testCase.expected[i] {
+				t.Error(testCase.label)
+				t.Errorf("expected: %s\nactual: %s", testCase.expected[i], actual[i])
+			}
+		}
+	}
+}
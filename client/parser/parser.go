@@ -3,7 +3,10 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"alda.io/client/color"
@@ -12,24 +15,242 @@ import (
 	"alda.io/client/model"
 )
 
+// maxErrors is the number of errors that are reported, to avoid reporting a
+// cascade of errors that all stem from the same problem. Scanning and parsing
+// give up at the error after that, so that we know whether any were left out.
+const maxErrors = 20
+
+// DefaultMaxNestingDepth is the number of levels that event sequences, cram
+// expressions and Lisp forms can be nested within one another, unless
+// configured otherwise via MaxNestingDepth or ConfigureMaxNestingDepth. The
+// limit protects against running out of stack space on machine-generated
+// input.
+const DefaultMaxNestingDepth = 10000
+
+// ParseErrors is the error returned when there are one or more syntax errors in
+// the input. The parser recovers from each error by skipping ahead to the next
+// barline, part declaration or line, so that all of the errors in the input can
+// be reported at once.
+type ParseErrors struct {
+	// Errors is the list of errors, in the order that they appear in the input.
+	Errors []*model.AldaSourceError
+	// Truncated is true if we gave up after encountering too many errors, i.e.
+	// there are errors that aren't reported.
+	Truncated bool
+}
+
+// newParseErrors returns the errors in the order that they appear in the input,
+// leaving out any beyond the first maxErrors of them.
+func newParseErrors(errs []*model.AldaSourceError) *ParseErrors {
+	sorted := append([]*model.AldaSourceError{}, errs...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Context, sorted[j].Context
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	if len(sorted) > maxErrors {
+		return &ParseErrors{Errors: sorted[:maxErrors], Truncated: true}
+	}
+
+	return &ParseErrors{Errors: sorted}
+}
+
+// Error returns a string representation of the errors, one per line.
+func (pe *ParseErrors) Error() string {
+	lines := []string{}
+
+	for _, err := range pe.Errors {
+		lines = append(lines, err.Error())
+	}
+
+	if pe.Truncated {
+		lines = append(lines, "too many errors")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the first error, for the benefit of callers that are only
+// interested in a single error.
+func (pe *ParseErrors) Unwrap() error {
+	return pe.Errors[0]
+}
+
+// asSourceError returns err as an *model.AldaSourceError, wrapping it with the
+// provided context if it isn't one already.
+func asSourceError(
+	err error, context model.AldaSourceContext,
+) *model.AldaSourceError {
+	var sourceError *model.AldaSourceError
+	if errors.As(err, &sourceError) {
+		return sourceError
+	}
+
+	return &model.AldaSourceError{Context: context, Err: err}
+}
+
 type parser struct {
 	filename string
 	input    []Token
 	current  int
+	errors   []*model.AldaSourceError
 	// When true, source context is _not_ included in parsed tokens. This is
 	// useful for testing, e.g. for checking the equality of a list of expected
 	// tokens, agnostic of source context like line and column numbers.
 	suppressSourceContext bool
+	// When non-nil, the comments in the input are collected here (see
+	// CollectComments).
+	comments *[]SourceComment
+	// When non-nil, warnings about the input are collected here (see
+	// CollectWarnings).
+	warnings *[]*model.AldaSourceError
+	// The names of the variables defined so far
+	variables map[string]bool
+	// The number of levels that constructs can be nested, and the current level
+	maxNestingDepth int
+	depth           int
+	// How to treat recoverable problems with the input (see Strictness)
+	strictness Strictness
+	// The source code, if known, from which the raw text of ErrorNodes is taken
+	// (see skipError). It's only converted to a string if there's an error.
+	source       []rune
+	sourceString *string
+	// For input read from a reader, which isn't kept, the text between tokens
+	// that the raw text of ErrorNodes is put back together with (see
+	// scanner.gaps)
+	gaps map[int]string
+	// Where the children of the nodes being parsed are stored (see nodeArena)
+	arena nodeArena
+	// The nodes collected by the lists being parsed (see nodeList)
+	stack []ASTNode
 }
 
+// Strictness determines how the parser treats problems with the input that it
+// could recover from, e.g. a chord that ends with a separator (`c/e/`), or an
+// event sequence that isn't closed by the end of the input.
+type Strictness int
+
+const (
+	// Strict parsing reports recoverable problems as errors, like any other
+	// syntax error. This is the default.
+	Strict Strictness = iota
+	// Lenient parsing reports recoverable problems as warnings (see
+	// CollectWarnings) and carries on as if the input were complete, which
+	// suits input that is still being typed, e.g. at the REPL. The recoverable
+	// problems are:
+	//
+	//   * a separator at the end of a chord, e.g. `c/e/`, which is ignored
+	//   * repeated separators in a chord, e.g. `c//e`, which count as one
+	//   * a glissando that doesn't end on a note, e.g. `c~~`, which is ignored
+	//   * an event sequence, cram expression or S-expression that is still open
+	//     at the end of the input, which is closed there
+	Lenient
+)
+
 // A parseOption is a function that customizes a parser instance.
 type parseOption func(*parser)
 
-// SuppressSourceContext customizes a parser to ignore source context
+// SuppressSourceContext customizes a parser to ignore source context, including
+// the original spelling of literals (see ASTNode.SourceText)
 func SuppressSourceContext(parser *parser) {
 	parser.suppressSourceContext = true
 }
 
+// CollectWarnings customizes a parser to collect warnings about the input, i.e.
+// things that are valid but probably not what was intended, by appending them
+// to the given slice. Otherwise, warnings are discarded.
+func CollectWarnings(warnings *[]*model.AldaSourceError) parseOption {
+	return func(p *parser) {
+		p.warnings = warnings
+	}
+}
+
+// MaxNestingDepth customizes a parser to allow event sequences, cram
+// expressions and Lisp forms to be nested up to the given number of levels,
+// instead of DefaultMaxNestingDepth.
+func MaxNestingDepth(depth int) parseOption {
+	return func(p *parser) {
+		p.maxNestingDepth = depth
+	}
+}
+
+// nest records that the parser is entering the construct opened by the given
+// token, returning an error if that exceeds the maximum nesting depth. Each
+// successful call must be followed by a call to unnest when the construct has
+// been parsed.
+func (p *parser) nest(openToken Token) error {
+	if p.depth >= p.maxNestingDepth {
+		return p.errorAtToken(openToken, fmt.Sprintf(
+			"exceeded the maximum nesting depth of %d", p.maxNestingDepth,
+		))
+	}
+
+	p.depth++
+	return nil
+}
+
+func (p *parser) unnest() {
+	p.depth--
+}
+
+// WithStrictness customizes how a parser treats recoverable problems with the
+// input (see Strictness).
+func WithStrictness(strictness Strictness) parseOption {
+	return func(p *parser) {
+		p.strictness = strictness
+	}
+}
+
+// recover reports whether the parser can recover from a problem with the
+// input, i.e. parsing is lenient, in which case the problem is recorded as a
+// warning. Otherwise, the caller reports the problem as an error.
+func (p *parser) recover(token Token, format string, args ...interface{}) bool {
+	if p.strictness != Lenient {
+		return false
+	}
+
+	p.warn(token, format, args...)
+	return true
+}
+
+// A savepoint is a position in the input that the parser can backtrack to,
+// having looked ahead.
+type savepoint struct {
+	current  int
+	warnings int
+}
+
+func (p *parser) save() savepoint {
+	point := savepoint{current: p.current}
+	if p.warnings != nil {
+		point.warnings = len(*p.warnings)
+	}
+
+	return point
+}
+
+// backtrack returns the parser to a savepoint, discarding any warnings about
+// the input after it, which will be parsed again.
+func (p *parser) backtrack(point savepoint) {
+	p.current = point.current
+	if p.warnings != nil {
+		*p.warnings = (*p.warnings)[:point.warnings]
+	}
+}
+
+func (p *parser) warn(token Token, format string, args ...interface{}) {
+	if p.warnings != nil {
+		*p.warnings = append(*p.warnings, &model.AldaSourceError{
+			Context: token.sourceContext,
+			Err:     fmt.Errorf(format, args...),
+		})
+	}
+}
+
 func (p *parser) sourceContext(token Token) model.AldaSourceContext {
 	if p.suppressSourceContext {
 		return model.AldaSourceContext{}
@@ -38,17 +259,59 @@ func (p *parser) sourceContext(token Token) model.AldaSourceContext {
 	return token.sourceContext
 }
 
+// sourceText returns the original spelling of a literal, i.e. the part of a
+// token's text that the literal was interpreted from.
+func (p *parser) sourceText(text string) string {
+	if p.suppressSourceContext {
+		return ""
+	}
+
+	return text
+}
+
 func newParser(filename string, tokens []Token, opts ...parseOption) *parser {
 	parser := &parser{
-		filename: filename,
-		input:    tokens,
-		current:  0,
+		filename:        filename,
+		current:         0,
+		variables:       map[string]bool{},
+		maxNestingDepth: DefaultMaxNestingDepth,
 	}
 
 	for _, opt := range opts {
 		opt(parser)
 	}
 
+	if parser.comments != nil {
+		*parser.comments = append(*parser.comments, collectComments(tokens)...)
+	}
+
+	// The parser has no use for trivia, so we filter it out up front. Usually
+	// there is none, in which case we can avoid copying the tokens. (The full
+	// slice expression ensures that appending an EOF token below doesn't write
+	// to the caller's array.)
+	input := tokens[:len(tokens):len(tokens)]
+	for i, token := range tokens {
+		if token.tokenType.IsTrivia() {
+			input = make([]Token, i, len(tokens))
+			copy(input, tokens[:i])
+
+			for _, token := range tokens[i:] {
+				if !token.tokenType.IsTrivia() {
+					input = append(input, token)
+				}
+			}
+
+			break
+		}
+	}
+
+	// The parser relies on the input ending with an EOF token.
+	if len(input) == 0 || input[len(input)-1].tokenType != EOF {
+		input = append(input, Token{tokenType: EOF})
+	}
+
+	parser.input = input
+
 	return parser
 }
 
@@ -122,6 +385,106 @@ func (p *parser) unexpectedTokenError(
 	return p.errorAtToken(token, msg)
 }
 
+// recordError takes note of an error so that parsing can continue.
+func (p *parser) recordError(err error) {
+	p.errors = append(p.errors, asSourceError(err, p.peek().sourceContext))
+}
+
+func (p *parser) tooManyErrors() bool {
+	return len(p.errors) > maxErrors
+}
+
+// skipError records an error, skips ahead to where parsing can resume (see
+// synchronize), and returns an ErrorNode to stand in for the input that was
+// skipped.
+func (p *parser) skipError(err error, start int) ASTNode {
+	p.recordError(err)
+	p.synchronize(start)
+
+	sourceError := p.errors[len(p.errors)-1]
+
+	return ASTNode{
+		Type:          ErrorNode,
+		SourceContext: p.sourceContext(Token{sourceContext: sourceError.Context}),
+		Literal:       sourceError.Err.Error(),
+		SourceText:    p.skippedText(start),
+	}
+}
+
+// skippedText returns the raw text of the tokens from start up to the current
+// position, including any whitespace and comments between them. Without the
+// source code, or the text between the tokens, the tokens are joined with
+// spaces.
+func (p *parser) skippedText(start int) string {
+	tokens := p.input[start:p.current]
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	if p.gaps != nil {
+		text := strings.Builder{}
+		for i, token := range tokens {
+			if i > 0 {
+				gap, ok := p.gaps[token.sourceContext.Offset]
+				if !ok {
+					gap = plainGap(tokens[i-1].endContext, token.sourceContext)
+				}
+				text.WriteString(gap)
+			}
+			text.WriteString(token.text)
+		}
+
+		return text.String()
+	}
+
+	if p.source == nil && p.sourceString == nil {
+		texts := []string{}
+		for _, token := range tokens {
+			texts = append(texts, token.text)
+		}
+
+		return strings.Join(texts, " ")
+	}
+
+	if p.sourceString == nil {
+		source := string(p.source)
+		p.sourceString = &source
+	}
+
+	first := tokens[0].sourceContext.Offset
+	last := tokens[len(tokens)-1].endContext.Offset
+
+	return (*p.sourceString)[first:last]
+}
+
+// synchronize skips ahead after an error, to a point where we can reasonably
+// resume parsing: just past the next barline, or the next part declaration, or
+// the next line, whichever comes first.
+//
+// `start` is the position where the parser was when it began parsing the
+// construct that failed. We always skip at least one token, to guarantee that
+// we make progress.
+func (p *parser) synchronize(start int) {
+	errorLine := p.errors[len(p.errors)-1].Context.Line
+
+	if p.current <= start {
+		p.current = start
+		p.advance()
+	}
+
+	for !p.check(EOF) && !p.looksLikePartDeclaration() {
+		if p.peek().sourceContext.Line > errorLine {
+			return
+		}
+
+		if _, matched := p.match(Barline); matched {
+			return
+		}
+
+		p.advance()
+	}
+}
+
 func (p *parser) consume(tokenType TokenType, context string) (Token, error) {
 	if p.check(tokenType) {
 		return p.advance(), nil
@@ -132,6 +495,15 @@ func (p *parser) consume(tokenType TokenType, context string) (Token, error) {
 
 func (p *parser) lispForm(context string) (ASTNode, error) {
 	if token, matched := p.match(Symbol); matched {
+		// A keyword is a symbol that starts with a colon, e.g. `:major`.
+		if len(token.text) > 1 && strings.HasPrefix(token.text, ":") {
+			return ASTNode{
+				Type:          LispKeywordNode,
+				SourceContext: p.sourceContext(token),
+				Literal:       token.text[1:],
+			}, nil
+		}
+
 		return ASTNode{
 			Type:          LispSymbolNode,
 			SourceContext: p.sourceContext(token),
@@ -144,6 +516,7 @@ func (p *parser) lispForm(context string) (ASTNode, error) {
 			Type:          LispNumberNode,
 			SourceContext: p.sourceContext(token),
 			Literal:       token.literal,
+			SourceText:    p.sourceText(token.text),
 		}, nil
 	}
 
@@ -152,6 +525,21 @@ func (p *parser) lispForm(context string) (ASTNode, error) {
 			Type:          LispStringNode,
 			SourceContext: p.sourceContext(token),
 			Literal:       token.literal,
+			SourceText:    p.sourceText(token.text),
+		}, nil
+	}
+
+	if quoteToken, matched := p.match(SingleQuote); matched {
+		// NB: The quoted form may itself be quoted, e.g. `''a`.
+		form, err := p.lispForm(context)
+		if err != nil {
+			return ASTNode{}, err
+		}
+
+		return ASTNode{
+			Type:          LispQuotedFormNode,
+			SourceContext: p.sourceContext(quoteToken),
+			Children:      []ASTNode{form},
 		}, nil
 	}
 
@@ -159,44 +547,82 @@ func (p *parser) lispForm(context string) (ASTNode, error) {
 		return p.lispList()
 	}
 
+	if _, matched := p.match(EventSeqOpen); matched {
+		return p.lispCollection(LispVectorNode, EventSeqClose, "in vector")
+	}
+
+	if token, matched := p.match(CramOpen); matched {
+		mapNode, err := p.lispCollection(LispMapNode, CramClose, "in map")
+		if err != nil {
+			return ASTNode{}, err
+		}
+
+		if len(mapNode.Children)%2 != 0 {
+			return ASTNode{}, p.errorAtToken(
+				token, "map literal must contain an even number of forms",
+			)
+		}
+
+		return mapNode, nil
+	}
+
 	return ASTNode{}, p.unexpectedTokenError(p.peek(), context)
 }
 
 func (p *parser) lispList() (ASTNode, error) {
 	// NB: This assumes the initial LeftParen token was already consumed.
-	list := ASTNode{
+	return p.lispCollection(LispListNode, RightParen, "in S-expression")
+}
+
+// lispCollection parses the forms of a Lisp list, vector or map, up to and
+// including the closing token. It assumes that the opening token was already
+// consumed.
+func (p *parser) lispCollection(
+	nodeType ASTNodeType, closeType TokenType, context string,
+) (ASTNode, error) {
+	if err := p.nest(p.previous()); err != nil {
+		return ASTNode{}, err
+	}
+	defer p.unnest()
+
+	collection := ASTNode{
 		SourceContext: p.sourceContext(p.previous()),
-		Type:          LispListNode,
+		Type:          nodeType,
+	}
+
+	forms := p.newNodeList()
+
+	// An empty collection has no children, rather than empty children.
+	collect := func() ASTNode {
+		if forms.len > 0 {
+			collection.Children = forms.children()
+		}
+		return collection
 	}
 
-	for token := p.peek(); token.tokenType != RightParen; token = p.peek() {
+	for token := p.peek(); token.tokenType != closeType; token = p.peek() {
+		if token.tokenType == EOF &&
+			p.recover(token, "unterminated S-expression") {
+			return collect(), nil
+		}
+
 		if _, matched := p.match(EOF); matched {
 			return ASTNode{}, p.errorAtToken(token, "unterminated S-expression")
 		}
 
-		quoteToken, quoted := p.match(SingleQuote)
-
-		form, err := p.lispForm("in S-expression")
+		form, err := p.lispForm(context)
 		if err != nil {
 			return ASTNode{}, err
 		}
 
-		if quoted {
-			form = ASTNode{
-				Type:          LispQuotedFormNode,
-				SourceContext: p.sourceContext(quoteToken),
-				Children:      []ASTNode{form},
-			}
-		}
-
-		list.Children = append(list.Children, form)
+		forms.add(form)
 	}
 
-	if _, err := p.consume(RightParen, "in S-expression"); err != nil {
+	if _, err := p.consume(closeType, context); err != nil {
 		return ASTNode{}, err
 	}
 
-	return list, nil
+	return collect(), nil
 }
 
 func (p *parser) sexp() (ASTNode, error) {
@@ -281,19 +707,24 @@ func (p *parser) partEvents() (ASTNode, error) {
 	partEvents := ASTNode{
 		Type:          EventSequenceNode,
 		SourceContext: p.sourceContext(p.peek()),
-		Children:      []ASTNode{},
 	}
 
+	events := p.newNodeList()
+
 	// Keep consuming events until we reach either a part declaration or EOF.
-	for !p.check(EOF) && !p.looksLikePartDeclaration() {
+	for !p.check(EOF) && !p.looksLikePartDeclaration() && !p.tooManyErrors() {
+		start := p.current
+
 		event, err := p.innerEvent()
 		if err != nil {
-			return ASTNode{}, err
+			event = p.skipError(err, start)
 		}
 
-		partEvents.Children = append(partEvents.Children, event)
+		events.add(event)
 	}
 
+	partEvents.Children = events.children()
+
 	return partEvents, nil
 }
 
@@ -314,7 +745,7 @@ func (p *parser) part() (ASTNode, error) {
 	return ASTNode{
 		Type:          PartNode,
 		SourceContext: p.sourceContext(nameToken),
-		Children:      []ASTNode{partDecl, partEvents},
+		Children:      p.arena.children(partDecl, partEvents),
 	}, nil
 }
 
@@ -333,7 +764,7 @@ func (p *parser) implicitPart() (ASTNode, error) {
 	return ASTNode{
 		Type:          ImplicitPartNode,
 		SourceContext: partEvents.SourceContext,
-		Children:      []ASTNode{partEvents},
+		Children:      p.arena.children(partEvents),
 	}, nil
 }
 
@@ -382,6 +813,8 @@ func (p *parser) variableDefinition() (ASTNode, error) {
 		eventsNode.Children = append(eventsNode.Children, node)
 	}
 
+	p.variables[nameToken.text] = true
+
 	definitionNode := ASTNode{
 		Type:          VariableDefinitionNode,
 		SourceContext: p.sourceContext(equalsToken),
@@ -391,18 +824,26 @@ func (p *parser) variableDefinition() (ASTNode, error) {
 	return definitionNode, nil
 }
 
+// repeatTimesText returns the number of times in the text of a Repeat token,
+// e.g. "02" for "* 02".
+func repeatTimesText(token Token) string {
+	return strings.TrimLeft(token.text, "* ")
+}
+
 func (p *parser) singleOrRepeated(node ASTNode) ASTNode {
 	if token, matched := p.match(Repeat); matched {
 		return ASTNode{
 			SourceContext: p.sourceContext(token),
 			Type:          RepeatNode,
-			Children: []ASTNode{
+			Children: p.arena.children(
 				node,
-				{
-					Type:    TimesNode,
-					Literal: token.literal,
+				ASTNode{
+					Type:          TimesNode,
+					SourceContext: p.sourceContext(token),
+					Literal:       token.literal,
+					SourceText:    p.sourceText(repeatTimesText(token)),
 				},
-			},
+			),
 		}
 	}
 
@@ -413,6 +854,26 @@ func (p *parser) variableReference() (ASTNode, error) {
 	// NB: This assumes the initial Name token was already consumed.
 	nameToken := p.previous()
 
+	// A dynamic marking (e.g. `mf`) is an event in itself, unless a variable of
+	// the same name has been defined, in which case it's a reference to the
+	// variable, as it was before dynamic markings were events.
+	if isDynamicMarking(nameToken.text) {
+		if !p.variables[nameToken.text] {
+			return ASTNode{
+				Type:          DynamicNode,
+				SourceContext: p.sourceContext(nameToken),
+				Literal:       nameToken.text,
+			}, nil
+		}
+
+		p.warn(
+			nameToken,
+			"%s refers to the variable %s, not the dynamic marking; "+
+				"use (%s) for the dynamic marking",
+			nameToken.text, nameToken.text, nameToken.text,
+		)
+	}
+
 	reference := ASTNode{
 		Type:          VariableReferenceNode,
 		SourceContext: p.sourceContext(nameToken),
@@ -439,6 +900,8 @@ func (p *parser) octaveSet() (ASTNode, error) {
 		Type:          OctaveSetNode,
 		SourceContext: p.sourceContext(token),
 		Literal:       token.literal,
+		// Trim the initial 'o'.
+		SourceText: p.sourceText(token.text[1:]),
 	}, nil
 }
 
@@ -454,22 +917,26 @@ func (p *parser) durationComponent() ASTNode {
 	case NoteLength:
 		noteLength := token.literal.(noteLength)
 
+		denominator := ASTNode{
+			Type:          DenominatorNode,
+			SourceContext: p.sourceContext(token),
+			Literal:       noteLength.denominator,
+			SourceText:    p.sourceText(strings.TrimRight(token.text, ".")),
+		}
+
 		nlNode := ASTNode{
 			Type:          NoteLengthNode,
 			SourceContext: p.sourceContext(token),
-			Children: []ASTNode{
-				{
-					Type:    DenominatorNode,
-					Literal: noteLength.denominator,
-				},
-			},
 		}
 
 		if noteLength.dots > 0 {
-			nlNode.Children = append(nlNode.Children, ASTNode{
-				Type:    DotsNode,
-				Literal: noteLength.dots,
+			nlNode.Children = p.arena.children(denominator, ASTNode{
+				Type:          DotsNode,
+				SourceContext: p.sourceContext(token),
+				Literal:       noteLength.dots,
 			})
+		} else {
+			nlNode.Children = p.arena.children(denominator)
 		}
 
 		return nlNode
@@ -478,12 +945,14 @@ func (p *parser) durationComponent() ASTNode {
 			Type:          NoteLengthMsNode,
 			SourceContext: p.sourceContext(token),
 			Literal:       token.literal,
+			SourceText:    p.sourceText(strings.TrimSuffix(token.text, "ms")),
 		}
 	case NoteLengthSeconds:
 		return ASTNode{
 			Type:          NoteLengthSecondsNode,
 			SourceContext: p.sourceContext(token),
 			Literal:       token.literal,
+			SourceText:    p.sourceText(strings.TrimSuffix(token.text, "s")),
 		}
 	}
 
@@ -492,11 +961,17 @@ func (p *parser) durationComponent() ASTNode {
 }
 
 func (p *parser) duration() ASTNode {
-	durationNode := func(componentNodes []ASTNode) ASTNode {
+	// NB: This assumes the initial duration component token was already consumed.
+	components := p.newNodeList()
+	components.add(p.durationComponent())
+
+	durationNode := func() ASTNode {
+		sourceContext := components.nodes()[0].SourceContext
+
 		return ASTNode{
 			Type:          DurationNode,
-			SourceContext: componentNodes[0].SourceContext,
-			Children:      componentNodes,
+			SourceContext: sourceContext,
+			Children:      components.children(),
 		}
 	}
 
@@ -507,15 +982,12 @@ func (p *parser) duration() ASTNode {
 		}
 	}
 
-	// NB: This assumes the initial duration component token was already consumed.
-	componentNodes := []ASTNode{p.durationComponent()}
-
 	// Repeatedly parse duration components.
 	for {
 		// Repeatedly parse barlines amongst the duration components.
 		for {
 			if token, matched := p.match(Barline); matched {
-				componentNodes = append(componentNodes, barlineNode(token))
+				components.add(barlineNode(token))
 			} else {
 				break
 			}
@@ -527,8 +999,10 @@ func (p *parser) duration() ASTNode {
 		// consume the slur as part of e.g. a note.
 		beforeTies := p.current
 
-		if _, matched := p.match(Tie); !matched {
-			return durationNode(componentNodes)
+		// A glissando token (`~~`) followed by a note length is just two ties, as
+		// it always has been, e.g. `c4~~4`.
+		if _, matched := p.match(Tie, Glissando); !matched {
+			return durationNode()
 		}
 
 		// We'll stash any barlines that we encounter here temporarily. We'll add
@@ -548,18 +1022,18 @@ func (p *parser) duration() ASTNode {
 		// tying a duration across a barline and it feels right to have a tie on
 		// either side of the barline. So we'll consume any additional ties here.
 		for {
-			if _, matched := p.match(Tie); !matched {
+			if _, matched := p.match(Tie, Glissando); !matched {
 				break
 			}
 		}
 
 		if _, matched := p.matchDurationComponent(); !matched {
 			p.current = beforeTies
-			return durationNode(componentNodes)
+			return durationNode()
 		}
 
-		componentNodes = append(componentNodes, barlines...)
-		componentNodes = append(componentNodes, p.durationComponent())
+		components.add(barlines...)
+		components.add(p.durationComponent())
 	}
 }
 
@@ -567,34 +1041,28 @@ func (p *parser) note() (ASTNode, error) {
 	// NB: This assumes the initial NoteLetter token was already consumed.
 	noteLetterToken := p.previous()
 
-	laaNode := ASTNode{
-		Type:          NoteLetterAndAccidentalsNode,
+	letterNode := ASTNode{
+		Type:          NoteLetterNode,
 		SourceContext: p.sourceContext(noteLetterToken),
-		Children: []ASTNode{
-			{
-				Type:          NoteLetterNode,
-				SourceContext: p.sourceContext(noteLetterToken),
-				Literal:       noteLetterToken.literal,
-			},
-		},
+		Literal:       noteLetterToken.literal,
 	}
 
-	accidentalNodes := []ASTNode{}
+	accidentals := p.newNodeList()
 
 AccidentalsLoop:
 	for {
 		if token, matched := p.match(Flat); matched {
-			accidentalNodes = append(accidentalNodes, ASTNode{
+			accidentals.add(ASTNode{
 				Type:          FlatNode,
 				SourceContext: p.sourceContext(token),
 			})
 		} else if token, matched := p.match(Natural); matched {
-			accidentalNodes = append(accidentalNodes, ASTNode{
+			accidentals.add(ASTNode{
 				Type:          NaturalNode,
 				SourceContext: p.sourceContext(token),
 			})
 		} else if token, matched := p.match(Sharp); matched {
-			accidentalNodes = append(accidentalNodes, ASTNode{
+			accidentals.add(ASTNode{
 				Type:          SharpNode,
 				SourceContext: p.sourceContext(token),
 			})
@@ -603,31 +1071,44 @@ AccidentalsLoop:
 		}
 	}
 
-	if len(accidentalNodes) > 0 {
-		laaNode.Children = append(laaNode.Children, ASTNode{
+	laaNode := ASTNode{
+		Type:          NoteLetterAndAccidentalsNode,
+		SourceContext: p.sourceContext(noteLetterToken),
+	}
+
+	if accidentals.len > 0 {
+		sourceContext := accidentals.nodes()[0].SourceContext
+
+		laaNode.Children = p.arena.children(letterNode, ASTNode{
 			Type:          NoteAccidentalsNode,
-			SourceContext: accidentalNodes[0].SourceContext,
-			Children:      accidentalNodes,
+			SourceContext: sourceContext,
+			Children:      accidentals.children(),
 		})
+	} else {
+		laaNode.Children = p.arena.children(letterNode)
 	}
 
 	noteNode := ASTNode{
 		Type:          NoteNode,
 		SourceContext: p.sourceContext(noteLetterToken),
-		Children:      []ASTNode{laaNode},
 	}
 
+	children := p.newNodeList()
+	children.add(laaNode)
+
 	if _, matched := p.matchDurationComponent(); matched {
-		noteNode.Children = append(noteNode.Children, p.duration())
+		children.add(p.duration())
 	}
 
 	if tie, matched := p.match(Tie); matched {
-		noteNode.Children = append(noteNode.Children, ASTNode{
+		children.add(ASTNode{
 			Type:          TieNode,
 			SourceContext: p.sourceContext(tie),
 		})
 	}
 
+	noteNode.Children = children.children()
+
 	return noteNode, nil
 }
 
@@ -641,7 +1122,7 @@ func (p *parser) rest() ASTNode {
 	}
 
 	if _, matched := p.matchDurationComponent(); matched {
-		rest.Children = []ASTNode{p.duration()}
+		rest.Children = p.arena.children(p.duration())
 	}
 
 	return rest
@@ -698,11 +1179,12 @@ func (p *parser) noteRestOrChord() (ASTNode, error) {
 
 	// The cumulative list of nodes. Depending on whether this is a chord, the
 	// nodes will either be emitted as part of the chord, or emitted individually.
-	allNodes := []ASTNode{}
+	allNodes := p.newNodeList()
 
 	type maybeRepeat struct {
 		sourceContext model.AldaSourceContext
 		times         int32
+		sourceText    string
 	}
 
 	// We're essentially using this as a nil value. Below, we check whether
@@ -715,18 +1197,17 @@ func (p *parser) noteRestOrChord() (ASTNode, error) {
 			return ASTNode{}, err
 		}
 
+		allNodes.add(noteOrRest)
+
 		if token, matched := p.match(Repeat); matched {
-			allNodes = append(allNodes, noteOrRest)
 			repeat = maybeRepeat{
 				sourceContext: p.sourceContext(token),
 				times:         token.literal.(int32),
+				sourceText:    p.sourceText(repeatTimesText(token)),
 			}
 			break
 		}
 
-		// The nodes for just this iteration of the loop
-		nodes := []ASTNode{noteOrRest}
-
 		// HACK to work around the complexity that comes with allowing chords to
 		// include attribute changes in between the notes. This is all easier if we
 		// can make this function return a single node and not a list of nodes (see
@@ -745,31 +1226,48 @@ func (p *parser) noteRestOrChord() (ASTNode, error) {
 		//
 		// Here, we capture the current parser position after we parse each note or
 		// rest in the chord, so that we can backtrack to that position if needed.
-		backtrackPosition := p.current
+		backtrackPosition := p.save()
 
 		nodesBeforeSeparator, err := p.nodesBetweenNotesInChord()
-		if err != nil {
-			return ASTNode{}, err
-		}
 
-		if _, matched := p.match(Separator); !matched {
-			// See HACK comment above.
-			p.current = backtrackPosition
-
-			allNodes = append(allNodes, nodes...)
+		if _, matched := p.match(Separator); err != nil || !matched {
+			// See HACK comment above. If the nodes after the note have an error, we
+			// leave it to be reported when they're parsed as separate events, so
+			// that the note isn't lost along with them (see skipError).
+			p.backtrack(backtrackPosition)
 
 			break
 		}
 
-		nodes = append(nodes, nodesBeforeSeparator...)
+		allNodes.add(nodesBeforeSeparator...)
+		separator := p.previous()
+		afterSeparator := p.save()
 
 		nodesAfterSeparator, err := p.nodesBetweenNotesInChord()
 		if err != nil {
 			return ASTNode{}, err
 		}
-		nodes = append(nodes, nodesAfterSeparator...)
 
-		allNodes = append(allNodes, nodes...)
+		for p.check(Separator) &&
+			p.recover(p.peek(), "repeated separator `/` in chord") {
+			allNodes.add(nodesAfterSeparator...)
+			separator = p.advance()
+			afterSeparator = p.save()
+
+			nodesAfterSeparator, err = p.nodesBetweenNotesInChord()
+			if err != nil {
+				return ASTNode{}, err
+			}
+		}
+
+		if !p.check(NoteLetter, RestLetter) && p.strictness == Lenient {
+			// The nodes after the separator are parsed again as separate events.
+			p.backtrack(afterSeparator)
+			p.recover(separator, "trailing separator `/` in chord")
+			break
+		}
+
+		allNodes.add(nodesAfterSeparator...)
 
 		if _, matched := p.match(NoteLetter, RestLetter); !matched {
 			return ASTNode{}, p.unexpectedTokenError(p.peek(), "in chord")
@@ -777,51 +1275,236 @@ func (p *parser) noteRestOrChord() (ASTNode, error) {
 	}
 
 	notesCount := 0
-	for _, node := range allNodes {
+	for _, node := range allNodes.nodes() {
 		switch node.Type {
 		case NoteNode, RestNode:
 			notesCount++
 		}
 	}
 
+	// The note or rest, or the chord of all of the nodes. (Any other nodes
+	// without a chord are parsed again as separate events.)
+	node := allNodes.nodes()[0]
 	if notesCount > 1 {
-		allNodes = []ASTNode{
-			{
-				Type:          ChordNode,
-				SourceContext: allNodes[0].SourceContext,
-				Children:      allNodes,
-			},
+		node = ASTNode{
+			Type:          ChordNode,
+			SourceContext: node.SourceContext,
+			Children:      allNodes.children(),
 		}
+	} else {
+		allNodes.pop()
 	}
 
-	if repeat.times > 0 {
-		if len(allNodes) != 1 {
-			panic(fmt.Sprintf("Expected a single node in %#v", allNodes))
+	if token, matched := p.match(Glissando); matched && repeat.times == 0 {
+		glissando, err := p.glissando(token, node)
+		if err != nil {
+			return ASTNode{}, err
+		}
+		node = glissando
+
+		if token, matched := p.match(Repeat); matched {
+			repeat = maybeRepeat{
+				sourceContext: p.sourceContext(token),
+				times:         token.literal.(int32),
+				sourceText:    p.sourceText(repeatTimesText(token)),
+			}
 		}
+	}
 
+	if repeat.times > 0 {
 		return ASTNode{
 			SourceContext: repeat.sourceContext,
 			Type:          RepeatNode,
-			Children: []ASTNode{
-				allNodes[0],
-				{
-					Type:    TimesNode,
-					Literal: repeat.times,
+			Children: p.arena.children(
+				node,
+				ASTNode{
+					Type:          TimesNode,
+					SourceContext: repeat.sourceContext,
+					Literal:       repeat.times,
+					SourceText:    repeat.sourceText,
 				},
-			},
+			),
 		}, nil
 	}
 
-	return allNodes[0], nil
+	return node, nil
+}
+
+// Parses the rest of a glissando, e.g. `c2 ~~ | g2 ~~ c`, given the note that
+// starts it.
+//
+// NB: This assumes the initial Glissando token was already consumed.
+func (p *parser) glissando(token Token, first ASTNode) (ASTNode, error) {
+	switch first.Type {
+	case ChordNode:
+		return ASTNode{}, p.errorAtToken(
+			token, "a glissando can't start on a chord",
+		)
+	case RestNode:
+		return ASTNode{}, p.errorAtToken(
+			token, "a glissando can't start on a rest",
+		)
+	}
+
+	glissando := ASTNode{
+		Type:          GlissandoNode,
+		SourceContext: first.SourceContext,
+		Children:      []ASTNode{first},
+	}
+
+	for {
+		beforeBarlines := p.current
+		childrenBeforeBarlines := len(glissando.Children)
+
+		for {
+			if token, matched := p.match(Barline); matched {
+				glissando.Children = append(glissando.Children, ASTNode{
+					Type:          BarlineNode,
+					SourceContext: p.sourceContext(token),
+				})
+			} else {
+				break
+			}
+		}
+
+		if token, matched := p.match(RestLetter); matched {
+			return ASTNode{}, p.errorAtToken(
+				token, "a glissando can't end on a rest",
+			)
+		}
+
+		if !p.check(NoteLetter) &&
+			p.recover(token, "glissando `~~` doesn't end on a note") {
+			// The barlines are parsed again as separate events.
+			p.current = beforeBarlines
+			glissando.Children = glissando.Children[:childrenBeforeBarlines]
+
+			if len(glissando.Children) == 1 {
+				return first, nil
+			}
+
+			return glissando, nil
+		}
+
+		if _, matched := p.match(NoteLetter); !matched {
+			return ASTNode{}, p.unexpectedTokenError(p.peek(), "in glissando")
+		}
+
+		note, err := p.note()
+		if err != nil {
+			return ASTNode{}, err
+		}
+		glissando.Children = append(glissando.Children, note)
+
+		// Look ahead for a chord, e.g. `c ~~ e/g`, and then backtrack, whether or
+		// not we found one.
+		beforeChord := p.save()
+		if _, err := p.nodesBetweenNotesInChord(); err != nil {
+			return ASTNode{}, err
+		}
+		if separator, matched := p.match(Separator); matched {
+			return ASTNode{}, p.errorAtToken(
+				separator, "a glissando can't end on a chord",
+			)
+		}
+		p.backtrack(beforeChord)
+
+		next, matched := p.match(Glissando)
+		if !matched {
+			return glissando, nil
+		}
+		token = next
+	}
+}
+
+// Parses a time signature, e.g. `3/4`, which is shorthand for
+// `(time-signature '(3 4))`.
+func (p *parser) timeSignature(token Token) (ASTNode, error) {
+	timeSig := token.literal.(model.TimeSignature)
+	if err := timeSig.Validate(); err != nil {
+		return ASTNode{}, p.errorAtToken(token, err.Error())
+	}
+
+	return ASTNode{
+		Type:          TimeSignatureNode,
+		SourceContext: p.sourceContext(token),
+		Children: []ASTNode{
+			{
+				Type:          TimeSignatureNumeratorNode,
+				SourceContext: p.sourceContext(token),
+				Literal:       timeSig.Numerator,
+			},
+			{
+				Type:          TimeSignatureDenominatorNode,
+				SourceContext: p.sourceContext(token),
+				Literal:       timeSig.Denominator,
+			},
+		},
+	}, nil
+}
+
+// Parses a tuplet, e.g. `{c d e}3:2`, given the events between the braces and
+// the tuplet ratio token that follows them.
+func (p *parser) tuplet(
+	cramOpenToken Token, eventsNode ASTNode, ratioToken Token,
+) (ASTNode, error) {
+	ratio := ratioToken.literal.(model.TupletRatio)
+	if err := ratio.Validate(); err != nil {
+		return ASTNode{}, p.errorAtToken(ratioToken, err.Error())
+	}
+
+	return ASTNode{
+		Type:          TupletNode,
+		SourceContext: p.sourceContext(cramOpenToken),
+		Children: []ASTNode{
+			eventsNode,
+			{
+				Type:          TupletActualNotesNode,
+				SourceContext: p.sourceContext(ratioToken),
+				Literal:       ratio.ActualNotes,
+			},
+			{
+				Type:          TupletNormalNotesNode,
+				SourceContext: p.sourceContext(ratioToken),
+				Literal:       ratio.NormalNotes,
+			},
+		},
+	}, nil
+}
+
+// Parses a multi-measure rest, e.g. `R*8`.
+func (p *parser) multiMeasureRest(token Token) (ASTNode, error) {
+	measures := token.literal.(int32)
+	if measures < 1 {
+		return ASTNode{}, p.errorAtToken(
+			token, "a multi-measure rest must last at least one measure",
+		)
+	}
+
+	return ASTNode{
+		Type:          MultiMeasureRestNode,
+		SourceContext: p.sourceContext(token),
+		Literal:       measures,
+	}, nil
 }
 
 func (p *parser) eventSeq() (ASTNode, error) {
 	// NB: This assumes the initial EventSeqOpen token was already consumed.
 	eventSeqOpenToken := p.previous()
 
-	eventNodes := []ASTNode{}
+	if err := p.nest(eventSeqOpenToken); err != nil {
+		return ASTNode{}, err
+	}
+	defer p.unnest()
+
+	eventNodes := p.newNodeList()
 
 	for token := p.peek(); token.tokenType != EventSeqClose; token = p.peek() {
+		if token.tokenType == EOF &&
+			p.recover(token, "unterminated event sequence") {
+			break
+		}
+
 		if _, matched := p.match(EOF); matched {
 			return ASTNode{}, p.errorAtToken(token, "unterminated event sequence")
 		}
@@ -833,23 +1516,36 @@ func (p *parser) eventSeq() (ASTNode, error) {
 
 		if token, matched := p.match(Repetitions); matched {
 			repetitionRanges := token.literal.([]model.RepetitionRange)
+			// e.g. "'1-2,4" => ["1-2", "4"]
+			rangeTexts := strings.Split(token.text[1:], ",")
 
 			repetitionsNode := ASTNode{
 				Type:          RepetitionsNode,
 				SourceContext: p.sourceContext(token),
 			}
 
-			for _, repetitionRange := range repetitionRanges {
+			for i, repetitionRange := range repetitionRanges {
+				// e.g. "1-2" => ["1", "2"], "4" => ["4", "4"]
+				firstText, lastText, isRange := strings.Cut(rangeTexts[i], "-")
+				if !isRange {
+					lastText = firstText
+				}
+
 				repetitionsNode.Children = append(repetitionsNode.Children, ASTNode{
-					Type: RepetitionRangeNode,
+					Type:          RepetitionRangeNode,
+					SourceContext: p.sourceContext(token),
 					Children: []ASTNode{
 						{
-							Type:    FirstRepetitionNode,
-							Literal: repetitionRange.First,
+							Type:          FirstRepetitionNode,
+							SourceContext: p.sourceContext(token),
+							Literal:       repetitionRange.First,
+							SourceText:    p.sourceText(firstText),
 						},
 						{
-							Type:    LastRepetitionNode,
-							Literal: repetitionRange.Last,
+							Type:          LastRepetitionNode,
+							SourceContext: p.sourceContext(token),
+							Literal:       repetitionRange.Last,
+							SourceText:    p.sourceText(lastText),
 						},
 					},
 				})
@@ -858,21 +1554,23 @@ func (p *parser) eventSeq() (ASTNode, error) {
 			eventNode = ASTNode{
 				Type:          OnRepetitionsNode,
 				SourceContext: p.sourceContext(token),
-				Children:      []ASTNode{eventNode, repetitionsNode},
+				Children:      p.arena.children(eventNode, repetitionsNode),
 			}
 		}
 
-		eventNodes = append(eventNodes, eventNode)
+		eventNodes.add(eventNode)
 	}
 
-	if _, err := p.consume(EventSeqClose, "in event sequence"); err != nil {
-		return ASTNode{}, err
+	if !p.check(EOF) {
+		if _, err := p.consume(EventSeqClose, "in event sequence"); err != nil {
+			return ASTNode{}, err
+		}
 	}
 
 	eventSeq := ASTNode{
 		Type:          EventSequenceNode,
 		SourceContext: p.sourceContext(eventSeqOpenToken),
-		Children:      eventNodes,
+		Children:      eventNodes.children(),
 	}
 
 	return p.singleOrRepeated(eventSeq), nil
@@ -882,9 +1580,19 @@ func (p *parser) cram() (ASTNode, error) {
 	// NB: This assumes the initial CramOpen token was already consumed.
 	cramOpenToken := p.previous()
 
-	allEvents := []ASTNode{}
+	if err := p.nest(cramOpenToken); err != nil {
+		return ASTNode{}, err
+	}
+	defer p.unnest()
+
+	allEvents := p.newNodeList()
 
 	for token := p.peek(); token.tokenType != CramClose; token = p.peek() {
+		if token.tokenType == EOF &&
+			p.recover(token, "unterminated cram expression") {
+			break
+		}
+
 		if _, matched := p.match(EOF); matched {
 			return ASTNode{}, p.errorAtToken(token, "unterminated cram expression")
 		}
@@ -893,27 +1601,46 @@ func (p *parser) cram() (ASTNode, error) {
 		if err != nil {
 			return ASTNode{}, err
 		}
-		allEvents = append(allEvents, event)
+		allEvents.add(event)
 	}
 
-	if _, err := p.consume(CramClose, "in cram expression"); err != nil {
-		return ASTNode{}, err
+	if !p.check(EOF) {
+		if _, err := p.consume(CramClose, "in cram expression"); err != nil {
+			return ASTNode{}, err
+		}
 	}
 
 	eventsNode := ASTNode{
 		Type:          EventSequenceNode,
-		SourceContext: allEvents[0].SourceContext,
-		Children:      allEvents,
+		SourceContext: p.sourceContext(cramOpenToken),
+	}
+
+	// NB: A cram can be empty, e.g. `{}`, in which case the event sequence has
+	// the position of the cram itself.
+	if allEvents.len > 0 {
+		eventsNode.SourceContext = allEvents.nodes()[0].SourceContext
+	}
+
+	eventsNode.Children = allEvents.children()
+
+	if token, matched := p.match(TupletRatio); matched {
+		tuplet, err := p.tuplet(cramOpenToken, eventsNode, token)
+		if err != nil {
+			return ASTNode{}, err
+		}
+
+		return p.singleOrRepeated(tuplet), nil
 	}
 
 	cram := ASTNode{
 		Type:          CramNode,
 		SourceContext: p.sourceContext(cramOpenToken),
-		Children:      []ASTNode{eventsNode},
 	}
 
 	if _, matched := p.matchDurationComponent(); matched {
-		cram.Children = append(cram.Children, p.duration())
+		cram.Children = p.arena.children(eventsNode, p.duration())
+	} else {
+		cram.Children = p.arena.children(eventsNode)
 	}
 
 	return p.singleOrRepeated(cram), nil
@@ -927,6 +1654,8 @@ func (p *parser) voiceNumber() (ASTNode, error) {
 		Type:          VoiceNumberNode,
 		SourceContext: p.sourceContext(token),
 		Literal:       token.literal.(int32),
+		// Trim the surrounding 'V' and ':'.
+		SourceText: p.sourceText(token.text[1 : len(token.text)-1]),
 	}, nil
 }
 
@@ -1037,6 +1766,10 @@ func (p *parser) innerEvent() (ASTNode, error) {
 		}, nil
 	}
 
+	if token, matched := p.match(TimeSignature); matched {
+		return p.timeSignature(token)
+	}
+
 	if _, matched := p.match(EventSeqOpen); matched {
 		return p.eventSeq()
 	}
@@ -1049,6 +1782,10 @@ func (p *parser) innerEvent() (ASTNode, error) {
 		return p.voiceGroup()
 	}
 
+	if token, matched := p.match(MultiMeasureRest); matched {
+		return p.multiMeasureRest(token)
+	}
+
 	if token, matched := p.match(Marker); matched {
 		return ASTNode{
 			Type:          MarkerNode,
@@ -1078,24 +1815,127 @@ func (p *parser) topLevel() (ASTNode, error) {
 }
 
 func (p *parser) parseAST() (ASTNode, error) {
-	rootNode := ASTNode{Type: RootNode}
+	rootNode := ASTNode{
+		Type:          RootNode,
+		SourceContext: p.sourceContext(p.peek()),
+	}
+
+	for t := p.peek(); t.tokenType != EOF && !p.tooManyErrors(); t = p.peek() {
+		start := p.current
 
-	for t := p.peek(); t.tokenType != EOF; t = p.peek() {
-		// fmt.Printf("t: %s\n", t.String())
 		node, err := p.topLevel()
 		if err != nil {
-			return ASTNode{}, err
+			node = p.skipError(err, start)
 		}
 
 		rootNode.Children = append(rootNode.Children, node)
 	}
 
+	if len(p.errors) > 0 {
+		return rootNode, newParseErrors(p.errors)
+	}
+
 	return rootNode, nil
 }
 
+// parseEvents parses a fragment of code consisting only of events, i.e. the
+// kind of thing that can appear within a part.
+func (p *parser) parseEvents() ([]ASTNode, error) {
+	events := []ASTNode{}
+
+	for !p.check(EOF) && !p.tooManyErrors() {
+		start := p.current
+
+		// We report part declarations and variable definitions, but parse them
+		// anyway, so that we can carry on and report any further errors.
+		switch {
+		case p.looksLikePartDeclaration():
+			p.recordError(p.errorAtToken(p.peek(), fmt.Sprintf(
+				"Unexpected part declaration `%s` in events", p.peek().text,
+			)))
+
+			p.advance()
+			if _, err := p.partDeclaration(); err != nil {
+				p.recordError(err)
+				p.synchronize(start)
+			}
+			continue
+
+		case p.check(Name) && p.next().tokenType == Equals:
+			p.recordError(p.errorAtToken(p.peek(), fmt.Sprintf(
+				"Unexpected variable definition `%s` in events", p.peek().text,
+			)))
+		}
+
+		event, err := p.innerEvent()
+		if err != nil {
+			p.recordError(err)
+			p.synchronize(start)
+			continue
+		}
+
+		if event.Type != VariableDefinitionNode {
+			events = append(events, event)
+		}
+	}
+
+	if len(p.errors) > 0 {
+		return nil, newParseErrors(p.errors)
+	}
+
+	return events, nil
+}
+
 // Parse a string of input into a root ASTNode.
+//
+// If the input has syntax errors, the error is a *ParseErrors, and the AST is
+// still returned for the benefit of e.g. editor tooling. Each construct that
+// couldn't be parsed is replaced in the AST by an ErrorNode, along with the
+// input that was skipped to recover from the error (see synchronize). The
+// ErrorNode's literal is the error message, and its source text is the raw
+// text that was skipped. (Errors found while scanning, e.g. an unexpected
+// character, are reported, but the characters are left out of the AST.)
 func Parse(
 	filepath string, input string, opts ...parseOption,
+) (ASTNode, error) {
+	return parseRunes(filepath, []rune(input), opts...)
+}
+
+// ReadError is returned by ParseReader when the input could not be read, as
+// opposed to when the input was read successfully but contains syntax errors.
+type ReadError struct {
+	// Context is the position in the input at which reading failed.
+	Context model.AldaSourceContext
+	// Err is the error returned by the reader.
+	Err error
+}
+
+func (e *ReadError) Error() string {
+	filename := e.Context.Filename
+	if filename == "" {
+		filename = "<no file>"
+	}
+
+	return fmt.Sprintf(
+		"%s:%d:%d error reading input: %s",
+		filename, e.Context.Line, e.Context.Column, e.Err,
+	)
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// ParseReader parses input from a reader, which is read as it's scanned,
+// until EOF. The input isn't kept once it's been scanned, only the tokens
+// (and the text between them that isn't plain spacing), so parsing a long
+// input takes less memory than reading it into a string first.
+//
+// `filepath` is used to report the positions of any errors, in the same way as
+// with Parse. Input that cannot be read is reported as a *ReadError, rather
+// than any syntax errors in the input that was read before it.
+func ParseReader(
+	filepath string, r io.Reader, opts ...parseOption,
 ) (ASTNode, error) {
 	defer func(start time.Time) {
 		if r := recover(); r != nil {
@@ -1108,27 +1948,93 @@ func Parse(
 			Msg("Parsed input.")
 	}(time.Now())
 
-	tokens, err := Scan(filepath, input)
-	if err != nil {
-		return ASTNode{}, err
+	s := newReaderScanner(filepath, r)
+	p := newScannerParser(filepath, s, opts...)
+	if s.readErr != nil {
+		return ASTNode{}, s.readErr
 	}
 
-	p := newParser(filepath, tokens, opts...)
+	p.gaps = s.gaps
 
 	return p.parseAST()
 }
 
+func parseRunes(
+	filepath string, input []rune, opts ...parseOption,
+) (ASTNode, error) {
+	defer func(start time.Time) {
+		if r := recover(); r != nil {
+			panic(fmt.Sprintf("Critical error while parsing %s", filepath))
+		}
+
+		log.Info().
+			Str("filepath", filepath).
+			Str("took", time.Since(start).String()).
+			Msg("Parsed input.")
+	}(time.Now())
+
+	return newRuneParser(filepath, input, opts...).parseAST()
+}
+
+func newRuneParser(
+	filepath string, input []rune, opts ...parseOption,
+) *parser {
+	p := newScannerParser(filepath, newRuneScanner(filepath, input), opts...)
+	p.source = input
+	return p
+}
+
+// newScannerParser returns a parser of the tokens that the scanner scans.
+func newScannerParser(
+	filepath string, s *scanner, opts ...parseOption,
+) *parser {
+	// We apply the options to a throwaway parser in order to find out whether
+	// we need the scanner to emit comments.
+	if newParser(filepath, nil, opts...).comments != nil {
+		s.trivia = true
+	}
+
+	tokens, scanErrors := s.scan()
+
+	p := newParser(filepath, tokens, opts...)
+
+	// Even if there were scanning errors, we parse whatever tokens we have, in
+	// order to report as many errors as we can.
+	p.errors = append(p.errors, scanErrors...)
+
+	return p
+}
+
+// ParseTokens parses a list of tokens, e.g. the result of Tokenize, into an
+// AST. Trivia tokens are ignored.
+func ParseTokens(
+	filepath string, tokens []Token, opts ...parseOption,
+) (ASTNode, error) {
+	return newParser(filepath, tokens, opts...).parseAST()
+}
+
+// ParseEvents parses a fragment of code consisting only of events, e.g.
+// `c8 d e f | g2`, and returns the events themselves, rather than a RootNode
+// containing an ImplicitPartNode containing the events. See also FormatEvents.
+//
+// Part declarations and variable definitions are not events, so an error is
+// returned if the fragment contains either of them.
+func ParseEvents(input string, opts ...parseOption) ([]ASTNode, error) {
+	return newRuneParser("", []rune(input), opts...).parseEvents()
+}
+
 // ParseString reads and parses a string of input.
 func ParseString(input string) (ASTNode, error) {
 	return Parse("", input)
 }
 
-// ParseFile reads a file and parses the input.
-func ParseFile(filepath string) (ASTNode, error) {
+// readSourceFile reads a file of Alda source code, returning a user-facing
+// error if the file does not exist.
+func readSourceFile(filepath string) (string, error) {
 	contents, err := os.ReadFile(filepath)
 
 	if errors.Is(err, os.ErrNotExist) {
-		return ASTNode{}, help.UserFacingErrorf(
+		return "", help.UserFacingErrorf(
 			`Failed to open %s. The file does not seem to exist.
 
 Please check that you haven't misspelled the file name, etc.`,
@@ -1136,9 +2042,19 @@ Please check that you haven't misspelled the file name, etc.`,
 		)
 	}
 
+	if err != nil {
+		return "", err
+	}
+
+	return string(contents), nil
+}
+
+// ParseFile reads a file and parses the input.
+func ParseFile(filepath string) (ASTNode, error) {
+	contents, err := readSourceFile(filepath)
 	if err != nil {
 		return ASTNode{}, err
 	}
 
-	return Parse(filepath, string(contents))
+	return Parse(filepath, contents)
 }
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"io"
 	"testing"
 
 	"alda.io/client/model"
@@ -64,5 +65,199 @@ func TestParts(t *testing.T) {
 				model.Note{Pitch: model.LetterAndAccidentals{NoteLetter: model.E}},
 			},
 		},
+		parseTestCase{
+			label: "part with no events",
+			given: "piano:\n",
+			expectUpdates: []model.ScoreUpdate{
+				model.PartDeclaration{Names: []string{"piano"}},
+			},
+			expectAST: &ASTNode{
+				Type: RootNode,
+				Children: []ASTNode{
+					{
+						Type: PartNode,
+						Children: []ASTNode{
+							{
+								Type: PartDeclarationNode,
+								Children: []ASTNode{
+									{
+										Type: PartNamesNode,
+										Children: []ASTNode{
+											{Type: PartNameNode, Literal: "piano"},
+										},
+									},
+								},
+							},
+							{Type: EventSequenceNode, Children: []ASTNode{}},
+						},
+					},
+				},
+			},
+		},
+		parseTestCase{
+			label: "parts with no events",
+			given: "piano:\nviolin:",
+			expectUpdates: []model.ScoreUpdate{
+				model.PartDeclaration{Names: []string{"piano"}},
+				model.PartDeclaration{Names: []string{"violin"}},
+			},
+		},
+	)
+}
+
+func TestFormatImplicitPartSpacing(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "implicit part followed by a named part",
+			given:    "c d\npiano: e",
+			expected: "c d\n\npiano:\n  e\n",
+		},
+		formatTestCase{
+			label:    "global attribute changes followed by named parts",
+			given:    "(tempo! 90)\n\n\n\npiano: e f\nviolin: g",
+			expected: "(tempo! 90)\n\npiano:\n  e f\n\nviolin:\n  g\n",
+		},
+		formatTestCase{
+			label:    "variable definition followed by a named part",
+			given:    "riff = c d\npiano: riff",
+			expected: "riff = c d\n\npiano:\n  riff\n",
+		},
+		formatTestCase{
+			label:    "minified",
+			given:    "(tempo! 90)\npiano: e f\nviolin: g",
+			opts:     []formatterOption{ConfigureMinified(true)},
+			expected: "(tempo! 90) piano: e f violin: g\n",
+		},
+	)
+}
+
+func TestFormatExplicitImplicitPart(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label: "implicit part under a named part",
+			given: "c d e",
+			opts: []formatterOption{
+				ConfigureExplicitImplicitPart("piano"),
+				ConfigureIndentText("    "),
+			},
+			expected: "piano:\n    c d e\n",
+		},
+		formatTestCase{
+			label:    "only the leading implicit part",
+			given:    "(tempo! 90) c d\nviolin: e f",
+			opts:     []formatterOption{ConfigureExplicitImplicitPart("piano")},
+			expected: "piano:\n  (tempo! 90) c d\n\nviolin:\n  e f\n",
+		},
+		formatTestCase{
+			label:    "no implicit part",
+			given:    "violin: e f",
+			opts:     []formatterOption{ConfigureExplicitImplicitPart("piano")},
+			expected: "violin:\n  e f\n",
+		},
+		formatTestCase{
+			label:    "implicit part without the option",
+			given:    "c d e",
+			expected: "c d e\n",
+		},
+	)
+
+	err := FormatASTToCode(
+		ASTNode{Type: RootNode}, io.Discard, ConfigureExplicitImplicitPart("p!"),
+	)
+	if err == nil {
+		t.Error("expected an error for an invalid part name")
+	}
+
+	// A name that the score already declares would make it declare the part
+	// twice, which is ambiguous, e.g. `piano:` and `piano "solo":`.
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected string
+	}{
+		{
+			label: "part name",
+			given: "(tempo! 60)\npiano \"solo\": c",
+			expected: "piece.alda:2:1 invalid implicit part name: \"piano\" is " +
+				"already declared in the score",
+		},
+		{
+			label: "alias",
+			given: "(tempo! 60)\nharp \"piano\": c",
+			expected: "piece.alda:2:6 invalid implicit part name: \"piano\" is " +
+				"already declared in the score",
+		},
+		{
+			label: "part group",
+			given: "c\nviolin/piano: d",
+			expected: "piece.alda:2:8 invalid implicit part name: \"piano\" is " +
+				"already declared in the score",
+		},
+	} {
+		ast, err := Parse("piece.alda", testCase.given)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+
+		err = FormatASTToCode(
+			ast, io.Discard, ConfigureExplicitImplicitPart("piano"),
+		)
+		if err == nil || err.Error() != testCase.expected {
+			t.Errorf(
+				"%s\nexpected error: %s\nactual error: %v",
+				testCase.label, testCase.expected, err,
+			)
+		}
+	}
+}
+
+func TestFormatPartGroupSpacing(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "two names without spacing by default",
+			given:    "piano / guitar: c",
+			expected: "piano/guitar:\n  c\n",
+		},
+		formatTestCase{
+			label:    "two names",
+			given:    "piano/guitar: c",
+			opts:     []formatterOption{ConfigurePartGroupSpacing(true)},
+			expected: "piano / guitar:\n  c\n",
+		},
+		formatTestCase{
+			label:    "two names with an alias",
+			given:    "piano/guitar \"rhythm\": c",
+			opts:     []formatterOption{ConfigurePartGroupSpacing(true)},
+			expected: "piano / guitar \"rhythm\":\n  c\n",
+		},
+		formatTestCase{
+			label:    "three names",
+			given:    "violin /viola/ cello: c",
+			opts:     []formatterOption{ConfigurePartGroupSpacing(true)},
+			expected: "violin / viola / cello:\n  c\n",
+		},
+		formatTestCase{
+			label:    "three names with an alias",
+			given:    "violin / viola / cello \"strings\": c",
+			opts:     []formatterOption{ConfigurePartGroupSpacing(false)},
+			expected: "violin/viola/cello \"strings\":\n  c\n",
+		},
+		formatTestCase{
+			label:    "a single name",
+			given:    "piano \"pno\": c",
+			opts:     []formatterOption{ConfigurePartGroupSpacing(true)},
+			expected: "piano \"pno\":\n  c\n",
+		},
+		formatTestCase{
+			label: "minified",
+			given: "violin/viola/cello \"strings\": c",
+			opts: []formatterOption{
+				ConfigurePartGroupSpacing(true), ConfigureMinified(true),
+			},
+			expected: "violin/viola/cello \"strings\": c\n",
+		},
 	)
 }
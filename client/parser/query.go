@@ -0,0 +1,284 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"alda.io/client/model"
+)
+
+// A NodeRef is a node found by a query (see FindAll, FindByType and Select),
+// along with its location in the tree that was queried.
+type NodeRef struct {
+	// Node is the node that was found.
+	Node ASTNode
+	// Parents are the ancestors of the node, from the node on which the query
+	// was run (first) to the node's immediate parent (last).
+	Parents []ASTNode
+	// Index is the position of the node among its parent's children.
+	Index int
+	// Path is the location of the node relative to the node on which the query
+	// was run, in the same form as the Path of a NodeDiff, e.g.
+	// "RootNode/PartNode[1]/EventSequenceNode/NoteNode[3]".
+	Path string
+}
+
+// Parent returns the node's immediate parent.
+func (ref NodeRef) Parent() ASTNode {
+	return ref.Parents[len(ref.Parents)-1]
+}
+
+// Position returns the source context of the node. If the node has no source
+// context (e.g. because the AST was constructed by hand), it returns that of
+// the nearest ancestor that has one. The boolean return value is false if
+// neither the node nor any of its ancestors has a source context.
+func (ref NodeRef) Position() (model.AldaSourceContext, bool) {
+	if ref.Node.SourceContext.Line > 0 {
+		return ref.Node.SourceContext, true
+	}
+
+	for i := len(ref.Parents) - 1; i >= 0; i-- {
+		if ref.Parents[i].SourceContext.Line > 0 {
+			return ref.Parents[i].SourceContext, true
+		}
+	}
+
+	return model.AldaSourceContext{}, false
+}
+
+// Replace replaces the node with another node, in place, in the tree on which
+// the query was run.
+//
+// NB: This works because the parent's Children slice shares its backing array
+// with the queried tree. The NodeRef itself is not updated, so after replacing
+// a node, refs to the node and its descendants are stale, and a query should be
+// run again in order to find nodes within the replacement.
+func (ref NodeRef) Replace(replacement ASTNode) {
+	ref.Parent().Children[ref.Index] = replacement
+}
+
+// FindAll returns every descendant of the node (not including the node itself)
+// for which the predicate returns true, in the order in which they appear in
+// the tree.
+func (node ASTNode) FindAll(pred func(ASTNode) bool) []NodeRef {
+	refs := []NodeRef{}
+	findAll(node, []ASTNode{}, node.Type.String(), pred, &refs)
+	return refs
+}
+
+func findAll(
+	node ASTNode,
+	parents []ASTNode,
+	path string,
+	pred func(ASTNode) bool,
+	refs *[]NodeRef,
+) {
+	// NB: We use a full slice expression so that appending to parents in one
+	// branch can't overwrite the Parents of a NodeRef found in another branch.
+	parents = append(parents[:len(parents):len(parents)], node)
+
+	for i, child := range node.Children {
+		childPath := path + "/" + childPathSegment(node.Children, i)
+
+		if pred(child) {
+			*refs = append(*refs, NodeRef{
+				Node: child, Parents: parents, Index: i, Path: childPath,
+			})
+		}
+
+		findAll(child, parents, childPath, pred, refs)
+	}
+}
+
+// FindByType returns every descendant of the node (not including the node
+// itself) of the given type, in the order in which they appear in the tree.
+func (node ASTNode) FindByType(nodeType ASTNodeType) []NodeRef {
+	return node.FindAll(func(n ASTNode) bool {
+		return n.Type == nodeType
+	})
+}
+
+// A pathStep is a single step in a path given to Select, e.g. "NoteNode[3]".
+type pathStep struct {
+	// anyType is true if the step is "*", in which case nodeType is ignored.
+	anyType  bool
+	nodeType ASTNodeType
+	// index is the required position of the node among its parent's children,
+	// or -1 if the node can be at any position.
+	index int
+}
+
+func (step pathStep) matches(node ASTNode, index int) bool {
+	return (step.anyType || node.Type == step.nodeType) &&
+		(step.index < 0 || step.index == index)
+}
+
+func parsePath(path string) ([]pathStep, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	steps := []pathStep{}
+
+	for _, segment := range strings.Split(path, "/") {
+		step := pathStep{index: -1}
+		name := segment
+
+		if i := strings.IndexRune(segment, '['); i >= 0 {
+			if !strings.HasSuffix(segment, "]") {
+				return nil, fmt.Errorf("invalid path segment: %q", segment)
+			}
+
+			index, err := strconv.Atoi(segment[i+1 : len(segment)-1])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index in path segment: %q", segment)
+			}
+
+			name = segment[:i]
+			step.index = index
+		}
+
+		if name == "*" {
+			step.anyType = true
+		} else {
+			nodeType, ok := ASTNodeTypeFromString(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown node type in path: %q", name)
+			}
+			step.nodeType = nodeType
+		}
+
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+// Select returns the descendants of the node at the given path, in the order in
+// which they appear in the tree.
+//
+// The path is a slash-separated list of node types, starting with the type of
+// one of the node's children, e.g. "PartNode/EventSequenceNode/NoteNode"
+// selects every note at the top level of every part when run on a RootNode. A
+// step can be "*", which matches a node of any type, and can end with an index
+// in square brackets, which matches only the node at that position among its
+// parent's children, e.g. "PartNode[1]".
+//
+// An error is returned if the path is malformed or contains an unknown node
+// type.
+func (node ASTNode) Select(path string) ([]NodeRef, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []NodeRef{}
+	selectPath(node, []ASTNode{}, node.Type.String(), steps, &refs)
+	return refs, nil
+}
+
+func selectPath(
+	node ASTNode,
+	parents []ASTNode,
+	path string,
+	steps []pathStep,
+	refs *[]NodeRef,
+) {
+	parents = append(parents[:len(parents):len(parents)], node)
+
+	for i, child := range node.Children {
+		if !steps[0].matches(child, i) {
+			continue
+		}
+
+		childPath := path + "/" + childPathSegment(node.Children, i)
+
+		if len(steps) == 1 {
+			*refs = append(*refs, NodeRef{
+				Node: child, Parents: parents, Index: i, Path: childPath,
+			})
+			continue
+		}
+
+		selectPath(child, parents, childPath, steps[1:], refs)
+	}
+}
+
+// Remove returns a copy of the node without the descendants at the given
+// paths, which are in the form given to Select, e.g.
+// "PartNode[1]/EventSequenceNode/NoteNode[3]", except that each step of a path
+// must match exactly one node. The original node is left unchanged.
+//
+// An error is returned if a path is malformed, or a step of it matches no
+// nodes or more than one.
+func (node ASTNode) Remove(paths ...string) (ASTNode, error) {
+	removed := node.Clone()
+
+	// A removal is the node at the given index among its parent's children, at
+	// the given depth in the tree.
+	type removal struct {
+		parent *ASTNode
+		index  int
+		depth  int
+	}
+
+	removals := []removal{}
+
+	for _, path := range paths {
+		steps, err := parsePath(path)
+		if err != nil {
+			return ASTNode{}, err
+		}
+
+		parent := &removed
+		for depth, step := range steps {
+			matches := []int{}
+			for i, child := range parent.Children {
+				if step.matches(child, i) {
+					matches = append(matches, i)
+				}
+			}
+
+			if len(matches) != 1 {
+				return ASTNode{}, fmt.Errorf(
+					"path %q matches %d nodes at step %d, rather than one",
+					path, len(matches), depth+1,
+				)
+			}
+
+			if depth == len(steps)-1 {
+				removals = append(removals, removal{parent, matches[0], depth})
+			} else {
+				parent = &parent.Children[matches[0]]
+			}
+		}
+	}
+
+	// Removing a node moves its later siblings, so the deepest nodes are removed
+	// first, and siblings from last to first.
+	sort.SliceStable(removals, func(i, j int) bool {
+		if removals[i].depth != removals[j].depth {
+			return removals[i].depth > removals[j].depth
+		}
+		return removals[i].index > removals[j].index
+	})
+
+	// The same node can be at more than one path, e.g. "PartNode[1]" and
+	// "*[1]", but it's only removed once.
+	done := map[removal]bool{}
+
+	for _, r := range removals {
+		if done[r] {
+			continue
+		}
+		done[r] = true
+
+		r.parent.Children = append(
+			r.parent.Children[:r.index], r.parent.Children[r.index+1:]...,
+		)
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,417 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+const queryTestScore = `riff = c8 d e
+
+piano:
+  (tempo! 120)
+  V1: c/e/g riff (vol 50)
+  V2: e/g/b
+  V0: riff
+
+violin:
+  (tempo! 90) riff c/e
+`
+
+// refSummary is a summary of a NodeRef that is convenient to compare in tests.
+type refSummary struct {
+	path     string
+	parent   ASTNodeType
+	index    int
+	position string
+}
+
+func summarizeRefs(refs []NodeRef) []refSummary {
+	summaries := []refSummary{}
+
+	for _, ref := range refs {
+		position := "none"
+		if context, ok := ref.Position(); ok {
+			position = fmt.Sprintf("%d:%d", context.Line, context.Column)
+		}
+
+		summaries = append(summaries, refSummary{
+			path:     ref.Path,
+			parent:   ref.Parent().Type,
+			index:    ref.Index,
+			position: position,
+		})
+	}
+
+	return summaries
+}
+
+type queryTestCase struct {
+	label    string
+	query    func(ASTNode) ([]NodeRef, error)
+	expected []refSummary
+}
+
+func executeQueryTestCases(t *testing.T, testCases ...queryTestCase) {
+	ast, err := Parse("query", queryTestScore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range testCases {
+		refs, err := testCase.query(ast)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		actual := summarizeRefs(refs)
+		// NB: deep.Equal ignores unexported fields, so we can't use it here.
+		if !reflect.DeepEqual(testCase.expected, actual) {
+			t.Error(testCase.label)
+			t.Errorf("expected:\n%+v\nactual:\n%+v", testCase.expected, actual)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	isLispForm := func(head string) func(ASTNode) bool {
+		return func(node ASTNode) bool {
+			return node.Type == LispListNode &&
+				len(node.Children) > 0 &&
+				node.Children[0].Type == LispSymbolNode &&
+				node.Children[0].Literal == head
+		}
+	}
+
+	executeQueryTestCases(
+		t,
+		queryTestCase{
+			label: "variable references",
+			query: func(ast ASTNode) ([]NodeRef, error) {
+				return ast.FindByType(VariableReferenceNode), nil
+			},
+			expected: []refSummary{
+				{
+					path: "RootNode/PartNode[1]/EventSequenceNode/VoiceGroupNode/" +
+						"VoiceNode[0]/EventSequenceNode/VariableReferenceNode",
+					parent:   EventSequenceNode,
+					index:    1,
+					position: "5:13",
+				},
+				{
+					path: "RootNode/PartNode[1]/EventSequenceNode/" +
+						"VariableReferenceNode",
+					parent:   EventSequenceNode,
+					index:    2,
+					position: "7:7",
+				},
+				{
+					path: "RootNode/PartNode[2]/EventSequenceNode/" +
+						"VariableReferenceNode",
+					parent:   EventSequenceNode,
+					index:    1,
+					position: "10:15",
+				},
+			},
+		},
+		queryTestCase{
+			label: "lisp forms with a specific head symbol",
+			query: func(ast ASTNode) ([]NodeRef, error) {
+				return ast.FindAll(isLispForm("tempo!")), nil
+			},
+			expected: []refSummary{
+				{
+					path:     "RootNode/PartNode[1]/EventSequenceNode/LispListNode",
+					parent:   EventSequenceNode,
+					index:    0,
+					position: "4:3",
+				},
+				{
+					path:     "RootNode/PartNode[2]/EventSequenceNode/LispListNode",
+					parent:   EventSequenceNode,
+					index:    0,
+					position: "10:3",
+				},
+			},
+		},
+		queryTestCase{
+			label: "chords inside voices",
+			query: func(ast ASTNode) ([]NodeRef, error) {
+				return ast.Select(
+					"PartNode/EventSequenceNode/VoiceGroupNode/VoiceNode/" +
+						"EventSequenceNode/ChordNode",
+				)
+			},
+			expected: []refSummary{
+				{
+					path: "RootNode/PartNode[1]/EventSequenceNode/VoiceGroupNode/" +
+						"VoiceNode[0]/EventSequenceNode/ChordNode",
+					parent:   EventSequenceNode,
+					index:    0,
+					position: "5:7",
+				},
+				{
+					path: "RootNode/PartNode[1]/EventSequenceNode/VoiceGroupNode/" +
+						"VoiceNode[1]/EventSequenceNode/ChordNode",
+					parent:   EventSequenceNode,
+					index:    0,
+					position: "6:7",
+				},
+			},
+		},
+		queryTestCase{
+			label: "selection with an index and a wildcard",
+			query: func(ast ASTNode) ([]NodeRef, error) {
+				return ast.Select("PartNode[2]/*/ChordNode")
+			},
+			expected: []refSummary{
+				{
+					path:     "RootNode/PartNode[2]/EventSequenceNode/ChordNode",
+					parent:   EventSequenceNode,
+					index:    2,
+					position: "10:20",
+				},
+			},
+		},
+		queryTestCase{
+			label: "selection from a node other than the root",
+			query: func(ast ASTNode) ([]NodeRef, error) {
+				voices := ast.FindByType(VoiceNode)
+				return voices[1].Node.Select("EventSequenceNode/*")
+			},
+			expected: []refSummary{
+				{
+					path:     "VoiceNode/EventSequenceNode/ChordNode",
+					parent:   EventSequenceNode,
+					index:    0,
+					position: "6:7",
+				},
+			},
+		},
+		queryTestCase{
+			label: "selection without matches",
+			query: func(ast ASTNode) ([]NodeRef, error) {
+				return ast.Select("PartNode/EventSequenceNode/CramNode")
+			},
+			expected: []refSummary{},
+		},
+	)
+}
+
+func TestQueryParents(t *testing.T) {
+	ast, err := Parse("query", queryTestScore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chords := ast.FindAll(func(node ASTNode) bool {
+		return node.Type == ChordNode
+	})
+
+	inVoices := 0
+	for _, chord := range chords {
+		if chord.Parents[0].Type != RootNode {
+			t.Errorf("expected the first parent to be the root: %s", chord.Path)
+		}
+
+		if !Equal(chord.Parent().Children[chord.Index], chord.Node) {
+			t.Errorf("expected the node to be at its index: %s", chord.Path)
+		}
+
+		for _, parent := range chord.Parents {
+			if parent.Type == VoiceNode {
+				inVoices++
+			}
+		}
+	}
+
+	if len(chords) != 3 || inVoices != 2 {
+		t.Errorf(
+			"expected 3 chords, 2 of which are in voices, but got %d and %d",
+			len(chords), inVoices,
+		)
+	}
+}
+
+func TestQueryReplace(t *testing.T) {
+	ast, err := Parse("query", queryTestScore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ref := range ast.FindByType(VariableReferenceNode) {
+		ref.Replace(ASTNode{
+			Type: RestNode,
+			Children: []ASTNode{{
+				Type: DurationNode,
+				Children: []ASTNode{{
+					Type:     NoteLengthNode,
+					Children: []ASTNode{{Type: DenominatorNode, Literal: 2.0}},
+				}},
+			}},
+		})
+	}
+
+	buffer := bytes.Buffer{}
+	if err := FormatASTToCode(ast, &buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `riff = c8 d e
+
+piano:
+  (tempo! 120)
+  V1:
+    c / e / g r2 (vol 50)
+  V2:
+    e / g / b
+  V0: r2
+
+violin:
+  (tempo! 90) r2 c / e
+`
+
+	if actual := buffer.String(); actual != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+}
+
+func TestQueryPosition(t *testing.T) {
+	ast, err := Parse("query", queryTestScore, SuppressSourceContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectNoPositions := func(refs []NodeRef) {
+		for _, ref := range refs {
+			if _, ok := ref.Position(); ok {
+				t.Errorf("expected no position: %s", ref.Path)
+			}
+		}
+	}
+
+	expectNoPositions(ast.FindByType(NoteNode))
+
+	// A node without a source context falls back to that of its nearest ancestor
+	// that has one.
+	ast, err = Parse("query", queryTestScore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notes := ast.FindByType(NoteNode)
+	notes[0].Node.SourceContext = model.AldaSourceContext{}
+	notes[0].Parents[len(notes[0].Parents)-1].SourceContext = at(1, 1)
+
+	context, ok := notes[0].Position()
+	if !ok || context.Line != 1 || context.Column != 1 {
+		t.Errorf("expected the parent's position, but got %#v", context)
+	}
+}
+
+func TestSelectErrors(t *testing.T) {
+	ast, err := Parse("query", queryTestScore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range []struct {
+		path     string
+		expected string
+	}{
+		{"", "empty path"},
+		{"PartNode/NotANode", `unknown node type in path: "NotANode"`},
+		{"PartNode//NoteNode", `unknown node type in path: ""`},
+		{"PartNode[1", `invalid path segment: "PartNode[1"`},
+		{"PartNode[x]", `invalid index in path segment: "PartNode[x]"`},
+		{"PartNode[-1]", `invalid index in path segment: "PartNode[-1]"`},
+	} {
+		_, err := ast.Select(testCase.path)
+		if err == nil {
+			t.Errorf("%q: expected an error", testCase.path)
+			continue
+		}
+
+		if err.Error() != testCase.expected {
+			t.Errorf(
+				"%q: expected error: %s\nactual error: %s",
+				testCase.path, testCase.expected, err,
+			)
+		}
+	}
+}
+
+func TestQueryRemove(t *testing.T) {
+	ast, err := Parse("query", queryTestScore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := ast.Remove(
+		"PartNode[1]/EventSequenceNode/VoiceGroupNode[1]/VoiceNode[0]/"+
+			"EventSequenceNode/LispListNode[2]",
+		"PartNode[1]/EventSequenceNode/LispListNode[0]",
+		"*[1]/EventSequenceNode/LispListNode",
+		"PartNode[2]/EventSequenceNode/ChordNode[2]",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := bytes.Buffer{}
+	if err := FormatASTToCode(removed, &buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `riff = c8 d e
+
+piano:
+  V1:
+    c / e / g riff
+  V2:
+    e / g / b
+  V0: riff
+
+violin:
+  (tempo! 90) riff
+`
+
+	if actual := buffer.String(); actual != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+
+	// The original AST is left unchanged.
+	if len(ast.FindByType(LispListNode)) != 3 {
+		t.Errorf("expected the original AST to be unchanged")
+	}
+
+	for _, testCase := range []struct {
+		path     string
+		expected string
+	}{
+		{"PartNode[1", `invalid path segment: "PartNode[1"`},
+		{
+			"PartNode",
+			`path "PartNode" matches 2 nodes at step 1, rather than one`,
+		},
+		{
+			"PartNode[1]/NoteNode",
+			`path "PartNode[1]/NoteNode" matches 0 nodes at step 2, rather than ` +
+				`one`,
+		},
+	} {
+		_, err := ast.Remove(testCase.path)
+		if err == nil || err.Error() != testCase.expected {
+			t.Errorf(
+				"%q: expected error: %s\nactual error: %v",
+				testCase.path, testCase.expected, err,
+			)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package parser
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	_ "alda.io/client/testing"
+)
+
+func TestParseReaderOneByteAtATime(t *testing.T) {
+	inputs := []string{
+		"piano: c d e f\n",
+		"piano: c d e f",
+		"(key-signature \"f+ c+\")\nviolin: é",
+		"",
+	}
+
+	for _, input := range inputs {
+		expected, expectedErr := Parse("piece.alda", input)
+
+		actual, err := ParseReader(
+			"piece.alda", iotest.OneByteReader(strings.NewReader(input)),
+		)
+
+		if (err == nil) != (expectedErr == nil) {
+			t.Errorf("%q: expected error %v, got %v", input, expectedErr, err)
+			continue
+		}
+
+		if expectedErr != nil {
+			if err.Error() != expectedErr.Error() {
+				t.Errorf("%q: expected error %v, got %v", input, expectedErr, err)
+			}
+			continue
+		}
+
+		if diffs := Diff(expected, actual); len(diffs) > 0 {
+			t.Errorf("%q: ASTs differ: %v", input, diffs)
+		}
+
+		if !ASTEqual(expected, actual) {
+			t.Errorf("%q: source contexts differ", input)
+		}
+	}
+}
+
+func TestParseReaderReadError(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	_, err := ParseReader(
+		"piece.alda",
+		io.MultiReader(
+			strings.NewReader("piano: c d\ne"),
+			iotest.ErrReader(errBoom),
+		),
+	)
+
+	var readError *ReadError
+	if !errors.As(err, &readError) {
+		t.Fatalf("expected a *ReadError, got %#v", err)
+	}
+
+	if !errors.Is(err, errBoom) {
+		t.Errorf("expected the error to wrap the reader's error, got %v", err)
+	}
+
+	var parseErrors *ParseErrors
+	if errors.As(err, &parseErrors) {
+		t.Errorf("expected a read error, not a syntax error, got %v", err)
+	}
+
+	expected := "piece.alda:2:2 error reading input: boom"
+	if err.Error() != expected {
+		t.Errorf("expected error: %s\nactual error: %s", expected, err)
+	}
+}
+
+func TestParseReaderSyntaxError(t *testing.T) {
+	_, err := ParseReader(
+		"piece.alda", iotest.OneByteReader(strings.NewReader("piano: c d\n  [e")),
+	)
+
+	var parseErrors *ParseErrors
+	if !errors.As(err, &parseErrors) {
+		t.Fatalf("expected a *ParseErrors, got %#v", err)
+	}
+
+	if context := parseErrors.Errors[0].Context; context.Filename != "piece.alda" ||
+		context.Line != 2 {
+		t.Errorf("unexpected error position: %v", err)
+	}
+}
+
+// The input is scanned as it's read, and the runes that have been scanned are
+// discarded along the way, so a long input exercises the lexemes that look
+// back or ahead across the runes that are kept.
+func TestParseReaderLongInput(t *testing.T) {
+	input := "piano:\n" +
+		strings.Repeat("  3/4 {c d e}3:2 c4.. | (print \"é\") [d e]*2 4/4\n", 200) +
+		"  c d ) e | f g"
+
+	expected, expectedErr := Parse("piece.alda", input)
+	if expectedErr == nil {
+		t.Fatal("expected a syntax error")
+	}
+
+	actual, err := ParseReader(
+		"piece.alda", iotest.OneByteReader(strings.NewReader(input)),
+	)
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %v, got %v", expectedErr, err)
+	}
+
+	if diffs := Diff(expected, actual); len(diffs) > 0 {
+		t.Errorf("ASTs differ: %v", diffs)
+	}
+
+	if !ASTEqual(expected, actual) {
+		t.Error("source contexts differ")
+	}
+
+	// Including the raw text of the ErrorNode
+	if e, a := sourceTexts(expected), sourceTexts(actual); !reflect.DeepEqual(
+		e, a,
+	) {
+		t.Errorf("expected source texts %q, got %q", e, a)
+	}
+}
+
+// sourceTexts returns the source texts of the nodes of an AST, in order.
+func sourceTexts(node ASTNode) []string {
+	texts := []string{node.SourceText}
+	for _, child := range node.Children {
+		texts = append(texts, sourceTexts(child)...)
+	}
+
+	return texts
+}
+
+// Only the text between tokens that isn't plain spacing is kept while the
+// input is read, so the raw text of an ErrorNode is put back together from
+// the tokens and the text between them.
+func TestParseReaderErrorSourceText(t *testing.T) {
+	inputs := []string{
+		"piano: c )\t\td  e\t \tf # comment\r\n\tg",
+		"piano:\n  c ) d   e\n\n\n    # one\n  # two\n e",
+		"piano: c ) \"é\"\t(print 1)   ) [d\r\n\r\ne]",
+	}
+
+	for _, input := range inputs {
+		expected, expectedErr := Parse("piece.alda", input)
+		if expectedErr == nil {
+			t.Errorf("%q: expected a syntax error", input)
+			continue
+		}
+
+		actual, err := ParseReader(
+			"piece.alda", iotest.OneByteReader(strings.NewReader(input)),
+		)
+		if err == nil || err.Error() != expectedErr.Error() {
+			t.Errorf("%q: expected error %v, got %v", input, expectedErr, err)
+		}
+
+		if e, a := sourceTexts(expected), sourceTexts(actual); !reflect.DeepEqual(
+			e, a,
+		) {
+			t.Errorf("%q: expected source texts %q, got %q", input, e, a)
+		}
+	}
+}
@@ -256,3 +256,64 @@ func TestRepeats(t *testing.T) {
 		},
 	)
 }
+
+func TestFormatRepeatSpacing(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "spaced by default",
+			given:    "piano: c4*4 (vol 50)*2 riff*2",
+			expected: "piano:\n  c4 *4 (vol 50) *2 riff *2\n",
+		},
+		formatTestCase{
+			label:    "spaced",
+			given:    "piano: c4*4 d8 *2",
+			opts:     []formatterOption{ConfigureRepeatSpacing(true)},
+			expected: "piano:\n  c4 *4 d8 *2\n",
+		},
+		formatTestCase{
+			label:    "tight",
+			given:    "piano: c4 *4 (vol 50) *2 riff *2 e/g *3",
+			opts:     []formatterOption{ConfigureRepeatSpacing(false)},
+			expected: "piano:\n  c4*4 (vol 50)*2 riff*2 e / g*3\n",
+		},
+		formatTestCase{
+			label: "event sequences, spaced",
+			given: "piano: [c d [e f] *2] *3",
+			opts:  []formatterOption{ConfigureRepeatSpacing(true)},
+			expected: "piano:\n  [\n    c d\n    [\n      e f\n    ] *2\n" +
+				"  ] *3\n",
+		},
+		formatTestCase{
+			label: "event sequences, tight",
+			given: "piano: [c d [e f] *2] *3",
+			opts:  []formatterOption{ConfigureRepeatSpacing(false)},
+			expected: "piano:\n  [\n    c d\n    [\n      e f\n    ]*2\n" +
+				"  ]*3\n",
+		},
+		formatTestCase{
+			// The repeated event is wrapped along with the number of times, rather
+			// than leaving `*4` at the start of the next line.
+			label: "tight repeat at the end of a wrapped line",
+			given: "piano: c8 d e f g a b > c d e f g a b > c d e f g a b > c " +
+				"d e f g a b > c d e f g c4 *4",
+			opts: []formatterOption{ConfigureRepeatSpacing(false)},
+			expected: "piano:\n  c8 d e f g a b > c d e f g a b > c d e f g a b > " +
+				"c d e f g a b > c d e f g\n  c4*4\n",
+		},
+		formatTestCase{
+			label:    "tight, within a cram expression",
+			given:    "piano: {c*2 d}4 e",
+			opts:     []formatterOption{ConfigureRepeatSpacing(false)},
+			expected: "piano:\n  { c*2 d }4 e\n",
+		},
+		formatTestCase{
+			label: "tight, within an inline part",
+			given: "piano: c*4 d/e*2",
+			opts: []formatterOption{
+				ConfigureRepeatSpacing(false), ConfigureInlineShortParts(40),
+			},
+			expected: "piano: c*4 d / e*2\n",
+		},
+	)
+}
@@ -0,0 +1,334 @@
+package parser
+
+import (
+	"strings"
+
+	"alda.io/client/model"
+)
+
+// A Respelling is a note whose accidentals go against those of the key
+// signature in effect, e.g. `a-` in a key with sharps, along with the same
+// pitch spelled in keeping with the key signature, e.g. `g+` (see
+// FindRespellings).
+type Respelling struct {
+	// Context is the position of the note.
+	Context model.AldaSourceContext
+	// Written is the note letter and accidentals as they're written, e.g.
+	// "a-".
+	Written string
+	// Respelled is the enharmonically equivalent note letter and accidentals,
+	// e.g. "g+".
+	Respelled string
+	// KeyAccidental is the accidental of the key signature, i.e. model.Sharp or
+	// model.Flat.
+	KeyAccidental model.Accidental
+}
+
+// How accidentals are written, keyed by accidental
+var accidentalSymbols = map[model.Accidental]string{
+	model.Sharp: "+", model.Flat: "-", model.Natural: "_",
+}
+
+// The note letters, in the order of their pitches within an octave
+var noteLettersInOrder = []model.NoteLetter{
+	model.C, model.D, model.E, model.F, model.G, model.A, model.B,
+}
+
+// percussionParts returns the parts with a percussion instrument, keyed by
+// their aliases or names (see partKey), including parts that refer to them by
+// alias.
+func percussionParts(root ASTNode) map[string]bool {
+	parts := map[string]bool{}
+
+	for _, part := range root.Children {
+		if part.Type != PartNode || len(part.Children[0].Children) == 0 {
+			continue
+		}
+
+		declaration := part.Children[0]
+		for _, nameNode := range declaration.Children[0].Children {
+			name, _ := nameNode.Literal.(string)
+			if model.IsPercussionInstrument(name) || parts[name] {
+				parts[partKey(declaration)] = true
+			}
+		}
+	}
+
+	return parts
+}
+
+// keyAccidental returns the accidental of a key signature whose accidentals
+// are all sharps or all flats. Returns false if the key signature is unknown,
+// has no accidentals, e.g. C major, or mixes sharps and flats.
+func keyAccidental(context pitchContext) (model.Accidental, bool) {
+	if !context.keySignatureKnown {
+		return 0, false
+	}
+
+	sharps, flats := false, false
+	for _, semitones := range context.keySignature {
+		sharps = sharps || semitones > 0
+		flats = flats || semitones < 0
+	}
+
+	switch {
+	case sharps && !flats:
+		return model.Sharp, true
+	case flats && !sharps:
+		return model.Flat, true
+	default:
+		return 0, false
+	}
+}
+
+// respell returns the spelling of a pitch class (0 for C to 11 for B) in a key
+// signature whose accidentals are all the given accidental: a note letter
+// without accidentals where there is one, with a natural sign if the key
+// signature changes it, or else a note letter with the key's accidental.
+func respell(
+	pitchClass int32, accidental model.Accidental, keySignature [7]int32,
+) string {
+	for _, letter := range noteLettersInOrder {
+		if model.NoteLetterIntervals[letter] != pitchClass {
+			continue
+		}
+
+		name := strings.ToLower(letter.String())
+		if keySignature[letter] != 0 {
+			name += accidentalSymbols[model.Natural]
+		}
+
+		return name
+	}
+
+	// A sharp is a semitone above the note letter, and a flat a semitone below.
+	step := int32(1)
+	if accidental == model.Flat {
+		step = -1
+	}
+
+	for _, letter := range noteLettersInOrder {
+		if (model.NoteLetterIntervals[letter]+step+12)%12 == pitchClass {
+			return strings.ToLower(letter.String()) + accidentalSymbols[accidental]
+		}
+	}
+
+	// Unreachable, as every pitch class is a note letter or next to one
+	return ""
+}
+
+// noteRespelling returns the respelling of a note, given the context in which
+// it's played, if it's written with accidentals that go against those of the
+// key signature.
+func noteRespelling(note ASTNode, context pitchContext) (Respelling, bool) {
+	accidental, ok := keyAccidental(context)
+	if !ok || len(note.Children) == 0 {
+		return Respelling{}, false
+	}
+
+	var letter model.NoteLetter
+	var letterRune rune
+	accidentals := []model.Accidental{}
+
+	for _, node := range note.Children[0].Children {
+		switch node.Type {
+		case NoteLetterNode:
+			letterRune, _ = node.Literal.(rune)
+			noteLetter, err := model.NewNoteLetter(letterRune)
+			if err != nil {
+				return Respelling{}, false
+			}
+			letter = noteLetter
+
+		case NoteAccidentalsNode:
+			for _, accidentalNode := range node.Children {
+				switch accidentalNode.Type {
+				case SharpNode:
+					accidentals = append(accidentals, model.Sharp)
+				case FlatNode:
+					accidentals = append(accidentals, model.Flat)
+				case NaturalNode:
+					accidentals = append(accidentals, model.Natural)
+				}
+			}
+		}
+	}
+
+	if letterRune == 0 {
+		return Respelling{}, false
+	}
+
+	written := string(letterRune)
+	against := false
+	pitchClass := model.NoteLetterIntervals[letter]
+
+	for _, a := range accidentals {
+		written += accidentalSymbols[a]
+
+		switch a {
+		case model.Sharp:
+			pitchClass++
+			against = against || accidental == model.Flat
+		case model.Flat:
+			pitchClass--
+			against = against || accidental == model.Sharp
+		}
+	}
+
+	if !against {
+		return Respelling{}, false
+	}
+
+	pitchClass = (pitchClass%12 + 12) % 12
+
+	return Respelling{
+		Context:       note.SourceContext,
+		Written:       written,
+		Respelled:     respell(pitchClass, accidental, context.keySignature),
+		KeyAccidental: accidental,
+	}, true
+}
+
+// FindRespellings returns the notes whose accidentals go against those of the
+// key signature in effect, e.g. `a-` or `d-` in a key with sharps, or `c+` in
+// a key with flats, along with the same pitches spelled in keeping with the
+// key signature, e.g. `g+`, `c+` and `d-`. This is a matter of style: the
+// notes sound the same either way, and either spelling can be the right one,
+// depending on the harmony.
+//
+// Only key signatures whose accidentals are all sharps or all flats are
+// considered, and the key signature of each note is worked out like the
+// octave is in CheckOctaveRange, whether it's written as note letters and
+// accidentals or as the name of a scale, e.g. `'(a major)`. So there are no
+// respellings before a key signature is set. The notes of percussion parts,
+// which stand for drums, aren't considered either. Each note is returned once,
+// even if it's played more than once.
+func FindRespellings(root ASTNode) []Respelling {
+	respellings := []Respelling{}
+	percussion := percussionParts(root)
+	found := map[*ASTNode]bool{}
+
+	var tracker *octaveTracker
+	tracker = newOctaveTracker(func(node *ASTNode, context pitchContext) {
+		if node.Type != NoteNode || found[node] ||
+			percussion[tracker.currentKey] {
+			return
+		}
+
+		if respelling, ok := noteRespelling(*node, context); ok {
+			found[node] = true
+			respellings = append(respellings, respelling)
+		}
+	})
+
+	tracker.walkRoot(&root)
+
+	return respellings
+}
+
+// DrumNameStyle is the way that the formatter writes the notes of percussion
+// parts, whose note letters and accidentals name drums rather than pitches,
+// when it respells notes (see ConfigureRespellNotes).
+type DrumNameStyle int
+
+const (
+	// DrumNamesVerbatim leaves the notes of percussion parts as they're written,
+	// so that a drum keeps the name that the author gave it. This is the
+	// default.
+	DrumNamesVerbatim DrumNameStyle = iota
+	// DrumNamesRespelled respells the notes of percussion parts like those of
+	// any other part.
+	DrumNamesRespelled
+)
+
+// pitchOfSpelling returns the number of semitones above the C of its octave of
+// a note letter and accidentals as they're written, e.g. 11 for "b" and 12 for
+// "b+".
+func pitchOfSpelling(spelling string) int32 {
+	letter, _ := model.NewNoteLetter(rune(spelling[0]))
+	pitch := model.NoteLetterIntervals[letter]
+
+	for _, symbol := range spelling[1:] {
+		switch symbol {
+		case '+':
+			pitch++
+		case '-':
+			pitch--
+		}
+	}
+
+	return pitch
+}
+
+// RespellNotes returns a copy of the AST where each note that FindRespellings
+// finds is spelled as it suggests, e.g. `a-` as `g+` in a key with sharps. The
+// original AST is left unchanged.
+//
+// A note is only respelled if it's respelled the same way everywhere it's
+// played, e.g. in a variable that's played in parts with different key
+// signatures, and if the respelling is in the same octave, so `c-` isn't
+// respelled as `b`. The notes of percussion parts are respelled or left as
+// they are, depending on the given style, and so are notes that are played by
+// both percussion and other parts.
+func RespellNotes(root ASTNode, drums DrumNameStyle) ASTNode {
+	respelled := root.Clone()
+	percussion := percussionParts(respelled)
+
+	// The respelling of each note, or "" if it's left as it is
+	spellings := map[*ASTNode]string{}
+
+	var tracker *octaveTracker
+	tracker = newOctaveTracker(func(node *ASTNode, context pitchContext) {
+		if node.Type != NoteNode {
+			return
+		}
+
+		spelling := ""
+		if respelling, ok := noteRespelling(*node, context); ok &&
+			(drums == DrumNamesRespelled || !percussion[tracker.currentKey]) &&
+			pitchOfSpelling(respelling.Written) ==
+				pitchOfSpelling(respelling.Respelled) {
+			spelling = respelling.Respelled
+		}
+
+		if previous, ok := spellings[node]; ok && previous != spelling {
+			spelling = ""
+		}
+		spellings[node] = spelling
+	})
+
+	tracker.walkRoot(&respelled)
+
+	for note, spelling := range spellings {
+		if spelling == "" {
+			continue
+		}
+
+		pitch := &note.Children[0]
+		letter := ASTNode{
+			Type:          NoteLetterNode,
+			SourceContext: pitch.Children[0].SourceContext,
+			Literal:       rune(spelling[0]),
+		}
+		pitch.Children = []ASTNode{letter}
+
+		accidentals := []ASTNode{}
+		for _, symbol := range spelling[1:] {
+			switch symbol {
+			case '+':
+				accidentals = append(accidentals, ASTNode{Type: SharpNode})
+			case '-':
+				accidentals = append(accidentals, ASTNode{Type: FlatNode})
+			case '_':
+				accidentals = append(accidentals, ASTNode{Type: NaturalNode})
+			}
+		}
+		if len(accidentals) > 0 {
+			pitch.Children = append(pitch.Children, ASTNode{
+				Type: NoteAccidentalsNode, Children: accidentals,
+			})
+		}
+	}
+
+	return respelled
+}
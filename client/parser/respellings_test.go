@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+func TestFindRespellings(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected []Respelling
+	}{
+		{
+			label:    "no key signature",
+			given:    "piano: a- g+",
+			expected: []Respelling{},
+		},
+		{
+			label:    "key signature with sharps and flats",
+			given:    "piano: (key-sig \"f+ b-\") a- g+",
+			expected: []Respelling{},
+		},
+		{
+			label: "chord in a sharp key",
+			given: "piano: (key-sig \"f+ c+\") d/g-/b-",
+			expected: []Respelling{
+				{
+					Context:       model.AldaSourceContext{Line: 1, Column: 28, Offset: 27},
+					Written:       "g-",
+					Respelled:     "f+",
+					KeyAccidental: model.Sharp,
+				},
+				{
+					Context:       model.AldaSourceContext{Line: 1, Column: 31, Offset: 30},
+					Written:       "b-",
+					Respelled:     "a+",
+					KeyAccidental: model.Sharp,
+				},
+			},
+		},
+		{
+			label: "flat key",
+			given: "piano: (key-sig '(b (flat))) g+ b+",
+			expected: []Respelling{
+				{
+					Context:       model.AldaSourceContext{Line: 1, Column: 30, Offset: 29},
+					Written:       "g+",
+					Respelled:     "a-",
+					KeyAccidental: model.Flat,
+				},
+				{
+					Context:       model.AldaSourceContext{Line: 1, Column: 33, Offset: 32},
+					Written:       "b+",
+					Respelled:     "c",
+					KeyAccidental: model.Flat,
+				},
+			},
+		},
+		{
+			label: "key signature written as the name of a scale",
+			given: "piano: (key-sig '(g minor)) a+ d+",
+			expected: []Respelling{
+				{
+					Context:       model.AldaSourceContext{Line: 1, Column: 29, Offset: 28},
+					Written:       "a+",
+					Respelled:     "b-",
+					KeyAccidental: model.Flat,
+				},
+				{
+					Context:       model.AldaSourceContext{Line: 1, Column: 32, Offset: 31},
+					Written:       "d+",
+					Respelled:     "e-",
+					KeyAccidental: model.Flat,
+				},
+			},
+		},
+	} {
+		ast, err := Parse("", testCase.given)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+
+		actual := FindRespellings(ast)
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf(
+				"%s\nexpected: %#v\nactual: %#v",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+func TestRespellNotesLeavesOriginal(t *testing.T) {
+	ast, err := Parse("", "piano: (key-sig \"b-\") g+ b+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := ast.Clone()
+
+	respelled := RespellNotes(ast, DrumNamesVerbatim)
+	if !reflect.DeepEqual(ast, original) {
+		t.Error("the original AST was changed")
+	}
+
+	// b+ would be respelled as the c of the next octave, so it's left as it is.
+	expected := "piano:\n  (key-sig \"b-\") a- b+\n"
+	buffer := bytes.Buffer{}
+	if err := FormatASTToCode(respelled, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	if actual := buffer.String(); actual != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,648 @@
+package parser
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"alda.io/client/model"
+)
+
+// A Rational is a fraction, e.g. {Numerator: 2, Denominator: 3} for two thirds.
+type Rational struct {
+	Numerator, Denominator int64
+}
+
+func (r Rational) String() string {
+	return fmt.Sprintf("%d/%d", r.Numerator, r.Denominator)
+}
+
+// maxScaledDenominator is the largest denominator of the note lengths that a
+// scaled note length is split into when it can't be written as a single note
+// length (see ScaleDurations).
+const maxScaledDenominator = 256
+
+// The attribute changes that set the default duration of a part, keyed by
+// name, without the `!` of a global change
+var durationAttributes = map[string]bool{
+	"set-duration": true, "set-duration-ms": true, "set-note-length": true,
+}
+
+// ScaleDurations returns a copy of the AST where every duration lasts the given
+// factor times as long, e.g. a factor of 2 turns quarter notes into half notes
+// (augmentation) and a factor of 1/2 turns them into eighth notes
+// (diminution). The original AST is left unchanged. Tempos and time
+// signatures are left as they are, so the score as a whole lasts the factor
+// times as long.
+//
+// A note length is scaled by scaling its denominator, keeping its dots, e.g.
+// `4..` scaled by 2/3 is `6..`. Where that doesn't give a whole number, it's
+// written as a single note length with dots if it can be, e.g. `4` scaled by
+// 3/2 is `4.`, and otherwise as note lengths tied together, e.g. `4` scaled by
+// 5/4 is `4~16`. Note lengths in milliseconds and seconds are multiplied by
+// the factor. So are the arguments of attribute changes that set the default
+// duration, e.g. `(set-note-length 8)`, except that a number of beats that
+// would be less than 1, which can't be written, is written as a note length
+// instead, e.g. `(set-duration 1)` scaled by 1/2 is `(set-note-length 8)`. The
+// number of measures of a multi-measure rest is multiplied too, and where that
+// doesn't give a whole number, it's expanded into rests (see
+// ExpandMultiMeasureRests).
+//
+// The outer duration of a cram expression is scaled, while the durations of
+// its events, which are relative to each other, are left as they are, unless
+// it starts with events without durations, which take the duration in effect
+// before it, e.g. `{c d4}`, in which case they're all scaled. If a part might
+// play a note with the default duration of a part, i.e. a quarter note, an
+// attribute change that sets its duration to the scaled default, e.g.
+// `(set-note-length 2)`, is added at the start of its first declaration,
+// unless the score starts by setting the duration of every part, e.g. with
+// `(set-duration! 3)`.
+//
+// Returns an error if the factor isn't positive, a note length can't be
+// written as note lengths tied together with denominators of at most 256 once
+// it's scaled, e.g. `4` scaled by 3/257, or a default duration in
+// milliseconds would be less than 1 ms.
+func ScaleDurations(root ASTNode, factor Rational) (ASTNode, error) {
+	if factor.Numerator <= 0 || factor.Denominator <= 0 {
+		return ASTNode{}, fmt.Errorf(
+			"invalid factor %s: it must be positive", factor,
+		)
+	}
+
+	scaler := durationScaler{
+		factor: big.NewRat(factor.Numerator, factor.Denominator),
+		text:   factor.String(),
+	}
+
+	scaled := root.Clone()
+
+	for _, rest := range scaled.FindByType(MultiMeasureRestNode) {
+		measures, _ := rest.Node.Literal.(int32)
+		if !scaler.scaleRat(new(big.Rat).SetInt64(int64(measures))).IsInt() {
+			scaled = ExpandMultiMeasureRests(scaled)
+			break
+		}
+	}
+
+	if err := scaler.scale(&scaled); err != nil {
+		return ASTNode{}, err
+	}
+
+	if factor.Numerator != factor.Denominator &&
+		!setsGlobalDuration(scaled) {
+		if err := scaler.setDefaultDurations(&scaled); err != nil {
+			return ASTNode{}, err
+		}
+	}
+
+	return scaled, nil
+}
+
+type durationScaler struct {
+	factor *big.Rat
+	// The factor as it's written in errors, e.g. "2/3"
+	text string
+}
+
+// scaleRat returns a number multiplied by the factor.
+func (s durationScaler) scaleRat(number *big.Rat) *big.Rat {
+	return new(big.Rat).Mul(number, s.factor)
+}
+
+// scaleFloat returns a number multiplied by the factor, as near as a float64
+// can get to it.
+func (s durationScaler) scaleFloat(number float64) float64 {
+	scaled, _ := s.scaleRat(decimalRat(number)).Float64()
+	return scaled
+}
+
+// scale scales the durations within a node.
+func (s durationScaler) scale(node *ASTNode) error {
+	switch node.Type {
+	case DurationNode:
+		components := []ASTNode{}
+		for _, component := range node.Children {
+			scaled, err := s.scaleComponent(component)
+			if err != nil {
+				return err
+			}
+			components = append(components, scaled...)
+		}
+		node.Children = components
+		return nil
+
+	case CramNode:
+		// The events of a cram expression are only scaled if they take the
+		// duration in effect before it, to keep them in proportion.
+		if !startsWithoutDuration(node.Children[0].Children) {
+			for i := range node.Children[1:] {
+				if err := s.scale(&node.Children[1+i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+	case MultiMeasureRestNode:
+		measures, _ := node.Literal.(int32)
+		scaled := s.scaleRat(new(big.Rat).SetInt64(int64(measures)))
+		node.Literal = int32(scaled.Num().Int64())
+		return nil
+
+	case LispListNode:
+		if isDurationAttribute(*node) {
+			return s.scaleDurationAttribute(node)
+		}
+	}
+
+	for i := range node.Children {
+		if err := s.scale(&node.Children[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scaleComponent returns the scaled components of a duration that replace one
+// of its components.
+func (s durationScaler) scaleComponent(component ASTNode) ([]ASTNode, error) {
+	switch component.Type {
+	case NoteLengthNode:
+		return s.scaleNoteLength(component)
+
+	case NoteLengthMsNode, NoteLengthSecondsNode:
+		number, _ := component.Literal.(float64)
+		scaled := component
+		scaled.Literal = s.scaleFloat(number)
+		return []ASTNode{scaled}, nil
+	}
+
+	return []ASTNode{component}, nil
+}
+
+// scaleNoteLength returns the note lengths, tied together, that last the
+// factor times as long as a note length (see ScaleDurations).
+func (s durationScaler) scaleNoteLength(noteLength ASTNode) ([]ASTNode, error) {
+	denominator, _ := noteLength.Children[0].Literal.(float64)
+	dots := int32(0)
+	if len(noteLength.Children) > 1 {
+		dots, _ = noteLength.Children[1].Literal.(int32)
+	}
+
+	// The denominator, scaled, with the same dots, e.g. `4..` scaled by 2/3 is
+	// `6..`
+	scaledDenominator := new(big.Rat).Quo(decimalRat(denominator), s.factor)
+	if scaledDenominator.IsInt() {
+		return []ASTNode{
+			newNoteLength(scaledDenominator, dots, noteLength.SourceContext),
+		}, nil
+	}
+
+	// The length in whole notes, scaled
+	length := s.scaleRat(new(big.Rat).Quo(
+		dottedFactor(dots), decimalRat(denominator),
+	))
+
+	noteLengths, ok := noteLengthsOf(length, noteLength.SourceContext)
+	if !ok {
+		return nil, noteLength.errorf(
+			"can't scale the note length %s by %s, as it can't be written as "+
+				"note lengths tied together once it's scaled",
+			noteLengthText(noteLength), s.text,
+		)
+	}
+
+	return noteLengths, nil
+}
+
+// newNoteLength returns a NoteLengthNode with the given denominator and dots.
+func newNoteLength(
+	denominator *big.Rat, dots int32, sourceContext model.AldaSourceContext,
+) ASTNode {
+	value, _ := denominator.Float64()
+	node := ASTNode{
+		Type:          NoteLengthNode,
+		SourceContext: sourceContext,
+		Children: []ASTNode{{
+			Type: DenominatorNode, SourceContext: sourceContext, Literal: value,
+		}},
+	}
+	if dots > 0 {
+		node.Children = append(node.Children, ASTNode{
+			Type: DotsNode, SourceContext: sourceContext, Literal: dots,
+		})
+	}
+	return node
+}
+
+// noteLengthsOf returns the note lengths, tied together, that last the given
+// number of whole notes, and whether it can be written as note lengths with
+// denominators of at most maxScaledDenominator.
+func noteLengthsOf(
+	length *big.Rat, sourceContext model.AldaSourceContext,
+) ([]ASTNode, bool) {
+	// A single note length, e.g. 3/8 is `4.`, with dots only if its denominator
+	// is a power of 2, as the likes of `6...` are hard to read
+	for dots := int32(0); dots <= 3; dots++ {
+		denominator := new(big.Rat).Quo(dottedFactor(dots), length)
+		value, _ := denominator.Float64()
+		if denominator.IsInt() && (dots == 0 || isPowerOfTwo(value)) {
+			return []ASTNode{newNoteLength(denominator, dots, sourceContext)}, true
+		}
+	}
+
+	// Note lengths tied together: whole notes, and then, for the rest of the
+	// length, n/(2^a * m) with m odd, a note length for each power of 2 that
+	// makes up n, e.g. 5/16 is `4~16`, as it's (4+1)/16, and 5/12 is `3~12`,
+	// as it's (4+1)/(4*3).
+	noteLengths := []ASTNode{}
+	appendNoteLengths := func(denominator *big.Int, count int64) bool {
+		if denominator.Cmp(big.NewInt(maxScaledDenominator)) > 0 {
+			return false
+		}
+
+		for i := int64(0); i < count; i++ {
+			noteLengths = append(noteLengths, newNoteLength(
+				new(big.Rat).SetInt(denominator), 0, sourceContext,
+			))
+		}
+		return true
+	}
+
+	wholeNotes, rest := new(big.Int).QuoRem(
+		length.Num(), length.Denom(), new(big.Int),
+	)
+	appendNoteLengths(big.NewInt(1), wholeNotes.Int64())
+
+	a := length.Denom().TrailingZeroBits()
+	m := new(big.Int).Rsh(length.Denom(), a)
+	for b := rest.BitLen() - 1; b >= 0; b-- {
+		if rest.Bit(b) == 0 {
+			continue
+		}
+
+		var ok bool
+		if uint(b) <= a {
+			ok = appendNoteLengths(new(big.Int).Lsh(m, a-uint(b)), 1)
+		} else {
+			ok = appendNoteLengths(m, int64(1)<<(uint(b)-a))
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return simplifyDurationComponents(noteLengths), true
+}
+
+// scaleDurationAttribute scales the argument of an attribute change that sets
+// the default duration, e.g. `(set-note-length 8)`.
+func (s durationScaler) scaleDurationAttribute(node *ASTNode) error {
+	name, _ := node.Children[0].Literal.(string)
+	argument := &node.Children[1]
+
+	switch strings.TrimSuffix(name, "!") {
+	case "set-duration", "set-duration-ms":
+		number, ok := argument.Literal.(float64)
+		if argument.Type != LispNumberNode || !ok {
+			return node.errorf("can't scale the argument of %s", name)
+		}
+
+		scaled := s.scaleRat(decimalRat(number))
+		if scaled.Cmp(big.NewRat(1, 1)) >= 0 {
+			argument.Literal = s.scaleFloat(number)
+			return nil
+		}
+
+		// Less than 1 beat or millisecond can't be written, as the argument has
+		// to be at least 1, but a number of beats can be written as a note
+		// length, e.g. 1/2 a beat is an eighth note.
+		if strings.TrimSuffix(name, "!") == "set-duration-ms" {
+			return node.errorf(
+				"can't scale (%s %s) by %s, as it would be less than 1 ms",
+				name, strconv.FormatFloat(number, 'f', -1, 64), s.text,
+			)
+		}
+
+		noteLengths, ok := noteLengthsOf(
+			new(big.Rat).Quo(scaled, big.NewRat(4, 1)), argument.SourceContext,
+		)
+		if !ok {
+			return node.errorf(
+				"can't scale (%s %s) by %s, as it can't be written as note "+
+					"lengths tied together once it's scaled",
+				name, strconv.FormatFloat(number, 'f', -1, 64), s.text,
+			)
+		}
+
+		node.Children[0].Literal = strings.Replace(
+			name, "set-duration", "set-note-length", 1,
+		)
+		*argument = durationArgument(noteLengths)
+		return nil
+	}
+
+	// The argument is a note length, either a number, i.e. its denominator, or
+	// a string, e.g. "2.." or "1~1".
+	var duration ASTNode
+	switch argument.Type {
+	case LispNumberNode:
+		duration = ASTNode{
+			Type: DurationNode,
+			Children: []ASTNode{{
+				Type: NoteLengthNode,
+				Children: []ASTNode{
+					{Type: DenominatorNode, Literal: argument.Literal},
+				},
+			}},
+		}
+
+	case LispStringNode:
+		text, _ := argument.Literal.(string)
+		note, err := Parse("", "c"+text, SuppressSourceContext)
+		if err != nil || len(note.FindByType(NoteNode)) != 1 ||
+			len(note.FindByType(DurationNode)) != 1 {
+			return node.errorf("can't scale the argument of %s", name)
+		}
+		duration = note.FindByType(DurationNode)[0].Node
+
+	default:
+		return node.errorf("can't scale the argument of %s", name)
+	}
+
+	if err := s.scale(&duration); err != nil {
+		return node.errorf("%s", err)
+	}
+
+	*argument = durationArgument(duration.Children)
+	return nil
+}
+
+// setDefaultDurations adds an attribute change that sets the scaled default
+// duration to the start of the first declaration of each part that might play
+// a note with the default duration (see ScaleDurations). It's a change of each
+// part, rather than a global one, as a global change is only applied once a
+// part plays a note, and the duration that a cram expression restores once
+// it's played is the one before the global change.
+//
+// A group that's declared along with parts that were declared before, e.g.
+// `piano/violin:` after `piano:`, can't set the duration of all of its
+// members, so the new ones, i.e. `violin:`, are declared before it to set
+// theirs.
+func (s durationScaler) setDefaultDurations(root *ASTNode) error {
+	setDefault, err := s.defaultDurationChange()
+	if err != nil {
+		return err
+	}
+
+	declared := map[string]bool{}
+	aliases := map[string][]string{}
+	parts := []ASTNode{}
+
+	for _, part := range root.Children {
+		if part.Type != PartNode || len(part.Children) < 2 {
+			parts = append(parts, part)
+			continue
+		}
+
+		instruments := declaredInstruments(part.Children[0], aliases)
+		newInstruments := map[string]bool{}
+		for _, instrument := range instruments {
+			if !declared[instrument] {
+				declared[instrument] = true
+				newInstruments[instrument] = true
+			}
+		}
+
+		events := &part.Children[len(part.Children)-1]
+		switch {
+		case len(newInstruments) == 0 ||
+			!startsWithoutDuration(events.Children):
+
+		case len(newInstruments) == len(instruments):
+			events.Children = append(
+				[]ASTNode{setDefault.Clone()}, events.Children...,
+			)
+
+		default:
+			// The members that are new are named as they are, rather than through
+			// an alias, which was declared before.
+			newNames := []ASTNode{}
+			for _, name := range part.Children[0].Children[0].Children {
+				if literal, _ := name.Literal.(string); newInstruments[literal] {
+					newNames = append(newNames, name)
+				}
+			}
+
+			parts = append(parts, ASTNode{
+				Type: PartNode,
+				Children: []ASTNode{
+					{
+						Type:     PartDeclarationNode,
+						Children: []ASTNode{{Type: PartNamesNode, Children: newNames}},
+					},
+					{Type: EventSequenceNode, Children: []ASTNode{setDefault.Clone()}},
+				},
+			})
+		}
+
+		parts = append(parts, part)
+	}
+
+	root.Children = parts
+	return nil
+}
+
+// declaredInstruments returns the instruments of a part declaration, known by
+// their names, or their aliases if they have one of their own, and records the
+// alias of the declaration, e.g. `violin` and `viola` for `strings:` after
+// `violin/viola "strings":`, or `v1` for `v1:` after `violin "v1":`. A member
+// of a group, e.g. `strings.violin`, is the instrument of that name.
+func declaredInstruments(decl ASTNode, aliases map[string][]string) []string {
+	if len(decl.Children) == 0 {
+		return nil
+	}
+
+	instruments := []string{}
+	for _, nameNode := range decl.Children[0].Children {
+		name, _ := nameNode.Literal.(string)
+		if members, ok := aliases[name]; ok {
+			instruments = append(instruments, members...)
+			continue
+		}
+
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			if _, ok := aliases[name[:i]]; ok {
+				name = name[i+1:]
+			}
+		}
+		instruments = append(instruments, name)
+	}
+
+	if len(decl.Children) > 1 {
+		if alias, ok := decl.Children[1].Literal.(string); ok {
+			if len(instruments) == 1 {
+				instruments = []string{alias}
+			}
+			aliases[alias] = instruments
+		}
+	}
+
+	return instruments
+}
+
+// defaultDurationChange returns an attribute change that sets the default
+// duration of a part to the scaled default duration, i.e. a quarter note.
+func (s durationScaler) defaultDurationChange() (ASTNode, error) {
+	quarter := ASTNode{
+		Type: NoteLengthNode,
+		Children: []ASTNode{
+			{Type: DenominatorNode, Literal: 4.0},
+		},
+	}
+
+	noteLengths, err := s.scaleNoteLength(quarter)
+	if err != nil {
+		return ASTNode{}, err
+	}
+
+	return ASTNode{
+		Type: LispListNode,
+		Children: []ASTNode{
+			{Type: LispSymbolNode, Literal: "set-note-length"},
+			durationArgument(noteLengths),
+		},
+	}, nil
+}
+
+// durationArgument returns the argument of a set-note-length attribute change
+// that sets the given note lengths: a number if it's a single note length
+// without dots, e.g. `2`, and otherwise a string, e.g. `"4~16"`.
+func durationArgument(noteLengths []ASTNode) ASTNode {
+	if len(noteLengths) == 1 && len(noteLengths[0].Children) == 1 {
+		return ASTNode{
+			Type: LispNumberNode, Literal: noteLengths[0].Children[0].Literal,
+		}
+	}
+
+	texts := []string{}
+	for _, noteLength := range noteLengths {
+		texts = append(texts, noteLengthText(noteLength))
+	}
+
+	return ASTNode{Type: LispStringNode, Literal: strings.Join(texts, "~")}
+}
+
+// noteLengthText returns a NoteLengthNode as it's written, e.g. "4..".
+func noteLengthText(noteLength ASTNode) string {
+	denominator, _ := noteLength.Children[0].Literal.(float64)
+	dots := int32(0)
+	if len(noteLength.Children) > 1 {
+		dots, _ = noteLength.Children[1].Literal.(int32)
+	}
+
+	return strconv.FormatFloat(denominator, 'f', -1, 64) +
+		strings.Repeat(".", int(dots))
+}
+
+// isDurationAttribute reports whether a node is an attribute change that sets
+// the default duration, with a single argument, e.g. `(set-note-length! 8)`.
+func isDurationAttribute(node ASTNode) bool {
+	if len(node.Children) != 2 || node.Children[0].Type != LispSymbolNode {
+		return false
+	}
+
+	name, _ := node.Children[0].Literal.(string)
+	return durationAttributes[strings.TrimSuffix(name, "!")]
+}
+
+// setsGlobalDuration reports whether a score starts by setting the duration of
+// every part, i.e. it has a global attribute change that sets the default
+// duration, e.g. `(set-duration! 3)`, before the first part declaration.
+func setsGlobalDuration(root ASTNode) bool {
+	if len(root.Children) == 0 || root.Children[0].Type != ImplicitPartNode ||
+		len(root.Children[0].Children) == 0 {
+		return false
+	}
+
+	for _, event := range root.Children[0].Children[0].Children {
+		if event.Type != LispListNode || !isDurationAttribute(event) {
+			continue
+		}
+
+		if name, _ := event.Children[0].Literal.(string); strings.HasSuffix(
+			name, "!",
+		) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startsWithoutDuration reports whether a sequence of events might play a
+// note, rest or cram expression without a duration before setting the
+// duration.
+func startsWithoutDuration(events []ASTNode) bool {
+	withoutDuration, _ := firstDuration(events)
+	return withoutDuration
+}
+
+// firstDuration returns whether the first event of a sequence of events that
+// determines its duration, if there is one, goes without a duration, and
+// whether there is one. Events whose durations can't be determined from the
+// AST, e.g. variable references, are assumed to go without.
+func firstDuration(events []ASTNode) (bool, bool) {
+	for _, event := range events {
+		switch event.Type {
+		case NoteNode, RestNode:
+			return len(event.FindByType(DurationNode)) == 0, true
+
+		case CramNode:
+			return len(event.Children) < 2, true
+
+		case VariableReferenceNode:
+			return true, true
+
+		case LispListNode:
+			if isDurationAttribute(event) {
+				return false, true
+			}
+
+		case VoiceGroupNode:
+			for _, voice := range event.Children {
+				if withoutDuration, ok := firstDuration(voice.Children); withoutDuration ||
+					!ok {
+					return true, true
+				}
+			}
+			return false, true
+
+		case EventSequenceNode, ChordNode, RepeatNode, OnRepetitionsNode,
+			TupletNode, VoiceNode:
+			if withoutDuration, ok := firstDuration(event.Children); ok {
+				return withoutDuration, true
+			}
+		}
+	}
+
+	return false, false
+}
+
+// decimalRat returns a number as the decimal fraction that it's written as,
+// e.g. 0.1 as 1/10 rather than the nearest binary fraction.
+func decimalRat(number float64) *big.Rat {
+	rat, _ := new(big.Rat).SetString(strconv.FormatFloat(number, 'f', -1, 64))
+	return rat
+}
+
+// dottedFactor returns the number of times as long as the undotted note length
+// that a note length with the given number of dots lasts, i.e. 2 - 2^-dots.
+func dottedFactor(dots int32) *big.Rat {
+	power := new(big.Int).Lsh(big.NewInt(1), uint(dots))
+	return new(big.Rat).SetFrac(
+		new(big.Int).Sub(new(big.Int).Lsh(power, 1), big.NewInt(1)), power,
+	)
+}
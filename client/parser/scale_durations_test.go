@@ -0,0 +1,342 @@
+package parser
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+// scaleDurationsToCode scales the durations of source code and formats the
+// result.
+func scaleDurationsToCode(given string, factor Rational) (string, error) {
+	ast, err := Parse("piece.alda", given)
+	if err != nil {
+		return "", err
+	}
+
+	scaled, err := ScaleDurations(ast, factor)
+	if err != nil {
+		return "", err
+	}
+
+	buffer := bytes.Buffer{}
+	if err := FormatASTToCode(scaled, &buffer); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+func TestScaleDurations(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		factor   Rational
+		expected string
+	}{
+		{
+			label:    "augmentation",
+			given:    "piano: c4 d8 e2.",
+			factor:   Rational{2, 1},
+			expected: "piano:\n  c2 d4 e1.\n",
+		},
+		{
+			label:    "diminution",
+			given:    "piano: c4 d8 e2.",
+			factor:   Rational{1, 2},
+			expected: "piano:\n  c8 d16 e4.\n",
+		},
+		{
+			label:    "dots kept",
+			given:    "piano: c4...",
+			factor:   Rational{2, 3},
+			expected: "piano:\n  c6...\n",
+		},
+		{
+			label:    "dots added",
+			given:    "piano: c4",
+			factor:   Rational{3, 2},
+			expected: "piano:\n  c4.\n",
+		},
+		{
+			label:    "tied note lengths",
+			given:    "piano: c4 d1 e4..",
+			factor:   Rational{5, 4},
+			expected: "piano:\n  c4~16 d1~4 e2~32.\n",
+		},
+		{
+			label:    "tied tuplet note lengths",
+			given:    "piano: c4",
+			factor:   Rational{5, 3},
+			expected: "piano:\n  c3~12\n",
+		},
+		{
+			label:    "milliseconds and seconds",
+			given:    "piano: c500ms d2s",
+			factor:   Rational{3, 2},
+			expected: "piano:\n  c750ms d3s\n",
+		},
+		{
+			label:    "crams",
+			given:    "piano: c2 {c d e}2 {e4 f8}4 {c d4}",
+			factor:   Rational{2, 1},
+			expected: "piano:\n  c1 { c d e }1 { e4 f8 }2 { c d2 }\n",
+		},
+		{
+			label:  "default duration",
+			given:  "piano: c d\nviolin: e4 f\npiano: g",
+			factor: Rational{2, 1},
+			expected: "piano:\n  (set-note-length 2) c d\n\n" +
+				"violin:\n  e2 f\n\npiano:\n  g\n",
+		},
+		{
+			label:    "default duration set globally",
+			given:    "(set-duration! 3)\n\npiano: c d",
+			factor:   Rational{2, 1},
+			expected: "(set-duration! 6)\n\npiano:\n  c d\n",
+		},
+		{
+			label:    "duration attribute shorter than a beat",
+			given:    "piano: (set-duration 1) c (set-duration 1.5) d",
+			factor:   Rational{1, 2},
+			expected: "piano:\n  (set-note-length 8) c (set-note-length \"8.\") d\n",
+		},
+		{
+			label:    "duration attributes",
+			given:    "piano: (set-note-length 8) c (set-duration 3) d",
+			factor:   Rational{3, 2},
+			expected: "piano:\n  (set-note-length \"8.\") c (set-duration 4.5) d\n",
+		},
+		{
+			label:    "multi-measure rests",
+			given:    "piano: c1 | R*2",
+			factor:   Rational{3, 2},
+			expected: "piano:\n  c1. | R*3\n",
+		},
+		{
+			label:    "multi-measure rests expanded",
+			given:    "piano: c1 | R*2",
+			factor:   Rational{1, 4},
+			expected: "piano:\n  c4 | r4 | r4\n",
+		},
+	} {
+		actual, err := scaleDurationsToCode(testCase.given, testCase.factor)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.label, err)
+			continue
+		}
+
+		if actual != testCase.expected {
+			t.Errorf(
+				"%s\nexpected:\n%q\nactual:\n%q",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+// scoreDurationMs returns the length of the score that source code plays.
+func scoreDurationMs(t *testing.T, code string) float64 {
+	ast, err := Parse("piece.alda", code)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+
+	updates, err := ast.Updates()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+
+	score := model.NewScore()
+	if err := score.Update(updates...); err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+
+	return score.DurationMs()
+}
+
+// A score with scaled durations lasts exactly the factor times as long.
+func TestScaleDurationsScoreDuration(t *testing.T) {
+	for _, given := range []string{
+		"piano: c d e f",
+		"piano: c8 d e4. f2 | g1~2 r4 c500ms d1s",
+		"riff = c8 d\npiano: riff e f riff",
+		"piano: (set-note-length 8) c d {c d e}4 {e f4 g}2 c2 {c d4}\n" +
+			"violin: o3 [c8 d]*3 V1: e4 f V2: g2 V0: a",
+		"piano: (tempo 90) c4.. d16 e6 f6 g6 | R*2 | a1",
+		"(set-duration! 3) piano: c (set-duration-ms 300) d\nviolin: e",
+	} {
+		original := scoreDurationMs(t, given)
+
+		for _, factor := range []Rational{
+			{2, 1}, {1, 2}, {3, 2}, {2, 3}, {5, 4}, {3, 1},
+		} {
+			code, err := scaleDurationsToCode(given, factor)
+			if err != nil {
+				t.Errorf("%s (by %s): %v", given, factor, err)
+				continue
+			}
+
+			expected := original * float64(factor.Numerator) /
+				float64(factor.Denominator)
+			actual := scoreDurationMs(t, code)
+			if math.Abs(actual-expected) > 1e-6 {
+				t.Errorf(
+					"%s (by %s): expected %f ms, got %f ms\n%s",
+					given, factor, expected, actual, code,
+				)
+			}
+		}
+	}
+}
+
+// noteTimings returns the offset and duration of each note that source code
+// plays, in ms, in order, as the notes of a group are played in the order in
+// which its parts were first declared.
+func noteTimings(t *testing.T, code string) [][2]float64 {
+	ast, err := Parse("piece.alda", code)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+
+	updates, err := ast.Updates()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+
+	score := model.NewScore()
+	if err := score.Update(updates...); err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+
+	timings := [][2]float64{}
+	for _, event := range score.Events {
+		if note, ok := event.(model.NoteEvent); ok {
+			timings = append(timings, [2]float64{note.Offset, note.Duration})
+		}
+	}
+
+	sort.Slice(timings, func(i, j int) bool {
+		if math.Abs(timings[i][0]-timings[j][0]) > 1e-6 {
+			return timings[i][0] < timings[j][0]
+		}
+		return timings[i][1] < timings[j][1]
+	})
+
+	return timings
+}
+
+// Every note of a score with scaled durations starts and lasts exactly the
+// factor times as long.
+func TestScaleDurationsNoteTimings(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	examplesDir := filepath.Join(filepath.Dir(filepath.Dir(dir)), "examples")
+
+	multiPoly, err := os.ReadFile(filepath.Join(examplesDir, "multi-poly.alda"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, given := range []string{
+		"piano: {c c} {c c}",
+		"piano: {c c}2 {c d e} f\nviolin: {c c} c",
+		"piano: (set-note-length 4) c d\nviolin: (set-duration 1) e",
+		"piano: (set-duration 3) c\npiano/violin: d e\nviolin: f",
+		"piano \"upper\": c\npiano \"lower\": (set-duration 2) d\nupper: e",
+		"violin/viola \"strings\": c\nstrings.violin: d2\nstrings: e",
+		string(multiPoly),
+	} {
+		original := noteTimings(t, given)
+
+		for _, factor := range []Rational{{2, 1}, {1, 2}, {3, 2}, {1, 4}} {
+			code, err := scaleDurationsToCode(given, factor)
+			if err != nil {
+				t.Errorf("%s (by %s): %v", given, factor, err)
+				continue
+			}
+
+			scaled := noteTimings(t, code)
+			if len(scaled) != len(original) {
+				t.Errorf(
+					"%s (by %s): expected %d notes, got %d\n%s",
+					given, factor, len(original), len(scaled), code,
+				)
+				continue
+			}
+
+			ratio := float64(factor.Numerator) / float64(factor.Denominator)
+			for i := range original {
+				if math.Abs(scaled[i][0]-original[i][0]*ratio) > 1e-6 ||
+					math.Abs(scaled[i][1]-original[i][1]*ratio) > 1e-6 {
+					t.Errorf(
+						"%s (by %s): note %d at %v ms, for %v ms, rather than %v ms, "+
+							"for %v ms\n%s",
+						given, factor, i, scaled[i][0], scaled[i][1],
+						original[i][0]*ratio, original[i][1]*ratio, code,
+					)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestScaleDurationsErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		factor   Rational
+		expected string
+	}{
+		{
+			label:    "zero",
+			given:    "piano: c",
+			factor:   Rational{0, 1},
+			expected: "invalid factor 0/1: it must be positive",
+		},
+		{
+			label:    "no denominator",
+			given:    "piano: c",
+			factor:   Rational{1, 0},
+			expected: "invalid factor 1/0: it must be positive",
+		},
+		{
+			label:  "duration in milliseconds shorter than 1 ms",
+			given:  "piano: (set-duration-ms 1) c",
+			factor: Rational{1, 2},
+			expected: "piece.alda:1:8 can't scale (set-duration-ms 1) by 1/2, as " +
+				"it would be less than 1 ms",
+		},
+		{
+			label:  "note length that can't be written",
+			given:  "piano: c4",
+			factor: Rational{3, 257},
+			expected: "piece.alda:1:9 can't scale the note length 4 by 3/257, as " +
+				"it can't be written as note lengths tied together once it's " +
+				"scaled",
+		},
+	} {
+		_, err := scaleDurationsToCode(testCase.given, testCase.factor)
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.label)
+			continue
+		}
+
+		if err.Error() != testCase.expected {
+			t.Errorf(
+				"%s\nexpected: %s\nactual: %s",
+				testCase.label, testCase.expected, err,
+			)
+		}
+	}
+}
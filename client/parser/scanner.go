@@ -1,10 +1,14 @@
 package parser
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	log "alda.io/client/logging"
 	model "alda.io/client/model"
@@ -63,6 +67,7 @@ const (
 	AtMarker
 	Barline
 	Colon
+	Comment
 	CramClose
 	CramOpen
 	EOF
@@ -70,9 +75,11 @@ const (
 	EventSeqClose
 	EventSeqOpen
 	Flat
+	Glissando
 	Integer
 	LeftParen
 	Marker
+	MultiMeasureRest
 	Name
 	Natural
 	NoteLength
@@ -92,18 +99,55 @@ const (
 	String
 	Symbol
 	Tie
+	TimeSignature
+	TupletRatio
 	Repeat
 	VoiceMarker
+	Whitespace
 )
 
+// IsTrivia returns true for the token types that have no effect on the meaning
+// of a score, i.e. comments and whitespace. The scanner only emits trivia
+// tokens when the IncludeTrivia option is used.
+func (tt TokenType) IsTrivia() bool {
+	return tt == Comment || tt == Whitespace
+}
+
 // A Token is a result of lexical analysis done by the scanner.
 type Token struct {
 	sourceContext model.AldaSourceContext
+	endContext    model.AldaSourceContext
 	tokenType     TokenType
 	text          string
 	literal       interface{}
 }
 
+// Type returns the type of the token.
+func (t Token) Type() TokenType {
+	return t.tokenType
+}
+
+// Text returns the text of the token, exactly as it appears in the input.
+func (t Token) Text() string {
+	return t.text
+}
+
+// Literal returns the value of the token, if it has one, e.g. the rune of a
+// note letter, the int32 of an octave set, or the contents of a string.
+func (t Token) Literal() interface{} {
+	return t.literal
+}
+
+// Start returns the position of the first character of the token.
+func (t Token) Start() model.AldaSourceContext {
+	return t.sourceContext
+}
+
+// End returns the position just after the last character of the token.
+func (t Token) End() model.AldaSourceContext {
+	return t.endContext
+}
+
 func (tt TokenType) String() string {
 	switch tt {
 	case Alias:
@@ -114,6 +158,8 @@ func (tt TokenType) String() string {
 		return "barline"
 	case Colon:
 		return "colon"
+	case Comment:
+		return "comment"
 	case CramClose:
 		return "end of cram expression"
 	case CramOpen:
@@ -128,12 +174,16 @@ func (tt TokenType) String() string {
 		return "start of event sequence"
 	case Flat:
 		return "flat"
+	case Glissando:
+		return "glissando"
 	case Integer:
 		return "integer"
 	case LeftParen:
 		return "open parenthesis"
 	case Marker:
 		return "marker"
+	case MultiMeasureRest:
+		return "multi-measure rest"
 	case Name:
 		return "name"
 	case Natural:
@@ -174,8 +224,14 @@ func (tt TokenType) String() string {
 		return "symbol"
 	case Tie:
 		return "tie"
+	case TimeSignature:
+		return "time signature"
+	case TupletRatio:
+		return "tuplet ratio"
 	case VoiceMarker:
 		return "voice marker"
+	case Whitespace:
+		return "whitespace"
 	default:
 		return fmt.Sprintf("%d (String not implemented)", tt)
 	}
@@ -200,16 +256,50 @@ type scanner struct {
 	current     int
 	line        int
 	column      int
+	offset      int // byte offset of the current rune
 	startLine   int
 	startColumn int
+	startOffset int
 	sexpLevel   int
+	errors      []*model.AldaSourceError
+	trivia      bool // whether to emit Comment and Whitespace tokens
+
+	// Whether the input is read as it's scanned (see newReaderScanner)
+	reading bool
+	// The reader from which input is read, until EOF or an error
+	reader *bufio.Reader
+	// The error that stopped reading, as a *ReadError
+	readErr error
+	// The position in the input up to which it's been read
+	readContext model.AldaSourceContext
+	// When reading, the input isn't kept once it's scanned, so the text between
+	// tokens (other than trivia) is kept wherever it can't be worked out from
+	// their positions (see plainGap), e.g. where there's a comment, keyed by the
+	// offset of the token after it. Together with the text of the tokens, that's
+	// enough to put any part of the input back together (see
+	// parser.skippedText).
+	gaps map[int]string
+	// The text since the end of the last token that isn't trivia, and its end
+	gap     []rune
+	lastEnd model.AldaSourceContext
 }
 
+// discardThreshold is the number of runes that a scanner reading from a reader
+// keeps before the start of the current lexeme, before discarding them.
+const discardThreshold = 4096
+
 func newScanner(filename string, input string) *scanner {
+	return newRuneScanner(filename, []rune(input))
+}
+
+func newRuneScanner(filename string, input []rune) *scanner {
 	return &scanner{
-		filename:  filename,
-		input:     []rune(input),
-		tokens:    []Token{},
+		filename: filename,
+		input:    input,
+		// Typical Alda code has about one token for every two characters, so we
+		// allocate room for that many up front rather than growing the slice (and
+		// copying the tokens) repeatedly while scanning a large score.
+		tokens:    make([]Token, 0, len(input)/2+1),
 		start:     0,
 		current:   0,
 		line:      1,
@@ -218,12 +308,122 @@ func newScanner(filename string, input string) *scanner {
 	}
 }
 
+// newReaderScanner returns a scanner that reads its input from a reader as it
+// scans it, rather than all at once beforehand.
+func newReaderScanner(filename string, r io.Reader) *scanner {
+	s := newRuneScanner(filename, []rune{})
+	s.reading = true
+	s.reader = bufio.NewReader(r)
+	s.readContext = model.AldaSourceContext{
+		Filename: filename, Line: 1, Column: 1,
+	}
+	s.gaps = map[int]string{}
+	return s
+}
+
+// fill reads input until the rune at index i has been read, if there's enough
+// input left, and returns whether it has.
+func (s *scanner) fill(i int) bool {
+	for i >= len(s.input) && s.reader != nil {
+		c, size, err := s.reader.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				s.readErr = &ReadError{Context: s.readContext, Err: err}
+			}
+			s.reader = nil
+			break
+		}
+
+		s.input = append(s.input, c)
+		s.readContext.Offset += size
+
+		if c == '\n' {
+			s.readContext.Line++
+			s.readContext.Column = 1
+		} else {
+			s.readContext.Column++
+		}
+	}
+
+	return i < len(s.input)
+}
+
+// discard drops the runes that have been scanned from the input being read,
+// except the one before the current lexeme, which some lexemes look back at.
+// The indexes into the input are adjusted to match.
+func (s *scanner) discard() {
+	n := s.current - 1
+	if !s.reading || n < discardThreshold {
+		return
+	}
+
+	s.input = s.input[:copy(s.input, s.input[n:])]
+	s.current -= n
+}
+
+// keepGap keeps track of the text between tokens while reading, given the
+// number of tokens before the lexeme that's just been scanned. A lexeme that
+// isn't a token, or is trivia, is part of the text before the next token.
+func (s *scanner) keepGap(tokens int) {
+	if len(s.tokens) == tokens || s.tokens[tokens].tokenType.IsTrivia() {
+		s.gap = append(s.gap, s.input[s.start:s.current]...)
+		return
+	}
+
+	token := s.tokens[tokens]
+	if tokens > 0 && !isPlainGap(s.gap, s.lastEnd, token.sourceContext) {
+		s.gaps[token.sourceContext.Offset] = string(s.gap)
+	}
+
+	s.gap = s.gap[:0]
+	s.lastEnd = token.endContext
+}
+
+// plainGap returns the text between two positions in the input, given that it
+// consists solely of newlines, followed by spaces, which is how the text
+// between tokens is usually written.
+func plainGap(end, start model.AldaSourceContext) string {
+	newlines, spaces := plainGapLength(end, start)
+	return strings.Repeat("\n", newlines) + strings.Repeat(" ", spaces)
+}
+
+// plainGapLength returns the number of newlines and spaces in the plain gap
+// between two positions in the input (see plainGap).
+func plainGapLength(end, start model.AldaSourceContext) (int, int) {
+	newlines, spaces := start.Line-end.Line, start.Column-end.Column
+	if newlines > 0 {
+		spaces = start.Column - 1
+	}
+	if newlines < 0 || spaces < 0 {
+		return 0, 0
+	}
+
+	return newlines, spaces
+}
+
+// isPlainGap reports whether the text between two positions in the input is
+// the plain gap between them (see plainGap).
+func isPlainGap(gap []rune, end, start model.AldaSourceContext) bool {
+	newlines, spaces := plainGapLength(end, start)
+	if len(gap) != newlines+spaces {
+		return false
+	}
+
+	for i, c := range gap {
+		if i < newlines && c != '\n' || i >= newlines && c != ' ' {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (s *scanner) reachedEOF() bool {
-	return s.current >= len(s.input)
+	return !s.fill(s.current)
 }
 
 func (s *scanner) eofIsNext() bool {
-	return s.current+1 >= len(s.input)
+	return !s.fill(s.current + 1)
 }
 
 func (s *scanner) peek() rune {
@@ -245,6 +445,7 @@ func (s *scanner) peekNext() rune {
 func (s *scanner) advance() rune {
 	r := s.input[s.current]
 	s.current++
+	s.offset += utf8.RuneLen(r)
 
 	if r == '\n' {
 		s.line++
@@ -281,10 +482,22 @@ func (s *scanner) addToken(tokenType TokenType, literal interface{}) {
 			Filename: s.filename,
 			Line:     s.startLine,
 			Column:   s.startColumn,
+			Offset:   s.startOffset,
+		},
+		endContext: model.AldaSourceContext{
+			Filename: s.filename,
+			Line:     s.line,
+			Column:   s.column,
+			Offset:   s.offset,
 		},
 	}
 
-	log.Debug().Str("token", token.String()).Msg("Adding token.")
+	// NB: We only describe the token if it will be logged, which it usually
+	// isn't, because doing so for every token of a large score is expensive.
+	if event := log.Debug(); event.Enabled() {
+		event.Str("token", token.String()).Msg("Adding token.")
+	}
+
 	s.tokens = append(s.tokens, token)
 }
 
@@ -294,10 +507,51 @@ func (s *scanner) skipComment() {
 	}
 }
 
+// stringEscapes maps each character that may follow a backslash in a string to
+// the character that the escape sequence represents.
+var stringEscapes = map[rune]rune{
+	'"':  '"',
+	'\\': '\\',
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+}
+
+// unescapeString interprets the escape sequences in the contents of a string.
+//
+// Within a string, a backslash escapes a double quote (\"), another backslash
+// (\\), a newline (\n), a carriage return (\r) or a tab (\t). A backslash
+// followed by any other character is left as-is.
+func unescapeString(contents []rune) string {
+	builder := strings.Builder{}
+
+	for i := 0; i < len(contents); i++ {
+		c := contents[i]
+
+		if c == '\\' && i+1 < len(contents) {
+			if escaped, ok := stringEscapes[contents[i+1]]; ok {
+				builder.WriteRune(escaped)
+				i++
+				continue
+			}
+		}
+
+		builder.WriteRune(c)
+	}
+
+	return builder.String()
+}
+
 func (s *scanner) parseString() error {
 	// NB: This assumes the initial quote was already consumed.
 
 	for s.peek() != '"' && !s.reachedEOF() {
+		// Skip over the escaped character, so that an escaped quote doesn't
+		// terminate the string.
+		if s.peek() == '\\' && !s.eofIsNext() {
+			s.advance()
+		}
+
 		s.advance()
 	}
 
@@ -310,7 +564,7 @@ func (s *scanner) parseString() error {
 
 	// Trim the surrounding quotes.
 	contents := s.input[s.start+1 : s.current-1]
-	s.addToken(String, string(contents))
+	s.addToken(String, unescapeString(contents))
 
 	return nil
 }
@@ -359,6 +613,99 @@ func terminatesNoteLength(c rune) bool {
 	return false
 }
 
+// startsTimeSignature returns true if the digit that was just consumed starts a
+// time signature, e.g. `3/4`. A note length is never followed by a slash and a
+// digit, but it can follow a tie and whitespace or a barline (e.g. `c2~ 4` or
+// `c2~|4`), so a time signature must be followed by whitespace, a barline, the
+// end of an event sequence, or EOF.
+func (s *scanner) startsTimeSignature() bool {
+	// NB: This assumes that the first digit has already been consumed.
+	if s.start > 0 {
+		switch prev := s.input[s.start-1]; {
+		case isWhitespace(prev), prev == '[', prev == '|':
+		default:
+			return false
+		}
+	}
+
+	i := s.current
+	for s.fill(i) && isDigit(s.input[i]) {
+		i++
+	}
+
+	if !s.fill(i+1) || s.input[i] != '/' || !isDigit(s.input[i+1]) {
+		return false
+	}
+
+	// skip '/'
+	i++
+	for s.fill(i) && isDigit(s.input[i]) {
+		i++
+	}
+
+	if !s.fill(i) {
+		return true
+	}
+
+	switch next := s.input[i]; {
+	case isWhitespace(next), next == '|', next == ']':
+		return true
+	}
+
+	return false
+}
+
+func (s *scanner) parseTimeSignature() {
+	// NB: This assumes that the first digit has already been consumed.
+	s.consumeDigits()
+	numerator := s.parseIntegerFrom(s.start)
+
+	// consume '/'
+	s.advance()
+
+	denominatorStart := s.current
+	s.consumeDigits()
+	denominator := s.parseIntegerFrom(denominatorStart)
+
+	s.addToken(TimeSignature, model.TimeSignature{
+		Numerator: numerator, Denominator: denominator,
+	})
+}
+
+// startsTupletRatio returns true if the digit that was just consumed starts a
+// tuplet ratio, e.g. the `3:2` in `{c d e}3:2`, which directly follows the end
+// of a cram expression.
+func (s *scanner) startsTupletRatio() bool {
+	// NB: This assumes that the first digit has already been consumed.
+	if s.start == 0 || s.input[s.start-1] != '}' {
+		return false
+	}
+
+	i := s.current
+	for s.fill(i) && isDigit(s.input[i]) {
+		i++
+	}
+
+	return s.fill(i+1) && s.input[i] == ':' && isDigit(s.input[i+1])
+}
+
+func (s *scanner) parseTupletRatio() {
+	// NB: This assumes that the first digit has already been consumed.
+	s.consumeDigits()
+	actualNotes := s.parseIntegerFrom(s.start)
+
+	// consume ':'
+	s.advance()
+
+	normalNotesStart := s.current
+	s.consumeDigits()
+	normalNotes := s.parseIntegerFrom(normalNotesStart)
+
+	s.addToken(TupletRatio, model.TupletRatio{
+		ActualNotes: actualNotes, NormalNotes: normalNotes,
+	})
+}
+
 func (s *scanner) parseNoteLength() {
 	// NB: This assumes that the first digit has already been consumed.
 
@@ -492,6 +839,36 @@ func (s *scanner) parseRepeat() error {
 	return nil
 }
 
+func (s *scanner) parseMultiMeasureRest() error {
+	// NB: This assumes the initial 'R' was already consumed.
+
+	// consume '*'
+	s.advance()
+
+	if c := s.peek(); !isDigit(c) {
+		return s.unexpectedCharError(c, "in multi-measure rest", s.line, s.column)
+	}
+
+	startDigits := s.current
+	s.consumeDigits()
+
+	if c := s.peek(); c != ' ' &&
+		c != '\r' &&
+		c != '\n' &&
+		c != '|' &&
+		c != ']' &&
+		c != '}' &&
+		!s.reachedEOF() {
+		return s.unexpectedCharError(c, "in multi-measure rest", s.line, s.column)
+	}
+
+	digits := s.input[startDigits:s.current]
+	measures, _ := strconv.ParseInt(string(digits), 10, 32)
+	s.addToken(MultiMeasureRest, int32(measures))
+
+	return nil
+}
+
 func (s *scanner) parseOctaveSet() error {
 	// NB: This assumes the initial 'o' was already consumed.
 
@@ -571,7 +948,7 @@ func (s *scanner) parseAlias() error {
 	}
 
 	if c := s.peek(); c != '"' {
-		s.unexpectedCharError(c, "in alias", s.line, s.column)
+		return s.unexpectedCharError(c, "in alias", s.line, s.column)
 	}
 
 	// Consume the closing ".
@@ -579,6 +956,10 @@ func (s *scanner) parseAlias() error {
 
 	// Trim the surrounding quotes.
 	contents := s.input[s.start+1 : s.current-1]
+	if len(contents) == 0 {
+		return s.errorAtPosition(s.startLine, s.startColumn, "Empty alias")
+	}
+
 	s.addToken(Alias, string(contents))
 
 	return nil
@@ -651,6 +1032,15 @@ func followsRestLetter(c rune) bool {
 	return false
 }
 
+func isWhitespace(c rune) bool {
+	switch c {
+	case ' ', '\r', '\n', '\t':
+		return true
+	}
+
+	return false
+}
+
 func (s *scanner) scanToken() error {
 	prevLine := s.line
 	prevColumn := s.column
@@ -659,10 +1049,16 @@ func (s *scanner) scanToken() error {
 
 	switch c {
 	case ' ', '\r', '\n', '\t':
-		// skip whitespace
+		if s.trivia {
+			s.consumeWhile(isWhitespace)
+			s.addToken(Whitespace, nil)
+		}
 		return nil
 	case '#':
 		s.skipComment()
+		if s.trivia {
+			s.addToken(Comment, nil)
+		}
 		return nil
 	case '(':
 		s.sexpLevel++
@@ -682,6 +1078,14 @@ func (s *scanner) scanToken() error {
 		switch c {
 		case '\'':
 			s.addToken(SingleQuote, nil)
+		case '[':
+			s.addToken(EventSeqOpen, nil)
+		case ']':
+			s.addToken(EventSeqClose, nil)
+		case '{':
+			s.addToken(CramOpen, nil)
+		case '}':
+			s.addToken(CramClose, nil)
 		case '"':
 			err = s.parseString()
 		default:
@@ -723,7 +1127,11 @@ func (s *scanner) scanToken() error {
 	case ':':
 		s.addToken(Colon, nil)
 	case '~':
-		s.addToken(Tie, nil)
+		if s.match('~') {
+			s.addToken(Glissando, nil)
+		} else {
+			s.addToken(Tie, nil)
+		}
 	case '|':
 		s.addToken(Barline, nil)
 	case '=':
@@ -741,7 +1149,13 @@ func (s *scanner) scanToken() error {
 	default:
 		switch {
 		case isDigit(c):
-			s.parseNoteLength()
+			if s.startsTimeSignature() {
+				s.parseTimeSignature()
+			} else if s.startsTupletRatio() {
+				s.parseTupletRatio()
+			} else {
+				s.parseNoteLength()
+			}
 		case isLetter(c):
 			n := s.peek()
 			switch {
@@ -755,6 +1169,13 @@ func (s *scanner) scanToken() error {
 				err = s.parseOctaveSet()
 			case isVoiceLetter(c) && isDigit(n):
 				err = s.parseVoiceMarker()
+			case c == 'R' && n == '*':
+				err = s.parseMultiMeasureRest()
+			case c == 'p' && (!isValidNameChar(n) || s.reachedEOF()):
+				// A lone `p` is the dynamic marking piano (see DynamicNode). Other
+				// dynamic markings are at least two letters long, so they scan as
+				// names anyway.
+				s.parseName()
 			default:
 				return s.unexpectedCharError(n, "in note/rest/name", s.line, s.column)
 			}
@@ -766,17 +1187,23 @@ func (s *scanner) scanToken() error {
 	return err
 }
 
-// Scan an input string and return a list of tokens.
-//
-// The `filename` argument is included in the error message in the event of a
-// parse error.
-func Scan(filename string, input string) ([]Token, error) {
-	s := newScanner(filename, input)
-	for !s.reachedEOF() {
+// recover skips past the rest of the current lexeme after a scanning error, so
+// that scanning can continue and report any further errors.
+func (s *scanner) recover() {
+	s.consumeWhile(func(c rune) bool { return !unicode.IsSpace(c) })
+}
+
+// scan scans the entire input, returning the tokens and any errors that were
+// encountered along the way. It gives up at the error after maxErrors of them
+// (see newParseErrors).
+func (s *scanner) scan() ([]Token, []*model.AldaSourceError) {
+	for !s.reachedEOF() && len(s.errors) <= maxErrors {
 		// We are at the beginning of the next lexeme.
+		s.discard()
 		s.start = s.current
 		s.startLine = s.line
 		s.startColumn = s.column
+		s.startOffset = s.offset
 
 		// log.Debug().
 		// 	Int("line", s.line).
@@ -785,23 +1212,76 @@ func Scan(filename string, input string) ([]Token, error) {
 		// 	Str("atCharacter", string(s.peek())).
 		// 	Msg("Scanning token.")
 		// Scan the next token.
+		tokens := len(s.tokens)
 		if err := s.scanToken(); err != nil {
-			return nil, err
+			s.errors = append(s.errors, asSourceError(err, model.AldaSourceContext{
+				Filename: s.filename, Line: s.startLine, Column: s.startColumn,
+			}))
+			s.recover()
+		}
+
+		if s.reading {
+			s.keepGap(tokens)
 		}
 	}
 
+	eofContext := model.AldaSourceContext{
+		Filename: s.filename,
+		Line:     s.line,
+		Column:   s.column,
+		Offset:   s.offset,
+	}
+
 	s.tokens = append(s.tokens, Token{
-		tokenType: EOF,
-		text:      "",
-		literal:   nil,
-		sourceContext: model.AldaSourceContext{
-			Filename: s.filename,
-			Line:     s.line,
-			Column:   s.column,
-		},
+		tokenType:     EOF,
+		text:          "",
+		literal:       nil,
+		sourceContext: eofContext,
+		endContext:    eofContext,
 	})
 
-	return s.tokens, nil
+	return s.tokens, s.errors
+}
+
+// Scan an input string and return a list of tokens.
+//
+// The `filename` argument is included in the error message in the event of a
+// parse error. If there are errors, a *ParseErrors is returned.
+func Scan(filename string, input string) ([]Token, error) {
+	tokens, errs := newScanner(filename, input).scan()
+	if len(errs) > 0 {
+		return nil, newParseErrors(errs)
+	}
+
+	return tokens, nil
+}
+
+type tokenizeOption func(*scanner)
+
+// IncludeTrivia customizes Tokenize to include Comment and Whitespace tokens,
+// so that the tokens cover every character of the input.
+func IncludeTrivia(s *scanner) {
+	s.trivia = true
+}
+
+// Tokenize scans a string of Alda source code and returns the list of tokens,
+// ending with an EOF token. If there are errors, a *ParseErrors is returned.
+//
+// The tokens can be parsed into an AST via ParseTokens, which is how Parse
+// parses its input.
+func Tokenize(src string, opts ...tokenizeOption) ([]Token, error) {
+	s := newScanner("", src)
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	tokens, errs := s.scan()
+	if len(errs) > 0 {
+		return nil, newParseErrors(errs)
+	}
+
+	return tokens, nil
 }
 
 // ScanFile reads a file, scans it, and returns a list of tokens.
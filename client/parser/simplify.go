@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"math"
+
+	"alda.io/client/model"
+)
+
+// SimplifyDurations returns a copy of the AST where tied note lengths are
+// replaced with an equivalent dotted note length wherever one exists, e.g.
+// `c2~4` becomes `c2.` and `c4~8~16` becomes `c4..`. The original AST is left
+// unchanged.
+//
+// Only note lengths whose denominators are powers of 2 are combined, and only
+// when the result lasts exactly as long as the tied note lengths. Note lengths
+// on either side of a barline are never combined, nor are note lengths in
+// milliseconds or seconds. A tie chain that can't be written as a single note
+// length as a whole might still be partly simplified, e.g. `c2~4~2` becomes
+// `c2.~2`.
+func SimplifyDurations(root ASTNode) ASTNode {
+	simplified := root.Clone()
+	simplifyDurations(&simplified)
+	return simplified
+}
+
+func simplifyDurations(node *ASTNode) {
+	for i := range node.Children {
+		simplifyDurations(&node.Children[i])
+	}
+
+	if node.Type == DurationNode {
+		node.Children = simplifyDurationComponents(node.Children)
+	}
+}
+
+// simplifyDurationComponents combines each run of tied note lengths into the
+// longest prefix of the run that can be written as a single note length, and
+// then does the same with the rest of the run.
+func simplifyDurationComponents(components []ASTNode) []ASTNode {
+	simplified := []ASTNode{}
+
+	for i := 0; i < len(components); {
+		next := i + 1
+		combined := components[i]
+
+		beats := 0.0
+		for j := i; j < len(components); j++ {
+			componentBeats, ok := noteLengthBeats(components[j])
+			if !ok {
+				break
+			}
+
+			beats += componentBeats
+
+			if j == i {
+				continue
+			}
+
+			noteLength, ok := noteLengthForBeats(beats, components[i].SourceContext)
+			if ok {
+				combined = noteLength
+				next = j + 1
+			}
+		}
+
+		simplified = append(simplified, combined)
+		i = next
+	}
+
+	return simplified
+}
+
+// noteLengthBeats returns the number of beats in a NoteLengthNode, if its
+// denominator is a power of 2.
+func noteLengthBeats(node ASTNode) (float64, bool) {
+	if node.Type != NoteLengthNode {
+		return 0, false
+	}
+
+	denominator := node.Children[0].Literal.(float64)
+	if !isPowerOfTwo(denominator) {
+		return 0, false
+	}
+
+	dots := int32(0)
+	if len(node.Children) > 1 {
+		dots = node.Children[1].Literal.(int32)
+	}
+
+	return (4 / denominator) * (2 - math.Pow(2, -float64(dots))), true
+}
+
+// noteLengthForBeats returns a NoteLengthNode with a power-of-2 denominator
+// and any number of dots that lasts exactly the given number of beats, if
+// there is one.
+func noteLengthForBeats(
+	beats float64, sourceContext model.AldaSourceContext,
+) (ASTNode, bool) {
+	if beats <= 0 || math.IsInf(beats, 0) {
+		return ASTNode{}, false
+	}
+
+	// The undotted part of the note length is the largest power of 2 that
+	// doesn't exceed the number of beats. Each dot adds half as much as the
+	// previous one, so a note length with n dots lasts (2 - 2^-n) times as long
+	// as the undotted part.
+	_, exp := math.Frexp(beats)
+	undotted := math.Ldexp(1, exp-1)
+
+	remainder := 2 - beats/undotted
+	if !isPowerOfTwo(remainder) {
+		return ASTNode{}, false
+	}
+
+	_, remainderExp := math.Frexp(remainder)
+	dots := int32(1 - remainderExp)
+
+	noteLength := ASTNode{
+		Type:          NoteLengthNode,
+		SourceContext: sourceContext,
+		Children: []ASTNode{{
+			Type:          DenominatorNode,
+			SourceContext: sourceContext,
+			Literal:       4 / undotted,
+		}},
+	}
+
+	if dots > 0 {
+		noteLength.Children = append(noteLength.Children, ASTNode{
+			Type:          DotsNode,
+			SourceContext: sourceContext,
+			Literal:       dots,
+		})
+	}
+
+	return noteLength, true
+}
+
+func isPowerOfTwo(n float64) bool {
+	frac, _ := math.Frexp(n)
+	return frac == 0.5
+}
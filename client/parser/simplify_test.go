@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestSimplifyDurations(t *testing.T) {
+	simplify := []formatterOption{ConfigureSimplifyDurations(true)}
+
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "half note tied to a quarter note",
+			given:    "c2~4",
+			opts:     simplify,
+			expected: "c2.\n",
+		},
+		formatTestCase{
+			label:    "tie chain that simplifies to a double-dotted note",
+			given:    "c4~8~16 d4.~8",
+			opts:     simplify,
+			expected: "c4.. d2\n",
+		},
+		formatTestCase{
+			label:    "rests and cram expressions",
+			given:    "r1~2 {c d e}2~4",
+			opts:     simplify,
+			expected: "r1. { c d e }2.\n",
+		},
+		formatTestCase{
+			label:    "tie chain that only partly simplifies",
+			given:    "c2~4~2",
+			opts:     simplify,
+			expected: "c2.~2\n",
+		},
+		formatTestCase{
+			label:    "tie chains that can't be simplified",
+			given:    "c4~16 d6~12 e4~200ms f2s~1s",
+			opts:     simplify,
+			expected: "c4~16 d6~12 e4~200ms f2s~1s\n",
+		},
+		formatTestCase{
+			label:    "note lengths on either side of a barline",
+			given:    "c2~|4",
+			opts:     simplify,
+			expected: "c2 | ~4\n",
+		},
+		formatTestCase{
+			label:    "durations aren't simplified by default",
+			given:    "c2~4",
+			expected: "c2~4\n",
+		},
+	)
+
+	ast, err := Parse("piece.alda", "c2~4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := ast.Clone()
+	simplified := SimplifyDurations(ast)
+
+	if !ASTEqual(ast, original) {
+		t.Error("expected SimplifyDurations to leave the original AST unchanged")
+	}
+
+	durations := simplified.FindByType(DurationNode)
+	if len(durations) != 1 || len(durations[0].Node.Children) != 1 {
+		t.Fatalf("expected a single note length, got %#v", durations)
+	}
+
+	// The combined note length keeps the source context of the first one.
+	context := durations[0].Node.Children[0].SourceContext
+	if context.Line != 1 || context.Column != 2 {
+		t.Errorf("expected the note length at 1:2, got %#v", context)
+	}
+}
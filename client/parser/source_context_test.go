@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+	"github.com/go-test/deep"
+)
+
+func TestSourceContextOffsets(t *testing.T) {
+	ast, err := Parse("piece.alda", "# é\npiano: c8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	part := ast.Children[0]
+	note := part.Children[1].Children[0]
+	denominator := note.Children[1].Children[0].Children[0]
+
+	for _, testCase := range []struct {
+		label    string
+		expected model.AldaSourceContext
+		actual   model.AldaSourceContext
+	}{
+		{
+			label: "part",
+			expected: model.AldaSourceContext{
+				Filename: "piece.alda", Line: 2, Column: 1, Offset: 5,
+			},
+			actual: part.SourceContext,
+		},
+		{
+			label: "note",
+			expected: model.AldaSourceContext{
+				Filename: "piece.alda", Line: 2, Column: 8, Offset: 12,
+			},
+			actual: note.SourceContext,
+		},
+		{
+			label: "denominator",
+			expected: model.AldaSourceContext{
+				Filename: "piece.alda", Line: 2, Column: 9, Offset: 13,
+			},
+			actual: denominator.SourceContext,
+		},
+	} {
+		if diff := deep.Equal(testCase.expected, testCase.actual); diff != nil {
+			t.Error(testCase.label)
+			for _, diffItem := range diff {
+				t.Errorf("%v", diffItem)
+			}
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+)
+
+// A Count is the number of occurrences of something in a score.
+type Count struct {
+	// Written is the number of occurrences in the source code, i.e. counting
+	// events within repeats once.
+	Written int
+	// Expanded is the number of occurrences when the score is played, i.e.
+	// counting events within repeats (e.g. `[c d]*4`) as many times as they are
+	// repeated, and events that only occur on certain repetitions (e.g. `c'1-2`)
+	// as many times as they occur.
+	//
+	// Variable references are expanded, i.e. the events in a variable
+	// definition are counted wherever the variable is referenced, rather than
+	// where it is defined.
+	Expanded int
+}
+
+// countKind is a kind of event that is counted (see Count).
+type countKind int
+
+const (
+	noteCount countKind = iota
+	restCount
+	chordCount
+	barlineCount
+	variableReferenceCount
+	countKinds
+)
+
+// playedCounts are the numbers of each kind of event that are played, e.g.
+// when a variable is referenced.
+type playedCounts [countKinds]int
+
+// PartStats are the statistics of a single part within a score.
+type PartStats struct {
+	// Names are the names in the part declaration, e.g. ["violin", "viola"].
+	Names []string
+	// Alias is the alias in the part declaration, if there is one.
+	Alias string
+	// Instruments are the instruments that the part plays, i.e. its names, with
+	// any aliases defined earlier in the score resolved to the instruments of
+	// the parts that they refer to, e.g. ["piano"] for `pno:` after
+	// `piano "pno":`.
+	Instruments []string
+	// Notes is the number of notes in the part, including notes in chords and
+	// in voices. The events in variable definitions aren't part of any part, but
+	// the events played by a variable reference in the part are.
+	Notes Count
+	// Rests is the number of rests in the part, including rests in chords and
+	// in voices.
+	Rests Count
+	// Chords is the number of chords in the part.
+	Chords Count
+	// Barlines is the number of barlines in the part.
+	Barlines Count
+	// VariableReferences is the number of variable references in the part (see
+	// ScoreStats.VariableReferences).
+	VariableReferences Count
+	// Measures is the number of measures in the part, as they're separated by
+	// barlines, counting the barlines within repeats as many times as they're
+	// repeated. A part without any events has no measures, and a barline at the
+	// end of a part doesn't start another one.
+	Measures int
+}
+
+// ScoreStats are basic statistics about a score, as computed by Analyze.
+type ScoreStats struct {
+	// Parts is the number of part declarations in the score.
+	Parts int
+	// Notes is the number of notes, including notes in chords and in voices.
+	Notes Count
+	// Rests is the number of rests, including rests in chords and in voices. A
+	// multi-measure rest counts as one rest.
+	Rests Count
+	// Chords is the number of chords.
+	Chords Count
+	// Barlines is the number of barlines, including barlines within durations
+	// (e.g. `c1|~1`).
+	Barlines Count
+	// VariableDefinitions is the number of variable definitions.
+	VariableDefinitions int
+	// VariableReferences is the number of variable references, including those
+	// within the definitions of the variables that are referenced, when played.
+	VariableReferences Count
+	// Markers is the number of markers, e.g. `%chorus`.
+	Markers int
+	// Measures is the number of measures in the longest part (see
+	// PartStats.Measures), adding up the measures of each declaration of a part,
+	// e.g. `piano "pno":` and a later `pno:`. Events before the first part
+	// declaration aren't counted.
+	Measures int
+	// Instruments are the distinct names used in part declarations, other than
+	// aliases defined in the score, in alphabetical order.
+	Instruments []string
+	// MaxNestingDepth is the maximum number of event sequences (e.g. `[c d]`)
+	// and crams (e.g. `{c d}`) within which an event is nested.
+	MaxNestingDepth int
+	// PartStats are the statistics of each part, in the order in which the
+	// parts are declared. A part that is declared more than once has more than
+	// one entry.
+	PartStats []PartStats
+}
+
+// Analyze computes basic statistics about a score, e.g. the number of notes.
+// See ScoreStats.
+//
+// Analyze assumes that the AST is well-formed (see ValidateAST). Nodes that
+// don't have the expected shape are skipped.
+func Analyze(root ASTNode) ScoreStats {
+	a := &analyzer{
+		stats:     ScoreStats{Instruments: []string{}, PartStats: []PartStats{}},
+		names:     map[string]bool{},
+		aliases:   map[string]bool{},
+		variables: map[string]playedCounts{},
+	}
+
+	a.analyze(root, analyzerContext{multiplier: 1, repeatTimes: 1})
+
+	for name := range a.names {
+		if !a.aliases[name] {
+			a.stats.Instruments = append(a.stats.Instruments, name)
+		}
+	}
+	sort.Strings(a.stats.Instruments)
+
+	a.resolveInstruments()
+
+	a.stats.Measures = scoreMeasures(a.stats.PartStats)
+
+	return a.stats
+}
+
+// scoreMeasures returns the number of measures in the longest part (see
+// ScoreStats.Measures).
+func scoreMeasures(parts []PartStats) int {
+	// The measures of each part, keyed by its alias or names
+	measures := map[string]int{}
+	longest := 0
+
+	for _, part := range parts {
+		key := strings.Join(part.Names, "/")
+		if part.Alias != "" {
+			key = part.Alias
+		}
+
+		measures[key] += part.Measures
+		if measures[key] > longest {
+			longest = measures[key]
+		}
+	}
+
+	return longest
+}
+
+// resolveInstruments sets the instruments of each part (see
+// PartStats.Instruments).
+func (a *analyzer) resolveInstruments() {
+	// The instruments of each alias defined so far
+	aliases := map[string][]string{}
+
+	for i := range a.stats.PartStats {
+		part := &a.stats.PartStats[i]
+		part.Instruments = []string{}
+
+		for _, name := range part.Names {
+			if instruments, ok := aliases[name]; ok {
+				part.Instruments = append(part.Instruments, instruments...)
+			} else if !a.aliases[name] {
+				part.Instruments = append(part.Instruments, name)
+			}
+		}
+
+		if part.Alias != "" {
+			aliases[part.Alias] = part.Instruments
+		}
+	}
+}
+
+type analyzer struct {
+	stats   ScoreStats
+	names   map[string]bool
+	aliases map[string]bool
+	// What a reference to each variable plays, as of the point in the score
+	// that has been analyzed
+	variables map[string]playedCounts
+}
+
+// count returns the count of a kind of event in the score, or in a part.
+func (s *ScoreStats) count(kind countKind) *Count {
+	return [countKinds]*Count{
+		&s.Notes, &s.Rests, &s.Chords, &s.Barlines, &s.VariableReferences,
+	}[kind]
+}
+
+func (p *PartStats) count(kind countKind) *Count {
+	return [countKinds]*Count{
+		&p.Notes, &p.Rests, &p.Chords, &p.Barlines, &p.VariableReferences,
+	}[kind]
+}
+
+// add counts an event of the given kind where it's written, and as many times
+// as it's played.
+func (a *analyzer) add(kind countKind, ctx analyzerContext) {
+	a.stats.count(kind).Written++
+	if ctx.part != nil {
+		ctx.part.count(kind).Written++
+	}
+
+	a.play(kind, ctx.multiplier, ctx)
+}
+
+// play counts the number of times that an event of the given kind is played.
+// Within a variable definition, it's counted towards what the variable plays.
+func (a *analyzer) play(kind countKind, times int, ctx analyzerContext) {
+	if ctx.variable != nil {
+		ctx.variable[kind] += times
+		return
+	}
+
+	a.stats.count(kind).Expanded += times
+	if ctx.part != nil {
+		ctx.part.count(kind).Expanded += times
+	}
+}
+
+// analyzerContext is the context in which a node is analyzed.
+type analyzerContext struct {
+	// multiplier is the number of times that the node occurs when the score is
+	// played.
+	multiplier int
+	// repeatTimes is the number of times that the innermost enclosing repeat
+	// repeats, or 1 if the node isn't within a repeat.
+	repeatTimes int
+	// depth is the nesting depth of the node (see MaxNestingDepth).
+	depth int
+	// standalone is true if the node is an event in itself, as opposed to e.g.
+	// the event sequence of a part.
+	standalone bool
+	// part is the statistics of the enclosing part, if any.
+	part *PartStats
+	// variable is what the enclosing variable definition plays, if the node is
+	// within one.
+	variable *playedCounts
+}
+
+func (a *analyzer) analyze(node ASTNode, ctx analyzerContext) {
+	switch node.Type {
+	case PartNode:
+		a.stats.Parts++
+		a.stats.PartStats = append(a.stats.PartStats, PartStats{Names: []string{}})
+		// NB: ctx.part points into a.stats.PartStats, which we don't append to
+		// again until we're done with this part, because parts aren't nested.
+		ctx.part = &a.stats.PartStats[len(a.stats.PartStats)-1]
+
+	case PartNameNode:
+		if name, ok := node.Literal.(string); ok {
+			a.names[name] = true
+			if ctx.part != nil {
+				ctx.part.Names = append(ctx.part.Names, name)
+			}
+		}
+
+	case PartAliasNode:
+		if alias, ok := node.Literal.(string); ok {
+			a.aliases[alias] = true
+			if ctx.part != nil {
+				ctx.part.Alias = alias
+			}
+		}
+
+	case NoteNode:
+		a.add(noteCount, ctx)
+
+	case RestNode, MultiMeasureRestNode:
+		a.add(restCount, ctx)
+
+	case ChordNode:
+		a.add(chordCount, ctx)
+
+	case BarlineNode:
+		a.add(barlineCount, ctx)
+
+	case MarkerNode:
+		a.stats.Markers++
+
+	case VariableDefinitionNode:
+		a.stats.VariableDefinitions++
+		// The events in the definition are played wherever the variable is
+		// referenced (see VariableReferenceNode), not where it's defined.
+		ctx.variable = &playedCounts{}
+		ctx.multiplier, ctx.repeatTimes = 1, 1
+		ctx.part = nil
+
+	case VariableReferenceNode:
+		a.add(variableReferenceCount, ctx)
+		if name, ok := node.Literal.(string); ok {
+			for kind, times := range a.variables[name] {
+				a.play(countKind(kind), times*ctx.multiplier, ctx)
+			}
+		}
+
+	case CramNode, TupletNode:
+		ctx.depth++
+
+	case EventSequenceNode:
+		// Only a standalone event sequence, i.e. one that is an event in itself,
+		// increases the nesting depth. Other event sequences (e.g. those of parts
+		// crams and tuplets) are just part of the structure of the AST.
+		if ctx.standalone {
+			ctx.depth++
+		}
+
+	case RepeatNode:
+		if len(node.Children) == 2 {
+			if times, ok := node.Children[1].Literal.(int32); ok && times >= 0 {
+				ctx.multiplier *= int(times)
+				ctx.repeatTimes = int(times)
+			}
+		}
+
+	case OnRepetitionsNode:
+		if len(node.Children) == 2 && ctx.repeatTimes > 0 {
+			// The event occurs only on those repetitions of the enclosing repeat
+			// that are in the given ranges.
+			occurrences := repetitionsWithin(node.Children[1], ctx.repeatTimes)
+			ctx.multiplier = ctx.multiplier / ctx.repeatTimes * occurrences
+		}
+	}
+
+	if ctx.depth > a.stats.MaxNestingDepth {
+		a.stats.MaxNestingDepth = ctx.depth
+	}
+
+	// Within a repeat or an event with repetitions, the first child is the event
+	// itself. Within an event sequence, every child is an event.
+	for i, child := range node.Children {
+		childCtx := ctx
+		childCtx.standalone = node.Type == EventSequenceNode ||
+			(i == 0 && (node.Type == RepeatNode || node.Type == OnRepetitionsNode))
+		a.analyze(child, childCtx)
+	}
+
+	// A variable plays what it was defined as at the time, even if a variable
+	// that it references is redefined later.
+	if node.Type == VariableDefinitionNode && len(node.Children) > 0 {
+		if name, ok := node.Children[0].Literal.(string); ok {
+			a.variables[name] = *ctx.variable
+		}
+	}
+
+	if node.Type == PartNode && ctx.part != nil {
+		ctx.part.Measures = partMeasures(node, ctx.part.Barlines)
+	}
+}
+
+// partMeasures returns the number of measures in a part, given the number of
+// barlines in it (see PartStats.Measures).
+func partMeasures(part ASTNode, barlines Count) int {
+	events := part.Children[len(part.Children)-1]
+	if events.Type != EventSequenceNode || len(events.Children) == 0 {
+		return 0
+	}
+
+	measures := barlines.Expanded + 1
+	if events.Children[len(events.Children)-1].Type == BarlineNode {
+		measures--
+	}
+
+	return measures
+}
+
+// repetitionsWithin returns the number of distinct repetitions in a
+// RepetitionsNode that are between 1 and times, inclusive.
+func repetitionsWithin(repetitions ASTNode, times int) int {
+	occurs := make([]bool, times+1)
+
+	for _, rangeNode := range repetitions.Children {
+		if len(rangeNode.Children) != 2 {
+			continue
+		}
+
+		first, ok1 := rangeNode.Children[0].Literal.(int32)
+		last, ok2 := rangeNode.Children[1].Literal.(int32)
+		if !ok1 || !ok2 {
+			continue
+		}
+
+		if first < 1 {
+			first = 1
+		}
+
+		for i := int(first); i <= int(last) && i <= times; i++ {
+			occurs[i] = true
+		}
+	}
+
+	count := 0
+	for _, occurrence := range occurs {
+		if occurrence {
+			count++
+		}
+	}
+
+	return count
+}
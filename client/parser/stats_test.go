@@ -0,0 +1,224 @@
+package parser
+
+import (
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+	"github.com/go-test/deep"
+)
+
+func TestAnalyze(t *testing.T) {
+	ast, err := Parse("stats", `riff = c8 d
+
+piano "pno":
+  o4 c/e/g r4 | [c d riff]*2
+  V1: [e f]*3 V2: g/b r V0: c
+
+violin/viola "strings":
+  [a [b {c d}4]'1,3 e]*4 | r2
+
+pno: riff*2
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ScoreStats{
+		Parts:               3,
+		Notes:               Count{Written: 17, Expanded: 38},
+		Rests:               Count{Written: 3, Expanded: 3},
+		Chords:              Count{Written: 2, Expanded: 2},
+		Barlines:            Count{Written: 2, Expanded: 2},
+		VariableDefinitions: 1,
+		VariableReferences:  Count{Written: 2, Expanded: 4},
+		Measures:            3,
+		Instruments:         []string{"piano", "viola", "violin"},
+		MaxNestingDepth:     3,
+		PartStats: []PartStats{
+			{
+				Names:              []string{"piano"},
+				Alias:              "pno",
+				Instruments:        []string{"piano"},
+				Notes:              Count{Written: 10, Expanded: 20},
+				Rests:              Count{Written: 2, Expanded: 2},
+				Chords:             Count{Written: 2, Expanded: 2},
+				Barlines:           Count{Written: 1, Expanded: 1},
+				VariableReferences: Count{Written: 1, Expanded: 2},
+				Measures:           2,
+			},
+			{
+				Names:       []string{"violin", "viola"},
+				Alias:       "strings",
+				Instruments: []string{"violin", "viola"},
+				Notes:       Count{Written: 5, Expanded: 14},
+				Rests:       Count{Written: 1, Expanded: 1},
+				Barlines:    Count{Written: 1, Expanded: 1},
+				Measures:    2,
+			},
+			{
+				Names:              []string{"pno"},
+				Instruments:        []string{"piano"},
+				Notes:              Count{Written: 0, Expanded: 4},
+				VariableReferences: Count{Written: 1, Expanded: 2},
+				Measures:           1,
+			},
+		},
+	}
+
+	if diff := deep.Equal(expected, Analyze(ast)); diff != nil {
+		for _, diffItem := range diff {
+			t.Errorf("%v", diffItem)
+		}
+	}
+}
+
+func TestAnalyzeRepetitions(t *testing.T) {
+	for _, testCase := range []struct {
+		given    string
+		expected Count
+	}{
+		{"[c d]*3", Count{Written: 2, Expanded: 6}},
+		{"[[c d]*2 e]*3", Count{Written: 3, Expanded: 15}},
+		{"[c'1-2,4 d]*4", Count{Written: 2, Expanded: 7}},
+		{"[c'1-2,2-3,9 d]*3", Count{Written: 2, Expanded: 6}},
+		{"[c d]*0 e", Count{Written: 3, Expanded: 1}},
+	} {
+		ast, err := Parse("stats", testCase.given)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual := Analyze(ast).Notes
+		if actual != testCase.expected {
+			t.Errorf(
+				"%s: expected %+v, got %+v", testCase.given, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+// The events in a variable definition are played where the variable is
+// referenced, as it was defined at the time, and not at all if it isn't.
+func TestAnalyzeVariables(t *testing.T) {
+	ast, err := Parse("stats", `riff = c d
+verse = [riff e]*2
+riff = f
+unused = g riff verse
+
+piano "pno":
+  verse | riff
+flute "fl":
+  riff*3
+pno/fl "group":
+  verse
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := Analyze(ast)
+
+	for _, testCase := range []struct {
+		label    string
+		actual   interface{}
+		expected interface{}
+	}{
+		{"notes", stats.Notes, Count{Written: 5, Expanded: 16}},
+		{"variable references", stats.VariableReferences, Count{7, 10}},
+		{"piano notes", stats.PartStats[0].Notes, Count{0, 7}},
+		{"piano measures", stats.PartStats[0].Measures, 2},
+		{"flute notes", stats.PartStats[1].Notes, Count{0, 3}},
+		{"group notes", stats.PartStats[2].Notes, Count{0, 6}},
+		{
+			"group instruments", stats.PartStats[2].Instruments,
+			[]string{"piano", "flute"},
+		},
+	} {
+		if diff := deep.Equal(testCase.expected, testCase.actual); diff != nil {
+			t.Errorf("%s: %v", testCase.label, diff)
+		}
+	}
+}
+
+func TestAnalyzeEmptyScore(t *testing.T) {
+	expected := ScoreStats{Instruments: []string{}, PartStats: []PartStats{}}
+
+	actual := Analyze(ASTNode{Type: RootNode})
+	if diff := deep.Equal(expected, actual); diff != nil {
+		for _, diffItem := range diff {
+			t.Errorf("%v", diffItem)
+		}
+	}
+}
+
+// The statistics that `alda stats` reports for a small score, including its
+// duration, which comes from evaluating the score.
+func TestAnalyzeFixture(t *testing.T) {
+	ast, err := Parse("fixture.alda", `(tempo! 120)
+melody = e8 f g4
+
+piano:
+  o4 c4 d melody | c/e/g1 |
+  %coda
+  [c8 d]*2 r2
+
+violin:
+  r1 | melody r2 | o5 c1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := Analyze(ast)
+
+	for _, testCase := range []struct {
+		label    string
+		actual   interface{}
+		expected interface{}
+	}{
+		{"parts", stats.Parts, 2},
+		{"notes", stats.Notes, Count{Written: 11, Expanded: 16}},
+		{"rests", stats.Rests, Count{Written: 3, Expanded: 3}},
+		{"chords", stats.Chords, Count{Written: 1, Expanded: 1}},
+		{"measures", stats.Measures, 3},
+		{"variable definitions", stats.VariableDefinitions, 1},
+		{"variable references", stats.VariableReferences, Count{2, 2}},
+		{"markers", stats.Markers, 1},
+		{"max nesting depth", stats.MaxNestingDepth, 1},
+		{"instruments", stats.Instruments, []string{"piano", "violin"}},
+		{"piano measures", stats.PartStats[0].Measures, 3},
+		{"violin measures", stats.PartStats[1].Measures, 3},
+	} {
+		if diff := deep.Equal(testCase.expected, testCase.actual); diff != nil {
+			t.Errorf("%s: %v", testCase.label, diff)
+		}
+	}
+
+	updates, err := ast.Updates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score := model.NewScore()
+	if err := score.Update(updates...); err != nil {
+		t.Fatal(err)
+	}
+
+	notes := 0
+	for _, event := range score.Events {
+		if _, ok := event.(model.NoteEvent); ok {
+			notes++
+		}
+	}
+
+	if notes != stats.Notes.Expanded {
+		t.Errorf("expected %d notes to be played, got %d", stats.Notes.Expanded,
+			notes)
+	}
+
+	// 3 measures of 4/4 at 120 bpm
+	if duration := score.DurationMs(); duration != 6000 {
+		t.Errorf("expected a duration of 6000 ms, got %v", duration)
+	}
+}
@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+// The constructs that are errors when parsing strictly, and warnings when
+// parsing leniently.
+func TestStrictness(t *testing.T) {
+	for _, testCase := range []struct {
+		label string
+		given string
+		// The error when parsing strictly
+		expectError string
+		// The warnings when parsing leniently
+		expectWarnings []string
+		// Input that parses to the same AST as the given input does leniently
+		equivalent string
+	}{
+		{
+			label:       "trailing separator in a chord",
+			given:       "c/e/ | d",
+			expectError: "piece.alda:1:6 Unexpected barline `|` in chord",
+			expectWarnings: []string{
+				"piece.alda:1:4 trailing separator `/` in chord",
+			},
+			equivalent: "c/e | d",
+		},
+		{
+			label:       "trailing separator before an attribute change",
+			given:       "c/e/ (vol 50)",
+			expectError: "piece.alda:1:14 Unexpected EOF in chord",
+			expectWarnings: []string{
+				"piece.alda:1:4 trailing separator `/` in chord",
+			},
+			equivalent: "c/e (vol 50)",
+		},
+		{
+			label:       "trailing separator at the end of the input",
+			given:       "piano: c/",
+			expectError: "piece.alda:1:10 Unexpected EOF in chord",
+			expectWarnings: []string{
+				"piece.alda:1:9 trailing separator `/` in chord",
+			},
+			equivalent: "piano: c",
+		},
+		{
+			label:       "repeated separators in a chord",
+			given:       "c/e//g",
+			expectError: "piece.alda:1:5 Unexpected separator `/` in chord",
+			expectWarnings: []string{
+				"piece.alda:1:5 repeated separator `/` in chord",
+			},
+			equivalent: "c/e/g",
+		},
+		{
+			label:       "glissando that doesn't end on a note",
+			given:       "c~~ |",
+			expectError: "piece.alda:1:6 Unexpected EOF in glissando",
+			expectWarnings: []string{
+				"piece.alda:1:2 glissando `~~` doesn't end on a note",
+			},
+			equivalent: "c |",
+		},
+		{
+			label:       "glissando that continues beyond its last note",
+			given:       "c~~e~~",
+			expectError: "piece.alda:1:7 Unexpected EOF in glissando",
+			expectWarnings: []string{
+				"piece.alda:1:5 glissando `~~` doesn't end on a note",
+			},
+			equivalent: "c~~e",
+		},
+		{
+			label:       "unterminated event sequence",
+			given:       "piano: [c d",
+			expectError: "piece.alda:1:12 unterminated event sequence",
+			expectWarnings: []string{
+				"piece.alda:1:12 unterminated event sequence",
+			},
+			equivalent: "piano: [c d]",
+		},
+		{
+			label:       "unterminated cram expression",
+			given:       "piano: {c d",
+			expectError: "piece.alda:1:12 unterminated cram expression",
+			expectWarnings: []string{
+				"piece.alda:1:12 unterminated cram expression",
+			},
+			equivalent: "piano: {c d}",
+		},
+		{
+			label:       "unterminated S-expression",
+			given:       "piano: (vol 50",
+			expectError: "piece.alda:1:15 unterminated S-expression",
+			expectWarnings: []string{
+				"piece.alda:1:15 unterminated S-expression",
+			},
+			equivalent: "piano: (vol 50)",
+		},
+		{
+			label:       "several constructs left open",
+			given:       "[c {d (vol 50",
+			expectError: "piece.alda:1:14 unterminated S-expression",
+			expectWarnings: []string{
+				"piece.alda:1:14 unterminated S-expression",
+				"piece.alda:1:14 unterminated cram expression",
+				"piece.alda:1:14 unterminated event sequence",
+			},
+			equivalent: "[c {d (vol 50)}]",
+		},
+	} {
+		_, err := Parse("piece.alda", testCase.given)
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.label)
+		} else if actual := err.Error(); actual != testCase.expectError {
+			t.Errorf(
+				"%s\nexpected error: %s\nactual error: %s",
+				testCase.label, testCase.expectError, actual,
+			)
+		}
+
+		_, err = Parse("piece.alda", testCase.given, WithStrictness(Strict))
+		if err == nil || err.Error() != testCase.expectError {
+			t.Errorf(
+				"%s: expected strict parsing to be the default, got %v",
+				testCase.label, err,
+			)
+		}
+
+		warnings := []*model.AldaSourceError{}
+		ast, err := Parse(
+			"piece.alda", testCase.given,
+			WithStrictness(Lenient), CollectWarnings(&warnings),
+		)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.label, err)
+			continue
+		}
+
+		actualWarnings := []string{}
+		for _, warning := range warnings {
+			actualWarnings = append(actualWarnings, warning.Error())
+		}
+
+		if !reflect.DeepEqual(actualWarnings, testCase.expectWarnings) {
+			t.Errorf(
+				"%s\nexpected warnings: %q\nactual warnings: %q",
+				testCase.label, testCase.expectWarnings, actualWarnings,
+			)
+		}
+
+		expectedAST, err := Parse("piece.alda", testCase.equivalent)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+
+		if !ASTEqual(ast, expectedAST, IgnoreSourceContext) {
+			t.Errorf(
+				"%s: expected the same AST as %q\nactual AST: %s",
+				testCase.label, testCase.equivalent, ast.JSON().String(),
+			)
+		}
+	}
+}
+
+// The same input parses the same way in either mode when it has no
+// recoverable problems, including warnings that aren't about strictness.
+func TestStrictnessWithoutProblems(t *testing.T) {
+	given := "piano: c/e/g [d e]*2 {f g}4 (vol 50) c~~e\nmf = d\npiano: mf"
+
+	strict, err := Parse("piece.alda", given, WithStrictness(Strict))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warnings := []*model.AldaSourceError{}
+	lenient, err := Parse(
+		"piece.alda", given,
+		WithStrictness(Lenient), CollectWarnings(&warnings),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ASTEqual(strict, lenient) {
+		t.Error("expected the same AST when parsing strictly and leniently")
+	}
+
+	if len(warnings) != 1 {
+		t.Errorf("expected 1 warning, got %d: %v", len(warnings), warnings)
+	}
+}
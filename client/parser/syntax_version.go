@@ -0,0 +1,183 @@
+package parser
+
+// SyntaxVersion is a major version of Alda whose syntax the formatter can
+// target (see ConfigureSyntaxVersion).
+type SyntaxVersion int
+
+const (
+	// SyntaxVersion1 is the syntax of Alda 1, where attribute arguments are
+	// Clojure data, e.g. `(key-signature [:g :minor])`.
+	SyntaxVersion1 SyntaxVersion = 1
+	// SyntaxVersion2 is the syntax of Alda 2, where attribute arguments are
+	// alda-lisp data, e.g. `(key-signature '(g minor))`.
+	SyntaxVersion2 SyntaxVersion = 2
+)
+
+// ConvertSyntaxVersion returns a copy of the AST where the constructs whose
+// syntax differs between versions of Alda are written in the syntax of the
+// given version. The original AST is left unchanged.
+//
+// Currently, the only such construct is the argument of a key signature
+// attribute change, e.g. `(key-signature ...)` or `(key-sig! ...)`, when it's
+// written as data rather than as a string (which is the same in both
+// versions):
+//
+//	Alda 1                        Alda 2
+//	[:g :minor]                   '(g minor)
+//	{:f [:sharp] :c [:sharp]}     '(f (sharp) c (sharp))
+//
+// An argument that isn't written in either of these shapes is left as it is.
+func ConvertSyntaxVersion(root ASTNode, version SyntaxVersion) ASTNode {
+	converted := root.Clone()
+	convertSyntaxVersion(&converted, version)
+	return converted
+}
+
+func convertSyntaxVersion(node *ASTNode, version SyntaxVersion) {
+	for i := range node.Children {
+		convertSyntaxVersion(&node.Children[i], version)
+	}
+
+	if !isKeySignatureChange(*node) {
+		return
+	}
+
+	switch version {
+	case SyntaxVersion1:
+		if argument, ok := keySignatureDataV1(node.Children[1]); ok {
+			node.Children[1] = argument
+		}
+	case SyntaxVersion2:
+		if argument, ok := keySignatureDataV2(node.Children[1]); ok {
+			node.Children[1] = argument
+		}
+	}
+}
+
+// forAll reports whether every node satisfies the predicate.
+func forAll(nodes []ASTNode, predicate func(ASTNode) bool) bool {
+	for _, node := range nodes {
+		if !predicate(node) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isLispSymbol(node ASTNode) bool {
+	return node.Type == LispSymbolNode
+}
+
+func isLispKeyword(node ASTNode) bool {
+	return node.Type == LispKeywordNode
+}
+
+// renamed returns a copy of the nodes with the given type, e.g. symbols as
+// keywords, keeping their literals.
+func renamed(nodes []ASTNode, nodeType ASTNodeType) []ASTNode {
+	copies := []ASTNode{}
+	for _, node := range nodes {
+		copies = append(copies, ASTNode{Type: nodeType, Literal: node.Literal})
+	}
+
+	return copies
+}
+
+// keySignatureDataV1 returns the Alda 1 form of a key signature written as an
+// Alda 2 quoted list (or vector), i.e. a vector of keywords for a scale, or a
+// map of keywords to vectors of keywords for note letters and accidentals.
+func keySignatureDataV1(argument ASTNode) (ASTNode, bool) {
+	if argument.Type != LispQuotedFormNode || len(argument.Children) != 1 {
+		return ASTNode{}, false
+	}
+
+	list := argument.Children[0]
+	if list.Type != LispListNode && list.Type != LispVectorNode ||
+		len(list.Children) == 0 {
+		return ASTNode{}, false
+	}
+
+	// e.g. '(g minor)
+	if forAll(list.Children, isLispSymbol) {
+		return ASTNode{
+			Type:     LispVectorNode,
+			Children: renamed(list.Children, LispKeywordNode),
+		}, true
+	}
+
+	// e.g. '(f (sharp) c (sharp))
+	if len(list.Children)%2 != 0 {
+		return ASTNode{}, false
+	}
+
+	entries := []ASTNode{}
+	for i := 0; i < len(list.Children); i += 2 {
+		letter, accidentals := list.Children[i], list.Children[i+1]
+		if !isLispSymbol(letter) || accidentals.Type != LispListNode ||
+			!forAll(accidentals.Children, isLispSymbol) {
+			return ASTNode{}, false
+		}
+
+		entries = append(
+			entries,
+			ASTNode{Type: LispKeywordNode, Literal: letter.Literal},
+			ASTNode{
+				Type:     LispVectorNode,
+				Children: renamed(accidentals.Children, LispKeywordNode),
+			},
+		)
+	}
+
+	return ASTNode{Type: LispMapNode, Children: entries}, true
+}
+
+// keySignatureDataV2 returns the Alda 2 form of a key signature written as
+// Alda 1 Clojure data (see keySignatureDataV1), i.e. a quoted list.
+func keySignatureDataV2(argument ASTNode) (ASTNode, bool) {
+	quoted := func(forms []ASTNode) ASTNode {
+		return ASTNode{
+			Type:     LispQuotedFormNode,
+			Children: []ASTNode{{Type: LispListNode, Children: forms}},
+		}
+	}
+
+	switch argument.Type {
+	// e.g. [:g :minor]
+	case LispVectorNode:
+		if len(argument.Children) == 0 ||
+			!forAll(argument.Children, isLispKeyword) {
+			return ASTNode{}, false
+		}
+
+		return quoted(renamed(argument.Children, LispSymbolNode)), true
+
+	// e.g. {:f [:sharp] :c [:sharp]}
+	case LispMapNode:
+		if len(argument.Children) == 0 || len(argument.Children)%2 != 0 {
+			return ASTNode{}, false
+		}
+
+		forms := []ASTNode{}
+		for i := 0; i < len(argument.Children); i += 2 {
+			letter, accidentals := argument.Children[i], argument.Children[i+1]
+			if !isLispKeyword(letter) || accidentals.Type != LispVectorNode ||
+				!forAll(accidentals.Children, isLispKeyword) {
+				return ASTNode{}, false
+			}
+
+			forms = append(
+				forms,
+				ASTNode{Type: LispSymbolNode, Literal: letter.Literal},
+				ASTNode{
+					Type:     LispListNode,
+					Children: renamed(accidentals.Children, LispSymbolNode),
+				},
+			)
+		}
+
+		return quoted(forms), true
+	}
+
+	return ASTNode{}, false
+}
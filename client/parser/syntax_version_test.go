@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+func TestFormatSyntaxVersion(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label: "key signatures are written as they are by default",
+			given: "piano: (key-sig [:g :minor]) (key-sig '(f (sharp)))",
+			expected: "piano:\n" +
+				"  (key-sig [:g :minor]) (key-sig '(f (sharp)))\n",
+		},
+		formatTestCase{
+			label: "Alda 2 scale name for Alda 1",
+			given: "piano: (key-signature '(e flat major)) e",
+			opts: []formatterOption{
+				ConfigureSyntaxVersion(SyntaxVersion1),
+			},
+			expected: "piano:\n  (key-signature [:e :flat :major]) e\n",
+		},
+		formatTestCase{
+			label: "Alda 2 accidentals for Alda 1",
+			given: "piano: (key-sig! '(f (sharp) c (sharp)))",
+			opts: []formatterOption{
+				ConfigureSyntaxVersion(SyntaxVersion1),
+			},
+			expected: "piano:\n  (key-sig! {:f [:sharp] :c [:sharp]})\n",
+		},
+		formatTestCase{
+			label: "Alda 1 scale name for Alda 2",
+			given: "piano: (key-sig [:g :minor]) g",
+			opts: []formatterOption{
+				ConfigureSyntaxVersion(SyntaxVersion2),
+			},
+			expected: "piano:\n  (key-sig '(g minor)) g\n",
+		},
+		formatTestCase{
+			label: "Alda 1 accidentals for Alda 2",
+			given: "piano: (key-sig {:b [:flat] :e [:flat]})",
+			opts: []formatterOption{
+				ConfigureSyntaxVersion(SyntaxVersion2),
+			},
+			expected: "piano:\n  (key-sig '(b (flat) e (flat)))\n",
+		},
+		formatTestCase{
+			label: "strings are the same in both versions",
+			given: "piano: (key-sig \"f+ c+\")",
+			opts: []formatterOption{
+				ConfigureSyntaxVersion(SyntaxVersion1),
+			},
+			expected: "piano:\n  (key-sig \"f+ c+\")\n",
+		},
+		formatTestCase{
+			label: "other attributes are unaffected",
+			given: "piano: (tempo [:a :b]) (vol '(1 2))",
+			opts: []formatterOption{
+				ConfigureSyntaxVersion(SyntaxVersion1),
+			},
+			expected: "piano:\n  (tempo [:a :b]) (vol '(1 2))\n",
+		},
+		formatTestCase{
+			label: "Alda 1 accidentals as a string",
+			given: "piano: (key-sig {:b [:flat] :e [:flat]})",
+			opts: []formatterOption{
+				ConfigureSyntaxVersion(SyntaxVersion1),
+				ConfigureKeySignatureStyle(KeySignatureString),
+			},
+			expected: "piano:\n  (key-sig \"b- e-\")\n",
+		},
+		formatTestCase{
+			label: "string as Alda 1 accidentals",
+			given: "piano: (key-sig \"b- e-\")",
+			opts: []formatterOption{
+				ConfigureSyntaxVersion(SyntaxVersion1),
+				ConfigureKeySignatureStyle(KeySignatureList),
+			},
+			expected: "piano:\n  (key-sig {:b [:flat] :e [:flat]})\n",
+		},
+	)
+}
+
+func TestFormatUnsupportedSyntaxVersion(t *testing.T) {
+	ast, err := Parse("piece.alda", "piano: c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = FormatASTToCode(
+		ast, &bytes.Buffer{}, ConfigureSyntaxVersion(SyntaxVersion(3)),
+	)
+	if err == nil || err.Error() != "unsupported syntax version 3" {
+		t.Errorf("expected an unsupported syntax version error, got: %v", err)
+	}
+}
@@ -36,7 +36,7 @@ func executeParseTestCases(t *testing.T, testCases ...parseTestCase) {
 			return
 		}
 		if testCase.expectAST != nil {
-			diff := deep.Equal(testCase.expectAST, actualAST)
+			diff := deep.Equal(*testCase.expectAST, actualAST)
 			if diff != nil {
 				t.Error(testCase.label)
 				for _, diffItem := range diff {
@@ -91,9 +91,9 @@ func executeParseTestCases(t *testing.T, testCases ...parseTestCase) {
 			return
 		}
 
-		if diff := deep.Equal(actualAST, formattedAST); diff != nil {
+		if !Equal(actualAST, formattedAST) {
 			t.Error(testCase.label)
-			for _, diffItem := range diff {
+			for _, diffItem := range Diff(actualAST, formattedAST) {
 				t.Errorf("%v", diffItem)
 			}
 		}
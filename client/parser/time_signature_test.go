@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+func timeSignatureUpdate(
+	numerator int32, denominator int32,
+) model.AttributeUpdate {
+	return model.AttributeUpdate{
+		PartUpdate: model.TimeSignatureSet{
+			TimeSignature: model.TimeSignature{
+				Numerator: numerator, Denominator: denominator,
+			},
+		},
+	}
+}
+
+func TestTimeSignatures(t *testing.T) {
+	executeParseTestCases(
+		t,
+		parseTestCase{
+			label: "time signature shorthand",
+			given: "piano: 3/4 c d e | 6/8 f",
+			expectUpdates: []model.ScoreUpdate{
+				model.PartDeclaration{Names: []string{"piano"}},
+				timeSignatureUpdate(3, 4),
+				letterNote(model.C),
+				letterNote(model.D),
+				letterNote(model.E),
+				model.Barline{},
+				timeSignatureUpdate(6, 8),
+				letterNote(model.F),
+			},
+		},
+		parseTestCase{
+			label: "time signature at the start of an event sequence",
+			given: "[5/4 c]",
+			expectUpdates: []model.ScoreUpdate{
+				eventSequence(timeSignatureUpdate(5, 4), letterNote(model.C)),
+			},
+		},
+		parseTestCase{
+			label: "chord with note lengths",
+			given: "c4/e8/g2",
+			expectUpdates: []model.ScoreUpdate{
+				model.Chord{
+					Events: []model.ScoreUpdate{
+						noteWithLength(model.C, 4),
+						noteWithLength(model.E, 8),
+						noteWithLength(model.G, 2),
+					},
+				},
+			},
+		},
+		parseTestCase{
+			label: "note length after a tie and whitespace",
+			given: "c2~ 4",
+			expectUpdates: []model.ScoreUpdate{
+				cNoteWithDuration(
+					model.NoteLength{Denominator: 2},
+					model.NoteLength{Denominator: 4},
+				),
+			},
+		},
+	)
+}
+
+func TestTimeSignatureErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		given    string
+		expected string
+	}{
+		{
+			given: "piano: 3/5 c",
+			expected: "piece.alda:1:8 invalid time signature 3/5: the denominator " +
+				"must be a power of 2",
+		},
+		{
+			given: "piano: 0/4 c",
+			expected: "piece.alda:1:8 invalid time signature 0/4: the numerator " +
+				"must be positive",
+		},
+	} {
+		_, err := Parse("piece.alda", testCase.given)
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.given)
+			continue
+		}
+
+		if actual := err.Error(); actual != testCase.expected {
+			t.Errorf(
+				"%s\nexpected error: %s\nactual error: %s",
+				testCase.given, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+func TestFormatTimeSignatures(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "time signatures are written as shorthand",
+			given:    "piano: 3/4  c d e |\n6/8 f",
+			expected: "piano:\n  3/4 c d e | 6/8 f\n",
+		},
+	)
+}
+
+// The shorthand is equivalent to the time-signature attribute.
+func TestTimeSignatureShorthandEquivalence(t *testing.T) {
+	scoreFor := func(input string) *model.Score {
+		ast, err := Parse("piece.alda", input, SuppressSourceContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		updates, err := ast.Updates()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		score := model.NewScore()
+		if err := score.Update(updates...); err != nil {
+			t.Fatal(err)
+		}
+
+		return score
+	}
+
+	shorthand := scoreFor("piano: 3/4 c d e")
+	lisp := scoreFor("piano: (time-signature '(3 4)) c d e")
+
+	expected := model.TimeSignature{Numerator: 3, Denominator: 4}
+	if actual := shorthand.Parts[0].TimeSignature; actual != expected {
+		t.Errorf("expected time signature %s, got %s", expected, actual)
+	}
+
+	if !reflect.DeepEqual(shorthand.Events, lisp.Events) {
+		t.Errorf(
+			"expected the same events\nshorthand: %#v\nlisp: %#v",
+			shorthand.Events, lisp.Events,
+		)
+	}
+
+	if shorthand.Parts[0].TimeSignature != lisp.Parts[0].TimeSignature {
+		t.Errorf(
+			"expected the same time signature\nshorthand: %s\nlisp: %s",
+			shorthand.Parts[0].TimeSignature, lisp.Parts[0].TimeSignature,
+		)
+	}
+}
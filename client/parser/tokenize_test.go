@@ -0,0 +1,187 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	_ "alda.io/client/testing"
+)
+
+// tokenSummary is a compact representation of a token, for ease of comparison
+// in tests.
+type tokenSummary struct {
+	tokenType TokenType
+	text      string
+	start     string // line:column
+	end       string // line:column
+}
+
+func summarizeTokens(tokens []Token) []tokenSummary {
+	summaries := []tokenSummary{}
+
+	for _, token := range tokens {
+		summaries = append(summaries, tokenSummary{
+			tokenType: token.Type(),
+			text:      token.Text(),
+			start:     fmt.Sprintf("%d:%d", token.Start().Line, token.Start().Column),
+			end:       fmt.Sprintf("%d:%d", token.End().Line, token.End().Column),
+		})
+	}
+
+	return summaries
+}
+
+type tokenizeTestCase struct {
+	label    string
+	given    string
+	opts     []tokenizeOption
+	expected []tokenSummary
+}
+
+func executeTokenizeTestCases(t *testing.T, testCases ...tokenizeTestCase) {
+	for _, testCase := range testCases {
+		tokens, err := Tokenize(testCase.given, testCase.opts...)
+		if err != nil {
+			t.Error(testCase.label)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		actual := summarizeTokens(tokens)
+		// NB: deep.Equal ignores unexported fields, so we can't use it here.
+		if !reflect.DeepEqual(testCase.expected, actual) {
+			t.Error(testCase.label)
+			t.Errorf("expected:\n%+v\nactual:\n%+v", testCase.expected, actual)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	executeTokenizeTestCases(
+		t,
+		tokenizeTestCase{
+			label: "part with notes and a barline",
+			given: "piano: c8 d | e",
+			expected: []tokenSummary{
+				{Name, "piano", "1:1", "1:6"},
+				{Colon, ":", "1:6", "1:7"},
+				{NoteLetter, "c", "1:8", "1:9"},
+				{NoteLength, "8", "1:9", "1:10"},
+				{NoteLetter, "d", "1:11", "1:12"},
+				{Barline, "|", "1:13", "1:14"},
+				{NoteLetter, "e", "1:15", "1:16"},
+				{EOF, "", "1:16", "1:16"},
+			},
+		},
+		tokenizeTestCase{
+			label: "note with accidental and chord separators",
+			given: "c+2/e/g",
+			expected: []tokenSummary{
+				{NoteLetter, "c", "1:1", "1:2"},
+				{Sharp, "+", "1:2", "1:3"},
+				{NoteLength, "2", "1:3", "1:4"},
+				{Separator, "/", "1:4", "1:5"},
+				{NoteLetter, "e", "1:5", "1:6"},
+				{Separator, "/", "1:6", "1:7"},
+				{NoteLetter, "g", "1:7", "1:8"},
+				{EOF, "", "1:8", "1:8"},
+			},
+		},
+		tokenizeTestCase{
+			label: "time signature and chord",
+			given: "3/4 c4/e",
+			expected: []tokenSummary{
+				{TimeSignature, "3/4", "1:1", "1:4"},
+				{NoteLetter, "c", "1:5", "1:6"},
+				{NoteLength, "4", "1:6", "1:7"},
+				{Separator, "/", "1:7", "1:8"},
+				{NoteLetter, "e", "1:8", "1:9"},
+				{EOF, "", "1:9", "1:9"},
+			},
+		},
+		tokenizeTestCase{
+			label: "nested lisp forms",
+			given: `(key-sig '(e (flat)) "x")`,
+			expected: []tokenSummary{
+				{LeftParen, "(", "1:1", "1:2"},
+				{Symbol, "key-sig", "1:2", "1:9"},
+				{SingleQuote, "'", "1:10", "1:11"},
+				{LeftParen, "(", "1:11", "1:12"},
+				{Symbol, "e", "1:12", "1:13"},
+				{LeftParen, "(", "1:14", "1:15"},
+				{Symbol, "flat", "1:15", "1:19"},
+				{RightParen, ")", "1:19", "1:20"},
+				{RightParen, ")", "1:20", "1:21"},
+				{String, `"x"`, "1:22", "1:25"},
+				{RightParen, ")", "1:25", "1:26"},
+				{EOF, "", "1:26", "1:26"},
+			},
+		},
+		tokenizeTestCase{
+			label: "trivia is omitted by default",
+			given: "c # comment\n  d",
+			expected: []tokenSummary{
+				{NoteLetter, "c", "1:1", "1:2"},
+				{NoteLetter, "d", "2:3", "2:4"},
+				{EOF, "", "2:4", "2:4"},
+			},
+		},
+		tokenizeTestCase{
+			label: "trivia is included on request",
+			given: "c # comment\n  d",
+			opts:  []tokenizeOption{IncludeTrivia},
+			expected: []tokenSummary{
+				{NoteLetter, "c", "1:1", "1:2"},
+				{Whitespace, " ", "1:2", "1:3"},
+				{Comment, "# comment", "1:3", "1:12"},
+				{Whitespace, "\n  ", "1:12", "2:3"},
+				{NoteLetter, "d", "2:3", "2:4"},
+				{EOF, "", "2:4", "2:4"},
+			},
+		},
+	)
+}
+
+func TestTokenizeTriviaCoversInput(t *testing.T) {
+	given := "# intro\npiano: o4 c8 d e  | (tempo 120)\n\tV1: [c e]*2 # end"
+
+	tokens, err := Tokenize(given, IncludeTrivia)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := ""
+	for _, token := range tokens {
+		text += token.Text()
+	}
+
+	if text != given {
+		t.Errorf(
+			"expected tokens to cover the input:\n%q\nactual:\n%q", given, text,
+		)
+	}
+}
+
+func TestParseTokens(t *testing.T) {
+	given := "piano: c+2/e/g # chord\n(key-sig '(e (flat))) d"
+
+	expected, err := Parse("", given)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := Tokenize(given, IncludeTrivia)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := ParseTokens("", tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ASTEqual(expected, actual) {
+		t.Errorf("ASTs differ: %v", Diff(expected, actual))
+	}
+}
@@ -0,0 +1,713 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"alda.io/client/model"
+)
+
+// A transposeOption is a function that customizes Transpose.
+type transposeOption func(*transposer)
+
+// SpellWithSharps customizes Transpose to spell the pitches between note
+// letters with sharps, e.g. `c+`, whichever way the notes are transposed.
+func SpellWithSharps(t *transposer) {
+	t.spelling = model.Sharp
+}
+
+// SpellWithFlats customizes Transpose to spell the pitches between note letters
+// with flats, e.g. `d-`, whichever way the notes are transposed.
+func SpellWithFlats(t *transposer) {
+	t.spelling = model.Flat
+}
+
+// SkipPercussion customizes Transpose to leave the notes of percussion parts
+// as they are, as they stand for drums rather than pitches.
+func SkipPercussion(t *transposer) {
+	t.skipPercussion = true
+}
+
+// A transposedNote is what the first pass of Transpose finds out about a note
+// from the contexts in which it's played.
+type transposedNote struct {
+	// The key signature in effect where the note is played
+	keySignature [7]int32
+	// False if the key signature can't be determined without evaluating the
+	// score, or differs between the places where the note is played, e.g. in a
+	// variable referenced in different keys
+	keySignatureKnown bool
+	// Whether the note is played by a percussion part, and by any other part
+	percussion, pitched bool
+
+	// For a diatonic transposition (see TransposeDiatonic): whether the note is
+	// played where the key signature has been set by an attribute change, and
+	// where it hasn't, and the key signature in effect where the transposed note
+	// is played, i.e. the transposed key signature
+	keyed, unkeyed       bool
+	newKeySignature      [7]int32
+	newKeySignatureKnown bool
+}
+
+// A spelledPitch is the spelling of a transposed note: its note letter, the
+// number of semitones by which it's raised or lowered, and the number of
+// octaves by which it crosses into another octave.
+type spelledPitch struct {
+	letter  model.NoteLetter
+	offset  int32
+	octaves int32
+	// Whether the note is written without accidentals, in the key signature in
+	// effect, in which case the offset is only known if the key signature is
+	inKey, offsetKnown bool
+}
+
+// pitch returns the pitch of a spelled note relative to C in the octave of the
+// note before it was transposed.
+func (p spelledPitch) pitch() int32 {
+	return model.NoteLetterIntervals[p.letter] + p.offset + 12*p.octaves
+}
+
+type transposer struct {
+	semitones      int32
+	spelling       model.Accidental
+	skipPercussion bool
+	// The mapping of note letters and key signatures of a diatonic
+	// transposition, or nil for a chromatic one
+	diatonic *diatonicMapping
+	// The notes that are played, as far as it can be determined from the AST.
+	// Notes in variables that are never referenced aren't played.
+	notes map[*ASTNode]*transposedNote
+}
+
+// Transpose returns a copy of the AST where every note is rewritten so that it
+// sounds the given number of semitones higher, or lower if it's negative. The
+// result can be written as code with FormatASTToCode. The original AST is left
+// unchanged.
+//
+// Each note gets the note letter and accidentals of its new pitch, spelled with
+// sharps when transposing up and flats when transposing down (see
+// SpellWithSharps and SpellWithFlats). Key signatures are left as they are, so
+// a note only gets an accidental where the key signature in effect wouldn't
+// give it the right one, e.g. `f_` for F natural in G major. Where a note
+// crosses into another octave, e.g. `b` transposed up to `c`, octave changes
+// are added around it: `> c <`. This covers the notes of chords, cram
+// expressions, repeats, voices and variable definitions alike.
+//
+// The key signature of each note is worked out like the octave is in
+// CheckOctaveRange, whether it's written as note letters and accidentals or as
+// the name of a scale, e.g. `'(g minor)`. After a global key signature change,
+// e.g. `(key-sig! "f+")`, the key signatures of the other parts are unknown,
+// as it depends on timing, unless the change comes at the start of the score,
+// before any part is declared. Returns an error for a note without accidentals
+// whose key signature can't be determined without evaluating the score, as its
+// pitch isn't known.
+//
+// Octave changes can't be written within a glissando, so its notes are spelled
+// in the same octave, e.g. `a~~b` transposed up 2 semitones is `b~~b++`.
+// Returns an error for a glissando whose notes span too much of an octave to
+// be spelled that way.
+func Transpose(
+	root ASTNode, semitones int, opts ...transposeOption,
+) (ASTNode, error) {
+	t := &transposer{
+		semitones: int32(semitones),
+		spelling:  model.Sharp,
+		notes:     map[*ASTNode]*transposedNote{},
+	}
+	if semitones < 0 {
+		t.spelling = model.Flat
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	transposed := root.Clone()
+	if semitones == 0 {
+		return transposed, nil
+	}
+
+	percussion := percussionParts(transposed)
+
+	// The parts with global key signature changes, e.g. `(key-sig! "f+")`,
+	// which change the key signature of the other parts from the point in time
+	// at which they occur, which can't be determined from the AST, unless it's
+	// the start of the score
+	globalKeyParts := map[string]bool{}
+	initial := initialAttributeChanges(&transposed)
+
+	var tracker *octaveTracker
+	tracker = newOctaveTracker(func(node *ASTNode, context pitchContext) {
+		if isKeySignatureChange(*node) && !initial[node] {
+			name, _ := node.Children[0].Literal.(string)
+			if strings.HasSuffix(name, "!") {
+				globalKeyParts[tracker.currentKey] = true
+			}
+		}
+
+		if node.Type != NoteNode {
+			return
+		}
+
+		if len(globalKeyParts) > 1 ||
+			len(globalKeyParts) == 1 && !globalKeyParts[tracker.currentKey] {
+			context.keySignatureKnown = false
+		}
+
+		note, ok := t.notes[node]
+		if !ok {
+			note = &transposedNote{
+				keySignature:      context.keySignature,
+				keySignatureKnown: context.keySignatureKnown,
+			}
+			t.notes[node] = note
+		}
+
+		if context.keySignature != note.keySignature ||
+			!context.keySignatureKnown {
+			note.keySignatureKnown = false
+		}
+
+		if percussion[tracker.currentKey] {
+			note.percussion = true
+		} else {
+			note.pitched = true
+		}
+	})
+
+	tracker.walkRoot(&transposed)
+
+	if err := t.transposeNode(&transposed); err != nil {
+		return ASTNode{}, err
+	}
+
+	return transposed, nil
+}
+
+// initialAttributeChanges returns the attribute changes at the start of a
+// score, which come before any part is declared and any event is played, e.g.
+// `(key-sig! '(g minor))` on the first line. A global attribute change there
+// applies to every part from the start, so unlike one anywhere else, it
+// doesn't depend on timing.
+func initialAttributeChanges(root *ASTNode) map[*ASTNode]bool {
+	initial := map[*ASTNode]bool{}
+
+	if len(root.Children) == 0 || root.Children[0].Type != ImplicitPartNode {
+		return initial
+	}
+
+	part := &root.Children[0]
+	events := &part.Children[len(part.Children)-1]
+	for i := range events.Children {
+		if events.Children[i].Type != LispListNode {
+			break
+		}
+
+		initial[&events.Children[i]] = true
+	}
+
+	return initial
+}
+
+// transposeNode transposes the notes within a node.
+func (t *transposer) transposeNode(node *ASTNode) error {
+	switch node.Type {
+	case EventSequenceNode:
+		events, err := t.transposeEvents(node.Children)
+		if err != nil {
+			return err
+		}
+		node.Children = events
+		return nil
+
+	case RepeatNode, OnRepetitionsNode:
+		// The repeated event can be a single note, e.g. `c*4`, around which
+		// octave changes can only be added by making it an event sequence.
+		event := node.Children[0]
+		if event.Type == NoteNode || event.Type == GlissandoNode {
+			events, err := t.transposeEvents(node.Children[:1])
+			if err != nil {
+				return err
+			}
+
+			node.Children[0] = events[0]
+			if len(events) > 1 {
+				node.Children[0] = ASTNode{
+					Type:          EventSequenceNode,
+					SourceContext: event.SourceContext,
+					Children:      events,
+				}
+			}
+
+			return nil
+		}
+	}
+
+	for i := range node.Children {
+		if err := t.transposeNode(&node.Children[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transposeEvents returns a sequence of events with their notes transposed,
+// and octave changes added where needed, so that the octave is back where it
+// was at the end of the sequence.
+func (t *transposer) transposeEvents(events []ASTNode) ([]ASTNode, error) {
+	transposed, shift, err := t.transposeShifted(events, 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendOctaveChanges(transposed, octaveChanges(-shift)...), nil
+}
+
+// transposeShifted returns a sequence of events, or the children of a chord,
+// with their notes transposed. shift is the number of octaves by which the
+// octave has been shifted by the octave changes added so far, which are only
+// undone before the events that depend on the octave, so that a run of notes
+// that cross into the same octave are preceded by a single octave change.
+// Returns the shift at the end of the events, which the caller undoes.
+func (t *transposer) transposeShifted(
+	events []ASTNode, shift int32, inSequence bool,
+) ([]ASTNode, int32, error) {
+	transposed := []ASTNode{}
+
+	for i := range events {
+		event := &events[i]
+
+		switch event.Type {
+		case NoteNode:
+			octaves, err := t.transposeNote(event)
+			if err != nil {
+				return nil, 0, err
+			}
+			transposed = insertOctaveChanges(
+				transposed, octaveChanges(octaves-shift)...,
+			)
+			shift = octaves
+
+		case GlissandoNode:
+			octaves, err := t.transposeGlissando(event)
+			if err != nil {
+				return nil, 0, err
+			}
+			transposed = insertOctaveChanges(
+				transposed, octaveChanges(octaves-shift)...,
+			)
+			shift = octaves
+
+		case ChordNode:
+			children, chordShift, err := t.transposeShifted(
+				event.Children, shift, false,
+			)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			// A chord starts on a note, so the octave changes before its first
+			// note are written before it.
+			for len(children) > 0 && (children[0].Type == OctaveUpNode ||
+				children[0].Type == OctaveDownNode) {
+				transposed = insertOctaveChanges(transposed, children[0])
+				children = children[1:]
+			}
+
+			event.Children = children
+			shift = chordShift
+
+		case OctaveSetNode:
+			// The octave is set regardless of the shift.
+			shift = 0
+
+		case OctaveUpNode, OctaveDownNode:
+			// The octave is changed relative to the shift, which carries on.
+			transposed = appendOctaveChanges(transposed, *event)
+			continue
+
+		case RestNode, BarlineNode, MarkerNode, AtMarkerNode, DynamicNode,
+			TimeSignatureNode, MultiMeasureRestNode:
+			// These don't depend on the octave.
+
+		default:
+			transposed = appendOctaveChanges(transposed, octaveChanges(-shift)...)
+			shift = 0
+
+			if inSequence {
+				if err := t.transposeNode(event); err != nil {
+					return nil, 0, err
+				}
+			}
+		}
+
+		transposed = append(transposed, *event)
+	}
+
+	return transposed, shift, nil
+}
+
+// appendOctaveChanges appends octave changes to a sequence of events, where
+// each one cancels out an opposite octave change at the end of the sequence,
+// e.g. `>` after `<`, rather than being appended.
+func appendOctaveChanges(events []ASTNode, changes ...ASTNode) []ASTNode {
+	for _, change := range changes {
+		if len(events) > 0 {
+			last := events[len(events)-1].Type
+			if last == OctaveUpNode && change.Type == OctaveDownNode ||
+				last == OctaveDownNode && change.Type == OctaveUpNode {
+				events = events[:len(events)-1]
+				continue
+			}
+		}
+
+		events = append(events, change)
+	}
+
+	return events
+}
+
+// insertOctaveChanges adds the octave changes before a note to a sequence of
+// events, like appendOctaveChanges, except that they go before any key
+// signature changes at the end of the sequence. That's because the model only
+// lets a part's own key signature change take precedence over a global one at
+// the same point in time, e.g. `(key-sig! "f+")` at the start of the score, if
+// it's the last attribute change before the note.
+func insertOctaveChanges(events []ASTNode, changes ...ASTNode) []ASTNode {
+	i := len(events)
+	for i > 0 && isKeySignatureChange(events[i-1]) {
+		i--
+	}
+
+	keySignatureChanges := append([]ASTNode{}, events[i:]...)
+	return append(
+		appendOctaveChanges(events[:i], changes...), keySignatureChanges...,
+	)
+}
+
+// octaveChanges returns the octave changes that shift the octave by the given
+// number of octaves, e.g. `>>` for 2.
+func octaveChanges(octaves int32) []ASTNode {
+	changes := []ASTNode{}
+
+	for ; octaves > 0; octaves-- {
+		changes = append(changes, ASTNode{Type: OctaveUpNode})
+	}
+	for ; octaves < 0; octaves++ {
+		changes = append(changes, ASTNode{Type: OctaveDownNode})
+	}
+
+	return changes
+}
+
+// transposeGlissando transposes the notes of a glissando, and returns the
+// number of octaves by which they cross into another octave. Octave changes
+// can't be written within a glissando, so its notes are all spelled in the
+// same octave, that of one of its notes (see spellNote).
+func (t *transposer) transposeGlissando(glissando *ASTNode) (int32, error) {
+	type glissandoNote struct {
+		node    *ASTNode
+		info    *transposedNote
+		spelled spelledPitch
+	}
+
+	notes := []glissandoNote{}
+
+	for i := range glissando.Children {
+		node := &glissando.Children[i]
+		if node.Type != NoteNode {
+			continue
+		}
+
+		spelled, info, ok, err := t.transposedPitch(node)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+
+		notes = append(notes, glissandoNote{node, info, spelled})
+	}
+
+	for _, candidate := range notes {
+		octave := candidate.spelled.octaves
+
+		fits := true
+		for _, note := range notes {
+			_, _, ok := spellInOctave(note.spelled.pitch(), octave)
+			if note.spelled.octaves != octave && !(note.spelled.offsetKnown && ok) {
+				fits = false
+			}
+		}
+		if !fits {
+			continue
+		}
+
+		for _, note := range notes {
+			t.spellNote(note.node, note.info, note.spelled, &octave)
+		}
+		return octave, nil
+	}
+
+	if len(notes) == 0 {
+		return 0, nil
+	}
+
+	return 0, &model.AldaSourceError{
+		Context: glissando.SourceContext,
+		Err: fmt.Errorf(
+			"can't transpose a glissando whose notes can't be written in the " +
+				"same octave, as octave changes can't be written within it",
+		),
+	}
+}
+
+// transposeNote rewrites the note letter and accidentals of a note, and
+// returns the number of octaves by which the new pitch crosses into another
+// octave, e.g. 1 for `b` transposed up to `c`.
+func (t *transposer) transposeNote(note *ASTNode) (int32, error) {
+	spelled, info, ok, err := t.transposedPitch(note)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	return t.spellNote(note, info, spelled, nil), nil
+}
+
+// transposedPitch returns the spelling of a transposed note, along with what's
+// known about the note. Returns false if the note is left as it is.
+func (t *transposer) transposedPitch(
+	note *ASTNode,
+) (spelledPitch, *transposedNote, bool, error) {
+	info, played := t.notes[note]
+	if !played {
+		// A note that isn't played, e.g. in a variable that's never referenced,
+		// is transposed as if there were no key signature.
+		info = &transposedNote{
+			keySignatureKnown:    true,
+			pitched:              true,
+			unkeyed:              true,
+			newKeySignatureKnown: true,
+		}
+	}
+
+	if t.skipPercussion && info.percussion {
+		if info.pitched {
+			return spelledPitch{}, nil, false, &model.AldaSourceError{
+				Context: note.SourceContext,
+				Err: fmt.Errorf(
+					"can't skip a note that's played by both percussion and other " +
+						"parts",
+				),
+			}
+		}
+
+		return spelledPitch{}, nil, false, nil
+	}
+
+	letter, accidentals, ok := noteLetterAndAccidentals(note.Children[0])
+	if !ok {
+		return spelledPitch{}, nil, false, nil
+	}
+
+	if t.diatonic != nil {
+		spelled, err := t.diatonic.transposedPitch(note, letter, accidentals, info)
+		return spelled, info, err == nil, err
+	}
+
+	// The number of semitones by which the note is raised or lowered from its
+	// note letter
+	offset := accidentalsOffset(accidentals)
+	if accidentals == nil {
+		if !info.keySignatureKnown {
+			return spelledPitch{}, nil, false, errUnknownKeySignature(note)
+		}
+
+		offset = info.keySignature[letter]
+	}
+
+	spelled := t.spell(model.NoteLetterIntervals[letter] + offset + t.semitones)
+	return spelled, info, true, nil
+}
+
+// errUnknownKeySignature returns the error for a note without accidentals
+// whose pitch depends on a key signature that can't be determined.
+func errUnknownKeySignature(note *ASTNode) error {
+	return &model.AldaSourceError{
+		Context: note.SourceContext,
+		Err: fmt.Errorf(
+			"can't transpose a note without accidentals whose key signature " +
+				"can't be determined without evaluating the score",
+		),
+	}
+}
+
+// accidentalsOffset returns the number of semitones by which accidentals raise
+// or lower a note.
+func accidentalsOffset(accidentals []model.Accidental) int32 {
+	offset := int32(0)
+	for _, accidental := range accidentals {
+		switch accidental {
+		case model.Sharp:
+			offset++
+		case model.Flat:
+			offset--
+		}
+	}
+
+	return offset
+}
+
+// spell returns the spelling of a pitch relative to C in some octave: its note
+// letter, the number of semitones by which it's raised or lowered (see
+// spellPitchClass), and the number of octaves by which it's above that octave.
+func (t *transposer) spell(pitch int32) spelledPitch {
+	letter, offset := spellPitchClass((pitch%12+12)%12, t.spelling)
+
+	// The difference in pitch that isn't made up by the note letter and
+	// accidentals is a whole number of octaves.
+	octaves := floorDiv(pitch-model.NoteLetterIntervals[letter]-offset, 12)
+
+	return spelledPitch{
+		letter: letter, offset: offset, octaves: octaves, offsetKnown: true,
+	}
+}
+
+// spellInOctave returns the spelling of a pitch relative to C in some octave,
+// written in the given number of octaves above it, as a B or a C and the
+// number of semitones by which it's raised or lowered. Returns false if it
+// takes more than two accidentals.
+func spellInOctave(pitch int32, octave int32) (model.NoteLetter, int32, bool) {
+	letter := model.C
+	if pitch-12*octave > 6 {
+		letter = model.B
+	}
+
+	offset := pitch - 12*octave - model.NoteLetterIntervals[letter]
+	return letter, offset, -2 <= offset && offset <= 2
+}
+
+// spellNote rewrites the note letter and accidentals of a note as they're
+// spelled (see transposedPitch), and returns the number of octaves by which the
+// note crosses into another octave.
+//
+// If an octave is given, the note is spelled so that it crosses by that many
+// octaves instead, with a B or a C and as many accidentals as it takes (see
+// spellInOctave), e.g. `b+` rather than `> c`.
+func (t *transposer) spellNote(
+	note *ASTNode, info *transposedNote, spelled spelledPitch, octave *int32,
+) int32 {
+	if octave != nil && spelled.octaves != *octave {
+		letter, offset, _ := spellInOctave(spelled.pitch(), *octave)
+		spelled = spelledPitch{
+			letter: letter, offset: offset, octaves: *octave, offsetKnown: true,
+		}
+	}
+
+	newLetter, newOffset := spelled.letter, spelled.offset
+
+	keySignature, known := info.keySignature, info.keySignatureKnown
+	if t.diatonic != nil {
+		keySignature, known = info.newKeySignature, info.newKeySignatureKnown
+	}
+
+	newAccidentals := []ASTNode{}
+	if !spelled.inKey && (!known || keySignature[newLetter] != newOffset) {
+		for i := newOffset; i > 0; i-- {
+			newAccidentals = append(newAccidentals, ASTNode{Type: SharpNode})
+		}
+		for i := newOffset; i < 0; i++ {
+			newAccidentals = append(newAccidentals, ASTNode{Type: FlatNode})
+		}
+		if newOffset == 0 {
+			newAccidentals = append(newAccidentals, ASTNode{Type: NaturalNode})
+		}
+	}
+
+	pitch := &note.Children[0]
+	pitch.Children = []ASTNode{{
+		Type:          NoteLetterNode,
+		SourceContext: pitch.Children[0].SourceContext,
+		Literal:       rune(strings.ToLower(newLetter.String())[0]),
+	}}
+	if len(newAccidentals) > 0 {
+		pitch.Children = append(pitch.Children, ASTNode{
+			Type: NoteAccidentalsNode, Children: newAccidentals,
+		})
+	}
+
+	return spelled.octaves
+}
+
+// noteLetterAndAccidentals returns the note letter and accidentals of a
+// NoteLetterAndAccidentalsNode. The accidentals are nil if there aren't any,
+// in which case the note is played in the key signature.
+func noteLetterAndAccidentals(
+	pitch ASTNode,
+) (model.NoteLetter, []model.Accidental, bool) {
+	var letter model.NoteLetter
+	var accidentals []model.Accidental
+	hasLetter := false
+
+	for _, node := range pitch.Children {
+		switch node.Type {
+		case NoteLetterNode:
+			letterRune, _ := node.Literal.(rune)
+			noteLetter, err := model.NewNoteLetter(letterRune)
+			if err != nil {
+				return 0, nil, false
+			}
+			letter = noteLetter
+			hasLetter = true
+
+		case NoteAccidentalsNode:
+			accidentals = []model.Accidental{}
+			for _, accidental := range node.Children {
+				switch accidental.Type {
+				case SharpNode:
+					accidentals = append(accidentals, model.Sharp)
+				case FlatNode:
+					accidentals = append(accidentals, model.Flat)
+				case NaturalNode:
+					accidentals = append(accidentals, model.Natural)
+				}
+			}
+		}
+	}
+
+	return letter, accidentals, hasLetter
+}
+
+// spellPitchClass returns the note letter of a pitch class (0 for C to 11 for
+// B), and the number of semitones by which it's raised or lowered, which is
+// only non-zero if the pitch class is between two note letters, in which case
+// it's spelled with the given accidental.
+func spellPitchClass(
+	pitchClass int32, accidental model.Accidental,
+) (model.NoteLetter, int32) {
+	step := int32(1)
+	if accidental == model.Flat {
+		step = -1
+	}
+
+	for _, offset := range []int32{0, step} {
+		for _, letter := range noteLettersInOrder {
+			if (model.NoteLetterIntervals[letter]+offset+12)%12 == pitchClass {
+				return letter, offset
+			}
+		}
+	}
+
+	// Unreachable, as every pitch class is a note letter or next to one
+	return model.C, 0
+}
+
+// floorDiv returns a divided by b, rounded down.
+func floorDiv(a, b int32) int32 {
+	quotient := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		quotient--
+	}
+	return quotient
+}
@@ -0,0 +1,479 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"alda.io/client/model"
+)
+
+// A Key is a tonic and a scale type, e.g. E-flat major, which is
+// {Tonic: {model.E, [model.Flat]}, Scale: model.Ionian}.
+type Key struct {
+	Tonic model.LetterAndAccidentals
+	Scale model.ScaleType
+}
+
+// The scale types, keyed by the names by which they're written in a key
+// signature, e.g. `'(g minor)`
+var scaleTypes = map[string]model.ScaleType{
+	"major":      model.Ionian,
+	"ionian":     model.Ionian,
+	"dorian":     model.Dorian,
+	"phrygian":   model.Phrygian,
+	"lydian":     model.Lydian,
+	"mixolydian": model.Mixolydian,
+	"minor":      model.Aeolian,
+	"aeolian":    model.Aeolian,
+	"locrian":    model.Locrian,
+}
+
+// The names of the scale types, one per scale type, in the order in which
+// they're tried when writing the name of a scale
+var scaleNames = []string{
+	"major", "minor", "dorian", "phrygian", "lydian", "mixolydian", "locrian",
+}
+
+// The order in which sharps and flats are written in a key signature
+var (
+	orderOfSharps = []model.NoteLetter{
+		model.F, model.C, model.G, model.D, model.A, model.E, model.B,
+	}
+	orderOfFlats = []model.NoteLetter{
+		model.B, model.E, model.A, model.D, model.G, model.C, model.F,
+	}
+)
+
+// A diatonicMapping maps the notes and key signatures of one key to another,
+// scale degree by scale degree.
+type diatonicMapping struct {
+	// The number of note letters by which notes are moved up, or down if it's
+	// negative
+	steps int32
+	// The key signatures of the two keys, indexed by model.NoteLetter
+	from, to [7]int32
+}
+
+// newDiatonicMapping returns the mapping from one key to another, which moves
+// notes whichever way is the shorter, e.g. up a minor third from C to E-flat,
+// rather than down a major sixth.
+func newDiatonicMapping(from, to Key) diatonicMapping {
+	fromPosition := letterPosition(from.Tonic.NoteLetter)
+	toPosition := letterPosition(to.Tonic.NoteLetter)
+
+	stepsUp := (toPosition - fromPosition + 7) % 7
+	semitonesUp := model.NoteLetterIntervals[to.Tonic.NoteLetter] +
+		accidentalsOffset(to.Tonic.Accidentals) -
+		model.NoteLetterIntervals[from.Tonic.NoteLetter] -
+		accidentalsOffset(from.Tonic.Accidentals)
+	if toPosition < fromPosition {
+		semitonesUp += 12
+	}
+
+	steps := stepsUp
+	if stepsUp > 0 && abs(semitonesUp-12) < abs(semitonesUp) {
+		steps -= 7
+	}
+
+	return diatonicMapping{
+		steps: steps,
+		from:  scaleKeySignature(from.Tonic, from.Scale),
+		to:    scaleKeySignature(to.Tonic, to.Scale),
+	}
+}
+
+// letter returns the note letter to which a note letter is mapped, and the
+// number of octaves by which it crosses into another octave.
+func (m diatonicMapping) letter(
+	letter model.NoteLetter,
+) (model.NoteLetter, int32) {
+	position := letterPosition(letter) + m.steps
+	return noteLettersInOrder[(position%7+7)%7], floorDiv(position, 7)
+}
+
+// offset returns the number of semitones by which a note is raised or lowered
+// once it's mapped, given the number by which it's raised or lowered before:
+// it's altered as much from the key signature of the target key as it was from
+// that of the source key, e.g. F-sharp in C major is A natural in E-flat major.
+func (m diatonicMapping) offset(letter model.NoteLetter, offset int32) int32 {
+	newLetter, _ := m.letter(letter)
+	return m.to[newLetter] + offset - m.from[letter]
+}
+
+// keySignature returns the key signature to which a key signature is mapped.
+func (m diatonicMapping) keySignature(keySignature [7]int32) [7]int32 {
+	mapped := [7]int32{}
+	for _, letter := range noteLettersInOrder {
+		newLetter, _ := m.letter(letter)
+		mapped[newLetter] = m.offset(letter, keySignature[letter])
+	}
+
+	return mapped
+}
+
+// transposedPitch returns the spelling of a note mapped to another key. A note
+// without accidentals is only written with them if it's played where the key
+// signature hasn't been set, as the key signatures that have been are mapped
+// along with it.
+func (m diatonicMapping) transposedPitch(
+	note *ASTNode,
+	letter model.NoteLetter,
+	accidentals []model.Accidental,
+	info *transposedNote,
+) (spelledPitch, error) {
+	newLetter, octaves := m.letter(letter)
+	spelled := spelledPitch{
+		letter:      newLetter,
+		octaves:     octaves,
+		offsetKnown: true,
+	}
+
+	if accidentals != nil {
+		spelled.offset = m.offset(letter, accidentalsOffset(accidentals))
+		return spelled, nil
+	}
+
+	if info.keyed && info.unkeyed {
+		return spelledPitch{}, errUnknownKeySignature(note)
+	}
+
+	spelled.inKey = info.keyed
+	spelled.offsetKnown = info.keySignatureKnown
+	spelled.offset = m.offset(letter, info.keySignature[letter])
+
+	return spelled, nil
+}
+
+// TransposeDiatonic returns a copy of the AST where every note is moved from
+// one key to another by scale degree, e.g. `c e g` in C major to `e- g b-` in
+// E-flat major, and every key signature attribute change, e.g. `(key-sig
+// "f+")`, is changed to the corresponding key signature of the target key. The
+// result can be written as code with FormatASTToCode. The original AST is left
+// unchanged.
+//
+// A note that's raised or lowered from the source key is raised or lowered as
+// much from the target key, e.g. `f+` in C major is `a_` in E-flat major, so
+// chromatic notes keep their function. A note without accidentals stays
+// without them where a key signature has been set, and otherwise gets the
+// accidentals of its new pitch. Notes are moved whichever way is the shorter,
+// and a note that crosses into another octave gets octave changes around it,
+// like in Transpose, which also describes the limits of working out the key
+// signature of a note from the AST. Unlike in Transpose, a key signature
+// written as the name of a scale, e.g. `'(a major)`, is transposed too.
+//
+// Returns an error for a key signature attribute change whose argument isn't
+// written as note letters and accidentals or as the name of a scale, as it
+// can't be transposed.
+func TransposeDiatonic(root ASTNode, fromKey, toKey Key) (ASTNode, error) {
+	mapping := newDiatonicMapping(fromKey, toKey)
+	t := &transposer{
+		diatonic: &mapping,
+		notes:    map[*ASTNode]*transposedNote{},
+	}
+
+	transposed := root.Clone()
+
+	// The parts with global key signature changes (see Transpose for the
+	// caveats of global changes)
+	globalKeyParts := map[string]bool{}
+	initial := initialAttributeChanges(&transposed)
+
+	var tracker *octaveTracker
+	tracker = newOctaveTracker(func(node *ASTNode, context pitchContext) {
+		if isKeySignatureChange(*node) && !initial[node] {
+			name, _ := node.Children[0].Literal.(string)
+			if strings.HasSuffix(name, "!") {
+				globalKeyParts[tracker.currentKey] = true
+			}
+		}
+
+		if node.Type != NoteNode {
+			return
+		}
+
+		// Whether the key signature has been set is tracked for each voice,
+		// like the key signature itself.
+		keyed, unkeyed := context.keyed, context.unkeyed
+
+		newKeySignature := [7]int32{}
+		newKeySignatureKnown := true
+		if keyed {
+			newKeySignature = mapping.keySignature(context.keySignature)
+			newKeySignatureKnown = context.keySignatureKnown
+		}
+
+		if len(globalKeyParts) > 1 ||
+			len(globalKeyParts) == 1 && !globalKeyParts[tracker.currentKey] {
+			keyed, unkeyed = true, true
+			newKeySignatureKnown = false
+		}
+
+		note, ok := t.notes[node]
+		if !ok {
+			note = &transposedNote{
+				keySignature:         context.keySignature,
+				keySignatureKnown:    context.keySignatureKnown,
+				newKeySignature:      newKeySignature,
+				newKeySignatureKnown: newKeySignatureKnown,
+			}
+			t.notes[node] = note
+		}
+
+		if context.keySignature != note.keySignature ||
+			!context.keySignatureKnown {
+			note.keySignatureKnown = false
+		}
+		if newKeySignature != note.newKeySignature || !newKeySignatureKnown {
+			note.newKeySignatureKnown = false
+		}
+
+		note.keyed = note.keyed || keyed
+		note.unkeyed = note.unkeyed || unkeyed
+		note.pitched = true
+	})
+
+	tracker.walkRoot(&transposed)
+
+	if err := mapping.transposeKeySignatures(&transposed); err != nil {
+		return ASTNode{}, err
+	}
+
+	if err := t.transposeNode(&transposed); err != nil {
+		return ASTNode{}, err
+	}
+
+	return transposed, nil
+}
+
+// transposeKeySignatures maps the argument of each key signature attribute
+// change within a node, keeping it in the syntax in which it's written (see
+// ConvertSyntaxVersion).
+func (m diatonicMapping) transposeKeySignatures(node *ASTNode) error {
+	for i := range node.Children {
+		if err := m.transposeKeySignatures(&node.Children[i]); err != nil {
+			return err
+		}
+	}
+
+	if !isKeySignatureChange(*node) {
+		return nil
+	}
+
+	argument := node.Children[1]
+
+	version1 := argument.Type == LispVectorNode || argument.Type == LispMapNode
+	if version1 {
+		argument, _ = keySignatureDataV2(argument)
+	}
+
+	transposed, ok := m.transposeKeySignature(argument)
+	if ok && version1 {
+		transposed, ok = keySignatureDataV1(transposed)
+	}
+	if !ok {
+		return &model.AldaSourceError{
+			Context: node.SourceContext,
+			Err: fmt.Errorf(
+				"can't transpose a key signature that isn't written as note " +
+					"letters and accidentals or as the name of a scale",
+			),
+		}
+	}
+
+	node.Children[1] = transposed
+	return nil
+}
+
+// transposeKeySignature returns the mapped argument of a key signature
+// attribute change. A key signature written as the name of a scale is written
+// as the name of a scale on the mapped tonic, of the same type where it can be,
+// e.g. `'(c major)` mapped from C major to C minor is `'(c minor)`. If the key
+// signature maps to one that isn't that of a scale, it's written as note
+// letters and accidentals instead.
+func (m diatonicMapping) transposeKeySignature(
+	argument ASTNode,
+) (ASTNode, bool) {
+	// A key signature without any note letters, e.g. `""`, is that of C major.
+	text, _ := argument.Literal.(string)
+	empty := argument.Type == LispStringNode && strings.TrimSpace(text) == ""
+
+	if _, ok := keySignatureEntries(argument); ok || empty {
+		context := pitchContext{}
+		changeKeySignature(&context, argument)
+		if !context.keySignatureKnown {
+			return ASTNode{}, false
+		}
+
+		// The model doesn't accept a key signature without any note letters
+		// written as a list, and an empty string reads like a mistake, so it's
+		// written as the name of the scale without accidentals instead.
+		entries := keySignatureEntriesOf(m.keySignature(context.keySignature))
+		if len(entries) == 0 {
+			return keySignatureScaleForm(
+				model.LetterAndAccidentals{NoteLetter: model.C}, "major",
+			), true
+		}
+
+		if argument.Type == LispStringNode {
+			return keySignatureString(entries), true
+		}
+		return keySignatureList(entries)
+	}
+
+	tonic, scaleName, ok := keySignatureScale(argument)
+	if !ok {
+		return ASTNode{}, false
+	}
+	scale := scaleTypes[scaleName]
+
+	mapped := m.keySignature(scaleKeySignature(tonic, scale))
+
+	newLetter, _ := m.letter(tonic.NoteLetter)
+	newOffset := m.offset(tonic.NoteLetter, accidentalsOffset(tonic.Accidentals))
+	newTonic := model.LetterAndAccidentals{NoteLetter: newLetter}
+	for i := newOffset; i > 0; i-- {
+		newTonic.Accidentals = append(newTonic.Accidentals, model.Sharp)
+	}
+	for i := newOffset; i < 0; i++ {
+		newTonic.Accidentals = append(newTonic.Accidentals, model.Flat)
+	}
+
+	newScaleName, ok := "", false
+	for _, name := range append([]string{scaleName}, scaleNames...) {
+		if scaleKeySignature(newTonic, scaleTypes[name]) == mapped {
+			newScaleName, ok = name, true
+			break
+		}
+	}
+	if !ok {
+		return keySignatureList(keySignatureEntriesOf(mapped))
+	}
+
+	return keySignatureScaleForm(newTonic, newScaleName), true
+}
+
+// keySignatureScaleForm returns the argument of a key signature attribute
+// change written as the name of a scale, e.g. `'(e flat major)`.
+func keySignatureScaleForm(
+	tonic model.LetterAndAccidentals, scaleName string,
+) ASTNode {
+	forms := []ASTNode{{
+		Type:    LispSymbolNode,
+		Literal: strings.ToLower(tonic.NoteLetter.String()),
+	}}
+	for _, accidental := range tonic.Accidentals {
+		name := "sharp"
+		if accidental == model.Flat {
+			name = "flat"
+		}
+		forms = append(forms, ASTNode{Type: LispSymbolNode, Literal: name})
+	}
+	forms = append(forms, ASTNode{Type: LispSymbolNode, Literal: scaleName})
+
+	return ASTNode{
+		Type:     LispQuotedFormNode,
+		Children: []ASTNode{{Type: LispListNode, Children: forms}},
+	}
+}
+
+// keySignatureScale returns the tonic and the name of the scale type of a key
+// signature written as the name of a scale, e.g. `'(e flat major)`.
+func keySignatureScale(
+	argument ASTNode,
+) (model.LetterAndAccidentals, string, bool) {
+	if argument.Type != LispQuotedFormNode || len(argument.Children) != 1 {
+		return model.LetterAndAccidentals{}, "", false
+	}
+
+	forms := argument.Children[0].Children
+	if len(forms) < 2 || !forAll(forms, isLispSymbol) {
+		return model.LetterAndAccidentals{}, "", false
+	}
+
+	letterName, _ := forms[0].Literal.(string)
+	scaleName, _ := forms[len(forms)-1].Literal.(string)
+	if _, ok := scaleTypes[scaleName]; !ok || !isNoteLetterName(letterName) {
+		return model.LetterAndAccidentals{}, "", false
+	}
+
+	letter, _ := model.NewNoteLetter(rune(letterName[0]))
+	tonic := model.LetterAndAccidentals{NoteLetter: letter}
+
+	for _, form := range forms[1 : len(forms)-1] {
+		switch form.Literal {
+		case "sharp":
+			tonic.Accidentals = append(tonic.Accidentals, model.Sharp)
+		case "flat":
+			tonic.Accidentals = append(tonic.Accidentals, model.Flat)
+		default:
+			return model.LetterAndAccidentals{}, "", false
+		}
+	}
+
+	return tonic, scaleName, true
+}
+
+// scaleKeySignature returns the number of semitones by which the key signature
+// of a scale raises or lowers each note letter, indexed by model.NoteLetter.
+func scaleKeySignature(
+	tonic model.LetterAndAccidentals, scale model.ScaleType,
+) [7]int32 {
+	offsets := [7]int32{}
+	for letter, accidentals := range model.KeySignatureFromScale(tonic, scale) {
+		offsets[letter] = accidentalsOffset(accidentals)
+	}
+
+	return offsets
+}
+
+// keySignatureEntriesOf returns the entries of a key signature given the
+// number of semitones by which it raises or lowers each note letter, with the
+// sharps and then the flats in the order in which they're conventionally
+// written, e.g. `f+ c+` rather than `c+ f+`.
+func keySignatureEntriesOf(offsets [7]int32) []keySignatureEntry {
+	entries := []keySignatureEntry{}
+
+	for _, order := range []struct {
+		letters    []model.NoteLetter
+		sign       int32
+		accidental string
+	}{
+		{orderOfSharps, 1, "sharp"},
+		{orderOfFlats, -1, "flat"},
+	} {
+		for _, letter := range order.letters {
+			entry := keySignatureEntry{
+				letter:      strings.ToLower(letter.String()),
+				accidentals: []string{},
+			}
+			for i := offsets[letter] * order.sign; i > 0; i-- {
+				entry.accidentals = append(entry.accidentals, order.accidental)
+			}
+
+			if len(entry.accidentals) > 0 {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return entries
+}
+
+// letterPosition returns the position of a note letter in an octave, from 0
+// for C to 6 for B.
+func letterPosition(letter model.NoteLetter) int32 {
+	for i, inOrder := range noteLettersInOrder {
+		if inOrder == letter {
+			return int32(i)
+		}
+	}
+
+	return 0
+}
+
+func abs(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,260 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+// key returns the key with the given tonic and scale type.
+func key(
+	letter model.NoteLetter, scale model.ScaleType, accidentals ...model.Accidental,
+) Key {
+	return Key{
+		Tonic: model.LetterAndAccidentals{
+			NoteLetter: letter, Accidentals: accidentals,
+		},
+		Scale: scale,
+	}
+}
+
+var (
+	cMajor      = key(model.C, model.Ionian)
+	cMinor      = key(model.C, model.Aeolian)
+	dMajor      = key(model.D, model.Ionian)
+	gMajor      = key(model.G, model.Ionian)
+	aMajor      = key(model.A, model.Ionian)
+	bMajor      = key(model.B, model.Ionian)
+	eFlatMajor  = key(model.E, model.Ionian, model.Flat)
+	bFlatMajor  = key(model.B, model.Ionian, model.Flat)
+	fSharpMajor = key(model.F, model.Ionian, model.Sharp)
+)
+
+// transposeDiatonicToCode transposes source code from one key to another and
+// formats the result.
+func transposeDiatonicToCode(given string, from, to Key) (string, error) {
+	ast, err := Parse("piece.alda", given)
+	if err != nil {
+		return "", err
+	}
+
+	transposed, err := TransposeDiatonic(ast, from, to)
+	if err != nil {
+		return "", err
+	}
+
+	buffer := bytes.Buffer{}
+	if err := FormatASTToCode(transposed, &buffer); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// A melody in C major with secondary dominants: V/V (D7, with F-sharp), V/vi
+// (E7, with G-sharp), V/ii (A7, with C-sharp) and V/IV (C7, with B-flat)
+const secondaryDominants = "piano: (key-sig '(c major)) o4 " +
+	"c e g a | d f+ a > c < | g b > d < b | e g+ b > d < | " +
+	"a > c+ e g < | c e g b- | f a > c < a | g b > d f | e1 <"
+
+func TestTransposeDiatonic(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		from, to Key
+		expected string
+	}{
+		{
+			label: "secondary dominants from C to E-flat",
+			given: secondaryDominants,
+			from:  cMajor,
+			to:    eFlatMajor,
+			expected: "piano:\n" +
+				"  (key-sig '(e flat major)) o4 e g b > c | < f a_ > c e < | " +
+				"b > d f d | < g b_ >\n" +
+				"  d f < | > c e_ g b < | e g b > d- | < a > c e c | " +
+				"< b > d f a | g1 <\n",
+		},
+		{
+			label:    "no key signature",
+			given:    "piano: c e g b- f+ a",
+			from:     cMajor,
+			to:       eFlatMajor,
+			expected: "piano:\n  e- g b- > d- < a > c <\n",
+		},
+		{
+			label:    "key signature as a string",
+			given:    "piano: (key-sig \"f+\") g b > d < c+ f_ f",
+			from:     gMajor,
+			to:       bFlatMajor,
+			expected: "piano:\n  (key-sig \"b- e-\") b > d f < e_ a- a\n",
+		},
+		{
+			label:    "Alda 1 key signature",
+			given:    "piano: (key-signature [:c :major]) c",
+			from:     cMajor,
+			to:       eFlatMajor,
+			expected: "piano:\n  (key-signature [:e :flat :major]) e\n",
+		},
+		{
+			label: "to another mode",
+			given: "piano: (key-sig '(c major)) c e a b (key-sig '(g major)) f",
+			from:  cMajor,
+			to:    cMinor,
+			expected: "piano:\n  (key-sig '(c minor)) c e a b " +
+				"(key-sig '(f (sharp) b (flat) e (flat) a (flat)))\n  f\n",
+		},
+		{
+			label: "to a key signature without accidentals",
+			given: "piano: (key-sig '(b (flat))) b (key-sig \"b-\") e",
+			from:  cMajor,
+			to:    gMajor,
+			expected: "piano:\n" +
+				"  (key-sig '(c major)) f < (key-sig '(c major)) b >\n",
+		},
+		{
+			label:    "down",
+			given:    "piano: c e g c+",
+			from:     cMajor,
+			to:       aMajor,
+			expected: "piano:\n  < a > c+ e < a+ >\n",
+		},
+	} {
+		actual, err := transposeDiatonicToCode(
+			testCase.given, testCase.from, testCase.to,
+		)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.label, err)
+			continue
+		}
+
+		if actual != testCase.expected {
+			t.Errorf(
+				"%s\nexpected:\n%q\nactual:\n%q",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+// readExample returns the contents of an example score in the `examples`
+// directory.
+func readExample(t *testing.T, name string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	examplesDir := filepath.Join(filepath.Dir(filepath.Dir(dir)), "examples")
+
+	contents, err := os.ReadFile(filepath.Join(examplesDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(contents)
+}
+
+// Every note of a score transposed to another key of the same mode sounds
+// higher or lower by the interval between the tonics.
+func TestTransposeDiatonicMidiNotes(t *testing.T) {
+	for _, given := range []string{
+		secondaryDominants,
+		"piano: o4 c d e f+ g a b- > c d- < b a+",
+		"riff = c e g b\n" +
+			"piano: (key-sig \"\") o3 riff (key-sig \"f+\") a b {b > c d}2 | " +
+			"V1: b/d/f V2: e f V0: c8 riff*2\n" +
+			"cello: o2 [c d e'1 b'2]*2 b*3 (octave 3) b a/b/>c/e\n" +
+			"violin: o5 c~~d~~e g~~b (key-sig '(c major)) b~~a",
+		"piano: (key-sig '(b (flat))) b e\nviolin: (key-sig \"b-\") b e",
+		"piano: V1: c8 d V2: (key-sig '(b (flat) e (flat))) b V3: b",
+		readExample(t, "key_signature.alda"),
+		readExample(t, "nesting.alda"),
+	} {
+		original := midiNotes(t, given)
+
+		for _, testCase := range []struct {
+			to        Key
+			semitones int32
+		}{
+			{eFlatMajor, 3},
+			{aMajor, -3},
+			{bMajor, -1},
+			{fSharpMajor, 6},
+			{dMajor, 2},
+			{gMajor, -5},
+			{cMajor, 0},
+		} {
+			code, err := transposeDiatonicToCode(given, cMajor, testCase.to)
+			if err != nil {
+				t.Errorf("%s (to %v): %v", given, testCase.to, err)
+				continue
+			}
+
+			transposed := midiNotes(t, code)
+			if len(transposed) != len(original) {
+				t.Errorf(
+					"%s (to %v): expected %d notes, got %d\n%s",
+					given, testCase.to, len(original), len(transposed), code,
+				)
+				continue
+			}
+
+			for i := range original {
+				if transposed[i]-original[i] != testCase.semitones {
+					t.Errorf(
+						"%s (to %v): note %d moved from %d to %d\n%s",
+						given, testCase.to, i, original[i], transposed[i], code,
+					)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestTransposeDiatonicErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		expected string
+	}{
+		{
+			label: "key signature that isn't note letters or a scale",
+			given: "piano: (key-sig '(h major)) c",
+			expected: "piece.alda:1:8 can't transpose a key signature that isn't " +
+				"written as note letters and accidentals or as the name of a scale",
+		},
+		{
+			label: "variable played with and without a key signature",
+			given: "riff = f\npiano: riff (key-sig '(g major)) riff",
+			expected: "piece.alda:1:8 can't transpose a note without accidentals " +
+				"whose key signature can't be determined without evaluating the " +
+				"score",
+		},
+		{
+			label: "note after voices with and without a key signature",
+			given: "piano: V1: (key-sig '(g major)) f V2: f V0: f",
+			expected: "piece.alda:1:45 can't transpose a note without accidentals " +
+				"whose key signature can't be determined without evaluating the " +
+				"score",
+		},
+	} {
+		_, err := transposeDiatonicToCode(testCase.given, cMajor, eFlatMajor)
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.label)
+			continue
+		}
+
+		if err.Error() != testCase.expected {
+			t.Errorf(
+				"%s\nexpected: %s\nactual: %s",
+				testCase.label, testCase.expected, err,
+			)
+		}
+	}
+}
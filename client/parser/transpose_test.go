@@ -0,0 +1,342 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+// transposeToCode transposes source code and formats the result.
+func transposeToCode(
+	given string, semitones int, opts ...transposeOption,
+) (string, error) {
+	ast, err := Parse("piece.alda", given)
+	if err != nil {
+		return "", err
+	}
+
+	transposed, err := Transpose(ast, semitones, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	buffer := bytes.Buffer{}
+	if err := FormatASTToCode(transposed, &buffer); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+func TestTranspose(t *testing.T) {
+	for _, testCase := range []struct {
+		label     string
+		given     string
+		semitones int
+		opts      []transposeOption
+		expected  string
+	}{
+		{
+			label:     "up, with sharps",
+			given:     "piano: c d e f g a b",
+			semitones: 1,
+			expected:  "piano:\n  c+ d+ f f+ g+ a+ > c <\n",
+		},
+		{
+			label:     "down, with flats",
+			given:     "piano: c d e f g a b",
+			semitones: -1,
+			expected:  "piano:\n  < b > d- e- e g- a- b-\n",
+		},
+		{
+			label:     "spelling with flats going up",
+			given:     "piano: c f",
+			semitones: 1,
+			opts:      []transposeOption{SpellWithFlats},
+			expected:  "piano:\n  d- g-\n",
+		},
+		{
+			label:     "notes crossing into the same octave",
+			given:     "piano: a b > c",
+			semitones: 3,
+			expected:  "piano:\n  > c d d+\n",
+		},
+		{
+			label:     "key signature",
+			given:     "piano: (key-sig \"f+\") e f g",
+			semitones: 2,
+			expected:  "piano:\n  (key-sig \"f+\") f g+ a\n",
+		},
+		{
+			label:     "key signature written as the name of a scale",
+			given:     "piano: (key-sig '(g minor)) b e f",
+			semitones: 2,
+			expected:  "piano:\n  > (key-sig '(g minor)) c < f g\n",
+		},
+		{
+			label:     "global key signature at the start of the score",
+			given:     "(key-sig! '(d major))\n\nviolin: f\ncello: c",
+			semitones: -1,
+			expected:  "(key-sig! '(d major))\n\nviolin:\n  f_\n\ncello:\n  c_\n",
+		},
+		{
+			label:     "chords, repeats and variables",
+			given:     "riff = b\npiano: a/b/>c a*2 riff",
+			semitones: 2,
+			expected:  "riff = > c+ <\n\npiano:\n  b / > c+ / d b *2 riff\n",
+		},
+		{
+			label:     "glissando",
+			given:     "piano: a~~b",
+			semitones: 2,
+			expected:  "piano:\n  b ~~ b++\n",
+		},
+		{
+			label:     "octave set after a crossing",
+			given:     "piano: b o3 c",
+			semitones: 1,
+			expected:  "piano:\n  > c o3 c+\n",
+		},
+		{
+			label:     "percussion skipped",
+			given:     "percussion: o2 c+ e\npiano: c",
+			semitones: 2,
+			opts:      []transposeOption{SkipPercussion},
+			expected:  "percussion:\n  o2 c+ e\n\npiano:\n  d\n",
+		},
+		{
+			label:     "no transposition",
+			given:     "piano: c+ d",
+			semitones: 0,
+			expected:  "piano:\n  c+ d\n",
+		},
+	} {
+		actual, err := transposeToCode(
+			testCase.given, testCase.semitones, testCase.opts...,
+		)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.label, err)
+			continue
+		}
+
+		if actual != testCase.expected {
+			t.Errorf(
+				"%s\nexpected:\n%q\nactual:\n%q",
+				testCase.label, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+// midiNotes returns the MIDI notes of the notes that a score plays, in the
+// order of its events, along with the MIDI notes that its glissandos slide to.
+func midiNotes(t *testing.T, code string) []int32 {
+	ast, err := Parse("piece.alda", code)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+
+	updates, err := ast.Updates()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+
+	score := model.NewScore()
+	if err := score.Update(updates...); err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+
+	notes := []int32{}
+	for _, event := range score.Events {
+		if note, ok := event.(model.NoteEvent); ok {
+			notes = append(notes, note.MidiNote)
+			if note.Glissando {
+				notes = append(notes, note.GlissandoMidiNote)
+			}
+		}
+	}
+
+	return notes
+}
+
+// Every note of a transposed score sounds exactly the given number of
+// semitones higher or lower.
+func TestTransposeMidiNotes(t *testing.T) {
+	for _, given := range []string{
+		"piano: o4 c c+ d d+ e f f+ g g+ a a+ b > c < b- e- c- b+ e+ f- c_ d++",
+		"piano: (key-sig \"b- e- a-\") o3 c d e f g a b > c d e_ a+ <<< b",
+		"riff = c e g b\n" +
+			"piano: (key-sig \"f+ c+\") o3 riff a b {b > c d}2 | V1: b/d/f " +
+			"V2: e f V0: c8 riff*2\n" +
+			"cello: o2 [c d e'1 b'2]*2 b*3 (octave 3) b a/b/>c/e\n" +
+			"violin: o5 [a b > c]*2 (key-sig! \"f+\") f g\n" +
+			"cello: c+ d_ e-",
+		"piano: c~~e~~g b~~a a~~g+",
+		"(key-sig! '(g minor))\nviolin: o4 g a b c d e f (key-sig \"\") b e\n" +
+			"cello: o2 (key-sig '(e flat major)) e a b " +
+			"(key-sig '(f sharp major)) e b",
+		"piano \"lefthand\": o2 b a\nlefthand: b\n" +
+			"violin/viola \"strings\": o4 b\nstrings.violin: a+ b",
+	} {
+		original := midiNotes(t, given)
+
+		for _, semitones := range []int{-13, -12, -7, -1, 1, 2, 5, 11, 12, 14} {
+			for _, opts := range [][]transposeOption{
+				nil, {SpellWithSharps}, {SpellWithFlats},
+			} {
+				code, err := transposeToCode(given, semitones, opts...)
+				if err != nil {
+					t.Errorf("%s (%d semitones): %v", given, semitones, err)
+					continue
+				}
+
+				transposed := midiNotes(t, code)
+				if len(transposed) != len(original) {
+					t.Errorf(
+						"%s (%d semitones): expected %d notes, got %d\n%s",
+						given, semitones, len(original), len(transposed), code,
+					)
+					continue
+				}
+
+				for i := range original {
+					if transposed[i]-original[i] != int32(semitones) {
+						t.Errorf(
+							"%s (%d semitones): note %d moved from %d to %d\n%s",
+							given, semitones, i, original[i], transposed[i], code,
+						)
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// The example scores whose key signatures are written as the names of scales,
+// e.g. `(key-sig! '(g minor))`, transpose like any other.
+func TestTransposeExamplesMidiNotes(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	examplesDir := filepath.Join(filepath.Dir(filepath.Dir(dir)), "examples")
+
+	for _, example := range []string{
+		"debussy_quartet.alda",
+		"jimenez-divertimento.alda",
+		"key_signature.alda",
+		"modes.alda",
+		"nicechord-alda-demo.alda",
+		"panning.alda",
+	} {
+		contents, err := os.ReadFile(filepath.Join(examplesDir, example))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		original := midiNotes(t, string(contents))
+
+		for _, semitones := range []int{-5, 3} {
+			code, err := transposeToCode(string(contents), semitones)
+			if err != nil {
+				t.Errorf("%s (%d semitones): %v", example, semitones, err)
+				continue
+			}
+
+			transposed := midiNotes(t, code)
+			if len(transposed) != len(original) {
+				t.Errorf(
+					"%s (%d semitones): expected %d notes, got %d",
+					example, semitones, len(original), len(transposed),
+				)
+				continue
+			}
+
+			for i := range original {
+				if transposed[i]-original[i] != int32(semitones) {
+					t.Errorf(
+						"%s (%d semitones): note %d moved from %d to %d",
+						example, semitones, i, original[i], transposed[i],
+					)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestTransposePercussionMidiNotes(t *testing.T) {
+	given := "percussion: o2 c+ e f+ (key-sig \"f+\") f\npiano: o4 c e"
+
+	code, err := transposeToCode(given, 3, SkipPercussion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The percussion notes are unchanged, and the piano notes transposed.
+	expected := midiNotes(t, given)
+	expected[4] += 3
+	expected[5] += 3
+
+	if actual := midiNotes(t, code); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected: %v\nactual: %v\n%s", expected, actual, code)
+	}
+}
+
+func TestTransposeErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		label    string
+		given    string
+		opts     []transposeOption
+		expected string
+	}{
+		{
+			label: "variable played in different key signatures",
+			given: "riff = f\npiano: riff (key-sig \"f+\") riff",
+			expected: "piece.alda:1:8 can't transpose a note without accidentals " +
+				"whose key signature can't be determined without evaluating the " +
+				"score",
+		},
+		{
+			label: "global key signature change in another part",
+			given: "violin: (key-sig! \"f+\") f\ncello: f+ f",
+			expected: "piece.alda:2:11 can't transpose a note without " +
+				"accidentals whose key signature can't be determined without " +
+				"evaluating the score",
+		},
+		{
+			label: "glissando across octaves",
+			given: "piano: d~~b",
+			expected: "piece.alda:1:8 can't transpose a glissando whose notes " +
+				"can't be written in the same octave, as octave changes can't be " +
+				"written within it",
+		},
+		{
+			label: "variable played by percussion and other parts",
+			given: "beat = c\npercussion: beat\npiano: beat",
+			opts:  []transposeOption{SkipPercussion},
+			expected: "piece.alda:1:8 can't skip a note that's played by both " +
+				"percussion and other parts",
+		},
+	} {
+		_, err := transposeToCode(testCase.given, 3, testCase.opts...)
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.label)
+			continue
+		}
+
+		if err.Error() != testCase.expected {
+			t.Errorf(
+				"%s\nexpected: %s\nactual: %s",
+				testCase.label, testCase.expected, err,
+			)
+		}
+	}
+}
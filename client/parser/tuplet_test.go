@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"testing"
+
+	"alda.io/client/model"
+	_ "alda.io/client/testing"
+)
+
+func tuplet(
+	actualNotes int32, normalNotes int32, events ...model.ScoreUpdate,
+) model.Tuplet {
+	return model.Tuplet{
+		Events: events,
+		Ratio: model.TupletRatio{
+			ActualNotes: actualNotes, NormalNotes: normalNotes,
+		},
+	}
+}
+
+func TestTuplets(t *testing.T) {
+	executeParseTestCases(
+		t,
+		parseTestCase{
+			label: "tuplet without explicit note lengths",
+			given: "{c d e f g}5:4",
+			expectUpdates: []model.ScoreUpdate{
+				tuplet(
+					5, 4,
+					letterNote(model.C), letterNote(model.D), letterNote(model.E),
+					letterNote(model.F), letterNote(model.G),
+				),
+			},
+		},
+		parseTestCase{
+			label: "tuplet with explicit note lengths",
+			given: "{c8 d e}3:2 f",
+			expectUpdates: []model.ScoreUpdate{
+				tuplet(
+					3, 2,
+					noteWithLength(model.C, 8), letterNote(model.D),
+					letterNote(model.E),
+				),
+				letterNote(model.F),
+			},
+		},
+		parseTestCase{
+			label: "nested tuplets",
+			given: "{c d {e f g}3:2}3:2",
+			expectUpdates: []model.ScoreUpdate{
+				tuplet(
+					3, 2,
+					letterNote(model.C),
+					letterNote(model.D),
+					tuplet(
+						3, 2,
+						letterNote(model.E), letterNote(model.F), letterNote(model.G),
+					),
+				),
+			},
+		},
+		parseTestCase{
+			label: "tuplet within a cram expression",
+			given: "{{c d e}3:2 f}2",
+			expectUpdates: []model.ScoreUpdate{
+				model.Cram{
+					Events: []model.ScoreUpdate{
+						tuplet(
+							3, 2,
+							letterNote(model.C), letterNote(model.D), letterNote(model.E),
+						),
+						letterNote(model.F),
+					},
+					Duration: model.Duration{
+						Components: []model.DurationComponent{
+							model.NoteLength{Denominator: 2},
+						},
+					},
+				},
+			},
+		},
+		parseTestCase{
+			label: "repeated tuplet",
+			given: "{c d e}3:2*2",
+			expectUpdates: []model.ScoreUpdate{
+				repeat(
+					tuplet(
+						3, 2,
+						letterNote(model.C), letterNote(model.D), letterNote(model.E),
+					),
+					2,
+				),
+			},
+		},
+	)
+}
+
+func TestTupletErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		given    string
+		expected string
+	}{
+		{
+			given: "piano: {c d e}0:2",
+			expected: "piece.alda:1:15 invalid tuplet ratio 0:2: both numbers " +
+				"must be positive",
+		},
+		{
+			given: "piano: {c d e}3:0",
+			expected: "piece.alda:1:15 invalid tuplet ratio 3:0: both numbers " +
+				"must be positive",
+		},
+	} {
+		_, err := Parse("piece.alda", testCase.given)
+		if err == nil {
+			t.Errorf("%s: expected an error", testCase.given)
+			continue
+		}
+
+		if actual := err.Error(); actual != testCase.expected {
+			t.Errorf(
+				"%s\nexpected error: %s\nactual error: %s",
+				testCase.given, testCase.expected, actual,
+			)
+		}
+	}
+}
+
+func TestFormatTuplets(t *testing.T) {
+	executeFormatTestCases(
+		t,
+		formatTestCase{
+			label:    "the ratio is glued to the closing brace",
+			given:    "piano: {c8 d e}3:2 {f g {a b c}3:2}3:2",
+			expected: "piano:\n  { c8 d e }3:2 { f g { a b c }3:2 }3:2\n",
+		},
+		formatTestCase{
+			label: "long tuplet",
+			given: "piano: {c d e f g a b > c d e f g a b > c d e f g a b > c d e " +
+				"f g a b > c d e f g a b}40:32",
+			expected: `piano:
+  {
+    c d e f g a b > c d e f g a b > c d e f g a b > c d e f g a b > c d e f g a
+    b
+  }40:32
+`,
+		},
+		formatTestCase{
+			label:    "minified",
+			given:    "piano: {c8 d e}3:2 f",
+			opts:     []formatterOption{ConfigureMinified(true)},
+			expected: "piano: {c8 d e}3:2 f\n",
+		},
+	)
+}
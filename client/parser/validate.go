@@ -0,0 +1,537 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"alda.io/client/model"
+)
+
+// A ValidationError describes a problem with the structure of an AST, e.g. a
+// node with the wrong number or types of children, or a literal of the wrong Go
+// type.
+type ValidationError struct {
+	// Path is the location of the problematic node within the tree, in the same
+	// form as the Path of a NodeDiff.
+	Path string
+	// Context is the source context of the problematic node, if it has one.
+	Context model.AldaSourceContext
+	// Message describes the problem.
+	Message string
+}
+
+func (ve ValidationError) Error() string {
+	msg := fmt.Sprintf("%s: %s", ve.Path, ve.Message)
+
+	if ve.Context.Line == 0 {
+		return msg
+	}
+
+	return (&model.AldaSourceError{
+		Context: ve.Context, Err: fmt.Errorf("%s", msg),
+	}).Error()
+}
+
+// A literalKind is a Go type that the literal of an AST node can have.
+type literalKind int
+
+const (
+	noLiteral literalKind = iota
+	runeLiteral
+	int32Literal
+	float64Literal
+	numberLiteral // float64, int32, int64 or int
+	stringLiteral
+)
+
+func (lk literalKind) String() string {
+	switch lk {
+	case noLiteral:
+		return "no literal"
+	case runeLiteral:
+		return "a rune literal"
+	case int32Literal:
+		return "an int32 literal"
+	case float64Literal:
+		return "a float64 literal"
+	case numberLiteral:
+		return "a numeric literal"
+	case stringLiteral:
+		return "a string literal"
+	default:
+		return fmt.Sprintf("%d (String not implemented)", lk)
+	}
+}
+
+func (lk literalKind) allows(literal interface{}) bool {
+	switch literal.(type) {
+	case nil:
+		return lk == noLiteral
+	case int32: // NB: rune is an alias for int32
+		return lk == runeLiteral || lk == int32Literal || lk == numberLiteral
+	case float64:
+		return lk == float64Literal || lk == numberLiteral
+	case int64, int:
+		return lk == numberLiteral
+	case string:
+		return lk == stringLiteral
+	default:
+		return false
+	}
+}
+
+// A nodeSpec describes the valid shape of a type of node.
+type nodeSpec struct {
+	literal literalKind
+	// required are the types that each of the node's first children can have.
+	required [][]ASTNodeType
+	// optional are the types that each of the node's subsequent children can
+	// have, if present. Each optional child can be omitted independently of the
+	// others, but the children must appear in this order.
+	optional [][]ASTNodeType
+	// rest are the types that any number of further children can have. If rest
+	// is nil, no further children are allowed.
+	rest []ASTNodeType
+	// minRest is the minimum number of further children.
+	minRest int
+	// pairs is true if the further children come in pairs, e.g. the keys and
+	// values of a Lisp map.
+	pairs bool
+}
+
+var eventTypes = []ASTNodeType{
+	AtMarkerNode,
+	BarlineNode,
+	ChordNode,
+	CramNode,
+	DynamicNode,
+	ErrorNode,
+	EventSequenceNode,
+	GlissandoNode,
+	LispListNode,
+	MarkerNode,
+	MultiMeasureRestNode,
+	NoteNode,
+	OctaveDownNode,
+	OctaveSetNode,
+	OctaveUpNode,
+	OnRepetitionsNode,
+	RepeatNode,
+	RestNode,
+	TimeSignatureNode,
+	TupletNode,
+	VariableDefinitionNode,
+	VariableReferenceNode,
+	VoiceGroupEndMarkerNode,
+	VoiceGroupNode,
+}
+
+var lispFormTypes = []ASTNodeType{
+	LispKeywordNode,
+	LispListNode,
+	LispMapNode,
+	LispNumberNode,
+	LispQuotedFormNode,
+	LispStringNode,
+	LispSymbolNode,
+	LispVectorNode,
+}
+
+func one(types ...ASTNodeType) [][]ASTNodeType {
+	return [][]ASTNodeType{types}
+}
+
+// nodeSpecs describes the grammar of an AST, i.e. the constraints that the
+// parser satisfies and the formatter and ASTNode.Updates rely on.
+var nodeSpecs = map[ASTNodeType]nodeSpec{
+	AtMarkerNode: {literal: stringLiteral},
+	BarlineNode:  {},
+	// An empty chord is allowed, so that the formatter can format it, but it
+	// can't be played (see ASTNode.Updates).
+	ChordNode: {
+		rest: []ASTNodeType{
+			NoteNode, RestNode, OctaveDownNode, OctaveSetNode, OctaveUpNode,
+			LispListNode,
+		},
+	},
+	CramNode: {
+		required: one(EventSequenceNode),
+		optional: one(DurationNode),
+	},
+	DenominatorNode: {literal: float64Literal},
+	DotsNode:        {literal: int32Literal},
+	DurationNode: {
+		rest: []ASTNodeType{
+			NoteLengthNode, NoteLengthMsNode, NoteLengthSecondsNode, BarlineNode,
+		},
+		minRest: 1,
+	},
+	DynamicNode:         {literal: stringLiteral},
+	ErrorNode:           {literal: stringLiteral},
+	EventSequenceNode:   {rest: eventTypes},
+	FirstRepetitionNode: {literal: int32Literal},
+	FlatNode:            {},
+	GlissandoNode: {
+		required: one(NoteNode),
+		rest:     []ASTNodeType{NoteNode, BarlineNode},
+		minRest:  1,
+	},
+	ImplicitPartNode:   {required: one(EventSequenceNode)},
+	LastRepetitionNode: {literal: int32Literal},
+	LispKeywordNode:    {literal: stringLiteral},
+	LispListNode:       {rest: lispFormTypes},
+	LispMapNode:        {rest: lispFormTypes, pairs: true},
+	LispNumberNode:     {literal: numberLiteral},
+	LispQuotedFormNode: {required: [][]ASTNodeType{lispFormTypes}},
+	LispStringNode:     {literal: stringLiteral},
+	LispSymbolNode:     {literal: stringLiteral},
+	LispVectorNode:     {rest: lispFormTypes},
+	MarkerNode:         {literal: stringLiteral},
+	MultiMeasureRestNode: {
+		literal: int32Literal,
+	},
+	NaturalNode: {},
+	NoteAccidentalsNode: {
+		rest: []ASTNodeType{FlatNode, NaturalNode, SharpNode}, minRest: 1,
+	},
+	NoteLengthMsNode: {literal: float64Literal},
+	NoteLengthNode: {
+		required: one(DenominatorNode),
+		optional: one(DotsNode),
+	},
+	NoteLengthSecondsNode: {literal: float64Literal},
+	NoteLetterAndAccidentalsNode: {
+		required: one(NoteLetterNode),
+		optional: one(NoteAccidentalsNode),
+	},
+	NoteLetterNode: {literal: runeLiteral},
+	NoteNode: {
+		required: one(NoteLetterAndAccidentalsNode),
+		optional: [][]ASTNodeType{{DurationNode}, {TieNode}},
+	},
+	OctaveDownNode: {},
+	OctaveSetNode:  {literal: int32Literal},
+	OctaveUpNode:   {},
+	OnRepetitionsNode: {
+		required: [][]ASTNodeType{eventTypes, {RepetitionsNode}},
+	},
+	PartAliasNode: {literal: stringLiteral},
+	PartDeclarationNode: {
+		required: one(PartNamesNode),
+		optional: one(PartAliasNode),
+	},
+	PartNameNode:  {literal: stringLiteral},
+	PartNamesNode: {rest: []ASTNodeType{PartNameNode}, minRest: 1},
+	PartNode: {
+		required: [][]ASTNodeType{{PartDeclarationNode}, {EventSequenceNode}},
+	},
+	RepeatNode: {
+		required: [][]ASTNodeType{eventTypes, {TimesNode}},
+	},
+	RepetitionRangeNode: {
+		required: [][]ASTNodeType{{FirstRepetitionNode}, {LastRepetitionNode}},
+	},
+	RepetitionsNode: {
+		rest: []ASTNodeType{RepetitionRangeNode}, minRest: 1,
+	},
+	RestNode:  {optional: one(DurationNode)},
+	RootNode:  {rest: []ASTNodeType{ErrorNode, ImplicitPartNode, PartNode}},
+	SharpNode: {},
+	TieNode:   {},
+	TimeSignatureDenominatorNode: {
+		literal: int32Literal,
+	},
+	TimeSignatureNode: {
+		required: [][]ASTNodeType{
+			{TimeSignatureNumeratorNode}, {TimeSignatureDenominatorNode},
+		},
+	},
+	TimeSignatureNumeratorNode: {
+		literal: int32Literal,
+	},
+	TimesNode: {literal: int32Literal},
+	TupletActualNotesNode: {
+		literal: int32Literal,
+	},
+	TupletNode: {
+		required: [][]ASTNodeType{
+			{EventSequenceNode}, {TupletActualNotesNode}, {TupletNormalNotesNode},
+		},
+	},
+	TupletNormalNotesNode: {
+		literal: int32Literal,
+	},
+	VariableDefinitionNode: {
+		required: [][]ASTNodeType{{VariableNameNode}, {EventSequenceNode}},
+	},
+	VariableNameNode:        {literal: stringLiteral},
+	VariableReferenceNode:   {literal: stringLiteral},
+	VoiceGroupEndMarkerNode: {},
+	VoiceGroupNode: {
+		rest: []ASTNodeType{VoiceNode, VoiceGroupEndMarkerNode}, minRest: 1,
+	},
+	VoiceNode: {
+		required: [][]ASTNodeType{{VoiceNumberNode}, {EventSequenceNode}},
+	},
+	VoiceNumberNode: {literal: int32Literal},
+}
+
+// ValidateAST checks the structure of an AST against the grammar that the
+// parser produces, i.e. the number and types of each node's children and the
+// Go type of each node's literal. It returns every problem that it finds, in
+// the order in which the problematic nodes appear in the tree.
+//
+// An ErrorNode, which stands in for input that couldn't be parsed (see Parse),
+// is also reported as a problem.
+func ValidateAST(root ASTNode) []ValidationError {
+	return validateAST(root, false, false)
+}
+
+// validateAST is like ValidateAST, but optionally allows ErrorNodes, and nodes
+// of unknown types that the formatter can write as text (see
+// unknownNodeText).
+func validateAST(
+	root ASTNode, allowErrors bool, allowUnknownText bool,
+) []ValidationError {
+	v := &validator{
+		root:             root.Type,
+		problems:         []ValidationError{},
+		allowErrors:      allowErrors,
+		allowUnknownText: allowUnknownText,
+	}
+	v.validate(root)
+	return v.problems
+}
+
+// A validator validates an AST, keeping track of where it is in the tree so
+// that it can describe the path to a problematic node.
+//
+// NB: The path is only built when there's a problem to report, because
+// building it for every node of a large AST is expensive.
+type validator struct {
+	root        ASTNodeType
+	steps       []validationStep
+	problems    []ValidationError
+	allowErrors bool
+	// Whether to allow nodes of unknown types that have text (see
+	// unknownNodeText)
+	allowUnknownText bool
+}
+
+// A validationStep is a step along the path from the root to the node being
+// validated, i.e. the index of a node among its siblings.
+type validationStep struct {
+	siblings []ASTNode
+	index    int
+}
+
+// path returns the path to the node being validated (see ValidationError),
+// or to its child at the given index, if childIndex isn't -1.
+func (v *validator) path(node ASTNode, childIndex int) string {
+	path := strings.Builder{}
+	path.WriteString(v.root.String())
+
+	for _, step := range v.steps {
+		path.WriteString("/" + childPathSegment(step.siblings, step.index))
+	}
+
+	if childIndex >= 0 {
+		path.WriteString("/" + childPathSegment(node.Children, childIndex))
+	}
+
+	return path.String()
+}
+
+func (v *validator) report(
+	node ASTNode, path string, format string, args ...interface{},
+) {
+	v.problems = append(v.problems, ValidationError{
+		Path:    path,
+		Context: node.SourceContext,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) allowsUnknownText(node ASTNode) bool {
+	_, hasText := unknownNodeText(node)
+	return v.allowUnknownText && hasText
+}
+
+func (v *validator) validate(node ASTNode) {
+	spec, ok := nodeSpecs[node.Type]
+	if !ok {
+		if v.allowsUnknownText(node) {
+			return
+		}
+
+		v.report(
+			node, v.path(node, -1), "unknown node type %s", node.Type.String(),
+		)
+		return
+	}
+
+	if node.Type == ErrorNode && !v.allowErrors {
+		v.report(node, v.path(node, -1), "syntax error: %v", node.Literal)
+	}
+
+	if !spec.literal.allows(node.Literal) {
+		literal := "no literal"
+		if node.Literal != nil {
+			literal = fmt.Sprintf("%T %#v", node.Literal, node.Literal)
+		}
+
+		v.report(
+			node, v.path(node, -1), "expected %s to have %s, but it has %s",
+			node.Type.String(), spec.literal.String(), literal,
+		)
+	}
+
+	childCountOK := spec.allowsChildren(len(node.Children))
+	if !childCountOK {
+		v.report(
+			node, v.path(node, -1), "expected %s to have %s, but it has %d",
+			node.Type.String(), spec.expectedChildren(), len(node.Children),
+		)
+	}
+
+	nextOptional := 0
+
+	for i, child := range node.Children {
+		switch {
+		case node.Type == EventSequenceNode && v.allowsUnknownText(child):
+			// Written as text, wherever an event can be (see unknownNodeText)
+
+		case i < len(spec.required):
+			if !containsType(spec.required[i], child.Type) {
+				v.report(
+					child, v.path(node, i), "expected %s but got %s",
+					joinTypes(spec.required[i]), child.describe(),
+				)
+			}
+
+		default:
+			matched := false
+			for j := nextOptional; j < len(spec.optional); j++ {
+				if containsType(spec.optional[j], child.Type) {
+					nextOptional = j + 1
+					matched = true
+					break
+				}
+			}
+
+			switch {
+			case matched:
+			case spec.rest != nil && containsType(spec.rest, child.Type):
+				nextOptional = len(spec.optional)
+			case nextOptional < len(spec.optional):
+				v.report(
+					child, v.path(node, i), "expected %s but got %s",
+					joinTypes(spec.optional[nextOptional]), child.describe(),
+				)
+			case spec.rest != nil || childCountOK:
+				v.report(
+					child, v.path(node, i), "unexpected %s in %s",
+					child.describe(), node.Type.String(),
+				)
+			}
+			// Otherwise, there are too many children, which we've already
+			// reported.
+		}
+
+		v.steps = append(v.steps, validationStep{node.Children, i})
+		v.validate(child)
+		v.steps = v.steps[:len(v.steps)-1]
+	}
+}
+
+// allowsChildren reports whether the spec allows a node to have n children.
+func (spec nodeSpec) allowsChildren(n int) bool {
+	min := len(spec.required) + spec.minRest
+
+	if spec.rest != nil {
+		return n >= min && (!spec.pairs || (n-len(spec.required))%2 == 0)
+	}
+
+	return min <= n && n <= len(spec.required)+len(spec.optional)
+}
+
+// expectedChildren returns a description of the number of children that the
+// spec allows.
+func (spec nodeSpec) expectedChildren() string {
+	min := len(spec.required) + spec.minRest
+
+	if spec.pairs {
+		return "an even number of children"
+	}
+
+	if spec.rest != nil {
+		return fmt.Sprintf("at least %s", pluralChildren(min))
+	}
+
+	max := len(spec.required) + len(spec.optional)
+
+	counts := []string{}
+	for i := min; i <= max; i++ {
+		counts = append(counts, fmt.Sprintf("%d", i))
+	}
+
+	if len(counts) == 1 {
+		return pluralChildren(min)
+	}
+
+	return strings.Join(counts[:len(counts)-1], ", ") +
+		" or " + counts[len(counts)-1] + " children"
+}
+
+func pluralChildren(n int) string {
+	if n == 1 {
+		return "1 child"
+	}
+
+	return fmt.Sprintf("%d children", n)
+}
+
+func containsType(types []ASTNodeType, nodeType ASTNodeType) bool {
+	for _, t := range types {
+		if t == nodeType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sameTypes(a []ASTNodeType, b []ASTNodeType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// joinTypes returns a description of a list of node types, e.g.
+// "NoteNode, RestNode or ChordNode", or "an event".
+func joinTypes(types []ASTNodeType) string {
+	names := []string{}
+	for _, t := range types {
+		names = append(names, t.String())
+	}
+
+	switch {
+	case len(names) == 1:
+		return names[0]
+	case sameTypes(types, eventTypes):
+		return "an event"
+	case sameTypes(types, lispFormTypes):
+		return "a Lisp form"
+	}
+
+	return strings.Join(names[:len(names)-1], ", ") + " or " +
+		names[len(names)-1]
+}
@@ -0,0 +1,269 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "alda.io/client/testing"
+	"github.com/go-test/deep"
+)
+
+func TestValidateASTNodeSpecs(t *testing.T) {
+	for nodeType := ASTNodeType(0); nodeType < numASTNodeTypes; nodeType++ {
+		if _, ok := nodeSpecs[nodeType]; !ok {
+			t.Errorf("no spec for %s", nodeType.String())
+		}
+	}
+}
+
+func TestValidateASTExamples(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	examplesDir := filepath.Join(filepath.Dir(filepath.Dir(dir)), "examples")
+
+	paths, err := filepath.Glob(filepath.Join(examplesDir, "*.alda"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		ast, err := ParseFile(path)
+		if err != nil {
+			t.Error(path)
+			t.Errorf("%v\n", err)
+			continue
+		}
+
+		for _, problem := range ValidateAST(ast) {
+			t.Errorf("%s: %v", path, problem)
+		}
+	}
+}
+
+type validateTestCase struct {
+	label    string
+	given    ASTNode
+	expected []string
+}
+
+func executeValidateTestCases(t *testing.T, testCases ...validateTestCase) {
+	for _, testCase := range testCases {
+		actual := []string{}
+		for _, problem := range ValidateAST(testCase.given) {
+			actual = append(actual, problem.Error())
+		}
+
+		if diff := deep.Equal(testCase.expected, actual); diff != nil {
+			t.Error(testCase.label)
+			for _, diffItem := range diff {
+				t.Errorf("%v", diffItem)
+			}
+		}
+
+		// None of these ASTs should make it past the formatter's validation, and
+		// in particular, none of them should cause the formatter to panic.
+		if err := FormatASTToCode(testCase.given, &bytes.Buffer{}); err == nil {
+			t.Error(testCase.label)
+			t.Error("expected formatting to fail")
+		}
+	}
+}
+
+func TestValidateAST(t *testing.T) {
+	note := func(letter rune) ASTNode {
+		return ASTNode{
+			Type: NoteNode, Children: []ASTNode{letterAndAccidentals(letter)},
+		}
+	}
+
+	executeValidateTestCases(
+		t,
+		validateTestCase{
+			label: "octave set with a string literal",
+			given: implicitPart(ASTNode{Type: OctaveSetNode, Literal: "4"}),
+			expected: []string{
+				"RootNode/ImplicitPartNode/EventSequenceNode/OctaveSetNode: " +
+					`expected OctaveSetNode to have an int32 literal, but it has ` +
+					`string "4"`,
+			},
+		},
+		validateTestCase{
+			label: "note letter with a string literal",
+			given: implicitPart(ASTNode{Type: NoteNode, Children: []ASTNode{{
+				Type: NoteLetterAndAccidentalsNode,
+				Children: []ASTNode{
+					{Type: NoteLetterNode, Literal: "c", SourceContext: at(2, 3)},
+				},
+			}}}),
+			expected: []string{
+				"piece.alda:2:3 RootNode/ImplicitPartNode/EventSequenceNode/" +
+					"NoteNode/NoteLetterAndAccidentalsNode/NoteLetterNode: " +
+					`expected NoteLetterNode to have a rune literal, but it has ` +
+					`string "c"`,
+			},
+		},
+		validateTestCase{
+			label: "denominator with an int literal",
+			given: implicitPart(ASTNode{Type: RestNode, Children: []ASTNode{{
+				Type: DurationNode,
+				Children: []ASTNode{{
+					Type:     NoteLengthNode,
+					Children: []ASTNode{{Type: DenominatorNode, Literal: 4}},
+				}},
+			}}}),
+			expected: []string{
+				"RootNode/ImplicitPartNode/EventSequenceNode/RestNode/" +
+					"DurationNode/NoteLengthNode/DenominatorNode: expected " +
+					"DenominatorNode to have a float64 literal, but it has int 4",
+			},
+		},
+		validateTestCase{
+			label: "marker without a literal",
+			given: implicitPart(ASTNode{Type: MarkerNode}),
+			expected: []string{
+				"RootNode/ImplicitPartNode/EventSequenceNode/MarkerNode: " +
+					"expected MarkerNode to have a string literal, but it has no " +
+					"literal",
+			},
+		},
+		validateTestCase{
+			label: "barline with a literal",
+			given: implicitPart(ASTNode{Type: BarlineNode, Literal: "|"}),
+			expected: []string{
+				"RootNode/ImplicitPartNode/EventSequenceNode/BarlineNode: " +
+					`expected BarlineNode to have no literal, but it has string "|"`,
+			},
+		},
+		validateTestCase{
+			label: "repeat with a float times literal",
+			given: implicitPart(ASTNode{Type: RepeatNode, Children: []ASTNode{
+				note('c'),
+				{Type: TimesNode, Literal: 2.0},
+			}}),
+			expected: []string{
+				"RootNode/ImplicitPartNode/EventSequenceNode/RepeatNode/" +
+					"TimesNode: expected TimesNode to have an int32 literal, but " +
+					"it has float64 2",
+			},
+		},
+		validateTestCase{
+			label: "part with too many children",
+			given: ASTNode{Type: RootNode, Children: []ASTNode{{
+				Type: PartNode,
+				Children: []ASTNode{
+					{Type: PartDeclarationNode, Children: []ASTNode{{
+						Type:     PartNamesNode,
+						Children: []ASTNode{{Type: PartNameNode, Literal: "piano"}},
+					}}},
+					{Type: EventSequenceNode},
+					{Type: EventSequenceNode},
+				},
+			}}},
+			expected: []string{
+				"RootNode/PartNode: expected PartNode to have 2 children, but it " +
+					"has 3",
+			},
+		},
+		validateTestCase{
+			label: "part declaration without names",
+			given: ASTNode{Type: RootNode, Children: []ASTNode{{
+				Type: PartNode,
+				Children: []ASTNode{
+					{Type: PartDeclarationNode, Children: []ASTNode{{
+						Type: PartNamesNode,
+					}}},
+					{Type: EventSequenceNode},
+				},
+			}}},
+			expected: []string{
+				"RootNode/PartNode/PartDeclarationNode/PartNamesNode: expected " +
+					"PartNamesNode to have at least 1 child, but it has 0",
+			},
+		},
+		validateTestCase{
+			label: "event at the top level",
+			given: ASTNode{Type: RootNode, Children: []ASTNode{note('c')}},
+			expected: []string{
+				"RootNode/NoteNode: unexpected NoteNode (1 child) in RootNode",
+			},
+		},
+		validateTestCase{
+			label: "note with children out of order",
+			given: implicitPart(ASTNode{Type: NoteNode, Children: []ASTNode{
+				letterAndAccidentals('c'),
+				{Type: TieNode},
+				{Type: DurationNode, Children: []ASTNode{
+					{Type: NoteLengthMsNode, Literal: 100.0},
+				}},
+			}}),
+			expected: []string{
+				"RootNode/ImplicitPartNode/EventSequenceNode/NoteNode/" +
+					"DurationNode: unexpected DurationNode (1 child) in NoteNode",
+			},
+		},
+		validateTestCase{
+			label: "voice group containing an event",
+			given: implicitPart(ASTNode{Type: VoiceGroupNode, Children: []ASTNode{
+				note('c'),
+			}}),
+			expected: []string{
+				"RootNode/ImplicitPartNode/EventSequenceNode/VoiceGroupNode/" +
+					"NoteNode: unexpected NoteNode (1 child) in VoiceGroupNode",
+			},
+		},
+		validateTestCase{
+			label: "quoted form of a non-Lisp node",
+			given: implicitPart(ASTNode{Type: LispListNode, Children: []ASTNode{
+				{Type: LispSymbolNode, Literal: "key-sig"},
+				{Type: LispQuotedFormNode, Children: []ASTNode{note('c')}},
+			}}),
+			expected: []string{
+				"RootNode/ImplicitPartNode/EventSequenceNode/LispListNode/" +
+					"LispQuotedFormNode/NoteNode: expected a Lisp form but got " +
+					"NoteNode (1 child)",
+			},
+		},
+		validateTestCase{
+			label: "unknown node type",
+			given: implicitPart(ASTNode{Type: numASTNodeTypes + 1}),
+			expected: []string{
+				"RootNode/ImplicitPartNode/EventSequenceNode/64 (String not " +
+					"implemented): unexpected 64 (String not implemented) in " +
+					"EventSequenceNode",
+				"RootNode/ImplicitPartNode/EventSequenceNode/64 (String not " +
+					"implemented): unknown node type 64 (String not implemented)",
+			},
+		},
+		validateTestCase{
+			label: "multiple problems are all reported, in order",
+			given: implicitPart(
+				ASTNode{Type: OctaveSetNode, Literal: int64(4)},
+				note('c'),
+				ASTNode{Type: GlissandoNode},
+				ASTNode{Type: VariableReferenceNode, Literal: 'x'},
+			),
+			expected: []string{
+				"RootNode/ImplicitPartNode/EventSequenceNode/OctaveSetNode: " +
+					"expected OctaveSetNode to have an int32 literal, but it has " +
+					"int64 4",
+				"RootNode/ImplicitPartNode/EventSequenceNode/GlissandoNode: " +
+					"expected GlissandoNode to have at least 2 children, but it has 0",
+				"RootNode/ImplicitPartNode/EventSequenceNode/" +
+					"VariableReferenceNode: expected VariableReferenceNode to have " +
+					"a string literal, but it has int32 120",
+			},
+		},
+	)
+}
+
+func letterAndAccidentals(letter rune) ASTNode {
+	return ASTNode{
+		Type:     NoteLetterAndAccidentalsNode,
+		Children: []ASTNode{{Type: NoteLetterNode, Literal: letter}},
+	}
+}
@@ -20,11 +20,11 @@ func IsInputBeingPipedIn() (bool, error) {
 
 var ErrNoInputSupplied = fmt.Errorf("no input supplied")
 
-// Reads all bytes piped into stdin and returns them.
+// Returns a reader of the input piped into stdin.
 //
 // Returns the error `ErrNoInputSupplied` if no input is being piped in, or a
 // different error if something else went wrong.
-func ReadStdin() ([]byte, error) {
+func StdinReader() (io.Reader, error) {
 	isInputSupplied, err := IsInputBeingPipedIn()
 	if err != nil {
 		return nil, err
@@ -34,7 +34,20 @@ func ReadStdin() ([]byte, error) {
 		return nil, ErrNoInputSupplied
 	}
 
-	bytes, err := io.ReadAll(os.Stdin)
+	return os.Stdin, nil
+}
+
+// Reads all bytes piped into stdin and returns them.
+//
+// Returns the error `ErrNoInputSupplied` if no input is being piped in, or a
+// different error if something else went wrong.
+func ReadStdin() ([]byte, error) {
+	reader, err := StdinReader()
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +93,48 @@ func midiPanningMsg(track int32, offset int32, panning int32) *osc.Message {
 	return msg
 }
 
+func midiPitchBendMsg(
+	track int32, offset int32, semitones float32,
+) *osc.Message {
+	msg := osc.NewMessage(fmt.Sprintf("/track/%d/midi/pitch-bend", track))
+	msg.Append(offset)
+	msg.Append(semitones)
+	return msg
+}
+
+// glissandoStepMs is the approximate time between pitch bend messages in a
+// glissando. It's short enough that the slide sounds continuous.
+const glissandoStepMs = 25
+
+// glissandoMessages returns pitch bend messages that slide the pitch of a track
+// from the note's pitch to the pitch of the next note in the glissando, over
+// the audible duration of the note, and then reset the pitch at the end.
+func glissandoMessages(
+	track int32, offset float64, note model.NoteEvent,
+) []*osc.Message {
+	semitones := float64(note.GlissandoMidiNote - note.MidiNote)
+	steps := int(math.Max(2, math.Round(note.AudibleDuration/glissandoStepMs)))
+
+	msgs := []*osc.Message{}
+
+	// The pitch reaches the next note's pitch one step before the note ends, so
+	// that the last bend doesn't coincide with the reset below.
+	for i := 0; i < steps; i++ {
+		stepOffset := offset + note.AudibleDuration*float64(i)/float64(steps)
+		bend := semitones * float64(i) / float64(steps-1)
+
+		msgs = append(msgs, midiPitchBendMsg(
+			track, int32(math.Round(stepOffset)), float32(bend),
+		))
+	}
+
+	// The note might be followed by another note in the same glissando, so we
+	// reset the pitch right when the note ends, in time for the next note.
+	return append(msgs, midiPitchBendMsg(
+		track, int32(math.Round(offset+note.AudibleDuration)), 0,
+	))
+}
+
 func oscClient(port int) *osc.Client {
 	return osc.NewClient("localhost", int(port), osc.ClientProtocol(osc.TCP))
 }
@@ -388,6 +430,12 @@ func (oe OSCTransmitter) ScoreToOSCBundle(
 				int32(math.Round(event.Volume*127)),
 			))
 
+			if event.Glissando {
+				for _, msg := range glissandoMessages(track, offset, event) {
+					bundle.Append(msg)
+				}
+			}
+
 			scoreLength = math.Max(scoreLength, offset+event.AudibleDuration)
 		default:
 			return nil, fmt.Errorf("unsupported event: %#v", event)
@@ -0,0 +1,95 @@
+package transmitter
+
+import (
+	"testing"
+
+	"alda.io/client/model"
+	"alda.io/client/parser"
+	_ "alda.io/client/testing"
+	"github.com/daveyarwood/go-osc/osc"
+)
+
+// The pitch bend messages of a glissando are sent to the player in the same
+// form as the player's `/track/{number}/midi/pitch-bend` handler reads them: an
+// int offset and a float number of semitones.
+func TestGlissandoPitchBendMessages(t *testing.T) {
+	ast, err := parser.Parse("piece.alda", "piano: c2 ~~ g2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates, err := ast.Updates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score := model.NewScore()
+	if err := score.Update(updates...); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := OSCTransmitter{}.ScoreToOSCBundle(score)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bundle is sent over the wire, so we check the messages as they're
+	// received.
+	data, err := bundle.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet, err := osc.ParsePacket(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offsets := []int32{}
+	bends := []float32{}
+	for _, msg := range packet.(*osc.Bundle).Messages {
+		if msg.Address != "/track/1/midi/pitch-bend" {
+			continue
+		}
+
+		if len(msg.Arguments) != 2 {
+			t.Fatalf("expected 2 arguments, got %#v", msg.Arguments)
+		}
+
+		offset, ok := msg.Arguments[0].(int32)
+		if !ok {
+			t.Fatalf("expected an int32 offset, got %#v", msg.Arguments[0])
+		}
+
+		bend, ok := msg.Arguments[1].(float32)
+		if !ok {
+			t.Fatalf("expected float32 semitones, got %#v", msg.Arguments[1])
+		}
+
+		offsets = append(offsets, offset)
+		bends = append(bends, bend)
+	}
+
+	if len(bends) < 3 {
+		t.Fatalf("expected pitch bend messages, got %v", bends)
+	}
+
+	// The pitch slides from C up to G over the audible duration of the half
+	// note (900 ms at 120 bpm), and is reset when the note ends.
+	last := len(bends) - 1
+	if bends[0] != 0 || bends[last-1] != 7 || bends[last] != 0 {
+		t.Errorf("expected the pitch to bend from 0 to 7 and back to 0, got %v",
+			bends)
+	}
+
+	if offsets[0] != 0 || offsets[last] != 900 {
+		t.Errorf("expected pitch bends from 0 to 900 ms, got %v", offsets)
+	}
+
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] < offsets[i-1] {
+			t.Errorf("expected pitch bends in order, got %v", offsets)
+			break
+		}
+	}
+}
@@ -37,6 +37,17 @@ const val MIDI_VIBRATO_DEPTH = 77
 const val MIDI_VIBRATO_DELAY = 78
 const val MIDI_REVERB        = 91
 const val MIDI_CHORUS        = 93
+// Registered parameter number (RPN) 0 is the pitch bend range.
+// ref: https://www.midi.org/specifications-old/item/table-3-control-change-messages-data-bytes-2
+const val MIDI_RPN_MSB       = 101
+const val MIDI_RPN_LSB       = 100
+const val MIDI_DATA_ENTRY    = 6
+const val MIDI_DATA_ENTRY_LSB = 38
+
+// The pitch bend range, in semitones, that we configure on a channel before
+// bending its pitch. This is wide enough to cover a glissando of up to two
+// octaves in either direction.
+const val PITCH_BEND_RANGE   = 24
 
 const val DIVISION_TYPE = Sequence.PPQ
 // This ought to allow for notes as fast as 512th notes at a tempo of 120 bpm,
@@ -445,6 +456,37 @@ class MidiEngine {
     )
   }
 
+  // Bends the pitch of the channel by `semitones`, which can be fractional and
+  // must be within PITCH_BEND_RANGE in either direction.
+  //
+  // MIDI pitch bend applies to the whole channel, not to a single note, so any
+  // other notes sounding on the channel at the same time (e.g. the other notes
+  // of a chord, or the notes of other voices in the part) are bent too.
+  //
+  // We set the channel's pitch bend range each time, because the default range
+  // (2 semitones) isn't wide enough for most glissandi, and there's no telling
+  // what other tracks might have done with the channel.
+  fun pitchBend(offset : Int, channel : Int, semitones : Float) {
+    listOf(
+      Pair(MIDI_RPN_MSB, 0),
+      Pair(MIDI_RPN_LSB, 0),
+      Pair(MIDI_DATA_ENTRY, PITCH_BEND_RANGE),
+      Pair(MIDI_DATA_ENTRY_LSB, 0)
+    ).forEach { (control, value) ->
+      scheduleShortMsg(
+        offset, ShortMessage.CONTROL_CHANGE, channel, control, value
+      )
+    }
+
+    // Pitch bend values are 14-bit, with 8192 meaning "no bend."
+    val value = Math.round(8192 + (semitones / PITCH_BEND_RANGE) * 8192)
+      .coerceIn(0, 16383)
+
+    scheduleShortMsg(
+      offset, ShortMessage.PITCH_BEND, channel, value and 0x7F, value shr 7
+    )
+  }
+
   // Schedules an event to occur at the desired offset.
   //
   // Returns a CountDownLatch that will count down from 1 to 0 when the event is
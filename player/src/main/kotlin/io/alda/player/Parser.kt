@@ -117,6 +117,21 @@ class MidiPanningEvent(
   override fun endOffset() = 0
 }
 
+// Bends the pitch of the track's whole channel (see MidiEngine.pitchBend).
+class MidiPitchBendEvent(
+  val offset : Int, val semitones : Float
+) : Event, Schedulable {
+  override fun addOffset(o : Int) : MidiPitchBendEvent {
+    return MidiPitchBendEvent(offset + o, semitones)
+  }
+
+  override fun schedule(channel : Int) {
+    midi().pitchBend(offset, channel, semitones)
+  }
+
+  override fun endOffset() = 0
+}
+
 abstract class PatternEventBase(
   open val offset : Int, open val patternName : String
 ) {
@@ -336,6 +351,14 @@ class Updates() {
           addTrackEvent(trackNumber(address), MidiPanningEvent(offset, panning))
         }
 
+        Regex("/track/\\d+/midi/pitch-bend").matches(address) -> {
+          val offset    = args.get(0) as Int
+          val semitones = args.get(1) as Float
+          addTrackEvent(
+            trackNumber(address), MidiPitchBendEvent(offset, semitones)
+          )
+        }
+
         Regex("/track/\\d+/pattern").matches(address) -> {
           val offset      = args.get(0) as Int
           val patternName = args.get(1) as String